@@ -76,6 +76,8 @@ func main() {
 	var noBrowser bool
 	var projectID string
 	var configPath string
+	var replayPath string
+	var validateConfig bool
 
 	// Define command-line flags for different operation modes.
 	flag.BoolVar(&login, "login", false, "Login Google Account")
@@ -86,6 +88,8 @@ func main() {
 	flag.BoolVar(&noBrowser, "no-browser", false, "Don't open browser automatically for OAuth")
 	flag.StringVar(&projectID, "project_id", "", "Project ID (Gemini only, not required)")
 	flag.StringVar(&configPath, "config", "", "Configure File Path")
+	flag.StringVar(&replayPath, "replay", "", "Replay a captured request file against its recorded upstream responses")
+	flag.BoolVar(&validateConfig, "validate-config", false, "Check the config file and accounts, print a report, and exit")
 
 	// Parse the command-line flags.
 	flag.Parse()
@@ -111,11 +115,15 @@ func main() {
 		cfg, err = config.LoadConfig(configFilePath)
 	}
 	if err != nil {
+		if validateConfig {
+			cmd.DoValidateConfig(nil, configFilePath, err)
+		}
 		log.Fatalf("failed to load config: %v", err)
 	}
 
 	// Set the log level based on the configuration.
 	util.SetLogLevel(cfg)
+	util.SetReasoningBudgets(cfg)
 
 	// Expand the tilde (~) in the auth directory path to the user's home directory.
 	if strings.HasPrefix(cfg.AuthDir, "~") {
@@ -142,7 +150,10 @@ func main() {
 
 	// Handle different command modes based on the provided flags.
 
-	if login {
+	if validateConfig {
+		// Check the configuration and exit without starting the server
+		cmd.DoValidateConfig(cfg, configFilePath, nil)
+	} else if login {
 		// Handle Google/Gemini login
 		cmd.DoLogin(cfg, projectID, options)
 	} else if codexLogin {
@@ -155,6 +166,8 @@ func main() {
 		cmd.DoQwenLogin(cfg, options)
 	} else if geminiWebAuth {
 		cmd.DoGeminiWebAuth(cfg)
+	} else if replayPath != "" {
+		cmd.DoReplay(cfg, replayPath)
 	} else {
 		// Start the main proxy service
 		cmd.StartService(cfg, configFilePath)
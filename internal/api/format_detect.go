@@ -0,0 +1,157 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/api/handlers"
+	"github.com/luispater/CLIProxyAPI/v5/internal/api/handlers/claude"
+	"github.com/luispater/CLIProxyAPI/v5/internal/api/handlers/gemini"
+	"github.com/luispater/CLIProxyAPI/v5/internal/api/handlers/openai"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// acceptFormats maps the values of the "format" parameter of the Accept header to the API
+// formats served by the generic endpoint.
+var acceptFormats = map[string]string{
+	"openai":           OPENAI,
+	"openai-response":  OPENAI_RESPONSE,
+	"openai-responses": OPENAI_RESPONSE,
+	"anthropic":        CLAUDE,
+	"claude":           CLAUDE,
+	"gemini":           GEMINI,
+}
+
+// detectRequestFormat selects the API format of a request sent to the generic endpoint.
+// The first rule that matches wins:
+//  1. The "format" parameter of a media type in the Accept header, e.g.
+//     "Accept: application/json; format=anthropic" (openai, openai-response, anthropic, gemini).
+//  2. An anthropic-version header selects Anthropic Messages.
+//  3. The shape of the body: "contents" selects Gemini; "input" without "messages" selects
+//     OpenAI Responses; "messages" with a top-level "system", Anthropic content blocks
+//     (tool_use, tool_result, image with a source), or "stop_sequences" selects Anthropic.
+//  4. Otherwise the request is an OpenAI chat completion.
+//
+// Parameters:
+//   - c: The Gin context of the request
+//   - rawJSON: The raw JSON request body
+//
+// Returns:
+//   - string: The API format (OPENAI, OPENAI_RESPONSE, CLAUDE, or GEMINI)
+func detectRequestFormat(c *gin.Context, rawJSON []byte) string {
+	for _, accepted := range strings.Split(c.GetHeader("Accept"), ",") {
+		_, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		if format, ok := acceptFormats[strings.ToLower(params["format"])]; ok {
+			return format
+		}
+	}
+	if c.GetHeader("anthropic-version") != "" {
+		return CLAUDE
+	}
+
+	root := gjson.ParseBytes(rawJSON)
+	switch {
+	case root.Get("contents").Exists():
+		return GEMINI
+	case root.Get("input").Exists() && !root.Get("messages").Exists():
+		return OPENAI_RESPONSE
+	case root.Get("system").Exists() || root.Get("stop_sequences").Exists():
+		return CLAUDE
+	}
+	anthropic := false
+	root.Get("messages").ForEach(func(_, message gjson.Result) bool {
+		message.Get("content").ForEach(func(_, block gjson.Result) bool {
+			switch block.Get("type").String() {
+			case "tool_use", "tool_result":
+				anthropic = true
+			case "image":
+				anthropic = block.Get("source").Exists()
+			}
+			return !anthropic
+		})
+		return !anthropic
+	})
+	if anthropic {
+		return CLAUDE
+	}
+	return OPENAI
+}
+
+// acceptsEventStream reports whether the Accept header of a request asks for an event stream.
+func acceptsEventStream(c *gin.Context) bool {
+	for _, accepted := range strings.Split(c.GetHeader("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err == nil && mediaType == "text/event-stream" {
+			return true
+		}
+	}
+	return false
+}
+
+// unifiedGenerateHandler serves a generic endpoint for proxies that front several client
+// types on one path. The format of each request is detected (see detectRequestFormat) and
+// the request is handled by the endpoint of that format, so the response is in the same
+// format. An Accept header asking for text/event-stream requests a stream if the body does
+// not say otherwise. Gemini requests name their model in the "model" field of the body.
+func (s *Server) unifiedGenerateHandler(openaiHandler *openai.OpenAIAPIHandler, responsesHandler *openai.OpenAIResponsesAPIHandler, claudeHandler *claude.ClaudeCodeAPIHandler, geminiHandler *gemini.GeminiAPIHandler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rawJSON, err := c.GetRawData()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, handlers.ErrorResponse{
+				Error: handlers.ErrorDetail{
+					Message: "Invalid request: " + err.Error(),
+					Type:    "invalid_request_error",
+				},
+			})
+			return
+		}
+
+		format := detectRequestFormat(c, rawJSON)
+		stream := acceptsEventStream(c)
+		if stream && !gjson.GetBytes(rawJSON, "stream").Exists() {
+			rawJSON, _ = sjson.SetBytes(rawJSON, "stream", true)
+		}
+		log.Debugf("Detected %s format for generic request %s", format, c.GetString("requestID"))
+
+		if format == GEMINI {
+			model := gjson.GetBytes(rawJSON, "model").String()
+			if model == "" {
+				c.JSON(http.StatusBadRequest, handlers.ErrorResponse{
+					Error: handlers.ErrorDetail{
+						Message: "Invalid request: Gemini requests to this endpoint must name the model in the \"model\" field",
+						Type:    "invalid_request_error",
+					},
+				})
+				return
+			}
+			rawJSON, _ = sjson.DeleteBytes(rawJSON, "model")
+			method := "generateContent"
+			if stream {
+				method = "streamGenerateContent"
+			}
+			c.Params = append(c.Params, gin.Param{Key: "action", Value: model + ":" + method})
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(rawJSON))
+
+		switch format {
+		case GEMINI:
+			geminiHandler.GeminiHandler(c)
+		case CLAUDE:
+			claudeHandler.ClaudeMessages(c)
+		case OPENAI_RESPONSE:
+			responsesHandler.Responses(c)
+		default:
+			openaiHandler.ChatCompletions(c)
+		}
+	}
+}
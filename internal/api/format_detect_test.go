@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+)
+
+// genericRequest returns the Gin context of a request to the generic endpoint.
+func genericRequest(header http.Header) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/generate", nil)
+	for key, values := range header {
+		c.Request.Header[key] = values
+	}
+	return c
+}
+
+func TestDetectRequestFormatFromAcceptHeader(t *testing.T) {
+	// The body has the shape of an OpenAI chat completion, which the Accept header overrides.
+	body := []byte(`{"model":"gemini-2.5-pro","messages":[{"role":"user","content":"Hi"}]}`)
+	for accept, want := range map[string]string{
+		"application/json; format=openai":                         OPENAI,
+		"application/json; format=openai-response":                OPENAI_RESPONSE,
+		"application/json; format=openai-responses":               OPENAI_RESPONSE,
+		"application/json; format=anthropic":                      CLAUDE,
+		"application/json; format=claude":                         CLAUDE,
+		"application/json; format=gemini":                         GEMINI,
+		"text/event-stream; format=Anthropic":                     CLAUDE,
+		"text/html, application/json; format=gemini":              GEMINI,
+		"application/json; format=unknown, */*; format=anthropic": CLAUDE,
+	} {
+		if got := detectRequestFormat(genericRequest(http.Header{"Accept": {accept}}), body); got != want {
+			t.Errorf("Accept %q: format = %s, want %s", accept, got, want)
+		}
+	}
+}
+
+func TestDetectRequestFormatFromBody(t *testing.T) {
+	for name, tc := range map[string]struct {
+		header http.Header
+		body   string
+		want   string
+	}{
+		"anthropic-version header": {http.Header{"Anthropic-Version": {"2023-06-01"}}, `{"messages":[{"role":"user","content":"Hi"}]}`, CLAUDE},
+		"gemini contents":          {nil, `{"model":"gemini-2.5-pro","contents":[{"role":"user","parts":[{"text":"Hi"}]}]}`, GEMINI},
+		"responses input":          {nil, `{"model":"gpt-5","input":"Hi"}`, OPENAI_RESPONSE},
+		"anthropic system":         {nil, `{"system":"Be brief.","messages":[{"role":"user","content":"Hi"}]}`, CLAUDE},
+		"anthropic stop sequences": {nil, `{"stop_sequences":["END"],"messages":[{"role":"user","content":"Hi"}]}`, CLAUDE},
+		"anthropic tool result":    {nil, `{"messages":[{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"ok"}]}]}`, CLAUDE},
+		"anthropic image":          {nil, `{"messages":[{"role":"user","content":[{"type":"image","source":{"type":"base64","media_type":"image/png","data":""}}]}]}`, CLAUDE},
+		"openai image":             {nil, `{"messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"data:image/png;base64,"}}]}]}`, OPENAI},
+		"openai chat":              {http.Header{"Accept": {"application/json"}}, `{"messages":[{"role":"user","content":"Hi"}]}`, OPENAI},
+	} {
+		if got := detectRequestFormat(genericRequest(tc.header), []byte(tc.body)); got != tc.want {
+			t.Errorf("%s: format = %s, want %s", name, got, tc.want)
+		}
+	}
+}
+
+func TestAcceptsEventStream(t *testing.T) {
+	for accept, want := range map[string]bool{
+		"text/event-stream":                   true,
+		"application/json, text/event-stream": true,
+		"text/event-stream; format=anthropic": true,
+		"application/json":                    false,
+		"":                                    false,
+	} {
+		if got := acceptsEventStream(genericRequest(http.Header{"Accept": {accept}})); got != want {
+			t.Errorf("Accept %q: acceptsEventStream = %v, want %v", accept, got, want)
+		}
+	}
+}
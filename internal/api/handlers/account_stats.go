@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	"github.com/luispater/CLIProxyAPI/v5/internal/metrics"
+	"github.com/luispater/CLIProxyAPI/v5/internal/util"
+)
+
+// selectedClientKey is the Gin context key of the client most recently selected for a request.
+const selectedClientKey = "selectedClient"
+
+// recordAccountSelection counts a request routed to a client and remembers the client, so
+// that errors reported for the request are attributed to its account.
+func (h *BaseAPIHandler) recordAccountSelection(c *gin.Context, cliClient interfaces.Client) {
+	c.Set(selectedClientKey, cliClient)
+	metrics.AccountRequests.Inc(cliClient.Type(), util.AccountLabel(h.Cfg, cliClient.GetEmail()))
+}
+
+// recordAccountError counts a failed upstream request against the account of the client
+// most recently selected for the request.
+func (h *BaseAPIHandler) recordAccountError(ctx context.Context, err *interfaces.ErrorMessage) {
+	ginContext, ok := ctx.Value("gin").(*gin.Context)
+	if !ok {
+		return
+	}
+	value, _ := ginContext.Get(selectedClientKey)
+	if cliClient, isClient := value.(interfaces.Client); isClient {
+		metrics.AccountErrors.Inc(cliClient.Type(), util.AccountLabel(h.Cfg, cliClient.GetEmail()), strconv.Itoa(err.StatusCode))
+	}
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	"github.com/luispater/CLIProxyAPI/v5/internal/metrics"
+)
+
+func TestAccountCountersIncrementPerSelection(t *testing.T) {
+	// Accounts are labeled by their aliases in the metrics.
+	const (
+		healthy = "distribution-healthy"
+		failing = "distribution-failing"
+	)
+	aliases := map[string]string{healthy + "@example.com": healthy, failing + "@example.com": failing}
+	tests := []struct {
+		name         string
+		clients      []*poolClient
+		requests     int
+		wantRequests map[string]float64
+		wantErrors   map[string]float64
+	}{
+		{
+			name:         "single account",
+			clients:      []*poolClient{{fakeClient: fakeClient{name: healthy + "@example.com"}, send: answer("ok")}},
+			requests:     3,
+			wantRequests: map[string]float64{healthy: 3},
+			wantErrors:   map[string]float64{healthy: 0},
+		},
+		{
+			name: "retried on another account",
+			clients: []*poolClient{
+				{fakeClient: fakeClient{name: failing + "@example.com"}, send: fail(http.StatusServiceUnavailable)},
+				{fakeClient: fakeClient{name: healthy + "@example.com"}, send: answer("ok")},
+			},
+			requests:     1,
+			wantRequests: map[string]float64{failing: 1, healthy: 1},
+			wantErrors:   map[string]float64{failing: 1, healthy: 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clients := make([]interfaces.Client, 0, len(tt.clients))
+			for _, c := range tt.clients {
+				clients = append(clients, c)
+			}
+			pool := NewClientPool(NewBaseAPIHandlers(clients, &config.Config{RequestRetry: 1, AccountAliases: aliases}))
+
+			requestsBefore := make(map[string]float64)
+			errorsBefore := make(map[string]float64)
+			for account := range tt.wantRequests {
+				requestsBefore[account] = metrics.AccountRequests.Value("gemini", account)
+				errorsBefore[account] = metrics.AccountErrors.Value("gemini", account, "503")
+			}
+
+			for i := 0; i < tt.requests; i++ {
+				ctx := context.WithValue(context.Background(), "gin", normalizeContext(""))
+				if _, err := pool.SendMessage(ctx, "gemini-2.5-pro", []byte(`{}`), ""); err != nil {
+					t.Fatalf("SendMessage() error = %v", err.Error)
+				}
+			}
+
+			for account, want := range tt.wantRequests {
+				if got := metrics.AccountRequests.Value("gemini", account) - requestsBefore[account]; got != want {
+					t.Errorf("requests of %s = %v, want %v", account, got, want)
+				}
+			}
+			for account, want := range tt.wantErrors {
+				if got := metrics.AccountErrors.Value("gemini", account, "503") - errorsBefore[account]; got != want {
+					t.Errorf("errors of %s = %v, want %v", account, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/client"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+)
+
+// geminiHandler is the API handler of requests sent in the Gemini format.
+type geminiHandler struct{}
+
+func (geminiHandler) HandlerType() string      { return GEMINI }
+func (geminiHandler) Models() []map[string]any { return nil }
+
+// roundTripFunc serves the upstream requests of a test client.
+type roundTripFunc func(*http.Request) *http.Response
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req), nil
+}
+
+func TestAttemptBudgetSpansRetriesAndAccounts(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxAttempts int
+		wantCalls   int32
+	}{
+		// Two accounts, each retried once on a transient error, then request-retry gives up.
+		{name: "no limit", wantCalls: 4},
+		// One call and its retry on the first account, one call on the second.
+		{name: "limited", maxAttempts: 3, wantCalls: 3},
+		{name: "first call only", maxAttempts: 1, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			upstream := &http.Client{Transport: roundTripFunc(func(*http.Request) *http.Response {
+				calls.Add(1)
+				return &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(`{"error":{"code":503,"message":"overloaded","status":"UNAVAILABLE"}}`))}
+			})}
+			cfg := &config.Config{RequestRetry: 1, SameAccountRetry: 1, MaxUpstreamAttempts: tt.maxAttempts}
+			clients := []interfaces.Client{
+				client.NewGeminiClient(upstream, cfg, "test-key-budget-1"),
+				client.NewGeminiClient(upstream, cfg, "test-key-budget-2"),
+			}
+			h := NewBaseAPIHandlers(clients, cfg)
+
+			ctx, cancel := h.GetContextWithCancel(geminiHandler{}, normalizeContext(""), context.Background())
+			defer cancel()
+			_, err := NewClientPool(h).SendMessage(ctx, "gemini-2.5-flash", []byte(`{"contents":[{"role":"user","parts":[{"text":"Hi"}]}]}`), "")
+			if err == nil || err.StatusCode != http.StatusServiceUnavailable || !strings.Contains(err.Error.Error(), "overloaded") {
+				t.Fatalf("SendMessage() error = %v, want the last upstream error", err)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("upstream calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
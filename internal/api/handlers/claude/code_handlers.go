@@ -73,6 +73,17 @@ func (h *ClaudeCodeAPIHandler) ClaudeMessages(c *gin.Context) {
 		})
 		return
 	}
+	rawJSON = h.NormalizeRequest(c, h.HandlerType(), rawJSON)
+	if !h.CheckModelAccess(c, gjson.GetBytes(rawJSON, "model").String()) {
+		return
+	}
+	if !h.CheckReasoningEffort(c, h.HandlerType(), rawJSON) {
+		return
+	}
+	var ok bool
+	if rawJSON, ok = h.LimitToolResults(c, h.HandlerType(), rawJSON); !ok {
+		return
+	}
 
 	// Check if the client requested a streaming response.
 	streamResult := gjson.GetBytes(rawJSON, "stream")
@@ -85,12 +96,13 @@ func (h *ClaudeCodeAPIHandler) ClaudeMessages(c *gin.Context) {
 
 // ClaudeModels handles the Claude models listing endpoint.
 // It returns a JSON response containing available Claude models and their specifications.
+// The optional 'capability' query parameter restricts the list to models with those capabilities.
 //
 // Parameters:
 //   - c: The Gin context for the request.
 func (h *ClaudeCodeAPIHandler) ClaudeModels(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
-		"data": h.Models(),
+		"data": registry.GetGlobalRegistry().GetAvailableModels("claude", handlers.RequestedCapabilities(c)...),
 	})
 }
 
@@ -108,7 +120,6 @@ func (h *ClaudeCodeAPIHandler) handleStreamingResponse(c *gin.Context, rawJSON [
 	c.Header("Content-Type", "text/event-stream")
 	c.Header("Cache-Control", "no-cache")
 	c.Header("Connection", "keep-alive")
-	c.Header("Access-Control-Allow-Origin", "*")
 
 	// Get the http.Flusher interface to manually flush the response.
 	// This is crucial for streaming as it allows immediate sending of data chunks
@@ -146,9 +157,13 @@ func (h *ClaudeCodeAPIHandler) handleStreamingResponse(c *gin.Context, rawJSON [
 	// This loop implements a sophisticated load balancing and failover mechanism
 outLoop:
 	for retryCount <= h.Cfg.RequestRetry {
-		cliClient, errorResponse = h.GetClient(modelName)
+		cliClient, errorResponse = h.GetRequestClient(c, modelName)
 		if errorResponse != nil {
-			c.Status(errorResponse.StatusCode)
+			if h.WriteFallbackResponse(c, h.HandlerType(), modelName, rawJSON, true, errorResponse) {
+				cliCancel()
+				return
+			}
+			h.WriteErrorStatus(c, errorResponse)
 			_, _ = fmt.Fprint(c.Writer, errorResponse.Error.Error())
 			flusher.Flush()
 			cliCancel()
@@ -197,14 +212,14 @@ outLoop:
 							continue outLoop // Restart the client selection process
 						}
 					case 403, 408, 500, 502, 503, 504:
-						log.Debugf("http status code %d, switch client, %s", errInfo.StatusCode, util.HideAPIKey(cliClient.GetEmail()))
+						log.Debugf("http status code %d, switch client, %s", errInfo.StatusCode, util.AccountLabel(h.Cfg, cliClient.GetEmail()))
 						retryCount++
 						continue outLoop
 					case 401:
-						log.Debugf("unauthorized request, try to refresh token, %s", util.HideAPIKey(cliClient.GetEmail()))
+						log.Debugf("unauthorized request, try to refresh token, %s", util.AccountLabel(h.Cfg, cliClient.GetEmail()))
 						err := cliClient.RefreshTokens(cliCtx)
 						if err != nil {
-							log.Debugf("refresh token failed, switch client, %s", util.HideAPIKey(cliClient.GetEmail()))
+							log.Debugf("refresh token failed, switch client, %s", util.AccountLabel(h.Cfg, cliClient.GetEmail()))
 							cliClient.SetUnavailable()
 						}
 						retryCount++
@@ -214,7 +229,7 @@ outLoop:
 						continue outLoop
 					default:
 						// Forward other errors directly to the client
-						c.Status(errInfo.StatusCode)
+						h.WriteErrorStatus(c, errInfo)
 						_, _ = fmt.Fprint(c.Writer, errInfo.Error.Error())
 						flusher.Flush()
 						cliCancel(errInfo.Error)
@@ -230,7 +245,11 @@ outLoop:
 	}
 
 	if errorResponse != nil {
-		c.Status(errorResponse.StatusCode)
+		if h.WriteFallbackResponse(c, h.HandlerType(), modelName, rawJSON, true, errorResponse) {
+			cliCancel()
+			return
+		}
+		h.WriteErrorStatus(c, errorResponse)
 		_, _ = fmt.Fprint(c.Writer, errorResponse.Error.Error())
 		flusher.Flush()
 		cliCancel(errorResponse.Error)
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/api/middleware"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	"github.com/luispater/CLIProxyAPI/v5/internal/translator/translator"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/sjson"
+)
+
+// FallbackResponseHeader marks responses that carry the configured fallback reply
+// instead of model output.
+const FallbackResponseHeader = "X-Fallback-Response"
+
+// WriteFallbackResponse writes the configured fallback reply when a request failed because
+// every account for the model is exhausted. The reply is built as a Gemini response and
+// translated into the format of the request, so it has the same shape as a real answer.
+//
+// Parameters:
+//   - c: The Gin context of the current request
+//   - handlerType: The API format of the request (e.g. OPENAI, CLAUDE)
+//   - modelName: The requested model
+//   - rawJSON: The raw JSON request body
+//   - stream: Whether the client expects a streaming response
+//   - errMsg: The error that ended the request
+//
+// Returns:
+//   - bool: True if the fallback reply was written and the error should not be written
+func (h *BaseAPIHandler) WriteFallbackResponse(c *gin.Context, handlerType, modelName string, rawJSON []byte, stream bool, errMsg *interfaces.ErrorMessage) bool {
+	if h.Cfg.FallbackResponse == "" || errMsg == nil {
+		return false
+	}
+	if errMsg.StatusCode != http.StatusTooManyRequests && !errors.Is(errMsg.Error, ErrNoClientsAvailable) {
+		return false
+	}
+
+	log.Warnf("All accounts exhausted for model %s (request %s), serving fallback response: %v", modelName, c.GetString(middleware.RequestIDKey), errMsg.Error)
+
+	response := []byte(`{"candidates":[{"content":{"role":"model","parts":[{"text":""}]},"finishReason":"STOP","index":0}],"usageMetadata":{"promptTokenCount":0,"candidatesTokenCount":0,"totalTokenCount":0}}`)
+	response, _ = sjson.SetBytes(response, "candidates.0.content.parts.0.text", h.Cfg.FallbackResponse)
+	response, _ = sjson.SetBytes(response, "modelVersion", modelName)
+
+	ctx := context.WithValue(context.Background(), "gin", c)
+	c.Header(FallbackResponseHeader, "true")
+	c.Status(http.StatusOK)
+
+	if !stream {
+		c.Header("Content-Type", "application/json")
+		var param any
+		_, _ = c.Writer.Write([]byte(translator.ResponseNonStream(handlerType, GEMINI, ctx, modelName, rawJSON, rawJSON, response, &param)))
+		return true
+	}
+
+	var param any
+	chunks := translator.Response(handlerType, GEMINI, ctx, modelName, rawJSON, rawJSON, response, &param)
+	if translator.NeedConvert(handlerType, GEMINI) {
+		chunks = append(chunks, translator.Response(handlerType, GEMINI, ctx, modelName, rawJSON, rawJSON, []byte("[DONE]"), &param)...)
+	}
+	for _, chunk := range chunks {
+		switch handlerType {
+		case CLAUDE, OPENAI_RESPONSE:
+			_, _ = fmt.Fprintf(c.Writer, "%s\n", chunk)
+		default:
+			_, _ = fmt.Fprintf(c.Writer, "data: %s\n\n", chunk)
+		}
+	}
+	if handlerType == OPENAI {
+		_, _ = fmt.Fprint(c.Writer, "data: [DONE]\n\n")
+	}
+	if flusher, ok := c.Writer.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return true
+}
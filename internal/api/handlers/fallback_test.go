@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	_ "github.com/luispater/CLIProxyAPI/v5/internal/translator"
+	"github.com/tidwall/gjson"
+)
+
+func TestWriteFallbackResponseOnTotalExhaustion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{FallbackResponse: "We are busy, please try again later."}
+
+	// No account can serve the model, so selecting a client ends the request with an error.
+	h := NewBaseAPIHandlers(nil, cfg)
+	_, errMsg := h.GetClient("gemini-2.5-pro")
+	if errMsg == nil {
+		t.Fatal("GetClient() error = nil, want the exhaustion error")
+	}
+
+	tests := []struct {
+		name        string
+		handlerType string
+		stream      bool
+		check       func(t *testing.T, body string)
+	}{
+		{
+			name:        "openai",
+			handlerType: OPENAI,
+			check: func(t *testing.T, body string) {
+				if got := gjson.Get(body, "choices.0.message.content").String(); got != cfg.FallbackResponse {
+					t.Errorf("content = %q, want the fallback response", got)
+				}
+			},
+		},
+		{
+			name:        "openai stream",
+			handlerType: OPENAI,
+			stream:      true,
+			check: func(t *testing.T, body string) {
+				if !strings.Contains(body, `"content":"We are busy, please try again later."`) {
+					t.Errorf("stream = %s, want a chunk with the fallback response", body)
+				}
+				if !strings.HasSuffix(body, "data: [DONE]\n\n") {
+					t.Errorf("stream = %s, want it to end with [DONE]", body)
+				}
+			},
+		},
+		{
+			name:        "gemini",
+			handlerType: GEMINI,
+			check: func(t *testing.T, body string) {
+				if got := gjson.Get(body, "candidates.0.content.parts.0.text").String(); got != cfg.FallbackResponse {
+					t.Errorf("text = %q, want the fallback response", got)
+				}
+			},
+		},
+		{
+			name:        "claude stream",
+			handlerType: CLAUDE,
+			stream:      true,
+			check: func(t *testing.T, body string) {
+				if !strings.Contains(body, `"text":"We are busy, please try again later."`) {
+					t.Errorf("stream = %s, want a text delta with the fallback response", body)
+				}
+				if !strings.Contains(body, "event: message_stop") {
+					t.Errorf("stream = %s, want it to end the message", body)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+
+			if !h.WriteFallbackResponse(c, tt.handlerType, "gemini-2.5-pro", []byte(`{"model":"gemini-2.5-pro"}`), tt.stream, errMsg) {
+				t.Fatal("WriteFallbackResponse() = false, want the fallback response written")
+			}
+			if recorder.Code != http.StatusOK {
+				t.Errorf("status = %d, want %d", recorder.Code, http.StatusOK)
+			}
+			if recorder.Header().Get(FallbackResponseHeader) != "true" {
+				t.Errorf("%s header missing", FallbackResponseHeader)
+			}
+			tt.check(t, recorder.Body.String())
+		})
+	}
+}
+
+func TestWriteFallbackResponseSkipped(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name     string
+		fallback string
+		errMsg   *interfaces.ErrorMessage
+	}{
+		{name: "not configured", errMsg: &interfaces.ErrorMessage{StatusCode: http.StatusTooManyRequests}},
+		{name: "other error", fallback: "busy", errMsg: &interfaces.ErrorMessage{StatusCode: http.StatusBadRequest}},
+		{name: "no error", fallback: "busy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+
+			h := NewBaseAPIHandlers(nil, &config.Config{FallbackResponse: tt.fallback})
+			if h.WriteFallbackResponse(c, OPENAI, "gemini-2.5-pro", []byte(`{}`), false, tt.errMsg) {
+				t.Error("WriteFallbackResponse() = true, want the error passed on")
+			}
+			if recorder.Body.Len() != 0 {
+				t.Errorf("body = %s, want nothing written", recorder.Body.String())
+			}
+		})
+	}
+}
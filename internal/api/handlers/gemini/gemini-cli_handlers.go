@@ -11,12 +11,10 @@ import (
 	"io"
 	"net/http"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/luispater/CLIProxyAPI/v5/internal/api/handlers"
 	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
-	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
 	"github.com/luispater/CLIProxyAPI/v5/internal/util"
 	log "github.com/sirupsen/logrus"
 	"github.com/tidwall/gjson"
@@ -60,12 +58,21 @@ func (h *GeminiCLIAPIHandler) CLIHandler(c *gin.Context) {
 	}
 
 	rawJSON, _ := c.GetRawData()
+	rawJSON = h.NormalizeRequest(c, h.HandlerType(), rawJSON)
+	var ok bool
+	if rawJSON, ok = h.LimitToolResults(c, h.HandlerType(), rawJSON); !ok {
+		return
+	}
 	requestRawURI := c.Request.URL.Path
 
-	if requestRawURI == "/v1internal:generateContent" {
-		h.handleInternalGenerateContent(c, rawJSON)
-	} else if requestRawURI == "/v1internal:streamGenerateContent" {
-		h.handleInternalStreamGenerateContent(c, rawJSON)
+	if requestRawURI == "/v1internal:generateContent" || requestRawURI == "/v1internal:streamGenerateContent" {
+		var stream bool
+		stream, rawJSON = handlers.ResolveStreamMode(rawJSON, requestRawURI == "/v1internal:streamGenerateContent")
+		if stream {
+			h.handleInternalStreamGenerateContent(c, rawJSON)
+		} else {
+			h.handleInternalGenerateContent(c, rawJSON)
+		}
 	} else {
 		reqBody := bytes.NewBuffer(rawJSON)
 		req, err := http.NewRequest("POST", fmt.Sprintf("https://cloudcode-pa.googleapis.com%s", c.Request.URL.RequestURI()), reqBody)
@@ -130,7 +137,7 @@ func (h *GeminiCLIAPIHandler) CLIHandler(c *gin.Context) {
 }
 
 // handleInternalStreamGenerateContent handles streaming content generation requests.
-// It sets up a server-sent event stream and forwards the request to the backend client.
+// It sets up a server-sent event stream and forwards the request to the client pool.
 // The function continuously proxies response chunks from the backend to the client.
 func (h *GeminiCLIAPIHandler) handleInternalStreamGenerateContent(c *gin.Context, rawJSON []byte) {
 	alt := h.GetAlt(c)
@@ -139,7 +146,6 @@ func (h *GeminiCLIAPIHandler) handleInternalStreamGenerateContent(c *gin.Context
 		c.Header("Content-Type", "text/event-stream")
 		c.Header("Cache-Control", "no-cache")
 		c.Header("Connection", "keep-alive")
-		c.Header("Access-Control-Allow-Origin", "*")
 	}
 
 	// Get the http.Flusher interface to manually flush the response.
@@ -159,105 +165,46 @@ func (h *GeminiCLIAPIHandler) handleInternalStreamGenerateContent(c *gin.Context
 
 	cliCtx, cliCancel := h.GetContextWithCancel(h, c, context.Background())
 
-	var cliClient interfaces.Client
-	defer func() {
-		// Ensure the client's mutex is unlocked on function exit.
-		if cliClient != nil {
-			if mutex := cliClient.GetRequestMutex(); mutex != nil {
-				mutex.Unlock()
-			}
-		}
-	}()
+	// Send the message and receive response chunks and errors via channels. The pool
+	// switches to another account on errors that happen before the first chunk.
+	respChan, errChan := handlers.NewClientPool(h.BaseAPIHandler).SendMessageStream(cliCtx, modelName, rawJSON, "")
 
-	var errorResponse *interfaces.ErrorMessage
-	retryCount := 0
-outLoop:
-	for retryCount <= h.Cfg.RequestRetry {
-		cliClient, errorResponse = h.GetClient(modelName)
-		if errorResponse != nil {
-			c.Status(errorResponse.StatusCode)
-			_, _ = fmt.Fprint(c.Writer, errorResponse.Error.Error())
-			flusher.Flush()
-			cliCancel()
+	for {
+		select {
+		// Handle client disconnection.
+		case <-c.Request.Context().Done():
+			log.Debugf("gemini cli client disconnected: %v", c.Request.Context().Err())
+			cliCancel() // Cancel the backend request.
 			return
-		}
-
-		// Send the message and receive response chunks and errors via channels.
-		respChan, errChan := cliClient.SendRawMessageStream(cliCtx, modelName, rawJSON, "")
-
-		for {
-			select {
-			// Handle client disconnection.
-			case <-c.Request.Context().Done():
-				if c.Request.Context().Err().Error() == "context canceled" {
-					log.Debugf("gemini cli client disconnected: %v", c.Request.Context().Err())
-					cliCancel() // Cancel the backend request.
-					return
-				}
-			// Process incoming response chunks.
-			case chunk, okStream := <-respChan:
-				if !okStream {
-					cliCancel()
-					return
-				}
-				_, _ = c.Writer.Write([]byte("data: "))
-				_, _ = c.Writer.Write(chunk)
-				_, _ = c.Writer.Write([]byte("\n\n"))
-
-				flusher.Flush()
-			// Handle errors from the backend.
-			case err, okError := <-errChan:
-				if okError {
-					errorResponse = err
-					h.LoggingAPIResponseError(cliCtx, err)
-
-					switch err.StatusCode {
-					case 429:
-						if h.Cfg.QuotaExceeded.SwitchProject {
-							log.Debugf("quota exceeded, switch client")
-							continue outLoop // Restart the client selection process
-						}
-					case 403, 408, 500, 502, 503, 504:
-						log.Debugf("http status code %d, switch client", err.StatusCode)
-						retryCount++
-						continue outLoop
-					case 401:
-						log.Debugf("unauthorized request, try to refresh token, %s", util.HideAPIKey(cliClient.GetEmail()))
-						errRefreshTokens := cliClient.RefreshTokens(cliCtx)
-						if errRefreshTokens != nil {
-							log.Debugf("refresh token failed, switch client, %s", util.HideAPIKey(cliClient.GetEmail()))
-							cliClient.SetUnavailable()
-						}
-						retryCount++
-						continue outLoop
-					case 402:
-						cliClient.SetUnavailable()
-						continue outLoop
-					default:
-						// Forward other errors directly to the client
-						c.Status(err.StatusCode)
-						_, _ = fmt.Fprint(c.Writer, err.Error.Error())
-						flusher.Flush()
-						cliCancel(err.Error)
+		// Process incoming response chunks.
+		case chunk, okStream := <-respChan:
+			if !okStream {
+				// The stream has ended; the error that ended it, if any, follows.
+				if err, okError := <-errChan; okError && err != nil {
+					if h.WriteFallbackResponse(c, h.HandlerType(), modelName, rawJSON, true, err) {
+						cliCancel()
+						return
 					}
+					h.WriteErrorStatus(c, err)
+					_, _ = fmt.Fprint(c.Writer, err.Error.Error())
+					flusher.Flush()
+					cliCancel(err.Error)
 					return
 				}
-			// Send a keep-alive signal to the client.
-			case <-time.After(500 * time.Millisecond):
+				cliCancel()
+				return
 			}
+			_, _ = c.Writer.Write([]byte("data: "))
+			_, _ = c.Writer.Write(chunk)
+			_, _ = c.Writer.Write([]byte("\n\n"))
+
+			flusher.Flush()
 		}
 	}
-	if errorResponse != nil {
-		c.Status(errorResponse.StatusCode)
-		_, _ = fmt.Fprint(c.Writer, errorResponse.Error.Error())
-		flusher.Flush()
-		cliCancel(errorResponse.Error)
-		return
-	}
 }
 
 // handleInternalGenerateContent handles non-streaming content generation requests.
-// It sends a request to the backend client and proxies the entire response back to the client at once.
+// It sends a request to the client pool and proxies the entire response back to the client at once.
 func (h *GeminiCLIAPIHandler) handleInternalGenerateContent(c *gin.Context, rawJSON []byte) {
 	c.Header("Content-Type", "application/json")
 	modelResult := gjson.GetBytes(rawJSON, "model")
@@ -265,71 +212,17 @@ func (h *GeminiCLIAPIHandler) handleInternalGenerateContent(c *gin.Context, rawJ
 
 	cliCtx, cliCancel := h.GetContextWithCancel(h, c, context.Background())
 
-	var cliClient interfaces.Client
-	defer func() {
-		if cliClient != nil {
-			if mutex := cliClient.GetRequestMutex(); mutex != nil {
-				mutex.Unlock()
-			}
-		}
-	}()
-
-	var errorResponse *interfaces.ErrorMessage
-	retryCount := 0
-	for retryCount <= h.Cfg.RequestRetry {
-		cliClient, errorResponse = h.GetClient(modelName)
-		if errorResponse != nil {
-			c.Status(errorResponse.StatusCode)
-			_, _ = fmt.Fprint(c.Writer, errorResponse.Error.Error())
+	resp, err := handlers.NewClientPool(h.BaseAPIHandler).SendMessage(cliCtx, modelName, rawJSON, "")
+	if err != nil {
+		if h.WriteFallbackResponse(c, h.HandlerType(), modelName, rawJSON, false, err) {
 			cliCancel()
 			return
 		}
-
-		resp, err := cliClient.SendRawMessage(cliCtx, modelName, rawJSON, "")
-		if err != nil {
-			errorResponse = err
-			h.LoggingAPIResponseError(cliCtx, err)
-
-			switch err.StatusCode {
-			case 429:
-				if h.Cfg.QuotaExceeded.SwitchProject {
-					log.Debugf("quota exceeded, switch client")
-					continue // Restart the client selection process
-				}
-			case 403, 408, 500, 502, 503, 504:
-				log.Debugf("http status code %d, switch client", err.StatusCode)
-				retryCount++
-				continue
-			case 401:
-				log.Debugf("unauthorized request, try to refresh token, %s", util.HideAPIKey(cliClient.GetEmail()))
-				errRefreshTokens := cliClient.RefreshTokens(cliCtx)
-				if errRefreshTokens != nil {
-					log.Debugf("refresh token failed, switch client, %s", util.HideAPIKey(cliClient.GetEmail()))
-					cliClient.SetUnavailable()
-				}
-				retryCount++
-				continue
-			case 402:
-				cliClient.SetUnavailable()
-				continue
-			default:
-				// Forward other errors directly to the client
-				c.Status(err.StatusCode)
-				_, _ = c.Writer.Write([]byte(err.Error.Error()))
-				cliCancel(err.Error)
-			}
-			break
-		} else {
-			_, _ = c.Writer.Write(resp)
-			cliCancel()
-			break
-		}
-	}
-	if errorResponse != nil {
-		c.Status(errorResponse.StatusCode)
-		_, _ = c.Writer.Write([]byte(errorResponse.Error.Error()))
-		cliCancel(errorResponse.Error)
+		h.WriteErrorStatus(c, err)
+		_, _ = c.Writer.Write([]byte(err.Error.Error()))
+		cliCancel(err.Error)
 		return
 	}
-
+	_, _ = c.Writer.Write(resp)
+	cliCancel()
 }
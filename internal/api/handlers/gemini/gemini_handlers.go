@@ -49,9 +49,10 @@ func (h *GeminiAPIHandler) Models() []map[string]any {
 
 // GeminiModels handles the Gemini models listing endpoint.
 // It returns a JSON response containing available Gemini models and their specifications.
+// The optional 'capability' query parameter restricts the list to models with those capabilities.
 func (h *GeminiAPIHandler) GeminiModels(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
-		"models": h.Models(),
+		"models": registry.GetGlobalRegistry().GetAvailableModels("gemini", handlers.RequestedCapabilities(c)...),
 	})
 }
 
@@ -165,16 +166,28 @@ func (h *GeminiAPIHandler) GeminiHandler(c *gin.Context) {
 		return
 	}
 
-	method := action[1]
+	modelName, method := h.ResolveModelName(action[0]), action[1]
 	rawJSON, _ := c.GetRawData()
+	rawJSON = h.NormalizeRequest(c, h.HandlerType(), rawJSON)
+	if !h.CheckModelAccess(c, modelName) {
+		return
+	}
+	var ok bool
+	if rawJSON, ok = h.LimitToolResults(c, h.HandlerType(), rawJSON); !ok {
+		return
+	}
 
 	switch method {
-	case "generateContent":
-		h.handleGenerateContent(c, action[0], rawJSON)
-	case "streamGenerateContent":
-		h.handleStreamGenerateContent(c, action[0], rawJSON)
+	case "generateContent", "streamGenerateContent":
+		var stream bool
+		stream, rawJSON = handlers.ResolveStreamMode(rawJSON, method == "streamGenerateContent")
+		if stream {
+			h.handleStreamGenerateContent(c, modelName, rawJSON)
+		} else {
+			h.handleGenerateContent(c, modelName, rawJSON)
+		}
 	case "countTokens":
-		h.handleCountTokens(c, action[0], rawJSON)
+		h.handleCountTokens(c, modelName, rawJSON)
 	}
 }
 
@@ -194,7 +207,6 @@ func (h *GeminiAPIHandler) handleStreamGenerateContent(c *gin.Context, modelName
 		c.Header("Content-Type", "text/event-stream")
 		c.Header("Cache-Control", "no-cache")
 		c.Header("Connection", "keep-alive")
-		c.Header("Access-Control-Allow-Origin", "*")
 	}
 
 	// Get the http.Flusher interface to manually flush the response.
@@ -225,9 +237,13 @@ func (h *GeminiAPIHandler) handleStreamGenerateContent(c *gin.Context, modelName
 	retryCount := 0
 outLoop:
 	for retryCount <= h.Cfg.RequestRetry {
-		cliClient, errorResponse = h.GetClient(modelName)
+		cliClient, errorResponse = h.GetRequestClient(c, modelName)
 		if errorResponse != nil {
-			c.Status(errorResponse.StatusCode)
+			if h.WriteFallbackResponse(c, h.HandlerType(), modelName, rawJSON, true, errorResponse) {
+				cliCancel()
+				return
+			}
+			h.WriteErrorStatus(c, errorResponse)
 			_, _ = fmt.Fprint(c.Writer, errorResponse.Error.Error())
 			flusher.Flush()
 			cliCancel()
@@ -277,10 +293,10 @@ outLoop:
 						retryCount++
 						continue outLoop
 					case 401:
-						log.Debugf("unauthorized request, try to refresh token, %s", util.HideAPIKey(cliClient.GetEmail()))
+						log.Debugf("unauthorized request, try to refresh token, %s", util.AccountLabel(h.Cfg, cliClient.GetEmail()))
 						errRefreshTokens := cliClient.RefreshTokens(cliCtx)
 						if errRefreshTokens != nil {
-							log.Debugf("refresh token failed, switch client, %s", util.HideAPIKey(cliClient.GetEmail()))
+							log.Debugf("refresh token failed, switch client, %s", util.AccountLabel(h.Cfg, cliClient.GetEmail()))
 							cliClient.SetUnavailable()
 						}
 						retryCount++
@@ -290,7 +306,7 @@ outLoop:
 						continue outLoop
 					default:
 						// Forward other errors directly to the client
-						c.Status(err.StatusCode)
+						h.WriteErrorStatus(c, err)
 						_, _ = fmt.Fprint(c.Writer, err.Error.Error())
 						flusher.Flush()
 						cliCancel(err.Error)
@@ -303,7 +319,11 @@ outLoop:
 		}
 	}
 	if errorResponse != nil {
-		c.Status(errorResponse.StatusCode)
+		if h.WriteFallbackResponse(c, h.HandlerType(), modelName, rawJSON, true, errorResponse) {
+			cliCancel()
+			return
+		}
+		h.WriteErrorStatus(c, errorResponse)
 		_, _ = fmt.Fprint(c.Writer, errorResponse.Error.Error())
 		flusher.Flush()
 		cliCancel(errorResponse.Error)
@@ -336,9 +356,9 @@ func (h *GeminiAPIHandler) handleCountTokens(c *gin.Context, modelName string, r
 
 	for {
 		var errorResponse *interfaces.ErrorMessage
-		cliClient, errorResponse = h.GetClient(modelName, false)
+		cliClient, errorResponse = h.GetRequestClient(c, modelName, false)
 		if errorResponse != nil {
-			c.Status(errorResponse.StatusCode)
+			h.WriteErrorStatus(c, errorResponse)
 			_, _ = fmt.Fprint(c.Writer, errorResponse.Error.Error())
 			cliCancel()
 			return
@@ -349,7 +369,7 @@ func (h *GeminiAPIHandler) handleCountTokens(c *gin.Context, modelName string, r
 			if err.StatusCode == 429 && h.Cfg.QuotaExceeded.SwitchProject {
 				continue
 			} else {
-				c.Status(err.StatusCode)
+				h.WriteErrorStatus(c, err)
 				_, _ = c.Writer.Write([]byte(err.Error.Error()))
 				cliCancel(err.Error)
 			}
@@ -390,9 +410,13 @@ func (h *GeminiAPIHandler) handleGenerateContent(c *gin.Context, modelName strin
 	var errorResponse *interfaces.ErrorMessage
 	retryCount := 0
 	for retryCount <= h.Cfg.RequestRetry {
-		cliClient, errorResponse = h.GetClient(modelName)
+		cliClient, errorResponse = h.GetRequestClient(c, modelName)
 		if errorResponse != nil {
-			c.Status(errorResponse.StatusCode)
+			if h.WriteFallbackResponse(c, h.HandlerType(), modelName, rawJSON, false, errorResponse) {
+				cliCancel()
+				return
+			}
+			h.WriteErrorStatus(c, errorResponse)
 			_, _ = fmt.Fprint(c.Writer, errorResponse.Error.Error())
 			cliCancel()
 			return
@@ -414,10 +438,10 @@ func (h *GeminiAPIHandler) handleGenerateContent(c *gin.Context, modelName strin
 				retryCount++
 				continue
 			case 401:
-				log.Debugf("unauthorized request, try to refresh token, %s", util.HideAPIKey(cliClient.GetEmail()))
+				log.Debugf("unauthorized request, try to refresh token, %s", util.AccountLabel(h.Cfg, cliClient.GetEmail()))
 				errRefreshTokens := cliClient.RefreshTokens(cliCtx)
 				if errRefreshTokens != nil {
-					log.Debugf("refresh token failed, switch client, %s", util.HideAPIKey(cliClient.GetEmail()))
+					log.Debugf("refresh token failed, switch client, %s", util.AccountLabel(h.Cfg, cliClient.GetEmail()))
 					cliClient.SetUnavailable()
 				}
 				retryCount++
@@ -427,7 +451,7 @@ func (h *GeminiAPIHandler) handleGenerateContent(c *gin.Context, modelName strin
 				continue
 			default:
 				// Forward other errors directly to the client
-				c.Status(err.StatusCode)
+				h.WriteErrorStatus(c, err)
 				_, _ = c.Writer.Write([]byte(err.Error.Error()))
 				cliCancel(err.Error)
 			}
@@ -439,7 +463,11 @@ func (h *GeminiAPIHandler) handleGenerateContent(c *gin.Context, modelName strin
 		}
 	}
 	if errorResponse != nil {
-		c.Status(errorResponse.StatusCode)
+		if h.WriteFallbackResponse(c, h.HandlerType(), modelName, rawJSON, false, errorResponse) {
+			cliCancel()
+			return
+		}
+		h.WriteErrorStatus(c, errorResponse)
 		_, _ = c.Writer.Write([]byte(errorResponse.Error.Error()))
 		cliCancel(errorResponse.Error)
 		return
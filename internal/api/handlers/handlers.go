@@ -4,16 +4,24 @@
 package handlers
 
 import (
-	"fmt"
+	"cmp"
+	"errors"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/api/middleware"
 	"github.com/luispater/CLIProxyAPI/v5/internal/config"
 	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
-	"github.com/luispater/CLIProxyAPI/v5/internal/util"
+	"github.com/luispater/CLIProxyAPI/v5/internal/translator/translator"
 	"golang.org/x/net/context"
 )
 
+// ErrNoClientsAvailable is returned by GetClient when no available client can serve the model.
+var ErrNoClientsAvailable = errors.New("no clients available")
+
 // ErrorResponse represents a standard error response format for the API.
 // It contains a single ErrorDetail field.
 type ErrorResponse struct {
@@ -47,9 +55,16 @@ type BaseAPIHandler struct {
 	// Mutex ensures thread-safe access to shared resources.
 	Mutex *sync.Mutex
 
-	// LastUsedClientIndex tracks the last used client index for each provider
-	// to implement round-robin load balancing.
-	LastUsedClientIndex map[string]int
+	// LastUsedAt tracks when each client was last selected, so that requests go to the
+	// least recently used client.
+	LastUsedAt map[interfaces.Client]time.Time
+
+	// Uses counts the requests sent to each client since the clients were last updated, for
+	// weighted load balancing with generative-language-api-key-weights.
+	Uses map[interfaces.Client]int
+
+	// LoadShedder tracks the API requests in flight, reported by Health. It may be nil.
+	LoadShedder *middleware.LoadShedder
 }
 
 // NewBaseAPIHandlers creates a new API handlers instance.
@@ -63,10 +78,11 @@ type BaseAPIHandler struct {
 //   - *BaseAPIHandler: A new API handlers instance
 func NewBaseAPIHandlers(cliClients []interfaces.Client, cfg *config.Config) *BaseAPIHandler {
 	return &BaseAPIHandler{
-		CliClients:          cliClients,
-		Cfg:                 cfg,
-		Mutex:               &sync.Mutex{},
-		LastUsedClientIndex: make(map[string]int),
+		CliClients: cliClients,
+		Cfg:        cfg,
+		Mutex:      &sync.Mutex{},
+		LastUsedAt: make(map[interfaces.Client]time.Time),
+		Uses:       make(map[interfaces.Client]int),
 	}
 }
 
@@ -77,12 +93,26 @@ func NewBaseAPIHandlers(cliClients []interfaces.Client, cfg *config.Config) *Bas
 //   - clients: The new slice of AI service clients
 //   - cfg: The new application configuration
 func (h *BaseAPIHandler) UpdateClients(clients []interfaces.Client, cfg *config.Config) {
+	h.Mutex.Lock()
+	lastUsedAt := make(map[interfaces.Client]time.Time, len(clients))
+	for _, cliClient := range clients {
+		if usedAt, ok := h.LastUsedAt[cliClient]; ok {
+			lastUsedAt[cliClient] = usedAt
+		}
+	}
+	h.LastUsedAt = lastUsedAt
+	// The counts start over, so that added keys do not take all requests until they catch up.
+	h.Uses = make(map[interfaces.Client]int, len(clients))
 	h.CliClients = clients
+	h.Mutex.Unlock()
+
 	h.Cfg = cfg
 }
 
-// GetClient returns an available client from the pool using round-robin load balancing.
-// It checks for quota limits and tries to find an unlocked client for immediate use.
+// GetClient returns the least recently used available client of the pool. Every account
+// (token file or API key) has its own client, so requests are spread over the accounts and
+// run in parallel. Clients whose quota for the model is exceeded are skipped, and a client
+// that is not busy is preferred if the client serializes its requests.
 // The modelName parameter is used to check quota status for specific models.
 //
 // Parameters:
@@ -93,51 +123,39 @@ func (h *BaseAPIHandler) UpdateClients(clients []interfaces.Client, cfg *config.
 //   - client.Client: An available client for the requested model
 //   - *client.ErrorMessage: An error message if no client is available
 func (h *BaseAPIHandler) GetClient(modelName string, isGenerateContent ...bool) (interfaces.Client, *interfaces.ErrorMessage) {
+	return h.selectClient(modelName, nil, isGenerateContent...)
+}
+
+// selectClient implements GetClient. Clients for which ignoreQuota returns true are selected
+// regardless of their remembered quota state; a nil ignoreQuota respects it for all clients.
+func (h *BaseAPIHandler) selectClient(modelName string, ignoreQuota func(interfaces.Client) bool, isGenerateContent ...bool) (interfaces.Client, *interfaces.ErrorMessage) {
 	clients := make([]interfaces.Client, 0)
+	exhausted := make([]interfaces.Client, 0)
 	for i := 0; i < len(h.CliClients); i++ {
-		if h.CliClients[i].CanProvideModel(modelName) && h.CliClients[i].IsAvailable() && !h.CliClients[i].IsModelQuotaExceeded(modelName) {
-			clients = append(clients, h.CliClients[i])
+		if !h.CliClients[i].CanProvideModel(modelName) || !h.CliClients[i].IsAvailable() {
+			continue
 		}
-	}
-
-	// Lock the mutex to update the last used client index
-	h.Mutex.Lock()
-	if _, hasKey := h.LastUsedClientIndex[modelName]; !hasKey {
-		h.LastUsedClientIndex[modelName] = 0
+		if (ignoreQuota == nil || !ignoreQuota(h.CliClients[i])) && h.CliClients[i].IsModelQuotaExceeded(modelName) {
+			exhausted = append(exhausted, h.CliClients[i])
+			continue
+		}
+		clients = append(clients, h.CliClients[i])
 	}
 
 	if len(clients) == 0 {
-		h.Mutex.Unlock()
-		return nil, &interfaces.ErrorMessage{StatusCode: 500, Error: fmt.Errorf("no clients available")}
-	}
-
-	var cliClient interfaces.Client
-
-	startIndex := h.LastUsedClientIndex[modelName]
-	if (len(isGenerateContent) > 0 && isGenerateContent[0]) || len(isGenerateContent) == 0 {
-		currentIndex := (startIndex + 1) % len(clients)
-		h.LastUsedClientIndex[modelName] = currentIndex
-	}
-	h.Mutex.Unlock()
-
-	// Reorder the client to start from the last used index
-	reorderedClients := make([]interfaces.Client, 0)
-	for i := 0; i < len(clients); i++ {
-		cliClient = clients[(startIndex+1+i)%len(clients)]
-		reorderedClients = append(reorderedClients, cliClient)
-	}
-
-	if len(reorderedClients) == 0 {
-		if util.GetProviderName(modelName, h.Cfg) == "claude" {
-			// log.Debugf("Claude Model %s is quota exceeded for all accounts", modelName)
-			return nil, &interfaces.ErrorMessage{StatusCode: 429, Error: fmt.Errorf(`{"type":"error","error":{"type":"rate_limit_error","message":"This request would exceed your account's rate limit. Please try again later."}}`)}
+		if len(exhausted) > 0 {
+			return nil, h.quotaExceededError(modelName, exhausted)
 		}
-		return nil, &interfaces.ErrorMessage{StatusCode: 429, Error: fmt.Errorf(`{"error":{"code":429,"message":"All the models of '%s' are quota exceeded","status":"RESOURCE_EXHAUSTED"}}`, modelName)}
+		return nil, &interfaces.ErrorMessage{StatusCode: 500, Error: ErrNoClientsAvailable}
 	}
 
+	h.Mutex.Lock()
+	slices.SortStableFunc(clients, h.compareClients)
+
+	var cliClient interfaces.Client
 	locked := false
-	for i := 0; i < len(reorderedClients); i++ {
-		cliClient = reorderedClients[i]
+	for i := 0; i < len(clients); i++ {
+		cliClient = clients[i]
 		if mutex := cliClient.GetRequestMutex(); mutex != nil {
 			if mutex.TryLock() {
 				locked = true
@@ -145,10 +163,20 @@ func (h *BaseAPIHandler) GetClient(modelName string, isGenerateContent ...bool)
 			}
 		} else {
 			locked = true
+			break
 		}
 	}
 	if !locked {
 		cliClient = clients[0]
+	}
+	// Only content generation counts as a use, so that token counting does not move clients.
+	if (len(isGenerateContent) > 0 && isGenerateContent[0]) || len(isGenerateContent) == 0 {
+		h.LastUsedAt[cliClient] = time.Now()
+		h.Uses[cliClient]++
+	}
+	h.Mutex.Unlock()
+
+	if !locked {
 		if mutex := cliClient.GetRequestMutex(); mutex != nil {
 			mutex.Lock()
 		}
@@ -157,6 +185,73 @@ func (h *BaseAPIHandler) GetClient(modelName string, isGenerateContent ...bool)
 	return cliClient, nil
 }
 
+// compareClients orders the clients a request may be sent to, best first. With latency load
+// balancing, clients are ordered by their recent upstream latency divided by their weight, so
+// a key with weight 2 is preferred unless it is more than twice as slow. Otherwise, or at equal
+// latency, weighted API keys are ordered by their uses divided by their weight, so that each
+// key receives its share of the requests. Remaining ties go to the least recently used client;
+// clients that were never used keep their configured order and go first. Clients without a
+// weight, such as token file accounts, have a weight of 1. The caller must hold h.Mutex.
+func (h *BaseAPIHandler) compareClients(a, b interfaces.Client) int {
+	weightA, weightB := 1, 1
+	if len(h.Cfg.GlAPIKeyWeights) > 0 {
+		weightA, weightB = clientWeight(a), clientWeight(b)
+	}
+	if h.Cfg.LoadBalance == "latency" {
+		if order := cmp.Compare(upstreamLatency(a)*time.Duration(weightB), upstreamLatency(b)*time.Duration(weightA)); order != 0 {
+			return order
+		}
+	}
+	if len(h.Cfg.GlAPIKeyWeights) > 0 {
+		if order := cmp.Compare(h.Uses[a]*weightB, h.Uses[b]*weightA); order != 0 {
+			return order
+		}
+	}
+	return h.LastUsedAt[a].Compare(h.LastUsedAt[b])
+}
+
+// upstreamLatency returns the recent upstream latency of a client, or 0 if it has no recent
+// measurement, so that such clients are tried and measured first.
+func upstreamLatency(cliClient interfaces.Client) time.Duration {
+	if latencyClient, ok := cliClient.(interface {
+		UpstreamLatency() (time.Duration, bool)
+	}); ok {
+		if latency, measured := latencyClient.UpstreamLatency(); measured {
+			return latency
+		}
+	}
+	return 0
+}
+
+// clientWeight returns the load balancing weight of a client: the configured weight of its
+// API key, or 1 for clients without one.
+func clientWeight(cliClient interfaces.Client) int {
+	if weightedClient, ok := cliClient.(interface{ Weight() int }); ok {
+		return weightedClient.Weight()
+	}
+	return 1
+}
+
+// RequestedCapabilities returns the model capabilities requested with the 'capability' query
+// parameter, which may be repeated or hold a comma-separated list (e.g. ?capability=tools,vision).
+//
+// Parameters:
+//   - c: The Gin context containing the HTTP request
+//
+// Returns:
+//   - []string: The requested capabilities
+func RequestedCapabilities(c *gin.Context) []string {
+	capabilities := make([]string, 0)
+	for _, value := range c.QueryArray("capability") {
+		for _, capability := range strings.Split(value, ",") {
+			if capability = strings.TrimSpace(capability); capability != "" {
+				capabilities = append(capabilities, capability)
+			}
+		}
+	}
+	return capabilities
+}
+
 // GetAlt extracts the 'alt' parameter from the request query string.
 // It checks both 'alt' and '$alt' parameters and returns the appropriate value.
 //
@@ -178,8 +273,23 @@ func (h *BaseAPIHandler) GetAlt(c *gin.Context) string {
 	return alt
 }
 
+// inboundHandler overrides the format reported by a handler with a custom inbound
+// format registered through translator.RegisterInbound.
+type inboundHandler struct {
+	interfaces.APIHandler
+	from string
+}
+
+// HandlerType returns the registered inbound format.
+func (h inboundHandler) HandlerType() string {
+	return h.from
+}
+
 // GetContextWithCancel creates a new context with cancellation capabilities.
-// It embeds the Gin context and the API handler into the new context for later use.
+// It embeds the Gin context and the API handler into the new context for later use, and the
+// start of the request, from which clients measure the first token latency of streams.
+// If a custom inbound format is registered for the route and content type, the handler
+// reports that format so the matching translators are used.
 // The returned cancel function also handles logging the API response if request logging is enabled.
 //
 // Parameters:
@@ -193,7 +303,11 @@ func (h *BaseAPIHandler) GetAlt(c *gin.Context) string {
 func (h *BaseAPIHandler) GetContextWithCancel(handler interfaces.APIHandler, c *gin.Context, ctx context.Context) (context.Context, APIHandlerCancelFunc) {
 	newCtx, cancel := context.WithCancel(ctx)
 	newCtx = context.WithValue(newCtx, "gin", c)
+	if from, ok := translator.InboundFormat(c.FullPath(), c.GetHeader("Content-Type")); ok {
+		handler = inboundHandler{APIHandler: handler, from: from}
+	}
 	newCtx = context.WithValue(newCtx, "handler", handler)
+	newCtx = context.WithValue(newCtx, "requestStart", time.Now())
 	return newCtx, func(params ...interface{}) {
 		if h.Cfg.RequestLog {
 			if len(params) == 1 {
@@ -215,7 +329,10 @@ func (h *BaseAPIHandler) GetContextWithCancel(handler interfaces.APIHandler, c *
 	}
 }
 
+// LoggingAPIResponseError records an upstream error of a request: it is counted against the
+// account that served the request and, when request logging is enabled, kept for the request log.
 func (h *BaseAPIHandler) LoggingAPIResponseError(ctx context.Context, err *interfaces.ErrorMessage) {
+	h.recordAccountError(ctx, err)
 	if h.Cfg.RequestLog {
 		if ginContext, ok := ctx.Value("gin").(*gin.Context); ok {
 			if apiResponseErrors, isExist := ginContext.Get("API_RESPONSE_ERROR"); isExist {
@@ -231,6 +348,21 @@ func (h *BaseAPIHandler) LoggingAPIResponseError(ctx context.Context, err *inter
 	}
 }
 
+// WriteErrorStatus writes the status of an error response together with the headers the
+// client attached to the error, such as the Retry-After of an upstream 429.
+//
+// Parameters:
+//   - c: The Gin context of the current request
+//   - err: The error to respond with
+func (h *BaseAPIHandler) WriteErrorStatus(c *gin.Context, err *interfaces.ErrorMessage) {
+	for key, values := range err.Addon {
+		for _, value := range values {
+			c.Writer.Header().Add(key, value)
+		}
+	}
+	c.Status(err.StatusCode)
+}
+
 // APIHandlerCancelFunc is a function type for canceling an API handler's context.
 // It can optionally accept parameters, which are used for logging the response.
 type APIHandlerCancelFunc func(params ...interface{})
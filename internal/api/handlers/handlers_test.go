@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+)
+
+// fakeClient is a client of the pool with a fixed latency and load balancing weight. Methods
+// not needed for client selection are left to the embedded nil interface.
+type fakeClient struct {
+	interfaces.Client
+	name    string
+	latency time.Duration
+	weight  int
+	mutex   *sync.Mutex
+}
+
+func (c *fakeClient) CanProvideModel(string) bool      { return true }
+func (c *fakeClient) IsAvailable() bool                { return true }
+func (c *fakeClient) IsModelQuotaExceeded(string) bool { return false }
+func (c *fakeClient) GetRequestMutex() *sync.Mutex     { return c.mutex }
+func (c *fakeClient) Weight() int                      { return c.weight }
+func (c *fakeClient) Type() string                     { return "gemini" }
+func (c *fakeClient) GetEmail() string                 { return c.name }
+
+func (c *fakeClient) UpstreamLatency() (time.Duration, bool) {
+	return c.latency, c.latency > 0
+}
+
+// selections sends n requests and counts the requests each client received.
+func selections(t *testing.T, h *BaseAPIHandler, n int) map[string]int {
+	t.Helper()
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		cliClient, errMsg := h.GetClient("gemini-2.5-pro")
+		if errMsg != nil {
+			t.Fatalf("GetClient() error = %v", errMsg.Error)
+		}
+		counts[cliClient.(*fakeClient).name]++
+	}
+	return counts
+}
+
+func TestGetClientPrefersLowerLatency(t *testing.T) {
+	fast := &fakeClient{name: "fast", latency: 100 * time.Millisecond, weight: 1}
+	slow := &fakeClient{name: "slow", latency: 300 * time.Millisecond, weight: 1}
+	h := NewBaseAPIHandlers([]interfaces.Client{slow, fast}, &config.Config{LoadBalance: "latency"})
+
+	if counts := selections(t, h, 10); counts["fast"] != 10 {
+		t.Errorf("selections = %v, want all requests on the fast client", counts)
+	}
+}
+
+func TestGetClientLatencyIsDividedByWeight(t *testing.T) {
+	// The weighted key is slower, but less than three times as slow, so it is preferred.
+	weighted := &fakeClient{name: "weighted", latency: 250 * time.Millisecond, weight: 3}
+	fast := &fakeClient{name: "fast", latency: 100 * time.Millisecond, weight: 1}
+	cfg := &config.Config{LoadBalance: "latency", GlAPIKeyWeights: []int{3, 1}}
+	h := NewBaseAPIHandlers([]interfaces.Client{fast, weighted}, cfg)
+	if counts := selections(t, h, 10); counts["weighted"] != 10 {
+		t.Errorf("selections = %v, want all requests on the weighted client", counts)
+	}
+
+	// More than three times as slow, the weighted key loses to the faster one.
+	weighted.latency = 400 * time.Millisecond
+	if counts := selections(t, h, 10); counts["fast"] != 10 {
+		t.Errorf("selections = %v, want all requests on the fast client", counts)
+	}
+}
+
+func TestGetClientSharesRequestsByWeight(t *testing.T) {
+	heavy := &fakeClient{name: "heavy", weight: 3}
+	light := &fakeClient{name: "light", weight: 1}
+	h := NewBaseAPIHandlers([]interfaces.Client{heavy, light}, &config.Config{GlAPIKeyWeights: []int{3, 1}})
+
+	counts := selections(t, h, 400)
+	if counts["heavy"] != 300 || counts["light"] != 100 {
+		t.Errorf("selections = %v, want 300 heavy and 100 light", counts)
+	}
+
+	// Without measurements, latency load balancing falls back to the weighted shares.
+	h = NewBaseAPIHandlers([]interfaces.Client{heavy, light}, &config.Config{LoadBalance: "latency", GlAPIKeyWeights: []int{3, 1}})
+	counts = selections(t, h, 400)
+	if counts["heavy"] != 300 || counts["light"] != 100 {
+		t.Errorf("selections with latency load balancing = %v, want 300 heavy and 100 light", counts)
+	}
+}
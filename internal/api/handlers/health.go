@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/client"
+	"github.com/luispater/CLIProxyAPI/v5/internal/util"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Health reports whether the proxy can serve requests, for load balancer health checks.
+// It answers 200 if at least one account can be used and 503 otherwise, with the state of
+// every account in the body. The token expiry of Gemini CLI accounts is the one last
+// obtained; probes do not refresh tokens. Accounts that lost access to their project are
+// reported with needs_attention. The load reports the API requests in flight and the
+// overload threshold past which new requests are rejected, which are 503 responses
+// unrelated to the state of the accounts.
+// Account e-mails and API keys are masked, as the endpoint requires no authentication.
+// Project IDs and project access errors are only included for requests carrying the
+// management key in the X-Management-Key header.
+func (h *BaseAPIHandler) Health(c *gin.Context) {
+	h.Mutex.Lock()
+	clients := h.CliClients
+	h.Mutex.Unlock()
+
+	details := h.managementKeyProvided(c)
+	accounts := make([]gin.H, 0, len(clients))
+	healthy := false
+	for _, cliClient := range clients {
+		account := gin.H{
+			"type":      cliClient.Type(),
+			"account":   util.AccountLabel(h.Cfg, cliClient.GetEmail()),
+			"available": cliClient.IsAvailable(),
+		}
+		usable := cliClient.IsAvailable()
+		if projectClient, ok := cliClient.(interface{ GetProjectID() string }); ok && details {
+			account["project_id"] = projectClient.GetProjectID()
+		}
+		if tokenClient, ok := cliClient.(interface{ TokenExpiry() (time.Time, error) }); ok {
+			if expiry, err := tokenClient.TokenExpiry(); err != nil {
+				account["error"] = err.Error()
+			} else {
+				account["token_expiry"] = expiry.UTC().Format(time.RFC3339)
+			}
+		}
+		if healthClient, ok := cliClient.(interface{ Health() client.HealthStatus }); ok {
+			if health := healthClient.Health(); health.ProjectAccessLost {
+				account["needs_attention"] = true
+				account["project_access_lost"] = true
+				if details {
+					account["project_access_error"] = health.ProjectAccessError
+				}
+				usable = false
+			}
+		}
+		account["healthy"] = usable
+		healthy = healthy || usable
+		accounts = append(accounts, account)
+	}
+
+	status, statusCode := "ok", http.StatusOK
+	if !healthy {
+		status, statusCode = "unavailable", http.StatusServiceUnavailable
+	}
+	response := gin.H{"status": status, "accounts": accounts}
+	if h.LoadShedder != nil {
+		active, maxActive := h.LoadShedder.Active(), h.LoadShedder.MaxActive()
+		response["load"] = gin.H{
+			"active_requests":     active,
+			"max_active_requests": maxActive,
+			"overloaded":          maxActive > 0 && active >= maxActive,
+		}
+	}
+	c.JSON(statusCode, response)
+}
+
+// managementKeyProvided reports whether the request carries the management key in the
+// X-Management-Key header. The key is only checked if the header is present, so that
+// regular probes do not pay for the bcrypt comparison.
+func (h *BaseAPIHandler) managementKeyProvided(c *gin.Context) bool {
+	provided := c.GetHeader("X-Management-Key")
+	secret := h.Cfg.RemoteManagement.SecretKey
+	if provided == "" || secret == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(secret), []byte(provided)) == nil
+}
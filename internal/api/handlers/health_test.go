@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/api/middleware"
+	"github.com/luispater/CLIProxyAPI/v5/internal/client"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	"github.com/tidwall/gjson"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHealthReportsLoad(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewBaseAPIHandlers([]interfaces.Client{&fakeClient{name: "key"}}, &config.Config{})
+	h.LoadShedder = middleware.NewLoadShedder(8, 5)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/health", nil)
+	h.Health(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	load := gjson.Get(w.Body.String(), "load")
+	if got := load.Get("active_requests").Int(); got != 0 {
+		t.Errorf("load.active_requests = %d, want 0", got)
+	}
+	if got := load.Get("max_active_requests").Int(); got != 8 {
+		t.Errorf("load.max_active_requests = %d, want 8", got)
+	}
+	if load.Get("overloaded").Bool() {
+		t.Error("load.overloaded = true, want false")
+	}
+}
+
+// projectClient is an account of a Gemini CLI project that lost access to it.
+type projectClient struct {
+	fakeClient
+}
+
+func (c *projectClient) GetProjectID() string { return "secret-project" }
+
+func (c *projectClient) Health() client.HealthStatus {
+	return client.HealthStatus{ProjectAccessLost: true, ProjectAccessError: "permission denied on secret-project"}
+}
+
+func TestHealthShowsProjectsOnlyWithManagementKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hashed, err := bcrypt.GenerateFromPassword([]byte("management-key"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{}
+	cfg.RemoteManagement.SecretKey = string(hashed)
+	h := NewBaseAPIHandlers([]interfaces.Client{&projectClient{fakeClient{name: "user@example.com"}}}, cfg)
+
+	tests := []struct {
+		name        string
+		key         string
+		wantDetails bool
+	}{
+		{name: "no key"},
+		{name: "wrong key", key: "guess"},
+		{name: "management key", key: "management-key", wantDetails: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/health", nil)
+			if tt.key != "" {
+				c.Request.Header.Set("X-Management-Key", tt.key)
+			}
+			h.Health(c)
+
+			if w.Code != http.StatusServiceUnavailable {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+			}
+			account := gjson.Get(w.Body.String(), "accounts.0")
+			if !account.Get("needs_attention").Bool() {
+				t.Errorf("account = %s, want needs_attention", account.Raw)
+			}
+			if got := account.Get("project_id").Exists(); got != tt.wantDetails {
+				t.Errorf("project_id present = %t, want %t: %s", got, tt.wantDetails, account.Raw)
+			}
+			if got := account.Get("project_access_error").Exists(); got != tt.wantDetails {
+				t.Errorf("project_access_error present = %t, want %t: %s", got, tt.wantDetails, account.Raw)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// historyTrimmedNote is added to the system instruction when history-limit.note is enabled.
+const historyTrimmedNote = "%d earlier messages of this conversation were omitted."
+
+// historyFormat describes where the messages and the system instruction of an API format are.
+type historyFormat struct {
+	// messagesPath is the path of the message array.
+	messagesPath string
+
+	// isSystem reports whether a message is a system instruction, which is never dropped.
+	isSystem func(message gjson.Result) bool
+
+	// isTurnStart reports whether a message can start the retained history: a user message
+	// that is not a tool result, so that tool calls are never separated from their results.
+	isTurnStart func(message gjson.Result) bool
+
+	// addNote adds the omitted-messages note to the request.
+	addNote func(rawJSON []byte, note string) []byte
+}
+
+// historyFormats maps the handler types to the layout of their requests.
+var historyFormats = map[string]historyFormat{
+	OPENAI: {
+		messagesPath: "messages",
+		isSystem:     isOpenAISystemMessage,
+		isTurnStart: func(message gjson.Result) bool {
+			return message.Get("role").String() == "user"
+		},
+		addNote: func(rawJSON []byte, note string) []byte {
+			// The note goes after the system messages, which precede the retained history.
+			index := 0
+			for _, message := range gjson.GetBytes(rawJSON, "messages").Array() {
+				if !isOpenAISystemMessage(message) {
+					break
+				}
+				index++
+			}
+			messages := []byte(gjson.GetBytes(rawJSON, "messages").Raw)
+			noteMessage, _ := sjson.Set(`{"role":"system"}`, "content", note)
+			messages = insertRaw(messages, index, noteMessage)
+			rawJSON, _ = sjson.SetRawBytes(rawJSON, "messages", messages)
+			return rawJSON
+		},
+	},
+	OPENAI_RESPONSE: {
+		messagesPath: "input",
+		isSystem:     isOpenAISystemMessage,
+		isTurnStart: func(message gjson.Result) bool {
+			itemType := message.Get("type").String()
+			return (itemType == "" || itemType == "message") && message.Get("role").String() == "user"
+		},
+		addNote: func(rawJSON []byte, note string) []byte {
+			return appendText(rawJSON, "instructions", note)
+		},
+	},
+	CLAUDE: {
+		messagesPath: "messages",
+		isSystem:     func(gjson.Result) bool { return false },
+		isTurnStart: func(message gjson.Result) bool {
+			if message.Get("role").String() != "user" {
+				return false
+			}
+			for _, content := range message.Get("content").Array() {
+				if content.Get("type").String() == "tool_result" {
+					return false
+				}
+			}
+			return true
+		},
+		addNote: func(rawJSON []byte, note string) []byte {
+			if system := gjson.GetBytes(rawJSON, "system"); system.IsArray() {
+				block, _ := sjson.Set(`{"type":"text"}`, "text", note)
+				rawJSON, _ = sjson.SetRawBytes(rawJSON, "system.-1", []byte(block))
+				return rawJSON
+			}
+			return appendText(rawJSON, "system", note)
+		},
+	},
+	GEMINI:    geminiHistoryFormat(""),
+	GEMINICLI: geminiHistoryFormat("request."),
+}
+
+// geminiHistoryFormat returns the layout of Gemini requests, whose fields are below
+// pathPrefix ("request." for Gemini CLI).
+func geminiHistoryFormat(pathPrefix string) historyFormat {
+	return historyFormat{
+		messagesPath: pathPrefix + "contents",
+		isSystem:     func(gjson.Result) bool { return false },
+		isTurnStart: func(content gjson.Result) bool {
+			if content.Get("role").String() != "user" {
+				return false
+			}
+			for _, part := range content.Get("parts").Array() {
+				if part.Get("functionResponse").Exists() {
+					return false
+				}
+			}
+			return true
+		},
+		addNote: func(rawJSON []byte, note string) []byte {
+			path := pathPrefix + "systemInstruction"
+			if !gjson.GetBytes(rawJSON, path).Exists() && gjson.GetBytes(rawJSON, pathPrefix+"system_instruction").Exists() {
+				path = pathPrefix + "system_instruction"
+			}
+			part, _ := sjson.Set(`{}`, "text", note)
+			rawJSON, _ = sjson.SetRawBytes(rawJSON, path+".parts.-1", []byte(part))
+			return rawJSON
+		},
+	}
+}
+
+// trimHistory drops the oldest messages of a request that has more than the configured
+// maximum number of messages (history-limit.max-messages, or the key's max-history-messages).
+// System instructions are always kept, and the retained history starts with a user turn.
+//
+// Parameters:
+//   - c: The Gin context of the current request
+//   - handlerType: The API format of the request (e.g. OPENAI, CLAUDE)
+//   - rawJSON: The raw JSON request body
+//
+// Returns:
+//   - []byte: The request body with at most the maximum number of messages
+func (h *BaseAPIHandler) trimHistory(c *gin.Context, handlerType string, rawJSON []byte) []byte {
+	maxMessages := h.Cfg.HistoryLimit.MaxMessages
+	if setting := h.Cfg.GetAPIKeySetting(c.GetString("apiKey")); setting != nil && setting.MaxHistoryMessages > 0 {
+		maxMessages = setting.MaxHistoryMessages
+	}
+	format, ok := historyFormats[handlerType]
+	if maxMessages <= 0 || !ok {
+		return rawJSON
+	}
+
+	messages := gjson.GetBytes(rawJSON, format.messagesPath)
+	if !messages.IsArray() {
+		return rawJSON
+	}
+	history := make([]gjson.Result, 0)
+	for _, message := range messages.Array() {
+		if !format.isSystem(message) {
+			history = append(history, message)
+		}
+	}
+	if len(history) <= maxMessages {
+		return rawJSON
+	}
+
+	// Prefer dropping more messages to start at a user turn; if no later message can start
+	// the history, keep earlier messages instead.
+	cut := -1
+	for start := len(history) - maxMessages; start < len(history); start++ {
+		if format.isTurnStart(history[start]) {
+			cut = start
+			break
+		}
+	}
+	for start := len(history) - maxMessages - 1; cut < 0 && start > 0; start-- {
+		if format.isTurnStart(history[start]) {
+			cut = start
+		}
+	}
+	if cut <= 0 {
+		return rawJSON
+	}
+
+	trimmed := []byte(`[]`)
+	index := 0
+	for _, message := range messages.Array() {
+		if format.isSystem(message) {
+			trimmed, _ = sjson.SetRawBytes(trimmed, "-1", []byte(message.Raw))
+			continue
+		}
+		if index >= cut {
+			trimmed, _ = sjson.SetRawBytes(trimmed, "-1", []byte(message.Raw))
+		}
+		index++
+	}
+	rawJSON, _ = sjson.SetRawBytes(rawJSON, format.messagesPath, trimmed)
+	if h.Cfg.HistoryLimit.Note {
+		rawJSON = format.addNote(rawJSON, fmt.Sprintf(historyTrimmedNote, cut))
+	}
+
+	log.Debugf("Dropped %d of %d messages to keep the history within %d messages (request %s)", cut, len(history), maxMessages, c.GetString("requestID"))
+	return rawJSON
+}
+
+// isOpenAISystemMessage reports whether an OpenAI message or Responses input item is a
+// system or developer instruction.
+func isOpenAISystemMessage(message gjson.Result) bool {
+	role := message.Get("role").String()
+	return role == "system" || role == "developer"
+}
+
+// appendText appends text to a string field, separated by a blank line.
+func appendText(rawJSON []byte, path, text string) []byte {
+	if current := gjson.GetBytes(rawJSON, path).String(); current != "" {
+		text = current + "\n\n" + text
+	}
+	rawJSON, _ = sjson.SetBytes(rawJSON, path, text)
+	return rawJSON
+}
+
+// insertRaw inserts a raw JSON value into a JSON array at index.
+func insertRaw(array []byte, index int, value string) []byte {
+	out := []byte(`[]`)
+	for i, item := range gjson.ParseBytes(array).Array() {
+		if i == index {
+			out, _ = sjson.SetRawBytes(out, "-1", []byte(value))
+		}
+		out, _ = sjson.SetRawBytes(out, "-1", []byte(item.Raw))
+	}
+	if index >= len(gjson.ParseBytes(array).Array()) {
+		out, _ = sjson.SetRawBytes(out, "-1", []byte(value))
+	}
+	return out
+}
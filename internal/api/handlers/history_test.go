@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	"github.com/tidwall/gjson"
+)
+
+// messageTexts returns the text of every message, system block, or part of an array, whatever
+// its API format.
+func messageTexts(messages gjson.Result) string {
+	texts := make([]string, 0)
+	for _, message := range messages.Array() {
+		for _, path := range []string{"content", "content.0.text", "content.0.content", "parts.0.text", "parts.0.functionCall.name", "parts.0.functionResponse.name", "text"} {
+			if text := message.Get(path); text.Type == gjson.String {
+				texts = append(texts, text.String())
+				break
+			}
+		}
+	}
+	return strings.Join(texts, " ")
+}
+
+func TestTrimHistory(t *testing.T) {
+	const openAIMessages = `{"messages":[{"role":"system","content":"s"},{"role":"user","content":"u1"},{"role":"assistant","content":"a1"},{"role":"user","content":"u2"},{"role":"assistant","content":"a2"},{"role":"user","content":"u3"},{"role":"assistant","content":"a3"}]}`
+	tests := []struct {
+		name         string
+		handlerType  string
+		maxMessages  int
+		apiKeyLimit  int
+		body         string
+		messagesPath string
+		want         string
+	}{
+		{name: "disabled", handlerType: OPENAI, body: openAIMessages, messagesPath: "messages", want: "s u1 a1 u2 a2 u3 a3"},
+		{name: "within the limit", handlerType: OPENAI, maxMessages: 6, body: openAIMessages, messagesPath: "messages", want: "s u1 a1 u2 a2 u3 a3"},
+		{name: "keeps the system prompt and the recent turns", handlerType: OPENAI, maxMessages: 4, body: openAIMessages, messagesPath: "messages", want: "s u2 a2 u3 a3"},
+		{name: "starts at a user turn", handlerType: OPENAI, maxMessages: 3, body: openAIMessages, messagesPath: "messages", want: "s u3 a3"},
+		{name: "API key limit", handlerType: OPENAI, apiKeyLimit: 2, body: openAIMessages, messagesPath: "messages", want: "s u3 a3"},
+		{name: "API key limit overrides the global one", handlerType: OPENAI, maxMessages: 2, apiKeyLimit: 4, body: openAIMessages, messagesPath: "messages", want: "s u2 a2 u3 a3"},
+		{
+			name:         "keeps earlier messages when no later turn starts",
+			handlerType:  OPENAI,
+			maxMessages:  2,
+			body:         `{"messages":[{"role":"user","content":"u1"},{"role":"assistant","content":"a1"},{"role":"user","content":"u2"},{"role":"assistant","content":"a2"},{"role":"assistant","content":"a3"},{"role":"assistant","content":"a4"}]}`,
+			messagesPath: "messages",
+			want:         "u2 a2 a3 a4",
+		},
+		{
+			name:         "Responses system input",
+			handlerType:  OPENAI_RESPONSE,
+			maxMessages:  2,
+			body:         `{"input":[{"role":"developer","content":"s"},{"role":"user","content":"u1"},{"role":"assistant","content":"a1"},{"role":"user","content":"u2"},{"role":"assistant","content":"a2"}]}`,
+			messagesPath: "input",
+			want:         "s u2 a2",
+		},
+		{
+			name:         "Claude tool results stay with their calls",
+			handlerType:  CLAUDE,
+			maxMessages:  4,
+			body:         `{"system":"s","messages":[{"role":"user","content":"u1"},{"role":"assistant","content":[{"type":"tool_use","id":"t1","name":"f","input":{}}]},{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"r1"}]},{"role":"assistant","content":"a1"},{"role":"user","content":"u2"},{"role":"assistant","content":"a2"}]}`,
+			messagesPath: "messages",
+			want:         "u2 a2",
+		},
+		{
+			name:         "Gemini function responses stay with their calls",
+			handlerType:  GEMINI,
+			maxMessages:  3,
+			body:         `{"contents":[{"role":"user","parts":[{"text":"u1"}]},{"role":"model","parts":[{"text":"m1"}]},{"role":"user","parts":[{"text":"u2"}]},{"role":"model","parts":[{"functionCall":{"name":"f","args":{}}}]},{"role":"user","parts":[{"functionResponse":{"name":"f","response":{}}}]},{"role":"model","parts":[{"text":"m2"}]}]}`,
+			messagesPath: "contents",
+			want:         "u2 f f m2",
+		},
+		{
+			name:         "Gemini CLI request",
+			handlerType:  GEMINICLI,
+			maxMessages:  1,
+			body:         `{"request":{"contents":[{"role":"user","parts":[{"text":"u1"}]},{"role":"model","parts":[{"text":"m1"}]},{"role":"user","parts":[{"text":"u2"}]}]}}`,
+			messagesPath: "request.contents",
+			want:         "u2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{HistoryLimit: config.HistoryLimit{MaxMessages: tt.maxMessages}}
+			cfg.APIKeySettings = []config.APIKeySetting{{APIKey: "team-key", MaxHistoryMessages: tt.apiKeyLimit}}
+			h := NewBaseAPIHandlers([]interfaces.Client{}, cfg)
+
+			got := h.trimHistory(normalizeContext("team-key"), tt.handlerType, []byte(tt.body))
+			if texts := messageTexts(gjson.GetBytes(got, tt.messagesPath)); texts != tt.want {
+				t.Errorf("messages = %q, want %q", texts, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrimHistoryNote(t *testing.T) {
+	tests := []struct {
+		name        string
+		handlerType string
+		body        string
+		notePath    string
+	}{
+		{
+			name:        "OpenAI note after the system messages",
+			handlerType: OPENAI,
+			body:        `{"messages":[{"role":"system","content":"s"},{"role":"user","content":"u1"},{"role":"assistant","content":"a1"},{"role":"user","content":"u2"}]}`,
+			notePath:    "messages.1.content",
+		},
+		{
+			name:        "Responses instructions",
+			handlerType: OPENAI_RESPONSE,
+			body:        `{"instructions":"s","input":[{"role":"user","content":"u1"},{"role":"assistant","content":"a1"},{"role":"user","content":"u2"}]}`,
+			notePath:    "instructions",
+		},
+		{
+			name:        "Claude system blocks",
+			handlerType: CLAUDE,
+			body:        `{"system":[{"type":"text","text":"s"}],"messages":[{"role":"user","content":"u1"},{"role":"assistant","content":"a1"},{"role":"user","content":"u2"}]}`,
+			notePath:    "system.1.text",
+		},
+		{
+			name:        "Gemini system instruction",
+			handlerType: GEMINI,
+			body:        `{"systemInstruction":{"parts":[{"text":"s"}]},"contents":[{"role":"user","parts":[{"text":"u1"}]},{"role":"model","parts":[{"text":"m1"}]},{"role":"user","parts":[{"text":"u2"}]}]}`,
+			notePath:    "systemInstruction.parts.1.text",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewBaseAPIHandlers([]interfaces.Client{}, &config.Config{HistoryLimit: config.HistoryLimit{MaxMessages: 1, Note: true}})
+
+			got := h.trimHistory(normalizeContext(""), tt.handlerType, []byte(tt.body))
+			if note := gjson.GetBytes(got, tt.notePath).String(); !strings.Contains(note, "2 earlier messages of this conversation were omitted.") {
+				t.Errorf("%s = %q, want the omitted-messages note", tt.notePath, note)
+			}
+		})
+	}
+}
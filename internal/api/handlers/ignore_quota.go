@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/client"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+)
+
+// ignoreQuotaTriedKey is the Gin context key of the clients a request that ignores quota
+// state has been sent to.
+const ignoreQuotaTriedKey = "ignoreQuotaTried"
+
+// IgnoreQuotaHeader asks the proxy to attempt the upstream call even if the account is
+// remembered as quota exceeded for the model. It is honored only for API keys with
+// allow-ignore-quota set.
+const IgnoreQuotaHeader = "X-CLIProxy-Ignore-Quota"
+
+// GetRequestClient returns an available client for a request, like GetClient. If the request
+// carries a permitted IgnoreQuotaHeader, remembered quota state is ignored when selecting
+// the client and by the client itself, and a successful call clears it. The quota state of a
+// client the request was already sent to is respected again, so that a request retried after
+// 429 responses moves on to the other clients and ends once all of them were tried. Once the
+// request has used all of its max-upstream-attempts upstream calls, the last upstream error
+// is returned.
+//
+// Parameters:
+//   - c: The Gin context of the current request
+//   - modelName: The name of the model to be used
+//   - isGenerateContent: Optional parameter to indicate if this is for content generation
+//
+// Returns:
+//   - interfaces.Client: An available client for the requested model
+//   - *interfaces.ErrorMessage: An error message if no client is available
+func (h *BaseAPIHandler) GetRequestClient(c *gin.Context, modelName string, isGenerateContent ...bool) (interfaces.Client, *interfaces.ErrorMessage) {
+	if errBudget := client.AttemptBudgetExhausted(c, h.Cfg.MaxUpstreamAttempts); errBudget != nil {
+		return nil, errBudget
+	}
+	var ignoreQuota func(interfaces.Client) bool
+	value, _ := c.Get(ignoreQuotaTriedKey)
+	tried, _ := value.(map[interfaces.Client]bool)
+	if h.ignoresQuota(c) {
+		c.Set("ignoreQuota", true)
+		ignoreQuota = func(cliClient interfaces.Client) bool { return !tried[cliClient] }
+	}
+	cliClient, errorResponse := h.selectClient(modelName, ignoreQuota, isGenerateContent...)
+	if errorResponse == nil {
+		h.recordAccountSelection(c, cliClient)
+		if ignoreQuota != nil {
+			if tried == nil {
+				tried = make(map[interfaces.Client]bool)
+				c.Set(ignoreQuotaTriedKey, tried)
+			}
+			tried[cliClient] = true
+		}
+	}
+	return cliClient, errorResponse
+}
+
+// ignoresQuota reports whether the request may bypass remembered quota state.
+func (h *BaseAPIHandler) ignoresQuota(c *gin.Context) bool {
+	ignore, err := strconv.ParseBool(c.GetHeader(IgnoreQuotaHeader))
+	if err != nil || !ignore {
+		return false
+	}
+	setting := h.Cfg.GetAPIKeySetting(c.GetString("apiKey"))
+	return setting != nil && setting.AllowIgnoreQuota
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+)
+
+// exhaustedClient is an account that answers every request with a 429 and then remembers
+// the model as quota exceeded, as the real clients do.
+type exhaustedClient struct {
+	poolClient
+	calls         int
+	quotaExceeded bool
+}
+
+func (c *exhaustedClient) IsModelQuotaExceeded(string) bool { return c.quotaExceeded }
+
+func (c *exhaustedClient) SendRawMessage(ctx context.Context, _ string, _ []byte, _ string) ([]byte, *interfaces.ErrorMessage) {
+	c.calls++
+	if c.calls > 10 {
+		// Stop a runaway retry loop so that the test fails instead of hanging.
+		return []byte("runaway"), nil
+	}
+	c.quotaExceeded = true
+	return fail(http.StatusTooManyRequests)(ctx)
+}
+
+// ignoreQuotaContext returns the context of a request sending X-CLIProxy-Ignore-Quota with
+// an API key that may ignore quota state.
+func ignoreQuotaContext() context.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	c.Request.Header.Set(IgnoreQuotaHeader, "true")
+	c.Set("apiKey", "admin-key")
+	return context.WithValue(context.Background(), "gin", c)
+}
+
+func TestIgnoreQuotaRetriesStopWhenEveryClientIsExhausted(t *testing.T) {
+	first := &exhaustedClient{poolClient: poolClient{fakeClient: fakeClient{name: "first"}}}
+	second := &exhaustedClient{poolClient: poolClient{fakeClient: fakeClient{name: "second"}}}
+	// Both accounts were already marked before the request, which ignores that state.
+	first.quotaExceeded, second.quotaExceeded = true, true
+	cfg := &config.Config{APIKeySettings: []config.APIKeySetting{{APIKey: "admin-key", AllowIgnoreQuota: true}}}
+	cfg.QuotaExceeded.SwitchProject = true
+	pool := NewClientPool(NewBaseAPIHandlers([]interfaces.Client{first, second}, cfg))
+
+	resp, err := pool.SendMessage(ignoreQuotaContext(), "gemini-2.5-pro", []byte(`{}`), "")
+	if err == nil {
+		t.Fatalf("SendMessage() = %q, want a quota error", resp)
+	}
+	if err.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want %d", err.StatusCode, http.StatusTooManyRequests)
+	}
+	if first.calls != 1 || second.calls != 1 {
+		t.Errorf("upstream calls = %d and %d, want each account tried once", first.calls, second.calls)
+	}
+}
+
+func TestIgnoreQuotaAttemptsExhaustedClient(t *testing.T) {
+	exhausted := &exhaustedClient{poolClient: poolClient{fakeClient: fakeClient{name: "exhausted"}, send: answer("ok")}, quotaExceeded: true}
+	cfg := &config.Config{APIKeySettings: []config.APIKeySetting{{APIKey: "admin-key", AllowIgnoreQuota: true}}}
+	h := NewBaseAPIHandlers([]interfaces.Client{exhausted}, cfg)
+
+	if _, err := h.GetClient("gemini-2.5-pro"); err == nil {
+		t.Fatal("GetClient() selected a quota exceeded client")
+	}
+	cliClient, err := h.GetRequestClient(ignoreQuotaContext().Value("gin").(*gin.Context), "gemini-2.5-pro")
+	if err != nil {
+		t.Fatalf("GetRequestClient() error = %v", err.Error)
+	}
+	if cliClient != exhausted {
+		t.Errorf("GetRequestClient() = %v, want the quota exceeded client", cliClient)
+	}
+}
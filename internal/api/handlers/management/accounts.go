@@ -0,0 +1,40 @@
+package management
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/client"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	"github.com/luispater/CLIProxyAPI/v5/internal/registry"
+)
+
+// SetClients updates the clients reported by the accounts endpoint.
+func (h *Handler) SetClients(clients []interfaces.Client) {
+	h.clientsMu.Lock()
+	h.clients = clients
+	h.clientsMu.Unlock()
+}
+
+// GetAccounts returns the availability, quota, and health state of every loaded client.
+func (h *Handler) GetAccounts(c *gin.Context) {
+	h.clientsMu.RLock()
+	clients := h.clients
+	h.clientsMu.RUnlock()
+
+	accounts := make([]gin.H, 0, len(clients))
+	for _, cli := range clients {
+		account := gin.H{
+			"type":      cli.Type(),
+			"provider":  cli.Provider(),
+			"email":     cli.GetEmail(),
+			"available": cli.IsAvailable(),
+		}
+		if identified, ok := cli.(interface{ GetClientID() string }); ok {
+			account["quota-exceeded-models"] = registry.GetGlobalRegistry().GetQuotaExceededModels(identified.GetClientID())
+		}
+		if reporter, ok := cli.(interface{ Health() client.HealthStatus }); ok {
+			account["health"] = reporter.Health()
+		}
+		accounts = append(accounts, account)
+	}
+	c.JSON(200, gin.H{"accounts": accounts})
+}
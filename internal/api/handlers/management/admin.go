@@ -0,0 +1,42 @@
+package management
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminPage is the self-contained admin UI. It holds no data itself; it asks for the
+// management key and loads the accounts and metrics endpoints with it.
+//
+//go:embed admin/index.html
+var adminPage []byte
+
+// adminRealm is the realm of the basic auth challenge sent for the admin UI.
+const adminRealm = `Basic realm="CLIProxyAPI Admin"`
+
+// AdminMiddleware protects the admin UI with the management key. Requests without a valid
+// key are rejected like management API requests, with a basic auth challenge so that
+// browsers prompt for the key, which is entered as the password.
+func (h *Handler) AdminMiddleware() gin.HandlerFunc {
+	authorize := h.Middleware()
+	return func(c *gin.Context) {
+		if !h.cfg.RemoteManagement.AdminUI {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		c.Header("WWW-Authenticate", adminRealm)
+		authorize(c)
+	}
+}
+
+// GetAdminUI serves the admin UI when remote-management.admin-ui is enabled.
+func (h *Handler) GetAdminUI(c *gin.Context) {
+	if !h.cfg.RemoteManagement.AdminUI {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	c.Writer.Header().Del("WWW-Authenticate")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", adminPage)
+}
@@ -0,0 +1,85 @@
+package management
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newAdminEngine serves the admin UI as the server does, with the management key "secret".
+func newAdminEngine(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	hashed, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("hash management key: %v", err)
+	}
+	cfg := &config.Config{}
+	cfg.RemoteManagement.SecretKey = string(hashed)
+	cfg.RemoteManagement.AdminUI = true
+	h := NewHandler(cfg, "")
+
+	engine := gin.New()
+	engine.GET("/admin", h.AdminMiddleware(), h.GetAdminUI)
+	return engine
+}
+
+func TestAdminUIRequiresManagementKey(t *testing.T) {
+	engine := newAdminEngine(t)
+
+	for name, setAuth := range map[string]func(*http.Request){
+		"missing": func(*http.Request) {},
+		"invalid": func(r *http.Request) { r.SetBasicAuth("admin", "wrong") },
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			setAuth(req)
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got != adminRealm {
+				t.Errorf("WWW-Authenticate = %q, want %q", got, adminRealm)
+			}
+			if strings.Contains(w.Body.String(), "<html") {
+				t.Error("the admin page was served without a valid key")
+			}
+		})
+	}
+}
+
+func TestAdminUIServesPageWithManagementKey(t *testing.T) {
+	engine := newAdminEngine(t)
+
+	for name, setAuth := range map[string]func(*http.Request){
+		"basic":  func(r *http.Request) { r.SetBasicAuth("admin", "secret") },
+		"bearer": func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret") },
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			setAuth(req)
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got != "" {
+				t.Errorf("WWW-Authenticate = %q on success, want none", got)
+			}
+			// The page renders the accounts and metrics management endpoints.
+			for _, endpoint := range []string{"/v0/management/accounts", "/v0/management/metrics"} {
+				if !strings.Contains(w.Body.String(), endpoint) {
+					t.Errorf("the admin page does not load %s", endpoint)
+				}
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package management
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -470,30 +471,20 @@ func (h *Handler) RequestGeminiCLIToken(c *gin.Context) {
 		cliClient := client.NewGeminiCLIClient(httpClient2, &ts, h.cfg)
 
 		// Perform the user setup process (migrated from DoLogin)
-		if err = cliClient.SetupUser(ctx, ts.Email, projectID); err != nil {
-			if err.Error() == "failed to start user onboarding, need define a project id" {
-				log.Error("Failed to start user onboarding: A project ID is required.")
-				oauthStatus[state] = "Failed to start user onboarding: A project ID is required"
-				project, errGetProjectList := cliClient.GetProjectList(ctx)
-				if errGetProjectList != nil {
-					log.Fatalf("Failed to get project list: %v", err)
-					oauthStatus[state] = "Failed to get project list"
-				} else {
-					log.Infof("Your account %s needs to specify a project ID.", ts.Email)
-					log.Info("========================================================================")
-					for _, p := range project.Projects {
-						log.Infof("Project ID: %s", p.ProjectID)
-						log.Infof("Project Name: %s", p.Name)
-						log.Info("------------------------------------------------------------------------")
-					}
-					log.Infof("Please run this command to login again with a specific project:\n\n%s --login --project_id <project_id>\n", os.Args[0])
-				}
+		selectedProjectID, err := cliClient.SetupUserWithProjectDiscovery(ctx, ts.Email, projectID)
+		if err != nil {
+			if errors.Is(err, client.ErrProjectIDRequired) {
+				log.Errorf("Failed to complete user setup: %v", err)
+				oauthStatus[state] = err.Error()
 			} else {
 				log.Fatalf("Failed to complete user setup: %v", err)
 				oauthStatus[state] = "Failed to complete user setup"
 			}
 			return
 		}
+		if selectedProjectID != "" {
+			projectID = selectedProjectID
+		}
 
 		// Post-setup checks and token persistence
 		auto := projectID == ""
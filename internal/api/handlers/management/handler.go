@@ -11,6 +11,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -27,6 +28,9 @@ type Handler struct {
 
 	attemptsMu     sync.Mutex
 	failedAttempts map[string]*attemptInfo // keyed by client IP
+
+	clientsMu sync.RWMutex
+	clients   []interfaces.Client
 }
 
 // NewHandler creates a new management handler instance.
@@ -82,12 +86,15 @@ func (h *Handler) Middleware() gin.HandlerFunc {
 			return
 		}
 
-		// Accept either Authorization: Bearer <key> or X-Management-Key
+		// Accept Authorization: Bearer <key>, X-Management-Key, or the key as the
+		// password of HTTP basic auth, which browsers send for the admin page
 		var provided string
 		if ah := c.GetHeader("Authorization"); ah != "" {
 			parts := strings.SplitN(ah, " ", 2)
 			if len(parts) == 2 && strings.ToLower(parts[0]) == "bearer" {
 				provided = parts[1]
+			} else if _, password, ok := c.Request.BasicAuth(); ok {
+				provided = password
 			} else {
 				provided = ah
 			}
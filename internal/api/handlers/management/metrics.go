@@ -0,0 +1,11 @@
+package management
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/metrics"
+)
+
+// GetMetrics returns a snapshot of all in-process counters.
+func (h *Handler) GetMetrics(c *gin.Context) {
+	c.JSON(200, gin.H{"metrics": metrics.Snapshot()})
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+)
+
+// CheckModelAccess enforces the allowed-models and denied-models lists of the API key the
+// request was authenticated with. If the model is not permitted, a 403 error is written to
+// the response.
+//
+// Parameters:
+//   - c: The Gin context of the current request
+//   - modelName: The requested model
+//
+// Returns:
+//   - bool: True if the request may proceed
+func (h *BaseAPIHandler) CheckModelAccess(c *gin.Context, modelName string) bool {
+	setting := h.Cfg.GetAPIKeySetting(c.GetString("apiKey"))
+	if setting == nil || modelAllowed(setting, modelName) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, ErrorResponse{
+		Error: ErrorDetail{
+			Message: fmt.Sprintf("model %s is not allowed for this API key", modelName),
+			Type:    "permission_error",
+		},
+	})
+	return false
+}
+
+// modelAllowed reports whether a key may use a model. A model matching denied-models is
+// always rejected; otherwise it must match allowed-models if that list is set.
+func modelAllowed(setting *config.APIKeySetting, modelName string) bool {
+	if matchModel(setting.DeniedModels, modelName) {
+		return false
+	}
+	return len(setting.AllowedModels) == 0 || matchModel(setting.AllowedModels, modelName)
+}
+
+// matchModel reports whether a model name matches any of the patterns. Patterns may use
+// the wildcards supported by path.Match, for example "gemini-2.5-pro*".
+func matchModel(patterns []string, modelName string) bool {
+	for _, pattern := range patterns {
+		if matched, err := path.Match(pattern, modelName); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
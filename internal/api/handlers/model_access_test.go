@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	"github.com/tidwall/gjson"
+)
+
+func TestCheckModelAccess(t *testing.T) {
+	cfg := &config.Config{APIKeySettings: []config.APIKeySetting{
+		{APIKey: "flash-only", AllowedModels: []string{"gemini-2.5-flash*"}},
+		{APIKey: "no-pro", DeniedModels: []string{"gemini-2.5-pro"}},
+		{APIKey: "deny-wins", AllowedModels: []string{"gemini-*"}, DeniedModels: []string{"gemini-2.5-pro*"}},
+		{APIKey: "unrestricted"},
+	}}
+	tests := []struct {
+		name    string
+		apiKey  string
+		model   string
+		allowed bool
+	}{
+		{name: "allowed by pattern", apiKey: "flash-only", model: "gemini-2.5-flash-lite", allowed: true},
+		{name: "not in allowed list", apiKey: "flash-only", model: "gemini-2.5-pro", allowed: false},
+		{name: "denied model", apiKey: "no-pro", model: "gemini-2.5-pro", allowed: false},
+		{name: "not in denied list", apiKey: "no-pro", model: "gemini-2.5-flash", allowed: true},
+		{name: "denied takes precedence", apiKey: "deny-wins", model: "gemini-2.5-pro-preview", allowed: false},
+		{name: "allowed when not denied", apiKey: "deny-wins", model: "gemini-2.5-flash", allowed: true},
+		{name: "key without lists", apiKey: "unrestricted", model: "gemini-2.5-pro", allowed: true},
+		{name: "key without settings", apiKey: "other", model: "gemini-2.5-pro", allowed: true},
+	}
+	h := NewBaseAPIHandlers(nil, cfg)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+			c.Set("apiKey", tt.apiKey)
+
+			if got := h.CheckModelAccess(c, tt.model); got != tt.allowed {
+				t.Fatalf("CheckModelAccess(%q, %q) = %t, want %t", tt.apiKey, tt.model, got, tt.allowed)
+			}
+			if tt.allowed {
+				if recorder.Body.Len() != 0 {
+					t.Errorf("body = %s, want nothing written for an allowed model", recorder.Body.String())
+				}
+				return
+			}
+			if recorder.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want %d", recorder.Code, http.StatusForbidden)
+			}
+			if got := gjson.Get(recorder.Body.String(), "error.type").String(); got != "permission_error" {
+				t.Errorf("error type = %q, want permission_error", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+	"github.com/luispater/CLIProxyAPI/v5/internal/registry"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// numericParamPaths lists the request fields, across all supported API formats,
+// that are expected to be numbers.
+var numericParamPaths = []string{
+	// OpenAI Chat Completions / Completions / Responses and Claude Messages
+	"temperature",
+	"top_p",
+	"top_k",
+	"max_tokens",
+	"max_completion_tokens",
+	"max_output_tokens",
+	"n",
+	"seed",
+	"presence_penalty",
+	"frequency_penalty",
+	// Gemini generateContent
+	"generationConfig.temperature",
+	"generationConfig.topP",
+	"generationConfig.topK",
+	"generationConfig.maxOutputTokens",
+	"generationConfig.candidateCount",
+	"generationConfig.seed",
+	"generationConfig.presencePenalty",
+	"generationConfig.frequencyPenalty",
+	"generationConfig.thinkingConfig.thinkingBudget",
+	// Gemini CLI internal requests
+	"request.generationConfig.temperature",
+	"request.generationConfig.topP",
+	"request.generationConfig.topK",
+	"request.generationConfig.maxOutputTokens",
+	"request.generationConfig.candidateCount",
+	"request.generationConfig.seed",
+	"request.generationConfig.presencePenalty",
+	"request.generationConfig.frequencyPenalty",
+	"request.generationConfig.thinkingConfig.thinkingBudget",
+}
+
+// NormalizeRequest applies configuration-driven normalization to a raw request body
+// before it is dispatched to a client.
+//
+// Parameters:
+//   - c: The Gin context of the current request
+//   - handlerType: The API format of the request (e.g. OPENAI, CLAUDE)
+//   - rawJSON: The raw JSON request body
+//
+// Returns:
+//   - []byte: The normalized request body
+func (h *BaseAPIHandler) NormalizeRequest(c *gin.Context, handlerType string, rawJSON []byte) []byte {
+	if !h.Cfg.StrictNumericParams {
+		rawJSON = normalizeNumericStrings(rawJSON)
+	}
+	if model := gjson.GetBytes(rawJSON, "model"); model.Type == gjson.String {
+		if resolved := h.ResolveModelName(model.String()); resolved != model.String() {
+			rawJSON, _ = sjson.SetBytes(rawJSON, "model", resolved)
+		}
+	}
+	rawJSON = h.applyAPIKeyDefaults(c, handlerType, rawJSON)
+	rawJSON = h.trimHistory(c, handlerType, rawJSON)
+	rawJSON = h.injectSystemPrompt(c, handlerType, rawJSON)
+	return rawJSON
+}
+
+// ResolveModelName returns the canonical name of a model when case-insensitive-models is
+// enabled and the name differs from a registered model only in case. Otherwise, the name is
+// returned unchanged.
+//
+// Parameters:
+//   - modelName: The model name sent by the client
+//
+// Returns:
+//   - string: The model name to route the request with
+func (h *BaseAPIHandler) ResolveModelName(modelName string) string {
+	if !h.Cfg.CaseInsensitiveModels {
+		return modelName
+	}
+	resolved := registry.GetGlobalRegistry().ResolveModelID(modelName)
+	if resolved != modelName {
+		log.Debugf("resolved model %s to %s", modelName, resolved)
+	}
+	return resolved
+}
+
+// applyAPIKeyDefaults fills in request fields omitted by the client with the defaults
+// configured for the API key the request was authenticated with.
+func (h *BaseAPIHandler) applyAPIKeyDefaults(c *gin.Context, handlerType string, rawJSON []byte) []byte {
+	setting := h.Cfg.GetAPIKeySetting(c.GetString("apiKey"))
+	if setting == nil {
+		return rawJSON
+	}
+
+	if setting.ReasoningEffort != "" {
+		switch handlerType {
+		case OPENAI:
+			if !gjson.GetBytes(rawJSON, "reasoning_effort").Exists() {
+				rawJSON, _ = sjson.SetBytes(rawJSON, "reasoning_effort", setting.ReasoningEffort)
+			}
+		case OPENAI_RESPONSE:
+			if !gjson.GetBytes(rawJSON, "reasoning.effort").Exists() {
+				rawJSON, _ = sjson.SetBytes(rawJSON, "reasoning.effort", setting.ReasoningEffort)
+			}
+		}
+	}
+
+	return rawJSON
+}
+
+// normalizeNumericStrings converts string-encoded numeric parameters (e.g. "temperature": "0.7")
+// into JSON numbers. Strings that do not parse as numbers are left unchanged.
+func normalizeNumericStrings(rawJSON []byte) []byte {
+	for _, path := range numericParamPaths {
+		result := gjson.GetBytes(rawJSON, path)
+		if result.Type != gjson.String {
+			continue
+		}
+		value := strings.TrimSpace(result.String())
+		number, errParseFloat := strconv.ParseFloat(value, 64)
+		if errParseFloat != nil {
+			continue
+		}
+		rawJSON, _ = sjson.SetBytes(rawJSON, path, number)
+	}
+	return rawJSON
+}
+
+// ResolveStreamMode determines whether a Gemini-format request should be streamed. An explicit
+// boolean "stream" field in the body takes precedence over the route (generateContent versus
+// streamGenerateContent). The field is removed from the returned body because the Gemini API
+// does not accept it.
+//
+// Parameters:
+//   - rawJSON: The raw JSON request body
+//   - routeStream: Whether the route implies a streaming response
+//
+// Returns:
+//   - bool: Whether the response should be streamed
+//   - []byte: The request body without the "stream" field
+func ResolveStreamMode(rawJSON []byte, routeStream bool) (bool, []byte) {
+	streamResult := gjson.GetBytes(rawJSON, "stream")
+	if !streamResult.IsBool() {
+		return routeStream, rawJSON
+	}
+	rawJSON, _ = sjson.DeleteBytes(rawJSON, "stream")
+	return streamResult.Bool(), rawJSON
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	"github.com/luispater/CLIProxyAPI/v5/internal/registry"
+	"github.com/tidwall/gjson"
+)
+
+// normalizeContext returns the Gin context of a request authenticated with apiKey.
+func normalizeContext(apiKey string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	c.Set("apiKey", apiKey)
+	return c
+}
+
+func TestNormalizeRequestNumericStrings(t *testing.T) {
+	tests := []struct {
+		name   string
+		strict bool
+		body   string
+		path   string
+		want   string
+	}{
+		{name: "string temperature", body: `{"temperature":"0.7"}`, path: "temperature", want: `0.7`},
+		{name: "padded integer", body: `{"max_tokens":" 256 "}`, path: "max_tokens", want: `256`},
+		{name: "Gemini generation config", body: `{"generationConfig":{"topK":"40"}}`, path: "generationConfig.topK", want: `40`},
+		{name: "Gemini CLI request", body: `{"request":{"generationConfig":{"thinkingConfig":{"thinkingBudget":"1024"}}}}`, path: "request.generationConfig.thinkingConfig.thinkingBudget", want: `1024`},
+		{name: "not a number", body: `{"temperature":"warm"}`, path: "temperature", want: `"warm"`},
+		{name: "other fields untouched", body: `{"user":"42"}`, path: "user", want: `"42"`},
+		{name: "strict mode", strict: true, body: `{"temperature":"0.7"}`, path: "temperature", want: `"0.7"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewBaseAPIHandlers([]interfaces.Client{}, &config.Config{StrictNumericParams: tt.strict})
+			got := h.NormalizeRequest(normalizeContext(""), OPENAI, []byte(tt.body))
+			if raw := gjson.GetBytes(got, tt.path).Raw; raw != tt.want {
+				t.Errorf("%s = %s, want %s", tt.path, raw, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeRequestAppliesAPIKeyReasoningEffort(t *testing.T) {
+	cfg := &config.Config{APIKeySettings: []config.APIKeySetting{{APIKey: "team-key", ReasoningEffort: "low"}}}
+	h := NewBaseAPIHandlers([]interfaces.Client{}, cfg)
+
+	tests := []struct {
+		name        string
+		apiKey      string
+		handlerType string
+		body        string
+		path        string
+		want        string
+	}{
+		{name: "chat default", apiKey: "team-key", handlerType: OPENAI, body: `{"model":"m"}`, path: "reasoning_effort", want: "low"},
+		{name: "chat explicit", apiKey: "team-key", handlerType: OPENAI, body: `{"model":"m","reasoning_effort":"high"}`, path: "reasoning_effort", want: "high"},
+		{name: "responses default", apiKey: "team-key", handlerType: OPENAI_RESPONSE, body: `{"model":"m"}`, path: "reasoning.effort", want: "low"},
+		{name: "responses explicit", apiKey: "team-key", handlerType: OPENAI_RESPONSE, body: `{"model":"m","reasoning":{"effort":"medium"}}`, path: "reasoning.effort", want: "medium"},
+		{name: "other key", apiKey: "other-key", handlerType: OPENAI, body: `{"model":"m"}`, path: "reasoning_effort", want: ""},
+		{name: "other format", apiKey: "team-key", handlerType: CLAUDE, body: `{"model":"m"}`, path: "reasoning_effort", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := h.NormalizeRequest(normalizeContext(tt.apiKey), tt.handlerType, []byte(tt.body))
+			if effort := gjson.GetBytes(got, tt.path).String(); effort != tt.want {
+				t.Errorf("%s = %q, want %q", tt.path, effort, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveStreamMode(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		routeStream bool
+		want        bool
+	}{
+		{name: "route generateContent", body: `{"contents":[]}`, want: false},
+		{name: "route streamGenerateContent", body: `{"contents":[]}`, routeStream: true, want: true},
+		{name: "body stream true", body: `{"contents":[],"stream":true}`, want: true},
+		{name: "body stream false", body: `{"contents":[],"stream":false}`, routeStream: true, want: false},
+		{name: "non-boolean stream ignored", body: `{"contents":[],"stream":"yes"}`, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, body := ResolveStreamMode([]byte(tt.body), tt.routeStream)
+			if got != tt.want {
+				t.Errorf("ResolveStreamMode() = %t, want %t", got, tt.want)
+			}
+			if stream := gjson.GetBytes(body, "stream"); stream.IsBool() {
+				t.Errorf("body still has the stream field: %s", body)
+			}
+		})
+	}
+}
+
+func TestResolveModelName(t *testing.T) {
+	reg := registry.GetGlobalRegistry()
+	reg.RegisterClient("case-test", "gemini", []*registry.ModelInfo{{ID: "case-test-model-flash", Type: "gemini"}})
+	t.Cleanup(func() { reg.UnregisterClient("case-test") })
+
+	tests := []struct {
+		name            string
+		caseInsensitive bool
+		model           string
+		want            string
+	}{
+		{name: "canonical", caseInsensitive: true, model: "case-test-model-flash", want: "case-test-model-flash"},
+		{name: "mixed case", caseInsensitive: true, model: "Case-Test-Model-Flash", want: "case-test-model-flash"},
+		{name: "upper case", caseInsensitive: true, model: "CASE-TEST-MODEL-FLASH", want: "case-test-model-flash"},
+		{name: "unknown model", caseInsensitive: true, model: "Case-Test-Model-Pro", want: "Case-Test-Model-Pro"},
+		{name: "disabled", model: "Case-Test-Model-Flash", want: "Case-Test-Model-Flash"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewBaseAPIHandlers([]interfaces.Client{}, &config.Config{CaseInsensitiveModels: tt.caseInsensitive})
+			if got := h.ResolveModelName(tt.model); got != tt.want {
+				t.Errorf("ResolveModelName(%q) = %q, want %q", tt.model, got, tt.want)
+			}
+
+			// The model field of request bodies is resolved the same way.
+			body := h.NormalizeRequest(normalizeContext(""), OPENAI, []byte(`{"model":"`+tt.model+`"}`))
+			if got := gjson.GetBytes(body, "model").String(); got != tt.want {
+				t.Errorf("model = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/api/handlers"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// tokenCounter is implemented by the clients that can count the tokens of a prompt.
+type tokenCounter interface {
+	CountTokens(ctx context.Context, modelName string, rawJSON []byte) (int64, *interfaces.ErrorMessage)
+}
+
+// CountTokens handles the /v1/chat/completions/count_tokens endpoint. It counts the input
+// tokens of a chat completions request with the model's countTokens endpoint, so that
+// clients can check the size of a prompt before sending it. The response has the form
+// {"object":"chat.completion.token_count","model":"...","input_tokens":N}.
+//
+// Parameters:
+//   - c: The Gin context containing the HTTP request and response
+func (h *OpenAIAPIHandler) CountTokens(c *gin.Context) {
+	rawJSON, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, handlers.ErrorResponse{
+			Error: handlers.ErrorDetail{
+				Message: fmt.Sprintf("Invalid request: %v", err),
+				Type:    "invalid_request_error",
+			},
+		})
+		return
+	}
+	rawJSON = h.NormalizeRequest(c, h.HandlerType(), rawJSON)
+	modelName := gjson.GetBytes(rawJSON, "model").String()
+	if !h.CheckModelAccess(c, modelName) {
+		return
+	}
+
+	c.Header("Content-Type", "application/json")
+	cliCtx, cliCancel := h.GetContextWithCancel(h, c, context.Background())
+
+	var cliClient interfaces.Client
+	defer func() {
+		if cliClient != nil {
+			if mutex := cliClient.GetRequestMutex(); mutex != nil {
+				mutex.Unlock()
+			}
+		}
+	}()
+
+	for {
+		var errorResponse *interfaces.ErrorMessage
+		cliClient, errorResponse = h.GetRequestClient(c, modelName, false)
+		if errorResponse != nil {
+			h.WriteErrorStatus(c, errorResponse)
+			_, _ = fmt.Fprint(c.Writer, errorResponse.Error.Error())
+			cliCancel()
+			return
+		}
+
+		counter, ok := cliClient.(tokenCounter)
+		if !ok {
+			c.JSON(http.StatusNotImplemented, handlers.ErrorResponse{
+				Error: handlers.ErrorDetail{
+					Message: fmt.Sprintf("Token counting is not supported for model %s", modelName),
+					Type:    "invalid_request_error",
+				},
+			})
+			cliCancel()
+			return
+		}
+
+		totalTokens, errCount := counter.CountTokens(cliCtx, modelName, rawJSON)
+		if errCount != nil {
+			if errCount.StatusCode == http.StatusTooManyRequests && h.Cfg.QuotaExceeded.SwitchProject {
+				continue
+			}
+			h.WriteErrorStatus(c, errCount)
+			_, _ = c.Writer.Write([]byte(errCount.Error.Error()))
+			cliCancel(errCount.Error)
+			return
+		}
+
+		response := `{"object":"chat.completion.token_count","model":"","input_tokens":0}`
+		response, _ = sjson.Set(response, "model", modelName)
+		response, _ = sjson.Set(response, "input_tokens", totalTokens)
+		_, _ = c.Writer.Write([]byte(response))
+		cliCancel([]byte(response))
+		return
+	}
+}
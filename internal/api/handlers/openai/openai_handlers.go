@@ -15,6 +15,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/luispater/CLIProxyAPI/v5/internal/api/handlers"
+	"github.com/luispater/CLIProxyAPI/v5/internal/client"
 	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
 	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
 	"github.com/luispater/CLIProxyAPI/v5/internal/registry"
@@ -57,11 +58,15 @@ func (h *OpenAIAPIHandler) Models() []map[string]any {
 }
 
 // OpenAIModels handles the /v1/models endpoint.
-// It returns a list of available AI models with their capabilities
-// and specifications in OpenAI-compatible format.
+// It returns a list of the models served by the configured accounts in OpenAI-compatible
+// format. Besides the standard fields, each model reports whether all of its accounts are in
+// quota cooldown ("quota_exceeded"), the providers serving it ("providers", e.g. "gemini" for
+// API keys and "gemini-cli" for Code Assist accounts), and for Gemini CLI models the preview
+// models used as quota fallbacks ("preview_models"). The optional 'capability' query
+// parameter restricts the list to models with those capabilities.
 func (h *OpenAIAPIHandler) OpenAIModels(c *gin.Context) {
-	// Get all available models
-	allModels := h.Models()
+	// Get all registered models with the requested capabilities
+	allModels := registry.GetGlobalRegistry().GetModelsWithAvailability("openai", handlers.RequestedCapabilities(c)...)
 
 	// Filter to only include the 4 required fields: id, object, created, owned_by
 	filteredModels := make([]map[string]any, len(allModels))
@@ -81,6 +86,14 @@ func (h *OpenAIAPIHandler) OpenAIModels(c *gin.Context) {
 			filteredModel["owned_by"] = ownedBy
 		}
 
+		filteredModel["quota_exceeded"] = model["quota_exceeded"]
+		filteredModel["providers"] = model["providers"]
+		if providers, ok := model["providers"].([]string); ok && util.InArray(providers, GEMINICLI) {
+			if previews := client.PreviewModels(fmt.Sprint(model["id"])); len(previews) > 0 {
+				filteredModel["preview_models"] = previews
+			}
+		}
+
 		filteredModels[i] = filteredModel
 	}
 
@@ -108,6 +121,27 @@ func (h *OpenAIAPIHandler) ChatCompletions(c *gin.Context) {
 		})
 		return
 	}
+	rawJSON = h.NormalizeRequest(c, h.HandlerType(), rawJSON)
+	if !h.CheckModelAccess(c, gjson.GetBytes(rawJSON, "model").String()) {
+		return
+	}
+	if !h.CheckReasoningEffort(c, h.HandlerType(), rawJSON) {
+		return
+	}
+	var ok bool
+	if rawJSON, ok = h.LimitToolResults(c, h.HandlerType(), rawJSON); !ok {
+		return
+	}
+	rawJSON, err = h.ResolveToolCallIDs(rawJSON)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, handlers.ErrorResponse{
+			Error: handlers.ErrorDetail{
+				Message: fmt.Sprintf("Invalid request: %v", err),
+				Type:    "invalid_request_error",
+			},
+		})
+		return
+	}
 
 	// Check if the client requested a streaming response.
 	streamResult := gjson.GetBytes(rawJSON, "stream")
@@ -138,6 +172,13 @@ func (h *OpenAIAPIHandler) Completions(c *gin.Context) {
 		})
 		return
 	}
+	rawJSON = h.NormalizeRequest(c, h.HandlerType(), rawJSON)
+	if !h.CheckModelAccess(c, gjson.GetBytes(rawJSON, "model").String()) {
+		return
+	}
+	if !h.CheckReasoningEffort(c, h.HandlerType(), rawJSON) {
+		return
+	}
 
 	// Check if the client requested a streaming response.
 	streamResult := gjson.GetBytes(rawJSON, "stream")
@@ -414,9 +455,13 @@ func (h *OpenAIAPIHandler) handleNonStreamingResponse(c *gin.Context, rawJSON []
 	var errorResponse *interfaces.ErrorMessage
 	retryCount := 0
 	for retryCount <= h.Cfg.RequestRetry {
-		cliClient, errorResponse = h.GetClient(modelName)
+		cliClient, errorResponse = h.GetRequestClient(c, modelName)
 		if errorResponse != nil {
-			c.Status(errorResponse.StatusCode)
+			if h.WriteFallbackResponse(c, h.HandlerType(), modelName, rawJSON, false, errorResponse) {
+				cliCancel()
+				return
+			}
+			h.WriteErrorStatus(c, errorResponse)
 			_, _ = fmt.Fprint(c.Writer, errorResponse.Error.Error())
 			cliCancel()
 			return
@@ -438,10 +483,10 @@ func (h *OpenAIAPIHandler) handleNonStreamingResponse(c *gin.Context, rawJSON []
 				retryCount++
 				continue
 			case 401:
-				log.Debugf("unauthorized request, try to refresh token, %s", util.HideAPIKey(cliClient.GetEmail()))
+				log.Debugf("unauthorized request, try to refresh token, %s", util.AccountLabel(h.Cfg, cliClient.GetEmail()))
 				errRefreshTokens := cliClient.RefreshTokens(cliCtx)
 				if errRefreshTokens != nil {
-					log.Debugf("refresh token failed, switch client, %s", util.HideAPIKey(cliClient.GetEmail()))
+					log.Debugf("refresh token failed, switch client, %s", util.AccountLabel(h.Cfg, cliClient.GetEmail()))
 					cliClient.SetUnavailable()
 				}
 				retryCount++
@@ -451,7 +496,7 @@ func (h *OpenAIAPIHandler) handleNonStreamingResponse(c *gin.Context, rawJSON []
 				continue
 			default:
 				// Forward other errors directly to the client
-				c.Status(err.StatusCode)
+				h.WriteErrorStatus(c, err)
 				_, _ = c.Writer.Write([]byte(err.Error.Error()))
 				cliCancel(err.Error)
 			}
@@ -463,7 +508,11 @@ func (h *OpenAIAPIHandler) handleNonStreamingResponse(c *gin.Context, rawJSON []
 		}
 	}
 	if errorResponse != nil {
-		c.Status(errorResponse.StatusCode)
+		if h.WriteFallbackResponse(c, h.HandlerType(), modelName, rawJSON, false, errorResponse) {
+			cliCancel()
+			return
+		}
+		h.WriteErrorStatus(c, errorResponse)
 		_, _ = c.Writer.Write([]byte(errorResponse.Error.Error()))
 		cliCancel(errorResponse.Error)
 		return
@@ -481,7 +530,6 @@ func (h *OpenAIAPIHandler) handleStreamingResponse(c *gin.Context, rawJSON []byt
 	c.Header("Content-Type", "text/event-stream")
 	c.Header("Cache-Control", "no-cache")
 	c.Header("Connection", "keep-alive")
-	c.Header("Access-Control-Allow-Origin", "*")
 
 	// Get the http.Flusher interface to manually flush the response.
 	flusher, ok := c.Writer.(http.Flusher)
@@ -512,9 +560,13 @@ func (h *OpenAIAPIHandler) handleStreamingResponse(c *gin.Context, rawJSON []byt
 	retryCount := 0
 outLoop:
 	for retryCount <= h.Cfg.RequestRetry {
-		cliClient, errorResponse = h.GetClient(modelName)
+		cliClient, errorResponse = h.GetRequestClient(c, modelName)
 		if errorResponse != nil {
-			c.Status(errorResponse.StatusCode)
+			if h.WriteFallbackResponse(c, h.HandlerType(), modelName, rawJSON, true, errorResponse) {
+				cliCancel()
+				return
+			}
+			h.WriteErrorStatus(c, errorResponse)
 			_, _ = fmt.Fprint(c.Writer, errorResponse.Error.Error())
 			flusher.Flush()
 			cliCancel()
@@ -562,10 +614,10 @@ outLoop:
 						retryCount++
 						continue outLoop
 					case 401:
-						log.Debugf("unauthorized request, try to refresh token, %s", util.HideAPIKey(cliClient.GetEmail()))
+						log.Debugf("unauthorized request, try to refresh token, %s", util.AccountLabel(h.Cfg, cliClient.GetEmail()))
 						errRefreshTokens := cliClient.RefreshTokens(cliCtx)
 						if errRefreshTokens != nil {
-							log.Debugf("refresh token failed, switch client, %s", util.HideAPIKey(cliClient.GetEmail()))
+							log.Debugf("refresh token failed, switch client, %s", util.AccountLabel(h.Cfg, cliClient.GetEmail()))
 							cliClient.SetUnavailable()
 						}
 						retryCount++
@@ -575,7 +627,7 @@ outLoop:
 						continue outLoop
 					default:
 						// Forward other errors directly to the client
-						c.Status(err.StatusCode)
+						h.WriteErrorStatus(c, err)
 						_, _ = fmt.Fprint(c.Writer, err.Error.Error())
 						flusher.Flush()
 						cliCancel(err.Error)
@@ -588,7 +640,11 @@ outLoop:
 		}
 	}
 	if errorResponse != nil {
-		c.Status(errorResponse.StatusCode)
+		if h.WriteFallbackResponse(c, h.HandlerType(), modelName, rawJSON, true, errorResponse) {
+			cliCancel()
+			return
+		}
+		h.WriteErrorStatus(c, errorResponse)
 		_, _ = fmt.Fprint(c.Writer, errorResponse.Error.Error())
 		flusher.Flush()
 		cliCancel(errorResponse.Error)
@@ -624,9 +680,9 @@ func (h *OpenAIAPIHandler) handleCompletionsNonStreamingResponse(c *gin.Context,
 	var errorResponse *interfaces.ErrorMessage
 	retryCount := 0
 	for retryCount <= h.Cfg.RequestRetry {
-		cliClient, errorResponse = h.GetClient(modelName)
+		cliClient, errorResponse = h.GetRequestClient(c, modelName)
 		if errorResponse != nil {
-			c.Status(errorResponse.StatusCode)
+			h.WriteErrorStatus(c, errorResponse)
 			_, _ = fmt.Fprint(c.Writer, errorResponse.Error.Error())
 			cliCancel()
 			return
@@ -649,10 +705,10 @@ func (h *OpenAIAPIHandler) handleCompletionsNonStreamingResponse(c *gin.Context,
 				retryCount++
 				continue
 			case 401:
-				log.Debugf("unauthorized request, try to refresh token, %s", util.HideAPIKey(cliClient.GetEmail()))
+				log.Debugf("unauthorized request, try to refresh token, %s", util.AccountLabel(h.Cfg, cliClient.GetEmail()))
 				errRefreshTokens := cliClient.RefreshTokens(cliCtx)
 				if errRefreshTokens != nil {
-					log.Debugf("refresh token failed, switch client, %s", util.HideAPIKey(cliClient.GetEmail()))
+					log.Debugf("refresh token failed, switch client, %s", util.AccountLabel(h.Cfg, cliClient.GetEmail()))
 					cliClient.SetUnavailable()
 				}
 				retryCount++
@@ -662,7 +718,7 @@ func (h *OpenAIAPIHandler) handleCompletionsNonStreamingResponse(c *gin.Context,
 				continue
 			default:
 				// Forward other errors directly to the client
-				c.Status(err.StatusCode)
+				h.WriteErrorStatus(c, err)
 				_, _ = c.Writer.Write([]byte(err.Error.Error()))
 				cliCancel(err.Error)
 			}
@@ -676,7 +732,7 @@ func (h *OpenAIAPIHandler) handleCompletionsNonStreamingResponse(c *gin.Context,
 		}
 	}
 	if errorResponse != nil {
-		c.Status(errorResponse.StatusCode)
+		h.WriteErrorStatus(c, errorResponse)
 		_, _ = c.Writer.Write([]byte(errorResponse.Error.Error()))
 		cliCancel(errorResponse.Error)
 		return
@@ -695,7 +751,6 @@ func (h *OpenAIAPIHandler) handleCompletionsStreamingResponse(c *gin.Context, ra
 	c.Header("Content-Type", "text/event-stream")
 	c.Header("Cache-Control", "no-cache")
 	c.Header("Connection", "keep-alive")
-	c.Header("Access-Control-Allow-Origin", "*")
 
 	// Get the http.Flusher interface to manually flush the response.
 	flusher, ok := c.Writer.(http.Flusher)
@@ -729,9 +784,9 @@ func (h *OpenAIAPIHandler) handleCompletionsStreamingResponse(c *gin.Context, ra
 	retryCount := 0
 outLoop:
 	for retryCount <= h.Cfg.RequestRetry {
-		cliClient, errorResponse = h.GetClient(modelName)
+		cliClient, errorResponse = h.GetRequestClient(c, modelName)
 		if errorResponse != nil {
-			c.Status(errorResponse.StatusCode)
+			h.WriteErrorStatus(c, errorResponse)
 			_, _ = fmt.Fprint(c.Writer, errorResponse.Error.Error())
 			flusher.Flush()
 			cliCancel()
@@ -784,10 +839,10 @@ outLoop:
 						retryCount++
 						continue outLoop
 					case 401:
-						log.Debugf("unauthorized request, try to refresh token, %s", util.HideAPIKey(cliClient.GetEmail()))
+						log.Debugf("unauthorized request, try to refresh token, %s", util.AccountLabel(h.Cfg, cliClient.GetEmail()))
 						errRefreshTokens := cliClient.RefreshTokens(cliCtx)
 						if errRefreshTokens != nil {
-							log.Debugf("refresh token failed, switch client, %s", util.HideAPIKey(cliClient.GetEmail()))
+							log.Debugf("refresh token failed, switch client, %s", util.AccountLabel(h.Cfg, cliClient.GetEmail()))
 							cliClient.SetUnavailable()
 						}
 						retryCount++
@@ -797,7 +852,7 @@ outLoop:
 						continue outLoop
 					default:
 						// Forward other errors directly to the client
-						c.Status(err.StatusCode)
+						h.WriteErrorStatus(c, err)
 						_, _ = fmt.Fprint(c.Writer, err.Error.Error())
 						flusher.Flush()
 						cliCancel(err.Error)
@@ -810,7 +865,7 @@ outLoop:
 		}
 	}
 	if errorResponse != nil {
-		c.Status(errorResponse.StatusCode)
+		h.WriteErrorStatus(c, errorResponse)
 		_, _ = fmt.Fprint(c.Writer, errorResponse.Error.Error())
 		flusher.Flush()
 		cliCancel(errorResponse.Error)
@@ -82,6 +82,17 @@ func (h *OpenAIResponsesAPIHandler) Responses(c *gin.Context) {
 		})
 		return
 	}
+	rawJSON = h.NormalizeRequest(c, h.HandlerType(), rawJSON)
+	if !h.CheckModelAccess(c, gjson.GetBytes(rawJSON, "model").String()) {
+		return
+	}
+	if !h.CheckReasoningEffort(c, h.HandlerType(), rawJSON) {
+		return
+	}
+	var ok bool
+	if rawJSON, ok = h.LimitToolResults(c, h.HandlerType(), rawJSON); !ok {
+		return
+	}
 
 	// Check if the client requested a streaming response.
 	streamResult := gjson.GetBytes(rawJSON, "stream")
@@ -118,9 +129,13 @@ func (h *OpenAIResponsesAPIHandler) handleNonStreamingResponse(c *gin.Context, r
 	var errorResponse *interfaces.ErrorMessage
 	retryCount := 0
 	for retryCount <= h.Cfg.RequestRetry {
-		cliClient, errorResponse = h.GetClient(modelName)
+		cliClient, errorResponse = h.GetRequestClient(c, modelName)
 		if errorResponse != nil {
-			c.Status(errorResponse.StatusCode)
+			if h.WriteFallbackResponse(c, h.HandlerType(), modelName, rawJSON, false, errorResponse) {
+				cliCancel()
+				return
+			}
+			h.WriteErrorStatus(c, errorResponse)
 			_, _ = fmt.Fprint(c.Writer, errorResponse.Error.Error())
 			cliCancel()
 			return
@@ -142,10 +157,10 @@ func (h *OpenAIResponsesAPIHandler) handleNonStreamingResponse(c *gin.Context, r
 				retryCount++
 				continue
 			case 401:
-				log.Debugf("unauthorized request, try to refresh token, %s", util.HideAPIKey(cliClient.GetEmail()))
+				log.Debugf("unauthorized request, try to refresh token, %s", util.AccountLabel(h.Cfg, cliClient.GetEmail()))
 				errRefreshTokens := cliClient.RefreshTokens(cliCtx)
 				if errRefreshTokens != nil {
-					log.Debugf("refresh token failed, switch client, %s", util.HideAPIKey(cliClient.GetEmail()))
+					log.Debugf("refresh token failed, switch client, %s", util.AccountLabel(h.Cfg, cliClient.GetEmail()))
 					cliClient.SetUnavailable()
 				}
 				retryCount++
@@ -155,7 +170,7 @@ func (h *OpenAIResponsesAPIHandler) handleNonStreamingResponse(c *gin.Context, r
 				continue
 			default:
 				// Forward other errors directly to the client
-				c.Status(err.StatusCode)
+				h.WriteErrorStatus(c, err)
 				_, _ = c.Writer.Write([]byte(err.Error.Error()))
 				cliCancel(err.Error)
 			}
@@ -167,7 +182,11 @@ func (h *OpenAIResponsesAPIHandler) handleNonStreamingResponse(c *gin.Context, r
 		}
 	}
 	if errorResponse != nil {
-		c.Status(errorResponse.StatusCode)
+		if h.WriteFallbackResponse(c, h.HandlerType(), modelName, rawJSON, false, errorResponse) {
+			cliCancel()
+			return
+		}
+		h.WriteErrorStatus(c, errorResponse)
 		_, _ = c.Writer.Write([]byte(errorResponse.Error.Error()))
 		cliCancel(errorResponse.Error)
 		return
@@ -186,7 +205,6 @@ func (h *OpenAIResponsesAPIHandler) handleStreamingResponse(c *gin.Context, rawJ
 	c.Header("Content-Type", "text/event-stream")
 	c.Header("Cache-Control", "no-cache")
 	c.Header("Connection", "keep-alive")
-	c.Header("Access-Control-Allow-Origin", "*")
 
 	// Get the http.Flusher interface to manually flush the response.
 	flusher, ok := c.Writer.(http.Flusher)
@@ -217,9 +235,13 @@ func (h *OpenAIResponsesAPIHandler) handleStreamingResponse(c *gin.Context, rawJ
 	retryCount := 0
 outLoop:
 	for retryCount <= h.Cfg.RequestRetry {
-		cliClient, errorResponse = h.GetClient(modelName)
+		cliClient, errorResponse = h.GetRequestClient(c, modelName)
 		if errorResponse != nil {
-			c.Status(errorResponse.StatusCode)
+			if h.WriteFallbackResponse(c, h.HandlerType(), modelName, rawJSON, true, errorResponse) {
+				cliCancel()
+				return
+			}
+			h.WriteErrorStatus(c, errorResponse)
 			_, _ = fmt.Fprint(c.Writer, errorResponse.Error.Error())
 			flusher.Flush()
 			cliCancel()
@@ -265,10 +287,10 @@ outLoop:
 						retryCount++
 						continue outLoop
 					case 401:
-						log.Debugf("unauthorized request, try to refresh token, %s", util.HideAPIKey(cliClient.GetEmail()))
+						log.Debugf("unauthorized request, try to refresh token, %s", util.AccountLabel(h.Cfg, cliClient.GetEmail()))
 						errRefreshTokens := cliClient.RefreshTokens(cliCtx)
 						if errRefreshTokens != nil {
-							log.Debugf("refresh token failed, switch client, %s", util.HideAPIKey(cliClient.GetEmail()))
+							log.Debugf("refresh token failed, switch client, %s", util.AccountLabel(h.Cfg, cliClient.GetEmail()))
 							cliClient.SetUnavailable()
 						}
 						retryCount++
@@ -278,7 +300,7 @@ outLoop:
 						continue outLoop
 					default:
 						// Forward other errors directly to the client
-						c.Status(err.StatusCode)
+						h.WriteErrorStatus(c, err)
 						_, _ = fmt.Fprint(c.Writer, err.Error.Error())
 						flusher.Flush()
 						cliCancel(err.Error)
@@ -292,7 +314,11 @@ outLoop:
 	}
 
 	if errorResponse != nil {
-		c.Status(errorResponse.StatusCode)
+		if h.WriteFallbackResponse(c, h.HandlerType(), modelName, rawJSON, true, errorResponse) {
+			cliCancel()
+			return
+		}
+		h.WriteErrorStatus(c, errorResponse)
 		_, _ = fmt.Fprint(c.Writer, errorResponse.Error.Error())
 		flusher.Flush()
 		cliCancel(errorResponse.Error)
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	"github.com/luispater/CLIProxyAPI/v5/internal/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// ClientPool sends requests to the clients of a handler, one client per account (token file
+// or API key). Every request goes to the client chosen by GetClient, the least recently used
+// one whose quota for the model is not exceeded, so concurrent requests run in parallel on
+// different accounts. When the upstream call fails with an error another account may not
+// have, the request is retried on the next client.
+type ClientPool struct {
+	handler *BaseAPIHandler
+}
+
+// NewClientPool creates a pool of the clients of a handler. The pool follows the clients
+// and configuration of the handler when they are updated.
+//
+// Parameters:
+//   - handler: The handler whose clients are used
+//
+// Returns:
+//   - *ClientPool: A new client pool
+func NewClientPool(handler *BaseAPIHandler) *ClientPool {
+	return &ClientPool{handler: handler}
+}
+
+// SendMessage sends a raw JSON message like interfaces.Client.SendRawMessage, to the next
+// client of the pool. If the context holds the Gin context of the request, the request's
+// quota override is honored and the selected client is recorded for the request.
+//
+// Parameters:
+//   - ctx: The context of the request
+//   - modelName: The name of the model to use
+//   - rawJSON: The raw JSON request body
+//   - alt: An alternative response format parameter
+//
+// Returns:
+//   - []byte: The response body
+//   - *interfaces.ErrorMessage: An error message if the request failed on every attempted client
+func (p *ClientPool) SendMessage(ctx context.Context, modelName string, rawJSON []byte, alt string) ([]byte, *interfaces.ErrorMessage) {
+	var errorResponse *interfaces.ErrorMessage
+	retryCount := 0
+	for retryCount <= p.handler.Cfg.RequestRetry {
+		cliClient, errSelect := p.client(ctx, modelName)
+		if errSelect != nil {
+			return nil, errSelect
+		}
+
+		resp, err := cliClient.SendRawMessage(ctx, modelName, rawJSON, alt)
+		p.release(cliClient)
+		if err == nil {
+			return resp, nil
+		}
+		errorResponse = err
+		if !p.retry(ctx, cliClient, err, &retryCount) {
+			return nil, err
+		}
+	}
+	return nil, errorResponse
+}
+
+// SendMessageStream sends a raw JSON message like interfaces.Client.SendRawMessageStream, to
+// the next client of the pool. An error is retried on the next client only until the first
+// chunk has been received; afterwards it is passed on, as the chunks cannot be taken back.
+//
+// Parameters:
+//   - ctx: The context of the request
+//   - modelName: The name of the model to use
+//   - rawJSON: The raw JSON request body
+//   - alt: An alternative response format parameter
+//
+// Returns:
+//   - <-chan []byte: A channel receiving the response chunks
+//   - <-chan *interfaces.ErrorMessage: A channel receiving the error that ended the response, if any
+func (p *ClientPool) SendMessageStream(ctx context.Context, modelName string, rawJSON []byte, alt string) (<-chan []byte, <-chan *interfaces.ErrorMessage) {
+	dataChan := make(chan []byte)
+	errChan := make(chan *interfaces.ErrorMessage, 1)
+	go func() {
+		defer close(errChan)
+		defer close(dataChan)
+
+		var errorResponse *interfaces.ErrorMessage
+		retryCount := 0
+	outLoop:
+		for retryCount <= p.handler.Cfg.RequestRetry {
+			cliClient, errSelect := p.client(ctx, modelName)
+			if errSelect != nil {
+				errChan <- errSelect
+				return
+			}
+
+			respChan, respErrChan := cliClient.SendRawMessageStream(ctx, modelName, rawJSON, alt)
+			received := false
+			for respChan != nil || respErrChan != nil {
+				select {
+				case chunk, ok := <-respChan:
+					if !ok {
+						respChan = nil
+						continue
+					}
+					received = true
+					select {
+					case dataChan <- chunk:
+					case <-ctx.Done():
+						p.release(cliClient)
+						return
+					}
+				case err, ok := <-respErrChan:
+					if !ok {
+						respErrChan = nil
+						continue
+					}
+					p.release(cliClient)
+					errorResponse = err
+					if !received && p.retry(ctx, cliClient, err, &retryCount) {
+						continue outLoop
+					}
+					errChan <- err
+					return
+				}
+			}
+			p.release(cliClient)
+			return
+		}
+		errChan <- errorResponse
+	}()
+	return dataChan, errChan
+}
+
+// client selects the client for the next attempt of a request.
+func (p *ClientPool) client(ctx context.Context, modelName string) (interfaces.Client, *interfaces.ErrorMessage) {
+	if c, ok := ctx.Value("gin").(*gin.Context); ok {
+		return p.handler.GetRequestClient(c, modelName)
+	}
+	return p.handler.GetClient(modelName)
+}
+
+// release unlocks the request mutex of a client after an attempt, if the client has one.
+func (p *ClientPool) release(cliClient interfaces.Client) {
+	if mutex := cliClient.GetRequestMutex(); mutex != nil {
+		mutex.Unlock()
+	}
+}
+
+// retry records a failed attempt and reports whether the request should be retried on the
+// next client. Exceeded quotas are retried when quota-exceeded.switch-project is enabled,
+// without counting against request-retry. Server errors and forbidden requests count as a
+// retry; an unauthorized request refreshes the client's token first, and the client is
+// taken out of the pool if that fails. A client that requires payment is taken out of the
+// pool.
+func (p *ClientPool) retry(ctx context.Context, cliClient interfaces.Client, err *interfaces.ErrorMessage, retryCount *int) bool {
+	p.handler.LoggingAPIResponseError(ctx, err)
+
+	switch err.StatusCode {
+	case 429:
+		if p.handler.Cfg.QuotaExceeded.SwitchProject {
+			log.Debugf("quota exceeded, switch client")
+			return true
+		}
+	case 403, 408, 500, 502, 503, 504:
+		log.Debugf("http status code %d, switch client", err.StatusCode)
+		*retryCount++
+		return true
+	case 401:
+		log.Debugf("unauthorized request, try to refresh token, %s", util.AccountLabel(p.handler.Cfg, cliClient.GetEmail()))
+		if errRefreshTokens := cliClient.RefreshTokens(ctx); errRefreshTokens != nil {
+			log.Debugf("refresh token failed, switch client, %s", util.AccountLabel(p.handler.Cfg, cliClient.GetEmail()))
+			cliClient.SetUnavailable()
+		}
+		*retryCount++
+		return true
+	case 402:
+		cliClient.SetUnavailable()
+		return true
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+)
+
+// poolClient is an account of the pool whose upstream calls are answered by send.
+type poolClient struct {
+	fakeClient
+	send func(ctx context.Context) ([]byte, *interfaces.ErrorMessage)
+}
+
+func (c *poolClient) SendRawMessage(ctx context.Context, _ string, _ []byte, _ string) ([]byte, *interfaces.ErrorMessage) {
+	return c.send(ctx)
+}
+
+// SendRawMessageStream streams the response of send as a single chunk, or its error.
+func (c *poolClient) SendRawMessageStream(ctx context.Context, _ string, _ []byte, _ string) (<-chan []byte, <-chan *interfaces.ErrorMessage) {
+	dataChan := make(chan []byte, 1)
+	errChan := make(chan *interfaces.ErrorMessage, 1)
+	go func() {
+		defer close(errChan)
+		defer close(dataChan)
+		resp, err := c.send(ctx)
+		if err != nil {
+			errChan <- err
+			return
+		}
+		dataChan <- resp
+	}()
+	return dataChan, errChan
+}
+
+// answer returns a send function that responds with body.
+func answer(body string) func(context.Context) ([]byte, *interfaces.ErrorMessage) {
+	return func(context.Context) ([]byte, *interfaces.ErrorMessage) { return []byte(body), nil }
+}
+
+// fail returns a send function that fails with the status code.
+func fail(statusCode int) func(context.Context) ([]byte, *interfaces.ErrorMessage) {
+	return func(context.Context) ([]byte, *interfaces.ErrorMessage) {
+		return nil, &interfaces.ErrorMessage{StatusCode: statusCode, Error: errors.New(http.StatusText(statusCode))}
+	}
+}
+
+func TestClientPoolRunsRequestsInParallel(t *testing.T) {
+	// Each upstream call waits until both requests are in flight, which only happens if the
+	// requests run at the same time.
+	var inFlight sync.WaitGroup
+	inFlight.Add(2)
+	send := func(name string) func(context.Context) ([]byte, *interfaces.ErrorMessage) {
+		return func(context.Context) ([]byte, *interfaces.ErrorMessage) {
+			inFlight.Done()
+			inFlight.Wait()
+			return []byte(name), nil
+		}
+	}
+	first := &poolClient{fakeClient: fakeClient{name: "first"}, send: send("first")}
+	second := &poolClient{fakeClient: fakeClient{name: "second"}, send: send("second")}
+	pool := NewClientPool(NewBaseAPIHandlers([]interfaces.Client{first, second}, &config.Config{}))
+
+	results := make(chan string, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			resp, err := pool.SendMessage(context.Background(), "gemini-2.5-pro", []byte(`{}`), "")
+			if err != nil {
+				results <- err.Error.Error()
+				return
+			}
+			results <- string(resp)
+		}()
+	}
+
+	got := make(map[string]int)
+	for i := 0; i < 2; i++ {
+		select {
+		case result := <-results:
+			got[result]++
+		case <-time.After(5 * time.Second):
+			t.Fatal("the requests were not sent in parallel")
+		}
+	}
+	if got["first"] != 1 || got["second"] != 1 {
+		t.Errorf("responses = %v, want one from each account", got)
+	}
+}
+
+func TestClientPoolSwitchesClientOnQuotaExceeded(t *testing.T) {
+	exhausted := &poolClient{fakeClient: fakeClient{name: "exhausted"}, send: fail(http.StatusTooManyRequests)}
+	available := &poolClient{fakeClient: fakeClient{name: "available"}, send: answer("ok")}
+	clients := []interfaces.Client{exhausted, available}
+
+	cfg := &config.Config{}
+	cfg.QuotaExceeded.SwitchProject = true
+	resp, err := NewClientPool(NewBaseAPIHandlers(clients, cfg)).SendMessage(context.Background(), "gemini-2.5-pro", []byte(`{}`), "")
+	if err != nil {
+		t.Fatalf("SendMessage() error = %v", err.Error)
+	}
+	if string(resp) != "ok" {
+		t.Errorf("response = %q, want %q", resp, "ok")
+	}
+
+	// Without switch-project the quota error is returned.
+	_, err = NewClientPool(NewBaseAPIHandlers(clients, &config.Config{})).SendMessage(context.Background(), "gemini-2.5-pro", []byte(`{}`), "")
+	if err == nil || err.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("SendMessage() error = %v, want status %d", err, http.StatusTooManyRequests)
+	}
+}
+
+func TestClientPoolStreamSwitchesClientBeforeFirstChunk(t *testing.T) {
+	failing := &poolClient{fakeClient: fakeClient{name: "failing"}, send: fail(http.StatusServiceUnavailable)}
+	working := &poolClient{fakeClient: fakeClient{name: "working"}, send: answer("chunk")}
+	pool := NewClientPool(NewBaseAPIHandlers([]interfaces.Client{failing, working}, &config.Config{RequestRetry: 1}))
+
+	dataChan, errChan := pool.SendMessageStream(context.Background(), "gemini-2.5-pro", []byte(`{}`), "")
+	chunks := make([]string, 0)
+	for chunk := range dataChan {
+		chunks = append(chunks, string(chunk))
+	}
+	if err, ok := <-errChan; ok && err != nil {
+		t.Fatalf("stream error = %v", err.Error)
+	}
+	if len(chunks) != 1 || chunks[0] != "chunk" {
+		t.Errorf("chunks = %v, want [chunk]", chunks)
+	}
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/client"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	"github.com/luispater/CLIProxyAPI/v5/internal/util"
+)
+
+// quotaExceededError builds the 429 returned when every client that can serve a model is
+// quota exceeded for it. The error lists each exhausted account with its recovery time.
+// Claude models keep the Anthropic rate limit error format.
+func (h *BaseAPIHandler) quotaExceededError(modelName string, exhausted []interfaces.Client) *interfaces.ErrorMessage {
+	if util.GetProviderName(modelName, h.Cfg) == "claude" {
+		return &interfaces.ErrorMessage{StatusCode: 429, Error: fmt.Errorf(`{"type":"error","error":{"type":"rate_limit_error","message":"This request would exceed your account's rate limit. Please try again later."}}`)}
+	}
+
+	models := make([]client.QuotaExceededModel, 0, len(exhausted))
+	for _, cliClient := range exhausted {
+		model := client.QuotaExceededModel{
+			Model:   modelName,
+			Account: util.AccountLabel(h.Cfg, cliClient.GetEmail()),
+		}
+		if projectClient, ok := cliClient.(interface{ GetProjectID() string }); ok {
+			model.Project = projectClient.GetProjectID()
+		}
+		if recoveryClient, ok := cliClient.(interface{ QuotaRecoveryAt(string) time.Time }); ok {
+			model.RetryAt = recoveryClient.QuotaRecoveryAt(modelName)
+		}
+		models = append(models, model)
+	}
+	return client.QuotaExceededError(modelName, models)
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+// reasoningEfforts lists the reasoning effort values understood by the translators.
+var reasoningEfforts = []string{"none", "auto", "low", "medium", "high"}
+
+// CheckReasoningEffort validates the reasoning effort of a request: "reasoning_effort" for
+// OpenAI chat and Claude requests, "reasoning.effort" for OpenAI Responses requests, which
+// also accept "minimal". With strict-reasoning-effort enabled, an unknown value is rejected
+// with a 400 error written to the response; otherwise it is logged and the request proceeds
+// with the default effort (auto).
+//
+// Parameters:
+//   - c: The Gin context of the current request
+//   - handlerType: The API format of the request (e.g. OPENAI, CLAUDE)
+//   - rawJSON: The raw JSON request body
+//
+// Returns:
+//   - bool: True if the request may proceed
+func (h *BaseAPIHandler) CheckReasoningEffort(c *gin.Context, handlerType string, rawJSON []byte) bool {
+	path := "reasoning_effort"
+	allowed := reasoningEfforts
+	switch handlerType {
+	case OPENAI, CLAUDE:
+	case OPENAI_RESPONSE:
+		path = "reasoning.effort"
+		allowed = append([]string{"minimal"}, reasoningEfforts...)
+	default:
+		return true
+	}
+
+	effort := gjson.GetBytes(rawJSON, path)
+	if !effort.Exists() || effort.Type == gjson.Null {
+		return true
+	}
+	for _, value := range allowed {
+		if effort.Type == gjson.String && effort.String() == value {
+			return true
+		}
+	}
+
+	if !h.Cfg.StrictReasoningEffort {
+		log.Debugf("unknown %s %s, using the default reasoning effort", path, effort.Raw)
+		return true
+	}
+	c.JSON(http.StatusBadRequest, ErrorResponse{
+		Error: ErrorDetail{
+			Message: fmt.Sprintf("Invalid request: unsupported %s %s, expected one of %s", path, effort.Raw, strings.Join(allowed, ", ")),
+			Type:    "invalid_request_error",
+		},
+	})
+	return false
+}
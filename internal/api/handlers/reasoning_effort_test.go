@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	"github.com/tidwall/gjson"
+)
+
+func TestCheckReasoningEffort(t *testing.T) {
+	tests := []struct {
+		name        string
+		strict      bool
+		handlerType string
+		body        string
+		wantOK      bool
+	}{
+		{name: "valid", strict: true, handlerType: OPENAI, body: `{"reasoning_effort":"high"}`, wantOK: true},
+		{name: "missing", strict: true, handlerType: OPENAI, body: `{}`, wantOK: true},
+		{name: "null", strict: true, handlerType: OPENAI, body: `{"reasoning_effort":null}`, wantOK: true},
+		{name: "unknown lenient", handlerType: OPENAI, body: `{"reasoning_effort":"hihg"}`, wantOK: true},
+		{name: "unknown strict", strict: true, handlerType: OPENAI, body: `{"reasoning_effort":"hihg"}`, wantOK: false},
+		{name: "wrong case strict", strict: true, handlerType: OPENAI, body: `{"reasoning_effort":"High"}`, wantOK: false},
+		{name: "number strict", strict: true, handlerType: OPENAI, body: `{"reasoning_effort":2}`, wantOK: false},
+		{name: "Claude unknown strict", strict: true, handlerType: CLAUDE, body: `{"reasoning_effort":"max"}`, wantOK: false},
+		{name: "Responses minimal", strict: true, handlerType: OPENAI_RESPONSE, body: `{"reasoning":{"effort":"minimal"}}`, wantOK: true},
+		{name: "Responses unknown strict", strict: true, handlerType: OPENAI_RESPONSE, body: `{"reasoning":{"effort":"extreme"}}`, wantOK: false},
+		{name: "minimal only for Responses", strict: true, handlerType: OPENAI, body: `{"reasoning_effort":"minimal"}`, wantOK: false},
+		{name: "other formats not checked", strict: true, handlerType: GEMINI, body: `{"reasoning_effort":"hihg"}`, wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+			h := NewBaseAPIHandlers([]interfaces.Client{}, &config.Config{StrictReasoningEffort: tt.strict})
+
+			if got := h.CheckReasoningEffort(c, tt.handlerType, []byte(tt.body)); got != tt.wantOK {
+				t.Fatalf("CheckReasoningEffort() = %t, want %t", got, tt.wantOK)
+			}
+			if tt.wantOK {
+				if c.Writer.Written() {
+					t.Errorf("response written for an accepted request: %s", recorder.Body.String())
+				}
+				return
+			}
+			if recorder.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", recorder.Code, http.StatusBadRequest)
+			}
+			if got := gjson.Get(recorder.Body.String(), "error.type").String(); got != "invalid_request_error" {
+				t.Errorf("error.type = %q, want %q", got, "invalid_request_error")
+			}
+			if message := gjson.Get(recorder.Body.String(), "error.message").String(); !strings.Contains(message, "expected one of") {
+				t.Errorf("error.message = %q, want the accepted values", message)
+			}
+		})
+	}
+}
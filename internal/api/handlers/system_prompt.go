@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+	"github.com/luispater/CLIProxyAPI/v5/internal/util"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// NoSystemInjectHeader asks the proxy to send the request's own system instruction only,
+// without the configured system prompts. It is honored only for API keys with
+// allow-no-system-inject set.
+const NoSystemInjectHeader = "X-CLIProxy-No-System-Inject"
+
+// responseLanguageInstruction is added to the system instruction when response-language is set.
+const responseLanguageInstruction = "Always respond in %s, regardless of the language of the request."
+
+// systemPromptFormat describes how text is added before and after the system instruction
+// of an API format.
+type systemPromptFormat struct {
+	// prepend places text before the system instruction.
+	prepend func(rawJSON []byte, text string) []byte
+
+	// append places text after the system instruction.
+	append func(rawJSON []byte, text string) []byte
+}
+
+// systemPromptFormats maps the handler types to the layout of their system instructions.
+var systemPromptFormats = map[string]systemPromptFormat{
+	OPENAI: {
+		prepend: func(rawJSON []byte, text string) []byte {
+			return insertOpenAISystemMessage(rawJSON, 0, text)
+		},
+		append: func(rawJSON []byte, text string) []byte {
+			// The suffix goes after the leading system messages, before the conversation.
+			index := 0
+			for _, message := range gjson.GetBytes(rawJSON, "messages").Array() {
+				if !isOpenAISystemMessage(message) {
+					break
+				}
+				index++
+			}
+			return insertOpenAISystemMessage(rawJSON, index, text)
+		},
+	},
+	OPENAI_RESPONSE: {
+		prepend: func(rawJSON []byte, text string) []byte {
+			return prependText(rawJSON, "instructions", text)
+		},
+		append: func(rawJSON []byte, text string) []byte {
+			return appendText(rawJSON, "instructions", text)
+		},
+	},
+	CLAUDE: {
+		prepend: func(rawJSON []byte, text string) []byte {
+			if system := gjson.GetBytes(rawJSON, "system"); system.IsArray() {
+				block, _ := sjson.Set(`{"type":"text"}`, "text", text)
+				rawJSON, _ = sjson.SetRawBytes(rawJSON, "system", insertRaw([]byte(system.Raw), 0, block))
+				return rawJSON
+			}
+			return prependText(rawJSON, "system", text)
+		},
+		append: func(rawJSON []byte, text string) []byte {
+			if system := gjson.GetBytes(rawJSON, "system"); system.IsArray() {
+				block, _ := sjson.Set(`{"type":"text"}`, "text", text)
+				rawJSON, _ = sjson.SetRawBytes(rawJSON, "system.-1", []byte(block))
+				return rawJSON
+			}
+			return appendText(rawJSON, "system", text)
+		},
+	},
+	GEMINI:    geminiSystemPromptFormat(""),
+	GEMINICLI: geminiSystemPromptFormat("request."),
+}
+
+// geminiSystemPromptFormat returns the system instruction layout of Gemini requests, whose
+// fields are below pathPrefix ("request." for Gemini CLI).
+func geminiSystemPromptFormat(pathPrefix string) systemPromptFormat {
+	partsPath := func(rawJSON []byte) string {
+		if !gjson.GetBytes(rawJSON, pathPrefix+"systemInstruction").Exists() && gjson.GetBytes(rawJSON, pathPrefix+"system_instruction").Exists() {
+			return pathPrefix + "system_instruction.parts"
+		}
+		return pathPrefix + "systemInstruction.parts"
+	}
+	return systemPromptFormat{
+		prepend: func(rawJSON []byte, text string) []byte {
+			path := partsPath(rawJSON)
+			part, _ := sjson.Set(`{}`, "text", text)
+			parts := []byte(gjson.GetBytes(rawJSON, path).Raw)
+			if len(parts) == 0 {
+				parts = []byte(`[]`)
+			}
+			rawJSON, _ = sjson.SetRawBytes(rawJSON, path, insertRaw(parts, 0, part))
+			return rawJSON
+		},
+		append: func(rawJSON []byte, text string) []byte {
+			part, _ := sjson.Set(`{}`, "text", text)
+			rawJSON, _ = sjson.SetRawBytes(rawJSON, partsPath(rawJSON)+".-1", []byte(part))
+			return rawJSON
+		},
+	}
+}
+
+// injectSystemPrompt adds the configured system prompts to the system instruction of a
+// request. The system instruction is composed as: system-prompt.prefix, the key's
+// system-prompt.prefix, the request's own system instruction, the response-language
+// instruction, the key's system-prompt.suffix, and system-prompt.suffix. Nothing is added
+// to requests carrying a permitted NoSystemInjectHeader.
+//
+// Parameters:
+//   - c: The Gin context of the current request
+//   - handlerType: The API format of the request (e.g. OPENAI, CLAUDE)
+//   - rawJSON: The raw JSON request body
+//
+// Returns:
+//   - []byte: The request body with the system prompts added
+func (h *BaseAPIHandler) injectSystemPrompt(c *gin.Context, handlerType string, rawJSON []byte) []byte {
+	format, ok := systemPromptFormats[handlerType]
+	if !ok || h.skipsSystemInjection(c) {
+		return rawJSON
+	}
+
+	// Prefixes are prepended innermost first and suffixes appended innermost first, so that
+	// the global prompt encloses the key's prompt.
+	prefixes := make([]string, 0, 2)
+	suffixes := make([]string, 0, 3)
+	if language := h.Cfg.ResponseLanguageFor(c.GetString("apiKey")); language != "" {
+		suffixes = append(suffixes, fmt.Sprintf(responseLanguageInstruction, util.LanguageName(language)))
+	}
+	if setting := h.Cfg.GetAPIKeySetting(c.GetString("apiKey")); setting != nil {
+		prefixes = append(prefixes, setting.SystemPrompt.Prefix)
+		suffixes = append(suffixes, setting.SystemPrompt.Suffix)
+	}
+	prefixes = append(prefixes, h.Cfg.SystemPrompt.Prefix)
+	suffixes = append(suffixes, h.Cfg.SystemPrompt.Suffix)
+
+	for _, prefix := range prefixes {
+		if prefix != "" {
+			rawJSON = format.prepend(rawJSON, prefix)
+		}
+	}
+	for _, suffix := range suffixes {
+		if suffix != "" {
+			rawJSON = format.append(rawJSON, suffix)
+		}
+	}
+	return rawJSON
+}
+
+// skipsSystemInjection reports whether the request opted out of system prompt injection.
+func (h *BaseAPIHandler) skipsSystemInjection(c *gin.Context) bool {
+	skip, err := strconv.ParseBool(c.GetHeader(NoSystemInjectHeader))
+	if err != nil || !skip {
+		return false
+	}
+	setting := h.Cfg.GetAPIKeySetting(c.GetString("apiKey"))
+	return setting != nil && setting.AllowNoSystemInject
+}
+
+// insertOpenAISystemMessage inserts a system message into the messages of an OpenAI request.
+func insertOpenAISystemMessage(rawJSON []byte, index int, text string) []byte {
+	messages := []byte(gjson.GetBytes(rawJSON, "messages").Raw)
+	if len(messages) == 0 {
+		messages = []byte(`[]`)
+	}
+	message, _ := sjson.Set(`{"role":"system"}`, "content", text)
+	rawJSON, _ = sjson.SetRawBytes(rawJSON, "messages", insertRaw(messages, index, message))
+	return rawJSON
+}
+
+// prependText prepends text to a string field, separated by a blank line.
+func prependText(rawJSON []byte, path, text string) []byte {
+	if current := gjson.GetBytes(rawJSON, path).String(); current != "" {
+		text = text + "\n\n" + current
+	}
+	rawJSON, _ = sjson.SetBytes(rawJSON, path, text)
+	return rawJSON
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	"github.com/tidwall/gjson"
+)
+
+// systemTexts returns the texts of a system instruction separated by spaces, whether it is a
+// string or an array of messages, blocks, or parts.
+func systemTexts(system gjson.Result) string {
+	if system.Type == gjson.String {
+		return strings.ReplaceAll(system.String(), "\n\n", " ")
+	}
+	return messageTexts(system)
+}
+
+func TestInjectSystemPrompt(t *testing.T) {
+	cfg := &config.Config{
+		SystemPrompt: config.SystemPrompt{Prefix: "global-prefix", Suffix: "global-suffix"},
+		APIKeySettings: []config.APIKeySetting{
+			{APIKey: "team-key", SystemPrompt: config.SystemPrompt{Prefix: "team-prefix", Suffix: "team-suffix"}},
+			{APIKey: "suffix-key", SystemPrompt: config.SystemPrompt{Suffix: "suffix-only"}},
+		},
+	}
+	h := NewBaseAPIHandlers([]interfaces.Client{}, cfg)
+
+	tests := []struct {
+		name        string
+		apiKey      string
+		handlerType string
+		body        string
+		path        string
+		want        string
+	}{
+		{
+			name:        "OpenAI key prompt",
+			apiKey:      "team-key",
+			handlerType: OPENAI,
+			body:        `{"messages":[{"role":"system","content":"own"},{"role":"user","content":"hi"}]}`,
+			path:        "messages",
+			want:        "global-prefix team-prefix own team-suffix global-suffix hi",
+		},
+		{
+			name:        "OpenAI other key",
+			apiKey:      "other-key",
+			handlerType: OPENAI,
+			body:        `{"messages":[{"role":"system","content":"own"},{"role":"user","content":"hi"}]}`,
+			path:        "messages",
+			want:        "global-prefix own global-suffix hi",
+		},
+		{
+			name:        "OpenAI key suffix only",
+			apiKey:      "suffix-key",
+			handlerType: OPENAI,
+			body:        `{"messages":[{"role":"user","content":"hi"}]}`,
+			path:        "messages",
+			want:        "global-prefix suffix-only global-suffix hi",
+		},
+		{
+			name:        "Responses instructions",
+			apiKey:      "team-key",
+			handlerType: OPENAI_RESPONSE,
+			body:        `{"instructions":"own","input":"hi"}`,
+			path:        "instructions",
+			want:        "global-prefix team-prefix own team-suffix global-suffix",
+		},
+		{
+			name:        "Claude system string",
+			apiKey:      "team-key",
+			handlerType: CLAUDE,
+			body:        `{"system":"own","messages":[{"role":"user","content":"hi"}]}`,
+			path:        "system",
+			want:        "global-prefix team-prefix own team-suffix global-suffix",
+		},
+		{
+			name:        "Claude system blocks",
+			apiKey:      "other-key",
+			handlerType: CLAUDE,
+			body:        `{"system":[{"type":"text","text":"own"}],"messages":[{"role":"user","content":"hi"}]}`,
+			path:        "system",
+			want:        "global-prefix own global-suffix",
+		},
+		{
+			name:        "Gemini without a system instruction",
+			apiKey:      "team-key",
+			handlerType: GEMINI,
+			body:        `{"contents":[{"role":"user","parts":[{"text":"hi"}]}]}`,
+			path:        "systemInstruction.parts",
+			want:        "global-prefix team-prefix team-suffix global-suffix",
+		},
+		{
+			name:        "Gemini CLI system_instruction",
+			apiKey:      "team-key",
+			handlerType: GEMINICLI,
+			body:        `{"request":{"system_instruction":{"parts":[{"text":"own"}]},"contents":[{"role":"user","parts":[{"text":"hi"}]}]}}`,
+			path:        "request.system_instruction.parts",
+			want:        "global-prefix team-prefix own team-suffix global-suffix",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := h.injectSystemPrompt(normalizeContext(tt.apiKey), tt.handlerType, []byte(tt.body))
+			if texts := systemTexts(gjson.GetBytes(got, tt.path)); texts != tt.want {
+				t.Errorf("%s = %q, want %q", tt.path, texts, tt.want)
+			}
+		})
+	}
+}
+
+func TestInjectSystemPromptWithoutConfiguration(t *testing.T) {
+	h := NewBaseAPIHandlers([]interfaces.Client{}, &config.Config{})
+	body := `{"messages":[{"role":"user","content":"hi"}]}`
+	if got := h.injectSystemPrompt(normalizeContext("team-key"), OPENAI, []byte(body)); string(got) != body {
+		t.Errorf("request = %s, want it unchanged", got)
+	}
+}
+
+func TestInjectSystemPromptResponseLanguage(t *testing.T) {
+	cfg := &config.Config{
+		SystemPrompt:     config.SystemPrompt{Suffix: "global-suffix"},
+		ResponseLanguage: config.ResponseLanguage{Language: "ja"},
+		APIKeySettings: []config.APIKeySetting{
+			{APIKey: "team-key", ResponseLanguage: "de", SystemPrompt: config.SystemPrompt{Suffix: "team-suffix"}},
+		},
+	}
+	tests := []struct {
+		name      string
+		cfg       *config.Config
+		apiKey    string
+		wantParts []string
+	}{
+		{name: "global language", cfg: cfg, apiKey: "other-key", wantParts: []string{"own", "Always respond in Japanese, regardless of the language of the request.", "global-suffix"}},
+		{name: "key language", cfg: cfg, apiKey: "team-key", wantParts: []string{"own", "Always respond in German, regardless of the language of the request.", "team-suffix", "global-suffix"}},
+		{name: "not enforced", cfg: &config.Config{}, apiKey: "team-key", wantParts: []string{"own"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewBaseAPIHandlers([]interfaces.Client{}, tt.cfg)
+			got := h.injectSystemPrompt(normalizeContext(tt.apiKey), GEMINI, []byte(`{"systemInstruction":{"parts":[{"text":"own"}]},"contents":[]}`))
+
+			parts := gjson.GetBytes(got, "systemInstruction.parts").Array()
+			if len(parts) != len(tt.wantParts) {
+				t.Fatalf("system instruction = %s, want %d parts", gjson.GetBytes(got, "systemInstruction").Raw, len(tt.wantParts))
+			}
+			for i, want := range tt.wantParts {
+				if text := parts[i].Get("text").String(); text != want {
+					t.Errorf("part %d = %q, want %q", i, text, want)
+				}
+			}
+		})
+	}
+}
+
+func TestInjectSystemPromptNoSystemInjectHeader(t *testing.T) {
+	cfg := &config.Config{
+		SystemPrompt:     config.SystemPrompt{Prefix: "global-prefix"},
+		ResponseLanguage: config.ResponseLanguage{Language: "ja"},
+		APIKeySettings: []config.APIKeySetting{
+			{APIKey: "automation-key", AllowNoSystemInject: true, SystemPrompt: config.SystemPrompt{Suffix: "automation-suffix"}},
+			{APIKey: "team-key"},
+		},
+	}
+	h := NewBaseAPIHandlers([]interfaces.Client{}, cfg)
+	const injected = "global-prefix own Always respond in Japanese, regardless of the language of the request."
+
+	tests := []struct {
+		name   string
+		apiKey string
+		header string
+		want   string
+	}{
+		{name: "header skips injection", apiKey: "automation-key", header: "true", want: "own"},
+		{name: "header absent", apiKey: "automation-key", want: injected + " automation-suffix"},
+		{name: "header false", apiKey: "automation-key", header: "false", want: injected + " automation-suffix"},
+		{name: "header not boolean", apiKey: "automation-key", header: "yes please", want: injected + " automation-suffix"},
+		{name: "key not allowed", apiKey: "team-key", header: "true", want: injected},
+		{name: "unknown key", apiKey: "other-key", header: "1", want: injected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := normalizeContext(tt.apiKey)
+			if tt.header != "" {
+				c.Request.Header.Set(NoSystemInjectHeader, tt.header)
+			}
+			got := h.injectSystemPrompt(c, CLAUDE, []byte(`{"system":"own","messages":[{"role":"user","content":"hi"}]}`))
+			if texts := systemTexts(gjson.GetBytes(got, "system")); texts != tt.want {
+				t.Errorf("system = %q, want %q", texts, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// ResolveToolCallIDs detects tool_call_id values that are reused across tool calls in an
+// OpenAI chat request. Because the Gemini translators pair tool results with calls by ID,
+// a reused ID would attach a result to the wrong call. Depending on the
+// duplicate-tool-call-ids setting, duplicated calls are renamed to unique IDs or the
+// request is rejected.
+//
+// Each tool result is matched to the earliest preceding call with the same ID that has
+// not received a result yet, or to the latest call with that ID if all have one.
+//
+// Parameters:
+//   - rawJSON: The raw JSON OpenAI chat request
+//
+// Returns:
+//   - []byte: The request with unique tool call IDs
+//   - error: An error describing the first duplicate if duplicates are rejected
+func (h *BaseAPIHandler) ResolveToolCallIDs(rawJSON []byte) ([]byte, error) {
+	messages := gjson.GetBytes(rawJSON, "messages")
+	if !messages.IsArray() {
+		return rawJSON, nil
+	}
+
+	seen := make(map[string]int)
+	pending := make(map[string][]string)
+	latest := make(map[string]string)
+	for i, message := range messages.Array() {
+		switch message.Get("role").String() {
+		case "assistant":
+			for j, toolCall := range message.Get("tool_calls").Array() {
+				id := toolCall.Get("id").String()
+				if id == "" {
+					continue
+				}
+				if seen[id] > 0 {
+					if h.Cfg.DuplicateToolCallIDs == "reject" {
+						return rawJSON, fmt.Errorf("duplicate tool_call_id %q in messages.%d.tool_calls.%d", id, i, j)
+					}
+					unique := uniqueToolCallID(id, seen)
+					rawJSON, _ = sjson.SetBytes(rawJSON, fmt.Sprintf("messages.%d.tool_calls.%d.id", i, j), unique)
+					pending[id] = append(pending[id], unique)
+					latest[id] = unique
+					continue
+				}
+				seen[id]++
+				pending[id] = append(pending[id], id)
+				latest[id] = id
+			}
+		case "tool":
+			id := message.Get("tool_call_id").String()
+			target := latest[id]
+			if calls := pending[id]; len(calls) > 0 {
+				target = calls[0]
+				pending[id] = calls[1:]
+			}
+			if target != "" && target != id {
+				rawJSON, _ = sjson.SetBytes(rawJSON, fmt.Sprintf("messages.%d.tool_call_id", i), target)
+			}
+		}
+	}
+	return rawJSON, nil
+}
+
+// uniqueToolCallID derives an ID that has not been used yet by appending a counter.
+func uniqueToolCallID(id string, seen map[string]int) string {
+	for {
+		seen[id]++
+		candidate := fmt.Sprintf("%s_%d", id, seen[id])
+		if seen[candidate] == 0 {
+			seen[candidate] = 1
+			return candidate
+		}
+	}
+}
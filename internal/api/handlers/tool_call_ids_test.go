@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	"github.com/tidwall/gjson"
+)
+
+func TestResolveToolCallIDsRenamesDuplicates(t *testing.T) {
+	tests := []struct {
+		name        string
+		messages    string
+		wantCallIDs []string
+		wantResults []string
+	}{
+		{
+			name:        "unique ids unchanged",
+			messages:    `[{"role":"assistant","tool_calls":[{"id":"a"},{"id":"b"}]},{"role":"tool","tool_call_id":"a"},{"role":"tool","tool_call_id":"b"}]`,
+			wantCallIDs: []string{"a", "b"},
+			wantResults: []string{"a", "b"},
+		},
+		{
+			name:        "id reused across turns",
+			messages:    `[{"role":"assistant","tool_calls":[{"id":"call"}]},{"role":"tool","tool_call_id":"call"},{"role":"assistant","tool_calls":[{"id":"call"}]},{"role":"tool","tool_call_id":"call"}]`,
+			wantCallIDs: []string{"call", "call_2"},
+			wantResults: []string{"call", "call_2"},
+		},
+		{
+			name:        "id reused within a turn",
+			messages:    `[{"role":"assistant","tool_calls":[{"id":"call"},{"id":"call"}]},{"role":"tool","tool_call_id":"call"},{"role":"tool","tool_call_id":"call"}]`,
+			wantCallIDs: []string{"call", "call_2"},
+			wantResults: []string{"call", "call_2"},
+		},
+		{
+			name:        "renamed id avoids existing ids",
+			messages:    `[{"role":"assistant","tool_calls":[{"id":"call"},{"id":"call_2"},{"id":"call"}]},{"role":"tool","tool_call_id":"call"},{"role":"tool","tool_call_id":"call_2"},{"role":"tool","tool_call_id":"call"}]`,
+			wantCallIDs: []string{"call", "call_2", "call_3"},
+			wantResults: []string{"call", "call_2", "call_3"},
+		},
+		{
+			name:        "extra result maps to the latest call",
+			messages:    `[{"role":"assistant","tool_calls":[{"id":"call"}]},{"role":"tool","tool_call_id":"call"},{"role":"assistant","tool_calls":[{"id":"call"}]},{"role":"tool","tool_call_id":"call"},{"role":"tool","tool_call_id":"call"}]`,
+			wantCallIDs: []string{"call", "call_2"},
+			wantResults: []string{"call", "call_2", "call_2"},
+		},
+	}
+	h := NewBaseAPIHandlers(nil, &config.Config{DuplicateToolCallIDs: "rename"})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := h.ResolveToolCallIDs([]byte(`{"messages":` + tt.messages + `}`))
+			if err != nil {
+				t.Fatalf("ResolveToolCallIDs() error = %v", err)
+			}
+			var callIDs, results []string
+			for _, id := range gjson.GetBytes(out, "messages.#.tool_calls.#.id").Array() {
+				for _, callID := range id.Array() {
+					callIDs = append(callIDs, callID.String())
+				}
+			}
+			for _, id := range gjson.GetBytes(out, `messages.#(role=="tool")#.tool_call_id`).Array() {
+				results = append(results, id.String())
+			}
+			if strings.Join(callIDs, ",") != strings.Join(tt.wantCallIDs, ",") {
+				t.Errorf("tool call ids = %v, want %v", callIDs, tt.wantCallIDs)
+			}
+			if strings.Join(results, ",") != strings.Join(tt.wantResults, ",") {
+				t.Errorf("tool result ids = %v, want %v", results, tt.wantResults)
+			}
+		})
+	}
+}
+
+func TestResolveToolCallIDsRejectsDuplicates(t *testing.T) {
+	h := NewBaseAPIHandlers(nil, &config.Config{DuplicateToolCallIDs: "reject"})
+	raw := []byte(`{"messages":[{"role":"assistant","tool_calls":[{"id":"call"}]},{"role":"tool","tool_call_id":"call"},{"role":"assistant","tool_calls":[{"id":"call"}]}]}`)
+
+	_, err := h.ResolveToolCallIDs(raw)
+	if err == nil {
+		t.Fatal("ResolveToolCallIDs() error = nil, want a duplicate error")
+	}
+	if want := `duplicate tool_call_id "call" in messages.2.tool_calls.0`; err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+
+	// Unique ids are accepted.
+	unique := []byte(`{"messages":[{"role":"assistant","tool_calls":[{"id":"a"},{"id":"b"}]}]}`)
+	if _, err = h.ResolveToolCallIDs(unique); err != nil {
+		t.Errorf("ResolveToolCallIDs() error = %v, want nil for unique ids", err)
+	}
+}
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	// toolResultTruncatedMarker is appended to tool results cut off by the truncate policy.
+	toolResultTruncatedMarker = "\n[Tool result truncated: %d of %d bytes omitted]"
+
+	// toolResultOffloadedMarker precedes the start of tool results stored by the offload policy.
+	toolResultOffloadedMarker = "[Tool result of %d bytes stored in %s; the first %d bytes follow]\n"
+)
+
+// toolResult is a tool result of a request.
+type toolResult struct {
+	// path is the path of the tool result content in the request.
+	path string
+
+	// content is the tool result content.
+	content gjson.Result
+
+	// wrapKey is the key under which the replacement text is placed in an object, for formats
+	// whose tool results are objects rather than text.
+	wrapKey string
+}
+
+// toolResultFormats maps the handler types to a function listing the tool results of a request.
+var toolResultFormats = map[string]func(rawJSON []byte) []toolResult{
+	OPENAI: func(rawJSON []byte) []toolResult {
+		results := make([]toolResult, 0)
+		for i, message := range gjson.GetBytes(rawJSON, "messages").Array() {
+			if message.Get("role").String() == "tool" {
+				results = append(results, toolResult{path: fmt.Sprintf("messages.%d.content", i), content: message.Get("content")})
+			}
+		}
+		return results
+	},
+	OPENAI_RESPONSE: func(rawJSON []byte) []toolResult {
+		results := make([]toolResult, 0)
+		for i, item := range gjson.GetBytes(rawJSON, "input").Array() {
+			if item.Get("type").String() == "function_call_output" {
+				results = append(results, toolResult{path: fmt.Sprintf("input.%d.output", i), content: item.Get("output")})
+			}
+		}
+		return results
+	},
+	CLAUDE: func(rawJSON []byte) []toolResult {
+		results := make([]toolResult, 0)
+		for i, message := range gjson.GetBytes(rawJSON, "messages").Array() {
+			for j, block := range message.Get("content").Array() {
+				if block.Get("type").String() == "tool_result" {
+					results = append(results, toolResult{path: fmt.Sprintf("messages.%d.content.%d.content", i, j), content: block.Get("content")})
+				}
+			}
+		}
+		return results
+	},
+	GEMINI:    geminiToolResults(""),
+	GEMINICLI: geminiToolResults("request."),
+}
+
+// geminiToolResults returns the function listing the function responses of Gemini requests,
+// whose fields are below pathPrefix ("request." for Gemini CLI).
+func geminiToolResults(pathPrefix string) func(rawJSON []byte) []toolResult {
+	return func(rawJSON []byte) []toolResult {
+		results := make([]toolResult, 0)
+		for i, content := range gjson.GetBytes(rawJSON, pathPrefix+"contents").Array() {
+			for j, part := range content.Get("parts").Array() {
+				for _, key := range []string{"functionResponse", "function_response"} {
+					response := part.Get(key + ".response")
+					if !response.Exists() {
+						continue
+					}
+					result := toolResult{
+						path:    fmt.Sprintf("%scontents.%d.parts.%d.%s.response", pathPrefix, i, j, key),
+						content: response,
+						wrapKey: "content",
+					}
+					// A response holding a single text field (e.g. {"content": "..."}) is limited
+					// by that text; any other response by its JSON.
+					if fields := response.Map(); len(fields) == 1 {
+						for name, value := range fields {
+							if value.Type == gjson.String {
+								result = toolResult{path: result.path + "." + gjson.Escape(name), content: value}
+							}
+						}
+					}
+					results = append(results, result)
+				}
+			}
+		}
+		return results
+	}
+}
+
+// LimitToolResults enforces the maximum size of a single tool result of a request
+// (tool-results.max-bytes, or the key's max-tool-result-bytes), so that a tool that dumps a
+// whole file does not overflow the context of an agent loop. Depending on the policy
+// (tool-results.policy, or the key's tool-result-policy), an oversized result is truncated
+// with a marker, rejected with a 400 error written to the response, or stored in a file
+// under tool-results.offload-dir and replaced by a reference to the file and its start.
+//
+// Parameters:
+//   - c: The Gin context of the current request
+//   - handlerType: The API format of the request (e.g. OPENAI, CLAUDE)
+//   - rawJSON: The raw JSON request body
+//
+// Returns:
+//   - []byte: The request body with the oversized tool results handled
+//   - bool: True if the request may proceed
+func (h *BaseAPIHandler) LimitToolResults(c *gin.Context, handlerType string, rawJSON []byte) ([]byte, bool) {
+	maxBytes, policy := h.Cfg.ToolResults.MaxBytes, h.Cfg.ToolResults.Policy
+	if setting := h.Cfg.GetAPIKeySetting(c.GetString("apiKey")); setting != nil {
+		if setting.MaxToolResultBytes > 0 {
+			maxBytes = setting.MaxToolResultBytes
+		}
+		if setting.ToolResultPolicy != "" {
+			policy = setting.ToolResultPolicy
+		}
+	}
+	listToolResults, ok := toolResultFormats[handlerType]
+	if maxBytes <= 0 || !ok {
+		return rawJSON, true
+	}
+
+	for _, result := range listToolResults(rawJSON) {
+		text := toolResultText(result.content)
+		if len(text) <= maxBytes {
+			continue
+		}
+
+		var replacement string
+		switch policy {
+		case "reject":
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error: ErrorDetail{
+					Message: fmt.Sprintf("Invalid request: tool result at %s is %d bytes, exceeding the limit of %d bytes", result.path, len(text), maxBytes),
+					Type:    "invalid_request_error",
+				},
+			})
+			return rawJSON, false
+		case "offload":
+			path, err := h.offloadToolResult(text)
+			if err != nil {
+				log.Errorf("failed to offload tool result, truncating it instead: %v", err)
+				replacement = truncateToolResult(text, maxBytes)
+				break
+			}
+			head := truncateUTF8(text, maxBytes)
+			replacement = fmt.Sprintf(toolResultOffloadedMarker, len(text), path, len(head)) + head
+		default:
+			replacement = truncateToolResult(text, maxBytes)
+		}
+		log.Debugf("Tool result at %s of %d bytes exceeds %d bytes, applied the %s policy (request %s)", result.path, len(text), maxBytes, policyName(policy), c.GetString("requestID"))
+		rawJSON = replaceToolResult(rawJSON, result, replacement)
+	}
+	return rawJSON, true
+}
+
+// toolResultText returns the text of a tool result: the string itself, the text blocks of
+// an array of content blocks, or the JSON of any other value.
+func toolResultText(content gjson.Result) string {
+	if content.Type == gjson.String {
+		return content.String()
+	}
+	if content.IsArray() {
+		texts := make([]string, 0)
+		for _, block := range content.Array() {
+			if text := block.Get("text"); text.Exists() {
+				texts = append(texts, text.String())
+			}
+		}
+		return strings.Join(texts, "\n")
+	}
+	return content.Raw
+}
+
+// replaceToolResult replaces the text of a tool result. Content blocks other than text,
+// such as images, are kept after the replacement text.
+func replaceToolResult(rawJSON []byte, result toolResult, text string) []byte {
+	switch {
+	case result.content.IsArray():
+		blocks := make([]string, 0)
+		for _, block := range result.content.Array() {
+			if !block.Get("text").Exists() {
+				blocks = append(blocks, block.Raw)
+			}
+		}
+		textBlock, _ := sjson.Set(`{"type":"text"}`, "text", text)
+		rawJSON, _ = sjson.SetRawBytes(rawJSON, result.path, []byte("["+strings.Join(append([]string{textBlock}, blocks...), ",")+"]"))
+	case result.wrapKey != "":
+		wrapped, _ := sjson.Set(`{}`, result.wrapKey, text)
+		rawJSON, _ = sjson.SetRawBytes(rawJSON, result.path, []byte(wrapped))
+	default:
+		rawJSON, _ = sjson.SetBytes(rawJSON, result.path, text)
+	}
+	return rawJSON
+}
+
+// truncateToolResult cuts a tool result to maxBytes and appends the truncation marker.
+func truncateToolResult(text string, maxBytes int) string {
+	kept := truncateUTF8(text, maxBytes)
+	return kept + fmt.Sprintf(toolResultTruncatedMarker, len(text)-len(kept), len(text))
+}
+
+// truncateUTF8 returns at most maxBytes bytes of text without splitting a character.
+func truncateUTF8(text string, maxBytes int) string {
+	if len(text) <= maxBytes {
+		return text
+	}
+	kept := text[:maxBytes]
+	for len(kept) > 0 && !utf8.ValidString(kept) {
+		kept = kept[:len(kept)-1]
+	}
+	return kept
+}
+
+// offloadToolResult stores a tool result in tool-results.offload-dir (<auth-dir>/tool-results
+// by default), named by its hash so that a result repeated in later turns is stored once.
+func (h *BaseAPIHandler) offloadToolResult(text string) (string, error) {
+	dir := h.Cfg.ToolResults.OffloadDir
+	if dir == "" {
+		dir = filepath.Join(h.Cfg.AuthDir, "tool-results")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(text))
+	path := filepath.Join(dir, hex.EncodeToString(sum[:16])+".txt")
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	if err := os.WriteFile(path, []byte(text), 0o600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// policyName returns the name of a tool result policy, "truncate" if it is not set.
+func policyName(policy string) string {
+	if policy == "" {
+		return "truncate"
+	}
+	return policy
+}
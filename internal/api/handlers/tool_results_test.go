@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	"github.com/tidwall/gjson"
+)
+
+// toolResultContext returns a Gin context of a request authenticated with apiKey, and the
+// recorder of its response.
+func toolResultContext(apiKey string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	c.Set("apiKey", apiKey)
+	return c, w
+}
+
+func TestLimitToolResultsPolicies(t *testing.T) {
+	result := strings.Repeat("x", 100)
+	body := fmt.Sprintf(`{"messages":[{"role":"user","content":"read it"},{"role":"tool","tool_call_id":"1","content":%q}]}`, result)
+
+	tests := []struct {
+		name     string
+		maxBytes int
+		policy   string
+		keyBytes int
+		keyRule  string
+		wantOK   bool
+		want     string
+	}{
+		{name: "under the limit", maxBytes: 100, wantOK: true, want: result},
+		{name: "limit disabled", maxBytes: 0, policy: "reject", wantOK: true, want: result},
+		{name: "truncate by default", maxBytes: 10, wantOK: true, want: strings.Repeat("x", 10) + fmt.Sprintf(toolResultTruncatedMarker, 90, 100)},
+		{name: "truncate", maxBytes: 10, policy: "truncate", wantOK: true, want: strings.Repeat("x", 10) + fmt.Sprintf(toolResultTruncatedMarker, 90, 100)},
+		{name: "reject", maxBytes: 10, policy: "reject", wantOK: false},
+		{name: "key limit overrides global", maxBytes: 10, keyBytes: 200, wantOK: true, want: result},
+		{name: "key policy overrides global", maxBytes: 10, policy: "truncate", keyRule: "reject", wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{APIKeySettings: []config.APIKeySetting{{APIKey: "team-key", MaxToolResultBytes: tt.keyBytes, ToolResultPolicy: tt.keyRule}}}
+			cfg.ToolResults.MaxBytes = tt.maxBytes
+			cfg.ToolResults.Policy = tt.policy
+			h := NewBaseAPIHandlers([]interfaces.Client{}, cfg)
+
+			c, w := toolResultContext("team-key")
+			got, ok := h.LimitToolResults(c, OPENAI, []byte(body))
+			if ok != tt.wantOK {
+				t.Fatalf("LimitToolResults() ok = %t, want %t", ok, tt.wantOK)
+			}
+			if !ok {
+				if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "100 bytes, exceeding the limit of 10 bytes") {
+					t.Errorf("response = %d %s, want a 400 naming the sizes", w.Code, w.Body.String())
+				}
+				return
+			}
+			if content := gjson.GetBytes(got, "messages.1.content").String(); content != tt.want {
+				t.Errorf("tool result = %q, want %q", content, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimitToolResultsOffload(t *testing.T) {
+	result := strings.Repeat("y", 100)
+	cfg := &config.Config{}
+	cfg.ToolResults.MaxBytes = 10
+	cfg.ToolResults.Policy = "offload"
+	cfg.ToolResults.OffloadDir = t.TempDir()
+	h := NewBaseAPIHandlers([]interfaces.Client{}, cfg)
+
+	body := fmt.Sprintf(`{"input":[{"type":"function_call_output","call_id":"1","output":%q}]}`, result)
+	c, _ := toolResultContext("")
+	got, ok := h.LimitToolResults(c, OPENAI_RESPONSE, []byte(body))
+	if !ok {
+		t.Fatal("LimitToolResults() rejected the request")
+	}
+
+	output := gjson.GetBytes(got, "input.0.output").String()
+	path, err := h.offloadToolResult(result)
+	if err != nil {
+		t.Fatalf("offloadToolResult() error = %v", err)
+	}
+	if want := fmt.Sprintf(toolResultOffloadedMarker, 100, path, 10) + strings.Repeat("y", 10); output != want {
+		t.Errorf("tool result = %q, want %q", output, want)
+	}
+	stored, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading the offloaded result: %v", err)
+	}
+	if string(stored) != result {
+		t.Errorf("offloaded result = %q, want the full result", stored)
+	}
+}
+
+func TestLimitToolResultsFormats(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.ToolResults.MaxBytes = 4
+	h := NewBaseAPIHandlers([]interfaces.Client{}, cfg)
+	marker := fmt.Sprintf(toolResultTruncatedMarker, 6, 10)
+
+	tests := []struct {
+		name        string
+		handlerType string
+		body        string
+		path        string
+		want        string
+	}{
+		{
+			name:        "Claude text blocks keep images",
+			handlerType: CLAUDE,
+			body:        `{"messages":[{"role":"user","content":[{"type":"tool_result","tool_use_id":"1","content":[{"type":"text","text":"abcdefghij"},{"type":"image","source":{}}]}]}]}`,
+			path:        "messages.0.content.0.content",
+			want:        fmt.Sprintf(`[{"type":"text","text":%q},{"type":"image","source":{}}]`, "abcd"+marker),
+		},
+		{
+			name:        "Gemini single text field",
+			handlerType: GEMINI,
+			body:        `{"contents":[{"role":"user","parts":[{"functionResponse":{"name":"f","response":{"output":"abcdefghij"}}}]}]}`,
+			path:        "contents.0.parts.0.functionResponse.response",
+			want:        fmt.Sprintf(`{"output":%q}`, "abcd"+marker),
+		},
+		{
+			name:        "Gemini CLI object response",
+			handlerType: GEMINICLI,
+			body:        `{"request":{"contents":[{"role":"user","parts":[{"functionResponse":{"name":"f","response":{"a":1,"b":2}}}]}]}}`,
+			path:        "request.contents.0.parts.0.functionResponse.response",
+			want:        fmt.Sprintf(`{"content":%q}`, `{"a"`+fmt.Sprintf(toolResultTruncatedMarker, 9, 13)),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := toolResultContext("")
+			got, ok := h.LimitToolResults(c, tt.handlerType, []byte(tt.body))
+			if !ok {
+				t.Fatal("LimitToolResults() rejected the request")
+			}
+			if raw := gjson.GetBytes(got, tt.path).Raw; raw != tt.want {
+				t.Errorf("%s = %s, want %s", tt.path, raw, tt.want)
+			}
+		})
+	}
+}
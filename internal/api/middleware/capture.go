@@ -0,0 +1,85 @@
+// Package middleware provides HTTP middleware components for the CLI Proxy API server.
+// This file contains the capture middleware that records API requests, together with the
+// upstream exchanges they trigger, to replay files for regression testing.
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/capture"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// RequestCapture records API requests to replay files. Capturing only takes effect while
+// debug mode is on, since the files contain full prompts and responses.
+type RequestCapture struct {
+	cfg     atomic.Pointer[config.RequestCapture]
+	baseDir string
+}
+
+// NewRequestCapture creates a new capture middleware.
+//
+// Parameters:
+//   - cfg: The application configuration
+//   - baseDir: The directory relative capture directories are resolved against
+//
+// Returns:
+//   - *RequestCapture: A new capture middleware instance
+func NewRequestCapture(cfg *config.Config, baseDir string) *RequestCapture {
+	rc := &RequestCapture{baseDir: baseDir}
+	rc.SetConfig(cfg)
+	return rc
+}
+
+// SetConfig replaces the active capture settings.
+//
+// Parameters:
+//   - cfg: The application configuration
+func (rc *RequestCapture) SetConfig(cfg *config.Config) {
+	settings := cfg.RequestCapture
+	settings.Enabled = settings.Enabled && cfg.Debug
+	rc.cfg.Store(&settings)
+}
+
+// Middleware returns a Gin middleware that captures requests while capturing is enabled.
+//
+// Returns:
+//   - gin.HandlerFunc: The capture middleware handler
+func (rc *RequestCapture) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		settings := rc.cfg.Load()
+		if !settings.Enabled {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.Next()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		record := capture.NewRecord(c.Request, body)
+		c.Set(capture.ContextKey, record)
+		c.Next()
+
+		dir := settings.Dir
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(rc.baseDir, dir)
+		}
+		name := fmt.Sprintf("%s-%s", record.CapturedAt.Format("20060102-150405"), c.GetString(RequestIDKey))
+		path, errSave := record.Save(dir, name)
+		if errSave != nil {
+			log.Warnf("failed to save request capture: %v", errSave)
+			return
+		}
+		log.Debugf("captured request %s to %s", c.GetString(RequestIDKey), path)
+	}
+}
@@ -0,0 +1,120 @@
+// Package middleware provides HTTP middleware components for the CLI Proxy API server.
+// This file contains the CORS middleware that applies the configured cross-origin
+// policy to API responses and answers preflight requests.
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+)
+
+// defaultCORSMethods is used when the configuration does not list allowed methods.
+var defaultCORSMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+
+// corsExposedHeaders lists the response headers browsers are allowed to read.
+const corsExposedHeaders = "Retry-After, X-Request-ID, X-Resolved-Generation-Config"
+
+// CORS applies a cross-origin resource sharing policy. The policy can be updated
+// at runtime via SetConfig.
+type CORS struct {
+	cfg atomic.Pointer[config.CORS]
+}
+
+// NewCORS creates a new CORS middleware with the given policy.
+//
+// Parameters:
+//   - cfg: The CORS configuration
+//
+// Returns:
+//   - *CORS: A new CORS middleware instance
+func NewCORS(cfg config.CORS) *CORS {
+	m := &CORS{}
+	m.SetConfig(cfg)
+	return m
+}
+
+// SetConfig replaces the active CORS policy.
+//
+// Parameters:
+//   - cfg: The CORS configuration
+func (m *CORS) SetConfig(cfg config.CORS) {
+	m.cfg.Store(&cfg)
+}
+
+// Middleware returns a Gin middleware that sets the Access-Control-* headers for
+// allowed origins and answers preflight OPTIONS requests. Requests from origins that
+// are not allowed receive no CORS headers, and their preflight requests are rejected.
+//
+// Returns:
+//   - gin.HandlerFunc: The CORS middleware handler
+func (m *CORS) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		cfg := m.cfg.Load()
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		allowOrigin, allowed := m.allowedOrigin(cfg, origin)
+		if !allowed {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		c.Header("Access-Control-Allow-Origin", allowOrigin)
+		if allowOrigin != "*" {
+			c.Header("Vary", "Origin")
+		}
+		if cfg.AllowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+		c.Header("Access-Control-Expose-Headers", corsExposedHeaders)
+
+		if preflight {
+			methods := cfg.AllowedMethods
+			if len(methods) == 0 {
+				methods = defaultCORSMethods
+			}
+			c.Header("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+
+			if len(cfg.AllowedHeaders) > 0 {
+				c.Header("Access-Control-Allow-Headers", strings.Join(cfg.AllowedHeaders, ", "))
+			} else if requested := c.GetHeader("Access-Control-Request-Headers"); requested != "" {
+				c.Header("Access-Control-Allow-Headers", requested)
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// allowedOrigin returns the Access-Control-Allow-Origin value for the request origin
+// and whether the origin is allowed at all. A wildcard is echoed back as the request
+// origin when credentials are allowed, since browsers reject "*" with credentials.
+func (m *CORS) allowedOrigin(cfg *config.CORS, origin string) (string, bool) {
+	for _, allowed := range cfg.AllowedOrigins {
+		if allowed == "*" {
+			if cfg.AllowCredentials {
+				return origin, true
+			}
+			return "*", true
+		}
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return origin, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+)
+
+func TestCORS(t *testing.T) {
+	tests := []struct {
+		name            string
+		cfg             config.CORS
+		method          string
+		origin          string
+		requestHeaders  string
+		wantStatus      int
+		wantAllowOrigin string
+		wantCredentials string
+		wantMethods     string
+		wantHeaders     string
+	}{
+		{
+			name:       "no origin",
+			cfg:        config.CORS{AllowedOrigins: []string{"https://app.example.com"}},
+			method:     http.MethodPost,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:            "allowed origin",
+			cfg:             config.CORS{AllowedOrigins: []string{"https://app.example.com/"}},
+			method:          http.MethodPost,
+			origin:          "https://APP.example.com",
+			wantStatus:      http.StatusOK,
+			wantAllowOrigin: "https://APP.example.com",
+		},
+		{
+			name:       "other origin",
+			cfg:        config.CORS{AllowedOrigins: []string{"https://app.example.com"}},
+			method:     http.MethodPost,
+			origin:     "https://evil.example.com",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "other origin preflight",
+			cfg:        config.CORS{AllowedOrigins: []string{"https://app.example.com"}},
+			method:     http.MethodOptions,
+			origin:     "https://evil.example.com",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:            "wildcard",
+			cfg:             config.CORS{AllowedOrigins: []string{"*"}},
+			method:          http.MethodPost,
+			origin:          "https://any.example.com",
+			wantStatus:      http.StatusOK,
+			wantAllowOrigin: "*",
+		},
+		{
+			name:            "wildcard with credentials echoes the origin",
+			cfg:             config.CORS{AllowedOrigins: []string{"*"}, AllowCredentials: true},
+			method:          http.MethodPost,
+			origin:          "https://any.example.com",
+			wantStatus:      http.StatusOK,
+			wantAllowOrigin: "https://any.example.com",
+			wantCredentials: "true",
+		},
+		{
+			name:            "preflight with defaults",
+			cfg:             config.CORS{AllowedOrigins: []string{"*"}},
+			method:          http.MethodOptions,
+			origin:          "https://any.example.com",
+			requestHeaders:  "Authorization, Content-Type",
+			wantStatus:      http.StatusNoContent,
+			wantAllowOrigin: "*",
+			wantMethods:     "GET, POST, PUT, PATCH, DELETE, OPTIONS",
+			wantHeaders:     "Authorization, Content-Type",
+		},
+		{
+			name:            "preflight with configured methods and headers",
+			cfg:             config.CORS{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"POST"}, AllowedHeaders: []string{"Authorization"}},
+			method:          http.MethodOptions,
+			origin:          "https://any.example.com",
+			requestHeaders:  "Authorization, X-Custom",
+			wantStatus:      http.StatusNoContent,
+			wantAllowOrigin: "*",
+			wantMethods:     "POST",
+			wantHeaders:     "Authorization",
+		},
+	}
+	gin.SetMode(gin.TestMode)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := gin.New()
+			engine.Use(NewCORS(tt.cfg).Middleware())
+			engine.Any("/v1/chat/completions", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(tt.method, "/v1/chat/completions", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.method == http.MethodOptions {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+			if tt.requestHeaders != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.requestHeaders)
+			}
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			for header, want := range map[string]string{
+				"Access-Control-Allow-Origin":      tt.wantAllowOrigin,
+				"Access-Control-Allow-Credentials": tt.wantCredentials,
+				"Access-Control-Allow-Methods":     tt.wantMethods,
+				"Access-Control-Allow-Headers":     tt.wantHeaders,
+			} {
+				if got := w.Header().Get(header); got != want {
+					t.Errorf("%s = %q, want %q", header, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCORSSetConfigAppliesToNextRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cors := NewCORS(config.CORS{})
+	engine := gin.New()
+	engine.Use(cors.Middleware())
+	engine.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	request := func() string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w.Header().Get("Access-Control-Allow-Origin")
+	}
+	if got := request(); got != "" {
+		t.Errorf("Access-Control-Allow-Origin = %q before the update, want none", got)
+	}
+	cors.SetConfig(config.CORS{AllowedOrigins: []string{"https://app.example.com"}})
+	if got := request(); got != "https://app.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q after the update, want the origin", got)
+	}
+}
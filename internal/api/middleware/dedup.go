@@ -0,0 +1,233 @@
+// Package middleware provides HTTP middleware components for the CLI Proxy API server.
+// This file contains the request deduplication middleware that lets identical API
+// requests, sent by the same API key within a short window, share one upstream response.
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	"github.com/luispater/CLIProxyAPI/v5/internal/metrics"
+)
+
+// DeduplicatedHeader marks responses replayed from an identical earlier request.
+const DeduplicatedHeader = "X-Deduplicated"
+
+// dedupEntry holds the recorded response of a request that identical requests can reuse.
+type dedupEntry struct {
+	// done is closed once the response is complete.
+	done chan struct{}
+
+	// expires is the time after which the entry is no longer reused. It is set on completion.
+	expires time.Time
+
+	// replayable reports whether the recorded response is complete and can be replayed.
+	replayable bool
+
+	status int
+	header http.Header
+	chunks [][]byte
+}
+
+// RequestDedup coalesces identical POST requests. The first request is served normally
+// while its response is recorded; identical requests that arrive while it is in flight or
+// within the window after it completes receive a replay of that response. The settings
+// can be updated at runtime via SetConfig.
+type RequestDedup struct {
+	cfg atomic.Pointer[config.RequestDedup]
+
+	mutex   sync.Mutex
+	entries map[string]*dedupEntry
+}
+
+// NewRequestDedup creates a new deduplication middleware with the given settings.
+//
+// Parameters:
+//   - cfg: The deduplication configuration
+//
+// Returns:
+//   - *RequestDedup: A new deduplication middleware instance
+func NewRequestDedup(cfg config.RequestDedup) *RequestDedup {
+	d := &RequestDedup{entries: make(map[string]*dedupEntry)}
+	d.SetConfig(cfg)
+	return d
+}
+
+// SetConfig replaces the active deduplication settings.
+//
+// Parameters:
+//   - cfg: The deduplication configuration
+func (d *RequestDedup) SetConfig(cfg config.RequestDedup) {
+	d.cfg.Store(&cfg)
+}
+
+// Middleware returns a Gin middleware that deduplicates identical requests. It must run
+// after authentication so that requests are only shared between callers using the same key.
+//
+// Returns:
+//   - gin.HandlerFunc: The deduplication middleware handler
+func (d *RequestDedup) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := d.cfg.Load()
+		if !cfg.Enabled || c.Request.Method != http.MethodPost {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.Next()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		key := dedupKey(c.GetString("apiKey"), c.Request.URL.RequestURI(), body)
+		entry, leader, inFlight := d.acquire(key)
+		if !leader {
+			select {
+			case <-entry.done:
+			case <-c.Request.Context().Done():
+				c.Abort()
+				return
+			}
+			if entry.replayable {
+				if inFlight {
+					metrics.DedupRequests.Inc("coalesced")
+				} else {
+					metrics.DedupRequests.Inc("deduped")
+				}
+				replay(c, entry)
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
+		writer := &dedupWriter{ResponseWriter: c.Writer, entry: entry, maxChunks: cfg.MaxBufferedChunks}
+		c.Writer = writer
+		defer func() {
+			// Evaluated once the request has been served, so that cancelled or aborted
+			// responses are not replayed.
+			finished := c.Request.Context().Err() == nil && !c.IsAborted()
+			d.complete(key, entry, writer, finished, time.Duration(cfg.WindowSeconds)*time.Second)
+		}()
+		c.Next()
+	}
+}
+
+// acquire returns the entry for a key, creating it if no reusable entry exists. Expired
+// entries are removed so that memory is bounded by the requests of the last window.
+//
+// Returns:
+//   - *dedupEntry: The entry for the key
+//   - bool: True if the caller created the entry and must serve the request
+//   - bool: True if the entry was still in flight
+func (d *RequestDedup) acquire(key string) (*dedupEntry, bool, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	now := time.Now()
+	for k, e := range d.entries {
+		if !e.expires.IsZero() && now.After(e.expires) {
+			delete(d.entries, k)
+		}
+	}
+
+	if entry, ok := d.entries[key]; ok {
+		return entry, false, entry.expires.IsZero()
+	}
+	entry := &dedupEntry{done: make(chan struct{}), replayable: true}
+	d.entries[key] = entry
+	return entry, true, false
+}
+
+// complete records the outcome of a served request and releases waiting requests. Failed,
+// cancelled, or oversized responses are not reused.
+func (d *RequestDedup) complete(key string, entry *dedupEntry, writer *dedupWriter, finished bool, window time.Duration) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	entry.status = writer.Status()
+	entry.header = writer.Header().Clone()
+	entry.replayable = entry.replayable && finished && entry.status < http.StatusBadRequest
+	entry.expires = time.Now().Add(window)
+	if !entry.replayable || window <= 0 {
+		entry.chunks = nil
+		if d.entries[key] == entry {
+			delete(d.entries, key)
+		}
+	}
+	close(entry.done)
+}
+
+// replay writes a recorded response.
+func replay(c *gin.Context, entry *dedupEntry) {
+	for name, values := range entry.header {
+		if name == RequestIDHeader {
+			continue
+		}
+		for _, value := range values {
+			c.Writer.Header().Add(name, value)
+		}
+	}
+	c.Writer.Header().Set(DeduplicatedHeader, "true")
+	c.Writer.WriteHeader(entry.status)
+	for _, chunk := range entry.chunks {
+		_, _ = c.Writer.Write(chunk)
+	}
+	c.Writer.Flush()
+}
+
+// dedupKey identifies a request by API key, URI, and body.
+func dedupKey(apiKey, uri string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(apiKey))
+	hash.Write([]byte{0})
+	hash.Write([]byte(uri))
+	hash.Write([]byte{0})
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// dedupWriter records the chunks written to the client, up to maxChunks. Responses with
+// more chunks are still served but not recorded.
+type dedupWriter struct {
+	gin.ResponseWriter
+	entry     *dedupEntry
+	maxChunks int
+}
+
+// Write records the chunk and forwards it to the client.
+func (w *dedupWriter) Write(data []byte) (int, error) {
+	w.record(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString records the chunk and forwards it to the client.
+func (w *dedupWriter) WriteString(s string) (int, error) {
+	w.record([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// record appends a copy of the chunk to the entry, or gives up on the entry once the
+// chunk limit is exceeded.
+func (w *dedupWriter) record(data []byte) {
+	if !w.entry.replayable {
+		return
+	}
+	if w.maxChunks > 0 && len(w.entry.chunks) >= w.maxChunks {
+		w.entry.replayable = false
+		w.entry.chunks = nil
+		return
+	}
+	w.entry.chunks = append(w.entry.chunks, bytes.Clone(data))
+}
@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	"github.com/luispater/CLIProxyAPI/v5/internal/metrics"
+)
+
+// dedupEngine serves POST /generate behind the deduplication middleware. Every call of the
+// handler is counted in calls and answered with the given chunks.
+func dedupEngine(d *RequestDedup, calls *int, chunks ...string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(d.Middleware())
+	engine.POST("/generate", func(c *gin.Context) {
+		*calls++
+		for _, chunk := range chunks {
+			_, _ = c.Writer.WriteString(chunk)
+		}
+	})
+	return engine
+}
+
+// postGenerate sends an identical request to the engine.
+func postGenerate(engine *gin.Engine) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(`{"prompt":"hi"}`)))
+	return w
+}
+
+// expireEntries moves the end of the window of every completed entry into the past.
+func expireEntries(d *RequestDedup) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, entry := range d.entries {
+		if !entry.expires.IsZero() {
+			entry.expires = time.Now().Add(-time.Second)
+		}
+	}
+}
+
+func TestRequestDedupReplaysWithinWindowAndExpires(t *testing.T) {
+	d := NewRequestDedup(config.RequestDedup{Enabled: true, WindowSeconds: 60, MaxBufferedChunks: 16})
+	calls := 0
+	engine := dedupEngine(d, &calls, "first ", "chunk")
+	deduped := metrics.DedupRequests.Value("deduped")
+
+	postGenerate(engine)
+	replayed := postGenerate(engine)
+	if calls != 1 {
+		t.Fatalf("handler calls = %d within the window, want 1", calls)
+	}
+	if replayed.Header().Get(DeduplicatedHeader) != "true" || replayed.Body.String() != "first chunk" {
+		t.Errorf("replay = %q with %s %q, want the recorded response", replayed.Body.String(), DeduplicatedHeader, replayed.Header().Get(DeduplicatedHeader))
+	}
+	if got := metrics.DedupRequests.Value("deduped") - deduped; got != 1 {
+		t.Errorf("deduped counter increased by %v, want 1", got)
+	}
+
+	expireEntries(d)
+	if w := postGenerate(engine); w.Header().Get(DeduplicatedHeader) != "" {
+		t.Error("a request after the window was answered with a replay")
+	}
+	if calls != 2 {
+		t.Errorf("handler calls = %d after the window, want 2", calls)
+	}
+	d.mutex.Lock()
+	entries := len(d.entries)
+	d.mutex.Unlock()
+	if entries != 1 {
+		t.Errorf("entries = %d, want the expired entry removed", entries)
+	}
+}
+
+func TestRequestDedupDoesNotShareResponsesAboveBufferCap(t *testing.T) {
+	d := NewRequestDedup(config.RequestDedup{Enabled: true, WindowSeconds: 60, MaxBufferedChunks: 2})
+	calls := 0
+	engine := dedupEngine(d, &calls, "one", "two", "three")
+
+	first := postGenerate(engine)
+	second := postGenerate(engine)
+	if first.Body.String() != "onetwothree" || second.Body.String() != "onetwothree" {
+		t.Errorf("responses = %q and %q, want both complete", first.Body.String(), second.Body.String())
+	}
+	if calls != 2 {
+		t.Errorf("handler calls = %d, want a response above the cap not to be shared", calls)
+	}
+	if second.Header().Get(DeduplicatedHeader) != "" {
+		t.Error("a response above the cap was replayed")
+	}
+}
+
+func TestRequestDedupDoesNotReplayCancelledResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	d := NewRequestDedup(config.RequestDedup{Enabled: true, WindowSeconds: 60, MaxBufferedChunks: 16})
+	calls := 0
+	engine := gin.New()
+	engine.Use(d.Middleware())
+	engine.POST("/generate", func(c *gin.Context) {
+		calls++
+		_, _ = c.Writer.WriteString("partial")
+		if cancel, ok := c.Request.Context().Value(cancelKey{}).(context.CancelFunc); ok {
+			// The client disconnects before the response is complete.
+			cancel()
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = context.WithValue(ctx, cancelKey{}, cancel)
+	req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(`{"prompt":"hi"}`)).WithContext(ctx)
+	engine.ServeHTTP(httptest.NewRecorder(), req)
+
+	if w := postGenerate(engine); w.Header().Get(DeduplicatedHeader) != "" {
+		t.Error("the truncated response of a cancelled request was replayed")
+	}
+	if calls != 2 {
+		t.Errorf("handler calls = %d, want the identical request served again", calls)
+	}
+}
+
+// cancelKey is the context key of the function that cancels a test request.
+type cancelKey struct{}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+func TestLoadShedderRejectsRequestsPastThreshold(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	shedder := NewLoadShedder(1, 7)
+	release := make(chan struct{})
+	engine := gin.New()
+	engine.Use(shedder.Middleware())
+	engine.GET("/slow", func(c *gin.Context) {
+		<-release
+		c.String(http.StatusOK, "done")
+	})
+	engine.GET("/fast", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	// The first request occupies the only slot.
+	first := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		engine.ServeHTTP(first, httptest.NewRequest(http.MethodGet, "/slow", nil))
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for shedder.Active() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("the first request did not start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	second := httptest.NewRecorder()
+	engine.ServeHTTP(second, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if second.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", second.Code, http.StatusServiceUnavailable)
+	}
+	if got := second.Header().Get("Retry-After"); got != "7" {
+		t.Errorf("Retry-After = %q, want %q", got, "7")
+	}
+	if got := gjson.Get(second.Body.String(), "error.code").String(); got != "overloaded" {
+		t.Errorf("error.code = %q, want %q", got, "overloaded")
+	}
+
+	close(release)
+	<-done
+	if first.Code != http.StatusOK {
+		t.Errorf("first request status = %d, want %d", first.Code, http.StatusOK)
+	}
+	if active := shedder.Active(); active != 0 {
+		t.Errorf("Active() = %d after the requests completed, want 0", active)
+	}
+
+	// Once the load is gone, requests are served again.
+	third := httptest.NewRecorder()
+	engine.ServeHTTP(third, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	if third.Code != http.StatusNoContent {
+		t.Errorf("status after the load is gone = %d, want %d", third.Code, http.StatusNoContent)
+	}
+}
@@ -0,0 +1,116 @@
+// Package middleware provides HTTP middleware components for the CLI Proxy API server.
+// This file contains the global rate limiting middleware that caps the rate of API requests
+// across all keys and accounts with a token bucket.
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	"github.com/luispater/CLIProxyAPI/v5/internal/metrics"
+)
+
+// GlobalRateLimiter admits API requests at a configured average rate with bursts up to a
+// configured size, regardless of the API key or the account that would serve them. Requests
+// beyond the limit are rejected with 429 and a Retry-After header.
+type GlobalRateLimiter struct {
+	mutex sync.Mutex
+
+	// rate is the number of tokens added per second; 0 disables the limiter.
+	rate float64
+
+	// burst is the capacity of the bucket.
+	burst float64
+
+	// tokens is the number of tokens available at lastRefill.
+	tokens float64
+
+	// lastRefill is when tokens was last updated.
+	lastRefill time.Time
+}
+
+// NewGlobalRateLimiter creates a new global rate limiter.
+//
+// Parameters:
+//   - cfg: The rate limit settings
+//
+// Returns:
+//   - *GlobalRateLimiter: A new rate limiter instance
+func NewGlobalRateLimiter(cfg config.GlobalRateLimit) *GlobalRateLimiter {
+	l := &GlobalRateLimiter{}
+	l.SetConfig(cfg)
+	return l
+}
+
+// SetConfig replaces the rate and burst. The bucket starts full after a change.
+//
+// Parameters:
+//   - cfg: The rate limit settings
+func (l *GlobalRateLimiter) SetConfig(cfg config.GlobalRateLimit) {
+	burst := float64(cfg.Burst)
+	if burst < 1 {
+		burst = math.Max(1, math.Ceil(cfg.RequestsPerSecond))
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.rate == cfg.RequestsPerSecond && l.burst == burst {
+		return
+	}
+	l.rate = cfg.RequestsPerSecond
+	l.burst = burst
+	l.tokens = burst
+	l.lastRefill = time.Now()
+}
+
+// take removes a token from the bucket if one is available.
+//
+// Returns:
+//   - bool: True if the request is admitted
+//   - time.Duration: The time until a token is available if the request is not admitted
+func (l *GlobalRateLimiter) take() (bool, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.rate <= 0 {
+		return true, 0
+	}
+
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.lastRefill).Seconds()*l.rate)
+	l.lastRefill = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// Middleware returns a Gin middleware that rejects requests beyond the global rate limit
+// with 429 and a Retry-After header.
+//
+// Returns:
+//   - gin.HandlerFunc: The rate limiting middleware handler
+func (l *GlobalRateLimiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		admitted, wait := l.take()
+		if admitted {
+			c.Next()
+			return
+		}
+
+		metrics.RateLimitRejections.Inc()
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"error": gin.H{
+				"message": "Global request rate limit exceeded, please retry later",
+				"type":    "rate_limit_error",
+				"code":    "rate_limited",
+			},
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	"github.com/luispater/CLIProxyAPI/v5/internal/metrics"
+	"github.com/tidwall/gjson"
+)
+
+func TestGlobalRateLimiterGatesRequestsAcrossKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name           string
+		cfg            config.GlobalRateLimit
+		requests       int
+		wantAdmitted   int
+		wantRetryAfter string
+	}{
+		{name: "disabled", requests: 5, wantAdmitted: 5},
+		{name: "burst then rejected", cfg: config.GlobalRateLimit{RequestsPerSecond: 0.5, Burst: 2}, requests: 4, wantAdmitted: 2, wantRetryAfter: "2"},
+		{name: "burst defaults to the rate", cfg: config.GlobalRateLimit{RequestsPerSecond: 3}, requests: 5, wantAdmitted: 3, wantRetryAfter: "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewGlobalRateLimiter(tt.cfg)
+			engine := gin.New()
+			engine.Use(limiter.Middleware())
+			engine.POST("/v1/chat/completions", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+			engine.POST("/v1beta/models/:action", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+			rejectionsBefore := metrics.RateLimitRejections.Value()
+			admitted := 0
+			var rejected *httptest.ResponseRecorder
+			for i := 0; i < tt.requests; i++ {
+				// Each request uses a different key and route; the limit is shared by all of them.
+				path := "/v1/chat/completions"
+				if i%2 == 1 {
+					path = "/v1beta/models/gemini-2.5-pro:generateContent"
+				}
+				req := httptest.NewRequest(http.MethodPost, path, nil)
+				req.Header.Set("Authorization", fmt.Sprintf("Bearer key-%d", i))
+				recorder := httptest.NewRecorder()
+				engine.ServeHTTP(recorder, req)
+				switch recorder.Code {
+				case http.StatusNoContent:
+					admitted++
+				case http.StatusTooManyRequests:
+					rejected = recorder
+				default:
+					t.Fatalf("status = %d, want %d or %d", recorder.Code, http.StatusNoContent, http.StatusTooManyRequests)
+				}
+			}
+
+			if admitted != tt.wantAdmitted {
+				t.Errorf("admitted = %d, want %d", admitted, tt.wantAdmitted)
+			}
+			if got := metrics.RateLimitRejections.Value() - rejectionsBefore; got != float64(tt.requests-tt.wantAdmitted) {
+				t.Errorf("rejections counted = %v, want %d", got, tt.requests-tt.wantAdmitted)
+			}
+			if tt.wantRetryAfter == "" {
+				return
+			}
+			if got := rejected.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+			if got := gjson.Get(rejected.Body.String(), "error.code").String(); got != "rate_limited" {
+				t.Errorf("error.code = %q, want %q", got, "rate_limited")
+			}
+		})
+	}
+}
+
+func TestGlobalRateLimiterRefills(t *testing.T) {
+	limiter := NewGlobalRateLimiter(config.GlobalRateLimit{RequestsPerSecond: 2, Burst: 1})
+	if admitted, _ := limiter.take(); !admitted {
+		t.Fatal("first request rejected, want it admitted from the full bucket")
+	}
+	if admitted, wait := limiter.take(); admitted || wait <= 0 || wait > 500*time.Millisecond {
+		t.Fatalf("take() = %t, %v, want a rejection with a wait of at most 500ms", admitted, wait)
+	}
+
+	// Half a second later a token has been added.
+	limiter.mutex.Lock()
+	limiter.lastRefill = limiter.lastRefill.Add(-500 * time.Millisecond)
+	limiter.mutex.Unlock()
+	if admitted, _ := limiter.take(); !admitted {
+		t.Error("request after the refill rejected, want it admitted")
+	}
+
+	// A changed configuration starts with a full bucket.
+	limiter.SetConfig(config.GlobalRateLimit{RequestsPerSecond: 2, Burst: 3})
+	for i := 0; i < 3; i++ {
+		if admitted, _ := limiter.take(); !admitted {
+			t.Errorf("request %d after the change rejected, want the new burst admitted", i)
+		}
+	}
+}
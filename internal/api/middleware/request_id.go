@@ -0,0 +1,53 @@
+// Package middleware provides HTTP middleware components for the CLI Proxy API server.
+// This file contains the request ID middleware that assigns every request a
+// correlation ID, preserving the one provided by the client when present.
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// RequestIDHeader is the header carrying the request correlation ID.
+	// It also matches the OpenAI X-Request-Id spelling, since header names are case-insensitive.
+	RequestIDHeader = "X-Request-ID"
+
+	// RequestIDKey is the Gin context key holding the request correlation ID.
+	RequestIDKey = "requestID"
+
+	// maxRequestIDLength bounds client-provided IDs so they cannot bloat logs or upstream headers.
+	maxRequestIDLength = 128
+)
+
+// RequestIDMiddleware returns a Gin middleware that stores the client's X-Request-ID in the
+// context, or a generated one if the client omitted it or sent an invalid value, and echoes
+// it in the response headers.
+//
+// Returns:
+//   - gin.HandlerFunc: The request ID middleware handler
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.New().String()
+		}
+		c.Set(RequestIDKey, requestID)
+		c.Header(RequestIDHeader, requestID)
+		c.Next()
+	}
+}
+
+// validRequestID reports whether a client-provided request ID is non-empty, bounded in
+// length, and made of printable ASCII characters only.
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(requestID); i++ {
+		if requestID[i] < 0x21 || requestID[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -14,7 +14,8 @@ import (
 // RequestLoggingMiddleware creates a Gin middleware that logs HTTP requests and responses.
 // It captures detailed information about the request and response, including headers and body,
 // and uses the provided RequestLogger to record this data. If logging is disabled in the
-// logger, the middleware has minimal overhead.
+// logger, the middleware has minimal overhead. Requests outside the logger's sample are
+// captured as well, so that they can still be logged if they fail.
 func RequestLoggingMiddleware(logger logging.RequestLogger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Early return if logging is disabled (zero overhead)
@@ -32,6 +33,8 @@ func RequestLoggingMiddleware(logger logging.RequestLogger) gin.HandlerFunc {
 			return
 		}
 
+		requestInfo.Sampled = logger.IsSampled()
+
 		// Create response writer wrapper
 		wrapper := NewResponseWriterWrapper(c.Writer, logger, requestInfo)
 		c.Writer = wrapper
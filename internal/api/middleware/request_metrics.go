@@ -0,0 +1,83 @@
+// Package middleware provides HTTP middleware components for the CLI Proxy API server.
+// This file contains the middleware that records the Prometheus request metrics.
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/metrics"
+	"github.com/tidwall/gjson"
+)
+
+// RequestMetrics returns a Gin middleware that counts the API requests by requested model
+// and response status, and tracks the streaming responses in flight. The model is taken
+// from the Gemini route (/v1beta/models/{model}:{method}) or the "model" field of the body.
+func RequestMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		model := requestedModel(c)
+		writer := &streamTrackingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		defer func() {
+			if writer.streaming {
+				metrics.ActiveStreams.Add(-1)
+			}
+			metrics.Requests.Inc(model, strconv.Itoa(writer.Status()))
+		}()
+		c.Next()
+	}
+}
+
+// requestedModel returns the model a request asks for, or "unknown".
+func requestedModel(c *gin.Context) string {
+	if action := c.Param("action"); action != "" {
+		model, _, _ := strings.Cut(action, ":")
+		return model
+	}
+	if c.Request.Body != nil {
+		body, err := io.ReadAll(c.Request.Body)
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		if err == nil {
+			if model := gjson.GetBytes(body, "model").String(); model != "" {
+				return model
+			}
+		}
+	}
+	return "unknown"
+}
+
+// streamTrackingWriter counts a response as an active stream from its first write with an
+// event stream content type.
+type streamTrackingWriter struct {
+	gin.ResponseWriter
+	streaming bool
+}
+
+// observe starts tracking the response if it is an event stream.
+func (w *streamTrackingWriter) observe() {
+	if !w.streaming && strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		w.streaming = true
+		metrics.ActiveStreams.Add(1)
+	}
+}
+
+// Write writes response data.
+func (w *streamTrackingWriter) Write(data []byte) (int, error) {
+	w.observe()
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString writes a response string.
+func (w *streamTrackingWriter) WriteString(s string) (int, error) {
+	w.observe()
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Flush sends buffered response data to the client.
+func (w *streamTrackingWriter) Flush() {
+	w.observe()
+	w.ResponseWriter.Flush()
+}
@@ -5,6 +5,7 @@ package middleware
 
 import (
 	"bytes"
+	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -18,6 +19,7 @@ type RequestInfo struct {
 	Method  string              // Method is the HTTP method (e.g., GET, POST).
 	Headers map[string][]string // Headers contains the request headers.
 	Body    []byte              // Body is the raw request body.
+	Sampled bool                // Sampled is whether the request is logged even if it succeeds.
 }
 
 // ResponseWriterWrapper wraps the standard gin.ResponseWriter to intercept and log response data.
@@ -98,8 +100,9 @@ func (w *ResponseWriterWrapper) WriteHeader(statusCode int) {
 	contentType := w.ResponseWriter.Header().Get("Content-Type")
 	w.isStreaming = w.detectStreaming(contentType)
 
-	// If streaming, initialize streaming log writer
-	if w.isStreaming && w.logger.IsEnabled() {
+	// If streaming, initialize streaming log writer. A stream outside the sample is only
+	// logged when it fails before it starts.
+	if w.isStreaming && w.logger.IsEnabled() && (w.requestInfo.Sampled || statusCode >= http.StatusBadRequest) {
 		streamWriter, err := w.logger.LogStreamingRequest(
 			w.requestInfo.URL,
 			w.requestInfo.Method,
@@ -267,6 +270,11 @@ func (w *ResponseWriterWrapper) Finalize(c *gin.Context) error {
 			}
 		}
 
+		// Requests outside the sample are only logged when they failed
+		if !w.requestInfo.Sampled && finalStatusCode < http.StatusBadRequest && len(slicesAPIResponseError) == 0 {
+			return nil
+		}
+
 		// Log complete non-streaming response
 		return w.logger.LogRequest(
 			w.requestInfo.URL,
@@ -8,10 +8,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/luispater/CLIProxyAPI/v5/internal/api/handlers"
@@ -24,6 +26,7 @@ import (
 	"github.com/luispater/CLIProxyAPI/v5/internal/config"
 	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
 	"github.com/luispater/CLIProxyAPI/v5/internal/logging"
+	"github.com/luispater/CLIProxyAPI/v5/internal/metrics"
 	"github.com/luispater/CLIProxyAPI/v5/internal/util"
 	log "github.com/sirupsen/logrus"
 )
@@ -37,6 +40,12 @@ type Server struct {
 	// server is the underlying HTTP server.
 	server *http.Server
 
+	// metricsServer serves the Prometheus metrics on metrics.listen, if configured.
+	metricsServer *http.Server
+
+	// socketPath is the Unix socket the server listens on, if listen-socket is configured.
+	socketPath string
+
 	// handlers contains the API handlers for processing requests.
 	handlers *handlers.BaseAPIHandler
 
@@ -46,6 +55,21 @@ type Server struct {
 	// requestLogger is the request logger instance for dynamic configuration updates.
 	requestLogger *logging.FileRequestLogger
 
+	// loadShedder rejects new API requests with 503 when the server is overloaded.
+	loadShedder *middleware.LoadShedder
+
+	// rateLimiter rejects API requests with 429 beyond the global rate limit.
+	rateLimiter *middleware.GlobalRateLimiter
+
+	// cors applies the configured cross-origin policy to all responses.
+	cors *middleware.CORS
+
+	// capture records API requests to replay files in debug mode.
+	capture *middleware.RequestCapture
+
+	// dedup shares one upstream response between identical API requests.
+	dedup *middleware.RequestDedup
+
 	// configFilePath is the absolute path to the YAML config file for persistence.
 	configFilePath string
 
@@ -72,15 +96,18 @@ func NewServer(cfg *config.Config, cliClients []interfaces.Client, configFilePat
 	engine := gin.New()
 
 	// Add middleware
-	engine.Use(gin.Logger())
+	engine.Use(middleware.RequestIDMiddleware())
+	engine.Use(gin.LoggerWithFormatter(accessLogFormatter))
 	engine.Use(gin.Recovery())
 
 	// Add request logging middleware (positioned after recovery, before auth)
 	// Resolve logs directory relative to the configuration file directory.
 	requestLogger := logging.NewFileRequestLogger(cfg.RequestLog, "logs", filepath.Dir(configFilePath))
+	requestLogger.SetSampleRate(cfg.RequestLogSampleRate)
 	engine.Use(middleware.RequestLoggingMiddleware(requestLogger))
 
-	engine.Use(corsMiddleware())
+	cors := middleware.NewCORS(cfg.CORS)
+	engine.Use(cors.Middleware())
 
 	// Create server instance
 	s := &Server{
@@ -88,10 +115,17 @@ func NewServer(cfg *config.Config, cliClients []interfaces.Client, configFilePat
 		handlers:       handlers.NewBaseAPIHandlers(cliClients, cfg),
 		cfg:            cfg,
 		requestLogger:  requestLogger,
+		loadShedder:    middleware.NewLoadShedder(cfg.Overload.MaxActiveRequests, cfg.Overload.RetryAfterSeconds),
+		rateLimiter:    middleware.NewGlobalRateLimiter(cfg.GlobalRateLimit),
+		cors:           cors,
+		capture:        middleware.NewRequestCapture(cfg, filepath.Dir(configFilePath)),
+		dedup:          middleware.NewRequestDedup(cfg.RequestDedup),
 		configFilePath: configFilePath,
 	}
+	s.handlers.LoadShedder = s.loadShedder
 	// Initialize management handler
 	s.mgmt = managementHandlers.NewHandler(cfg, configFilePath)
+	s.mgmt.SetClients(cliClients)
 
 	// Setup routes
 	s.setupRoutes()
@@ -101,10 +135,46 @@ func NewServer(cfg *config.Config, cliClients []interfaces.Client, configFilePat
 		Addr:    fmt.Sprintf(":%d", cfg.Port),
 		Handler: engine,
 	}
+	if cfg.Metrics.Listen != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/metrics", prometheusMetrics)
+		s.metricsServer = &http.Server{Addr: cfg.Metrics.Listen, Handler: mux}
+	}
 
 	return s
 }
 
+// listenUnixSocket listens on a Unix socket that only the owner of the process can connect
+// to. A socket left behind by a previous run is replaced; any other file at the path is not.
+func listenUnixSocket(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err = os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(path, 0o600); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// prometheusMetrics writes all metrics in the Prometheus text exposition format.
+func prometheusMetrics(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", metrics.PrometheusContentType)
+	if err := metrics.WritePrometheus(w, metrics.Snapshot()); err != nil {
+		log.Debugf("Failed to write metrics: %v", err)
+	}
+}
+
 // setupRoutes configures the API routes for the server.
 // It defines the endpoints and associates them with their respective handlers.
 func (s *Server) setupRoutes() {
@@ -116,18 +186,20 @@ func (s *Server) setupRoutes() {
 
 	// OpenAI compatible API routes
 	v1 := s.engine.Group("/v1")
-	v1.Use(AuthMiddleware(s.cfg))
+	v1.Use(middleware.RequestMetrics(), s.loadShedder.Middleware(), AuthMiddleware(s.cfg), s.capture.Middleware(), s.dedup.Middleware(), s.rateLimiter.Middleware())
 	{
 		v1.GET("/models", s.unifiedModelsHandler(openaiHandlers, claudeCodeHandlers))
 		v1.POST("/chat/completions", openaiHandlers.ChatCompletions)
+		v1.POST("/chat/completions/count_tokens", openaiHandlers.CountTokens)
 		v1.POST("/completions", openaiHandlers.Completions)
 		v1.POST("/messages", claudeCodeHandlers.ClaudeMessages)
 		v1.POST("/responses", openaiResponsesHandlers.Responses)
+		v1.POST("/generate", s.unifiedGenerateHandler(openaiHandlers, openaiResponsesHandlers, claudeCodeHandlers, geminiHandlers))
 	}
 
 	// Gemini compatible API routes
 	v1beta := s.engine.Group("/v1beta")
-	v1beta.Use(AuthMiddleware(s.cfg))
+	v1beta.Use(middleware.RequestMetrics(), s.loadShedder.Middleware(), AuthMiddleware(s.cfg), s.capture.Middleware(), s.dedup.Middleware(), s.rateLimiter.Middleware())
 	{
 		v1beta.GET("/models", geminiHandlers.GeminiModels)
 		v1beta.POST("/models/:action", geminiHandlers.GeminiHandler)
@@ -143,10 +215,12 @@ func (s *Server) setupRoutes() {
 				"POST /v1/chat/completions",
 				"POST /v1/completions",
 				"GET /v1/models",
+				"GET /health",
 			},
 		})
 	})
-	s.engine.POST("/v1internal:method", geminiCLIHandlers.CLIHandler)
+	s.engine.GET("/health", s.handlers.Health)
+	s.engine.POST("/v1internal:method", middleware.RequestMetrics(), s.loadShedder.Middleware(), s.rateLimiter.Middleware(), geminiCLIHandlers.CLIHandler)
 
 	// OAuth callback endpoints (reuse main server port)
 	// These endpoints receive provider redirects and persist
@@ -264,7 +338,14 @@ func (s *Server) setupRoutes() {
 			mgmt.GET("/gemini-cli-auth-url", s.mgmt.RequestGeminiCLIToken)
 			mgmt.GET("/qwen-auth-url", s.mgmt.RequestQwenToken)
 			mgmt.GET("/get-auth-status", s.mgmt.GetAuthStatus)
+
+			mgmt.GET("/metrics", s.mgmt.GetMetrics)
+			mgmt.GET("/accounts", s.mgmt.GetAccounts)
 		}
+
+		// The admin page itself is static; the data it shows is loaded from the
+		// management endpoints above using the key entered by the operator.
+		s.engine.GET("/admin", s.mgmt.AdminMiddleware(), s.mgmt.GetAdminUI)
 	}
 }
 
@@ -293,9 +374,39 @@ func (s *Server) unifiedModelsHandler(openaiHandler *openai.OpenAIAPIHandler, cl
 // Returns:
 //   - error: An error if the server fails to start
 func (s *Server) Start() error {
-	log.Debugf("Starting API server on %s", s.server.Addr)
+	if s.metricsServer != nil {
+		go func() {
+			log.Infof("Serving Prometheus metrics on %s/metrics", s.metricsServer.Addr)
+			if err := s.metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Errorf("Failed to start metrics server: %v", err)
+			}
+		}()
+	}
+
+	if s.cfg.ListenSocket != "" {
+		listener, err := listenUnixSocket(s.cfg.ListenSocket)
+		if err != nil {
+			return fmt.Errorf("failed to listen on unix socket %s: %v", s.cfg.ListenSocket, err)
+		}
+		s.socketPath = s.cfg.ListenSocket
+		log.Infof("Serving API on unix socket %s", s.socketPath)
+
+		// With port 0 the server listens on the socket only.
+		if s.cfg.Port == 0 {
+			if err = s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return fmt.Errorf("failed to serve on unix socket: %v", err)
+			}
+			return nil
+		}
+		go func() {
+			if errServe := s.server.Serve(listener); errServe != nil && !errors.Is(errServe, http.ErrServerClosed) {
+				log.Errorf("Failed to serve on unix socket: %v", errServe)
+			}
+		}()
+	}
 
 	// Start the HTTP server.
+	log.Debugf("Starting API server on %s", s.server.Addr)
 	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return fmt.Errorf("failed to start HTTP server: %v", err)
 	}
@@ -303,6 +414,14 @@ func (s *Server) Start() error {
 	return nil
 }
 
+// Handler returns the HTTP handler of the server, for serving requests in-process.
+//
+// Returns:
+//   - http.Handler: The handler with all routes and middleware
+func (s *Server) Handler() http.Handler {
+	return s.engine
+}
+
 // Stop gracefully shuts down the API server without interrupting any
 // active connections.
 //
@@ -318,29 +437,47 @@ func (s *Server) Stop(ctx context.Context) error {
 	if err := s.server.Shutdown(ctx); err != nil {
 		return fmt.Errorf("failed to shutdown HTTP server: %v", err)
 	}
+	if s.socketPath != "" {
+		if err := os.Remove(s.socketPath); err != nil && !os.IsNotExist(err) {
+			log.Warnf("Failed to remove unix socket %s: %v", s.socketPath, err)
+		}
+	}
+	if s.metricsServer != nil {
+		if err := s.metricsServer.Shutdown(ctx); err != nil {
+			return fmt.Errorf("failed to shutdown metrics server: %v", err)
+		}
+	}
 
 	log.Debug("API server stopped")
 	return nil
 }
 
-// corsMiddleware returns a Gin middleware handler that adds CORS headers
-// to every response, allowing cross-origin requests.
+// accessLogFormatter formats access log lines like Gin's default logger, appending
+// the request ID and, when a streaming request recorded one, the time to first token.
+//
+// Parameters:
+//   - param: The log parameters provided by Gin
 //
 // Returns:
-//   - gin.HandlerFunc: The CORS middleware handler
-func corsMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "*")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(http.StatusNoContent)
-			return
-		}
-
-		c.Next()
+//   - string: The formatted log line
+func accessLogFormatter(param gin.LogFormatterParams) string {
+	var extra string
+	if requestID, ok := param.Keys[middleware.RequestIDKey].(string); ok {
+		extra = fmt.Sprintf(" | req %s", requestID)
+	}
+	if latency, ok := param.Keys["firstTokenLatency"].(time.Duration); ok {
+		extra += fmt.Sprintf(" | ttft %v", latency)
 	}
+	return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v%s\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		param.StatusCode,
+		param.Latency,
+		param.ClientIP,
+		param.Method,
+		param.Path,
+		extra,
+		param.ErrorMessage,
+	)
 }
 
 // UpdateClients updates the server's client list and configuration.
@@ -356,6 +493,10 @@ func (s *Server) UpdateClients(clients map[string]interfaces.Client, cfg *config
 		s.requestLogger.SetEnabled(cfg.RequestLog)
 		log.Debugf("request logging updated from %t to %t", s.cfg.RequestLog, cfg.RequestLog)
 	}
+	if s.requestLogger != nil && s.cfg.RequestLogSampleRate != cfg.RequestLogSampleRate {
+		s.requestLogger.SetSampleRate(cfg.RequestLogSampleRate)
+		log.Debugf("request log sample rate updated from %v to %v", s.cfg.RequestLogSampleRate, cfg.RequestLogSampleRate)
+	}
 
 	// Update log level dynamically when debug flag changes
 	if s.cfg.Debug != cfg.Debug {
@@ -363,10 +504,29 @@ func (s *Server) UpdateClients(clients map[string]interfaces.Client, cfg *config
 		log.Debugf("debug mode updated from %t to %t", s.cfg.Debug, cfg.Debug)
 	}
 
+	// Update load shedding limits
+	if s.cfg.Overload != cfg.Overload {
+		s.loadShedder.SetLimits(cfg.Overload.MaxActiveRequests, cfg.Overload.RetryAfterSeconds)
+		log.Debugf("overload limits updated: max-active-requests %d, retry-after-seconds %d", cfg.Overload.MaxActiveRequests, cfg.Overload.RetryAfterSeconds)
+	}
+
+	// Update the global rate limit
+	s.rateLimiter.SetConfig(cfg.GlobalRateLimit)
+
+	// Update the CORS policy
+	s.cors.SetConfig(cfg.CORS)
+
+	// Update request capture settings
+	s.capture.SetConfig(cfg)
+
+	// Update request deduplication settings
+	s.dedup.SetConfig(cfg.RequestDedup)
+
 	s.cfg = cfg
 	s.handlers.UpdateClients(clientSlice, cfg)
 	if s.mgmt != nil {
 		s.mgmt.SetConfig(cfg)
+		s.mgmt.SetClients(clientSlice)
 	}
 
 	// Count client types for detailed logging
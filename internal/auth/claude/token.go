@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/luispater/CLIProxyAPI/v5/internal/auth"
 	"github.com/luispater/CLIProxyAPI/v5/internal/misc"
 )
 
@@ -34,6 +35,9 @@ type ClaudeTokenStorage struct {
 	// Type indicates the authentication provider type, always "claude" for this storage.
 	Type string `json:"type"`
 
+	// SchemaVersion is the token file schema version, see auth.TokenSchemaVersion.
+	SchemaVersion int `json:"schema_version,omitempty"`
+
 	// Expire is the timestamp when the current access token expires.
 	Expire string `json:"expired"`
 }
@@ -50,6 +54,7 @@ type ClaudeTokenStorage struct {
 func (ts *ClaudeTokenStorage) SaveTokenToFile(authFilePath string) error {
 	misc.LogSavingCredentials(authFilePath)
 	ts.Type = "claude"
+	ts.SchemaVersion = auth.TokenSchemaVersion
 
 	// Create directory structure if it doesn't exist
 	if err := os.MkdirAll(filepath.Dir(authFilePath), 0700); err != nil {
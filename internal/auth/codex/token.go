@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/luispater/CLIProxyAPI/v5/internal/auth"
 	"github.com/luispater/CLIProxyAPI/v5/internal/misc"
 )
 
@@ -30,6 +31,8 @@ type CodexTokenStorage struct {
 	Email string `json:"email"`
 	// Type indicates the authentication provider type, always "codex" for this storage.
 	Type string `json:"type"`
+	// SchemaVersion is the token file schema version, see auth.TokenSchemaVersion.
+	SchemaVersion int `json:"schema_version,omitempty"`
 	// Expire is the timestamp when the current access token expires.
 	Expire string `json:"expired"`
 }
@@ -46,6 +49,7 @@ type CodexTokenStorage struct {
 func (ts *CodexTokenStorage) SaveTokenToFile(authFilePath string) error {
 	misc.LogSavingCredentials(authFilePath)
 	ts.Type = "codex"
+	ts.SchemaVersion = auth.TokenSchemaVersion
 	if err := os.MkdirAll(filepath.Dir(authFilePath), 0700); err != nil {
 		return fmt.Errorf("failed to create directory: %v", err)
 	}
@@ -65,6 +65,48 @@ func NewGeminiAuth() *GeminiAuth {
 //   - *http.Client: An HTTP client configured with authentication
 //   - error: An error if the client configuration fails, nil otherwise
 func (g *GeminiAuth) GetAuthenticatedClient(ctx context.Context, ts *GeminiTokenStorage, cfg *config.Config, noBrowser ...bool) (*http.Client, error) {
+	ctx = g.proxyContext(ctx, cfg)
+	conf := g.oauthConfig()
+
+	var token *oauth2.Token
+	var err error
+
+	// If no token is found in storage, initiate the web-based OAuth flow.
+	if ts.Token == nil {
+		log.Info("Could not load token from file, starting OAuth flow.")
+		token, err = g.getTokenFromWeb(ctx, conf, noBrowser...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get token from web: %w", err)
+		}
+		// After getting a new token, create a new token storage object with user info.
+		newTs, errCreateTokenStorage := g.createTokenStorage(ctx, conf, token, ts.ProjectID)
+		if errCreateTokenStorage != nil {
+			log.Errorf("Warning: failed to create token storage: %v", errCreateTokenStorage)
+			return nil, errCreateTokenStorage
+		}
+		*ts = *newTs
+	}
+
+	// Unmarshal the stored token into an oauth2.Token object.
+	tsToken, _ := json.Marshal(ts.Token)
+	if err = json.Unmarshal(tsToken, &token); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal token: %w", err)
+	}
+
+	// Return an HTTP client that automatically handles token refreshing.
+	return conf.Client(ctx, token), nil
+}
+
+// proxyContext returns a context carrying an HTTP client that routes OAuth2 traffic through
+// the configured proxy, if any.
+//
+// Parameters:
+//   - ctx: The parent context
+//   - cfg: The configuration containing proxy settings
+//
+// Returns:
+//   - context.Context: The context to use for OAuth2 requests
+func (g *GeminiAuth) proxyContext(ctx context.Context, cfg *config.Config) context.Context {
 	// Configure proxy settings for the HTTP client if a proxy URL is provided.
 	proxyURL, err := url.Parse(cfg.ProxyURL)
 	if err == nil {
@@ -93,42 +135,47 @@ func (g *GeminiAuth) GetAuthenticatedClient(ctx context.Context, ts *GeminiToken
 			ctx = context.WithValue(ctx, oauth2.HTTPClient, proxyClient)
 		}
 	}
+	return ctx
+}
 
-	// Configure the OAuth2 client.
-	conf := &oauth2.Config{
+// oauthConfig returns the OAuth2 configuration used by the Gemini CLI.
+func (g *GeminiAuth) oauthConfig() *oauth2.Config {
+	return &oauth2.Config{
 		ClientID:     geminiOauthClientID,
 		ClientSecret: geminiOauthClientSecret,
 		RedirectURL:  "http://localhost:8085/oauth2callback", // This will be used by the local server.
 		Scopes:       geminiOauthScopes,
 		Endpoint:     google.Endpoint,
 	}
+}
 
-	var token *oauth2.Token
-
-	// If no token is found in storage, initiate the web-based OAuth flow.
-	if ts.Token == nil {
-		log.Info("Could not load token from file, starting OAuth flow.")
-		token, err = g.getTokenFromWeb(ctx, conf, noBrowser...)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get token from web: %w", err)
-		}
-		// After getting a new token, create a new token storage object with user info.
-		newTs, errCreateTokenStorage := g.createTokenStorage(ctx, conf, token, ts.ProjectID)
-		if errCreateTokenStorage != nil {
-			log.Errorf("Warning: failed to create token storage: %v", errCreateTokenStorage)
-			return nil, errCreateTokenStorage
-		}
-		*ts = *newTs
+// RefreshToken forces a refresh of the stored access token using its refresh token, even if
+// the access token has not expired yet, and updates the token storage in place. Client
+// metadata stored alongside the token (client ID, scopes, etc.) is preserved.
+//
+// Parameters:
+//   - ctx: The context for the HTTP request
+//   - ts: The Gemini token storage to refresh
+//   - cfg: The configuration containing proxy settings
+//
+// Returns:
+//   - error: An error if the refresh fails, nil otherwise
+func (g *GeminiAuth) RefreshToken(ctx context.Context, ts *GeminiTokenStorage, cfg *config.Config) error {
+	var token oauth2.Token
+	tsToken, _ := json.Marshal(ts.Token)
+	if err := json.Unmarshal(tsToken, &token); err != nil {
+		return fmt.Errorf("failed to unmarshal token: %w", err)
+	}
+	if token.RefreshToken == "" {
+		return errors.New("token has no refresh token")
 	}
 
-	// Unmarshal the stored token into an oauth2.Token object.
-	tsToken, _ := json.Marshal(ts.Token)
-	if err = json.Unmarshal(tsToken, &token); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal token: %w", err)
+	newToken, err := g.oauthConfig().TokenSource(g.proxyContext(ctx, cfg), &oauth2.Token{RefreshToken: token.RefreshToken}).Token()
+	if err != nil {
+		return fmt.Errorf("failed to refresh token: %w", err)
 	}
 
-	// Return an HTTP client that automatically handles token refreshing.
-	return conf.Client(ctx, token), nil
+	return ts.SetToken(newToken)
 }
 
 // createTokenStorage creates a new GeminiTokenStorage object. It fetches the user's email
@@ -0,0 +1,63 @@
+package gemini
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	"golang.org/x/oauth2"
+)
+
+// roundTripFunc serves the token endpoint requests of a test.
+type roundTripFunc func(*http.Request) *http.Response
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req), nil
+}
+
+func TestRefreshTokenReplacesAccessTokenAndKeepsMetadata(t *testing.T) {
+	var refreshToken string
+	tokenEndpoint := &http.Client{Transport: roundTripFunc(func(req *http.Request) *http.Response {
+		_ = req.ParseForm()
+		refreshToken = req.PostForm.Get("refresh_token")
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"access_token":"fresh","token_type":"Bearer","expires_in":3600}`)),
+		}
+	})}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, tokenEndpoint)
+	ts := &GeminiTokenStorage{Token: map[string]any{
+		"access_token":  "still-valid",
+		"refresh_token": "refresh",
+		"expiry":        "2999-01-01T00:00:00Z",
+		"client_id":     "client",
+	}}
+
+	if err := NewGeminiAuth().RefreshToken(ctx, ts, &config.Config{}); err != nil {
+		t.Fatalf("RefreshToken() error = %v", err)
+	}
+	if refreshToken != "refresh" {
+		t.Errorf("refresh_token sent = %q, want %q", refreshToken, "refresh")
+	}
+	token := ts.Token.(map[string]any)
+	if token["access_token"] != "fresh" {
+		t.Errorf("access_token = %v, want fresh", token["access_token"])
+	}
+	if token["refresh_token"] != "refresh" {
+		t.Errorf("refresh_token = %v, want it kept", token["refresh_token"])
+	}
+	if token["client_id"] != "client" {
+		t.Errorf("client_id = %v, want it kept", token["client_id"])
+	}
+}
+
+func TestRefreshTokenRequiresRefreshToken(t *testing.T) {
+	ts := &GeminiTokenStorage{Token: map[string]any{"access_token": "token"}}
+	if err := NewGeminiAuth().RefreshToken(context.Background(), ts, &config.Config{}); err == nil {
+		t.Error("RefreshToken() error = nil, want an error without a refresh token")
+	}
+}
@@ -9,8 +9,10 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/luispater/CLIProxyAPI/v5/internal/auth"
 	"github.com/luispater/CLIProxyAPI/v5/internal/misc"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
 )
 
 // GeminiTokenStorage stores OAuth2 token information for Google Gemini API authentication.
@@ -23,6 +25,10 @@ type GeminiTokenStorage struct {
 	// ProjectID is the Google Cloud Project ID associated with this token.
 	ProjectID string `json:"project_id"`
 
+	// ProjectIDs optionally lists further Google Cloud Project IDs of the account. Requests
+	// rotate through ProjectID and these projects to spread load.
+	ProjectIDs []string `json:"project_ids,omitempty"`
+
 	// Email is the email address of the authenticated user.
 	Email string `json:"email"`
 
@@ -34,6 +40,9 @@ type GeminiTokenStorage struct {
 
 	// Type indicates the authentication provider type, always "gemini" for this storage.
 	Type string `json:"type"`
+
+	// SchemaVersion is the token file schema version, see auth.TokenSchemaVersion.
+	SchemaVersion int `json:"schema_version,omitempty"`
 }
 
 // SaveTokenToFile serializes the Gemini token storage to a JSON file.
@@ -48,6 +57,7 @@ type GeminiTokenStorage struct {
 func (ts *GeminiTokenStorage) SaveTokenToFile(authFilePath string) error {
 	misc.LogSavingCredentials(authFilePath)
 	ts.Type = "gemini"
+	ts.SchemaVersion = auth.TokenSchemaVersion
 	if err := os.MkdirAll(filepath.Dir(authFilePath), 0700); err != nil {
 		return fmt.Errorf("failed to create directory: %v", err)
 	}
@@ -67,3 +77,28 @@ func (ts *GeminiTokenStorage) SaveTokenToFile(authFilePath string) error {
 	}
 	return nil
 }
+
+// SetToken replaces the stored token with a refreshed one. Client metadata stored alongside
+// the token (client ID, scopes, etc.) is preserved.
+//
+// Parameters:
+//   - token: The refreshed OAuth2 token
+//
+// Returns:
+//   - error: An error if the token cannot be converted, nil otherwise
+func (ts *GeminiTokenStorage) SetToken(token *oauth2.Token) error {
+	var ifToken map[string]any
+	jsonData, _ := json.Marshal(token)
+	if err := json.Unmarshal(jsonData, &ifToken); err != nil {
+		return fmt.Errorf("failed to unmarshal token: %w", err)
+	}
+	if previous, ok := ts.Token.(map[string]any); ok {
+		for key, value := range previous {
+			if _, exists := ifToken[key]; !exists {
+				ifToken[key] = value
+			}
+		}
+	}
+	ts.Token = ifToken
+	return nil
+}
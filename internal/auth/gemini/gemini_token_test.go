@@ -0,0 +1,30 @@
+package gemini
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/auth"
+	"github.com/tidwall/gjson"
+)
+
+func TestSaveTokenToFileRecordsSchemaVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "user@example.com-p.json")
+	ts := &GeminiTokenStorage{Email: "user@example.com", ProjectID: "p", Token: map[string]any{"access_token": "a"}}
+	if err := ts.SaveTokenToFile(path); err != nil {
+		t.Fatalf("SaveTokenToFile() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := gjson.GetBytes(data, "schema_version").Int(); got != auth.TokenSchemaVersion {
+		t.Errorf("schema_version = %d, want %d", got, auth.TokenSchemaVersion)
+	}
+	// A saved file needs no migration.
+	if _, changed, errMigrate := auth.MigrateTokenData(data); errMigrate != nil || changed {
+		t.Errorf("MigrateTokenData() changed = %t, error = %v, want the saved file current", changed, errMigrate)
+	}
+}
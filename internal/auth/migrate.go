@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// TokenSchemaVersion is the schema version of the token files written by this version.
+// Every token storage records it in its schema_version field when it is saved.
+const TokenSchemaVersion = 1
+
+// tokenMigrations upgrade token files to the next schema version: tokenMigrations[v]
+// converts a file of version v to version v+1. Files written before versioning was
+// introduced have no schema_version and are version 0.
+var tokenMigrations = []func(data []byte) ([]byte, error){
+	migrateTokenV0,
+}
+
+// MigrateTokenData upgrades the contents of a token file to TokenSchemaVersion. Files of a
+// newer version than this one understands are returned unchanged.
+//
+// Parameters:
+//   - data: The contents of the token file
+//
+// Returns:
+//   - []byte: The upgraded contents
+//   - bool: Whether the contents were changed
+//   - error: An error if a migration failed
+func MigrateTokenData(data []byte) ([]byte, bool, error) {
+	version := int(gjson.GetBytes(data, "schema_version").Int())
+	if version >= TokenSchemaVersion || version < 0 {
+		return data, false, nil
+	}
+
+	var err error
+	for ; version < TokenSchemaVersion; version++ {
+		if data, err = tokenMigrations[version](data); err != nil {
+			return nil, false, fmt.Errorf("failed to migrate token from schema version %d: %w", version, err)
+		}
+		if data, err = sjson.SetBytes(data, "schema_version", version+1); err != nil {
+			return nil, false, fmt.Errorf("failed to migrate token from schema version %d: %w", version, err)
+		}
+	}
+	return data, true, nil
+}
+
+// MigrateTokenFile upgrades a token file loaded from disk to TokenSchemaVersion. If save is
+// true and the file needed a migration, the upgraded file is written back in place; a file
+// that cannot be rewritten is still loaded from the upgraded contents.
+//
+// Parameters:
+//   - path: The path of the token file
+//   - data: The contents the file was loaded with
+//   - save: Whether to write the upgraded file back to disk
+//
+// Returns:
+//   - []byte: The upgraded contents to load the token from
+func MigrateTokenFile(path string, data []byte, save bool) []byte {
+	migrated, changed, err := MigrateTokenData(data)
+	if err != nil {
+		log.Warnf("%s: %v", filepath.Base(path), err)
+		return data
+	}
+	if !changed {
+		return data
+	}
+	log.Debugf("migrated token file %s to schema version %d", filepath.Base(path), TokenSchemaVersion)
+	if !save {
+		return migrated
+	}
+
+	// The loaded contents may come from a cookie snapshot, so the file itself is
+	// migrated separately.
+	fileData, err := os.ReadFile(path)
+	if err != nil {
+		log.Warnf("failed to read token file %s for migration: %v", filepath.Base(path), err)
+		return migrated
+	}
+	fileData, changed, err = MigrateTokenData(fileData)
+	if err != nil || !changed {
+		return migrated
+	}
+	if err = writeFileAtomic(path, fileData); err != nil {
+		log.Warnf("failed to save migrated token file %s: %v", filepath.Base(path), err)
+		return migrated
+	}
+	log.Infof("upgraded token file %s to schema version %d", filepath.Base(path), TokenSchemaVersion)
+	return migrated
+}
+
+// migrateTokenV0 adds the type field to token files written before the provider type was
+// recorded, which the loaders require to pick the token storage.
+func migrateTokenV0(data []byte) ([]byte, error) {
+	if gjson.GetBytes(data, "type").String() != "" {
+		return data, nil
+	}
+	switch {
+	case gjson.GetBytes(data, "token").Exists() && gjson.GetBytes(data, "project_id").Exists():
+		return sjson.SetBytes(data, "type", "gemini")
+	case gjson.GetBytes(data, "secure_1psid").Exists():
+		return sjson.SetBytes(data, "type", "gemini-web")
+	}
+	return data, nil
+}
+
+// writeFileAtomic replaces a file through a temporary file in the same directory, keeping
+// its permissions.
+func writeFileAtomic(path string, data []byte) error {
+	mode := os.FileMode(0o600)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, mode); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestMigrateTokenData(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		wantChanged bool
+		wantType    string
+		wantVersion int64
+	}{
+		{name: "unversioned Gemini token", data: `{"token":{"access_token":"a"},"project_id":"p","email":"user@example.com"}`, wantChanged: true, wantType: "gemini", wantVersion: 1},
+		{name: "unversioned Gemini Web cookies", data: `{"secure_1psid":"s","secure_1psidts":"t"}`, wantChanged: true, wantType: "gemini-web", wantVersion: 1},
+		{name: "unversioned token with a type", data: `{"type":"claude","access_token":"a"}`, wantChanged: true, wantType: "claude", wantVersion: 1},
+		{name: "unversioned unknown token", data: `{"access_token":"a"}`, wantChanged: true, wantType: "", wantVersion: 1},
+		{name: "current version", data: `{"type":"qwen","schema_version":1}`, wantType: "qwen", wantVersion: 1},
+		{name: "newer version", data: `{"schema_version":7}`, wantVersion: 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed, err := MigrateTokenData([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("MigrateTokenData() error = %v", err)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("changed = %t, want %t", changed, tt.wantChanged)
+			}
+			if !tt.wantChanged && string(got) != tt.data {
+				t.Errorf("data = %s, want it unchanged", got)
+			}
+			if typ := gjson.GetBytes(got, "type").String(); typ != tt.wantType {
+				t.Errorf("type = %q, want %q", typ, tt.wantType)
+			}
+			if version := gjson.GetBytes(got, "schema_version").Int(); version != tt.wantVersion {
+				t.Errorf("schema_version = %d, want %d", version, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestMigrateTokenFile(t *testing.T) {
+	const old = `{"token":{"access_token":"a","refresh_token":"r"},"project_id":"p","email":"user@example.com"}`
+	tests := []struct {
+		name         string
+		save         bool
+		wantFileType string
+	}{
+		{name: "saved", save: true, wantFileType: "gemini"},
+		{name: "not saved", save: false, wantFileType: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "user@example.com-p.json")
+			if err := os.WriteFile(path, []byte(old), 0o640); err != nil {
+				t.Fatal(err)
+			}
+
+			loaded := MigrateTokenFile(path, []byte(old), tt.save)
+			if got := gjson.GetBytes(loaded, "type").String(); got != "gemini" {
+				t.Errorf("loaded type = %q, want %q", got, "gemini")
+			}
+			if got := gjson.GetBytes(loaded, "token.refresh_token").String(); got != "r" {
+				t.Errorf("loaded refresh_token = %q, want the existing fields kept", got)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := gjson.GetBytes(data, "type").String(); got != tt.wantFileType {
+				t.Errorf("file type = %q, want %q", got, tt.wantFileType)
+			}
+			if tt.save {
+				if got := gjson.GetBytes(data, "schema_version").Int(); got != TokenSchemaVersion {
+					t.Errorf("file schema_version = %d, want %d", got, TokenSchemaVersion)
+				}
+				info, errStat := os.Stat(path)
+				if errStat != nil {
+					t.Fatal(errStat)
+				}
+				if info.Mode().Perm() != 0o640 {
+					t.Errorf("file mode = %v, want the permissions kept", info.Mode().Perm())
+				}
+			}
+		})
+	}
+}
+
+func TestMigrateTokenFileMigratesFileSeparatelyFromSnapshot(t *testing.T) {
+	// The loaded contents carry fresher cookies than the file, which keeps its own values.
+	path := filepath.Join(t.TempDir(), "gemini-web-user.json")
+	if err := os.WriteFile(path, []byte(`{"secure_1psid":"s","secure_1psidts":"old"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := MigrateTokenFile(path, []byte(`{"secure_1psid":"s","secure_1psidts":"new"}`), true)
+	if got := gjson.GetBytes(loaded, "secure_1psidts").String(); got != "new" {
+		t.Errorf("loaded secure_1psidts = %q, want %q", got, "new")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := gjson.GetBytes(data, "secure_1psidts").String(); got != "old" {
+		t.Errorf("file secure_1psidts = %q, want %q", got, "old")
+	}
+	if got := gjson.GetBytes(data, "type").String(); got != "gemini-web" {
+		t.Errorf("file type = %q, want %q", got, "gemini-web")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/luispater/CLIProxyAPI/v5/internal/auth"
 	"github.com/luispater/CLIProxyAPI/v5/internal/misc"
 )
 
@@ -28,6 +29,8 @@ type QwenTokenStorage struct {
 	Email string `json:"email"`
 	// Type indicates the authentication provider type, always "qwen" for this storage.
 	Type string `json:"type"`
+	// SchemaVersion is the token file schema version, see auth.TokenSchemaVersion.
+	SchemaVersion int `json:"schema_version,omitempty"`
 	// Expire is the timestamp when the current access token expires.
 	Expire string `json:"expired"`
 }
@@ -44,6 +47,7 @@ type QwenTokenStorage struct {
 func (ts *QwenTokenStorage) SaveTokenToFile(authFilePath string) error {
 	misc.LogSavingCredentials(authFilePath)
 	ts.Type = "qwen"
+	ts.SchemaVersion = auth.TokenSchemaVersion
 	if err := os.MkdirAll(filepath.Dir(authFilePath), 0700); err != nil {
 		return fmt.Errorf("failed to create directory: %v", err)
 	}
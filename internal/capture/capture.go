@@ -0,0 +1,227 @@
+// Package capture records inbound API requests together with the upstream exchanges they
+// trigger, and replays recorded requests against a mock upstream. Captures turn reported
+// issues into reproducible regression cases.
+package capture
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContextKey is the Gin context key under which the Record of the current request is stored.
+const ContextKey = "capture"
+
+// redactedHeaders lists inbound headers that carry credentials and are not recorded.
+var redactedHeaders = []string{"Authorization", "X-Goog-Api-Key", "X-Api-Key", "Cookie"}
+
+// Inbound is a request received by the proxy.
+type Inbound struct {
+	Method string      `json:"method"`
+	Path   string      `json:"path"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body"`
+}
+
+// Exchange is a request sent upstream by a client and the response it received.
+type Exchange struct {
+	// Client is the type of the client that sent the request, for example "gemini-cli".
+	Client string `json:"client"`
+
+	Method       string `json:"method"`
+	URL          string `json:"url"`
+	RequestBody  string `json:"request_body"`
+	Status       int    `json:"status"`
+	ResponseBody string `json:"response_body"`
+}
+
+// Record holds everything needed to replay a request: the inbound request and the upstream
+// exchanges, in the order they were sent.
+type Record struct {
+	CapturedAt time.Time   `json:"captured_at"`
+	Inbound    Inbound     `json:"inbound"`
+	Upstream   []*Exchange `json:"upstream"`
+
+	mutex sync.Mutex
+}
+
+// NewRecord creates a record for an inbound request. Credential headers are removed.
+//
+// Parameters:
+//   - req: The inbound request
+//   - body: The request body
+//
+// Returns:
+//   - *Record: The new record
+func NewRecord(req *http.Request, body []byte) *Record {
+	header := req.Header.Clone()
+	for _, name := range redactedHeaders {
+		header.Del(name)
+	}
+	return &Record{
+		CapturedAt: time.Now(),
+		Inbound: Inbound{
+			Method: req.Method,
+			Path:   req.URL.RequestURI(),
+			Header: header,
+			Body:   string(body),
+		},
+	}
+}
+
+// AddExchange records an upstream request and wraps the response body so that it is
+// recorded as the caller reads it.
+//
+// Parameters:
+//   - clientType: The type of the client that sent the request
+//   - req: The upstream request
+//   - body: The upstream request body
+//   - resp: The upstream response
+//
+// Returns:
+//   - *http.Response: The response, with a recording body
+func (r *Record) AddExchange(clientType string, req *http.Request, body []byte, resp *http.Response) *http.Response {
+	exchange := &Exchange{
+		Client:      clientType,
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		RequestBody: string(body),
+		Status:      resp.StatusCode,
+	}
+	r.mutex.Lock()
+	r.Upstream = append(r.Upstream, exchange)
+	r.mutex.Unlock()
+
+	resp.Body = &recordingBody{ReadCloser: resp.Body, record: r, exchange: exchange}
+	return resp
+}
+
+// Save writes the record as indented JSON to a new file in dir.
+//
+// Parameters:
+//   - dir: The directory to write to; it is created if needed
+//   - name: The file name without extension
+//
+// Returns:
+//   - string: The path of the written file
+//   - error: An error if the file could not be written
+func (r *Record) Save(dir, name string) (string, error) {
+	r.mutex.Lock()
+	data, err := json.MarshalIndent(r, "", "  ")
+	r.mutex.Unlock()
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal capture: %w", err)
+	}
+	if err = os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create capture directory: %w", err)
+	}
+	path := filepath.Join(dir, name+".json")
+	if err = os.WriteFile(path, data, 0o600); err != nil {
+		return "", fmt.Errorf("failed to write capture: %w", err)
+	}
+	return path, nil
+}
+
+// Load reads a record written by Save.
+//
+// Parameters:
+//   - path: The path of the capture file
+//
+// Returns:
+//   - *Record: The loaded record
+//   - error: An error if the file could not be read or parsed
+func Load(path string) (*Record, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read capture: %w", err)
+	}
+	var record Record
+	if err = json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to parse capture: %w", err)
+	}
+	return &record, nil
+}
+
+// recordingBody appends everything read from an upstream response body to its exchange.
+type recordingBody struct {
+	io.ReadCloser
+	record   *Record
+	exchange *Exchange
+}
+
+// Read reads from the response body and records the data.
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.record.mutex.Lock()
+		b.exchange.ResponseBody += string(p[:n])
+		b.record.mutex.Unlock()
+	}
+	return n, err
+}
+
+// ReplayTransport is a mock upstream that answers requests with recorded responses, in the
+// order they were recorded, regardless of the request URL.
+type ReplayTransport struct {
+	mutex     sync.Mutex
+	exchanges []*Exchange
+	next      int
+}
+
+// NewReplayTransport creates a mock upstream seeded with recorded exchanges.
+//
+// Parameters:
+//   - exchanges: The recorded upstream exchanges
+//
+// Returns:
+//   - *ReplayTransport: The mock upstream transport
+func NewReplayTransport(exchanges []*Exchange) *ReplayTransport {
+	return &ReplayTransport{exchanges: exchanges}
+}
+
+// RoundTrip returns the next recorded response. Once all recorded responses have been
+// used, it answers with 502.
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		_, _ = io.Copy(io.Discard, req.Body)
+		_ = req.Body.Close()
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	status, body := http.StatusBadGateway, `{"error":{"code":502,"message":"no recorded upstream response left","status":"UNAVAILABLE"}}`
+	if t.next < len(t.exchanges) {
+		exchange := t.exchanges[t.next]
+		status, body = exchange.Status, exchange.ResponseBody
+		t.next++
+	}
+	return &http.Response{
+		StatusCode: status,
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Header:     http.Header{"Content-Type": []string{contentType(body)}},
+		Body:       io.NopCloser(bytes.NewReader([]byte(body))),
+		Request:    req,
+	}, nil
+}
+
+// Remaining returns the number of recorded responses that have not been used.
+func (t *ReplayTransport) Remaining() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return len(t.exchanges) - t.next
+}
+
+// contentType guesses the content type of a recorded response body.
+func contentType(body string) string {
+	if strings.HasPrefix(strings.TrimSpace(body), "data:") {
+		return "text/event-stream"
+	}
+	return "application/json"
+}
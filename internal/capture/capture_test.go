@@ -0,0 +1,83 @@
+package capture
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecordSaveLoadAndReplay(t *testing.T) {
+	inbound := httptest.NewRequest(http.MethodPost, "/v1beta/models/gemini-2.5-flash:generateContent?alt=sse", strings.NewReader(`{"contents":[]}`))
+	inbound.Header.Set("Authorization", "Bearer secret")
+	inbound.Header.Set("X-Goog-Api-Key", "secret")
+	inbound.Header.Set("Content-Type", "application/json")
+	record := NewRecord(inbound, []byte(`{"contents":[]}`))
+
+	responses := []struct {
+		status int
+		body   string
+	}{
+		{status: http.StatusTooManyRequests, body: `{"error":{"code":429}}`},
+		{status: http.StatusOK, body: "data: {\"candidates\":[]}\n\n"},
+	}
+	for _, response := range responses {
+		upstream := httptest.NewRequest(http.MethodPost, "https://upstream.example/v1:generateContent", nil)
+		resp := record.AddExchange("gemini", upstream, []byte(`{"request":{}}`), &http.Response{StatusCode: response.status, Body: io.NopCloser(strings.NewReader(response.body))})
+		// The response body is recorded as the client reads it.
+		if body, _ := io.ReadAll(resp.Body); string(body) != response.body {
+			t.Fatalf("response body = %q, want %q", body, response.body)
+		}
+	}
+
+	path, err := record.Save(t.TempDir(), "capture")
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if loaded.Inbound.Path != "/v1beta/models/gemini-2.5-flash:generateContent?alt=sse" || loaded.Inbound.Body != `{"contents":[]}` {
+		t.Errorf("inbound = %+v, want the captured request", loaded.Inbound)
+	}
+	for _, name := range []string{"Authorization", "X-Goog-Api-Key"} {
+		if loaded.Inbound.Header.Get(name) != "" {
+			t.Errorf("header %s was recorded, want it redacted", name)
+		}
+	}
+	if loaded.Inbound.Header.Get("Content-Type") != "application/json" {
+		t.Error("Content-Type header missing, want non-credential headers recorded")
+	}
+
+	transport := NewReplayTransport(loaded.Upstream)
+	tests := []struct {
+		status      int
+		body        string
+		contentType string
+	}{
+		{status: http.StatusTooManyRequests, body: responses[0].body, contentType: "application/json"},
+		{status: http.StatusOK, body: responses[1].body, contentType: "text/event-stream"},
+		{status: http.StatusBadGateway, contentType: "application/json"},
+	}
+	for i, tt := range tests {
+		resp, errRoundTrip := transport.RoundTrip(httptest.NewRequest(http.MethodPost, "https://other.example/", strings.NewReader(`{}`)))
+		if errRoundTrip != nil {
+			t.Fatalf("RoundTrip() error = %v", errRoundTrip)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != tt.status {
+			t.Errorf("response %d status = %d, want %d", i, resp.StatusCode, tt.status)
+		}
+		if tt.body != "" && string(body) != tt.body {
+			t.Errorf("response %d body = %q, want %q", i, body, tt.body)
+		}
+		if got := resp.Header.Get("Content-Type"); got != tt.contentType {
+			t.Errorf("response %d Content-Type = %q, want %q", i, got, tt.contentType)
+		}
+	}
+	if transport.Remaining() != 0 {
+		t.Errorf("Remaining() = %d, want 0", transport.Remaining())
+	}
+}
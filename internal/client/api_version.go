@@ -0,0 +1,116 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+var (
+	// knownAPIVersions lists the API versions tried, in order, when a backend no longer
+	// serves the configured version.
+	knownAPIVersions = map[string][]string{
+		GEMINICLI: {apiVersion, "v1"},
+		GEMINI:    {glAPIVersion, "v1", "v1alpha"},
+	}
+
+	detectedMutex       sync.RWMutex
+	detectedAPIVersions = make(map[string]string)
+)
+
+// resolveAPIVersion returns the API version to use for a backend: a version detected at
+// runtime, then the api-versions setting, then the built-in default.
+func (c *ClientBase) resolveAPIVersion(backend string) string {
+	detectedMutex.RLock()
+	version, ok := detectedAPIVersions[backend]
+	detectedMutex.RUnlock()
+	if ok {
+		return version
+	}
+
+	switch backend {
+	case GEMINICLI:
+		if c.cfg.APIVersions.GeminiCLI != "" {
+			return c.cfg.APIVersions.GeminiCLI
+		}
+	case GEMINI:
+		if c.cfg.APIVersions.Gemini != "" {
+			return c.cfg.APIVersions.Gemini
+		}
+	}
+	return knownAPIVersions[backend][0]
+}
+
+// retryAlternateAPIVersions retries a request that failed with a version-related 404
+// against the other known API versions of the backend. The first version that is served
+// is used for all later requests to the backend.
+//
+// Parameters:
+//   - ctx: The context for the request
+//   - backend: The backend the request was sent to (GEMINICLI or GEMINI)
+//   - req: The request that was sent
+//   - body: The request body
+//   - resp: The response to the request
+//
+// Returns:
+//   - *http.Response: The response from the first version that is served, or the original response
+//   - error: An error if a retry could not be sent
+func (c *ClientBase) retryAlternateAPIVersions(ctx context.Context, backend string, req *http.Request, body []byte, resp *http.Response) (*http.Response, error) {
+	if !c.cfg.APIVersions.Detect || resp.StatusCode != http.StatusNotFound {
+		return resp, nil
+	}
+	data, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	if !isVersionNotFound(data) {
+		return resp, nil
+	}
+
+	current := c.resolveAPIVersion(backend)
+	for _, version := range knownAPIVersions[backend] {
+		if version == current {
+			continue
+		}
+		if !c.takeAttempt(ctx) {
+			break
+		}
+		retryReq := req.Clone(ctx)
+		retryReq.URL.Path = strings.Replace(req.URL.Path, "/"+current, "/"+version, 1)
+		retryReq.Body = io.NopCloser(bytes.NewReader(body))
+		retryResp, err := c.httpClient.Do(retryReq)
+		if err != nil {
+			return nil, err
+		}
+		if retryResp.StatusCode == http.StatusNotFound {
+			retryData, _ := io.ReadAll(retryResp.Body)
+			_ = retryResp.Body.Close()
+			if isVersionNotFound(retryData) {
+				continue
+			}
+			retryResp.Body = io.NopCloser(bytes.NewReader(retryData))
+		}
+
+		detectedMutex.Lock()
+		detectedAPIVersions[backend] = version
+		detectedMutex.Unlock()
+		log.Warnf("%s API version %s is not served, switched to %s", backend, current, version)
+		return retryResp, nil
+	}
+
+	log.Debugf("%s API version %s is not served and no known alternative answered", backend, current)
+	return resp, nil
+}
+
+// isVersionNotFound reports whether a 404 body indicates an unknown path rather than an
+// unknown model. Google answers unknown paths with an HTML page, while API errors such as
+// a missing model are JSON.
+func isVersionNotFound(data []byte) bool {
+	return !gjson.ValidBytes(bytes.TrimSpace(data))
+}
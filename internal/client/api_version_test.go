@@ -0,0 +1,93 @@
+package client
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+)
+
+func TestAPIVersionDetection(t *testing.T) {
+	const notFoundPage = `<!DOCTYPE html><html><body>Error 404 (Not Found)</body></html>`
+	tests := []struct {
+		name         string
+		versions     config.APIVersions
+		served       string
+		notFound     string
+		wantStatus   int
+		wantVersions []string
+		wantNext     string
+	}{
+		{
+			name:         "detect switches to a served version",
+			versions:     config.APIVersions{Detect: true},
+			served:       "v1",
+			notFound:     notFoundPage,
+			wantStatus:   http.StatusOK,
+			wantVersions: []string{"v1beta", "v1"},
+			wantNext:     "v1",
+		},
+		{
+			name:         "detection disabled",
+			served:       "v1",
+			notFound:     notFoundPage,
+			wantStatus:   http.StatusNotFound,
+			wantVersions: []string{"v1beta"},
+			wantNext:     "v1beta",
+		},
+		{
+			name:         "missing model is not a version error",
+			versions:     config.APIVersions{Detect: true},
+			served:       "v1",
+			notFound:     `{"error":{"code":404,"message":"models/unknown is not found","status":"NOT_FOUND"}}`,
+			wantStatus:   http.StatusNotFound,
+			wantVersions: []string{"v1beta"},
+			wantNext:     "v1beta",
+		},
+		{
+			name:         "configured version",
+			versions:     config.APIVersions{Gemini: "v1alpha"},
+			served:       "v1alpha",
+			wantStatus:   http.StatusOK,
+			wantVersions: []string{"v1alpha"},
+			wantNext:     "v1alpha",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(func() {
+				detectedMutex.Lock()
+				delete(detectedAPIVersions, GEMINI)
+				detectedMutex.Unlock()
+			})
+
+			versions := make([]string, 0)
+			c := NewGeminiClient(&http.Client{Transport: roundTripFunc(func(req *http.Request) *http.Response {
+				version := strings.Split(strings.TrimPrefix(req.URL.Path, "/"), "/")[0]
+				versions = append(versions, version)
+				if version != tt.served {
+					return cannedResponse(http.StatusNotFound, nil, tt.notFound)
+				}
+				return cannedResponse(http.StatusOK, nil, `{"totalTokens":1}`)
+			})}, &config.Config{APIVersions: tt.versions}, "key")
+
+			_, err := c.CountTokens(testRequestContext(GEMINI, false), "gemini-2.5-flash", []byte(`{"contents":[]}`))
+			status := http.StatusOK
+			if err != nil {
+				status = err.StatusCode
+			}
+			if status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if !slices.Equal(versions, tt.wantVersions) {
+				t.Errorf("requested versions = %v, want %v", versions, tt.wantVersions)
+			}
+			if got := c.resolveAPIVersion(GEMINI); got != tt.wantNext {
+				t.Errorf("version of later requests = %q, want %q", got, tt.wantNext)
+			}
+		})
+	}
+}
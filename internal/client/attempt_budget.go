@@ -0,0 +1,122 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	log "github.com/sirupsen/logrus"
+)
+
+// attemptBudgetKey is the Gin context key under which the attempt budget of a request is stored.
+const attemptBudgetKey = "attemptBudget"
+
+// errAttemptBudgetExhausted is returned instead of sending an upstream request once the
+// request has used max-upstream-attempts upstream calls.
+var errAttemptBudgetExhausted = errors.New("upstream attempt budget exhausted")
+
+// attemptBudget counts the upstream calls of an inbound request across all fallback
+// mechanisms (transient retries, preview model and project switches, and client switches),
+// and remembers the last upstream error.
+type attemptBudget struct {
+	mutex      sync.Mutex
+	used       int
+	lastStatus int
+	lastBody   []byte
+}
+
+// requestAttemptBudget returns the attempt budget of the request, creating it on first use,
+// or nil if the context carries no inbound request.
+func requestAttemptBudget(ctx context.Context) *attemptBudget {
+	ginContext, ok := ctx.Value("gin").(*gin.Context)
+	if !ok {
+		return nil
+	}
+	if value, exists := ginContext.Get(attemptBudgetKey); exists {
+		if budget, isBudget := value.(*attemptBudget); isBudget {
+			return budget
+		}
+	}
+	budget := &attemptBudget{}
+	ginContext.Set(attemptBudgetKey, budget)
+	return budget
+}
+
+// takeAttempt reserves an upstream call for the request. It reports false once the request
+// has used max-upstream-attempts calls. Requests without a limit are never refused.
+func (c *ClientBase) takeAttempt(ctx context.Context) bool {
+	limit := c.cfg.MaxUpstreamAttempts
+	if limit <= 0 {
+		return true
+	}
+	budget := requestAttemptBudget(ctx)
+	if budget == nil {
+		return true
+	}
+	budget.mutex.Lock()
+	defer budget.mutex.Unlock()
+	if budget.used >= limit {
+		log.Debugf("Request %s used all %d upstream attempts", RequestID(ctx), limit)
+		return false
+	}
+	budget.used++
+	return true
+}
+
+// recordUpstreamError remembers a failed upstream response as the last error of the request,
+// so that it can be returned once the attempt budget is exhausted. The response body is read
+// and replaced with a copy.
+func recordUpstreamError(ctx context.Context, resp *http.Response) {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return
+	}
+	budget := requestAttemptBudget(ctx)
+	if budget == nil {
+		return
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	budget.mutex.Lock()
+	budget.lastStatus, budget.lastBody = resp.StatusCode, body
+	budget.mutex.Unlock()
+}
+
+// AttemptBudgetExhausted returns the last upstream error of a request that has used all of
+// its max-upstream-attempts upstream calls, or nil if the request may still call upstream.
+//
+// Parameters:
+//   - c: The Gin context of the current request
+//   - cfgLimit: The max-upstream-attempts setting
+//
+// Returns:
+//   - *interfaces.ErrorMessage: The last upstream error, or nil
+func AttemptBudgetExhausted(c *gin.Context, cfgLimit int) *interfaces.ErrorMessage {
+	if cfgLimit <= 0 {
+		return nil
+	}
+	value, exists := c.Get(attemptBudgetKey)
+	if !exists {
+		return nil
+	}
+	budget, ok := value.(*attemptBudget)
+	if !ok {
+		return nil
+	}
+	budget.mutex.Lock()
+	defer budget.mutex.Unlock()
+	if budget.used < cfgLimit {
+		return nil
+	}
+	if budget.lastStatus == 0 {
+		return &interfaces.ErrorMessage{StatusCode: http.StatusServiceUnavailable, Error: fmt.Errorf(`{"error":{"code":503,"message":"%s","status":"UNAVAILABLE"}}`, errAttemptBudgetExhausted)}
+	}
+	return &interfaces.ErrorMessage{StatusCode: budget.lastStatus, Error: fmt.Errorf("%s", budget.lastBody)}
+}
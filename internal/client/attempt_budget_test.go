@@ -0,0 +1,76 @@
+package client
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+)
+
+func TestAttemptBudgetBoundsUpstreamCalls(t *testing.T) {
+	tests := []struct {
+		name             string
+		maxAttempts      int
+		sameAccountRetry int
+		sends            int
+		wantCalls        int32
+		wantExhausted    bool
+	}{
+		{name: "no limit", sameAccountRetry: 1, sends: 2, wantCalls: 4},
+		{name: "within the limit", maxAttempts: 5, sameAccountRetry: 1, sends: 2, wantCalls: 4},
+		{name: "transient retries", maxAttempts: 1, sameAccountRetry: 1, sends: 1, wantCalls: 1, wantExhausted: true},
+		// A second send stands for any fallback sending the same request again.
+		{name: "shared across sends", maxAttempts: 3, sameAccountRetry: 1, sends: 2, wantCalls: 3, wantExhausted: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			cfg := &config.Config{MaxUpstreamAttempts: tt.maxAttempts, SameAccountRetry: tt.sameAccountRetry}
+			c := NewGeminiClient(&http.Client{Transport: roundTripFunc(func(*http.Request) *http.Response {
+				calls.Add(1)
+				return cannedResponse(http.StatusServiceUnavailable, nil, `{"error":{"code":503,"message":"overloaded","status":"UNAVAILABLE"}}`)
+			})}, cfg, "test-key-attempt-budget")
+
+			ctx := testRequestContext(GEMINI, false)
+			for i := 0; i < tt.sends; i++ {
+				if _, err := c.CountTokens(ctx, "gemini-2.5-flash", []byte(`{"contents":[]}`)); err == nil {
+					t.Fatal("CountTokens() error = nil, want an error")
+				}
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("upstream calls = %d, want %d", got, tt.wantCalls)
+			}
+
+			errBudget := AttemptBudgetExhausted(ctx.Value("gin").(*gin.Context), tt.maxAttempts)
+			if (errBudget != nil) != tt.wantExhausted {
+				t.Fatalf("AttemptBudgetExhausted() = %v, want exhausted %t", errBudget, tt.wantExhausted)
+			}
+			if errBudget == nil {
+				return
+			}
+			// The last upstream error is returned.
+			if errBudget.StatusCode != http.StatusServiceUnavailable || !strings.Contains(errBudget.Error.Error(), "overloaded") {
+				t.Errorf("AttemptBudgetExhausted() = %d %v, want the last upstream error", errBudget.StatusCode, errBudget.Error)
+			}
+		})
+	}
+}
+
+func TestAttemptBudgetExhaustedWithoutUpstreamError(t *testing.T) {
+	ctx := testRequestContext(GEMINI, false)
+	c := &ClientBase{cfg: &config.Config{MaxUpstreamAttempts: 1}}
+	if !c.takeAttempt(ctx) {
+		t.Fatal("takeAttempt() = false, want the first attempt granted")
+	}
+	if c.takeAttempt(ctx) {
+		t.Fatal("takeAttempt() = true, want the second attempt refused")
+	}
+	errBudget := AttemptBudgetExhausted(ctx.Value("gin").(*gin.Context), 1)
+	if errBudget == nil || errBudget.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("AttemptBudgetExhausted() = %v, want a 503", errBudget)
+	}
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// retryBaseDelay is the backoff before the first retry of a transient upstream error.
+	retryBaseDelay = 500 * time.Millisecond
+
+	// retryMaxDelay caps the backoff between retries.
+	retryMaxDelay = 8 * time.Second
+)
+
+// doWithRetry sends an upstream request and retries it on the same account when the upstream
+// answers with a transient 500, 502, 503, or 504, up to same-account-retry times, with exponential
+// backoff and jitter. Only the status is inspected, so a streaming response is retried before
+// any of its body is read. Every call counts against the request's max-upstream-attempts and
+// is aborted after request-timeout-seconds (see sendWithTimeout).
+//
+// Parameters:
+//   - ctx: The context for the request
+//   - req: The request to send
+//   - body: The request body, resent with each retry
+//
+// Returns:
+//   - *http.Response: The first response that is not a transient error, or the last response
+//   - error: An error if the request could not be sent
+func (c *ClientBase) doWithRetry(ctx context.Context, req *http.Request, body []byte) (*http.Response, error) {
+	if !c.takeAttempt(ctx) {
+		return nil, errAttemptBudgetExhausted
+	}
+	resp, err := c.sendWithTimeout(req)
+	for attempt := 1; err == nil && attempt <= c.cfg.SameAccountRetry && isTransientStatus(resp.StatusCode) && c.takeAttempt(ctx); attempt++ {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+
+		delay := min(retryBaseDelay<<(attempt-1), retryMaxDelay)
+		delay = delay/2 + rand.N(delay/2+1)
+		log.Debugf("Upstream returned %d, retry %d of %d in %s (request %s)", resp.StatusCode, attempt, c.cfg.SameAccountRetry, delay.Round(time.Millisecond), RequestID(ctx))
+		if errSleep := sleepContext(ctx, delay); errSleep != nil {
+			return nil, errSleep
+		}
+
+		retryReq := req.Clone(ctx)
+		retryReq.Body = io.NopCloser(bytes.NewReader(body))
+		resp, err = c.sendWithTimeout(retryReq)
+	}
+	if err == nil {
+		recordUpstreamError(ctx, resp)
+	}
+	return resp, err
+}
+
+// isTransientStatus reports whether an upstream status is a transient server error worth retrying.
+func isTransientStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
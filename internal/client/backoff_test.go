@@ -0,0 +1,40 @@
+package client
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+)
+
+func TestTransientErrorsAreRetriedSameAccountRetryTimes(t *testing.T) {
+	tests := []struct {
+		name             string
+		sameAccountRetry int
+		wantCalls        int32
+	}{
+		{name: "disabled", sameAccountRetry: 0, wantCalls: 1},
+		{name: "once", sameAccountRetry: 1, wantCalls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			cfg := &config.Config{RequestRetry: 3, SameAccountRetry: tt.sameAccountRetry}
+			c := NewGeminiClient(&http.Client{Transport: roundTripFunc(func(*http.Request) *http.Response {
+				calls.Add(1)
+				return cannedResponse(http.StatusServiceUnavailable, nil, `{"error":{"code":503,"status":"UNAVAILABLE"}}`)
+			})}, cfg, "test-key-same-account-retry")
+
+			_, err := c.CountTokens(testRequestContext(GEMINI, false), "gemini-2.5-flash", []byte(`{"contents":[]}`))
+			if err == nil || err.StatusCode != http.StatusServiceUnavailable {
+				t.Fatalf("CountTokens() error = %v, want a 503", err)
+			}
+			// request-retry does not apply on the same account; it moves the request to another one.
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("upstream calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -246,11 +246,8 @@ func (c *ClaudeClient) SendRawMessageStream(ctx context.Context, modelName strin
 		rawJSON, _ = sjson.SetBytes(rawJSON, "stream", true)
 		var stream io.ReadCloser
 
-		if c.IsModelQuotaExceeded(modelName) {
-			errChan <- &interfaces.ErrorMessage{
-				StatusCode: 429,
-				Error:      fmt.Errorf(`{"error":{"code":429,"message":"All the models of '%s' are quota exceeded","status":"RESOURCE_EXHAUSTED"}}`, modelName),
-			}
+		if !quotaCheckBypassed(ctx) && c.IsModelQuotaExceeded(modelName) {
+			errChan <- c.quotaExceededError(modelName, util.AccountLabel(c.cfg, c.GetEmail()), "", []string{modelName})
 			return
 		}
 
@@ -295,7 +292,7 @@ func (c *ClaudeClient) SendRawMessageStream(ctx context.Context, modelName strin
 		}
 
 		if errScanner := scanner.Err(); errScanner != nil {
-			errChan <- &interfaces.ErrorMessage{StatusCode: 500, Error: errScanner}
+			errChan <- &interfaces.ErrorMessage{StatusCode: requestErrorStatus(errScanner), Error: errScanner}
 			_ = stream.Close()
 			return
 		}
@@ -303,7 +300,7 @@ func (c *ClaudeClient) SendRawMessageStream(ctx context.Context, modelName strin
 		_ = stream.Close()
 	}()
 
-	return dataChan, errChan
+	return c.bufferStream(ctx, dataChan, errChan)
 }
 
 // SendRawTokenCount sends a token count request to Claude API.
@@ -479,15 +476,16 @@ func (c *ClaudeClient) APIRequest(ctx context.Context, modelName, endpoint strin
 	}
 
 	if c.apiKeyIndex != -1 {
-		log.Debugf("Use Claude API key %s for model %s", util.HideAPIKey(c.cfg.ClaudeKey[c.apiKeyIndex].APIKey), modelName)
+		log.Debugf("Use Claude API key %s for model %s (request %s)", util.HideAPIKey(c.cfg.ClaudeKey[c.apiKeyIndex].APIKey), modelName, RequestID(ctx))
 	} else {
-		log.Debugf("Use Claude account %s for model %s", c.GetEmail(), modelName)
+		log.Debugf("Use Claude account %s for model %s (request %s)", util.AccountLabel(c.cfg, c.GetEmail()), modelName, RequestID(ctx))
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.doWithRetry(ctx, req, jsonBody)
 	if err != nil {
-		return nil, &interfaces.ErrorMessage{StatusCode: 500, Error: fmt.Errorf("failed to execute request: %v", err)}
+		return nil, &interfaces.ErrorMessage{StatusCode: requestErrorStatus(err), Error: fmt.Errorf("failed to execute request: %v", err)}
 	}
+	resp = c.LogUpstreamExchange(ctx, req, jsonBody, resp)
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		defer func() {
@@ -566,11 +564,7 @@ func (c *ClaudeClient) GetEmail() string {
 //   - bool: True if the model's quota is exceeded, false otherwise.
 func (c *ClaudeClient) IsModelQuotaExceeded(model string) bool {
 	if lastExceededTime, hasKey := c.modelQuotaExceeded[model]; hasKey {
-		duration := time.Now().Sub(*lastExceededTime)
-		if duration > 30*time.Minute {
-			return false
-		}
-		return true
+		return c.inQuotaCooldown(model, *lastExceededTime)
 	}
 	return false
 }
@@ -6,14 +6,20 @@ package client
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"net/http"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/luispater/CLIProxyAPI/v5/internal/auth"
+	"github.com/luispater/CLIProxyAPI/v5/internal/capture"
 	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	"github.com/luispater/CLIProxyAPI/v5/internal/metrics"
+	"github.com/luispater/CLIProxyAPI/v5/internal/quota"
 	"github.com/luispater/CLIProxyAPI/v5/internal/registry"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
 )
 
 // ClientBase provides a common base structure for all AI API clients.
@@ -36,6 +42,17 @@ type ClientBase struct {
 	// The map key is the model name, and the value is the time when the quota was exceeded.
 	modelQuotaExceeded map[string]*time.Time
 
+	// modelQuotaRetryAfter holds the delay the upstream requested with the last 429 of a model,
+	// which replaces the configured cooldown.
+	modelQuotaRetryAfter map[string]time.Duration
+
+	// quotaMutex guards modelQuotaExceeded and modelQuotaRetryAfter for clients that access
+	// them through markModelQuotaExceeded, clearModelQuotaExceeded, and modelQuotaExceededAt.
+	quotaMutex sync.RWMutex
+
+	// latency tracks the recent time to the response headers of upstream calls.
+	latency latencyTracker
+
 	// clientID is the unique identifier for this client instance.
 	clientID string
 
@@ -46,6 +63,29 @@ type ClientBase struct {
 	isAvailable bool
 }
 
+// dailyRequestLimit returns the configured daily request soft cap for a model,
+// falling back to the "*" entry. Zero means no limit.
+func (c *ClientBase) dailyRequestLimit(model string) int {
+	if limit, ok := c.cfg.QuotaExceeded.DailyRequestLimits[model]; ok {
+		return limit
+	}
+	return c.cfg.QuotaExceeded.DailyRequestLimits["*"]
+}
+
+// dailyRequestLimitReached reports whether the account has used up its daily request
+// soft cap for the model in the current quota window.
+func (c *ClientBase) dailyRequestLimitReached(account, model string) bool {
+	return quota.GetDailyRequestCounter().LimitReached(account, model, c.dailyRequestLimit(model))
+}
+
+// recordDailyRequest counts a request against the account's daily quota for the model.
+func (c *ClientBase) recordDailyRequest(account, model string) {
+	count := quota.GetDailyRequestCounter().Increment(account, model)
+	if limit := c.dailyRequestLimit(model); limit > 0 && count == limit {
+		log.Infof("account %s reached the daily request limit (%d) for model %s", account, limit, model)
+	}
+}
+
 // GetRequestMutex returns the mutex used to synchronize requests for this client.
 // This ensures that only one request is processed at a time for quota management.
 //
@@ -82,6 +122,104 @@ func (c *ClientBase) AddAPIResponseData(ctx context.Context, line []byte) {
 	}
 }
 
+// CaptureExchange records an upstream request and its response when the inbound request
+// is being captured for replay (see the request-capture setting).
+//
+// Parameters:
+//   - ctx: The context for the request
+//   - clientType: The type of the client sending the request
+//   - req: The upstream request
+//   - body: The upstream request body
+//   - resp: The upstream response
+//
+// Returns:
+//   - *http.Response: The response, with a body that is recorded as it is read
+func (c *ClientBase) CaptureExchange(ctx context.Context, clientType string, req *http.Request, body []byte, resp *http.Response) *http.Response {
+	ginContext, ok := ctx.Value("gin").(*gin.Context)
+	if !ok {
+		return resp
+	}
+	if value, isExist := ginContext.Get(capture.ContextKey); isExist {
+		if record, isRecord := value.(*capture.Record); isRecord {
+			return record.AddExchange(clientType, req, body, resp)
+		}
+	}
+	return resp
+}
+
+// LogUpstreamExchange writes an upstream request and its response to <auth-dir>/logs/upstream.log
+// when log-requests is headers, bodies, or full. Credentials are redacted. The exchange is
+// written once the response body is closed.
+//
+// Parameters:
+//   - ctx: The context for the request
+//   - req: The upstream request
+//   - body: The upstream request body
+//   - resp: The upstream response
+//
+// Returns:
+//   - *http.Response: The response, with a body that is logged as it is read
+func (c *ClientBase) LogUpstreamExchange(ctx context.Context, req *http.Request, body []byte, resp *http.Response) *http.Response {
+	switch c.cfg.LogRequests {
+	case LogRequestsHeaders, LogRequestsBodies, LogRequestsFull:
+		return newUpstreamLogEntry(c.cfg.LogRequests, upstreamLogDir(c.cfg.AuthDir), RequestID(ctx), req, body, resp)
+	}
+	return resp
+}
+
+// ExposeGenerationConfig reports the effective generation config sent upstream back to the
+// caller in the X-Resolved-Generation-Config response header, so that parameter mapping,
+// clamping, and defaults can be inspected. It only performs this operation in debug mode.
+//
+// Parameters:
+//   - ctx: The context for the request
+//   - generationConfig: The generationConfig of the upstream request body
+func (c *ClientBase) ExposeGenerationConfig(ctx context.Context, generationConfig gjson.Result) {
+	if !c.cfg.Debug || !generationConfig.IsObject() {
+		return
+	}
+	if ginContext, ok := ctx.Value("gin").(*gin.Context); ok {
+		var compacted bytes.Buffer
+		if err := json.Compact(&compacted, []byte(generationConfig.Raw)); err != nil {
+			return
+		}
+		ginContext.Header("X-Resolved-Generation-Config", compacted.String())
+	}
+}
+
+// RequestID returns the correlation ID assigned to the inbound request by the server,
+// or "-" if the context does not carry one.
+//
+// Parameters:
+//   - ctx: The context for the request
+//
+// Returns:
+//   - string: The request ID
+func RequestID(ctx context.Context) string {
+	if ginContext, ok := ctx.Value("gin").(*gin.Context); ok {
+		if requestID := ginContext.GetString("requestID"); requestID != "" {
+			return requestID
+		}
+	}
+	return "-"
+}
+
+// quotaCheckBypassed reports whether the request asked to ignore remembered quota state
+// for its model, so that the upstream call is attempted regardless.
+//
+// Parameters:
+//   - ctx: The context for the request
+//
+// Returns:
+//   - bool: True if the quota check should be skipped
+func quotaCheckBypassed(ctx context.Context) bool {
+	if ginContext, ok := ctx.Value("gin").(*gin.Context); ok && ginContext.GetBool("ignoreQuota") {
+		log.Debugf("request %s ignores remembered quota state", RequestID(ctx))
+		return true
+	}
+	return false
+}
+
 // InitializeModelRegistry initializes the model registry for this client
 // This should be called by all client implementations during construction
 func (c *ClientBase) InitializeModelRegistry(clientID string) {
@@ -124,6 +262,98 @@ func (c *ClientBase) ClearModelQuotaExceeded(modelID string) {
 	}
 }
 
+// markModelQuotaExceeded records that this account exceeded its quota for a model, both
+// locally and in the model registry. A positive retryAfter, the delay requested by the
+// upstream, replaces the configured cooldown for this 429.
+func (c *ClientBase) markModelQuotaExceeded(modelID string, retryAfter time.Duration) {
+	now := time.Now()
+	c.quotaMutex.Lock()
+	if _, exceeded := c.modelQuotaExceeded[modelID]; !exceeded {
+		metrics.QuotaExceeded.Inc(modelID)
+	}
+	c.modelQuotaExceeded[modelID] = &now
+	if retryAfter > 0 {
+		if c.modelQuotaRetryAfter == nil {
+			c.modelQuotaRetryAfter = make(map[string]time.Duration)
+		}
+		c.modelQuotaRetryAfter[modelID] = retryAfter
+	} else {
+		delete(c.modelQuotaRetryAfter, modelID)
+	}
+	c.quotaMutex.Unlock()
+	c.SetModelQuotaExceeded(modelID)
+}
+
+// clearModelQuotaExceeded clears the quota exceeded state of a model for this account,
+// both locally and in the model registry.
+func (c *ClientBase) clearModelQuotaExceeded(modelID string) {
+	c.quotaMutex.Lock()
+	delete(c.modelQuotaExceeded, modelID)
+	delete(c.modelQuotaRetryAfter, modelID)
+	c.quotaMutex.Unlock()
+	c.ClearModelQuotaExceeded(modelID)
+}
+
+// modelQuotaExceededAt returns when this account last exceeded its quota for a model.
+func (c *ClientBase) modelQuotaExceededAt(modelID string) (time.Time, bool) {
+	c.quotaMutex.RLock()
+	defer c.quotaMutex.RUnlock()
+	if exceededAt, ok := c.modelQuotaExceeded[modelID]; ok && exceededAt != nil {
+		return *exceededAt, true
+	}
+	return time.Time{}, false
+}
+
+// quotaCooldown returns how long a model is skipped after a 429 (quota-exceeded.cooldown-seconds).
+func (c *ClientBase) quotaCooldown() time.Duration {
+	if c.cfg.QuotaExceeded.CooldownSeconds <= 0 {
+		return 30 * time.Minute
+	}
+	return time.Duration(c.cfg.QuotaExceeded.CooldownSeconds) * time.Second
+}
+
+// modelQuotaCooldown returns how long a model is skipped after its last 429: the delay the
+// upstream requested with it, or otherwise the configured cooldown.
+func (c *ClientBase) modelQuotaCooldown(model string) time.Duration {
+	c.quotaMutex.RLock()
+	retryAfter := c.modelQuotaRetryAfter[model]
+	c.quotaMutex.RUnlock()
+	if retryAfter > 0 {
+		return retryAfter
+	}
+	return c.quotaCooldown()
+}
+
+// QuotaRecoveryAt returns when a model that is quota exceeded on this account becomes
+// eligible again: the end of its cooldown, or otherwise the next daily quota reset, as a
+// model without a cooldown is exhausted by its daily request limit.
+//
+// Parameters:
+//   - model: A model for which IsModelQuotaExceeded reports true
+//
+// Returns:
+//   - time.Time: When the model can be used again
+func (c *ClientBase) QuotaRecoveryAt(model string) time.Time {
+	if exceededAt, ok := c.modelQuotaExceededAt(model); ok {
+		if recoveryAt := exceededAt.Add(c.modelQuotaCooldown(model)); recoveryAt.After(time.Now()) {
+			return recoveryAt
+		}
+	}
+	return quota.NextReset(time.Now())
+}
+
+// inQuotaCooldown reports whether a model that exceeded its quota at exceededAt is still
+// cooling down, i.e. within the upstream's requested delay or quota-exceeded.cooldown-seconds
+// of the 429.
+func (c *ClientBase) inQuotaCooldown(model string, exceededAt time.Time) bool {
+	remaining := c.modelQuotaCooldown(model) - time.Since(exceededAt)
+	if remaining <= 0 {
+		return false
+	}
+	log.Debugf("Model %s is quota exceeded, eligible again in %s", model, remaining.Round(time.Second))
+	return true
+}
+
 // GetClientID returns the unique identifier for this client
 func (c *ClientBase) GetClientID() string {
 	return c.clientID
@@ -243,11 +243,8 @@ func (c *CodexClient) SendRawMessageStream(ctx context.Context, modelName string
 
 		var stream io.ReadCloser
 
-		if c.IsModelQuotaExceeded(modelName) {
-			errChan <- &interfaces.ErrorMessage{
-				StatusCode: 429,
-				Error:      fmt.Errorf(`{"error":{"code":429,"message":"All the models of '%s' are quota exceeded","status":"RESOURCE_EXHAUSTED"}}`, modelName),
-			}
+		if !quotaCheckBypassed(ctx) && c.IsModelQuotaExceeded(modelName) {
+			errChan <- c.quotaExceededError(modelName, util.AccountLabel(c.cfg, c.GetEmail()), "", []string{modelName})
 			return
 		}
 
@@ -292,7 +289,7 @@ func (c *CodexClient) SendRawMessageStream(ctx context.Context, modelName string
 		}
 
 		if errScanner := scanner.Err(); errScanner != nil {
-			errChan <- &interfaces.ErrorMessage{StatusCode: 500, Error: errScanner}
+			errChan <- &interfaces.ErrorMessage{StatusCode: requestErrorStatus(errScanner), Error: errScanner}
 			_ = stream.Close()
 			return
 		}
@@ -300,7 +297,7 @@ func (c *CodexClient) SendRawMessageStream(ctx context.Context, modelName string
 		_ = stream.Close()
 	}()
 
-	return dataChan, errChan
+	return c.bufferStream(ctx, dataChan, errChan)
 }
 
 // SendRawTokenCount sends a token count request to OpenAI API
@@ -499,15 +496,16 @@ func (c *CodexClient) APIRequest(ctx context.Context, modelName, endpoint string
 	}
 
 	if c.apiKeyIndex != -1 {
-		log.Debugf("Use Codex API key %s for model %s", util.HideAPIKey(c.cfg.CodexKey[c.apiKeyIndex].APIKey), modelName)
+		log.Debugf("Use Codex API key %s for model %s (request %s)", util.HideAPIKey(c.cfg.CodexKey[c.apiKeyIndex].APIKey), modelName, RequestID(ctx))
 	} else {
-		log.Debugf("Use ChatGPT account %s for model %s", c.GetEmail(), modelName)
+		log.Debugf("Use ChatGPT account %s for model %s (request %s)", util.AccountLabel(c.cfg, c.GetEmail()), modelName, RequestID(ctx))
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.doWithRetry(ctx, req, jsonBody)
 	if err != nil {
-		return nil, &interfaces.ErrorMessage{StatusCode: 500, Error: fmt.Errorf("failed to execute request: %v", err)}
+		return nil, &interfaces.ErrorMessage{StatusCode: requestErrorStatus(err), Error: fmt.Errorf("failed to execute request: %v", err)}
 	}
+	resp = c.LogUpstreamExchange(ctx, req, jsonBody, resp)
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		defer func() {
@@ -542,11 +540,7 @@ func (c *CodexClient) GetEmail() string {
 //   - bool: True if the model's quota is exceeded, false otherwise.
 func (c *CodexClient) IsModelQuotaExceeded(model string) bool {
 	if lastExceededTime, hasKey := c.modelQuotaExceeded[model]; hasKey {
-		duration := time.Now().Sub(*lastExceededTime)
-		if duration > 30*time.Minute {
-			return false
-		}
-		return true
+		return c.inQuotaCooldown(model, *lastExceededTime)
 	}
 	return false
 }
@@ -0,0 +1,116 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	"github.com/luispater/CLIProxyAPI/v5/internal/translator/translator"
+	"github.com/luispater/CLIProxyAPI/v5/internal/util"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// CountTokens counts the tokens of the prompt of a request with the countTokens endpoint,
+// without generating a response. The request is in the format of the handler in ctx and is
+// translated like a request to generate content.
+//
+// Parameters:
+//   - ctx: The context for the request
+//   - modelName: The name of the model to count the tokens for
+//   - rawJSON: The raw JSON request body
+//
+// Returns:
+//   - int64: The total number of tokens of the prompt
+//   - *interfaces.ErrorMessage: An error message if the request fails
+func (c *GeminiCLIClient) CountTokens(ctx context.Context, modelName string, rawJSON []byte) (int64, *interfaces.ErrorMessage) {
+	if !quotaCheckBypassed(ctx) && c.isModelQuotaExceeded(modelName) {
+		return 0, c.quotaExceededError(modelName, util.AccountLabel(c.cfg, c.GetEmail()), c.GetProjectID(), []string{modelName})
+	}
+
+	handler := ctx.Value("handler").(interfaces.APIHandler)
+	rawJSON = translator.Request(handler.HandlerType(), c.Type(), modelName, rawJSON, false)
+
+	// The Code Assist countTokens endpoint only accepts the model and the contents, so the
+	// system instruction is counted as a leading user content.
+	contents := "[]"
+	for _, key := range []string{"request.systemInstruction", "request.system_instruction"} {
+		if parts := gjson.GetBytes(rawJSON, key+".parts"); parts.IsArray() {
+			systemContent, _ := sjson.SetRaw(`{"role":"user"}`, "parts", parts.Raw)
+			contents, _ = sjson.SetRaw(contents, "-1", systemContent)
+		}
+	}
+	for _, content := range gjson.GetBytes(rawJSON, "request.contents").Array() {
+		contents, _ = sjson.SetRaw(contents, "-1", content.Raw)
+	}
+	body, _ := sjson.Set(`{"request":{}}`, "request.model", "models/"+modelName)
+	body, _ = sjson.SetRaw(body, "request.contents", contents)
+
+	respBody, err := c.APIRequest(ctx, modelName, "countTokens", []byte(body), "", false)
+	if err != nil {
+		if err.StatusCode == http.StatusTooManyRequests {
+			c.markModelQuotaExceeded(modelName, retryAfterOf(err))
+		}
+		return 0, err
+	}
+	c.clearModelQuotaExceeded(modelName)
+	return readTotalTokens(ctx, &c.ClientBase, respBody)
+}
+
+// CountTokens counts the tokens of the prompt of a request with the countTokens endpoint,
+// without generating a response. The request is in the format of the handler in ctx and is
+// translated like a request to generate content.
+//
+// Parameters:
+//   - ctx: The context for the request
+//   - modelName: The name of the model to count the tokens for
+//   - rawJSON: The raw JSON request body
+//
+// Returns:
+//   - int64: The total number of tokens of the prompt
+//   - *interfaces.ErrorMessage: An error message if the request fails
+func (c *GeminiClient) CountTokens(ctx context.Context, modelName string, rawJSON []byte) (int64, *interfaces.ErrorMessage) {
+	if !quotaCheckBypassed(ctx) && c.IsModelQuotaExceeded(modelName) {
+		return 0, c.quotaExceededError(modelName, util.AccountLabel(c.cfg, c.GetEmail()), "", []string{modelName})
+	}
+
+	handler := ctx.Value("handler").(interfaces.APIHandler)
+	rawJSON = translator.Request(handler.HandlerType(), c.Type(), modelName, rawJSON, false)
+
+	// A full request, with its system instruction and tools, is counted as a generateContentRequest.
+	request, _ := sjson.SetBytes(rawJSON, "model", "models/"+modelName)
+	body, _ := sjson.SetRawBytes([]byte(`{}`), "generateContentRequest", request)
+
+	respBody, err := c.APIRequest(ctx, modelName, "countTokens", body, "", false)
+	if err != nil {
+		if err.StatusCode == http.StatusTooManyRequests {
+			c.markModelQuotaExceeded(modelName, retryAfterOf(err))
+		}
+		return 0, err
+	}
+	c.clearModelQuotaExceeded(modelName)
+	return readTotalTokens(ctx, &c.ClientBase, respBody)
+}
+
+// readTotalTokens reads a countTokens response and returns its total number of tokens.
+func readTotalTokens(ctx context.Context, c *ClientBase, respBody io.ReadCloser) (int64, *interfaces.ErrorMessage) {
+	defer func() {
+		_ = respBody.Close()
+	}()
+	bodyBytes, err := io.ReadAll(respBody)
+	if err != nil {
+		return 0, &interfaces.ErrorMessage{StatusCode: http.StatusInternalServerError, Error: err}
+	}
+	c.AddAPIResponseData(ctx, bodyBytes)
+
+	totalTokens := gjson.GetBytes(bodyBytes, "totalTokens")
+	if !totalTokens.Exists() {
+		totalTokens = gjson.GetBytes(bodyBytes, "response.totalTokens")
+	}
+	if !totalTokens.Exists() {
+		return 0, &interfaces.ErrorMessage{StatusCode: http.StatusBadGateway, Error: fmt.Errorf("countTokens response has no totalTokens: %s", bodyBytes)}
+	}
+	return totalTokens.Int(), nil
+}
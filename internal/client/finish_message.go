@@ -0,0 +1,88 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	// finishMessageField leaves the finishMessage of a candidate in the response, where the
+	// OpenAI translators pass it on as native_finish_message.
+	finishMessageField = "field"
+
+	// finishMessageContent appends the finishMessage to the text of the candidate, so that
+	// clients which ignore unknown fields still show it.
+	finishMessageContent = "content"
+
+	// finishMessageOmit removes the finishMessage from the response.
+	finishMessageOmit = "omit"
+)
+
+// applyFinishMessage handles the finishMessage that Gemini adds to a candidate to explain why
+// generation stopped, typically a block or a truncation, according to the finish-message
+// setting. The payload may be a single response, a response wrapped in a "response" field
+// (Gemini CLI), or a JSON array of either.
+//
+// Parameters:
+//   - data: The raw payload
+//
+// Returns:
+//   - []byte: The payload with finish messages moved to the content or removed
+func (c *ClientBase) applyFinishMessage(data []byte) []byte {
+	mode := c.cfg.FinishMessage
+	if (mode != finishMessageContent && mode != finishMessageOmit) || !strings.Contains(string(data), `"finishMessage"`) || !gjson.ValidBytes(data) {
+		return data
+	}
+
+	result := gjson.ParseBytes(data)
+	if !result.IsArray() {
+		return []byte(applyFinishMessageResponse(result.Raw, mode))
+	}
+
+	items := make([]string, 0)
+	result.ForEach(func(_, item gjson.Result) bool {
+		items = append(items, applyFinishMessageResponse(item.Raw, mode))
+		return true
+	})
+	return []byte("[" + strings.Join(items, ",") + "]")
+}
+
+// applyFinishMessageResponse handles the finish messages of the candidates of a single
+// response object. In content mode the message is added as a text part, labelled with the
+// finish reason, for example "[SAFETY: ...]".
+func applyFinishMessageResponse(response, mode string) string {
+	candidatesPath := "candidates"
+	if gjson.Get(response, "response").Exists() {
+		candidatesPath = "response." + candidatesPath
+	}
+
+	for i, candidate := range gjson.Get(response, candidatesPath).Array() {
+		message := candidate.Get("finishMessage").String()
+		if message == "" {
+			continue
+		}
+		candidatePath := fmt.Sprintf("%s.%d", candidatesPath, i)
+		response, _ = sjson.Delete(response, candidatePath+".finishMessage")
+		if mode != finishMessageContent {
+			continue
+		}
+
+		text := message
+		if reason := candidate.Get("finishReason").String(); reason != "" {
+			text = reason + ": " + message
+		}
+		if len(candidate.Get("content.parts").Array()) > 0 {
+			text = "\n\n[" + text + "]"
+		} else {
+			text = "[" + text + "]"
+			if !candidate.Get("content.role").Exists() {
+				response, _ = sjson.Set(response, candidatePath+".content.role", "model")
+			}
+		}
+		response, _ = sjson.Set(response, candidatePath+".content.parts.-1", map[string]string{"text": text})
+	}
+	return response
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+	"github.com/tidwall/gjson"
+)
+
+// blockedResponse is a Gemini response stopped by a block, with the explanation in finishMessage.
+const blockedResponse = `{"candidates":[{"content":{"role":"model","parts":[{"text":"Sure, here"}]},"finishReason":"SAFETY","finishMessage":"Response blocked."}]}`
+
+func TestApplyFinishMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		mode string
+		data string
+		want string
+	}{
+		{name: "field keeps the response", mode: finishMessageField, data: blockedResponse, want: blockedResponse},
+		{name: "unset keeps the response", mode: "", data: blockedResponse, want: blockedResponse},
+		{
+			name: "content appends the message",
+			mode: finishMessageContent,
+			data: blockedResponse,
+			want: `{"candidates":[{"content":{"role":"model","parts":[{"text":"Sure, here"},{"text":"\n\n[SAFETY: Response blocked.]"}]},"finishReason":"SAFETY"}]}`,
+		},
+		{
+			name: "content without parts",
+			mode: finishMessageContent,
+			data: `{"candidates":[{"finishReason":"PROHIBITED_CONTENT","finishMessage":"Blocked."}]}`,
+			want: `{"candidates":[{"finishReason":"PROHIBITED_CONTENT","content":{"role":"model","parts":[{"text":"[PROHIBITED_CONTENT: Blocked.]"}]}}]}`,
+		},
+		{
+			name: "Gemini CLI response",
+			mode: finishMessageContent,
+			data: `{"response":{"candidates":[{"content":{"role":"model","parts":[{"text":"Hi"}]},"finishMessage":"Stopped."}]}}`,
+			want: `{"response":{"candidates":[{"content":{"role":"model","parts":[{"text":"Hi"},{"text":"\n\n[Stopped.]"}]}}]}}`,
+		},
+		{
+			name: "omit",
+			mode: finishMessageOmit,
+			data: blockedResponse,
+			want: `{"candidates":[{"content":{"role":"model","parts":[{"text":"Sure, here"}]},"finishReason":"SAFETY"}]}`,
+		},
+		{
+			name: "array of responses",
+			mode: finishMessageOmit,
+			data: `[{"candidates":[{"finishReason":"STOP"}]},{"candidates":[{"finishReason":"SAFETY","finishMessage":"Blocked."}]}]`,
+			want: `[{"candidates":[{"finishReason":"STOP"}]},{"candidates":[{"finishReason":"SAFETY"}]}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &ClientBase{cfg: &config.Config{FinishMessage: tt.mode}}
+			if got := string(c.applyFinishMessage([]byte(tt.data))); got != tt.want {
+				t.Errorf("applyFinishMessage() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFinishMessageIsSurfaced(t *testing.T) {
+	tests := []struct {
+		name string
+		mode string
+		path string
+		want string
+	}{
+		{name: "field", mode: finishMessageField, path: "candidates.0.finishMessage", want: "Response blocked."},
+		{name: "content", mode: finishMessageContent, path: "candidates.0.content.parts.1.text", want: "\n\n[SAFETY: Response blocked.]"},
+		{name: "omit", mode: finishMessageOmit, path: "candidates.0.finishMessage", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewGeminiClient(&http.Client{Transport: roundTripFunc(func(*http.Request) *http.Response {
+				return cannedResponse(http.StatusOK, nil, blockedResponse)
+			})}, &config.Config{FinishMessage: tt.mode}, "test-key-finish-message")
+
+			resp, err := c.SendRawMessage(testRequestContext(GEMINI, true), "gemini-2.5-flash", []byte(`{"contents":[{"role":"user","parts":[{"text":"Hi"}]}]}`), "")
+			if err != nil {
+				t.Fatalf("SendRawMessage() error = %v", err.Error)
+			}
+			if got := gjson.GetBytes(resp, tt.path).String(); got != tt.want {
+				t.Errorf("%s = %q, want %q (response %s)", tt.path, got, tt.want, resp)
+			}
+		})
+	}
+}
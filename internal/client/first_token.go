@@ -0,0 +1,85 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/metrics"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+// firstTokenTimer measures the time from the start of a streaming request to the first
+// chunk carrying content, and records it once per stream. The request starts when the API
+// handler received it, so the latency includes client selection, retries, and project or
+// preview model switches, not only the upstream time to first byte.
+type firstTokenTimer struct {
+	ctx             context.Context
+	model           string
+	start           time.Time
+	excludeThinking bool
+	observed        bool
+}
+
+// newFirstTokenTimer starts timing a stream from the start of the request, as recorded by the
+// API handler under the "requestStart" context key, or from now if it was not recorded.
+//
+// Parameters:
+//   - ctx: The request context, used to attach the latency to the Gin context
+//   - model: The model serving the stream
+//   - excludeThinking: Whether thinking-only chunks should be ignored
+//
+// Returns:
+//   - *firstTokenTimer: A new timer
+func newFirstTokenTimer(ctx context.Context, model string, excludeThinking bool) *firstTokenTimer {
+	start, ok := ctx.Value("requestStart").(time.Time)
+	if !ok {
+		start = time.Now()
+	}
+	return &firstTokenTimer{ctx: ctx, model: model, start: start, excludeThinking: excludeThinking}
+}
+
+// observe inspects a raw Gemini stream chunk and records the latency on the first content.
+//
+// Parameters:
+//   - data: The raw chunk
+func (t *firstTokenTimer) observe(data []byte) {
+	if t.observed || !gjson.ValidBytes(data) {
+		return
+	}
+
+	hasContent := false
+	root := gjson.ParseBytes(data)
+	items := []gjson.Result{root}
+	if root.IsArray() {
+		items = root.Array()
+	}
+	for _, item := range items {
+		if wrapped := item.Get("response"); wrapped.Exists() {
+			item = wrapped
+		}
+		item.Get("candidates.0.content.parts").ForEach(func(_, part gjson.Result) bool {
+			if part.Get("functionCall").Exists() || part.Get("inlineData").Exists() {
+				hasContent = true
+			} else if part.Get("text").String() != "" {
+				hasContent = !t.excludeThinking || !part.Get("thought").Bool()
+			}
+			return !hasContent
+		})
+		if hasContent {
+			break
+		}
+	}
+	if !hasContent {
+		return
+	}
+
+	t.observed = true
+	latency := time.Since(t.start)
+	metrics.FirstTokenLatency.Observe(latency.Seconds(), t.model)
+	if ginContext, ok := t.ctx.Value("gin").(*gin.Context); ok {
+		ginContext.Set("firstTokenLatency", latency)
+	}
+	log.Debugf("first token latency for model %s: %s", t.model, latency)
+}
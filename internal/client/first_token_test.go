@@ -0,0 +1,83 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+	"github.com/luispater/CLIProxyAPI/v5/internal/metrics"
+)
+
+// delayedStreamClient returns a Gemini client whose upstream answers after headerDelay with a
+// stream of a thinking chunk and, contentDelay later, a content chunk.
+func delayedStreamClient(headerDelay, contentDelay time.Duration) *GeminiClient {
+	cfg := &config.Config{}
+	cfg.Metrics.TTFTExcludeThinking = true
+	return NewGeminiClient(&http.Client{Transport: roundTripFunc(func(*http.Request) *http.Response {
+		time.Sleep(headerDelay)
+		reader, writer := io.Pipe()
+		go func() {
+			_, _ = io.WriteString(writer, "data: {\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"text\":\"Thinking\",\"thought\":true}]}}]}\n\n")
+			time.Sleep(contentDelay)
+			_, _ = io.WriteString(writer, "data: {\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"text\":\"Hello\"}]},\"finishReason\":\"STOP\"}]}\n\n")
+			_ = writer.Close()
+		}()
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Content-Type": []string{"text/event-stream"}}, Body: reader}
+	})}, cfg, "test-key-first-token")
+}
+
+// drainStream reads a stream to its end and returns the first token latency it recorded.
+func drainStream(t *testing.T, ctx context.Context, c *GeminiClient, model string) time.Duration {
+	t.Helper()
+	dataChan, errChan := c.SendRawMessageStream(ctx, model, []byte(`{"contents":[{"role":"user","parts":[{"text":"Hi"}]}]}`), "")
+	for dataChan != nil || errChan != nil {
+		select {
+		case _, ok := <-dataChan:
+			if !ok {
+				dataChan = nil
+			}
+		case err, ok := <-errChan:
+			if !ok {
+				errChan = nil
+			} else if err != nil {
+				t.Fatalf("SendRawMessageStream() error = %v", err.Error)
+			}
+		}
+	}
+	latency, ok := ctx.Value("gin").(*gin.Context).Get("firstTokenLatency")
+	if !ok {
+		t.Fatal("first token latency was not recorded")
+	}
+	return latency.(time.Duration)
+}
+
+func TestFirstTokenLatencyIncludesTimeBeforeUpstreamHeaders(t *testing.T) {
+	const model = "gemini-2.5-flash-lite"
+	observed := metrics.FirstTokenLatency.Count(model)
+
+	latency := drainStream(t, testRequestContext(GEMINI, false), delayedStreamClient(60*time.Millisecond, 40*time.Millisecond), model)
+
+	// The thinking chunk does not count, and the wait for the upstream headers does.
+	if latency < 100*time.Millisecond {
+		t.Errorf("first token latency = %s, want at least 100ms", latency)
+	}
+	if got := metrics.FirstTokenLatency.Count(model) - observed; got != 1 {
+		t.Errorf("first token latency observed %d times, want 1", got)
+	}
+}
+
+func TestFirstTokenLatencyStartsAtRequestStart(t *testing.T) {
+	const model = "gemini-2.5-flash-lite"
+	// The handler received the request earlier, and spent the time selecting a client.
+	ctx := context.WithValue(testRequestContext(GEMINI, false), "requestStart", time.Now().Add(-200*time.Millisecond))
+
+	latency := drainStream(t, ctx, delayedStreamClient(0, 0), model)
+	if latency < 200*time.Millisecond {
+		t.Errorf("first token latency = %s, want at least 200ms from the request start", latency)
+	}
+}
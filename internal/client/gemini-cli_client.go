@@ -13,8 +13,10 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -44,9 +46,51 @@ var (
 	}
 )
 
+// PreviewModels returns the preview models a Gemini CLI model falls back to when its quota is
+// exceeded, in the order they are tried.
+func PreviewModels(model string) []string {
+	return slices.Clone(previewModels[model])
+}
+
 // GeminiCLIClient is the main client for interacting with the CLI API.
 type GeminiCLIClient struct {
 	ClientBase
+
+	// healthMutex protects health.
+	healthMutex sync.RWMutex
+
+	// health caches the result of the background health checks.
+	health HealthStatus
+
+	// projectsMutex protects accessibleProjects and projectsListedAt.
+	projectsMutex sync.Mutex
+
+	// accessibleProjects caches the projects the account can access, for X-CLIProxy-Project.
+	accessibleProjects map[string]bool
+
+	// projectsListedAt is when accessibleProjects was listed.
+	projectsListedAt time.Time
+
+	// projectRotation counts the requests that picked a project, for NextProjectID.
+	projectRotation atomic.Uint64
+
+	// projectQuotaMutex protects projectQuotaExceeded.
+	projectQuotaMutex sync.Mutex
+
+	// projectQuotaExceeded records, per model and project, when a project of the account
+	// hit its quota, for quota-exceeded.switch-project.
+	projectQuotaExceeded map[string]map[string]time.Time
+
+	// projectAccessFailures counts the consecutive project access errors of the primary project.
+	projectAccessFailures atomic.Int32
+
+	// projectRecovering reports whether an alternative project is being searched for.
+	projectRecovering atomic.Bool
+
+	// tokenMutex protects the token storage and serializes writes of the token file. It is
+	// separate from RequestMutex because tokens are refreshed, and saved, in the middle of
+	// requests.
+	tokenMutex sync.RWMutex
 }
 
 // NewGeminiCLIClient creates a new CLI API client.
@@ -73,6 +117,8 @@ func NewGeminiCLIClient(httpClient *http.Client, ts *geminiAuth.GeminiTokenStora
 		},
 	}
 
+	client.httpClient = client.persistRefreshedTokens(httpClient)
+
 	// Initialize model registry and register Gemini models
 	client.InitializeModelRegistry(clientID)
 	client.RegisterModels("gemini-cli", registry.GetGeminiCLIModels())
@@ -111,6 +157,8 @@ func (c *GeminiCLIClient) CanProvideModel(modelName string) bool {
 // Parameters:
 //   - projectID: The new project ID.
 func (c *GeminiCLIClient) SetProjectID(projectID string) {
+	c.tokenMutex.Lock()
+	defer c.tokenMutex.Unlock()
 	c.tokenStorage.(*geminiAuth.GeminiTokenStorage).ProjectID = projectID
 }
 
@@ -145,17 +193,51 @@ func (c *GeminiCLIClient) GetEmail() string {
 	return c.tokenStorage.(*geminiAuth.GeminiTokenStorage).Email
 }
 
+// dailyQuotaAccount returns the identifier used to track daily request counts for this client.
+func (c *GeminiCLIClient) dailyQuotaAccount() string {
+	return c.GetEmail() + "/" + c.GetProjectID()
+}
+
+// ProjectIDs returns the account's project IDs: the primary project ID followed by the
+// additional project IDs of the token storage, without duplicates.
+func (c *GeminiCLIClient) ProjectIDs() []string {
+	projectIDs := []string{c.GetProjectID()}
+	if ts, ok := c.tokenStorage.(*geminiAuth.GeminiTokenStorage); ok {
+		c.tokenMutex.RLock()
+		defer c.tokenMutex.RUnlock()
+		for _, projectID := range ts.ProjectIDs {
+			if projectID != "" && !util.InArray(projectIDs, projectID) {
+				projectIDs = append(projectIDs, projectID)
+			}
+		}
+	}
+	return projectIDs
+}
+
+// NextProjectID returns the project ID for the next request. Accounts with several project
+// IDs rotate through them round-robin; otherwise the project ID is always returned.
+func (c *GeminiCLIClient) NextProjectID() string {
+	projectIDs := c.ProjectIDs()
+	if len(projectIDs) == 1 {
+		return projectIDs[0]
+	}
+	return projectIDs[(c.projectRotation.Add(1)-1)%uint64(len(projectIDs))]
+}
+
 // GetProjectID returns the Google Cloud project ID from the client's token storage.
 func (c *GeminiCLIClient) GetProjectID() string {
 	if c.tokenStorage != nil {
 		if ts, ok := c.tokenStorage.(*geminiAuth.GeminiTokenStorage); ok {
+			c.tokenMutex.RLock()
+			defer c.tokenMutex.RUnlock()
 			return ts.ProjectID
 		}
 	}
 	return ""
 }
 
-// SetupUser performs the initial user onboarding and setup.
+// SetupUser performs the initial user onboarding and setup. Onboardings of all accounts
+// share a limit on parallelism and on the rate of onboarding API calls (see config.Onboarding).
 //
 // Parameters:
 //   - ctx: The context for the request.
@@ -166,6 +248,11 @@ func (c *GeminiCLIClient) GetProjectID() string {
 //   - error: An error if the setup fails, nil otherwise.
 func (c *GeminiCLIClient) SetupUser(ctx context.Context, email, projectID string) error {
 	c.tokenStorage.(*geminiAuth.GeminiTokenStorage).Email = email
+	release, err := onboarding.acquire(ctx, c.cfg.Onboarding)
+	if err != nil {
+		return fmt.Errorf("failed to wait for an onboarding slot: %w", err)
+	}
+	defer release()
 	log.Info("Performing user onboarding...")
 
 	// 1. LoadCodeAssist
@@ -177,7 +264,7 @@ func (c *GeminiCLIClient) SetupUser(ctx context.Context, email, projectID string
 	}
 
 	var loadAssistResp map[string]interface{}
-	err := c.makeAPIRequest(ctx, "loadCodeAssist", "POST", loadAssistReqBody, &loadAssistResp)
+	err = c.makeAPIRequest(ctx, "loadCodeAssist", "POST", loadAssistReqBody, &loadAssistResp)
 	if err != nil {
 		return fmt.Errorf("failed to load code assist: %w", err)
 	}
@@ -209,10 +296,13 @@ func (c *GeminiCLIClient) SetupUser(ctx context.Context, email, projectID string
 	if onboardProjectID != "" {
 		onboardReqBody["cloudaicompanionProject"] = onboardProjectID
 	} else {
-		return fmt.Errorf("failed to start user onboarding, need define a project id")
+		return ErrProjectIDRequired
 	}
 
 	for {
+		if err = onboarding.waitPoll(ctx, c.cfg.Onboarding); err != nil {
+			return fmt.Errorf("failed to wait for onboarding: %w", err)
+		}
 		var lroResp map[string]interface{}
 		err = c.makeAPIRequest(ctx, "onboardUser", "POST", onboardReqBody, &lroResp)
 		if err != nil {
@@ -225,17 +315,18 @@ func (c *GeminiCLIClient) SetupUser(ctx context.Context, email, projectID string
 		done, doneOk := lroResp["done"].(bool)
 		if doneOk && done {
 			if project, projectOk := lroResp["response"].(map[string]interface{})["cloudaicompanionProject"].(map[string]interface{}); projectOk {
-				if projectID != "" {
-					c.tokenStorage.(*geminiAuth.GeminiTokenStorage).ProjectID = projectID
-				} else {
-					c.tokenStorage.(*geminiAuth.GeminiTokenStorage).ProjectID = project["id"].(string)
+				if projectID == "" {
+					projectID = project["id"].(string)
 				}
-				log.Infof("Onboarding complete. Using Project ID: %s", c.tokenStorage.(*geminiAuth.GeminiTokenStorage).ProjectID)
+				c.SetProjectID(projectID)
+				log.Infof("Onboarding complete. Using Project ID: %s", projectID)
 				return nil
 			}
 		} else {
 			log.Println("Onboarding in progress, waiting 5 seconds...")
-			time.Sleep(5 * time.Second)
+			if err = sleepContext(ctx, 5*time.Second); err != nil {
+				return fmt.Errorf("failed to wait for onboarding: %w", err)
+			}
 		}
 	}
 }
@@ -263,7 +354,7 @@ func (c *GeminiCLIClient) makeAPIRequest(ctx context.Context, endpoint, method s
 		reqBody = bytes.NewBuffer(jsonBody)
 	}
 
-	url := fmt.Sprintf("%s/%s:%s", codeAssistEndpoint, apiVersion, endpoint)
+	url := fmt.Sprintf("%s/%s:%s", codeAssistEndpoint, c.resolveAPIVersion(GEMINICLI), endpoint)
 	if strings.HasPrefix(endpoint, "operations/") {
 		url = fmt.Sprintf("%s/%s", codeAssistEndpoint, endpoint)
 	}
@@ -281,10 +372,16 @@ func (c *GeminiCLIClient) makeAPIRequest(ctx context.Context, endpoint, method s
 	// Set headers
 	metadataStr := c.getClientMetadataString()
 	req.Header.Set("Content-Type", "application/json")
+	if requestID := RequestID(ctx); requestID != "-" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
 	req.Header.Set("User-Agent", c.GetUserAgent())
 	req.Header.Set("X-Goog-Api-Client", "gl-node/22.17.0")
 	req.Header.Set("Client-Metadata", metadataStr)
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token.AccessToken))
+	if err = decorateRequest(req, token.AccessToken, jsonBody); err != nil {
+		return fmt.Errorf("failed to decorate request: %w", err)
+	}
 
 	if ginContext, ok := ctx.Value("gin").(*gin.Context); ok {
 		ginContext.Set("API_REQUEST", jsonBody)
@@ -341,7 +438,7 @@ func (c *GeminiCLIClient) APIRequest(ctx context.Context, modelName, endpoint st
 
 	var url string
 	// Add alt=sse for streaming
-	url = fmt.Sprintf("%s/%s:%s", codeAssistEndpoint, apiVersion, endpoint)
+	url = fmt.Sprintf("%s/%s:%s", codeAssistEndpoint, c.resolveAPIVersion(GEMINICLI), endpoint)
 	if alt == "" && stream {
 		url = url + "?alt=sse"
 	} else {
@@ -366,23 +463,36 @@ func (c *GeminiCLIClient) APIRequest(ctx context.Context, modelName, endpoint st
 	if errToken != nil {
 		return nil, &interfaces.ErrorMessage{StatusCode: 500, Error: fmt.Errorf("failed to get token: %v", errToken)}
 	}
+	if requestID := RequestID(ctx); requestID != "-" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
 	req.Header.Set("User-Agent", c.GetUserAgent())
 	req.Header.Set("X-Goog-Api-Client", "gl-node/22.17.0")
 	req.Header.Set("Client-Metadata", metadataStr)
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token.AccessToken))
+	if errDecorate := decorateRequest(req, token.AccessToken, jsonBody); errDecorate != nil {
+		return nil, &interfaces.ErrorMessage{StatusCode: 500, Error: fmt.Errorf("failed to decorate request: %v", errDecorate)}
+	}
 
 	if c.cfg.RequestLog {
 		if ginContext, ok := ctx.Value("gin").(*gin.Context); ok {
 			ginContext.Set("API_REQUEST", jsonBody)
 		}
 	}
+	c.ExposeGenerationConfig(ctx, gjson.GetBytes(jsonBody, "request.generationConfig"))
 
-	log.Debugf("Use Gemini CLI account %s (project id: %s) for model %s", c.GetEmail(), c.GetProjectID(), modelName)
+	log.Debugf("Use Gemini CLI account %s (project id: %s) for model %s (request %s)", util.AccountLabel(c.cfg, c.GetEmail()), gjson.GetBytes(jsonBody, "project").String(), modelName, RequestID(ctx))
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.doWithRetry(ctx, req, jsonBody)
+	if err != nil {
+		return nil, &interfaces.ErrorMessage{StatusCode: requestErrorStatus(err), Error: fmt.Errorf("failed to execute request: %v", err)}
+	}
+	resp, err = c.retryAlternateAPIVersions(ctx, GEMINICLI, req, jsonBody, resp)
 	if err != nil {
 		return nil, &interfaces.ErrorMessage{StatusCode: 500, Error: fmt.Errorf("failed to execute request: %v", err)}
 	}
+	resp = c.CaptureExchange(ctx, GEMINICLI, req, jsonBody, resp)
+	resp = c.LogUpstreamExchange(ctx, req, jsonBody, resp)
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		defer func() {
@@ -392,8 +502,16 @@ func (c *GeminiCLIClient) APIRequest(ctx context.Context, modelName, endpoint st
 		}()
 		bodyBytes, _ := io.ReadAll(resp.Body)
 		// log.Debug(string(jsonBody))
-		return nil, &interfaces.ErrorMessage{StatusCode: resp.StatusCode, Error: fmt.Errorf("%s", string(bodyBytes))}
+		c.observeProjectAccess(resp.StatusCode, bodyBytes, gjson.GetBytes(jsonBody, "project").String())
+		errMsg := &interfaces.ErrorMessage{StatusCode: resp.StatusCode, Error: fmt.Errorf("%s", string(bodyBytes)), Addon: retryAfterAddon(resp.StatusCode, resp.Header, bodyBytes)}
+		if c.cfg.Debug {
+			if errMsg.Upstream = parseUpstreamError(bodyBytes); errMsg.Upstream != nil {
+				log.Debugf("Gemini CLI upstream error (request %s): code=%d status=%s message=%s details=%s", RequestID(ctx), errMsg.Upstream.Code, errMsg.Upstream.Status, errMsg.Upstream.Message, errMsg.Upstream.Details)
+			}
+		}
+		return nil, errMsg
 	}
+	c.observeProjectAccess(resp.StatusCode, nil, gjson.GetBytes(jsonBody, "project").String())
 
 	return resp.Body, nil
 }
@@ -411,21 +529,21 @@ func (c *GeminiCLIClient) APIRequest(ctx context.Context, modelName, endpoint st
 //   - *interfaces.ErrorMessage: An error message if the request fails.
 func (c *GeminiCLIClient) SendRawTokenCount(ctx context.Context, modelName string, rawJSON []byte, alt string) ([]byte, *interfaces.ErrorMessage) {
 	originalRequestRawJSON := bytes.Clone(rawJSON)
+	bypassQuota := quotaCheckBypassed(ctx)
+	triedModels := []string{modelName}
 	for {
-		if c.isModelQuotaExceeded(modelName) {
+		if !bypassQuota && c.isModelQuotaExceeded(modelName) {
 			if c.cfg.QuotaExceeded.SwitchPreviewModel {
 				newModelName := c.getPreviewModel(modelName)
 				if newModelName != "" {
 					log.Debugf("Model %s is quota exceeded. Switch to preview model %s", modelName, newModelName)
 					rawJSON, _ = sjson.SetBytes(rawJSON, "model", newModelName)
 					modelName = newModelName
+					triedModels = append(triedModels, modelName)
 					continue
 				}
 			}
-			return nil, &interfaces.ErrorMessage{
-				StatusCode: 429,
-				Error:      fmt.Errorf(`{"error":{"code":429,"message":"All the models of '%s' are quota exceeded","status":"RESOURCE_EXHAUSTED"}}`, modelName),
-			}
+			return nil, c.quotaExceededError(triedModels[0], util.AccountLabel(c.cfg, c.GetEmail()), c.GetProjectID(), triedModels)
 		}
 
 		handler := ctx.Value("handler").(interfaces.APIHandler)
@@ -438,19 +556,15 @@ func (c *GeminiCLIClient) SendRawTokenCount(ctx context.Context, modelName strin
 		respBody, err := c.APIRequest(ctx, modelName, "countTokens", rawJSON, alt, false)
 		if err != nil {
 			if err.StatusCode == 429 {
-				now := time.Now()
-				c.modelQuotaExceeded[modelName] = &now
-				// Update model registry quota status
-				c.SetModelQuotaExceeded(modelName)
+				c.markModelQuotaExceeded(modelName, retryAfterOf(err))
+				bypassQuota = false
 				if c.cfg.QuotaExceeded.SwitchPreviewModel {
 					continue
 				}
 			}
 			return nil, err
 		}
-		delete(c.modelQuotaExceeded, modelName)
-		// Clear quota status in model registry
-		c.ClearModelQuotaExceeded(modelName)
+		c.clearModelQuotaExceeded(modelName)
 		bodyBytes, errReadAll := io.ReadAll(respBody)
 		if errReadAll != nil {
 			return nil, &interfaces.ErrorMessage{StatusCode: 500, Error: errReadAll}
@@ -481,42 +595,68 @@ func (c *GeminiCLIClient) SendRawMessage(ctx context.Context, modelName string,
 	handler := ctx.Value("handler").(interfaces.APIHandler)
 	handlerType := handler.HandlerType()
 	rawJSON = translator.Request(handlerType, c.Type(), modelName, rawJSON, false)
-	rawJSON, _ = sjson.SetBytes(rawJSON, "project", c.GetProjectID())
+	rawJSON = c.applyRequestOptions(modelName, rawJSON, "request.")
+	rawJSON = c.applyDefaultGrounding(ctx, modelName, rawJSON, "request.")
+	rawJSON, errLimit := c.limitToolDeclarations(rawJSON, "request.")
+	if errLimit != nil {
+		return nil, errLimit
+	}
+	rawJSON, errSampling := c.checkSamplingParams(rawJSON, "request.")
+	if errSampling != nil {
+		return nil, errSampling
+	}
+	projectID, errProject := c.requestProjectID(ctx, modelName)
+	if errProject != nil {
+		return nil, errProject
+	}
+	rawJSON, _ = sjson.SetBytes(rawJSON, "project", projectID)
 	rawJSON, _ = sjson.SetBytes(rawJSON, "model", modelName)
+	summarized := false
+	if c.exceedsSummarizationTrigger(rawJSON, "request.") {
+		rawJSON, summarized = c.summarizeHistory(ctx, rawJSON, "request.", c.generateSummary)
+	}
 
+	bypassQuota := quotaCheckBypassed(ctx)
+	triedModels := []string{modelName}
 	for {
-		if c.isModelQuotaExceeded(modelName) {
+		if !bypassQuota && c.isModelQuotaExceeded(modelName) {
 			if c.cfg.QuotaExceeded.SwitchPreviewModel {
 				newModelName := c.getPreviewModel(modelName)
 				if newModelName != "" {
 					log.Debugf("Model %s is quota exceeded. Switch to preview model %s", modelName, newModelName)
 					rawJSON, _ = sjson.SetBytes(rawJSON, "model", newModelName)
 					modelName = newModelName
+					triedModels = append(triedModels, modelName)
 					continue
 				}
 			}
-			return nil, &interfaces.ErrorMessage{
-				StatusCode: 429,
-				Error:      fmt.Errorf(`{"error":{"code":429,"message":"All the models of '%s' are quota exceeded","status":"RESOURCE_EXHAUSTED"}}`, modelName),
-			}
+			return nil, c.quotaExceededError(triedModels[0], util.AccountLabel(c.cfg, c.GetEmail()), c.GetProjectID(), triedModels)
 		}
 
 		respBody, err := c.APIRequest(ctx, modelName, "generateContent", rawJSON, alt, false)
 		if err != nil {
+			if !summarized && isContextOverflow(err) {
+				if rawJSON, summarized = c.summarizeHistory(ctx, rawJSON, "request.", c.generateSummary); summarized {
+					continue
+				}
+			}
 			if err.StatusCode == 429 {
-				now := time.Now()
-				c.modelQuotaExceeded[modelName] = &now
-				// Update model registry quota status
-				c.SetModelQuotaExceeded(modelName)
+				if nextProjectID, switched := c.switchProjectOnQuota(ctx, modelName, projectID); switched {
+					projectID = nextProjectID
+					rawJSON, _ = sjson.SetBytes(rawJSON, "project", projectID)
+					continue
+				}
+				c.markModelQuotaExceeded(modelName, retryAfterOf(err))
+				bypassQuota = false
 				if c.cfg.QuotaExceeded.SwitchPreviewModel {
 					continue
 				}
 			}
 			return nil, err
 		}
-		delete(c.modelQuotaExceeded, modelName)
-		// Clear quota status in model registry
-		c.ClearModelQuotaExceeded(modelName)
+		c.clearModelQuotaExceeded(modelName)
+		c.clearProjectQuotaExceeded(modelName, projectID)
+		c.recordDailyRequest(c.dailyQuotaAccount(), modelName)
 		bodyBytes, errReadAll := io.ReadAll(respBody)
 		if errReadAll != nil {
 			return nil, &interfaces.ErrorMessage{StatusCode: 500, Error: errReadAll}
@@ -524,6 +664,25 @@ func (c *GeminiCLIClient) SendRawMessage(ctx context.Context, modelName string,
 
 		_ = respBody.Close()
 		c.AddAPIResponseData(ctx, bodyBytes)
+		rawJSON, bodyBytes = c.retryOnRecitation(ctx, modelName, rawJSON, bodyBytes, "request.", func(retryJSON []byte) ([]byte, *interfaces.ErrorMessage) {
+			return c.sendRetry(ctx, modelName, retryJSON, alt)
+		})
+		rawJSON, bodyBytes, errValidation := c.retryInvalidStructuredOutput(ctx, modelName, rawJSON, bodyBytes, "request.", func(retryJSON []byte) ([]byte, *interfaces.ErrorMessage) {
+			return c.sendRetry(ctx, modelName, retryJSON, alt)
+		})
+		if errValidation != nil {
+			return nil, errValidation
+		}
+		rawJSON, bodyBytes = c.checkResponseLanguage(ctx, modelName, rawJSON, bodyBytes, "request.", func(retryJSON []byte) ([]byte, *interfaces.ErrorMessage) {
+			return c.sendRetry(ctx, modelName, retryJSON, alt)
+		})
+		validator := newResponseValidator(modelName, util.AccountLabel(c.cfg, c.GetEmail()))
+		validator.observe(bodyBytes)
+		validator.finish()
+
+		bodyBytes = c.newThoughtFormatter(ctx, modelName).apply(bodyBytes)
+		bodyBytes = c.applyFinishMessage(bodyBytes)
+		bodyBytes, _ = c.newResponseSizeLimiter(ctx).apply(bodyBytes)
 
 		newCtx := context.WithValue(ctx, "alt", alt)
 		var param any
@@ -533,6 +692,49 @@ func (c *GeminiCLIClient) SendRawMessage(ctx context.Context, modelName string,
 	}
 }
 
+// sendRetry sends a non-streaming generateContent request and returns the raw response.
+func (c *GeminiCLIClient) sendRetry(ctx context.Context, modelName string, rawJSON []byte, alt string) ([]byte, *interfaces.ErrorMessage) {
+	respBody, errMsg := c.APIRequest(ctx, modelName, "generateContent", rawJSON, alt, false)
+	if errMsg != nil {
+		return nil, errMsg
+	}
+	defer func() {
+		_ = respBody.Close()
+	}()
+	bodyBytes, errReadAll := io.ReadAll(respBody)
+	if errReadAll != nil {
+		return nil, &interfaces.ErrorMessage{StatusCode: 500, Error: errReadAll}
+	}
+	c.AddAPIResponseData(ctx, bodyBytes)
+	return bodyBytes, nil
+}
+
+// generateSummary sends a bare Gemini request through the Code Assist API. It is used to
+// summarize conversation history that overflows the context window.
+func (c *GeminiCLIClient) generateSummary(ctx context.Context, modelName string, request []byte) ([]byte, *interfaces.ErrorMessage) {
+	projectID, errProject := c.requestProjectID(ctx, modelName)
+	if errProject != nil {
+		return nil, errProject
+	}
+	body := []byte(`{}`)
+	body, _ = sjson.SetBytes(body, "project", projectID)
+	body, _ = sjson.SetBytes(body, "model", modelName)
+	body, _ = sjson.SetRawBytes(body, "request", request)
+
+	respBody, errMsg := c.APIRequest(ctx, modelName, "generateContent", body, "", false)
+	if errMsg != nil {
+		return nil, errMsg
+	}
+	defer func() {
+		_ = respBody.Close()
+	}()
+	bodyBytes, errReadAll := io.ReadAll(respBody)
+	if errReadAll != nil {
+		return nil, &interfaces.ErrorMessage{StatusCode: 500, Error: errReadAll}
+	}
+	return []byte(gjson.GetBytes(bodyBytes, "response").Raw), nil
+}
+
 // SendRawMessageStream handles a single conversational turn, including tool calls.
 //
 // Parameters:
@@ -545,13 +747,21 @@ func (c *GeminiCLIClient) SendRawMessage(ctx context.Context, modelName string,
 //   - <-chan []byte: A channel for receiving response data chunks.
 //   - <-chan *interfaces.ErrorMessage: A channel for receiving error messages.
 func (c *GeminiCLIClient) SendRawMessageStream(ctx context.Context, modelName string, rawJSON []byte, alt string) (<-chan []byte, <-chan *interfaces.ErrorMessage) {
+	timer := newFirstTokenTimer(ctx, modelName, c.cfg.Metrics.TTFTExcludeThinking)
 	originalRequestRawJSON := bytes.Clone(rawJSON)
 
 	handler := ctx.Value("handler").(interfaces.APIHandler)
 	handlerType := handler.HandlerType()
 	rawJSON = translator.Request(handlerType, c.Type(), modelName, rawJSON, true)
+	rawJSON = c.applyRequestOptions(modelName, rawJSON, "request.")
+	rawJSON = c.applyDefaultGrounding(ctx, modelName, rawJSON, "request.")
+	rawJSON, errLimit := c.limitToolDeclarations(rawJSON, "request.")
+	if errLimit == nil {
+		rawJSON, errLimit = c.checkSamplingParams(rawJSON, "request.")
+	}
+	projectID, errProject := c.requestProjectID(ctx, modelName)
 
-	rawJSON, _ = sjson.SetBytes(rawJSON, "project", c.GetProjectID())
+	rawJSON, _ = sjson.SetBytes(rawJSON, "project", projectID)
 	rawJSON, _ = sjson.SetBytes(rawJSON, "model", modelName)
 
 	dataTag := []byte("data: ")
@@ -563,35 +773,55 @@ func (c *GeminiCLIClient) SendRawMessageStream(ctx context.Context, modelName st
 		defer close(errChan)
 		defer close(dataChan)
 
-		rawJSON, _ = sjson.SetBytes(rawJSON, "project", c.GetProjectID())
+		if errLimit != nil {
+			errChan <- errLimit
+			return
+		}
+		if errProject != nil {
+			errChan <- errProject
+			return
+		}
+
+		summarized := false
+		if c.exceedsSummarizationTrigger(rawJSON, "request.") {
+			rawJSON, summarized = c.summarizeHistory(ctx, rawJSON, "request.", c.generateSummary)
+		}
 
 		var stream io.ReadCloser
+		bypassQuota := quotaCheckBypassed(ctx)
+		triedModels := []string{modelName}
 		for {
-			if c.isModelQuotaExceeded(modelName) {
+			if !bypassQuota && c.isModelQuotaExceeded(modelName) {
 				if c.cfg.QuotaExceeded.SwitchPreviewModel {
 					newModelName := c.getPreviewModel(modelName)
 					if newModelName != "" {
 						log.Debugf("Model %s is quota exceeded. Switch to preview model %s", modelName, newModelName)
 						rawJSON, _ = sjson.SetBytes(rawJSON, "model", newModelName)
 						modelName = newModelName
+						triedModels = append(triedModels, modelName)
 						continue
 					}
 				}
-				errChan <- &interfaces.ErrorMessage{
-					StatusCode: 429,
-					Error:      fmt.Errorf(`{"error":{"code":429,"message":"All the models of '%s' are quota exceeded","status":"RESOURCE_EXHAUSTED"}}`, modelName),
-				}
+				errChan <- c.quotaExceededError(triedModels[0], util.AccountLabel(c.cfg, c.GetEmail()), c.GetProjectID(), triedModels)
 				return
 			}
 
 			var err *interfaces.ErrorMessage
 			stream, err = c.APIRequest(ctx, modelName, "streamGenerateContent", rawJSON, alt, true)
 			if err != nil {
+				if !summarized && isContextOverflow(err) {
+					if rawJSON, summarized = c.summarizeHistory(ctx, rawJSON, "request.", c.generateSummary); summarized {
+						continue
+					}
+				}
 				if err.StatusCode == 429 {
-					now := time.Now()
-					c.modelQuotaExceeded[modelName] = &now
-					// Update model registry quota status
-					c.SetModelQuotaExceeded(modelName)
+					if nextProjectID, switched := c.switchProjectOnQuota(ctx, modelName, projectID); switched {
+						projectID = nextProjectID
+						rawJSON, _ = sjson.SetBytes(rawJSON, "project", projectID)
+						continue
+					}
+					c.markModelQuotaExceeded(modelName, retryAfterOf(err))
+					bypassQuota = false
 					if c.cfg.QuotaExceeded.SwitchPreviewModel {
 						continue
 					}
@@ -599,9 +829,9 @@ func (c *GeminiCLIClient) SendRawMessageStream(ctx context.Context, modelName st
 				errChan <- err
 				return
 			}
-			delete(c.modelQuotaExceeded, modelName)
-			// Clear quota status in model registry
-			c.ClearModelQuotaExceeded(modelName)
+			c.clearModelQuotaExceeded(modelName)
+			c.clearProjectQuotaExceeded(modelName, projectID)
+			c.recordDailyRequest(c.dailyQuotaAccount(), modelName)
 			break
 		}
 		defer func() {
@@ -610,61 +840,99 @@ func (c *GeminiCLIClient) SendRawMessageStream(ctx context.Context, modelName st
 			}
 		}()
 
+		stopWatching := closeStreamOnCancel(ctx, stream)
+		defer stopWatching()
+
 		newCtx := context.WithValue(ctx, "alt", alt)
+		newCtx = context.WithValue(newCtx, "flushToolCalls", c.flushToolCalls(modelName))
 		var param any
+		validator := newResponseValidator(modelName, util.AccountLabel(c.cfg, c.GetEmail()))
+		trimmer := newLeadingWhitespaceTrimmer(c.cfg.TrimLeadingWhitespace)
+		duplicates := newDuplicateChunkFilter(c.cfg.DropDuplicateChunks, modelName)
+		stopOnToolCall := c.stopOnToolCall(modelName)
+		limiter := c.newResponseSizeLimiter(ctx)
+		thoughts := c.newThoughtFormatter(ctx, modelName)
 		if alt == "" {
 			scanner := bufio.NewScanner(stream)
+			buffer := c.newStreamBuffer(func(chunk []byte) {
+				if !translator.NeedConvert(handlerType, c.Type()) {
+					sendChunk(ctx, dataChan, chunk)
+					return
+				}
+				lines := translator.Response(handlerType, c.Type(), newCtx, modelName, originalRequestRawJSON, rawJSON, chunk, &param)
+				for i := 0; i < len(lines); i++ {
+					sendChunk(ctx, dataChan, []byte(lines[i]))
+				}
+			})
+			defer buffer.close()
 
-			if translator.NeedConvert(handlerType, c.Type()) {
-				for scanner.Scan() {
-					line := scanner.Bytes()
-					if bytes.HasPrefix(line, dataTag) {
-						lines := translator.Response(handlerType, c.Type(), newCtx, modelName, originalRequestRawJSON, rawJSON, line[6:], &param)
-						for i := 0; i < len(lines); i++ {
-							dataChan <- []byte(lines[i])
-						}
-					}
-					c.AddAPIResponseData(ctx, line)
+			for scanner.Scan() {
+				if ctx.Err() != nil {
+					break
 				}
-			} else {
-				for scanner.Scan() {
-					line := scanner.Bytes()
-					if bytes.HasPrefix(line, dataTag) {
-						dataChan <- line[6:]
-					}
-					c.AddAPIResponseData(ctx, line)
+				line, streamError := c.replaceStreamError(ctx, modelName, scanner.Bytes(), true)
+				truncated := false
+				if bytes.HasPrefix(line, dataTag) && !duplicates.duplicate(line[6:]) {
+					validator.observe(line[6:])
+					timer.observe(line[6:])
+					var chunk []byte
+					chunk, truncated = limiter.apply(trimmer.trim(c.applyFinishMessage(thoughts.apply(line[6:]))))
+					buffer.add(chunk)
+				}
+				c.AddAPIResponseData(ctx, line)
+				if streamError {
+					break
+				}
+				if truncated {
+					log.Debugf("Stop streaming model %s at the response size limit", modelName)
+					break
+				}
+				if stopOnToolCall && bytes.HasPrefix(line, dataTag) && containsFunctionCall(line[6:]) {
+					log.Debugf("Stop streaming model %s after tool call", modelName)
+					break
 				}
 			}
+			buffer.close()
 
+			if streamCancelled(ctx, modelName) {
+				return
+			}
 			if errScanner := scanner.Err(); errScanner != nil {
-				errChan <- &interfaces.ErrorMessage{StatusCode: 500, Error: errScanner}
+				errChan <- &interfaces.ErrorMessage{StatusCode: requestErrorStatus(errScanner), Error: errScanner}
 				_ = stream.Close()
 				return
 			}
 
 		} else {
 			data, err := io.ReadAll(stream)
+			if streamCancelled(ctx, modelName) {
+				return
+			}
 			if err != nil {
 				errChan <- &interfaces.ErrorMessage{StatusCode: 500, Error: err}
 				_ = stream.Close()
 				return
 			}
+			validator.observe(data)
+			timer.observe(data)
+			chunk, _ := limiter.apply(trimmer.trim(c.applyFinishMessage(thoughts.apply(data))))
 
 			if translator.NeedConvert(handlerType, c.Type()) {
-				lines := translator.Response(handlerType, c.Type(), newCtx, modelName, originalRequestRawJSON, rawJSON, data, &param)
+				lines := translator.Response(handlerType, c.Type(), newCtx, modelName, originalRequestRawJSON, rawJSON, chunk, &param)
 				for i := 0; i < len(lines); i++ {
-					dataChan <- []byte(lines[i])
+					sendChunk(ctx, dataChan, []byte(lines[i]))
 				}
 			} else {
-				dataChan <- data
+				sendChunk(ctx, dataChan, chunk)
 			}
 			c.AddAPIResponseData(ctx, data)
 		}
+		validator.finish()
 
 		if translator.NeedConvert(handlerType, c.Type()) {
 			lines := translator.Response(handlerType, c.Type(), ctx, modelName, rawJSON, originalRequestRawJSON, []byte("[DONE]"), &param)
 			for i := 0; i < len(lines); i++ {
-				dataChan <- []byte(lines[i])
+				sendChunk(ctx, dataChan, []byte(lines[i]))
 			}
 		}
 
@@ -672,7 +940,7 @@ func (c *GeminiCLIClient) SendRawMessageStream(ctx context.Context, modelName st
 
 	}()
 
-	return dataChan, errChan
+	return c.bufferStream(ctx, dataChan, errChan)
 }
 
 // isModelQuotaExceeded checks if the specified model has exceeded its quota
@@ -684,19 +952,22 @@ func (c *GeminiCLIClient) SendRawMessageStream(ctx context.Context, modelName st
 // Returns:
 //   - bool: True if the model's quota is exceeded, false otherwise.
 func (c *GeminiCLIClient) isModelQuotaExceeded(model string) bool {
-	if lastExceededTime, hasKey := c.modelQuotaExceeded[model]; hasKey {
-		duration := time.Now().Sub(*lastExceededTime)
-		if duration > 30*time.Minute {
-			return false
-		}
+	if c.dailyRequestLimitReached(c.dailyQuotaAccount(), model) {
 		return true
 	}
+	if lastExceededTime, hasKey := c.modelQuotaExceededAt(model); hasKey {
+		return c.inQuotaCooldown(model, lastExceededTime)
+	}
 	return false
 }
 
 // getPreviewModel returns an available preview model for the given base model,
 // or an empty string if no preview models are available or all are quota exceeded.
 //
+// Preview quota state is kept per account: a preview model exhausted on one account is
+// still tried on others, because preview quotas are usually granted per project. Only
+// this account's state is consulted, and it is safe for concurrent requests.
+//
 // Parameters:
 //   - model: The base model name.
 //
@@ -747,7 +1018,7 @@ func (c *GeminiCLIClient) CheckCloudAPIIsEnabled() (bool, error) {
 	c.RequestMutex.Lock()
 
 	// A simple request to test the API endpoint.
-	requestBody := fmt.Sprintf(`{"project":"%s","request":{"contents":[{"role":"user","parts":[{"text":"Be concise. What is the capital of France?"}]}],"generationConfig":{"thinkingConfig":{"include_thoughts":false,"thinkingBudget":0}}},"model":"gemini-2.5-flash"}`, c.tokenStorage.(*geminiAuth.GeminiTokenStorage).ProjectID)
+	requestBody := fmt.Sprintf(`{"project":"%s","request":{"contents":[{"role":"user","parts":[{"text":"Be concise. What is the capital of France?"}]}],"generationConfig":{"thinkingConfig":{"include_thoughts":false,"thinkingBudget":0}}},"model":"gemini-2.5-flash"}`, c.GetProjectID())
 
 	stream, err := c.APIRequest(ctx, "gemini-2.5-flash", "streamGenerateContent", []byte(requestBody), "", true)
 	if err != nil {
@@ -762,7 +1033,7 @@ func (c *GeminiCLIClient) CheckCloudAPIIsEnabled() (bool, error) {
 						"\n\nPlease activate your account with this url:\n\n%s\n\n And execute this command again:\n%s --login --project_id %s",
 						activationURL,
 						os.Args[0],
-						c.tokenStorage.(*geminiAuth.GeminiTokenStorage).ProjectID,
+						c.GetProjectID(),
 					)
 				}
 			}
@@ -830,6 +1101,13 @@ func (c *GeminiCLIClient) GetProjectList(ctx context.Context) (*interfaces.GCPPr
 // Returns:
 //   - error: An error if the save operation fails, nil otherwise.
 func (c *GeminiCLIClient) SaveTokenToFile() error {
+	c.tokenMutex.Lock()
+	defer c.tokenMutex.Unlock()
+	return c.saveTokenFile()
+}
+
+// saveTokenFile writes the token storage to its file. The caller must hold tokenMutex.
+func (c *GeminiCLIClient) saveTokenFile() error {
 	fileName := filepath.Join(c.cfg.AuthDir, fmt.Sprintf("%s-%s.json", c.tokenStorage.(*geminiAuth.GeminiTokenStorage).Email, c.tokenStorage.(*geminiAuth.GeminiTokenStorage).ProjectID))
 	return c.tokenStorage.SaveTokenToFile(fileName)
 }
@@ -871,14 +1149,66 @@ func (c *GeminiCLIClient) GetRequestMutex() *sync.Mutex {
 	return nil
 }
 
-// RefreshTokens is not applicable for Gemini CLI clients as they use API keys.
+// RefreshTokens forces a refresh of the OAuth2 access token, makes the HTTP client use the
+// new token, and persists it to the token file. The HTTP client itself is not replaced, since
+// requests in flight use it; only the token source of its transport is.
+//
+// Parameters:
+//   - ctx: The context for the refresh request
+//
+// Returns:
+//   - error: An error if the refresh or the save fails, nil otherwise
 func (c *GeminiCLIClient) RefreshTokens(ctx context.Context) error {
-	// API keys don't need refreshing
-	return nil
+	ts, ok := c.tokenStorage.(*geminiAuth.GeminiTokenStorage)
+	if !ok {
+		return fmt.Errorf("unexpected token storage type %T", c.tokenStorage)
+	}
+
+	// The token is refreshed on a copy of the storage, so that the storage is not locked
+	// while the refresh request is in flight.
+	c.tokenMutex.RLock()
+	refreshed := *ts
+	c.tokenMutex.RUnlock()
+
+	auth := geminiAuth.NewGeminiAuth()
+	if err := auth.RefreshToken(ctx, &refreshed, c.cfg); err != nil {
+		return err
+	}
+	httpClient, err := auth.GetAuthenticatedClient(context.Background(), &refreshed, c.cfg)
+	if err != nil {
+		return err
+	}
+
+	c.tokenMutex.Lock()
+	defer c.tokenMutex.Unlock()
+	ts.Token = refreshed.Token
+	if err = c.replaceTokenSource(httpClient); err != nil {
+		return err
+	}
+	return c.saveTokenFile()
 }
 
-// IsAvailable returns true if the client is available for use.
+// CurrentToken returns the access token currently used by the client, refreshing it first
+// if it has already expired.
+//
+// Returns:
+//   - *oauth2.Token: The current token
+//   - error: An error if the token cannot be obtained
+func (c *GeminiCLIClient) CurrentToken() (*oauth2.Token, error) {
+	transport, ok := c.httpClient.Transport.(*oauth2.Transport)
+	if !ok {
+		return nil, fmt.Errorf("unexpected transport type %T", c.httpClient.Transport)
+	}
+	return transport.Source.Token()
+}
+
+// IsAvailable returns true if the client is available for use. An account whose last
+// background health check failed is unavailable until a later check succeeds, and an
+// account that lost access to its project is unavailable until it has a usable project.
 func (c *GeminiCLIClient) IsAvailable() bool {
+	if health := c.Health(); (health.Checked && !health.Healthy) || health.ProjectAccessLost {
+		return false
+	}
 	return c.isAvailable
 }
 
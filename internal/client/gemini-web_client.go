@@ -405,7 +405,7 @@ func (c *GeminiWebClient) SendRawMessage(ctx context.Context, modelName string,
 		return nil, prepErr
 	}
 	defer geminiWeb.CleanupFiles(prep.uploaded)
-	log.Debugf("Use Gemini Web account %s for model %s", c.GetEmail(), modelName)
+	log.Debugf("Use Gemini Web account %s for model %s (request %s)", util.AccountLabel(c.cfg, c.GetEmail()), modelName, RequestID(ctx))
 	out, genErr := geminiWeb.SendWithSplit(prep.chat, prep.prompt, prep.uploaded, c.cfg)
 	if genErr != nil {
 		return nil, c.handleSendError(genErr, modelName)
@@ -441,7 +441,7 @@ func (c *GeminiWebClient) SendRawMessageStream(ctx context.Context, modelName st
 			return
 		}
 		defer geminiWeb.CleanupFiles(prep.uploaded)
-		log.Debugf("Use Gemini Web account %s for model %s", c.GetEmail(), modelName)
+		log.Debugf("Use Gemini Web account %s for model %s (request %s)", util.AccountLabel(c.cfg, c.GetEmail()), modelName, RequestID(ctx))
 		out, genErr := geminiWeb.SendWithSplit(prep.chat, prep.prompt, prep.uploaded, c.cfg)
 		if genErr != nil {
 			errChan <- c.handleSendError(genErr, modelName)
@@ -674,7 +674,7 @@ func (c *GeminiWebClient) SendRawMessageStream(ctx context.Context, modelName st
 			}
 		}
 	}()
-	return dataChan, errChan
+	return c.bufferStream(ctx, dataChan, errChan)
 }
 
 func (c *GeminiWebClient) handleSendError(genErr error, modelName string) *interfaces.ErrorMessage {
@@ -885,7 +885,7 @@ func (c *GeminiWebClient) startCookiePersist() {
 
 func (c *GeminiWebClient) IsModelQuotaExceeded(model string) bool {
 	if t, ok := c.modelQuotaExceeded[model]; ok {
-		return time.Since(*t) <= 30*time.Minute
+		return c.inQuotaCooldown(model, *t)
 	}
 	return false
 }
@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
 	"sync"
 	"time"
 
@@ -22,6 +23,7 @@ import (
 	"github.com/luispater/CLIProxyAPI/v5/internal/translator/translator"
 	"github.com/luispater/CLIProxyAPI/v5/internal/util"
 	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
 )
 
 const (
@@ -76,6 +78,16 @@ func (c *GeminiClient) Provider() string {
 	return GEMINI
 }
 
+// Weight returns the relative share of requests for the API key of this client, configured
+// in generative-language-api-key-weights. Keys without a positive weight have a weight of 1.
+func (c *GeminiClient) Weight() int {
+	index := slices.Index(c.cfg.GlAPIKey, c.glAPIKey)
+	if index >= 0 && index < len(c.cfg.GlAPIKeyWeights) && c.cfg.GlAPIKeyWeights[index] > 0 {
+		return c.cfg.GlAPIKeyWeights[index]
+	}
+	return 1
+}
+
 // CanProvideModel checks if this client can provide the specified model.
 //
 // Parameters:
@@ -97,6 +109,11 @@ func (c *GeminiClient) GetEmail() string {
 	return c.glAPIKey
 }
 
+// dailyQuotaAccount returns the identifier used to track daily request counts for this client.
+func (c *GeminiClient) dailyQuotaAccount() string {
+	return util.HideAPIKey(c.glAPIKey)
+}
+
 // APIRequest handles making requests to the CLI API endpoints.
 //
 // Parameters:
@@ -124,9 +141,9 @@ func (c *GeminiClient) APIRequest(ctx context.Context, modelName, endpoint strin
 
 	var url string
 	if endpoint == "countTokens" {
-		url = fmt.Sprintf("%s/%s/models/%s:%s", glEndPoint, glAPIVersion, modelName, endpoint)
+		url = fmt.Sprintf("%s/%s/models/%s:%s", glEndPoint, c.resolveAPIVersion(GEMINI), modelName, endpoint)
 	} else {
-		url = fmt.Sprintf("%s/%s/models/%s:%s", glEndPoint, glAPIVersion, modelName, endpoint)
+		url = fmt.Sprintf("%s/%s/models/%s:%s", glEndPoint, c.resolveAPIVersion(GEMINI), modelName, endpoint)
 		if alt == "" && stream {
 			url = url + "?alt=sse"
 		} else {
@@ -147,20 +164,33 @@ func (c *GeminiClient) APIRequest(ctx context.Context, modelName, endpoint strin
 
 	// Set headers
 	req.Header.Set("Content-Type", "application/json")
+	if requestID := RequestID(ctx); requestID != "-" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
 	req.Header.Set("x-goog-api-key", c.glAPIKey)
+	if errDecorate := decorateRequest(req, c.glAPIKey, jsonBody); errDecorate != nil {
+		return nil, &interfaces.ErrorMessage{StatusCode: 500, Error: fmt.Errorf("failed to decorate request: %v", errDecorate)}
+	}
 
 	if c.cfg.RequestLog {
 		if ginContext, ok := ctx.Value("gin").(*gin.Context); ok {
 			ginContext.Set("API_REQUEST", jsonBody)
 		}
 	}
+	c.ExposeGenerationConfig(ctx, gjson.GetBytes(jsonBody, "generationConfig"))
 
-	log.Debugf("Use Gemini API key %s for model %s", util.HideAPIKey(c.GetEmail()), modelName)
+	log.Debugf("Use Gemini API key %s for model %s (request %s)", util.AccountLabel(c.cfg, c.GetEmail()), modelName, RequestID(ctx))
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.doWithRetry(ctx, req, jsonBody)
+	if err != nil {
+		return nil, &interfaces.ErrorMessage{StatusCode: requestErrorStatus(err), Error: fmt.Errorf("failed to execute request: %v", err)}
+	}
+	resp, err = c.retryAlternateAPIVersions(ctx, GEMINI, req, jsonBody, resp)
 	if err != nil {
 		return nil, &interfaces.ErrorMessage{StatusCode: 500, Error: fmt.Errorf("failed to execute request: %v", err)}
 	}
+	resp = c.CaptureExchange(ctx, GEMINI, req, jsonBody, resp)
+	resp = c.LogUpstreamExchange(ctx, req, jsonBody, resp)
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		defer func() {
@@ -170,7 +200,13 @@ func (c *GeminiClient) APIRequest(ctx context.Context, modelName, endpoint strin
 		}()
 		bodyBytes, _ := io.ReadAll(resp.Body)
 		// log.Debug(string(jsonBody))
-		return nil, &interfaces.ErrorMessage{StatusCode: resp.StatusCode, Error: fmt.Errorf("%s", string(bodyBytes))}
+		errMsg := &interfaces.ErrorMessage{StatusCode: resp.StatusCode, Error: fmt.Errorf("%s", string(bodyBytes)), Addon: retryAfterAddon(resp.StatusCode, resp.Header, bodyBytes)}
+		if c.cfg.Debug {
+			if errMsg.Upstream = parseUpstreamError(bodyBytes); errMsg.Upstream != nil {
+				log.Debugf("Gemini upstream error (request %s): code=%d status=%s message=%s details=%s", RequestID(ctx), errMsg.Upstream.Code, errMsg.Upstream.Status, errMsg.Upstream.Message, errMsg.Upstream.Details)
+			}
+		}
+		return nil, errMsg
 	}
 
 	return resp.Body, nil
@@ -190,11 +226,8 @@ func (c *GeminiClient) APIRequest(ctx context.Context, modelName, endpoint strin
 func (c *GeminiClient) SendRawTokenCount(ctx context.Context, modelName string, rawJSON []byte, alt string) ([]byte, *interfaces.ErrorMessage) {
 	originalRequestRawJSON := bytes.Clone(rawJSON)
 	for {
-		if c.IsModelQuotaExceeded(modelName) {
-			return nil, &interfaces.ErrorMessage{
-				StatusCode: 429,
-				Error:      fmt.Errorf(`{"error":{"code":429,"message":"All the models of '%s' are quota exceeded","status":"RESOURCE_EXHAUSTED"}}`, modelName),
-			}
+		if !quotaCheckBypassed(ctx) && c.IsModelQuotaExceeded(modelName) {
+			return nil, c.quotaExceededError(modelName, util.AccountLabel(c.cfg, c.GetEmail()), "", []string{modelName})
 		}
 
 		handler := ctx.Value("handler").(interfaces.APIHandler)
@@ -203,17 +236,12 @@ func (c *GeminiClient) SendRawTokenCount(ctx context.Context, modelName string,
 
 		respBody, err := c.APIRequest(ctx, modelName, "countTokens", rawJSON, alt, false)
 		if err != nil {
-			if err.StatusCode == 429 {
-				now := time.Now()
-				c.modelQuotaExceeded[modelName] = &now
-				// Update model registry quota status
-				c.SetModelQuotaExceeded(modelName)
+			if err.StatusCode == http.StatusTooManyRequests {
+				c.markModelQuotaExceeded(modelName, retryAfterOf(err))
 			}
 			return nil, err
 		}
-		delete(c.modelQuotaExceeded, modelName)
-		// Clear quota status in model registry
-		c.ClearModelQuotaExceeded(modelName)
+		c.clearModelQuotaExceeded(modelName)
 		bodyBytes, errReadAll := io.ReadAll(respBody)
 		if errReadAll != nil {
 			return nil, &interfaces.ErrorMessage{StatusCode: 500, Error: errReadAll}
@@ -244,27 +272,39 @@ func (c *GeminiClient) SendRawMessage(ctx context.Context, modelName string, raw
 	handler := ctx.Value("handler").(interfaces.APIHandler)
 	handlerType := handler.HandlerType()
 	rawJSON = translator.Request(handlerType, c.Type(), modelName, rawJSON, false)
+	rawJSON = c.applyRequestOptions(modelName, rawJSON, "")
+	rawJSON = c.applyDefaultGrounding(ctx, modelName, rawJSON, "")
+	rawJSON, errLimit := c.limitToolDeclarations(rawJSON, "")
+	if errLimit != nil {
+		return nil, errLimit
+	}
+	rawJSON, errSampling := c.checkSamplingParams(rawJSON, "")
+	if errSampling != nil {
+		return nil, errSampling
+	}
+	summarized := false
+	if c.exceedsSummarizationTrigger(rawJSON, "") {
+		rawJSON, summarized = c.summarizeHistory(ctx, rawJSON, "", c.generateSummary)
+	}
 
-	if c.IsModelQuotaExceeded(modelName) {
-		return nil, &interfaces.ErrorMessage{
-			StatusCode: 429,
-			Error:      fmt.Errorf(`{"error":{"code":429,"message":"All the models of '%s' are quota exceeded","status":"RESOURCE_EXHAUSTED"}}`, modelName),
-		}
+	if !quotaCheckBypassed(ctx) && c.IsModelQuotaExceeded(modelName) {
+		return nil, c.quotaExceededError(modelName, util.AccountLabel(c.cfg, c.GetEmail()), "", []string{modelName})
 	}
 
 	respBody, err := c.APIRequest(ctx, modelName, "generateContent", rawJSON, alt, false)
+	if err != nil && !summarized && isContextOverflow(err) {
+		if rawJSON, summarized = c.summarizeHistory(ctx, rawJSON, "", c.generateSummary); summarized {
+			respBody, err = c.APIRequest(ctx, modelName, "generateContent", rawJSON, alt, false)
+		}
+	}
 	if err != nil {
-		if err.StatusCode == 429 {
-			now := time.Now()
-			c.modelQuotaExceeded[modelName] = &now
-			// Update model registry quota status
-			c.SetModelQuotaExceeded(modelName)
+		if err.StatusCode == http.StatusTooManyRequests {
+			c.markModelQuotaExceeded(modelName, retryAfterOf(err))
 		}
 		return nil, err
 	}
-	delete(c.modelQuotaExceeded, modelName)
-	// Clear quota status in model registry
-	c.ClearModelQuotaExceeded(modelName)
+	c.clearModelQuotaExceeded(modelName)
+	c.recordDailyRequest(c.dailyQuotaAccount(), modelName)
 	bodyBytes, errReadAll := io.ReadAll(respBody)
 	if errReadAll != nil {
 		return nil, &interfaces.ErrorMessage{StatusCode: 500, Error: errReadAll}
@@ -273,6 +313,25 @@ func (c *GeminiClient) SendRawMessage(ctx context.Context, modelName string, raw
 	_ = respBody.Close()
 	c.AddAPIResponseData(ctx, bodyBytes)
 	// log.Debugf("Gemini response: %s", string(bodyBytes))
+	rawJSON, bodyBytes = c.retryOnRecitation(ctx, modelName, rawJSON, bodyBytes, "", func(retryJSON []byte) ([]byte, *interfaces.ErrorMessage) {
+		return c.sendRetry(ctx, modelName, retryJSON, alt)
+	})
+	rawJSON, bodyBytes, errValidation := c.retryInvalidStructuredOutput(ctx, modelName, rawJSON, bodyBytes, "", func(retryJSON []byte) ([]byte, *interfaces.ErrorMessage) {
+		return c.sendRetry(ctx, modelName, retryJSON, alt)
+	})
+	if errValidation != nil {
+		return nil, errValidation
+	}
+	rawJSON, bodyBytes = c.checkResponseLanguage(ctx, modelName, rawJSON, bodyBytes, "", func(retryJSON []byte) ([]byte, *interfaces.ErrorMessage) {
+		return c.sendRetry(ctx, modelName, retryJSON, alt)
+	})
+	validator := newResponseValidator(modelName, util.AccountLabel(c.cfg, c.GetEmail()))
+	validator.observe(bodyBytes)
+	validator.finish()
+
+	bodyBytes = c.newThoughtFormatter(ctx, modelName).apply(bodyBytes)
+	bodyBytes = c.applyFinishMessage(bodyBytes)
+	bodyBytes, _ = c.newResponseSizeLimiter(ctx).apply(bodyBytes)
 
 	var param any
 	output := []byte(translator.ResponseNonStream(handlerType, c.Type(), ctx, modelName, originalRequestRawJSON, rawJSON, bodyBytes, &param))
@@ -280,6 +339,40 @@ func (c *GeminiClient) SendRawMessage(ctx context.Context, modelName string, raw
 	return output, nil
 }
 
+// sendRetry sends a non-streaming generateContent request and returns the raw response.
+func (c *GeminiClient) sendRetry(ctx context.Context, modelName string, rawJSON []byte, alt string) ([]byte, *interfaces.ErrorMessage) {
+	respBody, errMsg := c.APIRequest(ctx, modelName, "generateContent", rawJSON, alt, false)
+	if errMsg != nil {
+		return nil, errMsg
+	}
+	defer func() {
+		_ = respBody.Close()
+	}()
+	bodyBytes, errReadAll := io.ReadAll(respBody)
+	if errReadAll != nil {
+		return nil, &interfaces.ErrorMessage{StatusCode: 500, Error: errReadAll}
+	}
+	c.AddAPIResponseData(ctx, bodyBytes)
+	return bodyBytes, nil
+}
+
+// generateSummary sends a bare Gemini request to the Generative Language API. It is used
+// to summarize conversation history that overflows the context window.
+func (c *GeminiClient) generateSummary(ctx context.Context, modelName string, request []byte) ([]byte, *interfaces.ErrorMessage) {
+	respBody, errMsg := c.APIRequest(ctx, modelName, "generateContent", request, "", false)
+	if errMsg != nil {
+		return nil, errMsg
+	}
+	defer func() {
+		_ = respBody.Close()
+	}()
+	bodyBytes, errReadAll := io.ReadAll(respBody)
+	if errReadAll != nil {
+		return nil, &interfaces.ErrorMessage{StatusCode: 500, Error: errReadAll}
+	}
+	return bodyBytes, nil
+}
+
 // SendRawMessageStream handles a single conversational turn, including tool calls.
 //
 // Parameters:
@@ -292,11 +385,18 @@ func (c *GeminiClient) SendRawMessage(ctx context.Context, modelName string, raw
 //   - <-chan []byte: A channel for receiving response data chunks.
 //   - <-chan *interfaces.ErrorMessage: A channel for receiving error messages.
 func (c *GeminiClient) SendRawMessageStream(ctx context.Context, modelName string, rawJSON []byte, alt string) (<-chan []byte, <-chan *interfaces.ErrorMessage) {
+	timer := newFirstTokenTimer(ctx, modelName, c.cfg.Metrics.TTFTExcludeThinking)
 	originalRequestRawJSON := bytes.Clone(rawJSON)
 
 	handler := ctx.Value("handler").(interfaces.APIHandler)
 	handlerType := handler.HandlerType()
 	rawJSON = translator.Request(handlerType, c.Type(), modelName, rawJSON, true)
+	rawJSON = c.applyRequestOptions(modelName, rawJSON, "")
+	rawJSON = c.applyDefaultGrounding(ctx, modelName, rawJSON, "")
+	rawJSON, errLimit := c.limitToolDeclarations(rawJSON, "")
+	if errLimit == nil {
+		rawJSON, errLimit = c.checkSamplingParams(rawJSON, "")
+	}
 
 	dataTag := []byte("data: ")
 	errChan := make(chan *interfaces.ErrorMessage)
@@ -307,88 +407,133 @@ func (c *GeminiClient) SendRawMessageStream(ctx context.Context, modelName strin
 		defer close(errChan)
 		defer close(dataChan)
 
+		if errLimit != nil {
+			errChan <- errLimit
+			return
+		}
+		summarized := false
+		if c.exceedsSummarizationTrigger(rawJSON, "") {
+			rawJSON, summarized = c.summarizeHistory(ctx, rawJSON, "", c.generateSummary)
+		}
+
 		var stream io.ReadCloser
-		if c.IsModelQuotaExceeded(modelName) {
-			errChan <- &interfaces.ErrorMessage{
-				StatusCode: 429,
-				Error:      fmt.Errorf(`{"error":{"code":429,"message":"All the models of '%s' are quota exceeded","status":"RESOURCE_EXHAUSTED"}}`, modelName),
-			}
+		if !quotaCheckBypassed(ctx) && c.IsModelQuotaExceeded(modelName) {
+			errChan <- c.quotaExceededError(modelName, util.AccountLabel(c.cfg, c.GetEmail()), "", []string{modelName})
 			return
 		}
 		var err *interfaces.ErrorMessage
 		stream, err = c.APIRequest(ctx, modelName, "streamGenerateContent", rawJSON, alt, true)
+		if err != nil && !summarized && isContextOverflow(err) {
+			if rawJSON, summarized = c.summarizeHistory(ctx, rawJSON, "", c.generateSummary); summarized {
+				stream, err = c.APIRequest(ctx, modelName, "streamGenerateContent", rawJSON, alt, true)
+			}
+		}
 		if err != nil {
-			if err.StatusCode == 429 {
-				now := time.Now()
-				c.modelQuotaExceeded[modelName] = &now
-				// Update model registry quota status
-				c.SetModelQuotaExceeded(modelName)
+			if err.StatusCode == http.StatusTooManyRequests {
+				c.markModelQuotaExceeded(modelName, retryAfterOf(err))
 			}
 			errChan <- err
 			return
 		}
-		delete(c.modelQuotaExceeded, modelName)
-		// Clear quota status in model registry
-		c.ClearModelQuotaExceeded(modelName)
+		c.clearModelQuotaExceeded(modelName)
+		c.recordDailyRequest(c.dailyQuotaAccount(), modelName)
 		defer func() {
 			_ = stream.Close()
 		}()
 
+		stopWatching := closeStreamOnCancel(ctx, stream)
+		defer stopWatching()
+
 		newCtx := context.WithValue(ctx, "alt", alt)
+		newCtx = context.WithValue(newCtx, "flushToolCalls", c.flushToolCalls(modelName))
 		var param any
+		validator := newResponseValidator(modelName, util.AccountLabel(c.cfg, c.GetEmail()))
+		trimmer := newLeadingWhitespaceTrimmer(c.cfg.TrimLeadingWhitespace)
+		duplicates := newDuplicateChunkFilter(c.cfg.DropDuplicateChunks, modelName)
+		stopOnToolCall := c.stopOnToolCall(modelName)
+		limiter := c.newResponseSizeLimiter(ctx)
+		thoughts := c.newThoughtFormatter(ctx, modelName)
 		if alt == "" {
 			scanner := bufio.NewScanner(stream)
-			if translator.NeedConvert(handlerType, c.Type()) {
-				for scanner.Scan() {
-					line := scanner.Bytes()
-					if bytes.HasPrefix(line, dataTag) {
-						lines := translator.Response(handlerType, c.Type(), newCtx, modelName, originalRequestRawJSON, rawJSON, line[6:], &param)
-						for i := 0; i < len(lines); i++ {
-							dataChan <- []byte(lines[i])
-						}
-					}
-					c.AddAPIResponseData(ctx, line)
+			buffer := c.newStreamBuffer(func(chunk []byte) {
+				if !translator.NeedConvert(handlerType, c.Type()) {
+					sendChunk(ctx, dataChan, chunk)
+					return
 				}
-			} else {
-				for scanner.Scan() {
-					line := scanner.Bytes()
-					if bytes.HasPrefix(line, dataTag) {
-						dataChan <- line[6:]
-					}
-					c.AddAPIResponseData(ctx, line)
+				lines := translator.Response(handlerType, c.Type(), newCtx, modelName, originalRequestRawJSON, rawJSON, chunk, &param)
+				for i := 0; i < len(lines); i++ {
+					sendChunk(ctx, dataChan, []byte(lines[i]))
+				}
+			})
+			defer buffer.close()
+			for scanner.Scan() {
+				if ctx.Err() != nil {
+					break
+				}
+				line, streamError := c.replaceStreamError(ctx, modelName, scanner.Bytes(), false)
+				truncated := false
+				if bytes.HasPrefix(line, dataTag) && !duplicates.duplicate(line[6:]) {
+					validator.observe(line[6:])
+					timer.observe(line[6:])
+					var chunk []byte
+					chunk, truncated = limiter.apply(trimmer.trim(c.applyFinishMessage(thoughts.apply(line[6:]))))
+					buffer.add(chunk)
+				}
+				c.AddAPIResponseData(ctx, line)
+				if streamError {
+					break
+				}
+				if truncated {
+					log.Debugf("Stop streaming model %s at the response size limit", modelName)
+					break
+				}
+				if stopOnToolCall && bytes.HasPrefix(line, dataTag) && containsFunctionCall(line[6:]) {
+					log.Debugf("Stop streaming model %s after tool call", modelName)
+					break
 				}
 			}
+			buffer.close()
 
+			if streamCancelled(ctx, modelName) {
+				return
+			}
 			if errScanner := scanner.Err(); errScanner != nil {
-				errChan <- &interfaces.ErrorMessage{StatusCode: 500, Error: errScanner}
+				errChan <- &interfaces.ErrorMessage{StatusCode: requestErrorStatus(errScanner), Error: errScanner}
 				_ = stream.Close()
 				return
 			}
 
 		} else {
 			data, errReadAll := io.ReadAll(stream)
+			if streamCancelled(ctx, modelName) {
+				return
+			}
 			if errReadAll != nil {
 				errChan <- &interfaces.ErrorMessage{StatusCode: 500, Error: errReadAll}
 				_ = stream.Close()
 				return
 			}
+			validator.observe(data)
+			timer.observe(data)
+			chunk, _ := limiter.apply(trimmer.trim(c.applyFinishMessage(thoughts.apply(data))))
 
 			if translator.NeedConvert(handlerType, c.Type()) {
-				lines := translator.Response(handlerType, c.Type(), newCtx, modelName, originalRequestRawJSON, rawJSON, data, &param)
+				lines := translator.Response(handlerType, c.Type(), newCtx, modelName, originalRequestRawJSON, rawJSON, chunk, &param)
 				for i := 0; i < len(lines); i++ {
-					dataChan <- []byte(lines[i])
+					sendChunk(ctx, dataChan, []byte(lines[i]))
 				}
 			} else {
-				dataChan <- data
+				sendChunk(ctx, dataChan, chunk)
 			}
 
 			c.AddAPIResponseData(ctx, data)
 		}
+		validator.finish()
 
 		if translator.NeedConvert(handlerType, c.Type()) {
 			lines := translator.Response(handlerType, c.Type(), ctx, modelName, rawJSON, originalRequestRawJSON, []byte("[DONE]"), &param)
 			for i := 0; i < len(lines); i++ {
-				dataChan <- []byte(lines[i])
+				sendChunk(ctx, dataChan, []byte(lines[i]))
 			}
 		}
 
@@ -396,7 +541,7 @@ func (c *GeminiClient) SendRawMessageStream(ctx context.Context, modelName strin
 
 	}()
 
-	return dataChan, errChan
+	return c.bufferStream(ctx, dataChan, errChan)
 }
 
 // IsModelQuotaExceeded returns true if the specified model has exceeded its quota
@@ -408,13 +553,12 @@ func (c *GeminiClient) SendRawMessageStream(ctx context.Context, modelName strin
 // Returns:
 //   - bool: True if the model's quota is exceeded, false otherwise.
 func (c *GeminiClient) IsModelQuotaExceeded(model string) bool {
-	if lastExceededTime, hasKey := c.modelQuotaExceeded[model]; hasKey {
-		duration := time.Now().Sub(*lastExceededTime)
-		if duration > 30*time.Minute {
-			return false
-		}
+	if c.dailyRequestLimitReached(c.dailyQuotaAccount(), model) {
 		return true
 	}
+	if lastExceededTime, hasKey := c.modelQuotaExceededAt(model); hasKey {
+		return c.inQuotaCooldown(model, lastExceededTime)
+	}
 	return false
 }
 
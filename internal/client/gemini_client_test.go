@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+	"github.com/luispater/CLIProxyAPI/v5/internal/metrics"
+)
+
+// roundTripFunc serves the upstream requests of a test client.
+type roundTripFunc func(*http.Request) *http.Response
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req), nil
+}
+
+// testHandler is the API handler of test requests, whose format is passed through unchanged.
+type testHandler struct{ handlerType string }
+
+func (h testHandler) HandlerType() string      { return h.handlerType }
+func (h testHandler) Models() []map[string]any { return nil }
+
+// cannedResponse returns an upstream response with the given status, headers, and body.
+func cannedResponse(statusCode int, header http.Header, body string) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{StatusCode: statusCode, Header: header, Body: io.NopCloser(strings.NewReader(body))}
+}
+
+// testRequestContext returns the context of a request in the format of handlerType. With
+// ignoreQuota, the request is sent even if the model is quota exceeded.
+func testRequestContext(handlerType string, ignoreQuota bool) context.Context {
+	ginContext, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ginContext.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	ginContext.Set("ignoreQuota", ignoreQuota)
+	ctx := context.WithValue(context.Background(), "gin", ginContext)
+	return context.WithValue(ctx, "handler", testHandler{handlerType: handlerType})
+}
+
+func TestGeminiClientQuotaCooldownHonorsRetryAfter(t *testing.T) {
+	const model = "gemini-2.5-flash"
+	status := http.StatusTooManyRequests
+	c := NewGeminiClient(&http.Client{Transport: roundTripFunc(func(*http.Request) *http.Response {
+		if status == http.StatusTooManyRequests {
+			return cannedResponse(status, http.Header{"Retry-After": []string{"120"}}, `{"error":{"code":429,"status":"RESOURCE_EXHAUSTED"}}`)
+		}
+		return cannedResponse(status, nil, `{"totalTokens":7}`)
+	})}, &config.Config{}, "test-key-retry-after")
+	quotaExceeded := metrics.QuotaExceeded.Value(model)
+
+	_, err := c.CountTokens(testRequestContext(GEMINI, false), model, []byte(`{"contents":[]}`))
+	if err == nil || err.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("CountTokens() error = %v, want a 429", err)
+	}
+	if !c.IsModelQuotaExceeded(model) {
+		t.Fatal("model is not quota exceeded after a 429")
+	}
+	if remaining := time.Until(c.QuotaRecoveryAt(model)); remaining < 110*time.Second || remaining > 120*time.Second {
+		t.Errorf("cooldown = %s, want the 120s of Retry-After", remaining)
+	}
+	if got := metrics.QuotaExceeded.Value(model) - quotaExceeded; got != 1 {
+		t.Errorf("quota exceeded counter increased by %v, want 1", got)
+	}
+
+	status = http.StatusOK
+	if _, err = c.CountTokens(testRequestContext(GEMINI, true), model, []byte(`{"contents":[]}`)); err != nil {
+		t.Fatalf("CountTokens() error = %v", err)
+	}
+	if c.IsModelQuotaExceeded(model) {
+		t.Error("model is still quota exceeded after a successful request")
+	}
+}
+
+func TestGeminiClientQuotaStateIsSafeForConcurrentRequests(t *testing.T) {
+	const model = "gemini-2.5-pro"
+	c := NewGeminiClient(&http.Client{Transport: roundTripFunc(func(req *http.Request) *http.Response {
+		if strings.Contains(req.URL.Path, "countTokens") {
+			return cannedResponse(http.StatusTooManyRequests, nil, `{"error":{"code":429}}`)
+		}
+		return cannedResponse(http.StatusOK, nil, `{"candidates":[]}`)
+	})}, &config.Config{}, "test-key-concurrent")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx := testRequestContext(GEMINI, true)
+			if i%2 == 0 {
+				_, _ = c.CountTokens(ctx, model, []byte(`{"contents":[]}`))
+			} else {
+				_, _ = c.SendRawMessage(ctx, model, []byte(`{"contents":[]}`), "")
+			}
+			_ = c.IsModelQuotaExceeded(model)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestResponseMetricsUseAccountLabel(t *testing.T) {
+	const model = "gemini-2.5-flash-lite"
+	cfg := &config.Config{AccountAliases: map[string]string{"test-key-label": "team-a"}}
+	c := NewGeminiClient(&http.Client{Transport: roundTripFunc(func(*http.Request) *http.Response {
+		return cannedResponse(http.StatusOK, nil, `{"candidates":[{"content":{"role":"model","parts":[]},"finishReason":"STOP"}]}`)
+	})}, cfg, "test-key-label")
+	emptyResponses := metrics.EmptyResponses.Value(model, "team-a")
+
+	if _, err := c.SendRawMessage(testRequestContext(GEMINI, false), model, []byte(`{"contents":[{"role":"user","parts":[{"text":"hi"}]}]}`), ""); err != nil {
+		t.Fatalf("SendRawMessage() error = %v", err.Error)
+	}
+	if got := metrics.EmptyResponses.Value(model, "team-a") - emptyResponses; got != 1 {
+		t.Errorf("empty responses of team-a increased by %v, want 1", got)
+	}
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"context"
+	"path"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// NoGroundingHeader asks the proxy not to add Google Search grounding to a request to one
+// of the default-grounding-models.
+const NoGroundingHeader = "X-CLIProxy-No-Grounding"
+
+// searchToolKeys lists the field names of the Gemini tools that ground a request with Google Search.
+var searchToolKeys = []string{"googleSearch", "google_search", "googleSearchRetrieval", "google_search_retrieval"}
+
+// applyDefaultGrounding adds the googleSearch tool to a request for one of the
+// default-grounding-models, so that its answers are grounded without every client enabling
+// search. Nothing is added to requests carrying NoGroundingHeader: true, requests that
+// already use a search tool, or requests declaring functions, which Gemini does not accept
+// together with search.
+//
+// Parameters:
+//   - ctx: The context for the request
+//   - modelName: The model the request is sent to
+//   - rawJSON: The translated Gemini request
+//   - pathPrefix: The prefix of the Gemini request body ("request." for Gemini CLI, "" for Gemini)
+//
+// Returns:
+//   - []byte: The request, with the googleSearch tool if grounding applies
+func (c *ClientBase) applyDefaultGrounding(ctx context.Context, modelName string, rawJSON []byte, pathPrefix string) []byte {
+	if !c.groundsModel(modelName) {
+		return rawJSON
+	}
+	if ginContext, ok := ctx.Value("gin").(*gin.Context); ok {
+		if optOut, err := strconv.ParseBool(ginContext.GetHeader(NoGroundingHeader)); err == nil && optOut {
+			return rawJSON
+		}
+	}
+
+	tools := gjson.GetBytes(rawJSON, pathPrefix+"tools")
+	for _, tool := range tools.Array() {
+		for _, key := range searchToolKeys {
+			if tool.Get(key).Exists() {
+				return rawJSON
+			}
+		}
+		for _, key := range functionDeclarationKeys {
+			if len(tool.Get(key).Array()) > 0 {
+				log.Debugf("Not grounding request %s to %s, which declares functions", RequestID(ctx), modelName)
+				return rawJSON
+			}
+		}
+	}
+
+	if !tools.IsArray() {
+		rawJSON, _ = sjson.SetRawBytes(rawJSON, pathPrefix+"tools", []byte(`[]`))
+	}
+	rawJSON, _ = sjson.SetRawBytes(rawJSON, pathPrefix+"tools.-1", []byte(`{"googleSearch":{}}`))
+	return rawJSON
+}
+
+// groundsModel reports whether a model is listed in default-grounding-models. Entries may
+// contain the wildcards supported by path.Match, for example "gemini-2.5-pro*".
+func (c *ClientBase) groundsModel(modelName string) bool {
+	for _, pattern := range c.cfg.DefaultGroundingModels {
+		if matched, _ := path.Match(pattern, modelName); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+	"github.com/tidwall/gjson"
+)
+
+func TestApplyDefaultGrounding(t *testing.T) {
+	tests := []struct {
+		name       string
+		models     []string
+		model      string
+		optOut     string
+		pathPrefix string
+		request    string
+		want       string
+	}{
+		{name: "configured model", models: []string{"gemini-2.5-pro"}, model: "gemini-2.5-pro", request: `{"contents":[]}`, want: `[{"googleSearch":{}}]`},
+		{name: "wildcard", models: []string{"gemini-2.5-*"}, model: "gemini-2.5-flash", request: `{"contents":[]}`, want: `[{"googleSearch":{}}]`},
+		{name: "Gemini CLI request", models: []string{"gemini-2.5-pro"}, model: "gemini-2.5-pro", pathPrefix: "request.", request: `{"request":{"contents":[]}}`, want: `[{"googleSearch":{}}]`},
+		{name: "other tools kept", models: []string{"gemini-2.5-pro"}, model: "gemini-2.5-pro", request: `{"tools":[{"codeExecution":{}}]}`, want: `[{"codeExecution":{}},{"googleSearch":{}}]`},
+		{name: "other model", models: []string{"gemini-2.5-pro"}, model: "gemini-2.5-flash", request: `{"contents":[]}`, want: ``},
+		{name: "opted out", models: []string{"gemini-2.5-pro"}, model: "gemini-2.5-pro", optOut: "true", request: `{"contents":[]}`, want: ``},
+		{name: "opt-out false", models: []string{"gemini-2.5-pro"}, model: "gemini-2.5-pro", optOut: "false", request: `{"contents":[]}`, want: `[{"googleSearch":{}}]`},
+		{name: "search already enabled", models: []string{"gemini-2.5-pro"}, model: "gemini-2.5-pro", request: `{"tools":[{"google_search":{}}]}`, want: `[{"google_search":{}}]`},
+		{name: "functions declared", models: []string{"gemini-2.5-pro"}, model: "gemini-2.5-pro", request: `{"tools":[{"functionDeclarations":[{"name":"f"}]}]}`, want: `[{"functionDeclarations":[{"name":"f"}]}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &ClientBase{cfg: &config.Config{DefaultGroundingModels: tt.models}}
+			ctx := testRequestContext(GEMINI, true)
+			if tt.optOut != "" {
+				ctx.Value("gin").(*gin.Context).Request.Header.Set(NoGroundingHeader, tt.optOut)
+			}
+
+			got := c.applyDefaultGrounding(ctx, tt.model, []byte(tt.request), tt.pathPrefix)
+			if tools := gjson.GetBytes(got, tt.pathPrefix+"tools").Raw; tools != tt.want {
+				t.Errorf("tools = %s, want %s", tools, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultGroundingIsSentUpstream(t *testing.T) {
+	tests := []struct {
+		name   string
+		optOut bool
+		want   bool
+	}{
+		{name: "grounded by default", want: true},
+		{name: "disabled per request", optOut: true, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var upstream []byte
+			c := NewGeminiClient(&http.Client{Transport: roundTripFunc(func(req *http.Request) *http.Response {
+				upstream, _ = io.ReadAll(req.Body)
+				return cannedResponse(http.StatusOK, nil, `{"candidates":[{"content":{"role":"model","parts":[{"text":"Hi"}]},"finishReason":"STOP"}]}`)
+			})}, &config.Config{DefaultGroundingModels: []string{"gemini-2.5-flash"}}, "test-key-grounding")
+
+			ctx := testRequestContext(GEMINI, true)
+			if tt.optOut {
+				ctx.Value("gin").(*gin.Context).Request.Header.Set(NoGroundingHeader, "true")
+			}
+			if _, err := c.SendRawMessage(ctx, "gemini-2.5-flash", []byte(`{"contents":[{"role":"user","parts":[{"text":"Hi"}]}]}`), ""); err != nil {
+				t.Fatalf("SendRawMessage() error = %v", err.Error)
+			}
+			if got := gjson.GetBytes(upstream, "tools.#(googleSearch).googleSearch").Exists(); got != tt.want {
+				t.Errorf("googleSearch sent = %t, want %t (upstream request %s)", got, tt.want, upstream)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	geminiAuth "github.com/luispater/CLIProxyAPI/v5/internal/auth/gemini"
+	"github.com/tidwall/gjson"
+)
+
+// HealthStatus is the cached result of the background health checks of an account.
+type HealthStatus struct {
+	// Checked reports whether the account has been checked at least once.
+	Checked bool `json:"checked"`
+
+	// Healthy reports whether the last check succeeded.
+	Healthy bool `json:"healthy"`
+
+	// CheckedAt is the time of the last check.
+	CheckedAt time.Time `json:"checked_at"`
+
+	// ConsecutiveFailures is the number of failed checks since the last success.
+	ConsecutiveFailures int `json:"consecutive_failures"`
+
+	// LastError describes why the last check failed.
+	LastError string `json:"last_error,omitempty"`
+
+	// ProjectAccessLost reports whether the account lost access to its project (deleted
+	// project, changed IAM) and no other project has been set up yet. The account needs
+	// attention and is not used until it has a usable project.
+	ProjectAccessLost bool `json:"project_access_lost"`
+
+	// ProjectAccessError describes the lost project access and the outcome of the search
+	// for another project.
+	ProjectAccessError string `json:"project_access_error,omitempty"`
+}
+
+// Health returns the cached health status of the account.
+//
+// Returns:
+//   - HealthStatus: The result of the last health check
+func (c *GeminiCLIClient) Health() HealthStatus {
+	c.healthMutex.RLock()
+	defer c.healthMutex.RUnlock()
+	return c.health
+}
+
+// CheckHealth verifies that the Cloud AI API is usable for the account and caches the result.
+//
+// Returns:
+//   - HealthStatus: The updated health status
+func (c *GeminiCLIClient) CheckHealth() HealthStatus {
+	enabled, err := c.CheckCloudAPIIsEnabled()
+
+	c.healthMutex.Lock()
+	defer c.healthMutex.Unlock()
+	c.health.Checked = true
+	c.health.CheckedAt = time.Now()
+	c.health.Healthy = enabled && err == nil
+	if c.health.Healthy {
+		c.health.ConsecutiveFailures = 0
+		c.health.LastError = ""
+		// The check is sent with the account's project, so the project is usable again.
+		c.health.ProjectAccessLost = false
+		c.health.ProjectAccessError = ""
+	} else {
+		c.health.ConsecutiveFailures++
+		c.health.LastError = "cloud AI API is not enabled"
+		if err != nil {
+			c.health.LastError = err.Error()
+		}
+	}
+	return c.health
+}
+
+// TokenExpiry returns the expiry of the account's OAuth token as last obtained. The token is
+// not refreshed, so that health probes do not cause token requests; an expired token is
+// refreshed by the next request sent with the account.
+//
+// Returns:
+//   - time.Time: When the stored token expires
+//   - error: An error if the stored token has no valid expiry
+func (c *GeminiCLIClient) TokenExpiry() (time.Time, error) {
+	ts, ok := c.tokenStorage.(*geminiAuth.GeminiTokenStorage)
+	if !ok {
+		return time.Time{}, fmt.Errorf("client has no token storage")
+	}
+	c.tokenMutex.RLock()
+	stored, _ := json.Marshal(ts.Token)
+	c.tokenMutex.RUnlock()
+
+	expiry, err := time.Parse(time.RFC3339Nano, gjson.GetBytes(stored, "expiry").String())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("token has no valid expiry: %w", err)
+	}
+	return expiry, nil
+}
@@ -0,0 +1,187 @@
+package client
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	// minDownscaleDimension is the smallest longest side an image is scaled down to in order
+	// to fit image-downscale.max-bytes.
+	minDownscaleDimension = 256
+
+	// maxDownscalePixels caps the width times height of images that are decoded. Decoding
+	// allocates memory for every pixel the header claims, so larger images, which a small
+	// file can claim to be, are sent unchanged instead.
+	maxDownscalePixels = 25_000_000
+)
+
+// downscaleImages shrinks the inline images of a request that exceed image-downscale's
+// max-dimension or max-bytes. Images are scaled down keeping their aspect ratio and
+// re-encoded as JPEG, or as PNG if they have transparency. Images that cannot be decoded,
+// have more than maxDownscalePixels pixels, or would not get smaller are sent unchanged.
+//
+// Parameters:
+//   - rawJSON: The translated Gemini request
+//   - pathPrefix: The prefix of the Gemini request body ("request." for Gemini CLI, "" for Gemini)
+//
+// Returns:
+//   - []byte: The request with large images downscaled
+func (c *ClientBase) downscaleImages(rawJSON []byte, pathPrefix string) []byte {
+	settings := c.cfg.ImageDownscale
+	if !settings.Enabled || (settings.MaxDimension <= 0 && settings.MaxBytes <= 0) {
+		return rawJSON
+	}
+
+	for i, content := range gjson.GetBytes(rawJSON, pathPrefix+"contents").Array() {
+		for j, part := range content.Get("parts").Array() {
+			key := "inlineData"
+			inlineData := part.Get(key)
+			if !inlineData.Exists() {
+				key = "inline_data"
+				inlineData = part.Get(key)
+			}
+			mimeKey := "mime_type"
+			mimeType := inlineData.Get(mimeKey)
+			if !mimeType.Exists() {
+				mimeKey = "mimeType"
+				mimeType = inlineData.Get(mimeKey)
+			}
+			if !strings.HasPrefix(mimeType.String(), "image/") {
+				continue
+			}
+
+			data, err := base64.StdEncoding.DecodeString(inlineData.Get("data").String())
+			if err != nil {
+				continue
+			}
+			downscaled, newMimeType, ok := c.downscaleImage(data)
+			if !ok {
+				continue
+			}
+			path := fmt.Sprintf("%scontents.%d.parts.%d.%s", pathPrefix, i, j, key)
+			rawJSON, _ = sjson.SetBytes(rawJSON, path+".data", base64.StdEncoding.EncodeToString(downscaled))
+			rawJSON, _ = sjson.SetBytes(rawJSON, path+"."+mimeKey, newMimeType)
+			log.Debugf("Downscaled inline %s image from %d to %d bytes", mimeType.String(), len(data), len(downscaled))
+		}
+	}
+	return rawJSON
+}
+
+// downscaleImage shrinks an encoded image that exceeds the configured limits.
+//
+// Returns:
+//   - []byte: The re-encoded image
+//   - string: The MIME type of the re-encoded image
+//   - bool: Whether the image was downscaled
+func (c *ClientBase) downscaleImage(data []byte) ([]byte, string, bool) {
+	settings := c.cfg.ImageDownscale
+	imageConfig, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", false
+	}
+	if imageConfig.Width <= 0 || imageConfig.Height <= 0 || imageConfig.Width > maxDownscalePixels/imageConfig.Height {
+		log.Debugf("Not downscaling inline image of %dx%d pixels", imageConfig.Width, imageConfig.Height)
+		return nil, "", false
+	}
+	longest := max(imageConfig.Width, imageConfig.Height)
+	tooLarge := settings.MaxDimension > 0 && longest > settings.MaxDimension
+	tooHeavy := settings.MaxBytes > 0 && len(data) > settings.MaxBytes
+	if !tooLarge && !tooHeavy {
+		return nil, "", false
+	}
+
+	source, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", false
+	}
+	target := longest
+	if tooLarge {
+		target = settings.MaxDimension
+	}
+
+	var encoded []byte
+	var mimeType string
+	for {
+		encoded, mimeType, err = encodeImage(scaleImage(source, target), settings.JPEGQuality)
+		if err != nil {
+			return nil, "", false
+		}
+		if settings.MaxBytes <= 0 || len(encoded) <= settings.MaxBytes || target <= minDownscaleDimension {
+			break
+		}
+		target = max(target/2, minDownscaleDimension)
+	}
+	if len(encoded) >= len(data) && !tooLarge {
+		return nil, "", false
+	}
+	return encoded, mimeType, true
+}
+
+// encodeImage encodes an image as JPEG, or as PNG if it has transparency.
+func encodeImage(img image.Image, quality int) ([]byte, string, error) {
+	var buffer bytes.Buffer
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && !opaque.Opaque() {
+		if err := png.Encode(&buffer, img); err != nil {
+			return nil, "", err
+		}
+		return buffer.Bytes(), "image/png", nil
+	}
+	if quality <= 0 || quality > 100 {
+		quality = jpeg.DefaultQuality
+	}
+	if err := jpeg.Encode(&buffer, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, "", err
+	}
+	return buffer.Bytes(), "image/jpeg", nil
+}
+
+// scaleImage scales an image down so that its longest side is at most maxDimension pixels,
+// averaging the source pixels covered by each target pixel.
+func scaleImage(source image.Image, maxDimension int) *image.RGBA {
+	bounds := source.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), source, bounds.Min, draw.Src)
+
+	width, height := bounds.Dx(), bounds.Dy()
+	if longest := max(width, height); longest > maxDimension {
+		width = max(1, width*maxDimension/longest)
+		height = max(1, height*maxDimension/longest)
+	} else {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*bounds.Dy()/height, max((y+1)*bounds.Dy()/height, y*bounds.Dy()/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*bounds.Dx()/width, max((x+1)*bounds.Dx()/width, x*bounds.Dx()/width+1)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					for k := 0; k < 4; k++ {
+						sum[k] += int(row[sx*4+k])
+					}
+				}
+			}
+			count := (y1 - y0) * (x1 - x0)
+			offset := y*dst.Stride + x*4
+			for k := 0; k < 4; k++ {
+				dst.Pix[offset+k] = uint8(sum[k] / count)
+			}
+		}
+	}
+	return dst
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// testPNG returns an opaque PNG image of the given size, encoded in base64.
+func testPNG(t *testing.T, width, height int) string {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: uint8(x ^ y), A: 0xff})
+		}
+	}
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		t.Fatalf("encode test image: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(buffer.Bytes())
+}
+
+// sentInlineImage sends a request with an inline PNG image through a Gemini client and
+// returns the inline data of the request sent upstream.
+func sentInlineImage(t *testing.T, settings config.ImageDownscale, data string) gjson.Result {
+	t.Helper()
+	var upstreamBody []byte
+	c := NewGeminiClient(&http.Client{Transport: roundTripFunc(func(req *http.Request) *http.Response {
+		upstreamBody, _ = io.ReadAll(req.Body)
+		return cannedResponse(http.StatusOK, nil, `{"candidates":[]}`)
+	})}, &config.Config{ImageDownscale: settings}, "test-key-image-downscale")
+
+	request := `{"contents":[{"role":"user","parts":[{"text":"Describe the image."},{"inlineData":{"mimeType":"image/png","data":""}}]}]}`
+	request, _ = sjson.Set(request, "contents.0.parts.1.inlineData.data", data)
+	if _, err := c.SendRawMessage(testRequestContext(GEMINI, false), "gemini-2.5-flash", []byte(request), ""); err != nil {
+		t.Fatalf("SendRawMessage() error = %v", err.Error)
+	}
+	return gjson.GetBytes(upstreamBody, "contents.0.parts.1.inlineData")
+}
+
+func TestOversizedImageIsDownscaledBeforeTheRequestIsSent(t *testing.T) {
+	original := testPNG(t, 512, 256)
+	inlineData := sentInlineImage(t, config.ImageDownscale{Enabled: true, MaxDimension: 128}, original)
+
+	if got := inlineData.Get("mimeType").String(); got != "image/jpeg" {
+		t.Errorf("mimeType = %q, want %q", got, "image/jpeg")
+	}
+	data, err := base64.StdEncoding.DecodeString(inlineData.Get("data").String())
+	if err != nil {
+		t.Fatalf("decode sent image: %v", err)
+	}
+	imageConfig, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode sent image: %v", err)
+	}
+	if imageConfig.Width != 128 || imageConfig.Height != 64 {
+		t.Errorf("sent image is %dx%d, want 128x64", imageConfig.Width, imageConfig.Height)
+	}
+	if len(inlineData.Get("data").String()) >= len(original) {
+		t.Error("the sent image is not smaller than the original")
+	}
+}
+
+func TestImagesAreSentUnchangedWithinLimitsOrWhenDisabled(t *testing.T) {
+	original := testPNG(t, 512, 256)
+	for name, settings := range map[string]config.ImageDownscale{
+		"within limits": {Enabled: true, MaxDimension: 1024},
+		"disabled":      {MaxDimension: 128},
+	} {
+		t.Run(name, func(t *testing.T) {
+			inlineData := sentInlineImage(t, settings, original)
+			if inlineData.Get("data").String() != original || inlineData.Get("mimeType").String() != "image/png" {
+				t.Error("the image was changed")
+			}
+		})
+	}
+}
+
+// hugePNG returns a small PNG file whose header claims the given size, with a single
+// compressed row of image data.
+func hugePNG(t *testing.T, width, height uint32) []byte {
+	t.Helper()
+	data, err := base64.StdEncoding.DecodeString(testPNG(t, 1, 1))
+	if err != nil {
+		t.Fatalf("decode test image: %v", err)
+	}
+	// The IHDR chunk follows the 8-byte signature: length, type, width, height, ..., CRC.
+	binary.BigEndian.PutUint32(data[16:], width)
+	binary.BigEndian.PutUint32(data[20:], height)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+func TestImagesClaimingTooManyPixelsAreNotDecoded(t *testing.T) {
+	data := hugePNG(t, 100_000, 100_000)
+	imageConfig, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || imageConfig.Width != 100_000 {
+		t.Fatalf("the test image header is invalid: %v", err)
+	}
+
+	c := &ClientBase{cfg: &config.Config{ImageDownscale: config.ImageDownscale{Enabled: true, MaxDimension: 128}}}
+	if _, _, ok := c.downscaleImage(data); ok {
+		t.Error("an image claiming 10 billion pixels was downscaled")
+	}
+	original := base64.StdEncoding.EncodeToString(data)
+	if got := sentInlineImage(t, c.cfg.ImageDownscale, original).Get("data").String(); got != original {
+		t.Error("an image claiming 10 billion pixels was changed")
+	}
+}
@@ -0,0 +1,58 @@
+package client
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// latencyWeight is the weight of a new measurement in the upstream latency average.
+	latencyWeight = 0.3
+
+	// latencyHalfLife is the time after which the weight of the previous average is halved,
+	// so that a measurement after a long pause outweighs the old average.
+	latencyHalfLife = 5 * time.Minute
+
+	// latencyStaleAfter is the age after which the average is no longer reported, so that
+	// accounts that have not been used for a while are measured again.
+	latencyStaleAfter = 10 * time.Minute
+)
+
+// latencyTracker keeps a decaying average of the time to the response headers of upstream
+// calls.
+type latencyTracker struct {
+	mu      sync.Mutex
+	average float64
+	updated time.Time
+}
+
+// observe adds a measurement to the average.
+func (t *latencyTracker) observe(latency time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if t.updated.IsZero() {
+		t.average = latency.Seconds()
+	} else {
+		previousWeight := (1 - latencyWeight) * math.Pow(0.5, float64(now.Sub(t.updated))/float64(latencyHalfLife))
+		t.average = previousWeight*t.average + (1-previousWeight)*latency.Seconds()
+	}
+	t.updated = now
+}
+
+// UpstreamLatency returns the recent average time to the response headers of the client's
+// upstream calls.
+//
+// Returns:
+//   - time.Duration: The average latency
+//   - bool: False if the client has no measurement from the last 10 minutes
+func (c *ClientBase) UpstreamLatency() (time.Duration, bool) {
+	c.latency.mu.Lock()
+	defer c.latency.mu.Unlock()
+	if c.latency.updated.IsZero() || time.Since(c.latency.updated) > latencyStaleAfter {
+		return 0, false
+	}
+	return time.Duration(c.latency.average * float64(time.Second)), true
+}
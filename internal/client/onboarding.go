@@ -0,0 +1,93 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+)
+
+// onboardingLimiter bounds the number of accounts onboarded in parallel and spaces the
+// onboarding API calls of all accounts, so that onboarding many accounts at once does not
+// overwhelm the onboarding API.
+type onboardingLimiter struct {
+	mu       sync.Mutex
+	slots    chan struct{}
+	nextPoll time.Time
+}
+
+// onboarding is the limiter shared by all Gemini CLI clients.
+var onboarding = &onboardingLimiter{}
+
+// acquire waits for an onboarding slot. The returned function releases the slot.
+//
+// Parameters:
+//   - ctx: The context for the onboarding
+//   - cfg: The onboarding settings
+//
+// Returns:
+//   - func(): A function that releases the slot
+//   - error: The context error if the context ends before a slot is free
+func (l *onboardingLimiter) acquire(ctx context.Context, cfg config.Onboarding) (func(), error) {
+	maxConcurrent := cfg.MaxConcurrent
+	if maxConcurrent <= 0 {
+		maxConcurrent = 1
+	}
+
+	l.mu.Lock()
+	// A changed limit takes effect for new onboardings; running ones release to the
+	// channel they acquired from.
+	if l.slots == nil || cap(l.slots) != maxConcurrent {
+		l.slots = make(chan struct{}, maxConcurrent)
+	}
+	slots := l.slots
+	l.mu.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// waitPoll waits until the next onboarding API call is allowed by the shared rate.
+//
+// Parameters:
+//   - ctx: The context for the onboarding
+//   - cfg: The onboarding settings
+//
+// Returns:
+//   - error: The context error if the context ends while waiting
+func (l *onboardingLimiter) waitPoll(ctx context.Context, cfg config.Onboarding) error {
+	if cfg.PollsPerMinute <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if l.nextPoll.Before(now) {
+		l.nextPoll = now
+	}
+	wait := l.nextPoll.Sub(now)
+	l.nextPoll = l.nextPoll.Add(time.Minute / time.Duration(cfg.PollsPerMinute))
+	l.mu.Unlock()
+
+	return sleepContext(ctx, wait)
+}
+
+// sleepContext sleeps for the given duration or until the context ends.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
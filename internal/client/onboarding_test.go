@@ -0,0 +1,122 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	geminiAuth "github.com/luispater/CLIProxyAPI/v5/internal/auth/gemini"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	"golang.org/x/oauth2"
+)
+
+func TestSetupUserOnboardsAccountsWithinConcurrencyBound(t *testing.T) {
+	previous := onboarding
+	onboarding = &onboardingLimiter{}
+	t.Cleanup(func() { onboarding = previous })
+
+	tests := []struct {
+		name          string
+		maxConcurrent int
+		accounts      int
+	}{
+		{name: "bounded", maxConcurrent: 2, accounts: 6},
+		{name: "default of one", maxConcurrent: 0, accounts: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inFlight, maxInFlight atomic.Int32
+			upstream := roundTripFunc(func(req *http.Request) *http.Response {
+				current := inFlight.Add(1)
+				defer inFlight.Add(-1)
+				for {
+					observed := maxInFlight.Load()
+					if current <= observed || maxInFlight.CompareAndSwap(observed, current) {
+						break
+					}
+				}
+				// Keep the call open long enough for other accounts to overlap with it.
+				time.Sleep(20 * time.Millisecond)
+				if strings.HasSuffix(req.URL.Path, ":loadCodeAssist") {
+					return cannedResponse(http.StatusOK, nil, `{"allowedTiers":[{"id":"free-tier","isDefault":true}]}`)
+				}
+				return cannedResponse(http.StatusOK, nil, `{"done":true,"response":{"cloudaicompanionProject":{"id":"assigned"}}}`)
+			})
+
+			cfg := &config.Config{AuthDir: t.TempDir(), Onboarding: config.Onboarding{MaxConcurrent: tt.maxConcurrent}}
+			clients := make([]*GeminiCLIClient, tt.accounts)
+			for i := range clients {
+				httpClient := &http.Client{Transport: &oauth2.Transport{
+					Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token", Expiry: time.Now().Add(time.Hour)}),
+					Base:   upstream,
+				}}
+				ts := &geminiAuth.GeminiTokenStorage{Token: map[string]any{"access_token": "token"}}
+				clients[i] = NewGeminiCLIClient(httpClient, ts, cfg)
+			}
+
+			var wg sync.WaitGroup
+			errs := make([]error, len(clients))
+			for i, c := range clients {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					errs[i] = c.SetupUser(context.Background(), fmt.Sprintf("user%d@example.com", i), fmt.Sprintf("project-%d", i))
+				}()
+			}
+			wg.Wait()
+
+			for i, c := range clients {
+				if errs[i] != nil {
+					t.Errorf("account %d SetupUser() error = %v", i, errs[i])
+				}
+				if got, want := c.GetProjectID(), fmt.Sprintf("project-%d", i); got != want {
+					t.Errorf("account %d project = %q, want %q", i, got, want)
+				}
+			}
+			bound := int32(max(tt.maxConcurrent, 1))
+			if got := maxInFlight.Load(); got != bound {
+				t.Errorf("max concurrent onboarding calls = %d, want %d", got, bound)
+			}
+		})
+	}
+}
+
+func TestOnboardingPollsShareRate(t *testing.T) {
+	tests := []struct {
+		name           string
+		pollsPerMinute int
+		polls          int
+		wantAtLeast    time.Duration
+		wantBelow      time.Duration
+	}{
+		{name: "unlimited", polls: 3, wantBelow: 50 * time.Millisecond},
+		{name: "spaced across accounts", pollsPerMinute: 1200, polls: 3, wantAtLeast: 100 * time.Millisecond, wantBelow: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := &onboardingLimiter{}
+			cfg := config.Onboarding{PollsPerMinute: tt.pollsPerMinute}
+			start := time.Now()
+			var wg sync.WaitGroup
+			for i := 0; i < tt.polls; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if err := limiter.waitPoll(context.Background(), cfg); err != nil {
+						t.Errorf("waitPoll() error = %v", err)
+					}
+				}()
+			}
+			wg.Wait()
+			elapsed := time.Since(start)
+			if elapsed < tt.wantAtLeast || elapsed >= tt.wantBelow {
+				t.Errorf("%d polls took %v, want between %v and %v", tt.polls, elapsed, tt.wantAtLeast, tt.wantBelow)
+			}
+		})
+	}
+}
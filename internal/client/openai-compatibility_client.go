@@ -209,10 +209,11 @@ func (c *OpenAICompatibilityClient) APIRequest(ctx context.Context, modelName st
 	}
 
 	// Send the request
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.doWithRetry(ctx, req, modifiedJSON)
 	if err != nil {
-		return nil, &interfaces.ErrorMessage{StatusCode: 500, Error: fmt.Errorf("failed to execute request: %v", err)}
+		return nil, &interfaces.ErrorMessage{StatusCode: requestErrorStatus(err), Error: fmt.Errorf("failed to execute request: %v", err)}
 	}
+	resp = c.LogUpstreamExchange(ctx, req, modifiedJSON, resp)
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		defer func() {
@@ -369,11 +370,11 @@ func (c *OpenAICompatibilityClient) SendRawMessageStream(ctx context.Context, mo
 		}
 
 		if scanner.Err() != nil {
-			errChan <- &interfaces.ErrorMessage{StatusCode: 500, Error: scanner.Err()}
+			errChan <- &interfaces.ErrorMessage{StatusCode: requestErrorStatus(scanner.Err()), Error: scanner.Err()}
 		}
 	}()
 
-	return dataChan, errChan
+	return c.bufferStream(ctx, dataChan, errChan)
 }
 
 // SendRawTokenCount sends a token count request (not implemented for OpenAI compatibility).
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// partOrderNormalize enables reordering of the parts within each content.
+const partOrderNormalize = "normalize"
+
+// Part ranks used when normalizing part order. Parts are sorted by rank, and parts of the
+// same rank keep their original relative order.
+const (
+	partRankThought = iota
+	partRankFunctionResponse
+	partRankMedia
+	partRankText
+	partRankFunctionCall
+)
+
+// normalizePartOrder reorders the parts of every content in a Gemini request into the
+// sequence Gemini accepts most reliably:
+//
+//  1. thought parts
+//  2. functionResponse parts
+//  3. inlineData and fileData parts, if the content holds a single one of them
+//  4. text and all other parts
+//  5. functionCall parts
+//
+// A content with several media parts keeps its media and text interleaved, since the text
+// between them usually refers to the neighbouring media.
+//
+// Parameters:
+//   - rawJSON: The translated Gemini request
+//   - pathPrefix: The prefix of the Gemini request body ("request." for Gemini CLI, "" for Gemini)
+//
+// Returns:
+//   - []byte: The request with normalized part order
+func normalizePartOrder(rawJSON []byte, pathPrefix string) []byte {
+	for i, content := range gjson.GetBytes(rawJSON, pathPrefix+"contents").Array() {
+		parts := content.Get("parts").Array()
+		if len(parts) < 2 {
+			continue
+		}
+
+		media := 0
+		for _, part := range parts {
+			if part.Get("inlineData").Exists() || part.Get("fileData").Exists() {
+				media++
+			}
+		}
+
+		ranks := make([]int, len(parts))
+		order := make([]int, len(parts))
+		for j, part := range parts {
+			order[j] = j
+			switch {
+			case part.Get("thought").Bool():
+				ranks[j] = partRankThought
+			case part.Get("functionResponse").Exists():
+				ranks[j] = partRankFunctionResponse
+			case media == 1 && (part.Get("inlineData").Exists() || part.Get("fileData").Exists()):
+				ranks[j] = partRankMedia
+			case part.Get("functionCall").Exists():
+				ranks[j] = partRankFunctionCall
+			default:
+				ranks[j] = partRankText
+			}
+		}
+		sort.SliceStable(order, func(a, b int) bool { return ranks[order[a]] < ranks[order[b]] })
+
+		changed := false
+		sorted := make([]string, len(parts))
+		for j, index := range order {
+			changed = changed || index != j
+			sorted[j] = parts[index].Raw
+		}
+		if changed {
+			path := fmt.Sprintf("%scontents.%d.parts", pathPrefix, i)
+			rawJSON, _ = sjson.SetRawBytes(rawJSON, path, []byte("["+strings.Join(sorted, ",")+"]"))
+		}
+	}
+	return rawJSON
+}
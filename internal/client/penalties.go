@@ -0,0 +1,51 @@
+package client
+
+import (
+	"github.com/luispater/CLIProxyAPI/v5/internal/registry"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// Values of the unsupported-penalties setting.
+const (
+	unsupportedPenaltiesWarn    = "warn"
+	unsupportedPenaltiesForward = "forward"
+)
+
+// penaltyFields are the generationConfig fields that only models with the penalties
+// capability accept.
+var penaltyFields = []string{"presencePenalty", "frequencyPenalty"}
+
+// dropUnsupportedPenalties removes penalty parameters from a Gemini request if the model
+// does not accept them, instead of letting the upstream reject the request.
+//
+// Parameters:
+//   - modelName: The model the request is sent to
+//   - rawJSON: The translated Gemini request
+//   - pathPrefix: The prefix of the Gemini request body ("request." for Gemini CLI, "" for Gemini)
+//
+// Returns:
+//   - []byte: The request without unsupported penalty parameters
+func (c *ClientBase) dropUnsupportedPenalties(modelName string, rawJSON []byte, pathPrefix string) []byte {
+	if c.cfg.UnsupportedPenalties == unsupportedPenaltiesForward {
+		return rawJSON
+	}
+	if registry.GetGlobalRegistry().ModelHasCapability(modelName, registry.CapabilityPenalties) {
+		return rawJSON
+	}
+
+	for _, field := range penaltyFields {
+		path := pathPrefix + "generationConfig." + field
+		if !gjson.GetBytes(rawJSON, path).Exists() {
+			continue
+		}
+		rawJSON, _ = sjson.DeleteBytes(rawJSON, path)
+		if c.cfg.UnsupportedPenalties == unsupportedPenaltiesWarn {
+			log.Warnf("dropped %s: model %s does not support penalties", field, modelName)
+		} else {
+			log.Debugf("dropped %s: model %s does not support penalties", field, modelName)
+		}
+	}
+	return rawJSON
+}
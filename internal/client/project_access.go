@@ -0,0 +1,152 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	geminiAuth "github.com/luispater/CLIProxyAPI/v5/internal/auth/gemini"
+	"github.com/luispater/CLIProxyAPI/v5/internal/util"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// projectAccessFailureThreshold is the number of consecutive project access errors after
+	// which the account's project is considered revoked.
+	projectAccessFailureThreshold = 3
+
+	// projectRecoveryTimeout bounds the search for and onboarding of an alternative project.
+	projectRecoveryTimeout = 5 * time.Minute
+)
+
+// isProjectAccessError reports whether an upstream error means that the account can no
+// longer use the project of the request: a 403 PERMISSION_DENIED or a 404 NOT_FOUND that
+// names the project. A 403 asking to enable the Cloud AI API is not a project access error.
+func isProjectAccessError(statusCode int, body []byte, projectID string) bool {
+	if projectID == "" || (statusCode != 403 && statusCode != 404) {
+		return false
+	}
+	upstreamError := parseUpstreamError(body)
+	if upstreamError == nil {
+		return false
+	}
+	if strings.Contains(upstreamError.Details, "SERVICE_DISABLED") || strings.Contains(upstreamError.Details, "activationUrl") {
+		return false
+	}
+	switch upstreamError.Status {
+	case "PERMISSION_DENIED", "NOT_FOUND":
+	default:
+		return false
+	}
+	message := strings.ToLower(upstreamError.Message)
+	return strings.Contains(message, "project") || strings.Contains(message, strings.ToLower(projectID))
+}
+
+// observeProjectAccess tracks the upstream answers for the account's primary project. After
+// projectAccessFailureThreshold consecutive project access errors the account is flagged as
+// having lost access to its project, which makes it unavailable, and an alternative project
+// is searched for in the background. Requests sent with other projects are ignored.
+//
+// Parameters:
+//   - statusCode: The upstream HTTP status
+//   - body: The upstream error body, or nil for successful responses
+//   - projectID: The project the request was sent with
+func (c *GeminiCLIClient) observeProjectAccess(statusCode int, body []byte, projectID string) {
+	if projectID == "" || projectID != c.GetProjectID() {
+		return
+	}
+	if statusCode >= 200 && statusCode < 300 {
+		c.projectAccessFailures.Store(0)
+		return
+	}
+	if !isProjectAccessError(statusCode, body, projectID) {
+		return
+	}
+	if c.projectAccessFailures.Add(1) < projectAccessFailureThreshold {
+		return
+	}
+
+	if !c.projectRecovering.CompareAndSwap(false, true) {
+		return
+	}
+	c.setProjectAccessLost(true, fmt.Sprintf("access to project %s was revoked, searching for another project", projectID))
+	log.Warnf("Gemini CLI account %s lost access to project %s, searching for another project", util.AccountLabel(c.cfg, c.GetEmail()), projectID)
+
+	go func() {
+		defer c.projectRecovering.Store(false)
+		c.recoverProjectAccess(projectID)
+	}()
+}
+
+// recoverProjectAccess lists the projects the account can still access and onboards the
+// first active one other than the lost project. The token file is saved under the new
+// project and the file of the lost project is removed. If no project can be set up, the
+// account stays flagged until a later health check succeeds.
+//
+// Parameters:
+//   - lostProjectID: The project the account lost access to
+func (c *GeminiCLIClient) recoverProjectAccess(lostProjectID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), projectRecoveryTimeout)
+	defer cancel()
+
+	account := util.AccountLabel(c.cfg, c.GetEmail())
+	projects, err := c.GetProjectList(ctx)
+	if err != nil {
+		log.Errorf("Gemini CLI account %s needs attention: failed to list projects after losing access to project %s: %v", account, lostProjectID, err)
+		c.setProjectAccessLost(true, fmt.Sprintf("access to project %s was revoked and listing projects failed: %v", lostProjectID, err))
+		return
+	}
+
+	for _, project := range projects.Projects {
+		if project.ProjectID == lostProjectID || (project.LifecycleState != "" && project.LifecycleState != "ACTIVE") {
+			continue
+		}
+		if errSetup := c.SetupUser(ctx, c.GetEmail(), project.ProjectID); errSetup != nil {
+			log.Debugf("Failed to set up project %s for Gemini CLI account %s: %v", project.ProjectID, account, errSetup)
+			continue
+		}
+		if errSave := c.switchTokenFile(lostProjectID); errSave != nil {
+			log.Warnf("Failed to save token of Gemini CLI account %s for project %s: %v", account, project.ProjectID, errSave)
+		}
+
+		c.projectsMutex.Lock()
+		c.accessibleProjects = nil
+		c.projectsMutex.Unlock()
+		c.projectAccessFailures.Store(0)
+		c.setProjectAccessLost(false, "")
+		log.Infof("Gemini CLI account %s switched from project %s to project %s", account, lostProjectID, project.ProjectID)
+		return
+	}
+
+	log.Errorf("Gemini CLI account %s needs attention: access to project %s was revoked and no other accessible project was found", account, lostProjectID)
+	c.setProjectAccessLost(true, fmt.Sprintf("access to project %s was revoked and no other accessible project was found", lostProjectID))
+}
+
+// switchTokenFile saves the token storage, whose project ID was changed, to its file and
+// removes the file of the lost project. The token mutex is held for both, so that a token
+// refreshed meanwhile is not written to the file of the lost project.
+func (c *GeminiCLIClient) switchTokenFile(lostProjectID string) error {
+	c.tokenMutex.Lock()
+	defer c.tokenMutex.Unlock()
+
+	if err := c.saveTokenFile(); err != nil {
+		return err
+	}
+	lostFile := filepath.Join(c.cfg.AuthDir, fmt.Sprintf("%s-%s.json", c.tokenStorage.(*geminiAuth.GeminiTokenStorage).Email, lostProjectID))
+	if err := os.Remove(lostFile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// setProjectAccessLost records in the health status whether the account lost access to its
+// project.
+func (c *GeminiCLIClient) setProjectAccessLost(lost bool, reason string) {
+	c.healthMutex.Lock()
+	defer c.healthMutex.Unlock()
+	c.health.ProjectAccessLost = lost
+	c.health.ProjectAccessError = reason
+}
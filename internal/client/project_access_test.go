@@ -0,0 +1,56 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestProjectSwitchIsSafeDuringRequests(t *testing.T) {
+	c := newTestGeminiCLIClient(t, &oauth2.Token{AccessToken: "fresh", Expiry: time.Now().Add(time.Hour)})
+	lostFile := filepath.Join(c.cfg.AuthDir, "user@example.com-project-1.json")
+	if err := c.SaveTokenToFile(); err != nil {
+		t.Fatalf("SaveTokenToFile() error = %v", err)
+	}
+
+	// Requests read the project while the account switches to another one.
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					_ = c.ProjectIDs()
+					_ = c.NextProjectID()
+				}
+			}
+		}()
+	}
+
+	c.SetProjectID("project-2")
+	err := c.switchTokenFile("project-1")
+	close(stop)
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("switchTokenFile() error = %v", err)
+	}
+
+	if got := c.GetProjectID(); got != "project-2" {
+		t.Errorf("GetProjectID() = %q, want %q", got, "project-2")
+	}
+	if _, err = os.Stat(filepath.Join(c.cfg.AuthDir, "user@example.com-project-2.json")); err != nil {
+		t.Errorf("token file of the new project not written: %v", err)
+	}
+	if _, err = os.Stat(lostFile); !os.IsNotExist(err) {
+		t.Errorf("token file of the lost project still exists: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrProjectIDRequired is returned by SetupUser when onboarding cannot determine the
+// project of an account and none was given.
+var ErrProjectIDRequired = errors.New("failed to start user onboarding, need define a project id")
+
+// SetupUserWithProjectDiscovery onboards an account like SetupUser. If no project was given
+// and onboarding cannot determine one, the account's active Google Cloud projects are
+// listed: the only project is used, and with none or several an error explains how to
+// create a project or which --login --project_id command to run. With
+// onboarding.auto-select-project disabled, a single project is listed instead of used.
+//
+// Parameters:
+//   - ctx: The context for the requests
+//   - email: The user's email address
+//   - projectID: The Google Cloud project ID, or an empty string to let onboarding pick one
+//
+// Returns:
+//   - string: The project selected from the project list, or an empty string if none was
+//     selected
+//   - error: An error if the setup fails
+func (c *GeminiCLIClient) SetupUserWithProjectDiscovery(ctx context.Context, email, projectID string) (string, error) {
+	err := c.SetupUser(ctx, email, projectID)
+	if !errors.Is(err, ErrProjectIDRequired) || projectID != "" {
+		return "", err
+	}
+
+	projects, errList := c.GetProjectList(ctx)
+	if errList != nil {
+		return "", fmt.Errorf("%w: could not list the projects of account %s: %v", ErrProjectIDRequired, email, errList)
+	}
+	active := make([]string, 0, len(projects.Projects))
+	names := make(map[string]string)
+	for _, project := range projects.Projects {
+		if project.LifecycleState != "" && project.LifecycleState != "ACTIVE" {
+			continue
+		}
+		active = append(active, project.ProjectID)
+		names[project.ProjectID] = project.Name
+	}
+
+	command := fmt.Sprintf("%s --login --project_id", os.Args[0])
+	switch {
+	case len(active) == 0:
+		return "", fmt.Errorf("%w: account %s has no Google Cloud project. Create one at https://console.cloud.google.com/projectcreate, then run:\n\n  %s <project_id>", ErrProjectIDRequired, email, command)
+	case len(active) > 1 || !c.cfg.Onboarding.AutoSelectProject:
+		var list strings.Builder
+		for _, id := range active {
+			fmt.Fprintf(&list, "\n  - %s (%s)", id, names[id])
+		}
+		return "", fmt.Errorf("%w: choose one of the Google Cloud projects of account %s:%s\n\nand run:\n\n  %s <project_id>", ErrProjectIDRequired, email, list.String(), command)
+	}
+
+	log.Infof("Account %s has a single Google Cloud project, using project %s", email, active[0])
+	if err = c.SetupUser(ctx, email, active[0]); err != nil {
+		return "", err
+	}
+	return active[0], nil
+}
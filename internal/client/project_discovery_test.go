@@ -0,0 +1,149 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	geminiAuth "github.com/luispater/CLIProxyAPI/v5/internal/auth/gemini"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	"github.com/tidwall/gjson"
+	"golang.org/x/oauth2"
+)
+
+func TestSetupUserWithProjectDiscovery(t *testing.T) {
+	tests := []struct {
+		name        string
+		projects    string
+		listStatus  int
+		autoSelect  bool
+		wantProject string
+		// wantError lists text the error must contain; the error wraps ErrProjectIDRequired.
+		wantError []string
+		// wantNotInError lists text the error must not contain.
+		wantNotInError []string
+	}{
+		{
+			name:       "no project",
+			projects:   `{"projects":[]}`,
+			autoSelect: true,
+			wantError:  []string{"has no Google Cloud project", "https://console.cloud.google.com/projectcreate", "--login --project_id <project_id>"},
+		},
+		{
+			name:        "single project",
+			projects:    `{"projects":[{"projectId":"only-project","name":"Only","lifecycleState":"ACTIVE"}]}`,
+			autoSelect:  true,
+			wantProject: "only-project",
+		},
+		{
+			name:        "single active project",
+			projects:    `{"projects":[{"projectId":"only-project","name":"Only","lifecycleState":"ACTIVE"},{"projectId":"deleted-project","name":"Deleted","lifecycleState":"DELETE_REQUESTED"}]}`,
+			autoSelect:  true,
+			wantProject: "only-project",
+		},
+		{
+			name:       "single project without auto-select",
+			projects:   `{"projects":[{"projectId":"only-project","name":"Only","lifecycleState":"ACTIVE"}]}`,
+			autoSelect: false,
+			wantError:  []string{"only-project (Only)", "--login --project_id <project_id>"},
+		},
+		{
+			name:           "several projects",
+			projects:       `{"projects":[{"projectId":"first-project","name":"First","lifecycleState":"ACTIVE"},{"projectId":"second-project","name":"Second","lifecycleState":"ACTIVE"},{"projectId":"deleted-project","name":"Deleted","lifecycleState":"DELETE_REQUESTED"}]}`,
+			autoSelect:     true,
+			wantError:      []string{"choose one of the Google Cloud projects of account user@example.com", "first-project (First)", "second-project (Second)", "--login --project_id <project_id>"},
+			wantNotInError: []string{"deleted-project"},
+		},
+		{
+			name:       "project list fails",
+			listStatus: http.StatusForbidden,
+			autoSelect: true,
+			wantError:  []string{"could not list the projects of account user@example.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := roundTripFunc(func(req *http.Request) *http.Response {
+				if req.URL.Host == "cloudresourcemanager.googleapis.com" {
+					if tt.listStatus != 0 {
+						return cannedResponse(tt.listStatus, nil, `{"error":{"code":403,"status":"PERMISSION_DENIED"}}`)
+					}
+					return cannedResponse(http.StatusOK, nil, tt.projects)
+				}
+				body, _ := io.ReadAll(req.Body)
+				project := gjson.GetBytes(body, "cloudaicompanionProject").String()
+				if strings.HasSuffix(req.URL.Path, ":loadCodeAssist") {
+					// Onboarding cannot determine the project of this account by itself.
+					return cannedResponse(http.StatusOK, nil, `{"allowedTiers":[{"id":"standard-tier","isDefault":true}]}`)
+				}
+				return cannedResponse(http.StatusOK, nil, `{"done":true,"response":{"cloudaicompanionProject":{"id":"`+project+`"}}}`)
+			})
+			httpClient := &http.Client{Transport: &oauth2.Transport{
+				Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token", Expiry: time.Now().Add(time.Hour)}),
+				Base:   upstream,
+			}}
+			cfg := &config.Config{AuthDir: t.TempDir(), Onboarding: config.Onboarding{AutoSelectProject: tt.autoSelect}}
+			c := NewGeminiCLIClient(httpClient, &geminiAuth.GeminiTokenStorage{Token: map[string]any{"access_token": "token"}}, cfg)
+
+			selected, err := c.SetupUserWithProjectDiscovery(context.Background(), "user@example.com", "")
+			if len(tt.wantError) > 0 {
+				if !errors.Is(err, ErrProjectIDRequired) {
+					t.Fatalf("SetupUserWithProjectDiscovery() error = %v, want ErrProjectIDRequired", err)
+				}
+				for _, want := range tt.wantError {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("error = %q, want it to contain %q", err, want)
+					}
+				}
+				for _, unwanted := range tt.wantNotInError {
+					if strings.Contains(err.Error(), unwanted) {
+						t.Errorf("error = %q, want it not to contain %q", err, unwanted)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SetupUserWithProjectDiscovery() error = %v", err)
+			}
+			if selected != tt.wantProject {
+				t.Errorf("selected project = %q, want %q", selected, tt.wantProject)
+			}
+			if got := c.GetProjectID(); got != tt.wantProject {
+				t.Errorf("GetProjectID() = %q, want %q", got, tt.wantProject)
+			}
+		})
+	}
+}
+
+func TestSetupUserWithProjectDiscoveryKeepsGivenProject(t *testing.T) {
+	listed := false
+	upstream := roundTripFunc(func(req *http.Request) *http.Response {
+		if req.URL.Host == "cloudresourcemanager.googleapis.com" {
+			listed = true
+		}
+		if strings.HasSuffix(req.URL.Path, ":loadCodeAssist") {
+			return cannedResponse(http.StatusOK, nil, `{"allowedTiers":[{"id":"standard-tier","isDefault":true}]}`)
+		}
+		return cannedResponse(http.StatusOK, nil, `{"done":true,"response":{"cloudaicompanionProject":{"id":"given-project"}}}`)
+	})
+	httpClient := &http.Client{Transport: &oauth2.Transport{
+		Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token", Expiry: time.Now().Add(time.Hour)}),
+		Base:   upstream,
+	}}
+	c := NewGeminiCLIClient(httpClient, &geminiAuth.GeminiTokenStorage{Token: map[string]any{"access_token": "token"}}, &config.Config{AuthDir: t.TempDir()})
+
+	selected, err := c.SetupUserWithProjectDiscovery(context.Background(), "user@example.com", "given-project")
+	if err != nil {
+		t.Fatalf("SetupUserWithProjectDiscovery() error = %v", err)
+	}
+	if selected != "" || c.GetProjectID() != "given-project" {
+		t.Errorf("selected = %q, project = %q, want the given project used as is", selected, c.GetProjectID())
+	}
+	if listed {
+		t.Error("projects were listed, want the given project used without listing")
+	}
+}
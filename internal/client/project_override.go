@@ -0,0 +1,85 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	"github.com/luispater/CLIProxyAPI/v5/internal/util"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	// ProjectOverrideHeader selects the Google Cloud project a Gemini CLI request is sent
+	// with, for accounts that have access to more than one project.
+	ProjectOverrideHeader = "X-CLIProxy-Project"
+
+	// accessibleProjectsTTL is how long the projects an account can access are cached.
+	accessibleProjectsTTL = 10 * time.Minute
+)
+
+// requestProjectID returns the project ID a request is sent with: the project named by the
+// X-CLIProxy-Project header, or the account's next project for the model. An overriding
+// project is only used if the account can access it. The account's stored project ID is
+// never changed.
+//
+// Parameters:
+//   - ctx: The context for the request
+//   - modelName: The model of the request
+//
+// Returns:
+//   - string: The project ID for the request
+//   - *interfaces.ErrorMessage: A 403 error if the account cannot access the requested project
+func (c *GeminiCLIClient) requestProjectID(ctx context.Context, modelName string) (string, *interfaces.ErrorMessage) {
+	ginContext, ok := ctx.Value("gin").(*gin.Context)
+	if !ok {
+		return c.nextProjectFor(modelName), nil
+	}
+	override := strings.TrimSpace(ginContext.GetHeader(ProjectOverrideHeader))
+	if override == "" {
+		return c.nextProjectFor(modelName), nil
+	}
+	if util.InArray(c.ProjectIDs(), override) {
+		return override, nil
+	}
+
+	allowed, err := c.canAccessProject(ctx, override)
+	if err != nil {
+		log.Warnf("Failed to list projects of Gemini CLI account %s (request %s): %v", util.AccountLabel(c.cfg, c.GetEmail()), RequestID(ctx), err)
+	}
+	if !allowed {
+		message := fmt.Sprintf("account %s cannot use project %s", util.AccountLabel(c.cfg, c.GetEmail()), override)
+		errJSON, _ := sjson.Set(`{"error":{"code":403,"status":"PERMISSION_DENIED"}}`, "error.message", message)
+		return "", &interfaces.ErrorMessage{StatusCode: http.StatusForbidden, Error: fmt.Errorf("%s", errJSON)}
+	}
+
+	log.Debugf("Request %s overrides project of Gemini CLI account %s with %s", RequestID(ctx), util.AccountLabel(c.cfg, c.GetEmail()), override)
+	return override, nil
+}
+
+// canAccessProject reports whether the account can access a project. The accessible projects
+// are listed through the Cloud Resource Manager API and cached for accessibleProjectsTTL.
+func (c *GeminiCLIClient) canAccessProject(ctx context.Context, projectID string) (bool, error) {
+	c.projectsMutex.Lock()
+	defer c.projectsMutex.Unlock()
+
+	if c.accessibleProjects == nil || time.Since(c.projectsListedAt) > accessibleProjectsTTL {
+		projects, err := c.GetProjectList(ctx)
+		if err != nil {
+			return false, err
+		}
+		c.accessibleProjects = make(map[string]bool, len(projects.Projects))
+		for _, project := range projects.Projects {
+			if project.LifecycleState == "" || project.LifecycleState == "ACTIVE" {
+				c.accessibleProjects[project.ProjectID] = true
+			}
+		}
+		c.projectsListedAt = time.Now()
+	}
+	return c.accessibleProjects[projectID], nil
+}
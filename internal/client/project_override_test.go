@@ -0,0 +1,79 @@
+package client
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	geminiAuth "github.com/luispater/CLIProxyAPI/v5/internal/auth/gemini"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+	"github.com/tidwall/gjson"
+	"golang.org/x/oauth2"
+)
+
+func TestProjectOverrideHeader(t *testing.T) {
+	tests := []struct {
+		name        string
+		header      string
+		wantProject string
+		wantStatus  int
+	}{
+		{name: "no header", wantProject: "project-1"},
+		{name: "account project", header: "project-1", wantProject: "project-1"},
+		{name: "accessible project", header: " project-2 ", wantProject: "project-2"},
+		{name: "inaccessible project", header: "project-3", wantStatus: http.StatusForbidden},
+		{name: "inactive project", header: "project-4", wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sentProject string
+			upstream := roundTripFunc(func(req *http.Request) *http.Response {
+				if req.URL.Host == "cloudresourcemanager.googleapis.com" {
+					return cannedResponse(http.StatusOK, nil, `{"projects":[{"projectId":"project-1","lifecycleState":"ACTIVE"},{"projectId":"project-2","lifecycleState":"ACTIVE"},{"projectId":"project-4","lifecycleState":"DELETE_REQUESTED"}]}`)
+				}
+				body, _ := io.ReadAll(req.Body)
+				sentProject = gjson.GetBytes(body, "project").String()
+				return cannedResponse(http.StatusOK, nil, `{"response":{"candidates":[{"content":{"role":"model","parts":[{"text":"Hi"}]},"finishReason":"STOP"}]}}`)
+			})
+			token := &oauth2.Token{AccessToken: "fresh", Expiry: time.Now().Add(time.Hour)}
+			ts := &geminiAuth.GeminiTokenStorage{
+				Email:     "user@example.com",
+				ProjectID: "project-1",
+				Token:     map[string]any{"access_token": "fresh", "refresh_token": "refresh"},
+			}
+			c := NewGeminiCLIClient(&http.Client{Transport: &oauth2.Transport{Source: oauth2.StaticTokenSource(token), Base: upstream}}, ts, &config.Config{AuthDir: t.TempDir()})
+
+			ctx := testRequestContext(GEMINI, true)
+			if tt.header != "" {
+				ctx.Value("gin").(*gin.Context).Request.Header.Set(ProjectOverrideHeader, tt.header)
+			}
+			_, err := c.SendRawMessage(ctx, "gemini-2.5-pro", []byte(`{"contents":[{"role":"user","parts":[{"text":"Hi"}]}]}`), "")
+
+			if tt.wantStatus != 0 {
+				if err == nil || err.StatusCode != tt.wantStatus {
+					t.Fatalf("SendRawMessage() error = %v, want status %d", err, tt.wantStatus)
+				}
+				if !strings.Contains(err.Error.Error(), tt.header) {
+					t.Errorf("error = %v, want it to name the project", err.Error)
+				}
+				if sentProject != "" {
+					t.Errorf("request sent with project %q, want it rejected", sentProject)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("SendRawMessage() error = %v", err.Error)
+				}
+				if sentProject != tt.wantProject {
+					t.Errorf("project = %q, want %q", sentProject, tt.wantProject)
+				}
+			}
+			if got := c.GetProjectID(); got != "project-1" {
+				t.Errorf("GetProjectID() = %q, want the account project to be unchanged", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// projectInCooldown reports whether a project of the account hit its quota for a model within
+// the quota cooldown. Callers must hold projectQuotaMutex.
+func (c *GeminiCLIClient) projectInCooldown(modelName, projectID string) bool {
+	exceededAt, ok := c.projectQuotaExceeded[modelName][projectID]
+	return ok && time.Since(exceededAt) < c.quotaCooldown()
+}
+
+// nextProjectFor returns the project for the next request for a model: the next project in
+// the account's rotation whose quota for the model is not exhausted, or the next project in
+// the rotation if all of them are exhausted.
+func (c *GeminiCLIClient) nextProjectFor(modelName string) string {
+	projectIDs := c.ProjectIDs()
+	if len(projectIDs) == 1 {
+		return projectIDs[0]
+	}
+
+	c.projectQuotaMutex.Lock()
+	defer c.projectQuotaMutex.Unlock()
+	first := c.NextProjectID()
+	if !c.projectInCooldown(modelName, first) {
+		return first
+	}
+	for _, projectID := range projectIDs {
+		if !c.projectInCooldown(modelName, projectID) {
+			return projectID
+		}
+	}
+	return first
+}
+
+// switchProjectOnQuota records that a project hit its quota for a model and, when
+// quota-exceeded.switch-project is enabled, returns another project of the account whose
+// quota for the model is not exhausted. Requests pinned to a project with the
+// X-CLIProxy-Project header are not switched.
+//
+// Parameters:
+//   - ctx: The context for the request
+//   - modelName: The model of the request
+//   - projectID: The project that answered 429
+//
+// Returns:
+//   - string: The project to retry with
+//   - bool: Whether a project to retry with was found
+func (c *GeminiCLIClient) switchProjectOnQuota(ctx context.Context, modelName, projectID string) (string, bool) {
+	c.projectQuotaMutex.Lock()
+	defer c.projectQuotaMutex.Unlock()
+	if c.projectQuotaExceeded == nil {
+		c.projectQuotaExceeded = make(map[string]map[string]time.Time)
+	}
+	if c.projectQuotaExceeded[modelName] == nil {
+		c.projectQuotaExceeded[modelName] = make(map[string]time.Time)
+	}
+	c.projectQuotaExceeded[modelName][projectID] = time.Now()
+
+	if !c.cfg.QuotaExceeded.SwitchProject {
+		return "", false
+	}
+	if ginContext, ok := ctx.Value("gin").(*gin.Context); ok && strings.TrimSpace(ginContext.GetHeader(ProjectOverrideHeader)) != "" {
+		return "", false
+	}
+	for _, candidate := range c.ProjectIDs() {
+		if candidate != projectID && !c.projectInCooldown(modelName, candidate) {
+			log.Debugf("Project %s of %s is quota exceeded for model %s. Switch to project %s (request %s)", projectID, util.AccountLabel(c.cfg, c.GetEmail()), modelName, candidate, RequestID(ctx))
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// clearProjectQuotaExceeded forgets that a project hit its quota for a model.
+func (c *GeminiCLIClient) clearProjectQuotaExceeded(modelName, projectID string) {
+	c.projectQuotaMutex.Lock()
+	delete(c.projectQuotaExceeded[modelName], projectID)
+	c.projectQuotaMutex.Unlock()
+}
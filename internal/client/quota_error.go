@@ -0,0 +1,76 @@
+package client
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	"github.com/tidwall/sjson"
+)
+
+// QuotaExceededModel describes a model that is quota exceeded on an account, as reported
+// in the details of a quota exceeded 429.
+type QuotaExceededModel struct {
+	// Model is the model that was tried.
+	Model string `json:"model"`
+
+	// Account identifies the account the model was tried on, with API keys masked.
+	Account string `json:"account"`
+
+	// Project is the Google Cloud project of the account, if any.
+	Project string `json:"project,omitempty"`
+
+	// RetryAt is when the model becomes eligible again on the account.
+	RetryAt time.Time `json:"retry_at"`
+}
+
+// QuotaExceededError builds the 429 returned when every model tried for a request is quota
+// exceeded. Besides the message, the error lists the exhausted models with the account,
+// project, and recovery time of each, and the earliest time any of them recovers, which is
+// also sent in the Retry-After header.
+//
+// Parameters:
+//   - modelName: The model of the request
+//   - exhausted: The models that were tried and are quota exceeded
+//
+// Returns:
+//   - *interfaces.ErrorMessage: The 429 error
+func QuotaExceededError(modelName string, exhausted []QuotaExceededModel) *interfaces.ErrorMessage {
+	errJSON := `{"error":{"code":429,"message":"","status":"RESOURCE_EXHAUSTED"}}`
+	errJSON, _ = sjson.Set(errJSON, "error.message", fmt.Sprintf("All the models of '%s' are quota exceeded", modelName))
+	var addon http.Header
+	if len(exhausted) > 0 {
+		for i := range exhausted {
+			exhausted[i].RetryAt = exhausted[i].RetryAt.UTC().Truncate(time.Second)
+		}
+		earliest := exhausted[0].RetryAt
+		for _, model := range exhausted[1:] {
+			if model.RetryAt.Before(earliest) {
+				earliest = model.RetryAt
+			}
+		}
+		errJSON, _ = sjson.Set(errJSON, "error.quota.exhausted", exhausted)
+		errJSON, _ = sjson.Set(errJSON, "error.quota.earliest_recovery", earliest.UTC().Format(time.RFC3339))
+		if wait := time.Until(earliest); wait > 0 {
+			addon = http.Header{"Retry-After": []string{strconv.Itoa(int(math.Ceil(wait.Seconds())))}}
+		}
+	}
+	return &interfaces.ErrorMessage{StatusCode: http.StatusTooManyRequests, Error: fmt.Errorf("%s", errJSON), Addon: addon}
+}
+
+// quotaExceededError builds the quota exceeded 429 for models tried on this account.
+func (c *ClientBase) quotaExceededError(modelName, account, project string, models []string) *interfaces.ErrorMessage {
+	exhausted := make([]QuotaExceededModel, 0, len(models))
+	for _, model := range models {
+		exhausted = append(exhausted, QuotaExceededModel{
+			Model:   model,
+			Account: account,
+			Project: project,
+			RetryAt: c.QuotaRecoveryAt(model),
+		})
+	}
+	return QuotaExceededError(modelName, exhausted)
+}
@@ -229,11 +229,8 @@ func (c *QwenClient) SendRawMessageStream(ctx context.Context, modelName string,
 
 		var stream io.ReadCloser
 
-		if c.IsModelQuotaExceeded(modelName) {
-			errChan <- &interfaces.ErrorMessage{
-				StatusCode: 429,
-				Error:      fmt.Errorf(`{"error":{"code":429,"message":"All the models of '%s' are quota exceeded","status":"RESOURCE_EXHAUSTED"}}`, modelName),
-			}
+		if !quotaCheckBypassed(ctx) && c.IsModelQuotaExceeded(modelName) {
+			errChan <- c.quotaExceededError(modelName, util.AccountLabel(c.cfg, c.GetEmail()), "", []string{modelName})
 			return
 		}
 
@@ -284,7 +281,7 @@ func (c *QwenClient) SendRawMessageStream(ctx context.Context, modelName string,
 		}
 
 		if errScanner := scanner.Err(); errScanner != nil {
-			errChan <- &interfaces.ErrorMessage{StatusCode: 500, Error: errScanner}
+			errChan <- &interfaces.ErrorMessage{StatusCode: requestErrorStatus(errScanner), Error: errScanner}
 			_ = stream.Close()
 			return
 		}
@@ -292,7 +289,7 @@ func (c *QwenClient) SendRawMessageStream(ctx context.Context, modelName string,
 		_ = stream.Close()
 	}()
 
-	return dataChan, errChan
+	return c.bufferStream(ctx, dataChan, errChan)
 }
 
 // SendRawTokenCount sends a token count request to OpenAI API
@@ -424,12 +421,13 @@ func (c *QwenClient) APIRequest(ctx context.Context, modelName, endpoint string,
 		}
 	}
 
-	log.Debugf("Use Qwen Code account %s for model %s", c.GetEmail(), modelName)
+	log.Debugf("Use Qwen Code account %s for model %s (request %s)", util.AccountLabel(c.cfg, c.GetEmail()), modelName, RequestID(ctx))
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.doWithRetry(ctx, req, jsonBody)
 	if err != nil {
-		return nil, &interfaces.ErrorMessage{StatusCode: 500, Error: fmt.Errorf("failed to execute request: %v", err)}
+		return nil, &interfaces.ErrorMessage{StatusCode: requestErrorStatus(err), Error: fmt.Errorf("failed to execute request: %v", err)}
 	}
+	resp = c.LogUpstreamExchange(ctx, req, jsonBody, resp)
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		defer func() {
@@ -480,11 +478,7 @@ func (c *QwenClient) GetEmail() string {
 //   - bool: True if the model's quota is exceeded, false otherwise.
 func (c *QwenClient) IsModelQuotaExceeded(model string) bool {
 	if lastExceededTime, hasKey := c.modelQuotaExceeded[model]; hasKey {
-		duration := time.Now().Sub(*lastExceededTime)
-		if duration > 30*time.Minute {
-			return false
-		}
-		return true
+		return c.inQuotaCooldown(model, *lastExceededTime)
 	}
 	return false
 }
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"context"
+	"math"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	// recitationTemperatureStep is added to the temperature of a request retried after a
+	// RECITATION block. Requests without a temperature start from the Gemini default of 1.0.
+	recitationTemperatureStep = 0.3
+
+	// recitationNudge is appended to the system instruction of a retried request.
+	recitationNudge = "Answer in your own words. Do not reproduce long passages of existing text verbatim."
+)
+
+// isRecitation reports whether a raw Gemini response, bare, wrapped in a "response" field
+// (Gemini CLI), or a JSON array of either, was stopped because it recited existing content.
+func isRecitation(data []byte) bool {
+	result := gjson.ParseBytes(data)
+	responses := []gjson.Result{result}
+	if result.IsArray() {
+		responses = result.Array()
+	}
+	for _, response := range responses {
+		if wrapped := response.Get("response"); wrapped.Exists() {
+			response = wrapped
+		}
+		if response.Get("candidates.0.finishReason").String() == "RECITATION" {
+			return true
+		}
+	}
+	return false
+}
+
+// retryOnRecitation retries a non-streaming request once when its response was blocked with
+// the RECITATION finish reason and recitation-retry is enabled. The retry uses a higher
+// temperature and asks the model to rephrase. The original response is kept if the retry fails.
+//
+// Parameters:
+//   - ctx: The context for the request
+//   - modelName: The model of the request
+//   - rawJSON: The translated request that produced the response
+//   - bodyBytes: The raw response
+//   - pathPrefix: The path prefix of the request fields ("request." for Gemini CLI)
+//   - send: Sends a request and returns the raw response
+//
+// Returns:
+//   - []byte: The request that produced the returned response
+//   - []byte: The raw response
+func (c *ClientBase) retryOnRecitation(ctx context.Context, modelName string, rawJSON, bodyBytes []byte, pathPrefix string, send func([]byte) ([]byte, *interfaces.ErrorMessage)) ([]byte, []byte) {
+	if !isRecitation(bodyBytes) {
+		return rawJSON, bodyBytes
+	}
+	if !c.cfg.RecitationRetry {
+		log.Warnf("Model %s response blocked for recitation (request %s)", modelName, RequestID(ctx))
+		return rawJSON, bodyBytes
+	}
+	log.Warnf("Model %s response blocked for recitation, retrying once (request %s)", modelName, RequestID(ctx))
+
+	temperature := 1.0
+	if current := gjson.GetBytes(rawJSON, pathPrefix+"generationConfig.temperature"); current.Exists() {
+		temperature = current.Float()
+	}
+	retryJSON, _ := sjson.SetBytes(rawJSON, pathPrefix+"generationConfig.temperature", math.Min(temperature+recitationTemperatureStep, 2.0))
+
+	instructionPath := pathPrefix + "systemInstruction"
+	if !gjson.GetBytes(retryJSON, instructionPath).Exists() && gjson.GetBytes(retryJSON, pathPrefix+"system_instruction").Exists() {
+		instructionPath = pathPrefix + "system_instruction"
+	}
+	retryJSON, _ = sjson.SetBytes(retryJSON, instructionPath+".parts.-1.text", recitationNudge)
+
+	retryBody, errMsg := send(retryJSON)
+	if errMsg != nil {
+		log.Warnf("Recitation retry for model %s failed (request %s): %v", modelName, RequestID(ctx), errMsg.Error)
+		return rawJSON, bodyBytes
+	}
+	if isRecitation(retryBody) {
+		log.Warnf("Model %s response blocked for recitation again (request %s)", modelName, RequestID(ctx))
+	}
+	return retryJSON, retryBody
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+	"github.com/tidwall/gjson"
+)
+
+func TestSendRawMessageRecitation(t *testing.T) {
+	const (
+		recitation = `{"candidates":[{"content":{"role":"model","parts":[]},"finishReason":"RECITATION"}]}`
+		answer     = `{"candidates":[{"content":{"role":"model","parts":[{"text":"In other words..."}]},"finishReason":"STOP"}]}`
+	)
+	tests := []struct {
+		name            string
+		retry           bool
+		request         string
+		retryStatus     int
+		wantRequests    int
+		wantResponse    string
+		wantTemperature float64
+	}{
+		{name: "retry disabled", request: `{"contents":[]}`, wantRequests: 1, wantResponse: recitation},
+		{name: "retry with default temperature", retry: true, request: `{"contents":[]}`, retryStatus: http.StatusOK, wantRequests: 2, wantResponse: answer, wantTemperature: 1.3},
+		{name: "retry raises temperature", retry: true, request: `{"contents":[],"generationConfig":{"temperature":0.5},"systemInstruction":{"parts":[{"text":"Be brief."}]}}`, retryStatus: http.StatusOK, wantRequests: 2, wantResponse: answer, wantTemperature: 0.8},
+		{name: "failed retry keeps the original response", retry: true, request: `{"contents":[]}`, retryStatus: http.StatusInternalServerError, wantRequests: 2, wantResponse: recitation, wantTemperature: 1.3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := make([][]byte, 0)
+			c := NewGeminiClient(&http.Client{Transport: roundTripFunc(func(req *http.Request) *http.Response {
+				body, _ := io.ReadAll(req.Body)
+				requests = append(requests, body)
+				if len(requests) == 1 {
+					return cannedResponse(http.StatusOK, nil, recitation)
+				}
+				return cannedResponse(tt.retryStatus, nil, answer)
+			})}, &config.Config{RecitationRetry: tt.retry}, "key")
+
+			resp, err := c.SendRawMessage(testRequestContext(GEMINI, false), "gemini-2.5-flash", []byte(tt.request), "")
+			if err != nil {
+				t.Fatalf("SendRawMessage() error = %v", err.Error)
+			}
+			if len(requests) != tt.wantRequests {
+				t.Fatalf("upstream requests = %d, want %d", len(requests), tt.wantRequests)
+			}
+			if got, want := gjson.GetBytes(resp, "candidates.0.finishReason").String(), gjson.Get(tt.wantResponse, "candidates.0.finishReason").String(); got != want {
+				t.Errorf("finishReason = %q, want %q", got, want)
+			}
+			if tt.wantRequests < 2 {
+				return
+			}
+
+			retried := requests[1]
+			if got := gjson.GetBytes(retried, "generationConfig.temperature").Float(); got < tt.wantTemperature-1e-9 || got > tt.wantTemperature+1e-9 {
+				t.Errorf("retry temperature = %v, want %v", got, tt.wantTemperature)
+			}
+			parts := gjson.GetBytes(retried, "systemInstruction.parts").Array()
+			if len(parts) == 0 || parts[len(parts)-1].Get("text").String() != recitationNudge {
+				t.Errorf("retry system instruction = %s, want the rephrasing nudge last", gjson.GetBytes(retried, "systemInstruction").Raw)
+			}
+			if first := gjson.GetBytes([]byte(tt.request), "systemInstruction.parts.0.text").String(); first != "" && parts[0].Get("text").String() != first {
+				t.Errorf("retry system instruction = %s, want the original instruction kept", gjson.GetBytes(retried, "systemInstruction").Raw)
+			}
+		})
+	}
+}
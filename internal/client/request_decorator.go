@@ -0,0 +1,46 @@
+package client
+
+import (
+	"net/http"
+	"sync"
+)
+
+// RequestDecorator adds or modifies headers of an upstream request just before it is sent,
+// for example to sign the request or attach attestation headers required by the backend.
+//
+// Parameters:
+//   - req: The outgoing request, with all default headers already set
+//   - credential: The OAuth access token or API key used to authenticate the request
+//   - body: The request body
+//
+// Returns:
+//   - error: An error that aborts the request
+type RequestDecorator func(req *http.Request, credential string, body []byte) error
+
+var (
+	decoratorMutex    sync.RWMutex
+	requestDecorators []RequestDecorator
+)
+
+// RegisterRequestDecorator adds a decorator that is invoked for every upstream Gemini request.
+// Decorators run in registration order. No decorators are registered by default.
+//
+// Parameters:
+//   - decorator: The decorator to add
+func RegisterRequestDecorator(decorator RequestDecorator) {
+	decoratorMutex.Lock()
+	requestDecorators = append(requestDecorators, decorator)
+	decoratorMutex.Unlock()
+}
+
+// decorateRequest runs all registered decorators on an upstream request.
+func decorateRequest(req *http.Request, credential string, body []byte) error {
+	decoratorMutex.RLock()
+	defer decoratorMutex.RUnlock()
+	for _, decorator := range requestDecorators {
+		if err := decorator(req, credential, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
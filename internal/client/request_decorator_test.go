@@ -0,0 +1,80 @@
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+)
+
+// sign returns the hex HMAC-SHA256 of body keyed with credential.
+func sign(credential string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(credential))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestRequestDecorators(t *testing.T) {
+	tests := []struct {
+		name       string
+		decorators []RequestDecorator
+		wantStatus int
+		wantSent   bool
+	}{
+		{name: "no decorators", wantSent: true},
+		{
+			name: "signed header",
+			decorators: []RequestDecorator{func(req *http.Request, credential string, body []byte) error {
+				req.Header.Set("X-Signature", sign(credential, body))
+				return nil
+			}},
+			wantSent: true,
+		},
+		{
+			name: "failing decorator aborts the request",
+			decorators: []RequestDecorator{func(*http.Request, string, []byte) error {
+				return errors.New("attestation unavailable")
+			}},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(func() { requestDecorators = nil })
+			for _, decorator := range tt.decorators {
+				RegisterRequestDecorator(decorator)
+			}
+
+			sent := false
+			c := NewGeminiClient(&http.Client{Transport: roundTripFunc(func(req *http.Request) *http.Response {
+				sent = true
+				body, _ := io.ReadAll(req.Body)
+				signature := req.Header.Get("X-Signature")
+				if len(tt.decorators) == 0 && signature != "" {
+					t.Errorf("X-Signature = %q, want no header without decorators", signature)
+				}
+				if len(tt.decorators) > 0 && signature != sign("key", body) {
+					t.Errorf("X-Signature = %q, want the signature of the sent body", signature)
+				}
+				return cannedResponse(http.StatusOK, nil, `{"totalTokens":1}`)
+			})}, &config.Config{}, "key")
+
+			_, err := c.CountTokens(testRequestContext(GEMINI, false), "gemini-2.5-flash", []byte(`{"contents":[]}`))
+			if sent != tt.wantSent {
+				t.Errorf("request sent = %t, want %t", sent, tt.wantSent)
+			}
+			if tt.wantStatus == 0 && err != nil {
+				t.Fatalf("CountTokens() error = %v", err.Error)
+			}
+			if tt.wantStatus != 0 && (err == nil || err.StatusCode != tt.wantStatus) {
+				t.Errorf("CountTokens() error = %v, want status %d", err, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// promptTemplatePlaceholder is replaced by the original content when applying a prompt template.
+const promptTemplatePlaceholder = "{{content}}"
+
+// applyRequestOptions applies configuration-driven transformations to a translated Gemini
+// request before it is sent upstream.
+//
+// Parameters:
+//   - modelName: The model the request is sent to
+//   - rawJSON: The translated Gemini request
+//   - pathPrefix: The prefix of the Gemini request body ("request." for Gemini CLI, "" for Gemini)
+//
+// Returns:
+//   - []byte: The transformed request
+func (c *ClientBase) applyRequestOptions(modelName string, rawJSON []byte, pathPrefix string) []byte {
+	for _, template := range c.cfg.PromptTemplates {
+		if template.Model != modelName {
+			continue
+		}
+		if template.Target == "system" {
+			rawJSON = applySystemPromptTemplate(rawJSON, pathPrefix, template.Template)
+		} else {
+			rawJSON = applyUserPromptTemplate(rawJSON, pathPrefix, template.Template)
+		}
+	}
+	rawJSON = c.dropUnsupportedPenalties(modelName, rawJSON, pathPrefix)
+	if c.cfg.PartOrdering == partOrderNormalize {
+		rawJSON = normalizePartOrder(rawJSON, pathPrefix)
+	}
+	if !c.cfg.IncludeThoughts {
+		rawJSON = disableThoughts(rawJSON, pathPrefix)
+	}
+	rawJSON = c.applyDefaultSafetySettings(rawJSON, pathPrefix)
+	rawJSON = c.downscaleImages(rawJSON, pathPrefix)
+	return rawJSON
+}
+
+// applyDefaultSafetySettings adds default-safety-settings to a request that sets no safety
+// settings of its own.
+func (c *ClientBase) applyDefaultSafetySettings(rawJSON []byte, pathPrefix string) []byte {
+	if len(c.cfg.DefaultSafetySettings) == 0 {
+		return rawJSON
+	}
+	if gjson.GetBytes(rawJSON, pathPrefix+"safetySettings").Exists() || gjson.GetBytes(rawJSON, pathPrefix+"safety_settings").Exists() {
+		return rawJSON
+	}
+	rawJSON, _ = sjson.SetBytes(rawJSON, pathPrefix+"safetySettings", c.cfg.DefaultSafetySettings)
+	return rawJSON
+}
+
+// disableThoughts turns off include_thoughts in the thinking config of a request, if it has one.
+func disableThoughts(rawJSON []byte, pathPrefix string) []byte {
+	thinkingConfig := pathPrefix + "generationConfig.thinkingConfig"
+	if !gjson.GetBytes(rawJSON, thinkingConfig).Exists() {
+		return rawJSON
+	}
+	if gjson.GetBytes(rawJSON, thinkingConfig+".includeThoughts").Exists() {
+		rawJSON, _ = sjson.SetBytes(rawJSON, thinkingConfig+".includeThoughts", false)
+		return rawJSON
+	}
+	rawJSON, _ = sjson.SetBytes(rawJSON, thinkingConfig+".include_thoughts", false)
+	return rawJSON
+}
+
+// renderPromptTemplate substitutes the original content into a template. Templates without
+// a placeholder are treated as a prefix.
+func renderPromptTemplate(template, content string) string {
+	if !strings.Contains(template, promptTemplatePlaceholder) {
+		return template + content
+	}
+	return strings.ReplaceAll(template, promptTemplatePlaceholder, content)
+}
+
+// applyUserPromptTemplate wraps the last text part of the final user message.
+func applyUserPromptTemplate(rawJSON []byte, pathPrefix, template string) []byte {
+	contents := gjson.GetBytes(rawJSON, pathPrefix+"contents").Array()
+	for i := len(contents) - 1; i >= 0; i-- {
+		if contents[i].Get("role").String() != "user" {
+			continue
+		}
+		parts := contents[i].Get("parts").Array()
+		for j := len(parts) - 1; j >= 0; j-- {
+			text := parts[j].Get("text")
+			if !text.Exists() || parts[j].Get("thought").Bool() {
+				continue
+			}
+			path := fmt.Sprintf("%scontents.%d.parts.%d.text", pathPrefix, i, j)
+			rawJSON, _ = sjson.SetBytes(rawJSON, path, renderPromptTemplate(template, text.String()))
+			return rawJSON
+		}
+		return rawJSON
+	}
+	return rawJSON
+}
+
+// applySystemPromptTemplate wraps the system instruction, creating one if the request has none.
+func applySystemPromptTemplate(rawJSON []byte, pathPrefix, template string) []byte {
+	key := "systemInstruction"
+	if gjson.GetBytes(rawJSON, pathPrefix+"system_instruction").Exists() {
+		key = "system_instruction"
+	}
+	path := pathPrefix + key + ".parts.0.text"
+	rendered := renderPromptTemplate(template, gjson.GetBytes(rawJSON, path).String())
+	rawJSON, _ = sjson.SetBytes(rawJSON, path, rendered)
+	if !gjson.GetBytes(rawJSON, pathPrefix+key+".role").Exists() {
+		rawJSON, _ = sjson.SetBytes(rawJSON, pathPrefix+key+".role", "user")
+	}
+	return rawJSON
+}
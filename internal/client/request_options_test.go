@@ -0,0 +1,191 @@
+package client
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	"github.com/luispater/CLIProxyAPI/v5/internal/registry"
+	"github.com/tidwall/gjson"
+)
+
+func TestPromptTemplates(t *testing.T) {
+	const request = `{"systemInstruction":{"role":"user","parts":[{"text":"Be brief."}]},"contents":[{"role":"user","parts":[{"text":"first"}]},{"role":"model","parts":[{"text":"answer"}]},{"role":"user","parts":[{"text":"second"},{"inlineData":{"mimeType":"image/png","data":""}}]}]}`
+
+	tests := []struct {
+		name       string
+		templates  []config.PromptTemplate
+		pathPrefix string
+		request    string
+		path       string
+		want       string
+	}{
+		{
+			name:      "user placeholder",
+			templates: []config.PromptTemplate{{Model: "gemini-2.5-pro", Template: "<q>{{content}}</q>"}},
+			request:   request,
+			path:      "contents.2.parts.0.text",
+			want:      "<q>second</q>",
+		},
+		{
+			name:      "earlier user messages untouched",
+			templates: []config.PromptTemplate{{Model: "gemini-2.5-pro", Template: "<q>{{content}}</q>"}},
+			request:   request,
+			path:      "contents.0.parts.0.text",
+			want:      "first",
+		},
+		{
+			name:      "prefix without placeholder",
+			templates: []config.PromptTemplate{{Model: "gemini-2.5-pro", Template: "Answer in English. "}},
+			request:   request,
+			path:      "contents.2.parts.0.text",
+			want:      "Answer in English. second",
+		},
+		{
+			name:      "system",
+			templates: []config.PromptTemplate{{Model: "gemini-2.5-pro", Target: "system", Template: "{{content}} Use metric units."}},
+			request:   request,
+			path:      "systemInstruction.parts.0.text",
+			want:      "Be brief. Use metric units.",
+		},
+		{
+			name:      "system created",
+			templates: []config.PromptTemplate{{Model: "gemini-2.5-pro", Target: "system", Template: "You are terse."}},
+			request:   `{"contents":[{"role":"user","parts":[{"text":"hi"}]}]}`,
+			path:      "systemInstruction.parts.0.text",
+			want:      "You are terse.",
+		},
+		{
+			name:       "Gemini CLI request",
+			templates:  []config.PromptTemplate{{Model: "gemini-2.5-pro", Template: "[{{content}}]"}},
+			pathPrefix: "request.",
+			request:    `{"request":{"contents":[{"role":"user","parts":[{"text":"hi"}]}]}}`,
+			path:       "request.contents.0.parts.0.text",
+			want:       "[hi]",
+		},
+		{
+			name:      "other model",
+			templates: []config.PromptTemplate{{Model: "gemini-2.5-flash", Template: "<q>{{content}}</q>"}},
+			request:   request,
+			path:      "contents.2.parts.0.text",
+			want:      "second",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &ClientBase{cfg: &config.Config{PromptTemplates: tt.templates, IncludeThoughts: true}}
+			got := c.applyRequestOptions("gemini-2.5-pro", []byte(tt.request), tt.pathPrefix)
+			if text := gjson.GetBytes(got, tt.path).String(); text != tt.want {
+				t.Errorf("%s = %q, want %q", tt.path, text, tt.want)
+			}
+		})
+	}
+}
+
+// partKinds describes the parts of a content as a comma-separated list, naming text parts by
+// their text.
+func partKinds(parts gjson.Result) string {
+	kinds := make([]string, 0)
+	for _, part := range parts.Array() {
+		switch {
+		case part.Get("thought").Bool():
+			kinds = append(kinds, "thought")
+		case part.Get("functionResponse").Exists():
+			kinds = append(kinds, "response")
+		case part.Get("functionCall").Exists():
+			kinds = append(kinds, "call")
+		case part.Get("inlineData").Exists():
+			kinds = append(kinds, "image")
+		case part.Get("fileData").Exists():
+			kinds = append(kinds, "file")
+		default:
+			kinds = append(kinds, part.Get("text").String())
+		}
+	}
+	return strings.Join(kinds, ",")
+}
+
+func TestPartOrdering(t *testing.T) {
+	const (
+		image    = `{"inlineData":{"mimeType":"image/png","data":""}}`
+		file     = `{"fileData":{"mimeType":"application/pdf","fileUri":"gs://bucket/doc.pdf"}}`
+		call     = `{"functionCall":{"name":"get_weather","args":{}}}`
+		response = `{"functionResponse":{"name":"get_weather","response":{}}}`
+		thought  = `{"text":"plan","thought":true}`
+	)
+	tests := []struct {
+		name       string
+		ordering   string
+		pathPrefix string
+		parts      string
+		want       string
+	}{
+		{name: "single image moved before text", ordering: partOrderNormalize, parts: `{"text":"a"},` + image + `,{"text":"b"}`, want: "image,a,b"},
+		{name: "single file moved before text", ordering: partOrderNormalize, parts: `{"text":"a"},` + file, want: "file,a"},
+		{name: "several images stay interleaved", ordering: partOrderNormalize, parts: `{"text":"a"},` + image + `,{"text":"b"},` + image, want: "a,image,b,image"},
+		{name: "function call moved after text", ordering: partOrderNormalize, parts: call + `,{"text":"a"}`, want: "a,call"},
+		{name: "function response moved first", ordering: partOrderNormalize, parts: `{"text":"a"},` + response, want: "response,a"},
+		{name: "thought moved first", ordering: partOrderNormalize, parts: `{"text":"a"},` + call + `,` + thought, want: "thought,a,call"},
+		{name: "gemini cli request", ordering: partOrderNormalize, pathPrefix: "request.", parts: call + `,{"text":"a"}`, want: "a,call"},
+		{name: "disabled keeps client order", parts: call + `,{"text":"a"},` + image, want: "call,a,image"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := `{"contents":[{"role":"user","parts":[` + tt.parts + `]}]}`
+			if tt.pathPrefix != "" {
+				request = `{"request":` + request + `}`
+			}
+			c := &ClientBase{cfg: &config.Config{PartOrdering: tt.ordering, IncludeThoughts: true}}
+			got := c.applyRequestOptions("gemini-2.5-pro", []byte(request), tt.pathPrefix)
+			if !gjson.ValidBytes(got) {
+				t.Fatalf("request = %s, want valid JSON", got)
+			}
+			if kinds := partKinds(gjson.GetBytes(got, tt.pathPrefix+"contents.0.parts")); kinds != tt.want {
+				t.Errorf("parts = %s, want %s", kinds, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnsupportedPenalties(t *testing.T) {
+	reg := registry.GetGlobalRegistry()
+	reg.RegisterClient("penalties-test", "gemini", []*registry.ModelInfo{
+		{ID: "penalties-test-supported", Type: "gemini", Capabilities: []string{registry.CapabilityChat, registry.CapabilityPenalties}},
+		{ID: "penalties-test-unsupported", Type: "gemini"},
+	})
+	t.Cleanup(func() { reg.UnregisterClient("penalties-test") })
+
+	tests := []struct {
+		name       string
+		setting    string
+		model      string
+		pathPrefix string
+		forwarded  bool
+	}{
+		{name: "supporting model", setting: "omit", model: "penalties-test-supported", forwarded: true},
+		{name: "non-supporting model", setting: "omit", model: "penalties-test-unsupported", forwarded: false},
+		{name: "non-supporting model with warning", setting: unsupportedPenaltiesWarn, model: "penalties-test-unsupported", forwarded: false},
+		{name: "non-supporting model on Gemini CLI", setting: "omit", model: "penalties-test-unsupported", pathPrefix: "request.", forwarded: false},
+		{name: "forward setting", setting: unsupportedPenaltiesForward, model: "penalties-test-unsupported", forwarded: true},
+		{name: "unregistered model", setting: "omit", model: "penalties-test-unknown", forwarded: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := `{"contents":[],"generationConfig":{"temperature":0.5,"presencePenalty":0.4,"frequencyPenalty":0.2}}`
+			if tt.pathPrefix != "" {
+				request = `{"request":` + request + `}`
+			}
+			c := &ClientBase{cfg: &config.Config{UnsupportedPenalties: tt.setting}}
+			got := c.applyRequestOptions(tt.model, []byte(request), tt.pathPrefix)
+
+			for _, field := range penaltyFields {
+				if exists := gjson.GetBytes(got, tt.pathPrefix+"generationConfig."+field).Exists(); exists != tt.forwarded {
+					t.Errorf("%s forwarded = %t, want %t", field, exists, tt.forwarded)
+				}
+			}
+			if gjson.GetBytes(got, tt.pathPrefix+"generationConfig.temperature").Float() != 0.5 {
+				t.Errorf("temperature missing, want other parameters kept: %s", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/metrics"
+)
+
+var (
+	// errRequestTimeout is the cause of an upstream call aborted by request-timeout-seconds.
+	errRequestTimeout = errors.New("upstream request timed out")
+
+	// errStreamIdleTimeout is the cause of an upstream stream aborted by stream-idle-timeout-seconds.
+	errStreamIdleTimeout = errors.New("upstream stream stalled")
+)
+
+// sendWithTimeout sends an upstream request, aborting it after request-timeout-seconds. For
+// a non-streaming response the timeout covers reading the body too; for an event stream it
+// only covers the time to the response headers, and stream-idle-timeout-seconds aborts the
+// stream when no data arrives between chunks.
+//
+// Parameters:
+//   - req: The request to send
+//
+// Returns:
+//   - *http.Response: The response, whose body must be closed to release the timers
+//   - error: An error if the request failed or timed out
+func (c *ClientBase) sendWithTimeout(req *http.Request) (*http.Response, error) {
+	timeout := time.Duration(c.cfg.RequestTimeoutSeconds) * time.Second
+	idleTimeout := time.Duration(c.cfg.StreamIdleTimeoutSeconds) * time.Second
+	if timeout <= 0 && idleTimeout <= 0 {
+		return c.observeLatency(req)
+	}
+
+	ctx, cancel := context.WithCancelCause(req.Context())
+	var deadline *time.Timer
+	if timeout > 0 {
+		deadline = time.AfterFunc(timeout, func() {
+			cancel(fmt.Errorf("%w after %s", errRequestTimeout, timeout))
+		})
+	}
+
+	resp, err := c.observeLatency(req.WithContext(ctx))
+	if err != nil {
+		if deadline != nil {
+			deadline.Stop()
+		}
+		if cause := context.Cause(ctx); errors.Is(cause, errRequestTimeout) {
+			err = cause
+		}
+		cancel(nil)
+		return nil, err
+	}
+
+	body := &timeoutBody{ReadCloser: resp.Body, ctx: ctx, cancel: cancel}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		if deadline != nil {
+			deadline.Stop()
+		}
+		body.idleTimeout = idleTimeout
+	} else {
+		body.deadline = deadline
+	}
+	resp.Body = body
+	return resp, nil
+}
+
+// observeLatency sends an upstream request and records the time to its response headers.
+func (c *ClientBase) observeLatency(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
+	if err == nil {
+		latency := time.Since(start)
+		metrics.UpstreamLatency.Observe(latency.Seconds(), req.URL.Host)
+		c.latency.observe(latency)
+	}
+	return resp, err
+}
+
+// isTimeoutError reports whether an upstream call failed because of request-timeout-seconds
+// or stream-idle-timeout-seconds.
+func isTimeoutError(err error) bool {
+	return errors.Is(err, errRequestTimeout) || errors.Is(err, errStreamIdleTimeout)
+}
+
+// requestErrorStatus returns the status reported for an upstream call that could not be
+// completed: 504 if it timed out, 500 otherwise.
+func requestErrorStatus(err error) int {
+	if isTimeoutError(err) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// timeoutBody is a response body that enforces the timeouts of its upstream call.
+type timeoutBody struct {
+	io.ReadCloser
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	// deadline aborts a non-streaming call that is not read completely in time.
+	deadline *time.Timer
+
+	// idleTimeout is the longest a read of an event stream may wait for data.
+	idleTimeout time.Duration
+
+	mu       sync.Mutex
+	idleTime *time.Timer
+}
+
+// Read reads from the body, replacing the error of an aborted call with its timeout.
+func (b *timeoutBody) Read(p []byte) (int, error) {
+	if b.idleTimeout > 0 {
+		b.mu.Lock()
+		if b.idleTime == nil {
+			b.idleTime = time.AfterFunc(b.idleTimeout, func() {
+				b.cancel(fmt.Errorf("%w, no data for %s", errStreamIdleTimeout, b.idleTimeout))
+			})
+		} else {
+			b.idleTime.Reset(b.idleTimeout)
+		}
+		b.mu.Unlock()
+	}
+
+	n, err := b.ReadCloser.Read(p)
+
+	if b.idleTimeout > 0 {
+		b.mu.Lock()
+		b.idleTime.Stop()
+		b.mu.Unlock()
+	}
+	if err != nil && err != io.EOF {
+		if cause := context.Cause(b.ctx); isTimeoutError(cause) {
+			err = cause
+		}
+	}
+	return n, err
+}
+
+// Close closes the body and releases the timers of the call.
+func (b *timeoutBody) Close() error {
+	b.mu.Lock()
+	if b.idleTime != nil {
+		b.idleTime.Stop()
+	}
+	b.mu.Unlock()
+	if b.deadline != nil {
+		b.deadline.Stop()
+	}
+	err := b.ReadCloser.Close()
+	b.cancel(nil)
+	return err
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	"github.com/luispater/CLIProxyAPI/v5/internal/util"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	// LanguageMismatchHeader is set on responses whose text is not in the language required by
+	// response-language. Its value is the required language.
+	LanguageMismatchHeader = "X-CLIProxy-Language-Mismatch"
+
+	// responseLanguageValidateFlag flags responses in the wrong language.
+	responseLanguageValidateFlag = "flag"
+
+	// responseLanguageValidateRetry retries responses in the wrong language once, then flags them.
+	responseLanguageValidateRetry = "retry"
+
+	// responseLanguageReminder is sent to the model after a response in the wrong language.
+	responseLanguageReminder = "Your previous answer was not in %s. Respond again, entirely in %s."
+)
+
+// checkResponseLanguage checks that the text of a non-streaming Gemini response is in the
+// language required by response-language, when response-language.validate is "flag" or
+// "retry". A response in the wrong language is retried once with a reminder if validate is
+// "retry"; if it is still in the wrong language, a warning is logged and the
+// X-CLIProxy-Language-Mismatch response header is set.
+//
+// Parameters:
+//   - ctx: The context for the request
+//   - modelName: The model of the request
+//   - rawJSON: The translated request that produced the response
+//   - bodyBytes: The raw response
+//   - pathPrefix: The path prefix of the request fields ("request." for Gemini CLI)
+//   - send: Sends a request and returns the raw response
+//
+// Returns:
+//   - []byte: The request that produced the returned response
+//   - []byte: The raw response
+func (c *ClientBase) checkResponseLanguage(ctx context.Context, modelName string, rawJSON, bodyBytes []byte, pathPrefix string, send func([]byte) ([]byte, *interfaces.ErrorMessage)) ([]byte, []byte) {
+	validate := c.cfg.ResponseLanguage.Validate
+	if validate != responseLanguageValidateFlag && validate != responseLanguageValidateRetry {
+		return rawJSON, bodyBytes
+	}
+	ginContext, ok := ctx.Value("gin").(*gin.Context)
+	if !ok {
+		return rawJSON, bodyBytes
+	}
+	language := c.cfg.ResponseLanguageFor(ginContext.GetString("apiKey"))
+	if language == "" || !util.LanguageMismatch(language, responseText(bodyBytes)) {
+		return rawJSON, bodyBytes
+	}
+
+	name := util.LanguageName(language)
+	if validate == responseLanguageValidateRetry {
+		log.Debugf("Model %s did not respond in %s, retrying (request %s)", modelName, name, RequestID(ctx))
+		modelTurn, _ := sjson.Set(`{"role":"model","parts":[{"text":""}]}`, "parts.0.text", responseText(bodyBytes))
+		userTurn, _ := sjson.Set(`{"role":"user","parts":[{"text":""}]}`, "parts.0.text", fmt.Sprintf(responseLanguageReminder, name, name))
+		retryJSON, _ := sjson.SetRawBytes(rawJSON, pathPrefix+"contents.-1", []byte(modelTurn))
+		retryJSON, _ = sjson.SetRawBytes(retryJSON, pathPrefix+"contents.-1", []byte(userTurn))
+		retryBody, errMsg := send(retryJSON)
+		if errMsg != nil {
+			log.Warnf("Response language retry for model %s failed (request %s): %v", modelName, RequestID(ctx), errMsg.Error)
+		} else {
+			rawJSON, bodyBytes = retryJSON, retryBody
+			if !util.LanguageMismatch(language, responseText(bodyBytes)) {
+				return rawJSON, bodyBytes
+			}
+		}
+	}
+
+	log.Warnf("Model %s did not respond in %s (request %s)", modelName, name, RequestID(ctx))
+	ginContext.Header(LanguageMismatchHeader, name)
+	return rawJSON, bodyBytes
+}
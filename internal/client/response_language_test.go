@@ -0,0 +1,76 @@
+package client
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+	"github.com/tidwall/gjson"
+)
+
+func TestSendRawMessageChecksResponseLanguage(t *testing.T) {
+	const (
+		english  = `{"candidates":[{"content":{"role":"model","parts":[{"text":"The weather in Tokyo is sunny and warm today."}]},"finishReason":"STOP"}]}`
+		japanese = `{"candidates":[{"content":{"role":"model","parts":[{"text":"今日の東京の天気は晴れで、とても暖かいです。明日も晴れるでしょう。"}]},"finishReason":"STOP"}]}`
+	)
+	tests := []struct {
+		name         string
+		language     string
+		keyLanguage  string
+		validate     string
+		responses    []string
+		wantRequests int
+		wantHeader   string
+	}{
+		{name: "validation off", language: "ja", validate: "off", responses: []string{english}, wantRequests: 1},
+		{name: "matching language", language: "ja", validate: "flag", responses: []string{japanese}, wantRequests: 1},
+		{name: "mismatch flagged", language: "ja", validate: "flag", responses: []string{english}, wantRequests: 1, wantHeader: "Japanese"},
+		{name: "key language", language: "en", keyLanguage: "Japanese", validate: "flag", responses: []string{english}, wantRequests: 1, wantHeader: "Japanese"},
+		{name: "retry fixes the language", language: "ja", validate: "retry", responses: []string{english, japanese}, wantRequests: 2},
+		{name: "retry still mismatched", language: "ja", validate: "retry", responses: []string{english, english}, wantRequests: 2, wantHeader: "Japanese"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := make([][]byte, 0)
+			c := NewGeminiClient(&http.Client{Transport: roundTripFunc(func(req *http.Request) *http.Response {
+				body, _ := io.ReadAll(req.Body)
+				requests = append(requests, body)
+				return cannedResponse(http.StatusOK, nil, tt.responses[len(requests)-1])
+			})}, &config.Config{
+				ResponseLanguage: config.ResponseLanguage{Language: tt.language, Validate: tt.validate},
+				APIKeySettings:   []config.APIKeySetting{{APIKey: "team-key", ResponseLanguage: tt.keyLanguage}},
+			}, "key")
+
+			ctx := testRequestContext(GEMINI, false)
+			ginContext := ctx.Value("gin").(*gin.Context)
+			ginContext.Set("apiKey", "team-key")
+			resp, err := c.SendRawMessage(ctx, "gemini-2.5-flash", []byte(`{"contents":[{"role":"user","parts":[{"text":"How is the weather?"}]}]}`), "")
+			if err != nil {
+				t.Fatalf("SendRawMessage() error = %v", err.Error)
+			}
+			if len(requests) != tt.wantRequests {
+				t.Fatalf("upstream requests = %d, want %d", len(requests), tt.wantRequests)
+			}
+			if got := ginContext.Writer.Header().Get(LanguageMismatchHeader); got != tt.wantHeader {
+				t.Errorf("%s = %q, want %q", LanguageMismatchHeader, got, tt.wantHeader)
+			}
+			if want := gjson.Get(tt.responses[len(tt.responses)-1], "candidates.0.content.parts.0.text").String(); gjson.GetBytes(resp, "candidates.0.content.parts.0.text").String() != want {
+				t.Errorf("response = %s, want the last upstream response", resp)
+			}
+			if tt.wantRequests < 2 {
+				return
+			}
+
+			contents := gjson.GetBytes(requests[1], "contents").Array()
+			if len(contents) != 3 || contents[1].Get("role").String() != "model" {
+				t.Fatalf("retry contents = %s, want the request, the answer, and a reminder", gjson.GetBytes(requests[1], "contents").Raw)
+			}
+			if got, want := contents[2].Get("parts.0.text").String(), "Your previous answer was not in Japanese. Respond again, entirely in Japanese."; got != want {
+				t.Errorf("reminder = %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// truncationMarker is appended to responses cut off by the response size limit.
+const truncationMarker = "\n\n[Response truncated: maximum response size reached]"
+
+// responseSizeLimiter caps the amount of text returned to a client across a whole response,
+// whether delivered as a single body or as a sequence of stream chunks.
+type responseSizeLimiter struct {
+	limit int
+	used  int
+	done  bool
+}
+
+// newResponseSizeLimiter creates a limiter using the max-response-bytes setting of the API
+// key that authenticated the request. A limit of 0 disables truncation.
+func (c *ClientBase) newResponseSizeLimiter(ctx context.Context) *responseSizeLimiter {
+	limiter := &responseSizeLimiter{}
+	if ginContext, ok := ctx.Value("gin").(*gin.Context); ok {
+		if setting := c.cfg.GetAPIKeySetting(ginContext.GetString("apiKey")); setting != nil {
+			limiter.limit = setting.MaxResponseBytes
+		}
+	}
+	return limiter
+}
+
+// apply removes the text beyond the limit from a raw Gemini payload. The payload may be a
+// single response, a response wrapped in a "response" field (Gemini CLI), or a JSON array
+// of either. When the limit is reached, the truncation marker is appended to the last text
+// kept and the finish reason is set to MAX_TOKENS.
+//
+// Parameters:
+//   - data: The raw payload
+//
+// Returns:
+//   - []byte: The payload, truncated if the limit was reached
+//   - bool: Whether the limit has been reached and no more output should be forwarded
+func (l *responseSizeLimiter) apply(data []byte) ([]byte, bool) {
+	if l.limit <= 0 || l.done || !gjson.ValidBytes(data) {
+		return data, l.done
+	}
+
+	result := gjson.ParseBytes(data)
+	if !result.IsArray() {
+		return []byte(l.applyResponse(result.Raw)), l.done
+	}
+
+	items := make([]string, 0)
+	result.ForEach(func(_, item gjson.Result) bool {
+		items = append(items, l.applyResponse(item.Raw))
+		return !l.done
+	})
+	return []byte("[" + strings.Join(items, ",") + "]"), l.done
+}
+
+// applyResponse truncates a single response object.
+func (l *responseSizeLimiter) applyResponse(response string) string {
+	prefix := ""
+	if gjson.Get(response, "response").Exists() {
+		prefix = "response."
+	}
+
+	parts := gjson.Get(response, prefix+"candidates.0.content.parts").Array()
+	for i, part := range parts {
+		text := part.Get("text")
+		if !text.Exists() || part.Get("thought").Bool() {
+			continue
+		}
+		remaining := l.limit - l.used
+		if len(text.String()) <= remaining {
+			l.used += len(text.String())
+			continue
+		}
+
+		kept := text.String()[:remaining]
+		for len(kept) > 0 && !utf8.ValidString(kept) {
+			kept = kept[:len(kept)-1]
+		}
+		partsPath := prefix + "candidates.0.content.parts"
+		response, _ = sjson.Set(response, fmt.Sprintf("%s.%d.text", partsPath, i), kept+truncationMarker)
+		for j := len(parts) - 1; j > i; j-- {
+			response, _ = sjson.Delete(response, fmt.Sprintf("%s.%d", partsPath, j))
+		}
+		response, _ = sjson.Set(response, prefix+"candidates.0.finishReason", "MAX_TOKENS")
+		l.used = l.limit
+		l.done = true
+		break
+	}
+	return response
+}
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"github.com/luispater/CLIProxyAPI/v5/internal/metrics"
+	"github.com/tidwall/gjson"
+)
+
+// responseValidator inspects raw Gemini responses, whether delivered as a single body
+// or as a sequence of stream chunks, and records post-validation metrics once the
+// response is complete.
+type responseValidator struct {
+	model   string
+	account string
+
+	hasContent        bool
+	safetyBlocked     bool
+	truncated         bool
+	malformedToolCall bool
+}
+
+// newResponseValidator creates a validator for a single upstream response.
+//
+// Parameters:
+//   - model: The model that produced the response
+//   - account: The label of the account that served the request, see util.AccountLabel
+//
+// Returns:
+//   - *responseValidator: A new validator
+func newResponseValidator(model, account string) *responseValidator {
+	return &responseValidator{model: model, account: account}
+}
+
+// observe inspects a raw Gemini payload. It accepts a single response object, a
+// response wrapped in a "response" field (Gemini CLI), or a JSON array of either.
+//
+// Parameters:
+//   - data: The raw payload
+func (v *responseValidator) observe(data []byte) {
+	if !gjson.ValidBytes(data) {
+		return
+	}
+	result := gjson.ParseBytes(data)
+	if result.IsArray() {
+		result.ForEach(func(_, item gjson.Result) bool {
+			v.observeResponse(item)
+			return true
+		})
+		return
+	}
+	v.observeResponse(result)
+}
+
+// observeResponse inspects a single response object.
+func (v *responseValidator) observeResponse(response gjson.Result) {
+	if wrapped := response.Get("response"); wrapped.Exists() {
+		response = wrapped
+	}
+
+	if response.Get("promptFeedback.blockReason").String() != "" {
+		v.safetyBlocked = true
+	}
+
+	response.Get("candidates").ForEach(func(_, candidate gjson.Result) bool {
+		switch candidate.Get("finishReason").String() {
+		case "SAFETY", "PROHIBITED_CONTENT", "BLOCKLIST", "SPII", "IMAGE_SAFETY":
+			v.safetyBlocked = true
+		case "MAX_TOKENS":
+			v.truncated = true
+		case "MALFORMED_FUNCTION_CALL", "UNEXPECTED_TOOL_CALL":
+			v.malformedToolCall = true
+		}
+
+		candidate.Get("content.parts").ForEach(func(_, part gjson.Result) bool {
+			if functionCall := part.Get("functionCall"); functionCall.Exists() {
+				if functionCall.Get("name").String() == "" {
+					v.malformedToolCall = true
+				} else {
+					v.hasContent = true
+				}
+			} else if part.Get("text").String() != "" || part.Get("inlineData").Exists() {
+				v.hasContent = true
+			}
+			return true
+		})
+		return true
+	})
+}
+
+// finish records the collected outcomes. A response blocked by safety filters is
+// counted as a safety block only, not additionally as an empty response.
+func (v *responseValidator) finish() {
+	if v.safetyBlocked {
+		metrics.SafetyBlocks.Inc(v.model, v.account)
+	} else if !v.hasContent && !v.malformedToolCall {
+		metrics.EmptyResponses.Inc(v.model, v.account)
+	}
+	if v.truncated {
+		metrics.Truncations.Inc(v.model, v.account)
+	}
+	if v.malformedToolCall {
+		metrics.MalformedToolCalls.Inc(v.model, v.account)
+	}
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	"github.com/tidwall/gjson"
+)
+
+// retryInfoType is the type of the Google API error detail that carries the retry delay.
+const retryInfoType = "type.googleapis.com/google.rpc.RetryInfo"
+
+// upstreamRetryAfter returns how long the upstream asks to wait after a 429: the Retry-After
+// header, in seconds or as an HTTP date, or otherwise the retryDelay of a google.rpc.RetryInfo
+// detail in the error body (e.g. "31s").
+//
+// Parameters:
+//   - header: The upstream response headers
+//   - body: The upstream error body
+//
+// Returns:
+//   - time.Duration: The requested delay, or 0 if the upstream did not ask for one
+func upstreamRetryAfter(header http.Header, body []byte) time.Duration {
+	if value := strings.TrimSpace(header.Get("Retry-After")); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		if at, err := http.ParseTime(value); err == nil {
+			return max(time.Until(at), 0)
+		}
+	}
+	for _, detail := range gjson.GetBytes(body, "error.details").Array() {
+		if detail.Get("@type").String() != retryInfoType {
+			continue
+		}
+		if delay, err := time.ParseDuration(detail.Get("retryDelay").String()); err == nil && delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+// retryAfterAddon returns the Retry-After header passed on to the caller with an upstream
+// 429, or nil if the upstream did not ask for a delay.
+func retryAfterAddon(statusCode int, header http.Header, body []byte) http.Header {
+	if statusCode != http.StatusTooManyRequests {
+		return nil
+	}
+	delay := upstreamRetryAfter(header, body)
+	if delay <= 0 {
+		return nil
+	}
+	return http.Header{"Retry-After": []string{strconv.Itoa(int(math.Ceil(delay.Seconds())))}}
+}
+
+// retryAfterOf returns the delay carried by the Retry-After header of an error, or 0.
+func retryAfterOf(err *interfaces.ErrorMessage) time.Duration {
+	if err == nil || err.Addon == nil {
+		return 0
+	}
+	seconds, errParse := strconv.Atoi(err.Addon.Get("Retry-After"))
+	if errParse != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
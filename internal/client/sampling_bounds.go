@@ -0,0 +1,84 @@
+package client
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// samplingParamsReject rejects requests with out-of-range sampling parameters instead of
+// clamping them.
+const samplingParamsReject = "reject"
+
+// samplingBound is the valid range of a Gemini sampling parameter.
+type samplingBound struct {
+	field   string
+	min     float64
+	max     float64
+	integer bool
+}
+
+// samplingBounds lists the sampling parameters Gemini validates. topK has no upper bound.
+var samplingBounds = []samplingBound{
+	{field: "temperature", min: 0, max: 2},
+	{field: "topP", min: 0, max: 1},
+	{field: "topK", min: 1, max: math.MaxInt32, integer: true},
+}
+
+// checkSamplingParams enforces the valid ranges of temperature ([0, 2]), topP ([0, 1]), and
+// topK (positive integers) on a translated Gemini request. Out-of-range values are clamped
+// with a debug log, or, if invalid-sampling-params is "reject", the request is rejected with
+// a 400 error naming the offending field.
+//
+// Parameters:
+//   - rawJSON: The translated Gemini request
+//   - pathPrefix: The prefix of the Gemini request body ("request." for Gemini CLI, "" for Gemini)
+//
+// Returns:
+//   - []byte: The request, possibly with clamped parameters
+//   - *interfaces.ErrorMessage: An error if a parameter is out of range and clamping is disabled
+func (c *ClientBase) checkSamplingParams(rawJSON []byte, pathPrefix string) ([]byte, *interfaces.ErrorMessage) {
+	for _, bound := range samplingBounds {
+		path := pathPrefix + "generationConfig." + bound.field
+		value := gjson.GetBytes(rawJSON, path)
+		if value.Type != gjson.Number {
+			continue
+		}
+
+		clamped := math.Min(math.Max(value.Num, bound.min), bound.max)
+		if bound.integer {
+			clamped = math.Max(math.Round(clamped), bound.min)
+		}
+		if clamped == value.Num {
+			continue
+		}
+
+		if c.cfg.InvalidSamplingParams == samplingParamsReject {
+			return rawJSON, samplingParamError(bound, value.Raw)
+		}
+		log.Debugf("Clamped %s from %s to %s", bound.field, value.Raw, strconv.FormatFloat(clamped, 'f', -1, 64))
+		if bound.integer {
+			rawJSON, _ = sjson.SetBytes(rawJSON, path, int64(clamped))
+		} else {
+			rawJSON, _ = sjson.SetBytes(rawJSON, path, clamped)
+		}
+	}
+	return rawJSON, nil
+}
+
+// samplingParamError builds the 400 error returned for an out-of-range sampling parameter.
+func samplingParamError(bound samplingBound, value string) *interfaces.ErrorMessage {
+	expected := fmt.Sprintf("between %g and %g", bound.min, bound.max)
+	if bound.integer {
+		expected = "a positive integer"
+	}
+	return &interfaces.ErrorMessage{
+		StatusCode: 400,
+		Error:      fmt.Errorf(`{"error":{"code":400,"message":"Invalid value %s for %s: must be %s","status":"INVALID_ARGUMENT"}}`, value, bound.field, expected),
+	}
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"context"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+)
+
+// streamItem is a chunk or an error of a stream, queued in the order it was produced.
+type streamItem struct {
+	data  []byte
+	err   *interfaces.ErrorMessage
+	isErr bool
+}
+
+// bufferStream lets the upstream reader of a stream run up to stream-channel-buffer chunks
+// ahead of the consumer. Chunks and errors are queued in the order they were produced, so
+// no chunk is delivered after an error that followed it. When the queue is full the reader
+// blocks, pausing upstream reads until the consumer catches up; nothing is dropped. A
+// paused reader is not waiting on the upstream connection, so stream-idle-timeout-seconds
+// does not abort the stream because of a slow consumer. Once ctx is done, the remaining
+// items are discarded so that the reader can finish.
+//
+// Parameters:
+//   - ctx: The context of the stream
+//   - dataChan: The chunks of the stream, closed when the stream ends
+//   - errChan: The errors of the stream, closed when the stream ends
+//
+// Returns:
+//   - <-chan []byte: The buffered chunks
+//   - <-chan *interfaces.ErrorMessage: The buffered errors
+func (c *ClientBase) bufferStream(ctx context.Context, dataChan <-chan []byte, errChan <-chan *interfaces.ErrorMessage) (<-chan []byte, <-chan *interfaces.ErrorMessage) {
+	size := c.cfg.StreamChannelBuffer
+	if size <= 0 {
+		return dataChan, errChan
+	}
+
+	queue := make(chan streamItem, size)
+	go func() {
+		defer close(queue)
+		discard := false
+		for dataChan != nil || errChan != nil {
+			var item streamItem
+			select {
+			case data, ok := <-dataChan:
+				if !ok {
+					dataChan = nil
+					continue
+				}
+				item.data = data
+			case err, ok := <-errChan:
+				if !ok {
+					errChan = nil
+					continue
+				}
+				item.err, item.isErr = err, true
+			}
+			if discard {
+				continue
+			}
+			select {
+			case queue <- item:
+			case <-ctx.Done():
+				discard = true
+			}
+		}
+	}()
+
+	outData := make(chan []byte)
+	outErr := make(chan *interfaces.ErrorMessage)
+	go func() {
+		defer close(outErr)
+		defer close(outData)
+		for item := range queue {
+			if item.isErr {
+				select {
+				case outErr <- item.err:
+				case <-ctx.Done():
+				}
+				continue
+			}
+			select {
+			case outData <- item.data:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return outData, outErr
+}
@@ -0,0 +1,131 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	"github.com/tidwall/gjson"
+)
+
+// produceStream sends count chunks and then, if err is set, an error on unbuffered channels,
+// like the upstream reader of a client, counting the chunks the consumer side has accepted.
+func produceStream(count int, err *interfaces.ErrorMessage, sent *atomic.Int32) (<-chan []byte, <-chan *interfaces.ErrorMessage) {
+	dataChan := make(chan []byte)
+	errChan := make(chan *interfaces.ErrorMessage)
+	go func() {
+		defer close(errChan)
+		defer close(dataChan)
+		for i := 0; i < count; i++ {
+			dataChan <- []byte(fmt.Sprintf("chunk-%d", i))
+			sent.Add(1)
+		}
+		if err != nil {
+			errChan <- err
+		}
+	}()
+	return dataChan, errChan
+}
+
+func TestBufferStreamBoundsReadAhead(t *testing.T) {
+	tests := []struct {
+		name   string
+		buffer int
+		// wantAhead is the most chunks the reader gets ahead of a consumer that reads nothing:
+		// the queue plus the chunk each of the two goroutines holds.
+		wantAhead int32
+	}{
+		{name: "disabled", buffer: 0, wantAhead: 0},
+		{name: "small buffer", buffer: 2, wantAhead: 4},
+		{name: "larger buffer", buffer: 8, wantAhead: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const count = 50
+			var sent atomic.Int32
+			c := &ClientBase{cfg: &config.Config{StreamChannelBuffer: tt.buffer}}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			upstreamData, upstreamErr := produceStream(count, &interfaces.ErrorMessage{StatusCode: 500, Error: errors.New("upstream failed")}, &sent)
+			dataChan, errChan := c.bufferStream(ctx, upstreamData, upstreamErr)
+
+			// The reader stops once the buffer is full.
+			time.Sleep(50 * time.Millisecond)
+			if ahead := sent.Load(); ahead != tt.wantAhead {
+				t.Errorf("chunks read ahead = %d, want %d", ahead, tt.wantAhead)
+			}
+
+			// A slow consumer still receives every chunk in order, then the error.
+			for i := 0; i < count; i++ {
+				if i%10 == 0 {
+					time.Sleep(time.Millisecond)
+				}
+				if ahead := sent.Load() - int32(i); ahead > tt.wantAhead {
+					t.Fatalf("chunks read ahead = %d, want at most %d", ahead, tt.wantAhead)
+				}
+				chunk, ok := <-dataChan
+				if !ok {
+					t.Fatalf("stream ended after %d chunks, want %d", i, count)
+				}
+				if want := fmt.Sprintf("chunk-%d", i); string(chunk) != want {
+					t.Fatalf("chunk %d = %q, want %q", i, chunk, want)
+				}
+			}
+			if err, ok := <-errChan; !ok || err == nil || err.StatusCode != 500 {
+				t.Errorf("error = %v, want the upstream error after the chunks", err)
+			}
+			if _, ok := <-dataChan; ok {
+				t.Error("chunk received after the error, want the stream closed")
+			}
+		})
+	}
+}
+
+func TestBufferStreamReleasesReaderOnCancel(t *testing.T) {
+	var sent atomic.Int32
+	c := &ClientBase{cfg: &config.Config{StreamChannelBuffer: 2}}
+	ctx, cancel := context.WithCancel(context.Background())
+	upstreamData, upstreamErr := produceStream(100, nil, &sent)
+	dataChan, _ := c.bufferStream(ctx, upstreamData, upstreamErr)
+
+	<-dataChan
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for sent.Load() < 100 {
+		if time.Now().After(deadline) {
+			t.Fatalf("reader blocked after %d chunks, want it to finish once the context is done", sent.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestStreamChannelBufferDeliversEveryChunk(t *testing.T) {
+	var stream strings.Builder
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&stream, "data: {\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"text\":\"%d \"}]}}]}\n\n", i)
+	}
+	c := NewGeminiClient(&http.Client{Transport: roundTripFunc(func(*http.Request) *http.Response {
+		return cannedResponse(http.StatusOK, http.Header{"Content-Type": []string{"text/event-stream"}}, stream.String())
+	})}, &config.Config{StreamChannelBuffer: 4}, "test-key-stream-buffer")
+
+	dataChan, errChan := c.SendRawMessageStream(testRequestContext(GEMINI, true), "gemini-2.5-flash", []byte(`{"contents":[{"role":"user","parts":[{"text":"Count"}]}]}`), "")
+	var text strings.Builder
+	for chunk := range dataChan {
+		time.Sleep(time.Millisecond)
+		text.WriteString(gjson.GetBytes(chunk, "candidates.0.content.parts.0.text").String())
+	}
+	if err, ok := <-errChan; ok && err != nil {
+		t.Fatalf("stream error = %v", err.Error)
+	}
+	if want := "0 1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16 17 18 19 "; text.String() != want {
+		t.Errorf("streamed text = %q, want %q", text.String(), want)
+	}
+}
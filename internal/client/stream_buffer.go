@@ -0,0 +1,148 @@
+package client
+
+import (
+	"bytes"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// streamBuffer merges the text of consecutive Gemini stream chunks until stream-buffer.min-chars
+// characters have accumulated, for clients that render single-token chunks poorly. Buffered text
+// is flushed after stream-buffer.max-delay-ms even if the threshold is not reached. Chunks with
+// tool calls, finish reasons, or anything but text parts are never merged: the buffered text is
+// flushed before them and they are emitted unchanged.
+type streamBuffer struct {
+	minChars int
+	maxDelay time.Duration
+	emit     func([]byte)
+
+	mu      sync.Mutex
+	pending []byte
+	prefix  string
+	text    []byte
+	thought bool
+	timer   *time.Timer
+	closed  bool
+}
+
+// newStreamBuffer creates a buffer for a single stream.
+//
+// Parameters:
+//   - emit: Sends a raw Gemini chunk to the client; it is never called concurrently
+//
+// Returns:
+//   - *streamBuffer: A new buffer; with buffering disabled, every chunk is emitted immediately
+func (c *ClientBase) newStreamBuffer(emit func([]byte)) *streamBuffer {
+	return &streamBuffer{
+		minChars: c.cfg.StreamBuffer.MinChars,
+		maxDelay: time.Duration(c.cfg.StreamBuffer.MaxDelayMs) * time.Millisecond,
+		emit:     emit,
+	}
+}
+
+// add buffers a raw Gemini chunk, emitting the merged text once the threshold is reached.
+//
+// Parameters:
+//   - data: The raw chunk, a response object or a response wrapped in a "response" field
+func (b *streamBuffer) add(data []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	prefix, text, thought, ok := bufferableText(data)
+	if b.minChars <= 0 || b.closed || !ok {
+		b.flushLocked()
+		b.emit(data)
+		return
+	}
+	if b.pending != nil && thought != b.thought {
+		b.flushLocked()
+	}
+	if b.pending == nil && b.maxDelay > 0 {
+		b.timer = time.AfterFunc(b.maxDelay, b.flush)
+	}
+	b.pending = bytes.Clone(data)
+	b.prefix = prefix
+	b.thought = thought
+	b.text = append(b.text, text...)
+	if utf8.RuneCount(b.text) >= b.minChars {
+		b.flushLocked()
+	}
+}
+
+// flush emits the buffered text, if any.
+func (b *streamBuffer) flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.flushLocked()
+}
+
+// close flushes the buffered text and stops the buffer; later chunks are emitted unchanged.
+// It must be called before the stream's channels are closed.
+func (b *streamBuffer) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.flushLocked()
+	b.closed = true
+}
+
+// flushLocked emits the buffered text as a single chunk. The latest buffered chunk is kept
+// for everything but its parts, so the emitted chunk carries the latest usage metadata.
+func (b *streamBuffer) flushLocked() {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if b.pending == nil {
+		return
+	}
+	part, _ := sjson.Set(`{"text":""}`, "text", string(b.text))
+	if b.thought {
+		part, _ = sjson.Set(part, "thought", true)
+	}
+	chunk, _ := sjson.SetRawBytes(b.pending, b.prefix+"candidates.0.content.parts", []byte("["+part+"]"))
+	b.pending, b.text = nil, nil
+	b.emit(chunk)
+}
+
+// bufferableText returns the text of a raw Gemini chunk whose single candidate only has text
+// parts of one kind (thought or response text) and no finish reason.
+//
+// Returns:
+//   - string: The path prefix of the response ("response." if it is wrapped)
+//   - string: The concatenated text of the parts
+//   - bool: Whether the parts are thoughts
+//   - bool: Whether the chunk can be merged
+func bufferableText(data []byte) (string, string, bool, bool) {
+	prefix := ""
+	response := gjson.ParseBytes(data)
+	if wrapped := response.Get("response"); wrapped.Exists() {
+		prefix, response = "response.", wrapped
+	}
+	candidates := response.Get("candidates").Array()
+	if len(candidates) != 1 || candidates[0].Get("finishReason").Exists() {
+		return "", "", false, false
+	}
+	parts := candidates[0].Get("content.parts").Array()
+	if len(parts) == 0 {
+		return "", "", false, false
+	}
+
+	var text bytes.Buffer
+	thought := parts[0].Get("thought").Bool()
+	for _, part := range parts {
+		mergeable := true
+		part.ForEach(func(key, _ gjson.Result) bool {
+			mergeable = key.String() == "text" || key.String() == "thought"
+			return mergeable
+		})
+		if !mergeable || part.Get("thought").Bool() != thought {
+			return "", "", false, false
+		}
+		text.WriteString(part.Get("text").String())
+	}
+	return prefix, text.String(), thought, true
+}
@@ -0,0 +1,43 @@
+package client
+
+import (
+	"context"
+	"io"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// closeStreamOnCancel closes an upstream stream as soon as the request context is cancelled,
+// so that a read blocked on the stream returns and the upstream connection is released
+// instead of being drained until the upstream finishes.
+//
+// Parameters:
+//   - ctx: The context for the request
+//   - stream: The upstream response body
+//
+// Returns:
+//   - func() bool: A function that stops watching the context
+func closeStreamOnCancel(ctx context.Context, stream io.Closer) func() bool {
+	return context.AfterFunc(ctx, func() {
+		_ = stream.Close()
+	})
+}
+
+// streamCancelled reports whether the caller cancelled a stream before it finished, logging
+// the early termination.
+func streamCancelled(ctx context.Context, modelName string) bool {
+	if ctx.Err() == nil {
+		return false
+	}
+	log.Debugf("Stopped streaming model %s early, the request was cancelled (request %s)", modelName, RequestID(ctx))
+	return true
+}
+
+// sendChunk delivers a chunk to the caller unless the request is cancelled first, in which
+// case nobody reads the channel anymore.
+func sendChunk(ctx context.Context, dataChan chan<- []byte, chunk []byte) {
+	select {
+	case dataChan <- chunk:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"bytes"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+// duplicateChunkFilter detects a Gemini stream chunk that repeats the previous chunk byte for
+// byte, which upstream glitches occasionally produce. Only whole chunks carrying content are
+// compared: a token the model legitimately repeats arrives in a chunk with different usage
+// metadata or surrounding text, so it is never identical to the previous chunk.
+type duplicateChunkFilter struct {
+	enabled   bool
+	modelName string
+	previous  []byte
+}
+
+// newDuplicateChunkFilter creates a filter for a single stream.
+//
+// Parameters:
+//   - enabled: Whether filtering is enabled; a disabled filter reports no duplicates
+//   - modelName: The model of the stream, for logging
+//
+// Returns:
+//   - *duplicateChunkFilter: A new filter
+func newDuplicateChunkFilter(enabled bool, modelName string) *duplicateChunkFilter {
+	return &duplicateChunkFilter{enabled: enabled, modelName: modelName}
+}
+
+// duplicate reports whether a raw stream chunk is identical to the previous content chunk and
+// should be dropped.
+//
+// Parameters:
+//   - data: The raw chunk, a response object or a response wrapped in a "response" field
+//
+// Returns:
+//   - bool: True if the chunk repeats the previous content chunk
+func (f *duplicateChunkFilter) duplicate(data []byte) bool {
+	if !f.enabled || !hasContentParts(data) {
+		return false
+	}
+	if f.previous != nil && bytes.Equal(bytes.TrimSpace(data), f.previous) {
+		log.Debugf("Dropped a duplicate stream chunk of model %s", f.modelName)
+		return true
+	}
+	f.previous = bytes.Clone(bytes.TrimSpace(data))
+	return false
+}
+
+// hasContentParts reports whether a raw Gemini response chunk carries candidate content parts.
+func hasContentParts(data []byte) bool {
+	response := gjson.ParseBytes(data)
+	if wrapped := response.Get("response"); wrapped.Exists() {
+		response = wrapped
+	}
+	return len(response.Get("candidates.0.content.parts").Array()) > 0
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+	"github.com/tidwall/gjson"
+)
+
+func TestDuplicateChunkFilter(t *testing.T) {
+	const hello = `{"candidates":[{"content":{"role":"model","parts":[{"text":"Hello"}]}}]}`
+	tests := []struct {
+		name    string
+		enabled bool
+		chunks  []string
+		want    []bool
+	}{
+		{name: "disabled", chunks: []string{hello, hello}, want: []bool{false, false}},
+		{name: "consecutive duplicate", enabled: true, chunks: []string{hello, hello, hello}, want: []bool{false, true, true}},
+		{name: "surrounding whitespace", enabled: true, chunks: []string{hello, " " + hello + "\r"}, want: []bool{false, true}},
+		{
+			name:    "repeated token with other usage",
+			enabled: true,
+			chunks: []string{
+				`{"candidates":[{"content":{"role":"model","parts":[{"text":"ha"}]}}],"usageMetadata":{"candidatesTokenCount":1}}`,
+				`{"candidates":[{"content":{"role":"model","parts":[{"text":"ha"}]}}],"usageMetadata":{"candidatesTokenCount":2}}`,
+			},
+			want: []bool{false, false},
+		},
+		{name: "not consecutive", enabled: true, chunks: []string{hello, `{"candidates":[{"content":{"role":"model","parts":[{"text":" world"}]}}]}`, hello}, want: []bool{false, false, false}},
+		{name: "chunks without content", enabled: true, chunks: []string{`{"usageMetadata":{"totalTokenCount":3}}`, `{"usageMetadata":{"totalTokenCount":3}}`}, want: []bool{false, false}},
+		{name: "Gemini CLI response", enabled: true, chunks: []string{`{"response":` + hello + `}`, `{"response":` + hello + `}`}, want: []bool{false, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := newDuplicateChunkFilter(tt.enabled, "gemini-2.5-flash")
+			for i, chunk := range tt.chunks {
+				if got := filter.duplicate([]byte(chunk)); got != tt.want[i] {
+					t.Errorf("chunk %d duplicate = %t, want %t", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestStreamDropsDuplicateChunk(t *testing.T) {
+	const stream = "data: {\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"text\":\"Hello\"}]}}]}\n\n" +
+		"data: {\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"text\":\"Hello\"}]}}]}\n\n" +
+		"data: {\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"text\":\" world\"}]},\"finishReason\":\"STOP\"}]}\n\n"
+	tests := []struct {
+		name    string
+		enabled bool
+		want    string
+	}{
+		{name: "disabled", want: "HelloHello world"},
+		{name: "enabled", enabled: true, want: "Hello world"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewGeminiClient(&http.Client{Transport: roundTripFunc(func(*http.Request) *http.Response {
+				return cannedResponse(http.StatusOK, http.Header{"Content-Type": []string{"text/event-stream"}}, stream)
+			})}, &config.Config{DropDuplicateChunks: tt.enabled}, "test-key-duplicate-chunks")
+
+			dataChan, errChan := c.SendRawMessageStream(testRequestContext(GEMINI, true), "gemini-2.5-flash", []byte(`{"contents":[{"role":"user","parts":[{"text":"Hi"}]}]}`), "")
+			var text strings.Builder
+			for chunk := range dataChan {
+				text.WriteString(gjson.GetBytes(chunk, "candidates.0.content.parts.0.text").String())
+			}
+			if err, ok := <-errChan; ok && err != nil {
+				t.Fatalf("stream error = %v", err.Error)
+			}
+			if got := text.String(); got != tt.want {
+				t.Errorf("streamed text = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
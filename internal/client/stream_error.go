@@ -0,0 +1,85 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	// streamErrorsForward forwards error payloads found within a stream like any other chunk.
+	streamErrorsForward = "forward"
+
+	// streamDataPrefix starts each payload line of a Gemini stream.
+	streamDataPrefix = "data: "
+
+	// streamErrorNote is appended to the streamed text when a stream ends with an error.
+	streamErrorNote = "\n\n[Upstream error: %s]"
+)
+
+// streamErrorMessage returns the message of an error payload sent within a Gemini stream
+// instead of a response chunk. Payloads are bare, wrapped in a "response" field (Gemini CLI),
+// or a JSON array of either.
+//
+// Parameters:
+//   - data: The payload of a stream line
+//
+// Returns:
+//   - string: The error message
+//   - bool: True if the payload is an error
+func streamErrorMessage(data []byte) (string, bool) {
+	result := gjson.ParseBytes(data)
+	items := []gjson.Result{result}
+	if result.IsArray() {
+		items = result.Array()
+	}
+	for _, item := range items {
+		if wrapped := item.Get("response"); wrapped.IsObject() {
+			item = wrapped
+		}
+		if errObject := item.Get("error"); errObject.IsObject() {
+			message := errObject.Get("message").String()
+			if message == "" {
+				message = errObject.Get("status").String()
+			}
+			return message, true
+		}
+	}
+	return "", false
+}
+
+// replaceStreamError replaces an error payload sent within a Gemini stream with a final
+// response chunk that carries an error note and the OTHER finish reason, so that the client
+// receives a well-formed end of stream in its own protocol rather than a garbled chunk. With
+// stream-errors set to "forward", the line is returned unchanged.
+//
+// Parameters:
+//   - ctx: The context for the request
+//   - modelName: The model of the request
+//   - line: A "data: " line of the stream
+//   - wrapped: Whether response chunks are wrapped in a "response" field (Gemini CLI)
+//
+// Returns:
+//   - []byte: The line to process in place of the original
+//   - bool: True if the line was an error and the stream should stop after it
+func (c *ClientBase) replaceStreamError(ctx context.Context, modelName string, line []byte, wrapped bool) ([]byte, bool) {
+	if c.cfg.StreamErrors == streamErrorsForward || !bytes.HasPrefix(line, []byte(streamDataPrefix)) {
+		return line, false
+	}
+	message, isError := streamErrorMessage(line[len(streamDataPrefix):])
+	if !isError {
+		return line, false
+	}
+	log.Warnf("Model %s stream ended with an upstream error (request %s): %s", modelName, RequestID(ctx), message)
+
+	chunk := `{"candidates":[{"content":{"role":"model","parts":[{"text":""}]},"finishReason":"OTHER"}]}`
+	chunk, _ = sjson.Set(chunk, "candidates.0.content.parts.0.text", fmt.Sprintf(streamErrorNote, message))
+	if wrapped {
+		chunk, _ = sjson.SetRaw(`{"response":{}}`, "response", chunk)
+	}
+	return []byte(streamDataPrefix + chunk), true
+}
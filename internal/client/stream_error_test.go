@@ -0,0 +1,99 @@
+package client
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+	"github.com/tidwall/gjson"
+)
+
+func TestStreamErrorMessage(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		wantMessage string
+		wantError   bool
+	}{
+		{name: "response chunk", data: `{"candidates":[{"content":{"parts":[{"text":"Hi"}]}}]}`},
+		{name: "bare error", data: `{"error":{"code":500,"message":"Internal error","status":"INTERNAL"}}`, wantMessage: "Internal error", wantError: true},
+		{name: "status without message", data: `{"error":{"code":503,"status":"UNAVAILABLE"}}`, wantMessage: "UNAVAILABLE", wantError: true},
+		{name: "Gemini CLI error", data: `{"response":{"error":{"message":"Backend failed"}}}`, wantMessage: "Backend failed", wantError: true},
+		{name: "array with an error", data: `[{"candidates":[]},{"error":{"message":"Overloaded"}}]`, wantMessage: "Overloaded", wantError: true},
+		{name: "not JSON", data: `[DONE]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, isError := streamErrorMessage([]byte(tt.data))
+			if isError != tt.wantError || message != tt.wantMessage {
+				t.Errorf("streamErrorMessage() = %q, %t, want %q, %t", message, isError, tt.wantMessage, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestStreamErrorEndsStream(t *testing.T) {
+	const stream = "data: {\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"text\":\"Hello\"}]}}]}\n\n" +
+		"data: {\"error\":{\"code\":500,\"message\":\"Internal error\",\"status\":\"INTERNAL\"}}\n\n" +
+		"data: {\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"text\":\" after the error\"}]}}]}\n\n"
+	tests := []struct {
+		name         string
+		streamErrors string
+		// want holds the text of the first part of every chunk, or the error message of an
+		// error chunk.
+		want []string
+		// wantFinishReason is the finish reason of the last chunk.
+		wantFinishReason string
+	}{
+		{name: "finish", streamErrors: "finish", want: []string{"Hello", "\n\n[Upstream error: Internal error]"}, wantFinishReason: "OTHER"},
+		{name: "forward", streamErrors: streamErrorsForward, want: []string{"Hello", "Internal error", " after the error"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewGeminiClient(&http.Client{Transport: roundTripFunc(func(*http.Request) *http.Response {
+				return cannedResponse(http.StatusOK, http.Header{"Content-Type": []string{"text/event-stream"}}, stream)
+			})}, &config.Config{StreamErrors: tt.streamErrors}, "test-key-stream-error")
+
+			dataChan, errChan := c.SendRawMessageStream(testRequestContext(GEMINI, true), "gemini-2.5-flash", []byte(`{"contents":[{"role":"user","parts":[{"text":"Hi"}]}]}`), "")
+			chunks := make([][]byte, 0)
+			for chunk := range dataChan {
+				chunks = append(chunks, chunk)
+			}
+			if err, ok := <-errChan; ok && err != nil {
+				t.Fatalf("stream error = %v", err.Error)
+			}
+
+			if len(chunks) != len(tt.want) {
+				t.Fatalf("chunks = %q, want %d chunks", chunks, len(tt.want))
+			}
+			for i, chunk := range chunks {
+				got := gjson.GetBytes(chunk, "candidates.0.content.parts.0.text").String()
+				if message := gjson.GetBytes(chunk, "error.message"); message.Exists() {
+					got = message.String()
+				}
+				if got != tt.want[i] {
+					t.Errorf("chunk %d = %q, want %q", i, got, tt.want[i])
+				}
+			}
+			if got := gjson.GetBytes(chunks[len(chunks)-1], "candidates.0.finishReason").String(); got != tt.wantFinishReason {
+				t.Errorf("finishReason = %q, want %q", got, tt.wantFinishReason)
+			}
+		})
+	}
+}
+
+func TestStreamErrorWrapsGeminiCLIChunk(t *testing.T) {
+	c := &ClientBase{cfg: &config.Config{}}
+	line, streamError := c.replaceStreamError(testRequestContext(GEMINI, false), "gemini-2.5-pro", []byte(`data: {"response":{"error":{"message":"Backend failed"}}}`), true)
+	if !streamError {
+		t.Fatal("replaceStreamError() did not detect the error")
+	}
+	data := line[len(streamDataPrefix):]
+	if got := gjson.GetBytes(data, "response.candidates.0.content.parts.0.text").String(); got != "\n\n[Upstream error: Backend failed]" {
+		t.Errorf("text = %q, want the error note", got)
+	}
+	if got := gjson.GetBytes(data, "response.candidates.0.finishReason").String(); got != "OTHER" {
+		t.Errorf("finishReason = %q, want %q", got, "OTHER")
+	}
+}
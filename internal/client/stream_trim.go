@@ -0,0 +1,85 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// leadingWhitespaceTrimmer removes leading whitespace from the first content delta of a
+// Gemini stream. Thought parts and function calls are skipped so that only the first
+// visible text is affected; all later deltas are passed through untouched.
+type leadingWhitespaceTrimmer struct {
+	enabled bool
+	done    bool
+}
+
+// newLeadingWhitespaceTrimmer creates a trimmer for a single stream.
+//
+// Parameters:
+//   - enabled: Whether trimming is enabled; a disabled trimmer returns chunks unchanged
+//
+// Returns:
+//   - *leadingWhitespaceTrimmer: A new trimmer
+func newLeadingWhitespaceTrimmer(enabled bool) *leadingWhitespaceTrimmer {
+	return &leadingWhitespaceTrimmer{enabled: enabled}
+}
+
+// trim processes a raw stream chunk, which may be a single response object, a response
+// wrapped in a "response" field (Gemini CLI), or a JSON array of either.
+//
+// Parameters:
+//   - data: The raw chunk
+//
+// Returns:
+//   - []byte: The chunk, with leading whitespace removed from the first content text if applicable
+func (t *leadingWhitespaceTrimmer) trim(data []byte) []byte {
+	if !t.enabled || t.done || !gjson.ValidBytes(data) {
+		return data
+	}
+
+	root := gjson.ParseBytes(data)
+	if !root.IsArray() {
+		return t.trimResponse(data, "")
+	}
+	for i := range root.Array() {
+		data = t.trimResponse(data, fmt.Sprintf("%d.", i))
+		if t.done {
+			break
+		}
+	}
+	return data
+}
+
+// trimResponse trims the first text part of the response found at prefix.
+func (t *leadingWhitespaceTrimmer) trimResponse(data []byte, prefix string) []byte {
+	if gjson.GetBytes(data, prefix+"response").Exists() {
+		prefix += "response."
+	}
+
+	partsPath := prefix + "candidates.0.content.parts"
+	parts := gjson.GetBytes(data, partsPath)
+	for i, part := range parts.Array() {
+		if part.Get("thought").Bool() {
+			continue
+		}
+		text := part.Get("text")
+		if !text.Exists() {
+			continue
+		}
+
+		trimmed := strings.TrimLeftFunc(text.String(), unicode.IsSpace)
+		if trimmed != text.String() {
+			data, _ = sjson.SetBytes(data, fmt.Sprintf("%s.%d.text", partsPath, i), trimmed)
+		}
+		// A chunk consisting only of whitespace does not count as the first content delta.
+		if trimmed != "" {
+			t.done = true
+			return data
+		}
+	}
+	return data
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestLeadingWhitespaceTrimmer(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		chunks  []string
+		// want holds the text of the first part of every chunk after trimming.
+		want []string
+	}{
+		{
+			name:   "disabled",
+			chunks: []string{`{"candidates":[{"content":{"parts":[{"text":"\n\nHello"}]}}]}`},
+			want:   []string{"\n\nHello"},
+		},
+		{
+			name:    "first delta trimmed",
+			enabled: true,
+			chunks: []string{
+				`{"candidates":[{"content":{"parts":[{"text":"\n  Hello"}]}}]}`,
+				`{"candidates":[{"content":{"parts":[{"text":" world"}]}}]}`,
+			},
+			want: []string{"Hello", " world"},
+		},
+		{
+			name:    "whitespace-only chunk does not end trimming",
+			enabled: true,
+			chunks: []string{
+				`{"candidates":[{"content":{"parts":[{"text":"\n"}]}}]}`,
+				`{"candidates":[{"content":{"parts":[{"text":"  Hello"}]}}]}`,
+			},
+			want: []string{"", "Hello"},
+		},
+		{
+			name:    "thoughts are left alone",
+			enabled: true,
+			chunks: []string{
+				`{"candidates":[{"content":{"parts":[{"text":"  thinking","thought":true}]}}]}`,
+				`{"candidates":[{"content":{"parts":[{"text":"  Hello"}]}}]}`,
+			},
+			want: []string{"  thinking", "Hello"},
+		},
+		{
+			name:    "Gemini CLI response",
+			enabled: true,
+			chunks:  []string{`{"response":{"candidates":[{"content":{"parts":[{"text":"\tHello"}]}}]}}`},
+			want:    []string{"Hello"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trimmer := newLeadingWhitespaceTrimmer(tt.enabled)
+			for i, chunk := range tt.chunks {
+				trimmed := trimmer.trim([]byte(chunk))
+				parts := gjson.GetBytes(trimmed, "candidates.0.content.parts")
+				if wrapped := gjson.GetBytes(trimmed, "response"); wrapped.Exists() {
+					parts = wrapped.Get("candidates.0.content.parts")
+				}
+				if got := parts.Get("0.text").String(); got != tt.want[i] {
+					t.Errorf("chunk %d text = %q, want %q", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLeadingWhitespaceTrimmerHandlesArrays(t *testing.T) {
+	trimmer := newLeadingWhitespaceTrimmer(true)
+	trimmed := trimmer.trim([]byte(`[{"candidates":[{"content":{"parts":[{"text":" "}]}}]},{"candidates":[{"content":{"parts":[{"text":"  Hi"}]}}]},{"candidates":[{"content":{"parts":[{"text":"  there"}]}}]}]`))
+
+	for i, want := range []string{"", "Hi", "  there"} {
+		if got := gjson.GetBytes(trimmed, fmt.Sprintf("%d.candidates.0.content.parts.0.text", i)).String(); got != want {
+			t.Errorf("response %d text = %q, want %q", i, got, want)
+		}
+	}
+}
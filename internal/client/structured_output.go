@@ -0,0 +1,216 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	// structuredOutputOnFailureError returns an error instead of the best attempt when no
+	// attempt passes validation.
+	structuredOutputOnFailureError = "error"
+
+	// structuredOutputCorrection is sent to the model after an output that failed validation.
+	structuredOutputCorrection = "Your previous output failed validation: %s. Respond again with only the corrected JSON."
+
+	// maxReportedValidationErrors caps the validation errors included in a corrective message.
+	maxReportedValidationErrors = 5
+)
+
+// retryInvalidStructuredOutput validates the response of a non-streaming JSON mode request
+// (responseMimeType application/json) against its response schema. If validation fails, the
+// request is retried with the failed output and the validation errors fed back to the model,
+// up to structured-output.max-retries times. If no attempt passes, the attempt with the fewest
+// errors is returned, or an error if structured-output.on-failure is "error".
+//
+// Parameters:
+//   - ctx: The context for the request
+//   - modelName: The model of the request
+//   - rawJSON: The translated request that produced the response
+//   - bodyBytes: The raw response
+//   - pathPrefix: The path prefix of the request fields ("request." for Gemini CLI)
+//   - send: Sends a request and returns the raw response
+//
+// Returns:
+//   - []byte: The request that produced the returned response
+//   - []byte: The raw response
+//   - *interfaces.ErrorMessage: An error if no attempt passed and on-failure is "error"
+func (c *ClientBase) retryInvalidStructuredOutput(ctx context.Context, modelName string, rawJSON, bodyBytes []byte, pathPrefix string, send func([]byte) ([]byte, *interfaces.ErrorMessage)) ([]byte, []byte, *interfaces.ErrorMessage) {
+	settings := c.cfg.StructuredOutput
+	generationConfig := gjson.GetBytes(rawJSON, pathPrefix+"generationConfig")
+	if settings.MaxRetries <= 0 || generationConfig.Get("responseMimeType").String() != "application/json" {
+		return rawJSON, bodyBytes, nil
+	}
+	schema := generationConfig.Get("responseSchema")
+	if !schema.Exists() {
+		schema = generationConfig.Get("responseJsonSchema")
+	}
+
+	errs := validateStructuredOutput(bodyBytes, schema)
+	if len(errs) == 0 {
+		return rawJSON, bodyBytes, nil
+	}
+	bestJSON, bestBody, bestErrs := rawJSON, bodyBytes, errs
+
+	for attempt := 1; attempt <= settings.MaxRetries; attempt++ {
+		log.Debugf("Model %s structured output failed validation, retry %d of %d (request %s): %s",
+			modelName, attempt, settings.MaxRetries, RequestID(ctx), strings.Join(errs, "; "))
+
+		retryJSON := appendCorrection(rawJSON, pathPrefix, responseText(bodyBytes), errs)
+		retryBody, errMsg := send(retryJSON)
+		if errMsg != nil {
+			log.Warnf("Structured output retry for model %s failed (request %s): %v", modelName, RequestID(ctx), errMsg.Error)
+			break
+		}
+		errs = validateStructuredOutput(retryBody, schema)
+		if len(errs) == 0 {
+			return retryJSON, retryBody, nil
+		}
+		if len(errs) < len(bestErrs) {
+			bestJSON, bestBody, bestErrs = retryJSON, retryBody, errs
+		}
+		bodyBytes = retryBody
+	}
+
+	log.Warnf("Model %s structured output failed validation after retries (request %s): %s",
+		modelName, RequestID(ctx), strings.Join(bestErrs, "; "))
+	if settings.OnFailure == structuredOutputOnFailureError {
+		message := fmt.Sprintf("structured output failed validation: %s", strings.Join(bestErrs, "; "))
+		errJSON, _ := sjson.Set(`{"error":{"code":502,"status":"UNAVAILABLE"}}`, "error.message", message)
+		return nil, nil, &interfaces.ErrorMessage{StatusCode: http.StatusBadGateway, Error: fmt.Errorf("%s", errJSON)}
+	}
+	return bestJSON, bestBody, nil
+}
+
+// appendCorrection appends a failed output and a corrective user message to a request.
+func appendCorrection(rawJSON []byte, pathPrefix, output string, errs []string) []byte {
+	if len(errs) > maxReportedValidationErrors {
+		errs = errs[:maxReportedValidationErrors]
+	}
+	modelTurn, _ := sjson.Set(`{"role":"model","parts":[{"text":""}]}`, "parts.0.text", output)
+	userTurn, _ := sjson.Set(`{"role":"user","parts":[{"text":""}]}`, "parts.0.text", fmt.Sprintf(structuredOutputCorrection, strings.Join(errs, "; ")))
+	rawJSON, _ = sjson.SetRawBytes(rawJSON, pathPrefix+"contents.-1", []byte(modelTurn))
+	rawJSON, _ = sjson.SetRawBytes(rawJSON, pathPrefix+"contents.-1", []byte(userTurn))
+	return rawJSON
+}
+
+// responseText returns the non-thought text of the first candidate of a raw Gemini response,
+// bare or wrapped in a "response" field (Gemini CLI).
+func responseText(data []byte) string {
+	response := gjson.ParseBytes(data)
+	if wrapped := response.Get("response"); wrapped.Exists() {
+		response = wrapped
+	}
+	var text strings.Builder
+	for _, part := range response.Get("candidates.0.content.parts").Array() {
+		if !part.Get("thought").Bool() {
+			text.WriteString(part.Get("text").String())
+		}
+	}
+	return text.String()
+}
+
+// validateStructuredOutput checks that the response text is JSON matching the schema.
+//
+// Parameters:
+//   - data: The raw Gemini response
+//   - schema: The response schema; validation is skipped for parts of the schema that are absent
+//
+// Returns:
+//   - []string: The validation errors, empty if the output is valid
+func validateStructuredOutput(data []byte, schema gjson.Result) []string {
+	text := strings.TrimSpace(responseText(data))
+	if !gjson.Valid(text) {
+		return []string{"output is not valid JSON"}
+	}
+	return validateSchema(gjson.Parse(text), schema, "$")
+}
+
+// validateSchema checks a value against the subset of the OpenAPI and JSON Schema keywords
+// Gemini supports for response schemas: type, nullable, enum, properties, required, and items.
+func validateSchema(value, schema gjson.Result, path string) []string {
+	if !schema.IsObject() {
+		return nil
+	}
+	if value.Type == gjson.Null && schema.Get("nullable").Bool() {
+		return nil
+	}
+
+	if expected := schema.Get("type"); expected.Exists() {
+		types := make([]string, 0)
+		for _, t := range expected.Array() {
+			types = append(types, strings.ToLower(t.String()))
+		}
+		if !slices.Contains(types, jsonType(value)) && !(jsonType(value) == "integer" && slices.Contains(types, "number")) {
+			return []string{fmt.Sprintf("%s must be of type %s", path, strings.Join(types, " or "))}
+		}
+	}
+
+	if enum := schema.Get("enum"); enum.IsArray() {
+		found := false
+		for _, allowed := range enum.Array() {
+			if allowed.Raw == value.Raw || (allowed.Type == gjson.String && allowed.String() == value.String() && value.Type == gjson.String) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return []string{fmt.Sprintf("%s must be one of %s", path, enum.Raw)}
+		}
+	}
+
+	errs := make([]string, 0)
+	if value.IsObject() {
+		for _, required := range schema.Get("required").Array() {
+			if !value.Get(gjson.Escape(required.String())).Exists() {
+				errs = append(errs, fmt.Sprintf("%s.%s is required", path, required.String()))
+			}
+		}
+		schema.Get("properties").ForEach(func(key, propertySchema gjson.Result) bool {
+			if property := value.Get(gjson.Escape(key.String())); property.Exists() {
+				errs = append(errs, validateSchema(property, propertySchema, path+"."+key.String())...)
+			}
+			return true
+		})
+	}
+	if value.IsArray() {
+		if items := schema.Get("items"); items.Exists() {
+			for i, item := range value.Array() {
+				errs = append(errs, validateSchema(item, items, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	}
+	return errs
+}
+
+// jsonType returns the JSON Schema type name of a value.
+func jsonType(value gjson.Result) string {
+	switch {
+	case value.IsObject():
+		return "object"
+	case value.IsArray():
+		return "array"
+	}
+	switch value.Type {
+	case gjson.String:
+		return "string"
+	case gjson.True, gjson.False:
+		return "boolean"
+	case gjson.Null:
+		return "null"
+	case gjson.Number:
+		if value.Num == float64(int64(value.Num)) && !strings.ContainsAny(value.Raw, ".eE") {
+			return "integer"
+		}
+		return "number"
+	}
+	return ""
+}
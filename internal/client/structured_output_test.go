@@ -0,0 +1,155 @@
+package client
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const citySchema = `{"type":"OBJECT","properties":{"city":{"type":"STRING"},"country":{"type":"STRING"}},"required":["city","country"]}`
+
+// textResponse returns a Gemini response whose only part is text.
+func textResponse(text string) string {
+	response, _ := sjson.Set(`{"candidates":[{"content":{"role":"model","parts":[{"text":""}]},"finishReason":"STOP"}]}`, "candidates.0.content.parts.0.text", text)
+	return response
+}
+
+func TestStructuredOutputRetries(t *testing.T) {
+	jsonRequest := `{"contents":[{"role":"user","parts":[{"text":"Where is the Eiffel Tower?"}]}],"generationConfig":{"responseMimeType":"application/json","responseSchema":` + citySchema + `}}`
+	tests := []struct {
+		name         string
+		settings     config.StructuredOutput
+		request      string
+		outputs      []string
+		wantRequests int
+		wantOutput   string
+		wantStatus   int
+	}{
+		{
+			name:         "fails then succeeds after correction",
+			settings:     config.StructuredOutput{MaxRetries: 2},
+			request:      jsonRequest,
+			outputs:      []string{`The Eiffel Tower is in Paris.`, `{"city":"Paris","country":"France"}`},
+			wantRequests: 2,
+			wantOutput:   `{"city":"Paris","country":"France"}`,
+		},
+		{
+			name:         "best attempt returned",
+			settings:     config.StructuredOutput{MaxRetries: 2, OnFailure: "best"},
+			request:      jsonRequest,
+			outputs:      []string{`{"city":1,"country":2}`, `{"city":"Paris"}`, `not json`},
+			wantRequests: 3,
+			wantOutput:   `{"city":"Paris"}`,
+		},
+		{
+			name:         "error after failed retries",
+			settings:     config.StructuredOutput{MaxRetries: 1, OnFailure: structuredOutputOnFailureError},
+			request:      jsonRequest,
+			outputs:      []string{`{"city":"Paris"}`, `{"country":"France"}`},
+			wantRequests: 2,
+			wantStatus:   http.StatusBadGateway,
+		},
+		{
+			name:         "valid output not retried",
+			settings:     config.StructuredOutput{MaxRetries: 2},
+			request:      jsonRequest,
+			outputs:      []string{`{"city":"Paris","country":"France"}`},
+			wantRequests: 1,
+			wantOutput:   `{"city":"Paris","country":"France"}`,
+		},
+		{
+			name:         "retries disabled",
+			request:      jsonRequest,
+			outputs:      []string{`not json`},
+			wantRequests: 1,
+			wantOutput:   `not json`,
+		},
+		{
+			name:         "not JSON mode",
+			settings:     config.StructuredOutput{MaxRetries: 2},
+			request:      `{"contents":[{"role":"user","parts":[{"text":"hi"}]}]}`,
+			outputs:      []string{`Hello!`},
+			wantRequests: 1,
+			wantOutput:   `Hello!`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := make([][]byte, 0)
+			c := NewGeminiClient(&http.Client{Transport: roundTripFunc(func(req *http.Request) *http.Response {
+				body, _ := io.ReadAll(req.Body)
+				requests = append(requests, body)
+				return cannedResponse(http.StatusOK, nil, textResponse(tt.outputs[min(len(requests), len(tt.outputs))-1]))
+			})}, &config.Config{StructuredOutput: tt.settings}, "key")
+
+			resp, err := c.SendRawMessage(testRequestContext(GEMINI, false), "gemini-2.5-flash", []byte(tt.request), "")
+			if len(requests) != tt.wantRequests {
+				t.Errorf("upstream requests = %d, want %d", len(requests), tt.wantRequests)
+			}
+			if tt.wantStatus != 0 {
+				if err == nil || err.StatusCode != tt.wantStatus {
+					t.Fatalf("SendRawMessage() error = %v, want status %d", err, tt.wantStatus)
+				}
+				if !strings.Contains(err.Error.Error(), "structured output failed validation") {
+					t.Errorf("error = %v, want it to name the validation failure", err.Error)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SendRawMessage() error = %v", err.Error)
+			}
+			if got := responseText(resp); got != tt.wantOutput {
+				t.Errorf("output = %q, want %q", got, tt.wantOutput)
+			}
+
+			// Each retry carries the original conversation, the last failed output, and a
+			// corrective message.
+			for i := 1; i < len(requests); i++ {
+				contents := gjson.GetBytes(requests[i], "contents").Array()
+				if len(contents) != 3 {
+					t.Fatalf("retry %d contents = %d, want 3", i, len(contents))
+				}
+				model, correction := contents[len(contents)-2], contents[len(contents)-1]
+				if model.Get("role").String() != "model" || model.Get("parts.0.text").String() != tt.outputs[i-1] {
+					t.Errorf("retry %d model turn = %s, want the failed output", i, model.Raw)
+				}
+				if text := correction.Get("parts.0.text").String(); correction.Get("role").String() != "user" || !strings.HasPrefix(text, "Your previous output failed validation: ") {
+					t.Errorf("retry %d correction = %s, want a corrective user message", i, correction.Raw)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateStructuredOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		output string
+		want   []string
+	}{
+		{name: "valid", schema: citySchema, output: `{"city":"Paris","country":"France"}`},
+		{name: "not JSON", schema: citySchema, output: `Paris`, want: []string{"output is not valid JSON"}},
+		{name: "missing required", schema: citySchema, output: `{"city":"Paris"}`, want: []string{"$.country is required"}},
+		{name: "wrong type", schema: citySchema, output: `{"city":"Paris","country":1}`, want: []string{"$.country must be of type string"}},
+		{name: "integer is a number", schema: `{"type":"NUMBER"}`, output: `3`},
+		{name: "enum", schema: `{"type":"STRING","enum":["red","green"]}`, output: `"blue"`, want: []string{`$ must be one of ["red","green"]`}},
+		{name: "nullable", schema: `{"type":"STRING","nullable":true}`, output: `null`},
+		{name: "array items", schema: `{"type":"ARRAY","items":{"type":"INTEGER"}}`, output: `[1,"two"]`, want: []string{"$[1] must be of type integer"}},
+		{name: "no schema", output: `{"anything":true}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := validateStructuredOutput([]byte(textResponse(tt.output)), gjson.Parse(tt.schema))
+			if strings.Join(got, "; ") != strings.Join(tt.want, "; ") {
+				t.Errorf("errors = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// summarizationPrompt instructs the summarization model how to condense the older history.
+const summarizationPrompt = "Summarize the following conversation between a user and an AI assistant. " +
+	"Preserve facts, decisions, open tasks, file names, identifiers, and tool results that later turns may rely on. " +
+	"Be concise and write the summary as plain text.\n\n"
+
+// summaryGenerator sends a bare Gemini generateContent request to a model and returns the
+// bare Gemini response.
+type summaryGenerator func(ctx context.Context, modelName string, request []byte) ([]byte, *interfaces.ErrorMessage)
+
+// isContextOverflow reports whether an upstream error indicates that the request exceeded
+// the model's context window.
+func isContextOverflow(err *interfaces.ErrorMessage) bool {
+	if err == nil || err.StatusCode != 400 || err.Error == nil {
+		return false
+	}
+	message := err.Error.Error()
+	return strings.Contains(message, "exceeds the maximum number of tokens") ||
+		strings.Contains(message, "input token count")
+}
+
+// exceedsSummarizationTrigger reports whether a translated request is estimated to exceed the
+// configured trigger-tokens, using roughly four bytes of contents per token.
+func (c *ClientBase) exceedsSummarizationTrigger(rawJSON []byte, pathPrefix string) bool {
+	cfg := c.cfg.ContextSummarization
+	if !cfg.Enabled || cfg.TriggerTokens <= 0 {
+		return false
+	}
+	return len(gjson.GetBytes(rawJSON, pathPrefix+"contents").Raw)/4 > cfg.TriggerTokens
+}
+
+// summarizeHistory replaces the older contents of a translated Gemini request with a summary
+// produced by the configured summarization model. The summary is appended to the system
+// instruction, and the most recent messages are kept verbatim, starting at a user turn.
+//
+// Parameters:
+//   - ctx: The context for the request
+//   - rawJSON: The translated Gemini request
+//   - pathPrefix: The prefix of the Gemini request body ("request." for Gemini CLI, "" for Gemini)
+//   - generate: Sends the summarization request upstream
+//
+// Returns:
+//   - []byte: The request with the summarized history
+//   - bool: Whether the history was summarized
+func (c *ClientBase) summarizeHistory(ctx context.Context, rawJSON []byte, pathPrefix string, generate summaryGenerator) ([]byte, bool) {
+	cfg := c.cfg.ContextSummarization
+	if !cfg.Enabled {
+		return rawJSON, false
+	}
+
+	contents := gjson.GetBytes(rawJSON, pathPrefix+"contents").Array()
+	split := len(contents) - cfg.KeepRecentMessages
+	// The kept history must start with a user turn that is not a tool result.
+	for split > 0 && split < len(contents) && !isPlainUserTurn(contents[split]) {
+		split++
+	}
+	if split <= 0 || split >= len(contents) {
+		return rawJSON, false
+	}
+
+	var transcript strings.Builder
+	for _, content := range contents[:split] {
+		writeTranscriptTurn(&transcript, content)
+	}
+
+	request := `{"contents":[{"role":"user","parts":[{"text":""}]}]}`
+	request, _ = sjson.Set(request, "contents.0.parts.0.text", summarizationPrompt+transcript.String())
+	response, errMsg := generate(ctx, cfg.Model, []byte(request))
+	if errMsg != nil {
+		log.Warnf("failed to summarize conversation history with %s: %v", cfg.Model, errMsg.Error)
+		return rawJSON, false
+	}
+
+	var summary strings.Builder
+	gjson.GetBytes(response, "candidates.0.content.parts").ForEach(func(_, part gjson.Result) bool {
+		if !part.Get("thought").Bool() {
+			summary.WriteString(part.Get("text").String())
+		}
+		return true
+	})
+	if summary.Len() == 0 {
+		log.Warnf("summarization model %s returned an empty summary", cfg.Model)
+		return rawJSON, false
+	}
+
+	kept := make([]string, 0, len(contents)-split)
+	for _, content := range contents[split:] {
+		kept = append(kept, content.Raw)
+	}
+	rawJSON, _ = sjson.SetRawBytes(rawJSON, pathPrefix+"contents", []byte("["+strings.Join(kept, ",")+"]"))
+
+	key := "systemInstruction"
+	if gjson.GetBytes(rawJSON, pathPrefix+"system_instruction").Exists() {
+		key = "system_instruction"
+	}
+	note := "Summary of the earlier conversation:\n" + summary.String()
+	rawJSON, _ = sjson.SetBytes(rawJSON, pathPrefix+key+".parts.-1", map[string]string{"text": note})
+	if !gjson.GetBytes(rawJSON, pathPrefix+key+".role").Exists() {
+		rawJSON, _ = sjson.SetBytes(rawJSON, pathPrefix+key+".role", "user")
+	}
+
+	log.Debugf("Summarized %d of %d messages with %s (request %s)", split, len(contents), cfg.Model, RequestID(ctx))
+	return rawJSON, true
+}
+
+// isPlainUserTurn reports whether a content is a user turn that does not carry tool results.
+func isPlainUserTurn(content gjson.Result) bool {
+	if content.Get("role").String() != "user" {
+		return false
+	}
+	plain := true
+	content.Get("parts").ForEach(func(_, part gjson.Result) bool {
+		plain = !part.Get("functionResponse").Exists()
+		return plain
+	})
+	return plain
+}
+
+// writeTranscriptTurn renders a single content as plain text for the summarization prompt.
+func writeTranscriptTurn(transcript *strings.Builder, content gjson.Result) {
+	role := content.Get("role").String()
+	content.Get("parts").ForEach(func(_, part gjson.Result) bool {
+		switch {
+		case part.Get("thought").Bool():
+		case part.Get("text").Exists():
+			transcript.WriteString(fmt.Sprintf("%s: %s\n", role, part.Get("text").String()))
+		case part.Get("functionCall").Exists():
+			transcript.WriteString(fmt.Sprintf("%s called tool %s with %s\n", role, part.Get("functionCall.name").String(), part.Get("functionCall.args").Raw))
+		case part.Get("functionResponse").Exists():
+			transcript.WriteString(fmt.Sprintf("tool %s returned %s\n", part.Get("functionResponse.name").String(), part.Get("functionResponse.response").Raw))
+		}
+		return true
+	})
+}
@@ -0,0 +1,119 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	"github.com/tidwall/gjson"
+)
+
+// longConversation is a Gemini request with five turns; the fourth is a tool result.
+const longConversation = `{"systemInstruction":{"parts":[{"text":"Be brief."}]},"contents":[` +
+	`{"role":"user","parts":[{"text":"My name is Ada."}]},` +
+	`{"role":"model","parts":[{"functionCall":{"name":"lookup","args":{"q":"Ada"}}}]},` +
+	`{"role":"user","parts":[{"functionResponse":{"name":"lookup","response":{"found":true}}}]},` +
+	`{"role":"model","parts":[{"text":"Found you."}]},` +
+	`{"role":"user","parts":[{"text":"What is my name?"}]}]}`
+
+func TestIsContextOverflow(t *testing.T) {
+	tests := []struct {
+		name string
+		err  *interfaces.ErrorMessage
+		want bool
+	}{
+		{name: "nil", want: false},
+		{name: "token limit", err: &interfaces.ErrorMessage{StatusCode: 400, Error: errors.New("The input token count (1200000) exceeds the maximum number of tokens allowed (1048576).")}, want: true},
+		{name: "other 400", err: &interfaces.ErrorMessage{StatusCode: 400, Error: errors.New("Invalid argument")}, want: false},
+		{name: "other status", err: &interfaces.ErrorMessage{StatusCode: 429, Error: errors.New("exceeds the maximum number of tokens")}, want: false},
+	}
+	for _, tt := range tests {
+		if got := isContextOverflow(tt.err); got != tt.want {
+			t.Errorf("%s: isContextOverflow() = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSummarizeHistory(t *testing.T) {
+	var summarized string
+	generate := func(_ context.Context, modelName string, request []byte) ([]byte, *interfaces.ErrorMessage) {
+		if modelName != "gemini-2.5-flash" {
+			t.Errorf("summarization model = %q, want gemini-2.5-flash", modelName)
+		}
+		summarized = gjson.GetBytes(request, "contents.0.parts.0.text").String()
+		return []byte(`{"candidates":[{"content":{"parts":[{"text":"thinking","thought":true},{"text":"The user is Ada."}]}}]}`), nil
+	}
+	c := &ClientBase{cfg: &config.Config{ContextSummarization: config.ContextSummarization{Enabled: true, Model: "gemini-2.5-flash", KeepRecentMessages: 3}}}
+
+	got, ok := c.summarizeHistory(context.Background(), []byte(longConversation), "", generate)
+	if !ok {
+		t.Fatal("summarizeHistory() did not summarize")
+	}
+
+	// Keeping three messages would start at the tool result, so the kept history starts at
+	// the next plain user turn.
+	contents := gjson.GetBytes(got, "contents").Array()
+	if len(contents) != 1 || contents[0].Get("parts.0.text").String() != "What is my name?" {
+		t.Errorf("kept contents = %s, want only the last user turn", gjson.GetBytes(got, "contents").Raw)
+	}
+	for _, want := range []string{"user: My name is Ada.", "model called tool lookup", "tool lookup returned", "model: Found you."} {
+		if !strings.Contains(summarized, want) {
+			t.Errorf("summarization prompt lacks %q:\n%s", want, summarized)
+		}
+	}
+	parts := gjson.GetBytes(got, "systemInstruction.parts").Array()
+	if len(parts) != 2 || parts[0].Get("text").String() != "Be brief." || !strings.HasSuffix(parts[1].Get("text").String(), "The user is Ada.") {
+		t.Errorf("system instruction = %s, want the summary appended", gjson.GetBytes(got, "systemInstruction").Raw)
+	}
+}
+
+func TestSummarizeHistoryKeepsRequestWhenNotPossible(t *testing.T) {
+	failing := func(context.Context, string, []byte) ([]byte, *interfaces.ErrorMessage) {
+		return nil, &interfaces.ErrorMessage{StatusCode: 500, Error: errors.New("unavailable")}
+	}
+	empty := func(context.Context, string, []byte) ([]byte, *interfaces.ErrorMessage) {
+		return []byte(`{"candidates":[{"content":{"parts":[]}}]}`), nil
+	}
+	tests := []struct {
+		name     string
+		cfg      config.ContextSummarization
+		generate summaryGenerator
+	}{
+		{name: "disabled", cfg: config.ContextSummarization{KeepRecentMessages: 1}, generate: empty},
+		{name: "short history", cfg: config.ContextSummarization{Enabled: true, KeepRecentMessages: 10}, generate: empty},
+		{name: "summarization fails", cfg: config.ContextSummarization{Enabled: true, KeepRecentMessages: 1}, generate: failing},
+		{name: "empty summary", cfg: config.ContextSummarization{Enabled: true, KeepRecentMessages: 1}, generate: empty},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &ClientBase{cfg: &config.Config{ContextSummarization: tt.cfg}}
+			got, ok := c.summarizeHistory(context.Background(), []byte(longConversation), "", tt.generate)
+			if ok || string(got) != longConversation {
+				t.Errorf("summarizeHistory() = %s, %t, want the request unchanged", got, ok)
+			}
+		})
+	}
+}
+
+func TestExceedsSummarizationTrigger(t *testing.T) {
+	request := []byte(`{"request":{"contents":[{"role":"user","parts":[{"text":"` + strings.Repeat("a", 400) + `"}]}]}}`)
+	tests := []struct {
+		name string
+		cfg  config.ContextSummarization
+		want bool
+	}{
+		{name: "disabled", cfg: config.ContextSummarization{TriggerTokens: 10}, want: false},
+		{name: "no trigger", cfg: config.ContextSummarization{Enabled: true}, want: false},
+		{name: "below trigger", cfg: config.ContextSummarization{Enabled: true, TriggerTokens: 1000}, want: false},
+		{name: "above trigger", cfg: config.ContextSummarization{Enabled: true, TriggerTokens: 50}, want: true},
+	}
+	for _, tt := range tests {
+		c := &ClientBase{cfg: &config.Config{ContextSummarization: tt.cfg}}
+		if got := c.exceedsSummarizationTrigger(request, "request."); got != tt.want {
+			t.Errorf("%s: exceedsSummarizationTrigger() = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	// thinkingOutputSeparate returns thoughts as thought parts, which translators map to
+	// the reasoning field of their format.
+	thinkingOutputSeparate = "separate"
+
+	// thinkingOutputInline returns thoughts as regular text wrapped in <think> tags.
+	thinkingOutputInline = "inline"
+
+	// thinkingOutputHidden removes thoughts from the response.
+	thinkingOutputHidden = "hidden"
+)
+
+// thoughtFormatter rewrites the thought parts of a Gemini response according to the
+// thinking-output mode, whether delivered as a single body or as a sequence of stream chunks.
+type thoughtFormatter struct {
+	mode      string
+	inThought bool
+}
+
+// newThoughtFormatter creates a formatter for a model. The thinking-output setting of the
+// API key that authenticated the request takes precedence over the per-model setting, and
+// thoughts are always hidden when include-thoughts is disabled.
+func (c *ClientBase) newThoughtFormatter(ctx context.Context, model string) *thoughtFormatter {
+	if !c.cfg.IncludeThoughts {
+		return &thoughtFormatter{mode: thinkingOutputHidden}
+	}
+	mode, ok := c.cfg.ThinkingOutput[model]
+	if !ok {
+		mode = c.cfg.ThinkingOutput["*"]
+	}
+	if ginContext, okGin := ctx.Value("gin").(*gin.Context); okGin {
+		if setting := c.cfg.GetAPIKeySetting(ginContext.GetString("apiKey")); setting != nil && setting.ThinkingOutput != "" {
+			mode = setting.ThinkingOutput
+		}
+	}
+	return &thoughtFormatter{mode: mode}
+}
+
+// apply rewrites the thought parts of a raw Gemini payload. The payload may be a single
+// response, a response wrapped in a "response" field (Gemini CLI), or a JSON array of either.
+//
+// Parameters:
+//   - data: The raw payload
+//
+// Returns:
+//   - []byte: The payload with thoughts hidden or inlined
+func (f *thoughtFormatter) apply(data []byte) []byte {
+	if (f.mode != thinkingOutputInline && f.mode != thinkingOutputHidden) || !gjson.ValidBytes(data) {
+		return data
+	}
+
+	result := gjson.ParseBytes(data)
+	if !result.IsArray() {
+		return []byte(f.applyResponse(result.Raw))
+	}
+
+	items := make([]string, 0)
+	result.ForEach(func(_, item gjson.Result) bool {
+		items = append(items, f.applyResponse(item.Raw))
+		return true
+	})
+	return []byte("[" + strings.Join(items, ",") + "]")
+}
+
+// applyResponse rewrites the thought parts of a single response object. In inline mode the
+// opening tag is added to the first thought and the closing tag to the first part that follows
+// the thoughts, which may arrive in a later stream chunk.
+func (f *thoughtFormatter) applyResponse(response string) string {
+	partsPath := "candidates.0.content.parts"
+	if gjson.Get(response, "response").Exists() {
+		partsPath = "response." + partsPath
+	}
+
+	parts := gjson.Get(response, partsPath).Array()
+	if len(parts) == 0 {
+		return response
+	}
+
+	kept := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part.Get("thought").Bool() {
+			if f.mode == thinkingOutputHidden {
+				continue
+			}
+			text := part.Get("text").String()
+			if !f.inThought {
+				text = "<think>\n" + text
+				f.inThought = true
+			}
+			raw, _ := sjson.Delete(part.Raw, "thought")
+			raw, _ = sjson.Set(raw, "text", text)
+			kept = append(kept, raw)
+			continue
+		}
+
+		if f.inThought {
+			f.inThought = false
+			if text := part.Get("text"); text.Exists() {
+				raw, _ := sjson.Set(part.Raw, "text", "\n</think>\n\n"+text.String())
+				kept = append(kept, raw)
+				continue
+			}
+			kept = append(kept, `{"text":"\n</think>\n\n"}`)
+		}
+		kept = append(kept, part.Raw)
+	}
+
+	response, _ = sjson.SetRaw(response, partsPath, fmt.Sprintf("[%s]", strings.Join(kept, ",")))
+	return response
+}
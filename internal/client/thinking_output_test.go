@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	"github.com/tidwall/gjson"
+)
+
+// partTexts returns the texts of Gemini parts, with thought parts prefixed by "thought:".
+func partTexts(parts gjson.Result) []string {
+	texts := make([]string, 0)
+	for _, part := range parts.Array() {
+		if part.Get("thought").Bool() {
+			texts = append(texts, "thought:"+part.Get("text").String())
+			continue
+		}
+		texts = append(texts, part.Get("text").String())
+	}
+	return texts
+}
+
+func TestThoughtFormatterModes(t *testing.T) {
+	response := `{"candidates":[{"content":{"role":"model","parts":[{"text":"plan","thought":true},{"text":"answer"}]}}]}`
+	chunks := []string{
+		`{"response":{"candidates":[{"content":{"parts":[{"text":"step one","thought":true}]}}]}}`,
+		`{"response":{"candidates":[{"content":{"parts":[{"text":" step two","thought":true}]}}]}}`,
+		`{"response":{"candidates":[{"content":{"parts":[{"text":"answer"}]}}]}}`,
+	}
+	tests := []struct {
+		name       string
+		mode       string
+		wantParts  []string
+		wantChunks [][]string
+	}{
+		{
+			name:       "separate",
+			mode:       thinkingOutputSeparate,
+			wantParts:  []string{"thought:plan", "answer"},
+			wantChunks: [][]string{{"thought:step one"}, {"thought: step two"}, {"answer"}},
+		},
+		{
+			name:       "inline",
+			mode:       thinkingOutputInline,
+			wantParts:  []string{"<think>\nplan", "\n</think>\n\nanswer"},
+			wantChunks: [][]string{{"<think>\nstep one"}, {" step two"}, {"\n</think>\n\nanswer"}},
+		},
+		{
+			name:       "hidden",
+			mode:       thinkingOutputHidden,
+			wantParts:  []string{"answer"},
+			wantChunks: [][]string{{}, {}, {"answer"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := (&thoughtFormatter{mode: tt.mode}).apply([]byte(response))
+			if got := partTexts(gjson.GetBytes(out, "candidates.0.content.parts")); !slices.Equal(got, tt.wantParts) {
+				t.Errorf("non-stream parts = %q, want %q", got, tt.wantParts)
+			}
+
+			stream := &thoughtFormatter{mode: tt.mode}
+			for i, chunk := range chunks {
+				out = stream.apply([]byte(chunk))
+				if got := partTexts(gjson.GetBytes(out, "response.candidates.0.content.parts")); !slices.Equal(got, tt.wantChunks[i]) {
+					t.Errorf("chunk %d parts = %q, want %q", i, got, tt.wantChunks[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNewThoughtFormatterMode(t *testing.T) {
+	cfg := &config.Config{
+		IncludeThoughts: true,
+		ThinkingOutput:  map[string]string{"gemini-2.5-pro": thinkingOutputInline, "*": thinkingOutputHidden},
+		APIKeySettings:  []config.APIKeySetting{{APIKey: "key-separate", ThinkingOutput: thinkingOutputSeparate}, {APIKey: "key-default"}},
+	}
+	tests := []struct {
+		name            string
+		includeThoughts bool
+		model           string
+		apiKey          string
+		want            string
+	}{
+		{name: "model setting", includeThoughts: true, model: "gemini-2.5-pro", want: thinkingOutputInline},
+		{name: "default setting", includeThoughts: true, model: "gemini-2.5-flash", want: thinkingOutputHidden},
+		{name: "api key setting wins", includeThoughts: true, model: "gemini-2.5-pro", apiKey: "key-separate", want: thinkingOutputSeparate},
+		{name: "api key without setting", includeThoughts: true, model: "gemini-2.5-pro", apiKey: "key-default", want: thinkingOutputInline},
+		{name: "thoughts disabled", includeThoughts: false, model: "gemini-2.5-pro", apiKey: "key-separate", want: thinkingOutputHidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ginContext, _ := gin.CreateTestContext(httptest.NewRecorder())
+			ginContext.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+			ginContext.Set("apiKey", tt.apiKey)
+			ctx := context.WithValue(context.Background(), "gin", ginContext)
+
+			modeCfg := *cfg
+			modeCfg.IncludeThoughts = tt.includeThoughts
+			if got := (&ClientBase{cfg: &modeCfg}).newThoughtFormatter(ctx, tt.model).mode; got != tt.want {
+				t.Errorf("mode = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	geminiAuth "github.com/luispater/CLIProxyAPI/v5/internal/auth/gemini"
+	"github.com/luispater/CLIProxyAPI/v5/internal/util"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"golang.org/x/oauth2"
+)
+
+// persistingTokenSource wraps the token source of a Gemini CLI client and writes each token
+// refreshed by the OAuth2 transport back to the token file, so that a restart starts from the
+// latest token and a rotated refresh token is not lost.
+type persistingTokenSource struct {
+	client *GeminiCLIClient
+
+	// mu protects source and accessToken.
+	mu          sync.Mutex
+	source      oauth2.TokenSource
+	accessToken string
+}
+
+// Token returns the current token of the wrapped source and persists it if it was refreshed.
+func (s *persistingTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	source := s.source
+	s.mu.Unlock()
+
+	token, err := source.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	refreshed := token.AccessToken != s.accessToken
+	s.accessToken = token.AccessToken
+	s.mu.Unlock()
+
+	if refreshed {
+		if errSave := s.client.saveRefreshedToken(token); errSave != nil {
+			log.Warnf("Failed to persist refreshed token of Gemini CLI account %s: %v", util.AccountLabel(s.client.cfg, s.client.GetEmail()), errSave)
+		}
+	}
+	return token, nil
+}
+
+// setSource replaces the wrapped token source. accessToken is the access token the new source
+// starts from, which is already persisted.
+func (s *persistingTokenSource) setSource(source oauth2.TokenSource, accessToken string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.source = source
+	s.accessToken = accessToken
+}
+
+// persistRefreshedTokens returns an HTTP client that uses the OAuth2 transport of httpClient
+// with its token source wrapped to persist refreshed tokens. Clients without an OAuth2
+// transport are returned unchanged.
+func (c *GeminiCLIClient) persistRefreshedTokens(httpClient *http.Client) *http.Client {
+	transport, ok := httpClient.Transport.(*oauth2.Transport)
+	if !ok {
+		return httpClient
+	}
+	source := &persistingTokenSource{source: transport.Source, client: c, accessToken: c.storedAccessToken()}
+
+	wrapped := *httpClient
+	wrapped.Transport = &oauth2.Transport{Source: source, Base: transport.Base}
+	return &wrapped
+}
+
+// replaceTokenSource makes the HTTP client of the client use the token source of httpClient,
+// which was created for a refreshed token. The caller must hold tokenMutex.
+func (c *GeminiCLIClient) replaceTokenSource(httpClient *http.Client) error {
+	transport, ok := httpClient.Transport.(*oauth2.Transport)
+	if !ok {
+		return fmt.Errorf("unexpected transport type %T", httpClient.Transport)
+	}
+	current, ok := c.httpClient.Transport.(*oauth2.Transport)
+	if !ok {
+		return fmt.Errorf("unexpected transport type %T", c.httpClient.Transport)
+	}
+	source, ok := current.Source.(*persistingTokenSource)
+	if !ok {
+		return fmt.Errorf("unexpected token source type %T", current.Source)
+	}
+	source.setSource(transport.Source, c.storedAccessToken())
+	return nil
+}
+
+// storedAccessToken returns the access token of the token storage.
+func (c *GeminiCLIClient) storedAccessToken() string {
+	ts, ok := c.tokenStorage.(*geminiAuth.GeminiTokenStorage)
+	if !ok {
+		return ""
+	}
+	stored, _ := json.Marshal(ts.Token)
+	return gjson.GetBytes(stored, "access_token").String()
+}
+
+// saveRefreshedToken stores a refreshed token in the token storage and writes it to the token
+// file. It runs inside requests, from the OAuth2 transport, so it must not take RequestMutex;
+// the write is guarded by tokenMutex instead, so that concurrent refreshes do not corrupt the
+// file.
+func (c *GeminiCLIClient) saveRefreshedToken(token *oauth2.Token) error {
+	c.tokenMutex.Lock()
+	defer c.tokenMutex.Unlock()
+
+	if ts, ok := c.tokenStorage.(*geminiAuth.GeminiTokenStorage); ok {
+		if err := ts.SetToken(token); err != nil {
+			return err
+		}
+	}
+	log.Debugf("Persisting refreshed token of Gemini CLI account %s", util.AccountLabel(c.cfg, c.GetEmail()))
+	return c.saveTokenFile()
+}
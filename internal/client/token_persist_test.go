@@ -0,0 +1,112 @@
+package client
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	geminiAuth "github.com/luispater/CLIProxyAPI/v5/internal/auth/gemini"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	"github.com/tidwall/gjson"
+	"golang.org/x/oauth2"
+)
+
+// newTestGeminiCLIClient returns a Gemini CLI client whose OAuth2 transport hands out token.
+func newTestGeminiCLIClient(t *testing.T, token *oauth2.Token) *GeminiCLIClient {
+	t.Helper()
+	cfg := &config.Config{AuthDir: t.TempDir()}
+	ts := &geminiAuth.GeminiTokenStorage{
+		Email:     "user@example.com",
+		ProjectID: "project-1",
+		Token:     map[string]any{"access_token": "expired", "refresh_token": "refresh"},
+	}
+	httpClient := &http.Client{Transport: &oauth2.Transport{Source: oauth2.StaticTokenSource(token)}}
+	return NewGeminiCLIClient(httpClient, ts, cfg)
+}
+
+func TestRefreshedTokenIsPersistedWhileRequestMutexIsHeld(t *testing.T) {
+	c := newTestGeminiCLIClient(t, &oauth2.Token{AccessToken: "fresh", RefreshToken: "refresh", Expiry: time.Now().Add(time.Hour)})
+
+	// A request holds the request mutex while the transport refreshes the token.
+	c.RequestMutex.Lock()
+	defer c.RequestMutex.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.CurrentToken()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("CurrentToken() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("token refresh blocked on the request mutex")
+	}
+
+	data, err := os.ReadFile(filepath.Join(c.cfg.AuthDir, "user@example.com-project-1.json"))
+	if err != nil {
+		t.Fatalf("token file not written: %v", err)
+	}
+	if got := gjson.GetBytes(data, "token.access_token").String(); got != "fresh" {
+		t.Errorf("persisted access_token = %q, want %q", got, "fresh")
+	}
+}
+
+func TestReplaceTokenSourceKeepsHTTPClient(t *testing.T) {
+	c := newTestGeminiCLIClient(t, &oauth2.Token{AccessToken: "first", Expiry: time.Now().Add(time.Hour)})
+	httpClient := c.httpClient
+
+	replacement := &http.Client{Transport: &oauth2.Transport{Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "second", Expiry: time.Now().Add(time.Hour)})}}
+	c.tokenMutex.Lock()
+	err := c.replaceTokenSource(replacement)
+	c.tokenMutex.Unlock()
+	if err != nil {
+		t.Fatalf("replaceTokenSource() error = %v", err)
+	}
+
+	if c.httpClient != httpClient {
+		t.Error("the HTTP client was replaced")
+	}
+	token, err := c.CurrentToken()
+	if err != nil {
+		t.Fatalf("CurrentToken() error = %v", err)
+	}
+	if token.AccessToken != "second" {
+		t.Errorf("AccessToken = %q, want %q", token.AccessToken, "second")
+	}
+}
+
+// countingTokenSource counts the tokens requested from it.
+type countingTokenSource struct {
+	calls int
+}
+
+func (s *countingTokenSource) Token() (*oauth2.Token, error) {
+	s.calls++
+	return &oauth2.Token{AccessToken: "fresh", Expiry: time.Now().Add(time.Hour)}, nil
+}
+
+func TestTokenExpiryReadsStoredTokenWithoutRefresh(t *testing.T) {
+	expiry := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	source := &countingTokenSource{}
+	ts := &geminiAuth.GeminiTokenStorage{
+		Email: "user@example.com",
+		Token: map[string]any{"access_token": "expired", "refresh_token": "refresh", "expiry": expiry.Format(time.RFC3339)},
+	}
+	c := NewGeminiCLIClient(&http.Client{Transport: &oauth2.Transport{Source: source}}, ts, &config.Config{AuthDir: t.TempDir()})
+
+	got, err := c.TokenExpiry()
+	if err != nil {
+		t.Fatalf("TokenExpiry() error = %v", err)
+	}
+	if !got.Equal(expiry) {
+		t.Errorf("TokenExpiry() = %v, want %v", got, expiry)
+	}
+	if source.calls != 0 {
+		t.Errorf("token source called %d times, want 0", source.calls)
+	}
+}
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"github.com/tidwall/gjson"
+)
+
+// stopOnToolCall reports whether streaming for a model should end as soon as a chunk
+// containing a function call has been forwarded, falling back to the "*" entry.
+func (c *ClientBase) stopOnToolCall(model string) bool {
+	if stop, ok := c.cfg.StopOnToolCall[model]; ok {
+		return stop
+	}
+	return c.cfg.StopOnToolCall["*"]
+}
+
+// flushToolCalls reports whether the tool calls of a stream for a model should each be sent
+// in a chunk of their own, falling back to the "*" entry.
+func (c *ClientBase) flushToolCalls(model string) bool {
+	if flush, ok := c.cfg.FlushToolCalls[model]; ok {
+		return flush
+	}
+	return c.cfg.FlushToolCalls["*"]
+}
+
+// containsFunctionCall reports whether a raw Gemini stream chunk, bare or wrapped in a
+// "response" field (Gemini CLI), contains a function call part.
+func containsFunctionCall(data []byte) bool {
+	response := gjson.ParseBytes(data)
+	if wrapped := response.Get("response"); wrapped.Exists() {
+		response = wrapped
+	}
+	found := false
+	response.Get("candidates.0.content.parts").ForEach(func(_, part gjson.Result) bool {
+		found = part.Get("functionCall").Exists()
+		return !found
+	})
+	return found
+}
@@ -0,0 +1,190 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// functionDeclarationKeys lists the field names a Gemini tool may use for its declarations.
+var functionDeclarationKeys = []string{"functionDeclarations", "function_declarations"}
+
+// parameterSchemaKeys lists the field names a function declaration may use for its parameter schema.
+var parameterSchemaKeys = []string{"parameters", "parametersJsonSchema", "parameters_json_schema"}
+
+// limitToolDeclarations enforces the configured tool-limits on a translated Gemini request
+// before it is sent upstream. When a limit is exceeded the request is rejected with a 400 error
+// naming the limit, or, if truncation is enabled, the declarations beyond the limit are dropped
+// and a warning is logged. If prune-descriptions is enabled, the parameter descriptions are
+// removed first when the declarations exceed max-schema-bytes.
+//
+// Parameters:
+//   - rawJSON: The translated Gemini request
+//   - pathPrefix: The prefix of the Gemini request body ("request." for Gemini CLI, "" for Gemini)
+//
+// Returns:
+//   - []byte: The request, possibly with declarations or descriptions removed
+//   - *interfaces.ErrorMessage: An error if a limit is exceeded and truncation is disabled
+func (c *ClientBase) limitToolDeclarations(rawJSON []byte, pathPrefix string) ([]byte, *interfaces.ErrorMessage) {
+	limits := c.cfg.ToolLimits
+	if limits.MaxDeclarations <= 0 && limits.MaxSchemaBytes <= 0 && limits.MaxSchemaDepth <= 0 {
+		return rawJSON, nil
+	}
+
+	totalCount, totalSize := declarationStats(rawJSON, pathPrefix)
+	if limits.PruneDescriptions && limits.MaxSchemaBytes > 0 && totalSize > limits.MaxSchemaBytes {
+		rawJSON = pruneToolDescriptions(rawJSON, pathPrefix)
+		prunedSize := totalSize
+		_, totalSize = declarationStats(rawJSON, pathPrefix)
+		log.Debugf("Pruned parameter descriptions of tool declarations from %d to %d bytes to fit tool-limits.max-schema-bytes", prunedSize, totalSize)
+	}
+
+	type declarationList struct {
+		path string
+		kept []string
+	}
+
+	tools := gjson.GetBytes(rawJSON, pathPrefix+"tools").Array()
+	lists := make([]declarationList, 0, len(tools))
+	count, size, dropped := 0, 0, 0
+	for i, tool := range tools {
+		for _, key := range functionDeclarationKeys {
+			declarations := tool.Get(key)
+			if !declarations.IsArray() {
+				continue
+			}
+			list := declarationList{path: fmt.Sprintf("%stools.%d.%s", pathPrefix, i, key)}
+			for _, declaration := range declarations.Array() {
+				var errLimit *interfaces.ErrorMessage
+				if depth := schemaDepth(parameterSchema(declaration)); limits.MaxSchemaDepth > 0 && depth > limits.MaxSchemaDepth {
+					errLimit = toolLimitError(fmt.Sprintf("tool %q has a parameter schema nesting depth of %d, exceeding the limit of %d",
+						declaration.Get("name").String(), depth, limits.MaxSchemaDepth))
+				} else {
+					count++
+					size += len(declaration.Raw)
+					if limits.MaxDeclarations > 0 && count > limits.MaxDeclarations {
+						errLimit = toolLimitError(fmt.Sprintf("request has %d tool declarations, exceeding the limit of %d",
+							totalCount, limits.MaxDeclarations))
+					} else if limits.MaxSchemaBytes > 0 && size > limits.MaxSchemaBytes {
+						errLimit = toolLimitError(fmt.Sprintf("tool declarations total %d bytes, exceeding the limit of %d bytes",
+							totalSize, limits.MaxSchemaBytes))
+					}
+				}
+				if errLimit == nil {
+					list.kept = append(list.kept, declaration.Raw)
+					continue
+				}
+				if !limits.Truncate {
+					return rawJSON, errLimit
+				}
+				dropped++
+			}
+			lists = append(lists, list)
+		}
+	}
+	if dropped == 0 {
+		return rawJSON, nil
+	}
+
+	log.Warnf("Dropped %d of %d tool declarations exceeding tool-limits", dropped, totalCount)
+	for _, list := range lists {
+		if len(list.kept) == 0 {
+			rawJSON, _ = sjson.DeleteBytes(rawJSON, list.path)
+			continue
+		}
+		rawJSON, _ = sjson.SetRawBytes(rawJSON, list.path, []byte("["+strings.Join(list.kept, ",")+"]"))
+	}
+	return rawJSON, nil
+}
+
+// declarationStats returns the number of function declarations of a request and their total size in bytes.
+func declarationStats(rawJSON []byte, pathPrefix string) (int, int) {
+	count, size := 0, 0
+	for _, tool := range gjson.GetBytes(rawJSON, pathPrefix+"tools").Array() {
+		for _, key := range functionDeclarationKeys {
+			for _, declaration := range tool.Get(key).Array() {
+				count++
+				size += len(declaration.Raw)
+			}
+		}
+	}
+	return count, size
+}
+
+// parameterSchema returns the parameter schema of a function declaration.
+func parameterSchema(declaration gjson.Result) gjson.Result {
+	for _, key := range parameterSchemaKeys {
+		if schema := declaration.Get(key); schema.Exists() {
+			return schema
+		}
+	}
+	return gjson.Result{}
+}
+
+// schemaDepth returns the nesting depth of a schema: 1 for a schema without nested schemas,
+// plus one for each level of properties, items, or anyOf/oneOf/allOf alternatives.
+func schemaDepth(schema gjson.Result) int {
+	if !schema.IsObject() {
+		return 0
+	}
+	deepest := 0
+	schema.Get("properties").ForEach(func(_, property gjson.Result) bool {
+		deepest = max(deepest, schemaDepth(property))
+		return true
+	})
+	deepest = max(deepest, schemaDepth(schema.Get("items")))
+	for _, key := range []string{"anyOf", "oneOf", "allOf"} {
+		for _, alternative := range schema.Get(key).Array() {
+			deepest = max(deepest, schemaDepth(alternative))
+		}
+	}
+	return deepest + 1
+}
+
+// pruneToolDescriptions removes the descriptions from the parameter schemas of all function
+// declarations of a request. The descriptions of the functions themselves are kept.
+func pruneToolDescriptions(rawJSON []byte, pathPrefix string) []byte {
+	for i, tool := range gjson.GetBytes(rawJSON, pathPrefix+"tools").Array() {
+		for _, key := range functionDeclarationKeys {
+			for j, declaration := range tool.Get(key).Array() {
+				for _, schemaKey := range parameterSchemaKeys {
+					if schema := declaration.Get(schemaKey); schema.IsObject() {
+						path := fmt.Sprintf("%stools.%d.%s.%d.%s", pathPrefix, i, key, j, schemaKey)
+						rawJSON, _ = sjson.SetRawBytes(rawJSON, path, []byte(stripDescriptions(schema)))
+					}
+				}
+			}
+		}
+	}
+	return rawJSON
+}
+
+// stripDescriptions returns a schema without the descriptions of it and its nested schemas.
+func stripDescriptions(schema gjson.Result) string {
+	out, _ := sjson.Delete(schema.Raw, "description")
+	schema.Get("properties").ForEach(func(name, property gjson.Result) bool {
+		if property.IsObject() {
+			out, _ = sjson.SetRaw(out, "properties."+gjson.Escape(name.String()), stripDescriptions(property))
+		}
+		return true
+	})
+	if items := schema.Get("items"); items.IsObject() {
+		out, _ = sjson.SetRaw(out, "items", stripDescriptions(items))
+	}
+	for _, key := range []string{"anyOf", "oneOf", "allOf"} {
+		for i, alternative := range schema.Get(key).Array() {
+			out, _ = sjson.SetRaw(out, fmt.Sprintf("%s.%d", key, i), stripDescriptions(alternative))
+		}
+	}
+	return out
+}
+
+// toolLimitError builds the 400 error returned when a request exceeds the tool limits.
+func toolLimitError(reason string) *interfaces.ErrorMessage {
+	errJSON, _ := sjson.Set(`{"error":{"code":400,"status":"INVALID_ARGUMENT"}}`, "error.message", "Request exceeds tool-limits: "+reason)
+	return &interfaces.ErrorMessage{StatusCode: 400, Error: fmt.Errorf("%s", errJSON)}
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+	"github.com/tidwall/gjson"
+)
+
+// toolRequest is a Gemini request with three function declarations; "deep" has a parameter
+// schema nested three levels deep.
+const toolRequest = `{"contents":[],"tools":[{"functionDeclarations":[` +
+	`{"name":"a","parameters":{"type":"object","properties":{"x":{"type":"string","description":"the x value"}}}},` +
+	`{"name":"b","parameters":{"type":"object"}},` +
+	`{"name":"deep","parameters":{"type":"object","properties":{"p":{"type":"object","properties":{"q":{"type":"string"}}}}}}` +
+	`]}]}`
+
+func TestLimitToolDeclarations(t *testing.T) {
+	tests := []struct {
+		name      string
+		limits    config.ToolLimits
+		wantError string
+		wantNames []string
+	}{
+		{name: "no limits", wantNames: []string{"a", "b", "deep"}},
+		{name: "within limits", limits: config.ToolLimits{MaxDeclarations: 3, MaxSchemaDepth: 3}, wantNames: []string{"a", "b", "deep"}},
+		{name: "too many declarations", limits: config.ToolLimits{MaxDeclarations: 2}, wantError: "3 tool declarations, exceeding the limit of 2"},
+		{name: "too many declarations truncated", limits: config.ToolLimits{MaxDeclarations: 2, Truncate: true}, wantNames: []string{"a", "b"}},
+		{name: "too deep", limits: config.ToolLimits{MaxSchemaDepth: 2}, wantError: "parameter schema nesting depth of 3, exceeding the limit of 2"},
+		{name: "too deep truncated", limits: config.ToolLimits{MaxSchemaDepth: 2, Truncate: true}, wantNames: []string{"a", "b"}},
+		{name: "too large", limits: config.ToolLimits{MaxSchemaBytes: 100}, wantError: "exceeding the limit of 100 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &ClientBase{cfg: &config.Config{ToolLimits: tt.limits}}
+			got, err := c.limitToolDeclarations([]byte(toolRequest), "")
+			if tt.wantError != "" {
+				if err == nil || err.StatusCode != 400 || !strings.Contains(err.Error.Error(), tt.wantError) {
+					t.Fatalf("limitToolDeclarations() error = %v, want a 400 containing %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("limitToolDeclarations() error = %v", err.Error)
+			}
+			names := make([]string, 0)
+			for _, name := range gjson.GetBytes(got, "tools.0.functionDeclarations.#.name").Array() {
+				names = append(names, name.String())
+			}
+			if strings.Join(names, ",") != strings.Join(tt.wantNames, ",") {
+				t.Errorf("declarations = %v, want %v", names, tt.wantNames)
+			}
+		})
+	}
+}
+
+func TestLimitToolDeclarationsPrunesDescriptionsFirst(t *testing.T) {
+	_, size := declarationStats([]byte(toolRequest), "")
+	c := &ClientBase{cfg: &config.Config{ToolLimits: config.ToolLimits{MaxSchemaBytes: size - len(`,"description":"the x value"`), PruneDescriptions: true}}}
+
+	got, err := c.limitToolDeclarations([]byte(toolRequest), "")
+	if err != nil {
+		t.Fatalf("limitToolDeclarations() error = %v", err.Error)
+	}
+	if gjson.GetBytes(got, "tools.0.functionDeclarations.0.parameters.properties.x.description").Exists() {
+		t.Error("parameter description was not pruned")
+	}
+	if count := len(gjson.GetBytes(got, "tools.0.functionDeclarations").Array()); count != 3 {
+		t.Errorf("declarations = %d, want 3", count)
+	}
+}
+
+func TestSchemaDepth(t *testing.T) {
+	tests := []struct {
+		schema string
+		want   int
+	}{
+		{schema: `"string"`, want: 0},
+		{schema: `{"type":"string"}`, want: 1},
+		{schema: `{"type":"array","items":{"type":"string"}}`, want: 2},
+		{schema: `{"anyOf":[{"type":"string"},{"type":"object","properties":{"a":{"type":"string"}}}]}`, want: 3},
+	}
+	for _, tt := range tests {
+		if got := schemaDepth(gjson.Parse(tt.schema)); got != tt.want {
+			t.Errorf("schemaDepth(%s) = %d, want %d", tt.schema, got, tt.want)
+		}
+	}
+}
+
+func TestOversizedToolSchemaIsRejectedBeforeUpstream(t *testing.T) {
+	tests := []struct {
+		name      string
+		limits    config.ToolLimits
+		wantError string
+	}{
+		{name: "schema size", limits: config.ToolLimits{MaxSchemaBytes: 100}, wantError: "exceeding the limit of 100 bytes"},
+		{name: "schema size after pruning", limits: config.ToolLimits{MaxSchemaBytes: 100, PruneDescriptions: true}, wantError: "exceeding the limit of 100 bytes"},
+		{name: "schema depth", limits: config.ToolLimits{MaxSchemaDepth: 2}, wantError: "parameter schema nesting depth of 3, exceeding the limit of 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			c := NewGeminiClient(&http.Client{Transport: roundTripFunc(func(*http.Request) *http.Response {
+				calls++
+				return cannedResponse(http.StatusOK, nil, `{"candidates":[{"content":{"role":"model","parts":[{"text":"Hi"}]},"finishReason":"STOP"}]}`)
+			})}, &config.Config{ToolLimits: tt.limits}, "test-key-tool-limits")
+
+			_, err := c.SendRawMessage(testRequestContext(GEMINI, true), "gemini-2.5-flash", []byte(toolRequest), "")
+			if err == nil || err.StatusCode != http.StatusBadRequest || !strings.Contains(err.Error.Error(), tt.wantError) {
+				t.Fatalf("SendRawMessage() error = %v, want a 400 containing %q", err, tt.wantError)
+			}
+			if calls != 0 {
+				t.Errorf("upstream calls = %d, want the request rejected before the upstream call", calls)
+			}
+		})
+	}
+}
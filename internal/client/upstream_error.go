@@ -0,0 +1,38 @@
+package client
+
+import (
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	"github.com/tidwall/gjson"
+)
+
+// parseUpstreamError extracts the code, status, message, and details of a Google API
+// error body. It returns nil if the body is not a structured error.
+//
+// Parameters:
+//   - body: The raw upstream error body
+//
+// Returns:
+//   - *interfaces.UpstreamError: The parsed error, or nil
+func parseUpstreamError(body []byte) *interfaces.UpstreamError {
+	if !gjson.ValidBytes(body) {
+		return nil
+	}
+	errorResult := gjson.GetBytes(body, "error")
+	if !errorResult.IsObject() {
+		// Some endpoints wrap the error in a single element array.
+		errorResult = gjson.GetBytes(body, "0.error")
+		if !errorResult.IsObject() {
+			return nil
+		}
+	}
+
+	upstreamError := &interfaces.UpstreamError{
+		Code:    int(errorResult.Get("code").Int()),
+		Status:  errorResult.Get("status").String(),
+		Message: errorResult.Get("message").String(),
+	}
+	if details := errorResult.Get("details"); details.Exists() {
+		upstreamError.Details = details.Raw
+	}
+	return upstreamError
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+)
+
+func TestParseUpstreamError(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantNil     bool
+		wantCode    int
+		wantStatus  string
+		wantMessage string
+		wantDetails string
+	}{
+		{
+			name:        "object",
+			body:        `{"error":{"code":429,"message":"Quota exceeded","status":"RESOURCE_EXHAUSTED","details":[{"@type":"type.googleapis.com/google.rpc.RetryInfo","retryDelay":"30s"}]}}`,
+			wantCode:    429,
+			wantStatus:  "RESOURCE_EXHAUSTED",
+			wantMessage: "Quota exceeded",
+			wantDetails: `[{"@type":"type.googleapis.com/google.rpc.RetryInfo","retryDelay":"30s"}]`,
+		},
+		{
+			name:        "array",
+			body:        `[{"error":{"code":403,"message":"Permission denied","status":"PERMISSION_DENIED"}}]`,
+			wantCode:    403,
+			wantStatus:  "PERMISSION_DENIED",
+			wantMessage: "Permission denied",
+		},
+		{name: "plain text", body: `Bad Gateway`, wantNil: true},
+		{name: "other JSON", body: `{"message":"nope"}`, wantNil: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseUpstreamError([]byte(tt.body))
+			if tt.wantNil {
+				if got != nil {
+					t.Errorf("parseUpstreamError() = %+v, want nil", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("parseUpstreamError() = nil")
+			}
+			if got.Code != tt.wantCode || got.Status != tt.wantStatus || got.Message != tt.wantMessage || got.Details != tt.wantDetails {
+				t.Errorf("parseUpstreamError() = %+v, want code %d, status %s, message %q, details %s", got, tt.wantCode, tt.wantStatus, tt.wantMessage, tt.wantDetails)
+			}
+		})
+	}
+}
+
+func TestUpstreamErrorIsAttachedInDebugMode(t *testing.T) {
+	for _, debug := range []bool{false, true} {
+		c := NewGeminiClient(&http.Client{Transport: roundTripFunc(func(*http.Request) *http.Response {
+			return cannedResponse(http.StatusBadRequest, nil, `{"error":{"code":400,"message":"Invalid argument","status":"INVALID_ARGUMENT"}}`)
+		})}, &config.Config{Debug: debug}, "test-key-upstream-error")
+
+		_, err := c.CountTokens(testRequestContext(GEMINI, false), "gemini-2.5-flash", []byte(`{"contents":[]}`))
+		if err == nil {
+			t.Fatal("CountTokens() error = nil")
+		}
+		if got := err.Upstream != nil; got != debug {
+			t.Errorf("debug=%t: upstream error attached = %t", debug, got)
+		}
+		if debug && err.Upstream != nil && err.Upstream.Status != "INVALID_ARGUMENT" {
+			t.Errorf("upstream status = %q, want INVALID_ARGUMENT", err.Upstream.Status)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// LogRequestsHeaders logs the method, URL, and headers of upstream requests and responses.
+	LogRequestsHeaders = "headers"
+
+	// LogRequestsBodies logs the method, URL, and bodies of upstream requests and responses.
+	LogRequestsBodies = "bodies"
+
+	// LogRequestsFull logs the headers and the bodies of upstream requests and responses.
+	LogRequestsFull = "full"
+
+	// upstreamLogFile is the name of the upstream log file under <auth-dir>/logs.
+	upstreamLogFile = "upstream.log"
+
+	// upstreamLogMaxBytes is the size at which the upstream log file is rotated.
+	upstreamLogMaxBytes = 10 << 20
+
+	// upstreamLogBackups is the number of rotated upstream log files kept.
+	upstreamLogBackups = 3
+)
+
+// upstreamLogRedactedHeaders lists the headers and query parameters that carry credentials
+// and are never written to the upstream log.
+var upstreamLogRedactedHeaders = []string{"Authorization", "X-Goog-Api-Key", "X-Api-Key", "Cookie"}
+
+// upstreamLogger appends upstream exchanges to a size-rotated file.
+type upstreamLogger struct {
+	mutex sync.Mutex
+	file  *os.File
+	path  string
+	size  int64
+}
+
+// upstreamLog is the upstream log shared by all clients.
+var upstreamLog = &upstreamLogger{}
+
+// write appends an entry to the log file in dir, rotating the file when it grows beyond
+// upstreamLogMaxBytes.
+func (l *upstreamLogger) write(dir string, entry []byte) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	path := filepath.Join(dir, upstreamLogFile)
+	if l.file != nil && (l.path != path || l.size+int64(len(entry)) > upstreamLogMaxBytes) {
+		_ = l.file.Close()
+		l.file = nil
+		if l.path == path {
+			rotateUpstreamLog(path)
+		}
+	}
+	if l.file == nil {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			_ = file.Close()
+			return err
+		}
+		l.file, l.path, l.size = file, path, info.Size()
+	}
+
+	n, err := l.file.Write(entry)
+	l.size += int64(n)
+	return err
+}
+
+// rotateUpstreamLog shifts upstream.log to upstream.log.1, upstream.log.1 to upstream.log.2,
+// and so on, dropping the oldest file.
+func rotateUpstreamLog(path string) {
+	for i := upstreamLogBackups - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1))
+	}
+	_ = os.Rename(path, path+".1")
+}
+
+// upstreamLogDir returns the directory of the upstream log, <auth-dir>/logs.
+func upstreamLogDir(authDir string) string {
+	if strings.HasPrefix(authDir, "~") {
+		if home, err := os.UserHomeDir(); err == nil {
+			authDir = filepath.Join(home, authDir[1:])
+		}
+	}
+	return filepath.Join(authDir, "logs")
+}
+
+// upstreamLogEntry collects an upstream exchange until the response body is closed.
+type upstreamLogEntry struct {
+	io.ReadCloser
+	mode      string
+	dir       string
+	requestID string
+	request   []byte
+	response  bytes.Buffer
+	once      sync.Once
+}
+
+// Read reads from the response body and collects the data if bodies are logged.
+func (e *upstreamLogEntry) Read(p []byte) (int, error) {
+	n, err := e.ReadCloser.Read(p)
+	if n > 0 && e.mode != LogRequestsHeaders {
+		e.response.Write(p[:n])
+	}
+	return n, err
+}
+
+// Close closes the response body and writes the exchange to the upstream log.
+func (e *upstreamLogEntry) Close() error {
+	err := e.ReadCloser.Close()
+	e.once.Do(func() {
+		if e.mode != LogRequestsHeaders {
+			e.request = append(e.request, e.response.Bytes()...)
+			e.request = append(e.request, '\n')
+		}
+		if errWrite := upstreamLog.write(e.dir, e.request); errWrite != nil {
+			log.Warnf("Failed to write upstream log (request %s): %v", e.requestID, errWrite)
+		}
+	})
+	return err
+}
+
+// newUpstreamLogEntry formats the request and response head of an upstream exchange and
+// wraps the response body so that the exchange is logged once the body is closed.
+//
+// Parameters:
+//   - mode: The log-requests mode (headers, bodies, or full)
+//   - dir: The directory of the upstream log
+//   - requestID: The ID of the inbound request
+//   - req: The upstream request
+//   - body: The upstream request body
+//   - resp: The upstream response
+//
+// Returns:
+//   - *http.Response: The response, with a logging body
+func newUpstreamLogEntry(mode, dir, requestID string, req *http.Request, body []byte, resp *http.Response) *http.Response {
+	var entry bytes.Buffer
+	fmt.Fprintf(&entry, "=== %s request %s\n", time.Now().UTC().Format(time.RFC3339), requestID)
+	fmt.Fprintf(&entry, "%s %s\n", req.Method, redactURL(req.URL))
+	if mode != LogRequestsBodies {
+		writeRedactedHeaders(&entry, req.Header)
+	}
+	if mode != LogRequestsHeaders {
+		fmt.Fprintf(&entry, "\n%s\n", body)
+	}
+	fmt.Fprintf(&entry, "--- response %d\n", resp.StatusCode)
+	if mode != LogRequestsBodies {
+		writeRedactedHeaders(&entry, resp.Header)
+	}
+	if mode != LogRequestsHeaders {
+		entry.WriteString("\n")
+	}
+
+	resp.Body = &upstreamLogEntry{
+		ReadCloser: resp.Body,
+		mode:       mode,
+		dir:        dir,
+		requestID:  requestID,
+		request:    entry.Bytes(),
+	}
+	return resp
+}
+
+// writeRedactedHeaders writes headers in sorted order, with credentials redacted.
+func writeRedactedHeaders(w io.Writer, header http.Header) {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := strings.Join(header.Values(name), ", ")
+		for _, redacted := range upstreamLogRedactedHeaders {
+			if strings.EqualFold(name, redacted) {
+				value = "[REDACTED]"
+			}
+		}
+		_, _ = fmt.Fprintf(w, "%s: %s\n", name, value)
+	}
+}
+
+// redactURL returns a URL with the "key" query parameter, which carries Generative Language
+// API keys, redacted.
+func redactURL(u *url.URL) string {
+	query := u.Query()
+	if !query.Has("key") {
+		return u.String()
+	}
+	query.Set("key", "[REDACTED]")
+	redacted := *u
+	redacted.RawQuery = query.Encode()
+	return redacted.String()
+}
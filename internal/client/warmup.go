@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/auth/qwen"
+)
+
+// warmConnection sends a HEAD request to an upstream so that the client's transport keeps a
+// connection to it open. The response status is irrelevant; only the connection matters.
+//
+// Parameters:
+//   - ctx: The context for the request
+//   - url: The upstream endpoint
+//
+// Returns:
+//   - error: An error if the upstream could not be reached
+func (c *ClientBase) warmConnection(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create warmup request: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// WarmConnection keeps the connection to the Code Assist API open.
+func (c *GeminiCLIClient) WarmConnection(ctx context.Context) error {
+	return c.warmConnection(ctx, codeAssistEndpoint)
+}
+
+// WarmConnection keeps the connection to the Generative Language API open.
+func (c *GeminiClient) WarmConnection(ctx context.Context) error {
+	return c.warmConnection(ctx, glEndPoint)
+}
+
+// WarmConnection keeps the connection to the Claude API, or the key's base URL, open.
+func (c *ClaudeClient) WarmConnection(ctx context.Context) error {
+	url := claudeEndpoint
+	if c.apiKeyIndex != -1 && c.apiKeyIndex < len(c.cfg.ClaudeKey) && c.cfg.ClaudeKey[c.apiKeyIndex].BaseURL != "" {
+		url = c.cfg.ClaudeKey[c.apiKeyIndex].BaseURL
+	}
+	return c.warmConnection(ctx, url)
+}
+
+// WarmConnection keeps the connection to the Codex API, or the key's base URL, open.
+func (c *CodexClient) WarmConnection(ctx context.Context) error {
+	url := chatGPTEndpoint
+	if c.apiKeyIndex != -1 && c.apiKeyIndex < len(c.cfg.CodexKey) && c.cfg.CodexKey[c.apiKeyIndex].BaseURL != "" {
+		url = c.cfg.CodexKey[c.apiKeyIndex].BaseURL
+	}
+	return c.warmConnection(ctx, url)
+}
+
+// WarmConnection keeps the connection to the account's Qwen endpoint open.
+func (c *QwenClient) WarmConnection(ctx context.Context) error {
+	url := qwenEndpoint
+	if resourceURL := c.tokenStorage.(*qwen.QwenTokenStorage).ResourceURL; resourceURL != "" {
+		url = fmt.Sprintf("https://%s/v1", resourceURL)
+	}
+	return c.warmConnection(ctx, url)
+}
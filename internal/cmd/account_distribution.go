@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	"github.com/luispater/CLIProxyAPI/v5/internal/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// accountDistributionTick is how often the distribution logger checks whether a summary is due.
+const accountDistributionTick = 10 * time.Second
+
+// accountCounts holds the requests and errors of one account.
+type accountCounts struct {
+	requests float64
+	errors   float64
+}
+
+// runAccountDistributionLog periodically logs how many requests each account served since the
+// previous summary and how many of them failed, until ctx is cancelled. Summaries are written
+// every distribution-log-interval seconds; 0 disables them.
+//
+// Parameters:
+//   - ctx: The context controlling the logger's lifetime
+//   - cfg: Returns the current configuration
+func runAccountDistributionLog(ctx context.Context, cfg func() *config.Config) {
+	ticker := time.NewTicker(accountDistributionTick)
+	defer ticker.Stop()
+
+	previous := collectAccountCounts()
+	lastSummary := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Debugf("account distribution log stopped...")
+			return
+		case <-ticker.C:
+		}
+
+		interval := time.Duration(cfg().DistributionLogInterval) * time.Second
+		if interval <= 0 || time.Since(lastSummary) < interval {
+			continue
+		}
+		current := collectAccountCounts()
+		logAccountDistribution(current, previous, time.Since(lastSummary))
+		previous, lastSummary = current, time.Now()
+	}
+}
+
+// collectAccountCounts returns the cumulative requests and errors of every account, keyed by
+// provider and account.
+func collectAccountCounts() map[string]accountCounts {
+	counts := make(map[string]accountCounts)
+	for _, sample := range metrics.AccountRequests.Samples() {
+		key := sample.Labels["provider"] + " " + sample.Labels["account"]
+		entry := counts[key]
+		entry.requests += sample.Value
+		counts[key] = entry
+	}
+	for _, sample := range metrics.AccountErrors.Samples() {
+		key := sample.Labels["provider"] + " " + sample.Labels["account"]
+		entry := counts[key]
+		entry.errors += sample.Value
+		counts[key] = entry
+	}
+	return counts
+}
+
+// logAccountDistribution logs the requests and errors of each account within a window.
+func logAccountDistribution(current, previous map[string]accountCounts, window time.Duration) {
+	keys := make([]string, 0, len(current))
+	total := 0.0
+	for key, counts := range current {
+		requests := counts.requests - previous[key].requests
+		if requests > 0 {
+			keys = append(keys, key)
+			total += requests
+		}
+	}
+	if total == 0 {
+		log.Infof("account distribution over the last %s: no requests", window.Round(time.Second))
+		return
+	}
+	sort.Strings(keys)
+
+	log.Infof("account distribution over the last %s: %.0f requests", window.Round(time.Second), total)
+	for _, key := range keys {
+		requests := current[key].requests - previous[key].requests
+		errors := current[key].errors - previous[key].errors
+		log.Infof("  %s: %.0f requests (%.1f%%), %.0f succeeded, %.0f failed", key, requests, requests/total*100, requests-errors, errors)
+	}
+}
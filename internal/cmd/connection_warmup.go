@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	log "github.com/sirupsen/logrus"
+)
+
+// connectionWarmupTick is how often the warmer checks whether a warmup round is due.
+var connectionWarmupTick = 5 * time.Second
+
+// connectionWarmupTimeout bounds a single warmup request.
+const connectionWarmupTimeout = 10 * time.Second
+
+// connectionWarmer is implemented by clients that can keep their upstream connection open.
+type connectionWarmer interface {
+	WarmConnection(ctx context.Context) error
+}
+
+// runConnectionWarmup periodically sends a minimal request through every client, so that idle
+// keep-alive connections to the upstreams are not closed and sporadic requests do not pay for
+// a new TLS handshake, until ctx is cancelled. Rounds run every connection-warmup-interval
+// seconds; 0 disables them.
+//
+// Parameters:
+//   - ctx: The context controlling the warmer's lifetime
+//   - cfg: Returns the current configuration
+//   - clients: Returns the currently active clients
+func runConnectionWarmup(ctx context.Context, cfg func() *config.Config, clients func() []interfaces.Client) {
+	ticker := time.NewTicker(connectionWarmupTick)
+	defer ticker.Stop()
+
+	var lastWarmup time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			log.Debugf("connection warmup stopped...")
+			return
+		case <-ticker.C:
+		}
+
+		interval := time.Duration(cfg().ConnectionWarmupInterval) * time.Second
+		if interval <= 0 || time.Since(lastWarmup) < interval {
+			continue
+		}
+		lastWarmup = time.Now()
+		for _, c := range clients() {
+			warmer, ok := c.(connectionWarmer)
+			if !ok || !c.IsAvailable() {
+				continue
+			}
+			ctxWarmup, cancel := context.WithTimeout(ctx, connectionWarmupTimeout)
+			if err := warmer.WarmConnection(ctxWarmup); err != nil && ctx.Err() == nil {
+				log.Debugf("connection warmup for %s account failed: %v", c.Type(), err)
+			}
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/client"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+)
+
+func TestRunConnectionWarmup(t *testing.T) {
+	tick := connectionWarmupTick
+	connectionWarmupTick = 10 * time.Millisecond
+	t.Cleanup(func() { connectionWarmupTick = tick })
+
+	tests := []struct {
+		name        string
+		interval    int
+		unavailable bool
+		run         time.Duration
+		want        int32
+	}{
+		{name: "disabled", interval: 0, run: 200 * time.Millisecond, want: 0},
+		// The first round runs on the first tick, the next one a second later.
+		{name: "every interval", interval: 1, run: 1500 * time.Millisecond, want: 2},
+		{name: "unavailable account skipped", interval: 1, unavailable: true, run: 200 * time.Millisecond, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var warmups atomic.Int32
+			upstream := roundTripFunc(func(req *http.Request) *http.Response {
+				if req.Method == http.MethodHead {
+					warmups.Add(1)
+				}
+				return &http.Response{StatusCode: http.StatusNotFound, Header: http.Header{}, Body: http.NoBody}
+			})
+			geminiClient := client.NewGeminiClient(&http.Client{Transport: upstream}, &config.Config{}, "test-key-warmup")
+			if tt.unavailable {
+				geminiClient.SetUnavailable()
+			}
+
+			cfg := &config.Config{ConnectionWarmupInterval: tt.interval}
+			ctx, cancel := context.WithTimeout(context.Background(), tt.run)
+			defer cancel()
+			runConnectionWarmup(ctx, func() *config.Config { return cfg }, func() []interfaces.Client { return []interfaces.Client{geminiClient} })
+
+			if got := warmups.Load(); got != tt.want {
+				t.Errorf("warmup requests = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/client"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	"github.com/luispater/CLIProxyAPI/v5/internal/util"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// healthCheckTick is how often the health checker looks for accounts that are due.
+	healthCheckTick = 10 * time.Second
+
+	// healthCheckSpacing separates consecutive checks within a single tick so that many
+	// accounts are not checked at once.
+	healthCheckSpacing = 2 * time.Second
+)
+
+// runGeminiHealthChecks periodically checks Gemini CLI accounts in the background and caches
+// the result on each client, until ctx is cancelled. Healthy accounts are checked every
+// healthy-interval; failing accounts are re-checked after failing-interval, doubling with each
+// consecutive failure up to max-backoff.
+//
+// Parameters:
+//   - ctx: The context controlling the checker's lifetime
+//   - cfg: Returns the current configuration
+//   - clients: Returns the currently active clients
+func runGeminiHealthChecks(ctx context.Context, cfg func() *config.Config, clients func() []interfaces.Client) {
+	ticker := time.NewTicker(healthCheckTick)
+	defer ticker.Stop()
+
+	for {
+		settings := cfg().HealthCheck
+		if settings.Enabled {
+			for _, c := range clients() {
+				cliClient, ok := c.(*client.GeminiCLIClient)
+				if !ok || !healthCheckDue(cliClient.Health(), settings) {
+					continue
+				}
+				previous := cliClient.Health()
+				status := cliClient.CheckHealth()
+				switch {
+				case status.Healthy && previous.Checked && !previous.Healthy:
+					log.Infof("gemini account %s is healthy again", util.AccountLabel(cfg(), cliClient.GetEmail()))
+				case !status.Healthy:
+					log.Warnf("gemini account %s failed its health check (%d in a row): %s", util.AccountLabel(cfg(), cliClient.GetEmail()), status.ConsecutiveFailures, status.LastError)
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(healthCheckSpacing):
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Debugf("gemini health checks stopped...")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// healthCheckDue reports whether an account should be checked again.
+func healthCheckDue(status client.HealthStatus, settings config.HealthCheck) bool {
+	if !status.Checked {
+		return true
+	}
+	return time.Since(status.CheckedAt) >= healthCheckInterval(status, settings)
+}
+
+// healthCheckInterval returns the time to wait after the last check of an account.
+func healthCheckInterval(status client.HealthStatus, settings config.HealthCheck) time.Duration {
+	if status.Healthy {
+		return time.Duration(settings.HealthyInterval) * time.Second
+	}
+
+	interval := time.Duration(settings.FailingInterval) * time.Second
+	maxBackoff := time.Duration(settings.MaxBackoff) * time.Second
+	for i := 1; i < status.ConsecutiveFailures && interval < maxBackoff; i++ {
+		interval *= 2
+	}
+	if maxBackoff > 0 && interval > maxBackoff {
+		interval = maxBackoff
+	}
+	return interval
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	geminiAuth "github.com/luispater/CLIProxyAPI/v5/internal/auth/gemini"
+	"github.com/luispater/CLIProxyAPI/v5/internal/client"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	"golang.org/x/oauth2"
+)
+
+// roundTripFunc serves the upstream requests of a test client.
+type roundTripFunc func(*http.Request) *http.Response
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req), nil
+}
+
+func TestHealthCheckInterval(t *testing.T) {
+	settings := config.HealthCheck{HealthyInterval: 900, FailingInterval: 60, MaxBackoff: 300}
+	tests := []struct {
+		name   string
+		status client.HealthStatus
+		want   time.Duration
+	}{
+		{name: "healthy", status: client.HealthStatus{Checked: true, Healthy: true}, want: 900 * time.Second},
+		{name: "first failure", status: client.HealthStatus{Checked: true, ConsecutiveFailures: 1}, want: 60 * time.Second},
+		{name: "second failure doubles", status: client.HealthStatus{Checked: true, ConsecutiveFailures: 2}, want: 120 * time.Second},
+		{name: "third failure doubles again", status: client.HealthStatus{Checked: true, ConsecutiveFailures: 3}, want: 240 * time.Second},
+		{name: "capped at max backoff", status: client.HealthStatus{Checked: true, ConsecutiveFailures: 10}, want: 300 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := healthCheckInterval(tt.status, settings); got != tt.want {
+				t.Errorf("healthCheckInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHealthCheckDue(t *testing.T) {
+	settings := config.HealthCheck{HealthyInterval: 900, FailingInterval: 60, MaxBackoff: 1800}
+	tests := []struct {
+		name   string
+		status client.HealthStatus
+		want   bool
+	}{
+		{name: "never checked", status: client.HealthStatus{}, want: true},
+		{name: "healthy recently", status: client.HealthStatus{Checked: true, Healthy: true, CheckedAt: time.Now().Add(-time.Minute)}, want: false},
+		{name: "healthy long ago", status: client.HealthStatus{Checked: true, Healthy: true, CheckedAt: time.Now().Add(-20 * time.Minute)}, want: true},
+		{name: "failing past interval", status: client.HealthStatus{Checked: true, ConsecutiveFailures: 1, CheckedAt: time.Now().Add(-2 * time.Minute)}, want: true},
+		{name: "failing within backoff", status: client.HealthStatus{Checked: true, ConsecutiveFailures: 3, CheckedAt: time.Now().Add(-2 * time.Minute)}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := healthCheckDue(tt.status, settings); got != tt.want {
+				t.Errorf("healthCheckDue() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunGeminiHealthChecksUpdatesCachedStatus(t *testing.T) {
+	tick, spacing := healthCheckTick, healthCheckSpacing
+	healthCheckTick, healthCheckSpacing = 10*time.Millisecond, time.Millisecond
+	t.Cleanup(func() { healthCheckTick, healthCheckSpacing = tick, spacing })
+
+	var upstreamStatus atomic.Int32
+	upstreamStatus.Store(http.StatusInternalServerError)
+	upstream := roundTripFunc(func(*http.Request) *http.Response {
+		status := int(upstreamStatus.Load())
+		return &http.Response{StatusCode: status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(`data: {"response":{}}`))}
+	})
+	token := &oauth2.Token{AccessToken: "token", Expiry: time.Now().Add(time.Hour)}
+	httpClient := &http.Client{Transport: &oauth2.Transport{Source: oauth2.StaticTokenSource(token), Base: upstream}}
+	ts := &geminiAuth.GeminiTokenStorage{Email: "user@example.com", ProjectID: "project", Token: map[string]any{"access_token": "token"}}
+	cliClient := client.NewGeminiCLIClient(httpClient, ts, &config.Config{AuthDir: t.TempDir()})
+
+	// Intervals of zero make every account due on each tick.
+	cfg := &config.Config{HealthCheck: config.HealthCheck{Enabled: true}}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runGeminiHealthChecks(ctx, func() *config.Config { return cfg }, func() []interfaces.Client { return []interfaces.Client{cliClient} })
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	waitFor := func(condition func(client.HealthStatus) bool, description string) client.HealthStatus {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if status := cliClient.Health(); condition(status) {
+				return status
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("health status = %+v, want %s", cliClient.Health(), description)
+		return client.HealthStatus{}
+	}
+
+	status := waitFor(func(s client.HealthStatus) bool { return s.ConsecutiveFailures >= 2 }, "repeated failures")
+	if status.Healthy || status.LastError == "" {
+		t.Errorf("health status = %+v, want an unhealthy status with an error", status)
+	}
+	if cliClient.IsAvailable() {
+		t.Error("IsAvailable() = true, want false while the account fails its checks")
+	}
+
+	upstreamStatus.Store(http.StatusOK)
+	status = waitFor(func(s client.HealthStatus) bool { return s.Healthy }, "a healthy status")
+	if status.ConsecutiveFailures != 0 || status.LastError != "" {
+		t.Errorf("health status = %+v, want the failures cleared", status)
+	}
+	if !cliClient.IsAvailable() {
+		t.Error("IsAvailable() = false, want true after a successful check")
+	}
+}
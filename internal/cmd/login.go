@@ -5,7 +5,7 @@ package cmd
 
 import (
 	"context"
-	"os"
+	"errors"
 
 	"github.com/luispater/CLIProxyAPI/v5/internal/auth/gemini"
 	"github.com/luispater/CLIProxyAPI/v5/internal/client"
@@ -46,31 +46,20 @@ func DoLogin(cfg *config.Config, projectID string, options *LoginOptions) {
 	// Initialize the API client.
 	cliClient := client.NewGeminiCLIClient(httpClient, &ts, cfg)
 
-	// Perform the user setup process.
-	err = cliClient.SetupUser(clientCtx, ts.Email, projectID)
+	// Perform the user setup process. If onboarding cannot determine the project, the
+	// account's only project is used, or the user is told which project to pass.
+	selectedProjectID, err := cliClient.SetupUserWithProjectDiscovery(clientCtx, ts.Email, projectID)
 	if err != nil {
-		// Handle the specific case where a project ID is required but not provided.
-		if err.Error() == "failed to start user onboarding, need define a project id" {
-			log.Error("Failed to start user onboarding: A project ID is required.")
-			// Fetch and display the user's available projects to help them choose one.
-			project, errGetProjectList := cliClient.GetProjectList(clientCtx)
-			if errGetProjectList != nil {
-				log.Fatalf("Failed to get project list: %v", err)
-			} else {
-				log.Infof("Your account %s needs to specify a project ID.", ts.Email)
-				log.Info("========================================================================")
-				for _, p := range project.Projects {
-					log.Infof("Project ID: %s", p.ProjectID)
-					log.Infof("Project Name: %s", p.Name)
-					log.Info("------------------------------------------------------------------------")
-				}
-				log.Infof("Please run this command to login again with a specific project:\n\n%s --login --project_id <project_id>\n", os.Args[0])
-			}
+		if errors.Is(err, client.ErrProjectIDRequired) {
+			log.Errorf("Failed to complete user setup: %v", err)
 		} else {
 			log.Fatalf("Failed to complete user setup: %v", err)
 		}
 		return // Exit after handling the error.
 	}
+	if selectedProjectID != "" {
+		projectID = selectedProjectID
+	}
 
 	// If setup is successful, proceed to check API status and save the token.
 	auto := projectID == ""
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/api"
+	"github.com/luispater/CLIProxyAPI/v5/internal/auth/gemini"
+	"github.com/luispater/CLIProxyAPI/v5/internal/capture"
+	"github.com/luispater/CLIProxyAPI/v5/internal/client"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	. "github.com/luispater/CLIProxyAPI/v5/internal/constant"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"golang.org/x/oauth2"
+)
+
+// DoReplay feeds a captured inbound request through an in-process proxy whose upstream is
+// a mock seeded with the captured upstream responses, and prints the resulting response.
+// No network requests are made and no accounts are loaded.
+//
+// Parameters:
+//   - cfg: The application configuration
+//   - capturePath: The path of a file written by request-capture
+func DoReplay(cfg *config.Config, capturePath string) {
+	record, err := capture.Load(capturePath)
+	if err != nil {
+		log.Fatalf("failed to load capture: %v", err)
+		return
+	}
+
+	replayCfg := *cfg
+	replayCfg.APIKeys = nil
+	replayCfg.RequestCapture.Enabled = false
+	replayCfg.RequestDedup.Enabled = false
+	replayCfg.RequestLog = false
+	replayCfg.RemoteManagement.SecretKey = ""
+
+	transport := capture.NewReplayTransport(record.Upstream)
+	cliClient := newReplayClient(&replayCfg, record, transport)
+	defer cliClient.UnregisterClient()
+
+	server := api.NewServer(&replayCfg, []interfaces.Client{cliClient}, "")
+	req := httptest.NewRequest(record.Inbound.Method, record.Inbound.Path, bytes.NewReader([]byte(record.Inbound.Body)))
+	req.Header = record.Inbound.Header.Clone()
+	req.RemoteAddr = "127.0.0.1:0"
+	recorder := httptest.NewRecorder()
+	server.Handler().ServeHTTP(recorder, req)
+
+	log.Infof("replayed %s %s captured at %s: status %d, %d of %d upstream responses unused",
+		record.Inbound.Method, record.Inbound.Path, record.CapturedAt.Format("2006-01-02 15:04:05"),
+		recorder.Code, transport.Remaining(), len(record.Upstream))
+	fmt.Println(recorder.Body.String())
+}
+
+// replayClient is a client whose upstream is a replay transport.
+type replayClient interface {
+	interfaces.Client
+	UnregisterClient()
+}
+
+// newReplayClient creates a client of the type that sent the captured upstream requests.
+func newReplayClient(cfg *config.Config, record *capture.Record, transport http.RoundTripper) replayClient {
+	if len(record.Upstream) > 0 && record.Upstream[0].Client == GEMINICLI {
+		ts := &gemini.GeminiTokenStorage{
+			// The stored token matches the static one, so the client never persists it.
+			Token:     map[string]any{"access_token": "replay"},
+			ProjectID: gjson.Get(record.Upstream[0].RequestBody, "project").String(),
+			Email:     "replay",
+			Checked:   true,
+			Type:      "gemini",
+		}
+		httpClient := &http.Client{Transport: &oauth2.Transport{
+			Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "replay"}),
+			Base:   transport,
+		}}
+		return client.NewGeminiCLIClient(httpClient, ts, cfg)
+	}
+	return client.NewGeminiClient(&http.Client{Transport: transport}, cfg, "replay")
+}
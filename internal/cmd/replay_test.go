@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/api"
+	"github.com/luispater/CLIProxyAPI/v5/internal/capture"
+	"github.com/luispater/CLIProxyAPI/v5/internal/client"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+)
+
+func TestRecordThenReplayRequest(t *testing.T) {
+	const (
+		path     = "/v1beta/models/gemini-2.5-flash:generateContent"
+		request  = `{"contents":[{"role":"user","parts":[{"text":"What is the capital of France?"}]}]}`
+		response = `{"candidates":[{"content":{"role":"model","parts":[{"text":"Paris."}]},"finishReason":"STOP"}]}`
+	)
+	captureDir := t.TempDir()
+	cfg := &config.Config{Debug: true, RequestCapture: config.RequestCapture{Enabled: true, Dir: captureDir}}
+
+	// Record the request against an upstream that answers once.
+	upstreamCalls := 0
+	upstream := &http.Client{Transport: roundTripFunc(func(*http.Request) *http.Response {
+		upstreamCalls++
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(response))}
+	})}
+	recordingClient := client.NewGeminiClient(upstream, cfg, "key")
+	recorded := httptest.NewRecorder()
+	api.NewServer(cfg, []interfaces.Client{recordingClient}, "").Handler().ServeHTTP(recorded, httptest.NewRequest(http.MethodPost, path, strings.NewReader(request)))
+	recordingClient.UnregisterClient()
+	if recorded.Code != http.StatusOK || upstreamCalls != 1 {
+		t.Fatalf("recording: status = %d, upstream calls = %d, want 200 and 1", recorded.Code, upstreamCalls)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(captureDir, "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("capture files = %v, want one", files)
+	}
+	record, err := capture.Load(files[0])
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if record.Inbound.Path != path || record.Inbound.Body != request {
+		t.Errorf("captured inbound = %+v, want the sent request", record.Inbound)
+	}
+	if len(record.Upstream) != 1 || record.Upstream[0].ResponseBody != response {
+		t.Fatalf("captured upstream = %+v, want the upstream response", record.Upstream)
+	}
+
+	// Replay the captured request against the recorded upstream responses only.
+	replayCfg := &config.Config{}
+	transport := capture.NewReplayTransport(record.Upstream)
+	replayClient := newReplayClient(replayCfg, record, transport)
+	defer replayClient.UnregisterClient()
+	replayed := httptest.NewRecorder()
+	req := httptest.NewRequest(record.Inbound.Method, record.Inbound.Path, strings.NewReader(record.Inbound.Body))
+	req.Header = record.Inbound.Header.Clone()
+	api.NewServer(replayCfg, []interfaces.Client{replayClient}, "").Handler().ServeHTTP(replayed, req)
+
+	if replayed.Code != recorded.Code || replayed.Body.String() != recorded.Body.String() {
+		t.Errorf("replay = %d %s, want %d %s", replayed.Code, replayed.Body.String(), recorded.Code, recorded.Body.String())
+	}
+	if transport.Remaining() != 0 {
+		t.Errorf("unused recorded responses = %d, want 0", transport.Remaining())
+	}
+	if upstreamCalls != 1 {
+		t.Errorf("upstream calls = %d, want no calls during the replay", upstreamCalls)
+	}
+	if entries, _ := os.ReadDir(captureDir); len(entries) != 1 {
+		t.Errorf("capture files = %d, want the replay not captured", len(entries))
+	}
+}
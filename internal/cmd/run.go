@@ -18,6 +18,7 @@ import (
 	"time"
 
 	"github.com/luispater/CLIProxyAPI/v5/internal/api"
+	"github.com/luispater/CLIProxyAPI/v5/internal/auth"
 	"github.com/luispater/CLIProxyAPI/v5/internal/auth/claude"
 	"github.com/luispater/CLIProxyAPI/v5/internal/auth/codex"
 	"github.com/luispater/CLIProxyAPI/v5/internal/auth/gemini"
@@ -26,6 +27,7 @@ import (
 	"github.com/luispater/CLIProxyAPI/v5/internal/config"
 	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
 	"github.com/luispater/CLIProxyAPI/v5/internal/misc"
+	"github.com/luispater/CLIProxyAPI/v5/internal/quota"
 	"github.com/luispater/CLIProxyAPI/v5/internal/util"
 	"github.com/luispater/CLIProxyAPI/v5/internal/watcher"
 	log "github.com/sirupsen/logrus"
@@ -41,8 +43,9 @@ import (
 // 3. Initializes clients with API keys if provided in configuration
 // 4. Starts the API server with the client pool
 // 5. Sets up file watching for configuration and authentication directory changes
-// 6. Implements background token refresh for Codex, Claude, and Qwen clients
-// 7. Handles graceful shutdown on SIGINT or SIGTERM signals
+// 6. Implements background token refresh for Codex, Claude, Qwen, and Gemini CLI clients
+// 7. Reloads the configuration on SIGHUP
+// 8. Handles graceful shutdown on SIGINT or SIGTERM signals
 //
 // Parameters:
 //   - cfg: The application configuration containing settings like port, auth directory, API keys
@@ -51,6 +54,11 @@ func StartService(cfg *config.Config, configPath string) {
 	// Track the current active clients for graceful shutdown persistence.
 	var activeClients map[string]interfaces.Client
 	var activeClientsMu sync.RWMutex
+	// Track the current configuration for background tasks that honor hot reloads.
+	activeConfig := cfg
+	// Persist daily request counters next to the auth files so restarts keep the current window.
+	quota.GetDailyRequestCounter().SetPersistencePath(filepath.Join(cfg.AuthDir, "daily-request-counts.state"))
+
 	// Create a pool of API clients, one for each token file found.
 	cliClients := make(map[string]interfaces.Client)
 	successfulAuthCount := 0
@@ -81,6 +89,7 @@ func StartService(cfg *config.Config, configPath string) {
 			if errReadFile != nil {
 				return errReadFile
 			}
+			data = auth.MigrateTokenFile(path, data, cfg.MigrateAuthFiles)
 
 			// Determine token type from JSON data, defaulting to "gemini" if not specified.
 			tokenType := ""
@@ -203,7 +212,9 @@ func StartService(cfg *config.Config, configPath string) {
 
 	// Create and start the API server with the pool of clients in a separate goroutine.
 	apiServer := api.NewServer(cfg, allClients, configPath)
-	log.Infof("Starting API server on port %d", cfg.Port)
+	if cfg.ListenSocket == "" || cfg.Port != 0 {
+		log.Infof("Starting API server on port %d", cfg.Port)
+	}
 
 	// Start the API server in a goroutine so it doesn't block the main thread.
 	go func() {
@@ -223,6 +234,7 @@ func StartService(cfg *config.Config, configPath string) {
 		// Keep an up-to-date snapshot for graceful shutdown persistence.
 		activeClientsMu.Lock()
 		activeClients = newClients
+		activeConfig = newCfg
 		activeClientsMu.Unlock()
 	})
 	if errNewWatcher != nil {
@@ -254,6 +266,10 @@ func StartService(cfg *config.Config, configPath string) {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
+	// Reload the configuration on SIGHUP, e.g. to rotate API keys without a restart.
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+
 	// Background token refresh ticker for Codex, Claude, and Qwen clients to handle token expiration.
 	ctxRefresh, cancelRefresh := context.WithCancel(context.Background())
 	var wgRefresh sync.WaitGroup
@@ -317,9 +333,64 @@ func StartService(cfg *config.Config, configPath string) {
 		}
 	}()
 
+	// Background scheduler that refreshes Gemini CLI tokens before they expire.
+	wgRefresh.Add(1)
+	go func() {
+		defer wgRefresh.Done()
+		runGeminiTokenRefresh(ctxRefresh, func() []interfaces.Client {
+			activeClientsMu.RLock()
+			defer activeClientsMu.RUnlock()
+			return clientsToSlice(activeClients)
+		})
+	}()
+
+	// Background health checks of Gemini CLI accounts.
+	wgRefresh.Add(1)
+	go func() {
+		defer wgRefresh.Done()
+		runGeminiHealthChecks(ctxRefresh, func() *config.Config {
+			activeClientsMu.RLock()
+			defer activeClientsMu.RUnlock()
+			return activeConfig
+		}, func() []interfaces.Client {
+			activeClientsMu.RLock()
+			defer activeClientsMu.RUnlock()
+			return clientsToSlice(activeClients)
+		})
+	}()
+
+	// Keep idle upstream connections open.
+	wgRefresh.Add(1)
+	go func() {
+		defer wgRefresh.Done()
+		runConnectionWarmup(ctxRefresh, func() *config.Config {
+			activeClientsMu.RLock()
+			defer activeClientsMu.RUnlock()
+			return activeConfig
+		}, func() []interfaces.Client {
+			activeClientsMu.RLock()
+			defer activeClientsMu.RUnlock()
+			return clientsToSlice(activeClients)
+		})
+	}()
+
+	// Periodic summary of the requests served by each account.
+	wgRefresh.Add(1)
+	go func() {
+		defer wgRefresh.Done()
+		runAccountDistributionLog(ctxRefresh, func() *config.Config {
+			activeClientsMu.RLock()
+			defer activeClientsMu.RUnlock()
+			return activeConfig
+		})
+	}()
+
 	// Main loop to wait for shutdown signal or periodic checks.
 	for {
 		select {
+		case <-hupChan:
+			log.Info("Received SIGHUP, reloading configuration")
+			fileWatcher.RequestReload()
 		case <-sigChan:
 			log.Debugf("Received shutdown signal. Cleaning up...")
 
@@ -363,6 +434,7 @@ func StartService(cfg *config.Config, configPath string) {
 			if err = apiServer.Stop(ctx); err != nil {
 				log.Debugf("Error stopping API server: %v", err)
 			}
+			quota.GetDailyRequestCounter().Flush()
 
 			log.Debugf("Cleanup completed. Exiting...")
 			os.Exit(0)
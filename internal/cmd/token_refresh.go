@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"context"
+	"hash/fnv"
+	"time"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/client"
+	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// geminiTokenCheckInterval is how often Gemini CLI token expiry is checked.
+	geminiTokenCheckInterval = time.Minute
+
+	// geminiTokenRefreshRatio is the fraction of a token's lifetime after which it is refreshed.
+	geminiTokenRefreshRatio = 0.8
+
+	// geminiTokenDefaultLifetime is assumed when the token does not report its lifetime.
+	geminiTokenDefaultLifetime = time.Hour
+
+	// geminiTokenRefreshSpacing separates consecutive refreshes within a single check
+	// so that many accounts do not hit the token endpoint at once.
+	geminiTokenRefreshSpacing = 2 * time.Second
+)
+
+// runGeminiTokenRefresh proactively refreshes Gemini CLI access tokens at 80% of their
+// lifetime and persists them, until ctx is cancelled. Each account's refresh time is offset
+// by a stable per-account jitter so that accounts loaded together do not refresh together.
+//
+// Parameters:
+//   - ctx: The context controlling the scheduler's lifetime
+//   - clients: Returns the currently active clients
+func runGeminiTokenRefresh(ctx context.Context, clients func() []interfaces.Client) {
+	ticker := time.NewTicker(geminiTokenCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, c := range clients() {
+			cliClient, ok := c.(*client.GeminiCLIClient)
+			if !ok || !geminiTokenRefreshDue(cliClient) {
+				continue
+			}
+			log.Debugf("refreshing gemini tokens for %s", cliClient.GetEmail())
+			if err := cliClient.RefreshTokens(ctx); err != nil {
+				log.Warnf("failed to refresh gemini tokens for %s: %v", cliClient.GetEmail(), err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(geminiTokenRefreshSpacing):
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Debugf("refreshing gemini tokens stopped...")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// geminiTokenRefreshDue reports whether the client's access token has passed the refresh
+// point of its lifetime.
+func geminiTokenRefreshDue(cliClient *client.GeminiCLIClient) bool {
+	token, err := cliClient.CurrentToken()
+	if err != nil || token.Expiry.IsZero() {
+		return false
+	}
+
+	lifetime := geminiTokenDefaultLifetime
+	if token.ExpiresIn > 0 {
+		lifetime = time.Duration(token.ExpiresIn) * time.Second
+	}
+	remaining := time.Duration(float64(lifetime) * (1 - geminiTokenRefreshRatio))
+
+	// Spread accounts over an extra 5% of the lifetime based on their identity.
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(cliClient.GetEmail() + "/" + cliClient.GetProjectID()))
+	jitter := time.Duration(hash.Sum32()) % (lifetime / 20)
+
+	return time.Until(token.Expiry) <= remaining+jitter
+}
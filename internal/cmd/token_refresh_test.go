@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	geminiAuth "github.com/luispater/CLIProxyAPI/v5/internal/auth/gemini"
+	"github.com/luispater/CLIProxyAPI/v5/internal/client"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	"golang.org/x/oauth2"
+)
+
+func TestGeminiTokenRefreshDue(t *testing.T) {
+	tests := []struct {
+		name  string
+		token *oauth2.Token
+		want  bool
+	}{
+		{name: "fresh token", token: &oauth2.Token{AccessToken: "t", ExpiresIn: 3600, Expiry: time.Now().Add(50 * time.Minute)}, want: false},
+		{name: "past 80 percent", token: &oauth2.Token{AccessToken: "t", ExpiresIn: 3600, Expiry: time.Now().Add(5 * time.Minute)}, want: true},
+		{name: "default lifetime", token: &oauth2.Token{AccessToken: "t", Expiry: time.Now().Add(5 * time.Minute)}, want: true},
+		{name: "short lifetime not yet due", token: &oauth2.Token{AccessToken: "t", ExpiresIn: 600, Expiry: time.Now().Add(5 * time.Minute)}, want: false},
+		{name: "no expiry", token: &oauth2.Token{AccessToken: "t"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := &geminiAuth.GeminiTokenStorage{Email: "user@example.com", ProjectID: "project", Token: map[string]any{"access_token": "t"}}
+			httpClient := &http.Client{Transport: &oauth2.Transport{Source: oauth2.StaticTokenSource(tt.token)}}
+			cliClient := client.NewGeminiCLIClient(httpClient, ts, &config.Config{AuthDir: t.TempDir()})
+			if got := geminiTokenRefreshDue(cliClient); got != tt.want {
+				t.Errorf("geminiTokenRefreshDue() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
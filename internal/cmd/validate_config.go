@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/auth"
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+	"github.com/tidwall/gjson"
+)
+
+// configReport collects the results of the configuration checks.
+type configReport struct {
+	failed bool
+}
+
+// ok reports a passed check.
+func (r *configReport) ok(format string, args ...any) {
+	fmt.Printf("[ OK ] "+format+"\n", args...)
+}
+
+// warn reports a problem that does not prevent the server from starting.
+func (r *configReport) warn(format string, args ...any) {
+	fmt.Printf("[WARN] "+format+"\n", args...)
+}
+
+// fail reports a problem that prevents the server from working.
+func (r *configReport) fail(format string, args ...any) {
+	fmt.Printf("[FAIL] "+format+"\n", args...)
+	r.failed = true
+}
+
+// DoValidateConfig checks a configuration without starting the server, prints a report,
+// and exits with status 0 if the configuration is usable and 1 otherwise. It verifies that
+// the port is in range, that the proxy URL parses, and that at least one account is
+// available: a readable token file in the auth directory or an API key. A configuration
+// without accounts would otherwise only be noticed when the server starts.
+//
+// Parameters:
+//   - cfg: The loaded configuration, or nil if it could not be loaded
+//   - configFilePath: The path of the configuration file
+//   - loadErr: The error of loading the configuration, if any
+func DoValidateConfig(cfg *config.Config, configFilePath string, loadErr error) {
+	report := &configReport{}
+	defer func() {
+		if report.failed {
+			fmt.Println("Configuration is invalid.")
+			os.Exit(1)
+		}
+		fmt.Println("Configuration is valid.")
+		os.Exit(0)
+	}()
+
+	if loadErr != nil {
+		report.fail("config %s: %v", configFilePath, loadErr)
+		return
+	}
+	report.ok("config %s loaded", configFilePath)
+
+	switch {
+	case cfg.Port == 0 && cfg.ListenSocket != "":
+		report.ok("listen-socket %s (no TCP port)", cfg.ListenSocket)
+	case cfg.Port < 1 || cfg.Port > 65535:
+		report.fail("port %d is out of range (1-65535)", cfg.Port)
+	default:
+		report.ok("port %d", cfg.Port)
+		if cfg.ListenSocket != "" {
+			report.ok("listen-socket %s", cfg.ListenSocket)
+		}
+	}
+
+	validateProxyURL(report, cfg.ProxyURL)
+
+	if cfg.RequestLogSampleRate < 0 || cfg.RequestLogSampleRate > 1 {
+		report.warn("request-log-sample-rate %v is outside 0-1 and is treated as %v", cfg.RequestLogSampleRate, max(0, min(1, cfg.RequestLogSampleRate)))
+	}
+
+	tokenFiles := validateAuthDir(report, cfg.AuthDir)
+	apiKeys := len(cfg.GlAPIKey) + len(cfg.ClaudeKey) + len(cfg.CodexKey) + len(cfg.OpenAICompatibility)
+	if apiKeys > 0 {
+		report.ok("%d API key(s) configured", apiKeys)
+	}
+	if tokenFiles == 0 && apiKeys == 0 {
+		report.fail("no accounts: auth-dir has no token files and no API keys are configured; log in with --login (or another login flag) or add a generative-language-api-key")
+	}
+}
+
+// validateProxyURL checks that the proxy URL, if any, parses and uses a supported scheme.
+// Outbound requests silently go direct when the proxy URL is not usable.
+func validateProxyURL(report *configReport, proxyURL string) {
+	if proxyURL == "" {
+		report.ok("proxy-url not set, connecting directly")
+		return
+	}
+	parsed, err := url.Parse(proxyURL)
+	if err != nil {
+		report.fail("proxy-url %q does not parse: %v", proxyURL, err)
+		return
+	}
+	switch parsed.Scheme {
+	case "http", "https", "socks5":
+	default:
+		report.fail("proxy-url %q has unsupported scheme %q (expected http, https, or socks5)", proxyURL, parsed.Scheme)
+		return
+	}
+	if parsed.Host == "" {
+		report.fail("proxy-url %q has no host", proxyURL)
+		return
+	}
+	report.ok("proxy-url %s://%s", parsed.Scheme, parsed.Host)
+}
+
+// validateAuthDir checks the auth directory and returns the number of readable token files
+// in it. Files that cannot be read, are not JSON, or have no provider type are reported.
+func validateAuthDir(report *configReport, authDir string) int {
+	info, err := os.Stat(authDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			report.warn("auth-dir %s does not exist; it is created when the server starts", authDir)
+		} else {
+			report.fail("auth-dir %s: %v", authDir, err)
+		}
+		return 0
+	}
+	if !info.IsDir() {
+		report.fail("auth-dir %s is not a directory", authDir)
+		return 0
+	}
+
+	count := 0
+	err = filepath.WalkDir(authDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			return nil
+		}
+		data, errReadFile := os.ReadFile(path)
+		if errReadFile != nil {
+			report.warn("token file %s is not readable: %v", path, errReadFile)
+			return nil
+		}
+		if !gjson.ValidBytes(data) {
+			report.warn("token file %s is not valid JSON", path)
+			return nil
+		}
+		if migrated, _, errMigrate := auth.MigrateTokenData(data); errMigrate == nil {
+			data = migrated
+		}
+		tokenType := gjson.GetBytes(data, "type").String()
+		if tokenType == "" {
+			report.warn("token file %s has no type and is ignored", path)
+			return nil
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		report.fail("auth-dir %s could not be read: %v", authDir, err)
+		return count
+	}
+	if count == 0 {
+		report.warn("auth-dir %s contains no token files", authDir)
+	} else {
+		report.ok("auth-dir %s contains %d token file(s)", authDir, count)
+	}
+	return count
+}
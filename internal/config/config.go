@@ -12,35 +12,260 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-// Config represents the application's configuration, loaded from a YAML file.
+// Config represents the application's configuration, loaded from a YAML file. A few settings
+// can also be set through environment variables, which take precedence over the file.
 type Config struct {
-	// Port is the network port on which the API server will listen.
+	// Port is the network port on which the API server will listen. CLIPROXY_PORT overrides it.
 	Port int `yaml:"port" json:"-"`
 
-	// AuthDir is the directory where authentication token files are stored.
+	// ListenSocket is the path of a Unix socket the API server listens on, in addition to
+	// Port, or instead of it if Port is 0. The socket is created with 0600 permissions and
+	// removed on shutdown.
+	ListenSocket string `yaml:"listen-socket" json:"-"`
+
+	// AuthDir is the directory where authentication token files are stored. CLIPROXY_AUTH_DIR
+	// overrides it.
 	AuthDir string `yaml:"auth-dir" json:"-"`
 
+	// MigrateAuthFiles writes token files of an older schema version back to disk after
+	// upgrading them on load. When false, they are upgraded in memory only.
+	MigrateAuthFiles bool `yaml:"migrate-auth-files" json:"migrate-auth-files"`
+
 	// Debug enables or disables debug-level logging and other debug features.
 	Debug bool `yaml:"debug" json:"debug"`
 
 	// ProxyURL is the URL of an optional proxy server to use for outbound requests.
+	// CLIPROXY_PROXY_URL overrides it.
 	ProxyURL string `yaml:"proxy-url" json:"proxy-url"`
 
 	// APIKeys is a list of keys for authenticating clients to this proxy server.
+	// CLIPROXY_API_KEYS, a comma-separated list, overrides it.
 	APIKeys []string `yaml:"api-keys" json:"api-keys"`
 
+	// APIKeySettings defines per-key overrides for clients authenticating with one of APIKeys.
+	APIKeySettings []APIKeySetting `yaml:"api-key-settings" json:"api-key-settings"`
+
+	// CORS defines the cross-origin resource sharing policy for browser-based clients.
+	CORS CORS `yaml:"cors" json:"cors"`
+
 	// QuotaExceeded defines the behavior when a quota is exceeded.
 	QuotaExceeded QuotaExceeded `yaml:"quota-exceeded" json:"quota-exceeded"`
 
+	// Overload defines the load shedding behavior when the server is overloaded.
+	Overload Overload `yaml:"overload" json:"overload"`
+
+	// GlobalRateLimit caps the rate of API requests across all keys and accounts.
+	GlobalRateLimit GlobalRateLimit `yaml:"global-rate-limit" json:"global-rate-limit"`
+
 	// GlAPIKey is the API key for the generative language API.
 	GlAPIKey []string `yaml:"generative-language-api-key" json:"generative-language-api-key"`
 
+	// GlAPIKeyWeights are the relative shares of requests sent to the generative language API
+	// keys, in the order of GlAPIKey. Keys without a weight have a weight of 1.
+	GlAPIKeyWeights []int `yaml:"generative-language-api-key-weights" json:"generative-language-api-key-weights"`
+
 	// RequestLog enables or disables detailed request logging functionality.
 	RequestLog bool `yaml:"request-log" json:"request-log"`
 
+	// RequestLogSampleRate is the fraction of requests, between 0 and 1, that request-log
+	// records in full. Requests that fail are always recorded. The decision is made once per
+	// request, so a request is either recorded completely or not at all.
+	// Defaults to 1 (see LoadConfig).
+	RequestLogSampleRate float64 `yaml:"request-log-sample-rate" json:"request-log-sample-rate"`
+
+	// LogRequests writes the requests sent upstream and their responses to
+	// <auth-dir>/logs/upstream.log: "headers", "bodies", or "full" (headers and bodies).
+	// Credentials are redacted. Empty or "off" disables the log.
+	LogRequests string `yaml:"log-requests" json:"log-requests"`
+
 	// RequestRetry defines the retry times when the request failed.
+	// Defaults to 3 if not set in YAML (see LoadConfig).
 	RequestRetry int `yaml:"request-retry" json:"request-retry"`
 
+	// SameAccountRetry is how many times a transient 5xx response is retried on the same
+	// account, with exponential backoff, before the request counts as failed and request-retry
+	// moves it to another account. Defaults to 1 if not set in YAML (see LoadConfig).
+	SameAccountRetry int `yaml:"same-account-retry" json:"same-account-retry"`
+
+	// LoadBalance selects the account a request is sent to among those that can serve the
+	// model: "lru" (default) picks the least recently used one, "latency" the one with the
+	// lowest recent upstream latency. With generative-language-api-key-weights, the latency of
+	// an API key is divided by its weight.
+	LoadBalance string `yaml:"load-balance" json:"load-balance"`
+
+	// MaxUpstreamAttempts caps the upstream calls a single request may cause across all
+	// fallback mechanisms combined: transient retries, preview model and project switches, and
+	// switches to other accounts. Once exhausted, the last upstream error is returned.
+	// 0 disables the limit.
+	MaxUpstreamAttempts int `yaml:"max-upstream-attempts" json:"max-upstream-attempts"`
+
+	// RequestTimeoutSeconds aborts an upstream call that takes longer than this many seconds.
+	// A non-streaming call must complete within it; a streaming call must only start
+	// streaming within it. 0 disables the timeout.
+	RequestTimeoutSeconds int `yaml:"request-timeout-seconds" json:"request-timeout-seconds"`
+
+	// StreamIdleTimeoutSeconds aborts an upstream stream when no data arrives for this many
+	// seconds. 0 disables the timeout.
+	StreamIdleTimeoutSeconds int `yaml:"stream-idle-timeout-seconds" json:"stream-idle-timeout-seconds"`
+
+	// StrictNumericParams disables lenient parsing of string-encoded numeric request
+	// parameters (e.g. "temperature": "0.7"). When false, such strings are converted to numbers.
+	StrictNumericParams bool `yaml:"strict-numeric-params" json:"strict-numeric-params"`
+
+	// StrictReasoningEffort rejects requests whose reasoning effort is not one of none, auto,
+	// low, medium, or high with a 400 error. When false, unknown values fall back to auto.
+	StrictReasoningEffort bool `yaml:"strict-reasoning-effort" json:"strict-reasoning-effort"`
+
+	// CaseInsensitiveModels resolves model names that differ from a known model only in case
+	// (e.g. "Gemini-2.5-Flash") to the canonical name before the request is routed.
+	CaseInsensitiveModels bool `yaml:"case-insensitive-models" json:"case-insensitive-models"`
+
+	// TrimLeadingWhitespace removes leading whitespace from the first content delta of a stream.
+	// Thinking and tool-call chunks are not affected.
+	TrimLeadingWhitespace bool `yaml:"trim-leading-whitespace" json:"trim-leading-whitespace"`
+
+	// DropDuplicateChunks drops a streamed Gemini chunk that is identical to the previous one,
+	// which upstream glitches occasionally produce.
+	DropDuplicateChunks bool `yaml:"drop-duplicate-chunks" json:"drop-duplicate-chunks"`
+
+	// StreamBuffer merges the text of streamed Gemini chunks until a minimum number of
+	// characters has accumulated, for clients that render single-token chunks poorly.
+	StreamBuffer StreamBuffer `yaml:"stream-buffer" json:"stream-buffer"`
+
+	// StreamChannelBuffer is the number of chunks the upstream reader of a stream may read
+	// ahead of a slow client. When the buffer is full, upstream reads pause until the client
+	// catches up. 0 hands every chunk over directly.
+	StreamChannelBuffer int `yaml:"stream-channel-buffer" json:"stream-channel-buffer"`
+
+	// DuplicateToolCallIDs controls how OpenAI chat requests that reuse a tool_call_id across
+	// tool calls are handled: "rename" gives each call a unique ID and rewrites the matching
+	// tool results, "reject" fails the request with a 400 error.
+	DuplicateToolCallIDs string `yaml:"duplicate-tool-call-ids" json:"duplicate-tool-call-ids"`
+
+	// FallbackResponse is an optional canned reply returned in the format of the request,
+	// instead of an error, when every account for the requested model is exhausted.
+	FallbackResponse string `yaml:"fallback-response" json:"fallback-response"`
+
+	// RecitationRetry retries a non-streaming Gemini request once, with a higher temperature and
+	// a request to rephrase, when its response is blocked with the RECITATION finish reason.
+	RecitationRetry bool `yaml:"recitation-retry" json:"recitation-retry"`
+
+	// StructuredOutput configures retries of non-streaming JSON mode Gemini requests whose
+	// output fails validation against the response schema.
+	StructuredOutput StructuredOutput `yaml:"structured-output" json:"structured-output"`
+
+	// ResponseLanguage asks models to respond in a fixed language and optionally checks the
+	// language of responses. A key's response-language overrides the language.
+	ResponseLanguage ResponseLanguage `yaml:"response-language" json:"response-language"`
+
+	// StreamErrors controls error payloads that Gemini sends within a stream after it has
+	// started. "finish" stops the stream and ends it with an error note and the OTHER finish
+	// reason; "forward" passes the payload on like any other chunk. Defaults to "finish".
+	StreamErrors string `yaml:"stream-errors" json:"stream-errors"`
+
+	// FinishMessage controls the finishMessage Gemini adds to explain why generation stopped,
+	// for example on a block. "field" passes it on in native_finish_message of OpenAI chat
+	// completions, "content" appends it to the response text for every API format, and "omit"
+	// drops it. Defaults to "field".
+	FinishMessage string `yaml:"finish-message" json:"finish-message"`
+
+	// PromptTemplates defines opt-in, per-model templates that wrap the final user message
+	// or the system instruction of translated Gemini requests.
+	PromptTemplates []PromptTemplate `yaml:"prompt-templates" json:"prompt-templates"`
+
+	// DefaultSafetySettings are the safety settings of Gemini requests that do not set any.
+	DefaultSafetySettings []SafetySetting `yaml:"default-safety-settings" json:"default-safety-settings"`
+
+	// DefaultGroundingModels lists the models whose Gemini requests are grounded with Google
+	// Search unless they opt out with X-CLIProxy-No-Grounding: true. Entries may contain
+	// wildcards such as "gemini-2.5-pro*".
+	DefaultGroundingModels []string `yaml:"default-grounding-models" json:"default-grounding-models"`
+
+	// PartOrdering controls the order of parts within each content of translated Gemini
+	// requests. "normalize" reorders them into the sequence Gemini accepts (thoughts, function
+	// responses, a single image or file, text, function calls); empty keeps the client's order.
+	PartOrdering string `yaml:"part-ordering" json:"part-ordering"`
+
+	// UnsupportedPenalties controls presencePenalty and frequencyPenalty in Gemini requests to
+	// models without the penalties capability: "omit" drops them, "warn" drops them and logs
+	// a warning, and "forward" sends them anyway. Defaults to "omit" (see LoadConfig).
+	UnsupportedPenalties string `yaml:"unsupported-penalties" json:"unsupported-penalties"`
+
+	// StopOnToolCall ends a Gemini stream as soon as a chunk containing a tool call has been
+	// forwarded, keyed by model name. The "*" entry applies to models without their own entry.
+	StopOnToolCall map[string]bool `yaml:"stop-on-tool-call,omitempty" json:"stop-on-tool-call,omitempty"`
+
+	// FlushToolCalls sends every tool call of a Gemini stream translated to OpenAI Chat
+	// Completions in a chunk of its own, ahead of the finish reason, keyed by model name. The
+	// "*" entry applies to models without their own entry.
+	FlushToolCalls map[string]bool `yaml:"flush-tool-calls,omitempty" json:"flush-tool-calls,omitempty"`
+
+	// IncludeThoughts asks Gemini to return its thoughts. When false, every Gemini request is
+	// sent with include_thoughts disabled, whatever its reasoning effort, and any thought parts
+	// are removed from responses. Defaults to true.
+	IncludeThoughts bool `yaml:"include-thoughts" json:"include-thoughts"`
+
+	// ThinkingOutput controls how Gemini thoughts are returned, keyed by model name: "separate"
+	// keeps them as reasoning parts, "inline" turns them into text wrapped in <think> tags, and
+	// "hidden" removes them. The "*" entry applies to models without their own entry.
+	ThinkingOutput map[string]string `yaml:"thinking-output,omitempty" json:"thinking-output,omitempty"`
+
+	// ReasoningBudgets maps model names to the Gemini thinking budgets used for the low, medium,
+	// and high reasoning efforts. The "*" entry applies to models without their own entry.
+	// Models and efforts without an entry use the built-in budgets.
+	ReasoningBudgets map[string]ReasoningBudget `yaml:"reasoning-budgets,omitempty" json:"reasoning-budgets,omitempty"`
+
+	// ContextSummarization configures automatic summarization of older messages when a
+	// Gemini request overflows the model's context window.
+	ContextSummarization ContextSummarization `yaml:"context-summarization" json:"context-summarization"`
+
+	// HistoryLimit caps the number of messages forwarded upstream per request.
+	HistoryLimit HistoryLimit `yaml:"history-limit" json:"history-limit"`
+
+	// SystemPrompt is added to the system instruction of every request. See APIKeySetting.SystemPrompt
+	// for the order in which it is combined with the key's prompt.
+	SystemPrompt SystemPrompt `yaml:"system-prompt" json:"system-prompt"`
+
+	// ToolLimits caps the tool declarations forwarded to Gemini upstreams.
+	ToolLimits ToolLimits `yaml:"tool-limits" json:"tool-limits"`
+
+	// ToolResults caps the size of the tool results in requests.
+	ToolResults ToolResults `yaml:"tool-results" json:"tool-results"`
+
+	// ImageDownscale shrinks large inline images of Gemini requests before they are sent.
+	ImageDownscale ImageDownscale `yaml:"image-downscale" json:"image-downscale"`
+
+	// InvalidSamplingParams selects how Gemini requests with temperature outside [0, 2], topP
+	// outside [0, 1], or a topK that is not a positive integer are handled: "clamp" (default)
+	// clamps the value into range, "reject" returns a 400 error naming the field.
+	InvalidSamplingParams string `yaml:"invalid-sampling-params" json:"invalid-sampling-params"`
+
+	// HealthCheck configures periodic background health checks of Gemini CLI accounts.
+	HealthCheck HealthCheck `yaml:"health-check" json:"health-check"`
+
+	// DistributionLogInterval logs a summary of the requests served and failed by each account
+	// every this many seconds, covering the time since the previous summary. 0 disables it.
+	DistributionLogInterval int `yaml:"distribution-log-interval" json:"distribution-log-interval"`
+
+	// ConnectionWarmupInterval sends a minimal request through every client every this many
+	// seconds, so that idle upstream connections stay open. 0 disables it.
+	ConnectionWarmupInterval int `yaml:"connection-warmup-interval" json:"connection-warmup-interval"`
+
+	// APIVersions overrides the upstream API versions and enables detection of a working
+	// version when the configured one is no longer served.
+	APIVersions APIVersions `yaml:"api-versions" json:"api-versions"`
+
+	// RequestCapture configures recording of API requests and their upstream exchanges
+	// to replay files. It only takes effect in debug mode.
+	RequestCapture RequestCapture `yaml:"request-capture" json:"request-capture"`
+
+	// RequestDedup configures sharing one upstream response between identical API requests.
+	RequestDedup RequestDedup `yaml:"request-dedup" json:"request-dedup"`
+
+	// Onboarding limits how many Gemini CLI accounts are onboarded at once and how often
+	// the onboarding API is polled across all of them.
+	Onboarding Onboarding `yaml:"onboarding" json:"onboarding"`
+
 	// ClaudeKey defines a list of Claude API key configurations as specified in the YAML configuration file.
 	ClaudeKey []ClaudeKey `yaml:"claude-api-key" json:"claude-api-key"`
 
@@ -61,6 +286,29 @@ type Config struct {
 
 	// GeminiWeb groups configuration for Gemini Web client
 	GeminiWeb GeminiWebConfig `yaml:"gemini-web" json:"gemini-web"`
+
+	// Metrics groups options for the in-process metrics.
+	Metrics MetricsConfig `yaml:"metrics" json:"metrics"`
+
+	// AccountAliases maps account e-mails (or Gemini API keys) to the labels that identify the
+	// accounts in logs and metrics. Accounts without an alias are shown with a masked e-mail.
+	AccountAliases map[string]string `yaml:"account-aliases,omitempty" json:"account-aliases,omitempty"`
+
+	// envOverrides remembers the file values of the settings overridden by environment
+	// variables, so that they are not written to the configuration file.
+	envOverrides *envOverrides
+}
+
+// MetricsConfig nests metrics related options under 'metrics'.
+type MetricsConfig struct {
+	// Listen is the address (e.g. "127.0.0.1:9464") of a separate listener that serves the
+	// metrics in the Prometheus text format at /metrics, without authentication. Empty
+	// disables the listener. Changes take effect after a restart.
+	Listen string `yaml:"listen" json:"listen"`
+
+	// TTFTExcludeThinking, when true, ignores thinking-only chunks when measuring
+	// the time to first token of a stream.
+	TTFTExcludeThinking bool `yaml:"ttft-exclude-thinking" json:"ttft-exclude-thinking"`
 }
 
 // GeminiWebConfig nests Gemini Web related options under 'gemini-web'.
@@ -91,12 +339,329 @@ type GeminiWebConfig struct {
 	TokenRefreshSeconds int `yaml:"token-refresh-seconds" json:"token-refresh-seconds"`
 }
 
+// APIKeySetting holds the overrides applied to requests authenticated with a specific API key.
+type APIKeySetting struct {
+	// APIKey is the proxy API key these settings apply to. It must also be listed in api-keys.
+	APIKey string `yaml:"api-key" json:"api-key"`
+
+	// ReasoningEffort is the default reasoning effort (none, auto, low, medium, high)
+	// applied when a request does not specify one.
+	ReasoningEffort string `yaml:"reasoning-effort,omitempty" json:"reasoning-effort,omitempty"`
+
+	// MaxResponseBytes caps the text of Gemini responses returned to this key. Longer responses
+	// are truncated with a notice and finish with a length finish reason. 0 disables the limit.
+	MaxResponseBytes int `yaml:"max-response-bytes,omitempty" json:"max-response-bytes,omitempty"`
+
+	// ThinkingOutput overrides the thinking-output mode (separate, inline, hidden) for this key.
+	ThinkingOutput string `yaml:"thinking-output,omitempty" json:"thinking-output,omitempty"`
+
+	// AllowedModels restricts this key to the listed models. Entries may contain wildcards
+	// such as "gemini-2.5-flash*". An empty list allows every model not denied.
+	AllowedModels []string `yaml:"allowed-models,omitempty" json:"allowed-models,omitempty"`
+
+	// DeniedModels lists models this key may never use. It takes precedence over AllowedModels.
+	DeniedModels []string `yaml:"denied-models,omitempty" json:"denied-models,omitempty"`
+
+	// AllowIgnoreQuota lets this key send X-CLIProxy-Ignore-Quota: true to attempt the upstream
+	// call even when an account is remembered as quota exceeded for the model.
+	AllowIgnoreQuota bool `yaml:"allow-ignore-quota,omitempty" json:"allow-ignore-quota,omitempty"`
+
+	// AllowNoSystemInject lets this key send X-CLIProxy-No-System-Inject: true to skip the
+	// configured system prompts and the response-language instruction for a request.
+	AllowNoSystemInject bool `yaml:"allow-no-system-inject,omitempty" json:"allow-no-system-inject,omitempty"`
+
+	// MaxHistoryMessages overrides history-limit.max-messages for this key. 0 uses the global limit.
+	MaxHistoryMessages int `yaml:"max-history-messages,omitempty" json:"max-history-messages,omitempty"`
+
+	// MaxToolResultBytes overrides tool-results.max-bytes for this key. 0 uses the global limit.
+	MaxToolResultBytes int `yaml:"max-tool-result-bytes,omitempty" json:"max-tool-result-bytes,omitempty"`
+
+	// ToolResultPolicy overrides tool-results.policy (truncate, reject, offload) for this key.
+	ToolResultPolicy string `yaml:"tool-result-policy,omitempty" json:"tool-result-policy,omitempty"`
+
+	// SystemPrompt is added to the system instruction of requests authenticated with this key.
+	// The system instruction is composed as: global prefix, key prefix, the request's own system
+	// instruction, key suffix, global suffix.
+	SystemPrompt SystemPrompt `yaml:"system-prompt,omitempty" json:"system-prompt,omitempty"`
+
+	// ResponseLanguage overrides response-language.language for this key.
+	ResponseLanguage string `yaml:"response-language,omitempty" json:"response-language,omitempty"`
+}
+
+// CORS defines the cross-origin resource sharing policy. CORS is disabled unless at least
+// one allowed origin is configured.
+type CORS struct {
+	// AllowedOrigins lists the origins allowed to call the API. "*" allows any origin.
+	AllowedOrigins []string `yaml:"allowed-origins" json:"allowed-origins"`
+
+	// AllowedMethods lists the methods returned for preflight requests.
+	// Defaults to GET, POST, PUT, PATCH, DELETE, and OPTIONS when empty.
+	AllowedMethods []string `yaml:"allowed-methods" json:"allowed-methods"`
+
+	// AllowedHeaders lists the request headers returned for preflight requests.
+	// When empty, the headers requested by the browser are allowed.
+	AllowedHeaders []string `yaml:"allowed-headers" json:"allowed-headers"`
+
+	// AllowCredentials allows browsers to send credentials such as cookies.
+	AllowCredentials bool `yaml:"allow-credentials" json:"allow-credentials"`
+}
+
+// HealthCheck defines how often Gemini CLI accounts are checked in the background. Accounts
+// whose last check failed are skipped by client selection until a later check succeeds.
+type HealthCheck struct {
+	// Enabled turns on the background health checks.
+	Enabled bool `yaml:"enabled" json:"enabled"`
+
+	// HealthyInterval is the number of seconds between checks of a healthy account.
+	// Defaults to 900 if not set in YAML (see LoadConfig).
+	HealthyInterval int `yaml:"healthy-interval" json:"healthy-interval"`
+
+	// FailingInterval is the number of seconds before the first re-check of a failing account.
+	// The interval doubles with each consecutive failure. Defaults to 60.
+	FailingInterval int `yaml:"failing-interval" json:"failing-interval"`
+
+	// MaxBackoff caps the interval in seconds between checks of a failing account. Defaults to 1800.
+	MaxBackoff int `yaml:"max-backoff" json:"max-backoff"`
+}
+
+// APIVersions defines the API versions used for upstream Gemini requests.
+type APIVersions struct {
+	// GeminiCLI overrides the Gemini CLI (Code Assist) API version. Defaults to "v1internal".
+	GeminiCLI string `yaml:"gemini-cli" json:"gemini-cli"`
+
+	// Gemini overrides the Generative Language API version. Defaults to "v1beta".
+	Gemini string `yaml:"gemini" json:"gemini"`
+
+	// Detect retries requests that fail because the API version is not served with the
+	// other known versions, and keeps using the first one that works.
+	Detect bool `yaml:"detect" json:"detect"`
+}
+
+// RequestCapture defines where captured requests are written. Captures contain full prompts
+// and responses, so they are only recorded while debug mode is on.
+type RequestCapture struct {
+	// Enabled turns on request capturing.
+	Enabled bool `yaml:"enabled" json:"enabled"`
+
+	// Dir is the directory capture files are written to. Relative paths are resolved against
+	// the directory of the config file. Defaults to "captures".
+	Dir string `yaml:"dir" json:"dir"`
+}
+
+// RequestDedup defines how identical API requests are coalesced. A request is identical to
+// another if it uses the same API key, path, query, and body.
+type RequestDedup struct {
+	// Enabled turns on request deduplication.
+	Enabled bool `yaml:"enabled" json:"enabled"`
+
+	// WindowSeconds is how long a completed response is replayed to identical requests.
+	// Identical requests that arrive while the first one is in flight always wait for it.
+	// Defaults to 10 if not set in YAML (see LoadConfig).
+	WindowSeconds int `yaml:"window-seconds" json:"window-seconds"`
+
+	// MaxBufferedChunks caps the number of response chunks recorded per request. Responses
+	// with more chunks are not shared. Defaults to 2048.
+	MaxBufferedChunks int `yaml:"max-buffered-chunks" json:"max-buffered-chunks"`
+}
+
+// StructuredOutput defines how JSON mode responses that fail validation are retried.
+type StructuredOutput struct {
+	// MaxRetries is the number of retries, each feeding the failed output and the validation
+	// errors back to the model. 0 disables validation.
+	MaxRetries int `yaml:"max-retries" json:"max-retries"`
+
+	// OnFailure selects the result when no attempt passes: "best" returns the attempt with
+	// the fewest validation errors, "error" returns an error. Defaults to "best".
+	OnFailure string `yaml:"on-failure" json:"on-failure"`
+}
+
+// ResponseLanguage defines the language responses must be in and how it is checked.
+type ResponseLanguage struct {
+	// Language is the language responses must be in, as an English name or ISO 639-1 code
+	// (e.g. "Japanese" or "ja"). An instruction to respond in it is added to the system
+	// instruction. Empty disables enforcement.
+	Language string `yaml:"language" json:"language"`
+
+	// Validate checks the script of non-streaming Gemini responses: "off" (default) does not
+	// check, "flag" logs a warning and sets the X-CLIProxy-Language-Mismatch response header,
+	// and "retry" also retries once with a reminder of the language.
+	Validate string `yaml:"validate" json:"validate"`
+}
+
+// Onboarding defines the concurrency and polling rate of Gemini CLI account onboarding.
+type Onboarding struct {
+	// MaxConcurrent is the number of accounts onboarded in parallel. Further accounts wait
+	// for a slot. Defaults to 4 if not set in YAML (see LoadConfig).
+	MaxConcurrent int `yaml:"max-concurrent" json:"max-concurrent"`
+
+	// PollsPerMinute caps the onboarding API calls per minute, shared by all accounts.
+	// Defaults to 30. 0 disables the limit.
+	PollsPerMinute int `yaml:"polls-per-minute" json:"polls-per-minute"`
+
+	// AutoSelectProject uses the only Google Cloud project of an account at login when
+	// onboarding cannot determine the project. Defaults to true (see LoadConfig).
+	AutoSelectProject bool `yaml:"auto-select-project" json:"auto-select-project"`
+}
+
+// ContextSummarization defines how older messages are summarized to keep long conversations
+// within the context window.
+type ContextSummarization struct {
+	// Enabled turns on summarization. It is triggered by an upstream context overflow error,
+	// or proactively when TriggerTokens is set.
+	Enabled bool `yaml:"enabled" json:"enabled"`
+
+	// Model is the model used to produce the summary.
+	// Defaults to gemini-2.5-flash if not set in YAML (see LoadConfig).
+	Model string `yaml:"model" json:"model"`
+
+	// KeepRecentMessages is the number of most recent messages kept verbatim.
+	// Defaults to 6 if not set in YAML (see LoadConfig).
+	KeepRecentMessages int `yaml:"keep-recent-messages" json:"keep-recent-messages"`
+
+	// TriggerTokens summarizes before sending when the estimated history size exceeds this
+	// many tokens. 0 summarizes only after an overflow error.
+	TriggerTokens int `yaml:"trigger-tokens" json:"trigger-tokens"`
+}
+
+// ReasoningBudget defines the thinking budgets of a model per reasoning effort. 0 uses the
+// built-in budget for the effort.
+type ReasoningBudget struct {
+	// Low is the thinking budget for the low reasoning effort.
+	Low int `yaml:"low" json:"low"`
+
+	// Medium is the thinking budget for the medium reasoning effort.
+	Medium int `yaml:"medium" json:"medium"`
+
+	// High is the thinking budget for the high reasoning effort.
+	High int `yaml:"high" json:"high"`
+}
+
+// ForEffort returns the thinking budget for a reasoning effort (low, medium, or high), or 0
+// if the effort has no budget.
+func (b ReasoningBudget) ForEffort(effort string) int {
+	switch effort {
+	case "low":
+		return b.Low
+	case "medium":
+		return b.Medium
+	case "high":
+		return b.High
+	}
+	return 0
+}
+
+// SystemPrompt defines text placed before and after the system instruction of a request.
+type SystemPrompt struct {
+	// Prefix is placed before the request's system instruction.
+	Prefix string `yaml:"prefix,omitempty" json:"prefix,omitempty"`
+
+	// Suffix is placed after the request's system instruction.
+	Suffix string `yaml:"suffix,omitempty" json:"suffix,omitempty"`
+}
+
+// HistoryLimit defines how long conversation histories are trimmed before translation.
+type HistoryLimit struct {
+	// MaxMessages is the number of most recent messages kept; older messages are dropped.
+	// System instructions are always kept. 0 disables the limit.
+	MaxMessages int `yaml:"max-messages" json:"max-messages"`
+
+	// Note adds a note saying how many messages were omitted to the system instruction.
+	Note bool `yaml:"note" json:"note"`
+}
+
+// StreamBuffer defines how streamed text is buffered before it is sent to the client.
+type StreamBuffer struct {
+	// MinChars is the number of characters buffered before a chunk is sent. Tool calls and
+	// the final chunk are never delayed. 0 disables buffering.
+	MinChars int `yaml:"min-chars" json:"min-chars"`
+
+	// MaxDelayMs is the longest time in milliseconds text is buffered before it is sent,
+	// even if fewer than MinChars characters have accumulated. Defaults to 250.
+	MaxDelayMs int `yaml:"max-delay-ms" json:"max-delay-ms"`
+}
+
+// ToolLimits defines the limits applied to the function declarations of a request.
+type ToolLimits struct {
+	// MaxDeclarations is the maximum number of function declarations per request. 0 disables the limit.
+	MaxDeclarations int `yaml:"max-declarations" json:"max-declarations"`
+
+	// MaxSchemaBytes is the maximum total size in bytes of all function declarations. 0 disables the limit.
+	MaxSchemaBytes int `yaml:"max-schema-bytes" json:"max-schema-bytes"`
+
+	// MaxSchemaDepth is the maximum nesting depth of the parameter schema of a function declaration.
+	// 0 disables the limit.
+	MaxSchemaDepth int `yaml:"max-schema-depth" json:"max-schema-depth"`
+
+	// PruneDescriptions removes the parameter descriptions of the declarations when they exceed
+	// MaxSchemaBytes, before the limit is enforced.
+	PruneDescriptions bool `yaml:"prune-descriptions" json:"prune-descriptions"`
+
+	// Truncate drops the declarations beyond the limits with a warning instead of rejecting the request.
+	Truncate bool `yaml:"truncate" json:"truncate"`
+}
+
+// ToolResults defines how tool results larger than a limit are handled.
+type ToolResults struct {
+	// MaxBytes is the maximum size in bytes of a single tool result. 0 disables the limit.
+	MaxBytes int `yaml:"max-bytes" json:"max-bytes"`
+
+	// Policy is applied to larger tool results: "truncate" (the default) cuts them off with a
+	// marker, "reject" returns a 400 error, and "offload" stores them in a file under OffloadDir
+	// and replaces them with a reference to the file followed by their first MaxBytes bytes.
+	Policy string `yaml:"policy" json:"policy"`
+
+	// OffloadDir is the directory of offloaded tool results. Defaults to <auth-dir>/tool-results.
+	OffloadDir string `yaml:"offload-dir" json:"offload-dir"`
+}
+
+// ImageDownscale defines when inline images are downscaled and re-encoded.
+type ImageDownscale struct {
+	// Enabled turns on downscaling of PNG, JPEG, and GIF images.
+	Enabled bool `yaml:"enabled" json:"enabled"`
+
+	// MaxDimension is the maximum width and height in pixels; larger images are scaled down
+	// keeping their aspect ratio. Defaults to 2048. 0 disables the limit.
+	MaxDimension int `yaml:"max-dimension" json:"max-dimension"`
+
+	// MaxBytes is the maximum decoded size of an image in bytes; larger images are re-encoded
+	// and, if still too large, scaled down further. 0 disables the limit.
+	MaxBytes int `yaml:"max-bytes" json:"max-bytes"`
+
+	// JPEGQuality is the quality (1-100) of re-encoded opaque images. Defaults to 85.
+	JPEGQuality int `yaml:"jpeg-quality" json:"jpeg-quality"`
+}
+
+// SafetySetting sets the threshold at which Gemini blocks content of a harm category.
+type SafetySetting struct {
+	// Category is the harm category, e.g. "HARM_CATEGORY_HARASSMENT".
+	Category string `yaml:"category" json:"category"`
+
+	// Threshold is the blocking threshold, e.g. "BLOCK_NONE" or "BLOCK_ONLY_HIGH".
+	Threshold string `yaml:"threshold" json:"threshold"`
+}
+
+// PromptTemplate wraps part of a request sent to a specific model.
+type PromptTemplate struct {
+	// Model is the exact model name the template applies to.
+	Model string `yaml:"model" json:"model"`
+
+	// Target selects what is wrapped: "user" (the final user message, default) or "system"
+	// (the system instruction).
+	Target string `yaml:"target,omitempty" json:"target,omitempty"`
+
+	// Template is the wrapping text. The placeholder {{content}} is replaced by the original
+	// content; a template without the placeholder is used as a prefix.
+	Template string `yaml:"template" json:"template"`
+}
+
 // RemoteManagement holds management API configuration under 'remote-management'.
 type RemoteManagement struct {
 	// AllowRemote toggles remote (non-localhost) access to management API.
 	AllowRemote bool `yaml:"allow-remote"`
 	// SecretKey is the management key (plaintext or bcrypt hashed). YAML key intentionally 'secret-key'.
 	SecretKey string `yaml:"secret-key"`
+	// AdminUI serves a read-only admin page at /admin that shows account and metrics status.
+	AdminUI bool `yaml:"admin-ui"`
 }
 
 // QuotaExceeded defines the behavior when API quota limits are exceeded.
@@ -107,6 +672,38 @@ type QuotaExceeded struct {
 
 	// SwitchPreviewModel indicates whether to automatically switch to a preview model when a quota is exceeded.
 	SwitchPreviewModel bool `yaml:"switch-preview-model" json:"switch-preview-model"`
+
+	// DailyRequestLimits maps model names to a daily request soft cap per Gemini account.
+	// An account reaching the cap is treated as quota exceeded for that model until the
+	// quota window resets at midnight Pacific time. The "*" key applies to all other models.
+	DailyRequestLimits map[string]int `yaml:"daily-request-limits,omitempty" json:"daily-request-limits,omitempty"`
+
+	// CooldownSeconds is how long a model is skipped on an account after the account hits
+	// its quota for the model. Defaults to 1800 (30 minutes). A delay requested by the upstream
+	// 429 of a Gemini CLI account takes precedence.
+	CooldownSeconds int `yaml:"cooldown-seconds" json:"cooldown-seconds"`
+}
+
+// Overload defines the load shedding behavior of the API server.
+type Overload struct {
+	// MaxActiveRequests is the number of in-flight API requests past which new requests
+	// are rejected with 503 Service Unavailable. Zero disables load shedding.
+	MaxActiveRequests int `yaml:"max-active-requests" json:"max-active-requests"`
+
+	// RetryAfterSeconds is the value of the Retry-After header sent with 503 responses.
+	// Defaults to 5 when unset or <= 0.
+	RetryAfterSeconds int `yaml:"retry-after-seconds" json:"retry-after-seconds"`
+}
+
+// GlobalRateLimit defines a token bucket applied to all API requests before a client is selected.
+type GlobalRateLimit struct {
+	// RequestsPerSecond is the average number of requests admitted per second. Requests
+	// beyond the limit are rejected with 429 and a Retry-After header. 0 disables the limit.
+	RequestsPerSecond float64 `yaml:"requests-per-second" json:"requests-per-second"`
+
+	// Burst is the number of requests that may be admitted at once. Defaults to
+	// requests-per-second rounded up when unset or < 1.
+	Burst int `yaml:"burst" json:"burst"`
 }
 
 // ClaudeKey represents the configuration for a Claude API key,
@@ -178,9 +775,38 @@ func LoadConfig(configFile string) (*Config, error) {
 	var config Config
 	// Set defaults before unmarshal so that absent keys keep defaults.
 	config.GeminiWeb.Context = true
+	config.RequestRetry = 3
+	config.SameAccountRetry = 1
+	config.RequestLogSampleRate = 1
+	config.MigrateAuthFiles = true
+	config.ContextSummarization.Model = "gemini-2.5-flash"
+	config.ContextSummarization.KeepRecentMessages = 6
+	config.DuplicateToolCallIDs = "rename"
+	config.UnsupportedPenalties = "omit"
+	config.StructuredOutput.OnFailure = "best"
+	config.StreamBuffer.MaxDelayMs = 250
+	config.ImageDownscale.MaxDimension = 2048
+	config.ImageDownscale.JPEGQuality = 85
+	config.IncludeThoughts = true
+	config.InvalidSamplingParams = "clamp"
+	config.StreamErrors = "finish"
+	config.FinishMessage = "field"
+	config.HealthCheck.HealthyInterval = 900
+	config.HealthCheck.FailingInterval = 60
+	config.HealthCheck.MaxBackoff = 1800
+	config.RequestCapture.Dir = "captures"
+	config.RequestDedup.WindowSeconds = 10
+	config.RequestDedup.MaxBufferedChunks = 2048
+	config.Onboarding.MaxConcurrent = 4
+	config.Onboarding.PollsPerMinute = 30
+	config.Onboarding.AutoSelectProject = true
+	config.QuotaExceeded.CooldownSeconds = 1800
 	if err = yaml.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
+	if err = applyEnvOverrides(&config); err != nil {
+		return nil, err
+	}
 
 	// Hash remote management key if plaintext is detected (nested)
 	// We consider a value to be already hashed if it looks like a bcrypt hash ($2a$, $2b$, or $2y$ prefix).
@@ -200,6 +826,40 @@ func LoadConfig(configFile string) (*Config, error) {
 	return &config, nil
 }
 
+// GetAPIKeySetting returns the settings configured for the given proxy API key.
+//
+// Parameters:
+//   - apiKey: The API key the request was authenticated with
+//
+// Returns:
+//   - *APIKeySetting: The matching settings, or nil if none are configured
+func (c *Config) GetAPIKeySetting(apiKey string) *APIKeySetting {
+	if apiKey == "" {
+		return nil
+	}
+	for i := range c.APIKeySettings {
+		if c.APIKeySettings[i].APIKey == apiKey {
+			return &c.APIKeySettings[i]
+		}
+	}
+	return nil
+}
+
+// ResponseLanguageFor returns the language responses to the given proxy API key must be in,
+// or an empty string if the language is not enforced.
+//
+// Parameters:
+//   - apiKey: The API key the request was authenticated with
+//
+// Returns:
+//   - string: The key's response-language, or response-language.language
+func (c *Config) ResponseLanguageFor(apiKey string) string {
+	if setting := c.GetAPIKeySetting(apiKey); setting != nil && setting.ResponseLanguage != "" {
+		return setting.ResponseLanguage
+	}
+	return c.ResponseLanguage.Language
+}
+
 // looksLikeBcrypt returns true if the provided string appears to be a bcrypt hash.
 func looksLikeBcrypt(s string) bool {
 	return len(s) > 4 && (s[:4] == "$2a$" || s[:4] == "$2b$" || s[:4] == "$2y$")
@@ -236,7 +896,8 @@ func SaveConfigPreserveComments(configFile string, cfg *Config) error {
 	}
 
 	// Marshal the current cfg to YAML, then unmarshal to a yaml.Node we can merge from.
-	rendered, err := yaml.Marshal(cfg)
+	// Settings that come from environment variables keep their file values.
+	rendered, err := yaml.Marshal(cfg.withFileValues())
 	if err != nil {
 		return err
 	}
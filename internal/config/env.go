@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Environment variables that override the values of the configuration file, for deployments
+// where mounting a file is awkward. A variable that is set, even to an empty string, takes
+// precedence over the file. The overridden values are never written to the file.
+const (
+	// EnvPort overrides port.
+	EnvPort = "CLIPROXY_PORT"
+
+	// EnvAuthDir overrides auth-dir.
+	EnvAuthDir = "CLIPROXY_AUTH_DIR"
+
+	// EnvAPIKeys overrides api-keys with a comma-separated list of keys.
+	EnvAPIKeys = "CLIPROXY_API_KEYS"
+
+	// EnvProxyURL overrides proxy-url.
+	EnvProxyURL = "CLIPROXY_PROXY_URL"
+)
+
+// envOverrides records the settings replaced by environment variables, with the values of
+// the file and of the environment.
+type envOverrides struct {
+	port, authDir, apiKeys, proxyURL bool
+
+	// file holds the file values of the overridden settings.
+	file Config
+
+	// env holds the environment values of the overridden settings.
+	env Config
+}
+
+// applyEnvOverrides replaces the values of the configuration file with those of the
+// environment variables that are set.
+//
+// Parameters:
+//   - config: The configuration parsed from the file
+//
+// Returns:
+//   - error: An error if a variable has an invalid value
+func applyEnvOverrides(config *Config) error {
+	overrides := &envOverrides{}
+	if value, ok := os.LookupEnv(EnvPort); ok {
+		port, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || port < 0 || port > 65535 {
+			return fmt.Errorf("invalid %s %q: must be a port number", EnvPort, value)
+		}
+		overrides.port, overrides.file.Port, overrides.env.Port = true, config.Port, port
+		config.Port = port
+	}
+	if value, ok := os.LookupEnv(EnvAuthDir); ok {
+		overrides.authDir, overrides.file.AuthDir, overrides.env.AuthDir = true, config.AuthDir, strings.TrimSpace(value)
+		config.AuthDir = overrides.env.AuthDir
+	}
+	if value, ok := os.LookupEnv(EnvAPIKeys); ok {
+		keys := make([]string, 0)
+		for _, key := range strings.Split(value, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				keys = append(keys, key)
+			}
+		}
+		overrides.apiKeys, overrides.file.APIKeys, overrides.env.APIKeys = true, config.APIKeys, keys
+		config.APIKeys = slices.Clone(keys)
+	}
+	if value, ok := os.LookupEnv(EnvProxyURL); ok {
+		overrides.proxyURL, overrides.file.ProxyURL, overrides.env.ProxyURL = true, config.ProxyURL, strings.TrimSpace(value)
+		config.ProxyURL = overrides.env.ProxyURL
+	}
+	if overrides.port || overrides.authDir || overrides.apiKeys || overrides.proxyURL {
+		config.envOverrides = overrides
+	}
+	return nil
+}
+
+// withFileValues returns a copy of the configuration to be written to the configuration
+// file. Settings that still have the value of their environment variable get their file
+// value back; settings changed since, for example through the management API, keep the
+// change.
+func (c *Config) withFileValues() *Config {
+	o := c.envOverrides
+	if o == nil {
+		return c
+	}
+	file := *c
+	if o.port && file.Port == o.env.Port {
+		file.Port = o.file.Port
+	}
+	if o.authDir && file.AuthDir == o.env.AuthDir {
+		file.AuthDir = o.file.AuthDir
+	}
+	if o.apiKeys && slices.Equal(file.APIKeys, o.env.APIKeys) {
+		file.APIKeys = o.file.APIKeys
+	}
+	if o.proxyURL && file.ProxyURL == o.env.ProxyURL {
+		file.ProxyURL = o.file.ProxyURL
+	}
+	return &file
+}
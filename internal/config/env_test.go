@@ -0,0 +1,113 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeConfigFile writes a configuration file and returns its path.
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+const envTestConfig = `port: 8317
+auth-dir: "/file/auth"
+api-keys:
+  - "file-key"
+proxy-url: ""
+debug: false
+`
+
+func TestEnvOverridesTakePrecedenceOverFile(t *testing.T) {
+	t.Setenv(EnvPort, "9000")
+	t.Setenv(EnvAuthDir, " /env/auth ")
+	t.Setenv(EnvAPIKeys, "env-key-1, ,env-key-2")
+	t.Setenv(EnvProxyURL, "socks5://127.0.0.1:1080")
+
+	cfg, err := LoadConfig(writeConfigFile(t, envTestConfig))
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.Port != 9000 {
+		t.Errorf("Port = %d, want 9000", cfg.Port)
+	}
+	if cfg.AuthDir != "/env/auth" {
+		t.Errorf("AuthDir = %q, want %q", cfg.AuthDir, "/env/auth")
+	}
+	if want := []string{"env-key-1", "env-key-2"}; !slices.Equal(cfg.APIKeys, want) {
+		t.Errorf("APIKeys = %v, want %v", cfg.APIKeys, want)
+	}
+	if cfg.ProxyURL != "socks5://127.0.0.1:1080" {
+		t.Errorf("ProxyURL = %q, want the environment value", cfg.ProxyURL)
+	}
+}
+
+func TestEnvOverridesUnsetKeepFileValues(t *testing.T) {
+	cfg, err := LoadConfig(writeConfigFile(t, envTestConfig))
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.Port != 8317 || cfg.AuthDir != "/file/auth" || !slices.Equal(cfg.APIKeys, []string{"file-key"}) {
+		t.Errorf("config = port %d, auth-dir %q, api-keys %v, want the file values", cfg.Port, cfg.AuthDir, cfg.APIKeys)
+	}
+}
+
+func TestEnvOverridesRejectInvalidPort(t *testing.T) {
+	for _, port := range []string{"http", "-1", "65536"} {
+		t.Setenv(EnvPort, port)
+		if _, err := LoadConfig(writeConfigFile(t, envTestConfig)); err == nil || !strings.Contains(err.Error(), EnvPort) {
+			t.Errorf("%s=%q: LoadConfig() error = %v, want an error naming %s", EnvPort, port, err, EnvPort)
+		}
+	}
+}
+
+func TestSavingConfigDoesNotWriteEnvValues(t *testing.T) {
+	t.Setenv(EnvPort, "9000")
+	t.Setenv(EnvAuthDir, "/env/auth")
+	t.Setenv(EnvAPIKeys, "env-secret-key")
+	t.Setenv(EnvProxyURL, "socks5://127.0.0.1:1080")
+	path := writeConfigFile(t, envTestConfig)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	// A management edit of an unrelated setting saves the configuration.
+	cfg.Debug = true
+	if err = SaveConfigPreserveComments(path, cfg); err != nil {
+		t.Fatalf("SaveConfigPreserveComments() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read config: %v", err)
+	}
+	saved := string(data)
+	for _, leaked := range []string{"9000", "/env/auth", "env-secret-key", "socks5://"} {
+		if strings.Contains(saved, leaked) {
+			t.Errorf("the saved config contains the environment value %q:\n%s", leaked, saved)
+		}
+	}
+	if !strings.Contains(saved, "debug: true") || !strings.Contains(saved, "file-key") {
+		t.Errorf("the saved config lost the edit or the file values:\n%s", saved)
+	}
+	if cfg.Port != 9000 || cfg.AuthDir != "/env/auth" {
+		t.Error("saving changed the running configuration")
+	}
+
+	// A setting changed through the management API is saved even if it was overridden.
+	cfg.APIKeys = []string{"managed-key"}
+	if err = SaveConfigPreserveComments(path, cfg); err != nil {
+		t.Fatalf("SaveConfigPreserveComments() error = %v", err)
+	}
+	if data, _ = os.ReadFile(path); !strings.Contains(string(data), "managed-key") {
+		t.Errorf("the changed api-keys were not saved:\n%s", data)
+	}
+}
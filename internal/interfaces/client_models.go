@@ -67,6 +67,10 @@ type Part struct {
 
 	// FunctionResponse represents the result of a tool execution.
 	FunctionResponse *FunctionResponse `json:"functionResponse,omitempty"`
+
+	// ThoughtSignature is the opaque signature Gemini attaches to function calls,
+	// which must be sent back unchanged in follow-up turns.
+	ThoughtSignature string `json:"thoughtSignature,omitempty"`
 }
 
 // InlineData represents base64-encoded data with its MIME type.
@@ -111,10 +115,22 @@ type GenerateContentRequest struct {
 	// Tools defines the available tools/functions that the model can call.
 	Tools []ToolDeclaration `json:"tools,omitempty"`
 
+	// SafetySettings sets the blocking threshold of harm categories.
+	SafetySettings []SafetySetting `json:"safetySettings,omitempty"`
+
 	// GenerationConfig contains parameters that control the model's generation behavior.
 	GenerationConfig `json:"generationConfig"`
 }
 
+// SafetySetting sets the threshold at which content of a harm category is blocked.
+type SafetySetting struct {
+	// Category is the harm category, e.g. "HARM_CATEGORY_HARASSMENT".
+	Category string `json:"category"`
+
+	// Threshold is the blocking threshold, e.g. "BLOCK_NONE" or "BLOCK_MEDIUM_AND_ABOVE".
+	Threshold string `json:"threshold"`
+}
+
 // GenerationConfig defines parameters that control the model's generation behavior.
 // These parameters affect the creativity, randomness, and reasoning of the model's responses.
 type GenerationConfig struct {
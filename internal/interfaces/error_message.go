@@ -17,4 +17,23 @@ type ErrorMessage struct {
 
 	// Addon contains additional headers to be added to the response.
 	Addon http.Header
+
+	// Upstream holds the parsed upstream error body. It is only populated in debug mode.
+	Upstream *UpstreamError
+}
+
+// UpstreamError is the structured form of a Google API error body,
+// e.g. {"error":{"code":429,"message":"...","status":"RESOURCE_EXHAUSTED","details":[...]}}.
+type UpstreamError struct {
+	// Code is the HTTP status code reported by the upstream API.
+	Code int `json:"code"`
+
+	// Status is the canonical status name, e.g. RESOURCE_EXHAUSTED.
+	Status string `json:"status"`
+
+	// Message is the human-readable error message.
+	Message string `json:"message"`
+
+	// Details is the raw JSON array of error details, if any.
+	Details string `json:"details,omitempty"`
 }
@@ -52,3 +52,53 @@ type TranslateResponse struct {
 	// NonStream handles non-streaming response translation.
 	NonStream TranslateResponseNonStreamFunc
 }
+
+// Translator converts requests from an inbound API format into a client's upstream
+// format and converts the upstream responses back. Implementations are registered
+// for a pair of formats with translator.RegisterTranslator.
+type Translator interface {
+	// ParseRequest converts an inbound request into the upstream request format,
+	// including its contents, tools, and generation config.
+	ParseRequest(modelName string, rawJSON []byte, stream bool) []byte
+
+	// FormatStream converts a single upstream stream chunk into zero or more chunks
+	// in the inbound format. The param pointer carries state between chunks.
+	FormatStream(ctx context.Context, modelName string, originalRequestRawJSON, requestRawJSON, rawJSON []byte, param *any) []string
+
+	// FormatResponse converts a complete upstream response into the inbound format.
+	FormatResponse(ctx context.Context, modelName string, originalRequestRawJSON, requestRawJSON, rawJSON []byte, param *any) string
+}
+
+// TranslatorFuncs adapts a request translation function and a TranslateResponse
+// to the Translator interface. Nil functions pass the data through unchanged.
+type TranslatorFuncs struct {
+	// Request handles request translation.
+	Request TranslateRequestFunc
+
+	// Response handles streaming and non-streaming response translation.
+	Response TranslateResponse
+}
+
+// ParseRequest implements Translator.
+func (t TranslatorFuncs) ParseRequest(modelName string, rawJSON []byte, stream bool) []byte {
+	if t.Request == nil {
+		return rawJSON
+	}
+	return t.Request(modelName, rawJSON, stream)
+}
+
+// FormatStream implements Translator.
+func (t TranslatorFuncs) FormatStream(ctx context.Context, modelName string, originalRequestRawJSON, requestRawJSON, rawJSON []byte, param *any) []string {
+	if t.Response.Stream == nil {
+		return []string{string(rawJSON)}
+	}
+	return t.Response.Stream(ctx, modelName, originalRequestRawJSON, requestRawJSON, rawJSON, param)
+}
+
+// FormatResponse implements Translator.
+func (t TranslatorFuncs) FormatResponse(ctx context.Context, modelName string, originalRequestRawJSON, requestRawJSON, rawJSON []byte, param *any) string {
+	if t.Response.NonStream == nil {
+		return string(rawJSON)
+	}
+	return t.Response.NonStream(ctx, modelName, originalRequestRawJSON, requestRawJSON, rawJSON, param)
+}
@@ -9,10 +9,13 @@ import (
 	"compress/gzip"
 	"fmt"
 	"io"
+	"math"
+	"math/rand/v2"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
@@ -56,6 +59,13 @@ type RequestLogger interface {
 	// Returns:
 	//   - bool: True if logging is enabled, false otherwise
 	IsEnabled() bool
+
+	// IsSampled decides whether a successful request is logged in full. Failed requests
+	// are logged regardless. It is called once per request.
+	//
+	// Returns:
+	//   - bool: True if the request is in the sample, false otherwise
+	IsSampled() bool
 }
 
 // StreamingLogWriter handles real-time logging of streaming response chunks.
@@ -92,6 +102,10 @@ type FileRequestLogger struct {
 
 	// logsDir is the directory where log files are stored.
 	logsDir string
+
+	// sampleRate holds the bits of the fraction of successful requests that are logged, as
+	// returned by math.Float64bits. It is updated on config reloads while requests read it.
+	sampleRate atomic.Uint64
 }
 
 // NewFileRequestLogger creates a new file-based request logger.
@@ -112,10 +126,12 @@ func NewFileRequestLogger(enabled bool, logsDir string, configDir string) *FileR
 			logsDir = filepath.Join(configDir, logsDir)
 		}
 	}
-	return &FileRequestLogger{
+	logger := &FileRequestLogger{
 		enabled: enabled,
 		logsDir: logsDir,
 	}
+	logger.SetSampleRate(1)
+	return logger
 }
 
 // IsEnabled returns whether request logging is currently enabled.
@@ -135,6 +151,30 @@ func (l *FileRequestLogger) SetEnabled(enabled bool) {
 	l.enabled = enabled
 }
 
+// SetSampleRate updates the fraction of successful requests that are logged.
+//
+// Parameters:
+//   - sampleRate: The fraction of requests to log, between 0 and 1
+func (l *FileRequestLogger) SetSampleRate(sampleRate float64) {
+	l.sampleRate.Store(math.Float64bits(sampleRate))
+}
+
+// IsSampled decides whether a successful request is logged in full. The decision is drawn at
+// random by the server, so clients cannot choose whether their requests are logged.
+//
+// Returns:
+//   - bool: True if the request is in the sample, false otherwise
+func (l *FileRequestLogger) IsSampled() bool {
+	rate := math.Float64frombits(l.sampleRate.Load())
+	if rate >= 1 {
+		return true
+	}
+	if rate <= 0 {
+		return false
+	}
+	return rand.Float64() < rate
+}
+
 // LogRequest logs a complete non-streaming request/response cycle to a file.
 //
 // Parameters:
@@ -334,6 +374,13 @@ func (l *FileRequestLogger) formatLogContent(url, method string, headers map[str
 	for i := 0; i < len(apiResponseErrors); i++ {
 		content.WriteString("=== API ERROR RESPONSE ===\n")
 		content.WriteString(fmt.Sprintf("HTTP Status: %d\n", apiResponseErrors[i].StatusCode))
+		if upstream := apiResponseErrors[i].Upstream; upstream != nil {
+			content.WriteString(fmt.Sprintf("Upstream Code: %d\n", upstream.Code))
+			content.WriteString(fmt.Sprintf("Upstream Status: %s\n", upstream.Status))
+			if upstream.Details != "" {
+				content.WriteString(fmt.Sprintf("Upstream Details: %s\n", upstream.Details))
+			}
+		}
 		content.WriteString(apiResponseErrors[i].Error.Error())
 		content.WriteString("\n\n")
 	}
@@ -0,0 +1,41 @@
+package logging
+
+import (
+	"math"
+	"testing"
+)
+
+func TestIsSampledHonorsSampleRate(t *testing.T) {
+	const draws = 100000
+	logger := NewFileRequestLogger(true, t.TempDir(), "")
+
+	for _, rate := range []float64{0, 0.01, 0.25, 0.5, 1} {
+		logger.SetSampleRate(rate)
+		sampled := 0
+		for i := 0; i < draws; i++ {
+			if logger.IsSampled() {
+				sampled++
+			}
+		}
+		// Allow five standard deviations of the binomial distribution.
+		got := float64(sampled) / draws
+		if tolerance := 5 * math.Sqrt(rate*(1-rate)/draws); math.Abs(got-rate) > tolerance {
+			t.Errorf("rate %v: sampled fraction = %v, want within %v", rate, got, tolerance)
+		}
+	}
+}
+
+func TestSetSampleRateWhileSampling(t *testing.T) {
+	logger := NewFileRequestLogger(true, t.TempDir(), "")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			logger.SetSampleRate(float64(i%2) / 2)
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		logger.IsSampled()
+	}
+	<-done
+}
@@ -0,0 +1,10 @@
+package metrics
+
+var (
+	// AccountRequests counts the API requests routed to each account, including requests
+	// that are retried on another account.
+	AccountRequests = NewCounterVec("cliproxy_account_requests_total", "API requests routed to each account.", "provider", "account")
+
+	// AccountErrors counts the failed upstream requests of each account by HTTP status code.
+	AccountErrors = NewCounterVec("cliproxy_account_errors_total", "Failed upstream requests of each account.", "provider", "account", "status")
+)
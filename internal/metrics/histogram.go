@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+)
+
+// LatencyBuckets are the default bucket upper bounds, in seconds, for latency histograms.
+var LatencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2, 4, 8, 16, 32, 64}
+
+// histogramValue holds the observations of a single label combination.
+type histogramValue struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// HistogramVec samples observations into configurable buckets, partitioned by a fixed set of labels.
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mutex  sync.Mutex
+	values map[string]*histogramValue
+}
+
+// NewHistogramVec creates a histogram with the given buckets and label names and
+// registers it so that it is included in Snapshot.
+//
+// Parameters:
+//   - name: The metric name
+//   - help: A short description of the metric
+//   - buckets: The bucket upper bounds, in increasing order
+//   - labels: The label names used to partition the histogram
+//
+// Returns:
+//   - *HistogramVec: The registered histogram
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+
+	h := &HistogramVec{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: sorted,
+		values:  make(map[string]*histogramValue),
+	}
+	register(h)
+	return h
+}
+
+// Observe records a single observation for the given label values.
+//
+// Parameters:
+//   - value: The observed value
+//   - labelValues: The label values, in the same order as the label names
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	key := joinLabels(h.labels, labelValues)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	v, ok := h.values[key]
+	if !ok {
+		v = &histogramValue{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = v
+	}
+	for i, upperBound := range h.buckets {
+		if value <= upperBound {
+			v.counts[i]++
+		}
+	}
+	v.count++
+	v.sum += value
+}
+
+// Count returns the number of observations recorded for the given label values.
+//
+// Parameters:
+//   - labelValues: The label values, in the same order as the label names
+//
+// Returns:
+//   - uint64: The number of observations
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	key := joinLabels(h.labels, labelValues)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if v, ok := h.values[key]; ok {
+		return v.count
+	}
+	return 0
+}
+
+// snapshot returns a point-in-time copy of the histogram.
+func (h *HistogramVec) snapshot() Family {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	keys := make([]string, 0, len(h.values))
+	for key := range h.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	samples := make([]Sample, 0, len(keys))
+	for _, key := range keys {
+		v := h.values[key]
+		buckets := make([]Bucket, len(h.buckets))
+		for i, upperBound := range h.buckets {
+			buckets[i] = Bucket{UpperBound: upperBound, Count: v.counts[i]}
+		}
+		var mean float64
+		if v.count > 0 {
+			mean = v.sum / float64(v.count)
+		}
+		samples = append(samples, Sample{
+			Labels:  splitLabels(h.labels, key),
+			Value:   mean,
+			Count:   v.count,
+			Sum:     v.sum,
+			Buckets: buckets,
+		})
+	}
+
+	return Family{Name: h.name, Help: h.help, Type: "histogram", Samples: samples}
+}
@@ -0,0 +1,16 @@
+package metrics
+
+var (
+	// ActiveRequests tracks the number of API requests currently being served.
+	ActiveRequests = NewGaugeVec("cliproxy_active_requests", "API requests currently in flight.")
+
+	// OverloadRejections counts API requests rejected because the server was overloaded.
+	OverloadRejections = NewCounterVec("cliproxy_overload_rejections_total", "API requests rejected with 503 due to overload.")
+
+	// RateLimitRejections counts API requests rejected by the global rate limit.
+	RateLimitRejections = NewCounterVec("cliproxy_rate_limit_rejections_total", "API requests rejected with 429 by the global rate limit.")
+
+	// DedupRequests counts API requests answered with the response of an identical request,
+	// labelled "coalesced" if that request was still in flight or "deduped" if it had completed.
+	DedupRequests = NewCounterVec("cliproxy_dedup_requests_total", "API requests served from an identical request.", "outcome")
+)
@@ -0,0 +1,274 @@
+// Package metrics provides lightweight, dependency-free counters and gauges used to
+// observe the behavior of the proxy and its upstream providers. Metrics are registered
+// once at package initialization and can be snapshotted at any time for export.
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// labelSeparator joins label values into a single map key. It is a control
+// character so it never collides with model names or account identifiers.
+const labelSeparator = "\x1f"
+
+// collector is implemented by every metric type that can be included in Snapshot.
+type collector interface {
+	snapshot() Family
+}
+
+var (
+	registryMutex sync.RWMutex
+	registered    = make([]collector, 0)
+)
+
+// register adds a metric to the set returned by Snapshot.
+func register(c collector) {
+	registryMutex.Lock()
+	registered = append(registered, c)
+	registryMutex.Unlock()
+}
+
+// Sample is a single labeled value of a metric.
+type Sample struct {
+	// Labels maps each label name to its value.
+	Labels map[string]string `json:"labels"`
+
+	// Value is the current value of the metric. For histograms it is the mean of all observations.
+	Value float64 `json:"value"`
+
+	// Count is the number of observations (histograms only).
+	Count uint64 `json:"count,omitempty"`
+
+	// Sum is the sum of all observations (histograms only).
+	Sum float64 `json:"sum,omitempty"`
+
+	// Buckets holds the cumulative bucket counts (histograms only).
+	Buckets []Bucket `json:"buckets,omitempty"`
+}
+
+// Bucket is a cumulative histogram bucket.
+type Bucket struct {
+	// UpperBound is the inclusive upper bound of the bucket.
+	UpperBound float64 `json:"le"`
+
+	// Count is the number of observations less than or equal to UpperBound.
+	Count uint64 `json:"count"`
+}
+
+// Family is a snapshot of a metric and all of its labeled samples.
+type Family struct {
+	// Name is the metric name.
+	Name string `json:"name"`
+
+	// Help describes what the metric measures.
+	Help string `json:"help"`
+
+	// Type is the metric type: "counter", "gauge", or "histogram".
+	Type string `json:"type"`
+
+	// Samples holds the labeled values of the metric.
+	Samples []Sample `json:"samples"`
+}
+
+// metricVec holds the labeled values shared by counters and gauges.
+type metricVec struct {
+	name       string
+	help       string
+	metricType string
+	labels     []string
+
+	mutex  sync.Mutex
+	values map[string]float64
+}
+
+// newMetricVec creates a metric and registers it so that it is included in Snapshot.
+func newMetricVec(name, help, metricType string, labels []string) *metricVec {
+	v := &metricVec{
+		name:       name,
+		help:       help,
+		metricType: metricType,
+		labels:     labels,
+		values:     make(map[string]float64),
+	}
+
+	register(v)
+	return v
+}
+
+// Value returns the current value identified by the given label values.
+//
+// Parameters:
+//   - labelValues: The label values, in the same order as the label names
+//
+// Returns:
+//   - float64: The current value, or 0 if it was never set
+func (v *metricVec) Value(labelValues ...string) float64 {
+	key := v.key(labelValues)
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return v.values[key]
+}
+
+// add adds delta to the value identified by the given label values.
+func (v *metricVec) add(delta float64, labelValues []string) {
+	key := v.key(labelValues)
+
+	v.mutex.Lock()
+	v.values[key] += delta
+	v.mutex.Unlock()
+}
+
+// set replaces the value identified by the given label values.
+func (v *metricVec) set(value float64, labelValues []string) {
+	key := v.key(labelValues)
+
+	v.mutex.Lock()
+	v.values[key] = value
+	v.mutex.Unlock()
+}
+
+// key normalizes label values to the configured label count and joins them.
+func (v *metricVec) key(labelValues []string) string {
+	return joinLabels(v.labels, labelValues)
+}
+
+// joinLabels normalizes label values to the number of label names and joins them.
+func joinLabels(labels, labelValues []string) string {
+	values := make([]string, len(labels))
+	copy(values, labelValues)
+	return strings.Join(values, labelSeparator)
+}
+
+// splitLabels maps a joined label key back to label names and values.
+func splitLabels(labels []string, key string) map[string]string {
+	values := strings.Split(key, labelSeparator)
+	result := make(map[string]string, len(labels))
+	for i, name := range labels {
+		if i < len(values) {
+			result[name] = values[i]
+		}
+	}
+	return result
+}
+
+// snapshot returns a point-in-time copy of the metric.
+func (v *metricVec) snapshot() Family {
+	v.mutex.Lock()
+	keys := make([]string, 0, len(v.values))
+	for key := range v.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	samples := make([]Sample, 0, len(keys))
+	for _, key := range keys {
+		samples = append(samples, Sample{Labels: splitLabels(v.labels, key), Value: v.values[key]})
+	}
+	v.mutex.Unlock()
+
+	return Family{Name: v.name, Help: v.help, Type: v.metricType, Samples: samples}
+}
+
+// CounterVec is a monotonically increasing counter partitioned by a fixed set of labels.
+type CounterVec struct {
+	*metricVec
+}
+
+// NewCounterVec creates a counter with the given label names and registers it
+// so that it is included in Snapshot.
+//
+// Parameters:
+//   - name: The metric name
+//   - help: A short description of the metric
+//   - labels: The label names used to partition the counter
+//
+// Returns:
+//   - *CounterVec: The registered counter
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{metricVec: newMetricVec(name, help, "counter", labels)}
+}
+
+// Inc increments the counter identified by the given label values by one.
+//
+// Parameters:
+//   - labelValues: The label values, in the same order as the label names
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.add(1, labelValues)
+}
+
+// Add increments the counter identified by the given label values by delta.
+// Negative deltas are ignored because counters never decrease.
+//
+// Parameters:
+//   - delta: The amount to add
+//   - labelValues: The label values, in the same order as the label names
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		return
+	}
+	c.add(delta, labelValues)
+}
+
+// Samples returns the current labeled values of the counter.
+//
+// Returns:
+//   - []Sample: The labeled values, ordered by label values
+func (c *CounterVec) Samples() []Sample {
+	return c.snapshot().Samples
+}
+
+// GaugeVec is a value that can go up and down, partitioned by a fixed set of labels.
+type GaugeVec struct {
+	*metricVec
+}
+
+// NewGaugeVec creates a gauge with the given label names and registers it
+// so that it is included in Snapshot.
+//
+// Parameters:
+//   - name: The metric name
+//   - help: A short description of the metric
+//   - labels: The label names used to partition the gauge
+//
+// Returns:
+//   - *GaugeVec: The registered gauge
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{metricVec: newMetricVec(name, help, "gauge", labels)}
+}
+
+// Set replaces the gauge identified by the given label values.
+//
+// Parameters:
+//   - value: The new value
+//   - labelValues: The label values, in the same order as the label names
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.set(value, labelValues)
+}
+
+// Add adds delta, which may be negative, to the gauge identified by the given label values.
+//
+// Parameters:
+//   - delta: The amount to add
+//   - labelValues: The label values, in the same order as the label names
+func (g *GaugeVec) Add(delta float64, labelValues ...string) {
+	g.add(delta, labelValues)
+}
+
+// Snapshot returns the current state of all registered metrics, ordered by name.
+//
+// Returns:
+//   - []Family: The registered metrics and their samples
+func Snapshot() []Family {
+	registryMutex.RLock()
+	families := make([]Family, 0, len(registered))
+	for _, c := range registered {
+		families = append(families, c.snapshot())
+	}
+	registryMutex.RUnlock()
+
+	sort.Slice(families, func(i, j int) bool { return families[i].Name < families[j].Name })
+	return families
+}
@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PrometheusContentType is the content type of the Prometheus text exposition format.
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// WritePrometheus writes metric families in the Prometheus text exposition format.
+// Histograms are written as cumulative _bucket series with a final +Inf bucket, followed
+// by their _sum and _count.
+//
+// Parameters:
+//   - w: The writer to write to
+//   - families: The metric families, usually from Snapshot
+//
+// Returns:
+//   - error: An error if writing fails
+func WritePrometheus(w io.Writer, families []Family) error {
+	out := bufio.NewWriter(w)
+	for _, family := range families {
+		_, _ = fmt.Fprintf(out, "# HELP %s %s\n", family.Name, escapeHelp(family.Help))
+		_, _ = fmt.Fprintf(out, "# TYPE %s %s\n", family.Name, family.Type)
+		for _, sample := range family.Samples {
+			if family.Type != "histogram" {
+				writeSample(out, family.Name, sample.Labels, "", "", sample.Value)
+				continue
+			}
+			for _, bucket := range sample.Buckets {
+				writeSample(out, family.Name+"_bucket", sample.Labels, "le", formatValue(bucket.UpperBound), float64(bucket.Count))
+			}
+			writeSample(out, family.Name+"_bucket", sample.Labels, "le", "+Inf", float64(sample.Count))
+			writeSample(out, family.Name+"_sum", sample.Labels, "", "", sample.Sum)
+			writeSample(out, family.Name+"_count", sample.Labels, "", "", float64(sample.Count))
+		}
+	}
+	return out.Flush()
+}
+
+// writeSample writes a single series line, with an optional extra label.
+func writeSample(out *bufio.Writer, name string, labels map[string]string, extraName, extraValue string, value float64) {
+	names := make([]string, 0, len(labels))
+	for labelName := range labels {
+		names = append(names, labelName)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names)+1)
+	for _, labelName := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", labelName, escapeLabel(labels[labelName])))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", extraName, extraValue))
+	}
+
+	_, _ = out.WriteString(name)
+	if len(pairs) > 0 {
+		_, _ = out.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	_, _ = out.WriteString(" " + formatValue(value) + "\n")
+}
+
+// formatValue formats a sample value as Prometheus expects it.
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// escapeHelp escapes backslashes and line feeds in help text.
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+// escapeLabel replaces characters that %q would escape differently from Prometheus. Label
+// values are quoted with %q, which already escapes backslashes, quotes, and line feeds; other
+// control characters are dropped.
+func escapeLabel(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\n' {
+			return -1
+		}
+		return r
+	}, value)
+}
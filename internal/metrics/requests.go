@@ -0,0 +1,16 @@
+package metrics
+
+var (
+	// Requests counts the API requests served, by requested model and HTTP status.
+	Requests = NewCounterVec("cliproxy_requests_total", "API requests by model and HTTP status.", "model", "status")
+
+	// ActiveStreams tracks the streaming responses currently being sent to clients.
+	ActiveStreams = NewGaugeVec("cliproxy_active_streams", "Streaming responses currently being sent.")
+
+	// UpstreamLatency observes the time from sending an upstream request to receiving its
+	// response headers, by upstream host.
+	UpstreamLatency = NewHistogramVec("cliproxy_upstream_latency_seconds", "Time from sending an upstream request to its response headers.", LatencyBuckets, "host")
+
+	// QuotaExceeded counts the times a model was newly marked as quota exceeded on an account.
+	QuotaExceeded = NewCounterVec("cliproxy_quota_exceeded_total", "Models newly marked as quota exceeded on an account.", "model")
+)
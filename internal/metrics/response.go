@@ -0,0 +1,19 @@
+package metrics
+
+var (
+	// EmptyResponses counts upstream responses that carried no text, thought, or tool call parts.
+	EmptyResponses = NewCounterVec("cliproxy_empty_responses_total", "Upstream responses that contained no content.", "model", "account")
+
+	// SafetyBlocks counts responses blocked by upstream safety filters, either via
+	// promptFeedback.blockReason or a SAFETY/PROHIBITED_CONTENT/BLOCKLIST finish reason.
+	SafetyBlocks = NewCounterVec("cliproxy_safety_blocks_total", "Upstream responses blocked by safety filters.", "model", "account")
+
+	// Truncations counts responses that stopped because they reached the output token limit.
+	Truncations = NewCounterVec("cliproxy_max_tokens_truncations_total", "Upstream responses truncated by MAX_TOKENS.", "model", "account")
+
+	// MalformedToolCalls counts responses whose function calls could not be used.
+	MalformedToolCalls = NewCounterVec("cliproxy_malformed_tool_calls_total", "Upstream responses with malformed tool calls.", "model", "account")
+
+	// FirstTokenLatency observes the time from the start of a streaming request to the first content chunk.
+	FirstTokenLatency = NewHistogramVec("cliproxy_first_token_latency_seconds", "Time from request start to the first streamed content chunk.", LatencyBuckets, "model")
+)
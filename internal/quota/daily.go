@@ -0,0 +1,215 @@
+// Package quota tracks request-count based quotas that upstream providers enforce per
+// account and model. Counters follow Google's daily quota window, which resets at
+// midnight Pacific time, and are persisted so that restarts do not reset them.
+package quota
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// flushDelay is how long increments are batched before counters are written to disk.
+const flushDelay = 5 * time.Second
+
+// pacific is the time zone of Google's daily quota window.
+var pacific = loadPacific()
+
+// loadPacific loads the America/Los_Angeles zone, falling back to a fixed UTC-8 offset
+// when the system has no time zone database.
+func loadPacific() *time.Location {
+	location, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		return time.FixedZone("PST", -8*60*60)
+	}
+	return location
+}
+
+// NextReset returns when the daily quota window following t begins, at midnight Pacific time.
+func NextReset(t time.Time) time.Time {
+	local := t.In(pacific)
+	return time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, pacific)
+}
+
+// dailyState is the persisted form of the counters.
+type dailyState struct {
+	// Day is the quota window the counts belong to, formatted as YYYY-MM-DD in Pacific time.
+	Day string `json:"day"`
+
+	// Counts maps account -> model -> number of requests.
+	Counts map[string]map[string]int `json:"counts"`
+}
+
+// DailyRequestCounter counts requests per account and model within the current daily quota window.
+type DailyRequestCounter struct {
+	mutex   sync.Mutex
+	state   dailyState
+	path    string
+	pending bool
+	now     func() time.Time
+}
+
+var (
+	globalDailyCounter     *DailyRequestCounter
+	globalDailyCounterOnce sync.Once
+)
+
+// GetDailyRequestCounter returns the global daily request counter instance.
+func GetDailyRequestCounter() *DailyRequestCounter {
+	globalDailyCounterOnce.Do(func() {
+		globalDailyCounter = NewDailyRequestCounter()
+	})
+	return globalDailyCounter
+}
+
+// NewDailyRequestCounter creates an in-memory counter. Call SetPersistencePath to persist it.
+//
+// Returns:
+//   - *DailyRequestCounter: A new counter
+func NewDailyRequestCounter() *DailyRequestCounter {
+	return &DailyRequestCounter{
+		state: dailyState{Counts: make(map[string]map[string]int)},
+		now:   time.Now,
+	}
+}
+
+// SetPersistencePath sets the file the counters are persisted to and loads any
+// counters previously saved there for the current quota window.
+//
+// Parameters:
+//   - path: The file path used to persist counters
+func (d *DailyRequestCounter) SetPersistencePath(path string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.path = path
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("failed to read daily request counters from %s: %v", path, err)
+		}
+		return
+	}
+
+	var state dailyState
+	if err = json.Unmarshal(data, &state); err != nil {
+		log.Warnf("failed to parse daily request counters from %s: %v", path, err)
+		return
+	}
+	if state.Counts == nil {
+		state.Counts = make(map[string]map[string]int)
+	}
+	d.state = state
+	d.rollover()
+}
+
+// Increment records a request for the given account and model.
+//
+// Parameters:
+//   - account: The account identifier
+//   - model: The model name
+//
+// Returns:
+//   - int: The number of requests recorded in the current window, including this one
+func (d *DailyRequestCounter) Increment(account, model string) int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.rollover()
+	models, ok := d.state.Counts[account]
+	if !ok {
+		models = make(map[string]int)
+		d.state.Counts[account] = models
+	}
+	models[model]++
+	d.scheduleFlush()
+	return models[model]
+}
+
+// Count returns the number of requests recorded for the given account and model
+// in the current quota window.
+//
+// Parameters:
+//   - account: The account identifier
+//   - model: The model name
+//
+// Returns:
+//   - int: The number of requests
+func (d *DailyRequestCounter) Count(account, model string) int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.rollover()
+	return d.state.Counts[account][model]
+}
+
+// LimitReached reports whether the account has reached limit requests for the model
+// in the current quota window. A limit of zero or less never triggers.
+//
+// Parameters:
+//   - account: The account identifier
+//   - model: The model name
+//   - limit: The soft cap
+//
+// Returns:
+//   - bool: True if the cap has been reached
+func (d *DailyRequestCounter) LimitReached(account, model string, limit int) bool {
+	if limit <= 0 {
+		return false
+	}
+	return d.Count(account, model) >= limit
+}
+
+// Flush writes the counters to disk immediately.
+func (d *DailyRequestCounter) Flush() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.save()
+}
+
+// rollover resets the counters when the quota window has changed. Callers must hold the mutex.
+func (d *DailyRequestCounter) rollover() {
+	day := d.now().In(pacific).Format("2006-01-02")
+	if d.state.Day == day {
+		return
+	}
+	if d.state.Day != "" {
+		log.Debugf("daily request counters reset for quota window %s", day)
+	}
+	d.state.Day = day
+	d.state.Counts = make(map[string]map[string]int)
+}
+
+// scheduleFlush arranges for the counters to be saved shortly. Callers must hold the mutex.
+func (d *DailyRequestCounter) scheduleFlush() {
+	if d.path == "" || d.pending {
+		return
+	}
+	d.pending = true
+	time.AfterFunc(flushDelay, d.Flush)
+}
+
+// save writes the counters to disk. Callers must hold the mutex.
+func (d *DailyRequestCounter) save() {
+	d.pending = false
+	if d.path == "" {
+		return
+	}
+
+	data, err := json.Marshal(d.state)
+	if err != nil {
+		log.Warnf("failed to encode daily request counters: %v", err)
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(d.path), 0700); err != nil {
+		log.Warnf("failed to create directory for daily request counters: %v", err)
+		return
+	}
+	if err = os.WriteFile(d.path, data, 0600); err != nil {
+		log.Warnf("failed to save daily request counters to %s: %v", d.path, err)
+	}
+}
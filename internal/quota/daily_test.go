@@ -0,0 +1,90 @@
+package quota
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNextReset(t *testing.T) {
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Time
+	}{
+		{
+			name: "winter, before UTC midnight",
+			now:  time.Date(2025, 1, 15, 20, 0, 0, 0, time.UTC),
+			want: time.Date(2025, 1, 16, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "winter, after UTC midnight but before Pacific midnight",
+			now:  time.Date(2025, 1, 16, 3, 0, 0, 0, time.UTC),
+			want: time.Date(2025, 1, 16, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "summer",
+			now:  time.Date(2025, 7, 15, 12, 0, 0, 0, time.UTC),
+			want: time.Date(2025, 7, 16, 7, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NextReset(tt.now); !got.Equal(tt.want) {
+				t.Errorf("NextReset(%v) = %v, want %v", tt.now, got.UTC(), tt.want)
+			}
+		})
+	}
+}
+
+func TestDailyRequestCounterResetsAtPacificMidnight(t *testing.T) {
+	now := time.Date(2025, 1, 16, 7, 0, 0, 0, time.UTC) // 23:00 Pacific
+	counter := NewDailyRequestCounter()
+	counter.now = func() time.Time { return now }
+
+	counter.Increment("account", "gemini-2.5-pro")
+	if got := counter.Increment("account", "gemini-2.5-pro"); got != 2 {
+		t.Fatalf("Increment() = %d, want 2", got)
+	}
+	if got := counter.Count("account", "gemini-2.5-flash"); got != 0 {
+		t.Errorf("Count() of another model = %d, want 0", got)
+	}
+	if !counter.LimitReached("account", "gemini-2.5-pro", 2) {
+		t.Error("LimitReached() = false at the cap")
+	}
+	if counter.LimitReached("account", "gemini-2.5-pro", 0) {
+		t.Error("LimitReached() = true without a cap")
+	}
+
+	now = now.Add(2 * time.Hour) // 01:00 Pacific the next day
+	if got := counter.Count("account", "gemini-2.5-pro"); got != 0 {
+		t.Errorf("Count() after midnight Pacific = %d, want 0", got)
+	}
+}
+
+func TestDailyRequestCounterPersistsCurrentWindow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "daily.json")
+	now := time.Date(2025, 1, 15, 20, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	counter := NewDailyRequestCounter()
+	counter.now = clock
+	counter.SetPersistencePath(path)
+	counter.Increment("account", "gemini-2.5-pro")
+	counter.Flush()
+
+	restarted := NewDailyRequestCounter()
+	restarted.now = clock
+	restarted.SetPersistencePath(path)
+	if got := restarted.Count("account", "gemini-2.5-pro"); got != 1 {
+		t.Errorf("Count() after restart = %d, want 1", got)
+	}
+
+	now = now.Add(24 * time.Hour)
+	nextDay := NewDailyRequestCounter()
+	nextDay.now = clock
+	nextDay.SetPersistencePath(path)
+	if got := nextDay.Count("account", "gemini-2.5-pro"); got != 0 {
+		t.Errorf("Count() after restart on the next day = %d, want 0", got)
+	}
+}
@@ -0,0 +1,89 @@
+package registry
+
+import "slices"
+
+// Model capabilities used to filter the models list.
+const (
+	// CapabilityChat marks models that generate chat or text completions.
+	CapabilityChat = "chat"
+	// CapabilityTools marks models that support function calling.
+	CapabilityTools = "tools"
+	// CapabilityVision marks models that accept image input.
+	CapabilityVision = "vision"
+	// CapabilityReasoning marks models that can produce reasoning output.
+	CapabilityReasoning = "reasoning"
+	// CapabilityEmbeddings marks models that produce embeddings.
+	CapabilityEmbeddings = "embeddings"
+	// CapabilityPenalties marks Gemini models that accept presencePenalty and frequencyPenalty.
+	// No built-in Gemini model has it; models can declare it with ModelInfo.Capabilities.
+	CapabilityPenalties = "penalties"
+)
+
+// typeCapabilities lists the default capabilities of each model type. Models can override
+// them with ModelInfo.Capabilities.
+var typeCapabilities = map[string][]string{
+	"gemini": {CapabilityChat, CapabilityTools, CapabilityVision, CapabilityReasoning},
+	"claude": {CapabilityChat, CapabilityTools, CapabilityVision, CapabilityReasoning},
+	"openai": {CapabilityChat, CapabilityTools, CapabilityVision, CapabilityReasoning},
+	"qwen":   {CapabilityChat, CapabilityTools},
+}
+
+// ModelCapabilities returns the capabilities of a model. Explicit capabilities take precedence
+// over the defaults of the model type. For models that list their generation methods, chat
+// capabilities require generateContent and embeddings require embedContent.
+//
+// Parameters:
+//   - model: The model to inspect
+//
+// Returns:
+//   - []string: The capabilities of the model
+func ModelCapabilities(model *ModelInfo) []string {
+	if len(model.Capabilities) > 0 {
+		return model.Capabilities
+	}
+
+	capabilities := typeCapabilities[model.Type]
+	if len(model.SupportedGenerationMethods) == 0 {
+		return capabilities
+	}
+
+	result := make([]string, 0, len(capabilities)+1)
+	if slices.Contains(model.SupportedGenerationMethods, "generateContent") {
+		result = append(result, capabilities...)
+	}
+	if slices.Contains(model.SupportedGenerationMethods, "embedContent") {
+		result = append(result, CapabilityEmbeddings)
+	}
+	return result
+}
+
+// hasCapabilities reports whether a model has all of the given capabilities.
+func hasCapabilities(model *ModelInfo, capabilities []string) bool {
+	modelCapabilities := ModelCapabilities(model)
+	for _, capability := range capabilities {
+		if !slices.Contains(modelCapabilities, capability) {
+			return false
+		}
+	}
+	return true
+}
+
+// ModelHasCapability reports whether a registered model has a capability. Models that are
+// not registered are assumed to have it, since nothing is known about them.
+//
+// Parameters:
+//   - modelID: The model to check
+//   - capability: The capability to look for
+//
+// Returns:
+//   - bool: True if the model has the capability or is not registered
+func (r *ModelRegistry) ModelHasCapability(modelID, capability string) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	registration, exists := r.models[modelID]
+	if !exists || registration.Info == nil {
+		return true
+	}
+	return hasCapabilities(registration.Info, []string{capability})
+}
@@ -0,0 +1,74 @@
+package registry
+
+import (
+	"slices"
+	"sync"
+	"testing"
+)
+
+// newTestRegistry returns an empty registry that does not share state with the global one.
+func newTestRegistry() *ModelRegistry {
+	return &ModelRegistry{
+		models:          make(map[string]*ModelRegistration),
+		clientModels:    make(map[string][]string),
+		clientProviders: make(map[string]string),
+		mutex:           &sync.RWMutex{},
+	}
+}
+
+func TestGetAvailableModelsFiltersByCapability(t *testing.T) {
+	r := newTestRegistry()
+	r.RegisterClient("client", "gemini", []*ModelInfo{
+		{ID: "gemini-2.5-pro", Type: "gemini"},
+		{ID: "text-embedding-004", Type: "gemini", SupportedGenerationMethods: []string{"embedContent"}},
+		{ID: "chat-only", Type: "openai", Capabilities: []string{CapabilityChat}},
+		{ID: "qwen3-coder-plus", Type: "qwen"},
+	})
+
+	tests := []struct {
+		name         string
+		capabilities []string
+		want         []string
+	}{
+		{name: "no filter", want: []string{"chat-only", "gemini-2.5-pro", "qwen3-coder-plus", "text-embedding-004"}},
+		{name: "tools", capabilities: []string{CapabilityTools}, want: []string{"gemini-2.5-pro", "qwen3-coder-plus"}},
+		{name: "tools and vision", capabilities: []string{CapabilityTools, CapabilityVision}, want: []string{"gemini-2.5-pro"}},
+		{name: "embeddings", capabilities: []string{CapabilityEmbeddings}, want: []string{"text-embedding-004"}},
+		{name: "unknown capability", capabilities: []string{"telepathy"}, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := make([]string, 0)
+			for _, model := range r.GetAvailableModels("openai", tt.capabilities...) {
+				ids = append(ids, model["id"].(string))
+			}
+			slices.Sort(ids)
+			if !slices.Equal(ids, tt.want) {
+				t.Errorf("models = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestModelHasCapability(t *testing.T) {
+	r := newTestRegistry()
+	r.RegisterClient("client", "openai", []*ModelInfo{{ID: "chat-only", Type: "openai", Capabilities: []string{CapabilityChat}}})
+
+	tests := []struct {
+		name       string
+		model      string
+		capability string
+		want       bool
+	}{
+		{name: "declared capability", model: "chat-only", capability: CapabilityChat, want: true},
+		{name: "missing capability", model: "chat-only", capability: CapabilityTools, want: false},
+		{name: "unregistered model", model: "unknown", capability: CapabilityTools, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.ModelHasCapability(tt.model, tt.capability); got != tt.want {
+				t.Errorf("ModelHasCapability(%q, %q) = %t, want %t", tt.model, tt.capability, got, tt.want)
+			}
+		})
+	}
+}
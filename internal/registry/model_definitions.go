@@ -279,6 +279,7 @@ func GetOpenAIModels() []*ModelInfo {
 			ContextLength:       4096,
 			MaxCompletionTokens: 2048,
 			SupportedParameters: []string{"temperature", "max_tokens", "stream", "stop"},
+			Capabilities:        []string{CapabilityChat},
 		},
 	}
 }
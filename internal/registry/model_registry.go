@@ -4,6 +4,9 @@
 package registry
 
 import (
+	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -42,6 +45,8 @@ type ModelInfo struct {
 	MaxCompletionTokens int `json:"max_completion_tokens,omitempty"`
 	// SupportedParameters lists supported parameters
 	SupportedParameters []string `json:"supported_parameters,omitempty"`
+	// Capabilities overrides the default capabilities of the model type (see ModelCapabilities)
+	Capabilities []string `json:"capabilities,omitempty"`
 }
 
 // ModelRegistration tracks a model's availability
@@ -54,6 +59,8 @@ type ModelRegistration struct {
 	LastUpdated time.Time
 	// QuotaExceededClients tracks which clients have exceeded quota for this model
 	QuotaExceededClients map[string]*time.Time
+	// Providers counts the active clients that provide this model per provider
+	Providers map[string]int
 }
 
 // ModelRegistry manages the global registry of available models
@@ -62,6 +69,8 @@ type ModelRegistry struct {
 	models map[string]*ModelRegistration
 	// clientModels maps client ID to the models it provides
 	clientModels map[string][]string
+	// clientProviders maps client ID to its provider name
+	clientProviders map[string]string
 	// mutex ensures thread-safe access to the registry
 	mutex *sync.RWMutex
 }
@@ -74,9 +83,10 @@ var registryOnce sync.Once
 func GetGlobalRegistry() *ModelRegistry {
 	registryOnce.Do(func() {
 		globalRegistry = &ModelRegistry{
-			models:       make(map[string]*ModelRegistration),
-			clientModels: make(map[string][]string),
-			mutex:        &sync.RWMutex{},
+			models:          make(map[string]*ModelRegistration),
+			clientModels:    make(map[string][]string),
+			clientProviders: make(map[string]string),
+			mutex:           &sync.RWMutex{},
 		}
 	})
 	return globalRegistry
@@ -103,6 +113,7 @@ func (r *ModelRegistry) RegisterClient(clientID, clientProvider string, models [
 		if existing, exists := r.models[model.ID]; exists {
 			// Model already exists, increment count
 			existing.Count++
+			existing.Providers[clientProvider]++
 			existing.LastUpdated = now
 			log.Debugf("Incremented count for model %s, now %d clients", model.ID, existing.Count)
 		} else {
@@ -112,12 +123,14 @@ func (r *ModelRegistry) RegisterClient(clientID, clientProvider string, models [
 				Count:                1,
 				LastUpdated:          now,
 				QuotaExceededClients: make(map[string]*time.Time),
+				Providers:            map[string]int{clientProvider: 1},
 			}
 			log.Debugf("Registered new model %s from provider %s", model.ID, clientProvider)
 		}
 	}
 
 	r.clientModels[clientID] = modelIDs
+	r.clientProviders[clientID] = clientProvider
 	log.Debugf("Registered client %s from provider %s with %d models", clientID, clientProvider, len(models))
 }
 
@@ -142,6 +155,11 @@ func (r *ModelRegistry) unregisterClientInternal(clientID string) {
 		if registration, isExists := r.models[modelID]; isExists {
 			registration.Count--
 			registration.LastUpdated = now
+			if provider := r.clientProviders[clientID]; registration.Providers[provider] > 1 {
+				registration.Providers[provider]--
+			} else {
+				delete(registration.Providers, provider)
+			}
 
 			// Remove quota tracking for this client
 			delete(registration.QuotaExceededClients, clientID)
@@ -157,6 +175,7 @@ func (r *ModelRegistry) unregisterClientInternal(clientID string) {
 	}
 
 	delete(r.clientModels, clientID)
+	delete(r.clientProviders, clientID)
 	log.Debugf("Unregistered client %s", clientID)
 }
 
@@ -189,13 +208,36 @@ func (r *ModelRegistry) ClearModelQuotaExceeded(clientID, modelID string) {
 	}
 }
 
+// GetQuotaExceededModels returns the models for which a client is currently in quota cooldown
+// Parameters:
+//   - clientID: The client to check
+//
+// Returns:
+//   - []string: Sorted IDs of the models whose quota the client exceeded
+func (r *ModelRegistry) GetQuotaExceededModels(clientID string) []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	models := make([]string, 0)
+	quotaExpiredDuration := 5 * time.Minute
+	now := time.Now()
+	for modelID, registration := range r.models {
+		if quotaTime := registration.QuotaExceededClients[clientID]; quotaTime != nil && now.Sub(*quotaTime) < quotaExpiredDuration {
+			models = append(models, modelID)
+		}
+	}
+	sort.Strings(models)
+	return models
+}
+
 // GetAvailableModels returns all models that have at least one available client
 // Parameters:
 //   - handlerType: The handler type to filter models for (e.g., "openai", "claude", "gemini")
+//   - capabilities: Optional capabilities (e.g., "tools") that every returned model must have
 //
 // Returns:
 //   - []map[string]any: List of available models in the requested format
-func (r *ModelRegistry) GetAvailableModels(handlerType string) []map[string]any {
+func (r *ModelRegistry) GetAvailableModels(handlerType string, capabilities ...string) []map[string]any {
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
 
@@ -217,8 +259,8 @@ func (r *ModelRegistry) GetAvailableModels(handlerType string) []map[string]any
 
 		effectiveClients := availableClients - expiredClients
 
-		// Only include models that have available clients
-		if effectiveClients > 0 {
+		// Only include models that have available clients and the requested capabilities
+		if effectiveClients > 0 && hasCapabilities(registration.Info, capabilities) {
 			model := r.convertModelToMap(registration.Info, handlerType)
 			if model != nil {
 				models = append(models, model)
@@ -229,6 +271,82 @@ func (r *ModelRegistry) GetAvailableModels(handlerType string) []map[string]any
 	return models
 }
 
+// GetModelsWithAvailability returns every registered model with the requested capabilities,
+// including models whose clients are all in quota cooldown. Each model carries two fields in
+// addition to those of GetAvailableModels: "quota_exceeded", true if every client that provides
+// the model is in quota cooldown, and "providers", the sorted providers of its clients (e.g.
+// "gemini" for Generative Language API keys, "gemini-cli" for Code Assist accounts).
+//
+// Parameters:
+//   - handlerType: The handler type to format models for (e.g., "openai", "claude", "gemini")
+//   - capabilities: Optional capabilities (e.g., "tools") that every returned model must have
+//
+// Returns:
+//   - []map[string]any: List of models in the requested format
+func (r *ModelRegistry) GetModelsWithAvailability(handlerType string, capabilities ...string) []map[string]any {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	models := make([]map[string]any, 0)
+	quotaExpiredDuration := 5 * time.Minute
+	now := time.Now()
+
+	for _, registration := range r.models {
+		if registration.Count <= 0 || !hasCapabilities(registration.Info, capabilities) {
+			continue
+		}
+		model := r.convertModelToMap(registration.Info, handlerType)
+		if model == nil {
+			continue
+		}
+
+		expiredClients := 0
+		for _, quotaTime := range registration.QuotaExceededClients {
+			if quotaTime != nil && now.Sub(*quotaTime) < quotaExpiredDuration {
+				expiredClients++
+			}
+		}
+		providers := make([]string, 0, len(registration.Providers))
+		for provider := range registration.Providers {
+			providers = append(providers, provider)
+		}
+		sort.Strings(providers)
+
+		model["quota_exceeded"] = registration.Count-expiredClients <= 0
+		model["providers"] = providers
+		models = append(models, model)
+	}
+
+	sort.Slice(models, func(i, j int) bool {
+		return fmt.Sprint(models[i]["id"]) < fmt.Sprint(models[j]["id"])
+	})
+	return models
+}
+
+// ResolveModelID returns the canonical ID of a registered model whose ID matches the given
+// name case-insensitively, so that "Gemini-2.5-Flash" resolves to "gemini-2.5-flash".
+// Names that match a model exactly, or no model at all, are returned unchanged.
+//
+// Parameters:
+//   - name: The model name sent by the client
+//
+// Returns:
+//   - string: The canonical model ID
+func (r *ModelRegistry) ResolveModelID(name string) string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if _, exists := r.models[name]; exists {
+		return name
+	}
+	for modelID := range r.models {
+		if strings.EqualFold(modelID, name) {
+			return modelID
+		}
+	}
+	return name
+}
+
 // GetModelCount returns the number of available clients for a specific model
 // Parameters:
 //   - modelID: The model ID to check
@@ -0,0 +1,29 @@
+package registry
+
+import "testing"
+
+func TestResolveModelID(t *testing.T) {
+	r := newTestRegistry()
+	r.RegisterClient("client", "gemini", []*ModelInfo{
+		{ID: "gemini-2.5-flash", Type: "gemini"},
+		{ID: "Gemini-Exp", Type: "gemini"},
+	})
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "gemini-2.5-flash", want: "gemini-2.5-flash"},
+		{name: "Gemini-2.5-Flash", want: "gemini-2.5-flash"},
+		{name: "GEMINI-2.5-FLASH", want: "gemini-2.5-flash"},
+		{name: "gemini-exp", want: "Gemini-Exp"},
+		{name: "Gemini-2.5-Pro", want: "Gemini-2.5-Pro"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.ResolveModelID(tt.name); got != tt.want {
+				t.Errorf("ResolveModelID(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
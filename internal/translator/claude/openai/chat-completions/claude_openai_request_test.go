@@ -0,0 +1,27 @@
+package chat_completions
+
+import (
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestMaxCompletionTokensMapping(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int64
+	}{
+		{name: "max_completion_tokens", body: `{"max_completion_tokens":512}`, want: 512},
+		{name: "max_tokens", body: `{"max_tokens":256}`, want: 256},
+		{name: "max_completion_tokens takes precedence", body: `{"max_tokens":256,"max_completion_tokens":512}`, want: 512},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := ConvertOpenAIRequestToClaude("claude-sonnet-4", []byte(tt.body), false)
+			if got := gjson.GetBytes(out, "max_tokens").Int(); got != tt.want {
+				t.Errorf("max_tokens = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
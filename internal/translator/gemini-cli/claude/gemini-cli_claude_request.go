@@ -52,22 +52,8 @@ func ConvertClaudeRequestToCLI(modelName string, inputRawJSON []byte, _ bool) []
 
 	// system instruction
 	var systemInstruction *client.Content
-	systemResult := gjson.GetBytes(rawJSON, "system")
-	if systemResult.IsArray() {
-		systemResults := systemResult.Array()
-		systemInstruction = &client.Content{Role: "user", Parts: []client.Part{}}
-		for i := 0; i < len(systemResults); i++ {
-			systemPromptResult := systemResults[i]
-			systemTypePromptResult := systemPromptResult.Get("type")
-			if systemTypePromptResult.Type == gjson.String && systemTypePromptResult.String() == "text" {
-				systemPrompt := systemPromptResult.Get("text").String()
-				systemPart := client.Part{Text: systemPrompt}
-				systemInstruction.Parts = append(systemInstruction.Parts, systemPart)
-			}
-		}
-		if len(systemInstruction.Parts) == 0 {
-			systemInstruction = nil
-		}
+	if systemPrompt := util.ClaudeSystemText(gjson.GetBytes(rawJSON, "system")); systemPrompt != "" {
+		systemInstruction = &client.Content{Role: "user", Parts: []client.Part{{Text: systemPrompt}}}
 	}
 
 	// contents
@@ -100,7 +86,10 @@ func ConvertClaudeRequestToCLI(modelName string, inputRawJSON []byte, _ bool) []
 						functionArgs := contentResult.Get("input").String()
 						var args map[string]any
 						if err = json.Unmarshal([]byte(functionArgs), &args); err == nil {
-							clientContent.Parts = append(clientContent.Parts, client.Part{FunctionCall: &client.FunctionCall{Name: functionName, Args: args}})
+							clientContent.Parts = append(clientContent.Parts, client.Part{
+								FunctionCall:     &client.FunctionCall{Name: functionName, Args: args},
+								ThoughtSignature: util.GetThoughtSignature(contentResult.Get("id").String()),
+							})
 						}
 					} else if contentTypeResult.Type == gjson.String && contentTypeResult.String() == "tool_result" {
 						toolCallID := contentResult.Get("tool_use_id").String()
@@ -111,9 +100,26 @@ func ConvertClaudeRequestToCLI(modelName string, inputRawJSON []byte, _ bool) []
 								funcName = strings.Join(toolCallIDs[0:len(toolCallIDs)-1], "-")
 							}
 							responseData := contentResult.Get("content").String()
+							if blocks := contentResult.Get("content"); blocks.IsArray() {
+								texts := make([]string, 0)
+								for _, block := range blocks.Array() {
+									if block.Get("type").String() == "text" {
+										texts = append(texts, block.Get("text").String())
+									}
+								}
+								responseData = strings.Join(texts, "\n")
+							}
 							functionResponse := client.FunctionResponse{Name: funcName, Response: map[string]interface{}{"result": responseData}}
 							clientContent.Parts = append(clientContent.Parts, client.Part{FunctionResponse: &functionResponse})
 						}
+					} else if contentTypeResult.Type == gjson.String && contentTypeResult.String() == "image" {
+						source := contentResult.Get("source")
+						if source.Get("type").String() == "base64" {
+							clientContent.Parts = append(clientContent.Parts, client.Part{InlineData: &client.InlineData{
+								MimeType: source.Get("media_type").String(),
+								Data:     source.Get("data").String(),
+							}})
+						}
 					}
 				}
 				contents = append(contents, clientContent)
@@ -144,7 +150,12 @@ func ConvertClaudeRequestToCLI(modelName string, inputRawJSON []byte, _ bool) []
 					inputSchema, _ = sjson.Delete(inputSchema, "additionalProperties")
 					inputSchema, _ = sjson.Delete(inputSchema, "$schema")
 				}
-				tool, _ := sjson.Delete(toolResult.Raw, "input_schema")
+				// Only the fields Gemini accepts are kept; Claude-specific fields such as
+				// cache_control are dropped.
+				tool, _ := sjson.Set(`{}`, "name", toolResult.Get("name").String())
+				if description := toolResult.Get("description"); description.Exists() {
+					tool, _ = sjson.Set(tool, "description", description.String())
+				}
 				tool, _ = sjson.SetRaw(tool, "parameters", inputSchema)
 				var toolDeclaration any
 				if err = json.Unmarshal([]byte(tool), &toolDeclaration); err == nil {
@@ -180,11 +191,16 @@ func ConvertClaudeRequestToCLI(modelName string, inputRawJSON []byte, _ bool) []
 	} else if reasoningEffortResult.String() == "auto" {
 		out, _ = sjson.Set(out, "request.generationConfig.thinkingConfig.thinkingBudget", -1)
 	} else if reasoningEffortResult.String() == "low" {
-		out, _ = sjson.Set(out, "request.generationConfig.thinkingConfig.thinkingBudget", 1024)
+		out, _ = sjson.Set(out, "request.generationConfig.thinkingConfig.thinkingBudget", util.ReasoningBudget(modelName, "low", 1024))
 	} else if reasoningEffortResult.String() == "medium" {
-		out, _ = sjson.Set(out, "request.generationConfig.thinkingConfig.thinkingBudget", 8192)
+		out, _ = sjson.Set(out, "request.generationConfig.thinkingConfig.thinkingBudget", util.ReasoningBudget(modelName, "medium", 8192))
 	} else if reasoningEffortResult.String() == "high" {
-		out, _ = sjson.Set(out, "request.generationConfig.thinkingConfig.thinkingBudget", 24576)
+		out, _ = sjson.Set(out, "request.generationConfig.thinkingConfig.thinkingBudget", util.ReasoningBudget(modelName, "high", 24576))
+	} else if thinking := gjson.GetBytes(rawJSON, "thinking"); thinking.Get("type").String() == "disabled" {
+		out, _ = sjson.Set(out, "request.generationConfig.thinkingConfig.include_thoughts", false)
+		out, _ = sjson.Set(out, "request.generationConfig.thinkingConfig.thinkingBudget", 0)
+	} else if budget := thinking.Get("budget_tokens"); thinking.Get("type").String() == "enabled" && budget.Type == gjson.Number {
+		out, _ = sjson.Set(out, "request.generationConfig.thinkingConfig.thinkingBudget", budget.Int())
 	} else {
 		out, _ = sjson.Set(out, "request.generationConfig.thinkingConfig.thinkingBudget", -1)
 	}
@@ -197,6 +213,30 @@ func ConvertClaudeRequestToCLI(modelName string, inputRawJSON []byte, _ bool) []
 	if v := gjson.GetBytes(rawJSON, "top_k"); v.Exists() && v.Type == gjson.Number {
 		out, _ = sjson.Set(out, "request.generationConfig.topK", v.Num)
 	}
+	if v := gjson.GetBytes(rawJSON, "max_tokens"); v.Exists() && v.Type == gjson.Number {
+		out, _ = sjson.Set(out, "request.generationConfig.maxOutputTokens", v.Int())
+	}
+	if v := gjson.GetBytes(rawJSON, "stop_sequences"); v.IsArray() && len(v.Array()) > 0 {
+		out, _ = sjson.SetRaw(out, "request.generationConfig.stopSequences", v.Raw)
+	}
+	if settings := util.GeminiSafetySettings(root); settings != "" {
+		out, _ = sjson.SetRaw(out, "request.safetySettings", settings)
+	}
+
+	// Map tool_choice to the function calling mode
+	if toolChoice := gjson.GetBytes(rawJSON, "tool_choice"); toolChoice.IsObject() && gjson.Get(out, "request.tools").Exists() {
+		switch toolChoice.Get("type").String() {
+		case "auto":
+			out, _ = sjson.Set(out, "request.toolConfig.functionCallingConfig.mode", "AUTO")
+		case "any":
+			out, _ = sjson.Set(out, "request.toolConfig.functionCallingConfig.mode", "ANY")
+		case "tool":
+			out, _ = sjson.Set(out, "request.toolConfig.functionCallingConfig.mode", "ANY")
+			out, _ = sjson.Set(out, "request.toolConfig.functionCallingConfig.allowedFunctionNames", []string{toolChoice.Get("name").String()})
+		case "none":
+			out, _ = sjson.Set(out, "request.toolConfig.functionCallingConfig.mode", "NONE")
+		}
+	}
 
 	return []byte(out)
 }
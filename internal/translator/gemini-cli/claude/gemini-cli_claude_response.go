@@ -12,6 +12,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/luispater/CLIProxyAPI/v5/internal/util"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
 )
@@ -20,9 +21,11 @@ import (
 // This structure tracks the current state of the response translation process to ensure
 // proper sequencing of SSE events and transitions between different content types.
 type Params struct {
-	HasFirstResponse bool // Indicates if the initial message_start event has been sent
-	ResponseType     int  // Current response type: 0=none, 1=content, 2=thinking, 3=function
-	ResponseIndex    int  // Index counter for content blocks in the streaming response
+	HasFirstResponse bool  // Indicates if the initial message_start event has been sent
+	ResponseType     int   // Current response type: 0=none, 1=content, 2=thinking, 3=function
+	ResponseIndex    int   // Index counter for content blocks in the streaming response
+	UsedTool         bool  // Indicates if a tool_use block has been sent
+	OutputTokens     int64 // Cumulative output tokens reported in the last message_delta event
 }
 
 // ConvertGeminiCLIResponseToClaude performs sophisticated streaming response format conversion.
@@ -56,8 +59,6 @@ func ConvertGeminiCLIResponseToClaude(_ context.Context, _ string, originalReque
 		}
 	}
 
-	// Track whether tools are being used in this response chunk
-	usedTool := false
 	output := ""
 
 	// Initialize the streaming session with a message_start event
@@ -161,7 +162,7 @@ func ConvertGeminiCLIResponseToClaude(_ context.Context, _ string, originalReque
 			} else if functionCallResult.Exists() {
 				// Handle function/tool calls from the AI model
 				// This processes tool usage requests and formats them for Claude Code API compatibility
-				usedTool = true
+				(*param).(*Params).UsedTool = true
 				fcName := functionCallResult.Get("name").String()
 
 				// Handle state transitions when switching to function calls
@@ -195,7 +196,10 @@ func ConvertGeminiCLIResponseToClaude(_ context.Context, _ string, originalReque
 
 				// Create the tool use block with unique ID and function details
 				data := fmt.Sprintf(`{"type":"content_block_start","index":%d,"content_block":{"type":"tool_use","id":"","name":"","input":{}}}`, (*param).(*Params).ResponseIndex)
-				data, _ = sjson.Set(data, "content_block.id", fmt.Sprintf("%s-%d", fcName, time.Now().UnixNano()))
+				fcID := fmt.Sprintf("%s-%d", fcName, time.Now().UnixNano())
+				data, _ = sjson.Set(data, "content_block.id", fcID)
+				// Remember the thought signature so it can be re-attached when the tool_use block is sent back.
+				util.CacheThoughtSignature(fcID, partResult.Get("thoughtSignature").String())
 				data, _ = sjson.Set(data, "content_block.name", fcName)
 				output = output + fmt.Sprintf("data: %s\n\n\n", data)
 
@@ -225,7 +229,7 @@ func ConvertGeminiCLIResponseToClaude(_ context.Context, _ string, originalReque
 			// Create the message delta template with appropriate stop reason
 			template := `{"type":"message_delta","delta":{"stop_reason":"end_turn","stop_sequence":null},"usage":{"input_tokens":0,"output_tokens":0}}`
 			// Set tool_use stop reason if tools were used in this response
-			if usedTool {
+			if (*param).(*Params).UsedTool {
 				template = `{"type":"message_delta","delta":{"stop_reason":"tool_use","stop_sequence":null},"usage":{"input_tokens":0,"output_tokens":0}}`
 			}
 
@@ -236,6 +240,13 @@ func ConvertGeminiCLIResponseToClaude(_ context.Context, _ string, originalReque
 
 			output = output + template + "\n\n\n"
 		}
+	} else if outputTokens := usageResult.Get("candidatesTokenCount").Int() + usageResult.Get("thoughtsTokenCount").Int(); outputTokens > (*param).(*Params).OutputTokens {
+		// Report the cumulative output tokens of the message so far
+		template := `{"type":"message_delta","delta":{"stop_reason":null,"stop_sequence":null},"usage":{"output_tokens":0}}`
+		template, _ = sjson.Set(template, "usage.output_tokens", outputTokens)
+		output = output + "event: message_delta\n"
+		output = output + fmt.Sprintf("data: %s\n\n\n", template)
+		(*param).(*Params).OutputTokens = outputTokens
 	}
 
 	return []string{output}
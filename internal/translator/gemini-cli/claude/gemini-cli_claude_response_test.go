@@ -0,0 +1,59 @@
+package claude
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestStreamEmitsCumulativeUsageDeltas(t *testing.T) {
+	chunks := []string{
+		`{"response":{"candidates":[{"content":{"role":"model","parts":[{"text":"Hel"}]}}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":2}}}`,
+		`{"response":{"candidates":[{"content":{"role":"model","parts":[{"text":"lo"}]}}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":5,"thoughtsTokenCount":3}}}`,
+		`{"response":{"candidates":[{"content":{"role":"model","parts":[{"text":"!"}]}}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":5,"thoughtsTokenCount":3}}}`,
+		`{"response":{"candidates":[{"content":{"role":"model","parts":[{"text":""}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":9,"thoughtsTokenCount":3}}}`,
+		"[DONE]",
+	}
+	var param any
+	var events []string
+	for _, chunk := range chunks {
+		for _, output := range ConvertGeminiCLIResponseToClaude(context.Background(), "", nil, nil, []byte(chunk), &param) {
+			for _, block := range strings.Split(output, "\n\n\n") {
+				if block = strings.TrimSpace(block); block != "" {
+					events = append(events, block)
+				}
+			}
+		}
+	}
+
+	tests := []struct {
+		tokens int64
+		stop   string
+	}{
+		{tokens: 2},
+		{tokens: 8},
+		{tokens: 12, stop: "end_turn"},
+	}
+	deltas := make([]gjson.Result, 0)
+	for _, event := range events {
+		if strings.HasPrefix(event, "event: message_delta\n") {
+			deltas = append(deltas, gjson.Parse(strings.TrimPrefix(event, "event: message_delta\ndata: ")))
+		}
+	}
+	if len(deltas) != len(tests) {
+		t.Fatalf("message_delta events = %d, want %d: %v", len(deltas), len(tests), events)
+	}
+	for i, tt := range tests {
+		if got := deltas[i].Get("usage.output_tokens").Int(); got != tt.tokens {
+			t.Errorf("message_delta %d output_tokens = %d, want %d", i, got, tt.tokens)
+		}
+		if got := deltas[i].Get("delta.stop_reason").String(); got != tt.stop {
+			t.Errorf("message_delta %d stop_reason = %q, want %q", i, got, tt.stop)
+		}
+	}
+	if last := events[len(events)-1]; !strings.HasPrefix(last, "event: message_stop\n") {
+		t.Errorf("last event = %q, want message_stop", last)
+	}
+}
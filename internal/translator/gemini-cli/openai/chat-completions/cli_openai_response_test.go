@@ -0,0 +1,88 @@
+package chat_completions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+// interleavedResponse is a Gemini CLI response with text, then a tool call, then text.
+const interleavedResponse = `{"response":{"responseId":"resp-1","candidates":[{"content":{"role":"model","parts":[{"text":"Let me check. "},{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}},{"text":"Done."}]},"finishReason":"STOP"}]}}`
+
+func TestNonStreamResponseKeepsInterleavedTextAndToolCalls(t *testing.T) {
+	response := ConvertCliResponseToOpenAINonStream(context.Background(), "", nil, nil, []byte(interleavedResponse), nil)
+
+	if got := gjson.Get(response, "choices.0.message.content").String(); got != "Let me check. Done." {
+		t.Errorf("content = %q, want %q", got, "Let me check. Done.")
+	}
+	toolCalls := gjson.Get(response, "choices.0.message.tool_calls").Array()
+	if len(toolCalls) != 1 || toolCalls[0].Get("function.name").String() != "get_weather" {
+		t.Errorf("tool_calls = %v, want one get_weather call", toolCalls)
+	}
+}
+
+func TestStreamChunkKeepsInterleavedTextAndToolCalls(t *testing.T) {
+	var param any
+	chunks := ConvertCliResponseToOpenAI(context.Background(), "", nil, nil, []byte(interleavedResponse), &param)
+	if len(chunks) == 0 {
+		t.Fatal("no chunks")
+	}
+
+	content := ""
+	toolCalls := make([]gjson.Result, 0)
+	for _, chunk := range chunks {
+		content += gjson.Get(chunk, "choices.0.delta.content").String()
+		toolCalls = append(toolCalls, gjson.Get(chunk, "choices.0.delta.tool_calls").Array()...)
+	}
+	if content != "Let me check. Done." {
+		t.Errorf("content = %q, want %q", content, "Let me check. Done.")
+	}
+	if len(toolCalls) != 1 || toolCalls[0].Get("function.name").String() != "get_weather" || toolCalls[0].Get("index").Int() != 0 {
+		t.Errorf("tool_calls = %v, want get_weather at index 0", toolCalls)
+	}
+}
+
+func TestStreamFlushesToolCallsBeforeFinishReason(t *testing.T) {
+	var param any
+	ctx := context.WithValue(context.Background(), "flushToolCalls", true)
+	chunks := ConvertCliResponseToOpenAI(ctx, "", nil, nil, []byte(interleavedResponse), &param)
+	if len(chunks) != 3 {
+		t.Fatalf("chunks = %v, want text, tool call and final chunk", chunks)
+	}
+
+	toolCalls := gjson.Get(chunks[1], "choices.0.delta.tool_calls").Array()
+	if len(toolCalls) != 1 || toolCalls[0].Get("function.name").String() != "get_weather" {
+		t.Errorf("second chunk tool_calls = %v, want get_weather", toolCalls)
+	}
+	if finishReason := gjson.Get(chunks[1], "choices.0.finish_reason"); finishReason.Type != gjson.Null {
+		t.Errorf("tool call chunk finish_reason = %s, want null", finishReason.Raw)
+	}
+	if got := gjson.Get(chunks[2], "choices.0.finish_reason").String(); got == "" {
+		t.Error("last chunk has no finish_reason")
+	}
+}
+
+func TestStreamChunkSurfacesFinishMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     string
+	}{
+		{name: "blocked", response: `{"response":{"candidates":[{"content":{"role":"model","parts":[{"text":"Sure"}]},"finishReason":"SAFETY","finishMessage":"Response blocked."}]}}`, want: "Response blocked."},
+		{name: "no message", response: `{"response":{"candidates":[{"content":{"role":"model","parts":[{"text":"Done"}]},"finishReason":"STOP"}]}}`, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var param any
+			chunks := ConvertCliResponseToOpenAI(context.Background(), "", nil, nil, []byte(tt.response), &param)
+			if len(chunks) == 0 {
+				t.Fatal("no chunks")
+			}
+			last := chunks[len(chunks)-1]
+			if got := gjson.Get(last, "choices.0.native_finish_message").String(); got != tt.want {
+				t.Errorf("native_finish_message = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
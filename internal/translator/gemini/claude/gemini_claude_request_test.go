@@ -0,0 +1,39 @@
+package claude
+
+import (
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestSystemPromptMapping(t *testing.T) {
+	tests := []struct {
+		name   string
+		system string
+		want   string
+	}{
+		{name: "string", system: `"You are a helpful assistant."`, want: "You are a helpful assistant."},
+		{name: "single block", system: `[{"type":"text","text":"You are a helpful assistant."}]`, want: "You are a helpful assistant."},
+		{name: "multiple blocks concatenated", system: `[{"type":"text","text":"You are a helpful assistant."},{"type":"text","text":"Answer briefly.","cache_control":{"type":"ephemeral"}}]`, want: "You are a helpful assistant.\n\nAnswer briefly."},
+		{name: "non-text blocks ignored", system: `[{"type":"image","source":{}},{"type":"text","text":"Answer briefly."}]`, want: "Answer briefly."},
+		{name: "empty string", system: `""`, want: ""},
+		{name: "empty array", system: `[]`, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"model":"claude-sonnet-4","system":` + tt.system + `,"messages":[{"role":"user","content":"Hi"}]}`
+			out := ConvertClaudeRequestToGemini("gemini-2.5-pro", []byte(body), false)
+
+			instruction := gjson.GetBytes(out, "system_instruction")
+			if tt.want == "" {
+				if instruction.Exists() {
+					t.Errorf("system_instruction = %s, want none", instruction.Raw)
+				}
+				return
+			}
+			if parts := instruction.Get("parts").Array(); len(parts) != 1 || parts[0].Get("text").String() != tt.want {
+				t.Errorf("system_instruction = %s, want a single part with %q", instruction.Raw, tt.want)
+			}
+		})
+	}
+}
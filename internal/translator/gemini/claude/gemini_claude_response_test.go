@@ -0,0 +1,99 @@
+package claude
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+// sseEvents splits Claude SSE output into event names and their data payloads.
+func sseEvents(output string) (names []string, data []string) {
+	for _, block := range strings.Split(output, "\n\n\n") {
+		lines := strings.SplitN(strings.TrimSpace(block), "\n", 2)
+		if len(lines) != 2 {
+			continue
+		}
+		names = append(names, strings.TrimPrefix(lines[0], "event: "))
+		data = append(data, strings.TrimPrefix(lines[1], "data: "))
+	}
+	return names, data
+}
+
+func TestStreamEmitsCumulativeUsageDeltas(t *testing.T) {
+	tests := []struct {
+		name       string
+		chunks     []string
+		wantTokens []int64
+		wantStop   string
+	}{
+		{
+			name: "text response",
+			chunks: []string{
+				`{"candidates":[{"content":{"role":"model","parts":[{"text":"Hel"}]}}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":2}}`,
+				`{"candidates":[{"content":{"role":"model","parts":[{"text":"lo"}]}}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":5,"thoughtsTokenCount":3}}`,
+				`{"candidates":[{"content":{"role":"model","parts":[{"text":"!"}]}}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":5,"thoughtsTokenCount":3}}`,
+				`{"candidates":[{"content":{"role":"model","parts":[{"text":""}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":9,"thoughtsTokenCount":3}}`,
+			},
+			wantTokens: []int64{2, 8, 12},
+			wantStop:   "end_turn",
+		},
+		{
+			name: "tool call in an earlier chunk",
+			chunks: []string{
+				`{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}}]}}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":4}}`,
+				`{"candidates":[{"content":{"role":"model","parts":[{"text":""}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":6}}`,
+			},
+			wantTokens: []int64{4, 6},
+			wantStop:   "tool_use",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var param any
+			var names, data []string
+			for _, chunk := range append(tt.chunks, "[DONE]") {
+				for _, output := range ConvertGeminiResponseToClaude(context.Background(), "", nil, nil, []byte(chunk), &param) {
+					chunkNames, chunkData := sseEvents(output)
+					names = append(names, chunkNames...)
+					data = append(data, chunkData...)
+				}
+			}
+
+			tokens := make([]int64, 0)
+			var deltas []gjson.Result
+			for i, name := range names {
+				if name == "message_delta" {
+					delta := gjson.Parse(data[i])
+					deltas = append(deltas, delta)
+					tokens = append(tokens, delta.Get("usage.output_tokens").Int())
+				}
+			}
+			if len(tokens) != len(tt.wantTokens) {
+				t.Fatalf("message_delta output_tokens = %v, want %v", tokens, tt.wantTokens)
+			}
+			for i := range tokens {
+				if tokens[i] != tt.wantTokens[i] {
+					t.Errorf("message_delta output_tokens = %v, want %v", tokens, tt.wantTokens)
+					break
+				}
+			}
+			for _, delta := range deltas[:len(deltas)-1] {
+				if reason := delta.Get("delta.stop_reason"); reason.Type != gjson.Null {
+					t.Errorf("intermediate stop_reason = %s, want null", reason.Raw)
+				}
+			}
+			last := deltas[len(deltas)-1]
+			if got := last.Get("delta.stop_reason").String(); got != tt.wantStop {
+				t.Errorf("final stop_reason = %q, want %q", got, tt.wantStop)
+			}
+			if got := last.Get("usage.input_tokens").Int(); got != 10 {
+				t.Errorf("final input_tokens = %d, want 10", got)
+			}
+			if names[len(names)-1] != "message_stop" {
+				t.Errorf("last event = %q, want message_stop", names[len(names)-1])
+			}
+		})
+	}
+}
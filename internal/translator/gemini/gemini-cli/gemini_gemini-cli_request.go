@@ -12,13 +12,18 @@ import (
 	"github.com/tidwall/sjson"
 )
 
-// PrepareClaudeRequest parses and transforms a Claude API request into internal client format.
-// It extracts the model name, system instruction, message contents, and tool declarations
-// from the raw JSON request and returns them in the format expected by the internal client.
+// ConvertGeminiCLIRequestToGemini unwraps a Gemini CLI internal request into a bare Gemini
+// request for the Generative Language API. The "request" object becomes the body, so the
+// generationConfig, thinkingConfig, and other request fields keep their values; the client
+// applies its request options to the unwrapped body afterwards, at the bare paths. A body that
+// has no "request" object is treated as already unwrapped.
 func ConvertGeminiCLIRequestToGemini(_ string, inputRawJSON []byte, _ bool) []byte {
 	rawJSON := bytes.Clone(inputRawJSON)
 	modelResult := gjson.GetBytes(rawJSON, "model")
-	rawJSON = []byte(gjson.GetBytes(rawJSON, "request").Raw)
+	if request := gjson.GetBytes(rawJSON, "request"); request.IsObject() {
+		rawJSON = []byte(request.Raw)
+	}
+	rawJSON, _ = sjson.DeleteBytes(rawJSON, "project")
 	rawJSON, _ = sjson.SetBytes(rawJSON, "model", modelResult.String())
 	if gjson.GetBytes(rawJSON, "systemInstruction").Exists() {
 		rawJSON, _ = sjson.SetRawBytes(rawJSON, "system_instruction", []byte(gjson.GetBytes(rawJSON, "systemInstruction").Raw))
@@ -42,11 +42,11 @@ func ConvertOpenAIRequestToGemini(modelName string, inputRawJSON []byte, _ bool)
 		case "auto":
 			out, _ = sjson.SetBytes(out, "generationConfig.thinkingConfig.thinkingBudget", -1)
 		case "low":
-			out, _ = sjson.SetBytes(out, "generationConfig.thinkingConfig.thinkingBudget", 1024)
+			out, _ = sjson.SetBytes(out, "generationConfig.thinkingConfig.thinkingBudget", util.ReasoningBudget(modelName, "low", 1024))
 		case "medium":
-			out, _ = sjson.SetBytes(out, "generationConfig.thinkingConfig.thinkingBudget", 8192)
+			out, _ = sjson.SetBytes(out, "generationConfig.thinkingConfig.thinkingBudget", util.ReasoningBudget(modelName, "medium", 8192))
 		case "high":
-			out, _ = sjson.SetBytes(out, "generationConfig.thinkingConfig.thinkingBudget", 24576)
+			out, _ = sjson.SetBytes(out, "generationConfig.thinkingConfig.thinkingBudget", util.ReasoningBudget(modelName, "high", 24576))
 		default:
 			out, _ = sjson.SetBytes(out, "generationConfig.thinkingConfig.thinkingBudget", -1)
 		}
@@ -65,6 +65,26 @@ func ConvertOpenAIRequestToGemini(modelName string, inputRawJSON []byte, _ bool)
 		out, _ = sjson.SetBytes(out, "generationConfig.topK", tkr.Num)
 	}
 
+	// max_completion_tokens supersedes the deprecated max_tokens
+	if mct := gjson.GetBytes(rawJSON, "max_completion_tokens"); mct.Exists() && mct.Type == gjson.Number {
+		out, _ = sjson.SetBytes(out, "generationConfig.maxOutputTokens", mct.Int())
+	} else if mt := gjson.GetBytes(rawJSON, "max_tokens"); mt.Exists() && mt.Type == gjson.Number {
+		out, _ = sjson.SetBytes(out, "generationConfig.maxOutputTokens", mt.Int())
+	}
+
+	// safety_settings -> safetySettings
+	if settings := util.GeminiSafetySettings(gjson.ParseBytes(rawJSON)); settings != "" {
+		out, _ = sjson.SetRawBytes(out, "safetySettings", []byte(settings))
+	}
+
+	// response_format -> responseMimeType/responseSchema
+	if mimeType, schema := util.GeminiResponseFormat(gjson.ParseBytes(rawJSON), "response_format"); mimeType != "" {
+		out, _ = sjson.SetBytes(out, "generationConfig.responseMimeType", mimeType)
+		if schema != "" {
+			out, _ = sjson.SetRawBytes(out, "generationConfig.responseSchema", []byte(schema))
+		}
+	}
+
 	// messages -> systemInstruction + contents
 	messages := gjson.GetBytes(rawJSON, "messages")
 	if messages.IsArray() {
@@ -186,6 +206,15 @@ func ConvertOpenAIRequestToGemini(modelName string, inputRawJSON []byte, _ bool)
 							fargs := tc.Get("function.arguments").String()
 							node, _ = sjson.SetBytes(node, "parts."+itoa(p)+".functionCall.name", fname)
 							node, _ = sjson.SetRawBytes(node, "parts."+itoa(p)+".functionCall.args", []byte(fargs))
+							// Re-attach the thought signature returned with this tool call, either echoed
+							// back by the client or remembered from the original response.
+							signature := tc.Get("extra_content.google.thought_signature").String()
+							if signature == "" {
+								signature = util.GetThoughtSignature(fid)
+							}
+							if signature != "" {
+								node, _ = sjson.SetBytes(node, "parts."+itoa(p)+".thoughtSignature", signature)
+							}
 							p++
 							if fid != "" {
 								fIDs = append(fIDs, fid)
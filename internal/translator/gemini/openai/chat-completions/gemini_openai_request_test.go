@@ -0,0 +1,29 @@
+package chat_completions
+
+import (
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestMaxCompletionTokensMapping(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "max_completion_tokens", body: `{"max_completion_tokens":512}`, want: "512"},
+		{name: "max_tokens", body: `{"max_tokens":256}`, want: "256"},
+		{name: "max_completion_tokens takes precedence", body: `{"max_tokens":256,"max_completion_tokens":512}`, want: "512"},
+		{name: "non-numeric max_completion_tokens ignored", body: `{"max_tokens":256,"max_completion_tokens":"many"}`, want: "256"},
+		{name: "neither", body: `{}`, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := ConvertOpenAIRequestToGemini("gemini-2.5-pro", []byte(tt.body), false)
+			if got := gjson.GetBytes(out, "generationConfig.maxOutputTokens").Raw; got != tt.want {
+				t.Errorf("maxOutputTokens = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
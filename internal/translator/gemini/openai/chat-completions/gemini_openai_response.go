@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/luispater/CLIProxyAPI/v5/internal/util"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
 )
@@ -18,6 +19,11 @@ import (
 // convertGeminiResponseToOpenAIChatParams holds parameters for response conversion.
 type convertGeminiResponseToOpenAIChatParams struct {
 	UnixTimestamp int64
+	// FunctionIndex is the OpenAI tool call index assigned to the next function call of the stream.
+	FunctionIndex int
+	// IDBase is the timestamp the tool call IDs of the stream are derived from; each call adds
+	// its index, so IDs stay unique within the stream like in non-streaming responses.
+	IDBase int64
 }
 
 // ConvertGeminiResponseToOpenAI translates a single chunk of a streaming response from the
@@ -26,6 +32,10 @@ type convertGeminiResponseToOpenAIChatParams struct {
 // The function handles text content, tool calls, reasoning content, and usage metadata, outputting
 // responses that match the OpenAI API format. It supports incremental updates for streaming responses.
 //
+// If the context value "flushToolCalls" is true, every tool call is sent in a chunk of its own,
+// after the text that precedes it, and the finish reason and usage follow in a separate last
+// chunk. Otherwise a Gemini chunk becomes a single OpenAI chunk.
+//
 // Parameters:
 //   - ctx: The context for the request, used for cancellation and timeout handling
 //   - modelName: The name of the model being used for the response (unused in current implementation)
@@ -34,62 +44,44 @@ type convertGeminiResponseToOpenAIChatParams struct {
 //
 // Returns:
 //   - []string: A slice of strings, each containing an OpenAI-compatible JSON response
-func ConvertGeminiResponseToOpenAI(_ context.Context, _ string, originalRequestRawJSON, requestRawJSON, rawJSON []byte, param *any) []string {
+func ConvertGeminiResponseToOpenAI(ctx context.Context, _ string, originalRequestRawJSON, requestRawJSON, rawJSON []byte, param *any) []string {
 	if *param == nil {
 		*param = &convertGeminiResponseToOpenAIChatParams{
 			UnixTimestamp: 0,
+			IDBase:        time.Now().UnixNano(),
 		}
 	}
+	params := (*param).(*convertGeminiResponseToOpenAIChatParams)
 
 	if bytes.Equal(rawJSON, []byte("[DONE]")) {
 		return []string{}
 	}
+	flushToolCalls, _ := ctx.Value("flushToolCalls").(bool)
 
 	// Initialize the OpenAI SSE template.
-	template := `{"id":"","object":"chat.completion.chunk","created":12345,"model":"model","choices":[{"index":0,"delta":{"role":null,"content":null,"reasoning_content":null,"tool_calls":null},"finish_reason":null,"native_finish_reason":null}]}`
+	chunkTemplate := `{"id":"","object":"chat.completion.chunk","created":12345,"model":"model","choices":[{"index":0,"delta":{"role":null,"content":null,"reasoning_content":null,"tool_calls":null},"finish_reason":null,"native_finish_reason":null}]}`
 
 	// Extract and set the model version.
 	if modelVersionResult := gjson.GetBytes(rawJSON, "modelVersion"); modelVersionResult.Exists() {
-		template, _ = sjson.Set(template, "model", modelVersionResult.String())
+		chunkTemplate, _ = sjson.Set(chunkTemplate, "model", modelVersionResult.String())
 	}
 
 	// Extract and set the creation timestamp.
 	if createTimeResult := gjson.GetBytes(rawJSON, "createTime"); createTimeResult.Exists() {
 		t, err := time.Parse(time.RFC3339Nano, createTimeResult.String())
 		if err == nil {
-			(*param).(*convertGeminiResponseToOpenAIChatParams).UnixTimestamp = t.Unix()
+			params.UnixTimestamp = t.Unix()
 		}
-		template, _ = sjson.Set(template, "created", (*param).(*convertGeminiResponseToOpenAIChatParams).UnixTimestamp)
-	} else {
-		template, _ = sjson.Set(template, "created", (*param).(*convertGeminiResponseToOpenAIChatParams).UnixTimestamp)
 	}
+	chunkTemplate, _ = sjson.Set(chunkTemplate, "created", params.UnixTimestamp)
 
 	// Extract and set the response ID.
 	if responseIDResult := gjson.GetBytes(rawJSON, "responseId"); responseIDResult.Exists() {
-		template, _ = sjson.Set(template, "id", responseIDResult.String())
+		chunkTemplate, _ = sjson.Set(chunkTemplate, "id", responseIDResult.String())
 	}
 
-	// Extract and set the finish reason.
-	if finishReasonResult := gjson.GetBytes(rawJSON, "candidates.0.finishReason"); finishReasonResult.Exists() {
-		template, _ = sjson.Set(template, "choices.0.finish_reason", finishReasonResult.String())
-		template, _ = sjson.Set(template, "choices.0.native_finish_reason", finishReasonResult.String())
-	}
-
-	// Extract and set usage metadata (token counts).
-	if usageResult := gjson.GetBytes(rawJSON, "usageMetadata"); usageResult.Exists() {
-		if candidatesTokenCountResult := usageResult.Get("candidatesTokenCount"); candidatesTokenCountResult.Exists() {
-			template, _ = sjson.Set(template, "usage.completion_tokens", candidatesTokenCountResult.Int())
-		}
-		if totalTokenCountResult := usageResult.Get("totalTokenCount"); totalTokenCountResult.Exists() {
-			template, _ = sjson.Set(template, "usage.total_tokens", totalTokenCountResult.Int())
-		}
-		promptTokenCount := usageResult.Get("promptTokenCount").Int()
-		thoughtsTokenCount := usageResult.Get("thoughtsTokenCount").Int()
-		template, _ = sjson.Set(template, "usage.prompt_tokens", promptTokenCount+thoughtsTokenCount)
-		if thoughtsTokenCount > 0 {
-			template, _ = sjson.Set(template, "usage.completion_tokens_details.reasoning_tokens", thoughtsTokenCount)
-		}
-	}
+	chunks := make([]string, 0, 1)
+	template := chunkTemplate
 
 	// Process the main content part of the response.
 	partsResult := gjson.GetBytes(rawJSON, "candidates.0.content.parts")
@@ -102,33 +94,79 @@ func ConvertGeminiResponseToOpenAI(_ context.Context, _ string, originalRequestR
 
 			if partTextResult.Exists() {
 				// Handle text content, distinguishing between regular content and reasoning/thoughts.
+				// A chunk may carry several text parts, which are concatenated.
+				field := "choices.0.delta.content"
 				if partResult.Get("thought").Bool() {
-					template, _ = sjson.Set(template, "choices.0.delta.reasoning_content", partTextResult.String())
-				} else {
-					template, _ = sjson.Set(template, "choices.0.delta.content", partTextResult.String())
+					field = "choices.0.delta.reasoning_content"
 				}
+				template, _ = sjson.Set(template, field, gjson.Get(template, field).String()+partTextResult.String())
 				template, _ = sjson.Set(template, "choices.0.delta.role", "assistant")
 			} else if functionCallResult.Exists() {
-				// Handle function call content.
+				// Handle function call content. A flushed call goes into a chunk of its own,
+				// after the text collected so far.
+				if flushToolCalls {
+					if template != chunkTemplate {
+						chunks = append(chunks, template)
+					}
+					template = chunkTemplate
+				}
 				toolCallsResult := gjson.Get(template, "choices.0.delta.tool_calls")
 				if !toolCallsResult.Exists() || !toolCallsResult.IsArray() {
 					template, _ = sjson.SetRaw(template, "choices.0.delta.tool_calls", `[]`)
 				}
 
-				functionCallTemplate := `{"id": "","type": "function","function": {"name": "","arguments": ""}}`
+				// Each function call arrives complete, so it is emitted immediately with its own index.
+				functionCallTemplate := `{"id": "","index": 0,"type": "function","function": {"name": "","arguments": ""}}`
 				fcName := functionCallResult.Get("name").String()
-				functionCallTemplate, _ = sjson.Set(functionCallTemplate, "id", fmt.Sprintf("%s-%d", fcName, time.Now().UnixNano()))
+				fcID := fmt.Sprintf("%s-%d", fcName, params.IDBase+int64(params.FunctionIndex))
+				functionCallTemplate, _ = sjson.Set(functionCallTemplate, "id", fcID)
+				functionCallTemplate, _ = sjson.Set(functionCallTemplate, "index", params.FunctionIndex)
+				params.FunctionIndex++
 				functionCallTemplate, _ = sjson.Set(functionCallTemplate, "function.name", fcName)
 				if fcArgsResult := functionCallResult.Get("args"); fcArgsResult.Exists() {
 					functionCallTemplate, _ = sjson.Set(functionCallTemplate, "function.arguments", fcArgsResult.Raw)
 				}
+				// Preserve the thought signature so it can be echoed back in the next turn.
+				if signatureResult := partResult.Get("thoughtSignature"); signatureResult.Exists() {
+					functionCallTemplate, _ = sjson.Set(functionCallTemplate, "extra_content.google.thought_signature", signatureResult.String())
+					util.CacheThoughtSignature(fcID, signatureResult.String())
+				}
 				template, _ = sjson.Set(template, "choices.0.delta.role", "assistant")
 				template, _ = sjson.SetRaw(template, "choices.0.delta.tool_calls.-1", functionCallTemplate)
+				if flushToolCalls {
+					chunks = append(chunks, template)
+					template = chunkTemplate
+				}
 			}
 		}
 	}
 
-	return []string{template}
+	// Extract and set the finish reason.
+	finishReasonResult := gjson.GetBytes(rawJSON, "candidates.0.finishReason")
+	if finishReasonResult.Exists() {
+		template, _ = sjson.Set(template, "choices.0.finish_reason", MapFinishReason(finishReasonResult.String(), params.FunctionIndex > 0))
+		template, _ = sjson.Set(template, "choices.0.native_finish_reason", finishReasonResult.String())
+	}
+	if finishMessageResult := gjson.GetBytes(rawJSON, "candidates.0.finishMessage"); finishMessageResult.String() != "" {
+		template, _ = sjson.Set(template, "choices.0.native_finish_message", finishMessageResult.String())
+	}
+
+	// Extract and set usage metadata (token counts). Every chunk carries the running counts,
+	// so only the terminating chunk, which has a finish reason, reports the usage.
+	if usageResult := gjson.GetBytes(rawJSON, "usageMetadata"); usageResult.Exists() && finishReasonResult.Exists() {
+		template, _ = sjson.SetRaw(template, "usage", util.OpenAIUsage(usageResult))
+	}
+
+	// Surface the sources of a response grounded with Google Search as URL citations.
+	if annotations := util.OpenAIURLCitations(gjson.GetBytes(rawJSON, "candidates.0.groundingMetadata")); annotations != "" {
+		template, _ = sjson.SetRaw(template, "choices.0.delta.annotations", annotations)
+	}
+
+	// The last chunk is left out only if the tool calls were flushed and nothing is left.
+	if template != chunkTemplate || len(chunks) == 0 {
+		chunks = append(chunks, template)
+	}
+	return chunks
 }
 
 // ConvertGeminiResponseToOpenAINonStream converts a non-streaming Gemini response to a non-streaming OpenAI response.
@@ -165,30 +203,21 @@ func ConvertGeminiResponseToOpenAINonStream(_ context.Context, _ string, origina
 		template, _ = sjson.Set(template, "id", responseIDResult.String())
 	}
 
-	if finishReasonResult := gjson.GetBytes(rawJSON, "candidates.0.finishReason"); finishReasonResult.Exists() {
-		template, _ = sjson.Set(template, "choices.0.finish_reason", finishReasonResult.String())
-		template, _ = sjson.Set(template, "choices.0.native_finish_reason", finishReasonResult.String())
+	if usageResult := gjson.GetBytes(rawJSON, "usageMetadata"); usageResult.Exists() {
+		template, _ = sjson.SetRaw(template, "usage", util.OpenAIUsage(usageResult))
 	}
 
-	if usageResult := gjson.GetBytes(rawJSON, "usageMetadata"); usageResult.Exists() {
-		if candidatesTokenCountResult := usageResult.Get("candidatesTokenCount"); candidatesTokenCountResult.Exists() {
-			template, _ = sjson.Set(template, "usage.completion_tokens", candidatesTokenCountResult.Int())
-		}
-		if totalTokenCountResult := usageResult.Get("totalTokenCount"); totalTokenCountResult.Exists() {
-			template, _ = sjson.Set(template, "usage.total_tokens", totalTokenCountResult.Int())
-		}
-		promptTokenCount := usageResult.Get("promptTokenCount").Int()
-		thoughtsTokenCount := usageResult.Get("thoughtsTokenCount").Int()
-		template, _ = sjson.Set(template, "usage.prompt_tokens", promptTokenCount+thoughtsTokenCount)
-		if thoughtsTokenCount > 0 {
-			template, _ = sjson.Set(template, "usage.completion_tokens_details.reasoning_tokens", thoughtsTokenCount)
-		}
+	if annotations := util.OpenAIURLCitations(gjson.GetBytes(rawJSON, "candidates.0.groundingMetadata")); annotations != "" {
+		template, _ = sjson.SetRaw(template, "choices.0.message.annotations", annotations)
 	}
 
-	// Process the main content part of the response.
+	// Process all parts of the response. Text and function calls may be interleaved: text parts
+	// are concatenated in order and every function call becomes a tool call.
 	partsResult := gjson.GetBytes(rawJSON, "candidates.0.content.parts")
+	toolCallCount := 0
 	if partsResult.IsArray() {
 		partsResults := partsResult.Array()
+		idBase := time.Now().UnixNano()
 		for i := 0; i < len(partsResults); i++ {
 			partResult := partsResults[i]
 			partTextResult := partResult.Get("text")
@@ -196,11 +225,11 @@ func ConvertGeminiResponseToOpenAINonStream(_ context.Context, _ string, origina
 
 			if partTextResult.Exists() {
 				// Append text content, distinguishing between regular content and reasoning.
+				field := "choices.0.message.content"
 				if partResult.Get("thought").Bool() {
-					template, _ = sjson.Set(template, "choices.0.message.reasoning_content", partTextResult.String())
-				} else {
-					template, _ = sjson.Set(template, "choices.0.message.content", partTextResult.String())
+					field = "choices.0.message.reasoning_content"
 				}
+				template, _ = sjson.Set(template, field, gjson.Get(template, field).String()+partTextResult.String())
 				template, _ = sjson.Set(template, "choices.0.message.role", "assistant")
 			} else if functionCallResult.Exists() {
 				// Append function call content to the tool_calls array.
@@ -210,19 +239,60 @@ func ConvertGeminiResponseToOpenAINonStream(_ context.Context, _ string, origina
 				}
 				functionCallItemTemplate := `{"id": "","type": "function","function": {"name": "","arguments": ""}}`
 				fcName := functionCallResult.Get("name").String()
-				functionCallItemTemplate, _ = sjson.Set(functionCallItemTemplate, "id", fmt.Sprintf("%s-%d", fcName, time.Now().UnixNano()))
+				// Offset the timestamp by the call's position so that IDs stay unique within the response.
+				fcID := fmt.Sprintf("%s-%d", fcName, idBase+int64(toolCallCount))
+				toolCallCount++
+				functionCallItemTemplate, _ = sjson.Set(functionCallItemTemplate, "id", fcID)
 				functionCallItemTemplate, _ = sjson.Set(functionCallItemTemplate, "function.name", fcName)
 				if fcArgsResult := functionCallResult.Get("args"); fcArgsResult.Exists() {
 					functionCallItemTemplate, _ = sjson.Set(functionCallItemTemplate, "function.arguments", fcArgsResult.Raw)
 				}
+				// Preserve the thought signature so it can be echoed back in the next turn.
+				if signatureResult := partResult.Get("thoughtSignature"); signatureResult.Exists() {
+					functionCallItemTemplate, _ = sjson.Set(functionCallItemTemplate, "extra_content.google.thought_signature", signatureResult.String())
+					util.CacheThoughtSignature(fcID, signatureResult.String())
+				}
 				template, _ = sjson.Set(template, "choices.0.message.role", "assistant")
 				template, _ = sjson.SetRaw(template, "choices.0.message.tool_calls.-1", functionCallItemTemplate)
-			} else {
-				// If no usable content is found, return an empty string.
-				return ""
 			}
+			// Other parts, such as a bare thought signature, carry no message content.
 		}
 	}
 
+	if finishReasonResult := gjson.GetBytes(rawJSON, "candidates.0.finishReason"); finishReasonResult.Exists() {
+		template, _ = sjson.Set(template, "choices.0.finish_reason", MapFinishReason(finishReasonResult.String(), toolCallCount > 0))
+		template, _ = sjson.Set(template, "choices.0.native_finish_reason", finishReasonResult.String())
+	}
+	if finishMessageResult := gjson.GetBytes(rawJSON, "candidates.0.finishMessage"); finishMessageResult.String() != "" {
+		template, _ = sjson.Set(template, "choices.0.native_finish_message", finishMessageResult.String())
+	}
+
 	return template
 }
+
+// MapFinishReason converts a Gemini finish reason to the OpenAI finish_reason. A response
+// that ended normally reports "tool_calls" if it called tools and "stop" otherwise. Responses
+// cut off by the token or response size limit report "length", and responses stopped by
+// safety, recitation, or blocklist filters report "content_filter". Other reasons, which have
+// no OpenAI counterpart, report "stop". The original value is always available in
+// native_finish_reason, and the explanation Gemini gives with some finish reasons, such as
+// blocks, is passed on in native_finish_message.
+//
+// Parameters:
+//   - reason: The Gemini finish reason
+//   - toolCalls: Whether the response called tools
+//
+// Returns:
+//   - string: The OpenAI finish reason
+func MapFinishReason(reason string, toolCalls bool) string {
+	switch reason {
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return "content_filter"
+	}
+	if toolCalls {
+		return "tool_calls"
+	}
+	return "stop"
+}
@@ -0,0 +1,203 @@
+package chat_completions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+// interleavedResponse is a Gemini response with text, then a tool call, then text.
+const interleavedResponse = `{"responseId":"resp-1","candidates":[{"content":{"role":"model","parts":[{"text":"Let me check. "},{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}},{"text":"Done."}]},"finishReason":"STOP"}]}`
+
+func TestNonStreamResponseKeepsInterleavedTextAndToolCalls(t *testing.T) {
+	response := ConvertGeminiResponseToOpenAINonStream(context.Background(), "", nil, nil, []byte(interleavedResponse), nil)
+
+	if got := gjson.Get(response, "choices.0.message.content").String(); got != "Let me check. Done." {
+		t.Errorf("content = %q, want %q", got, "Let me check. Done.")
+	}
+	toolCalls := gjson.Get(response, "choices.0.message.tool_calls").Array()
+	if len(toolCalls) != 1 {
+		t.Fatalf("tool_calls = %v, want one call", toolCalls)
+	}
+	if got := toolCalls[0].Get("function.name").String(); got != "get_weather" {
+		t.Errorf("tool call name = %q, want %q", got, "get_weather")
+	}
+	if got := toolCalls[0].Get("function.arguments").String(); got != `{"city":"Paris"}` {
+		t.Errorf("tool call arguments = %q, want %q", got, `{"city":"Paris"}`)
+	}
+}
+
+func TestStreamChunkKeepsInterleavedTextAndToolCalls(t *testing.T) {
+	var param any
+	chunks := ConvertGeminiResponseToOpenAI(context.Background(), "", nil, nil, []byte(interleavedResponse), &param)
+	if len(chunks) == 0 {
+		t.Fatal("no chunks")
+	}
+
+	content := ""
+	toolCalls := make([]gjson.Result, 0)
+	for _, chunk := range chunks {
+		content += gjson.Get(chunk, "choices.0.delta.content").String()
+		toolCalls = append(toolCalls, gjson.Get(chunk, "choices.0.delta.tool_calls").Array()...)
+	}
+	if content != "Let me check. Done." {
+		t.Errorf("content = %q, want %q", content, "Let me check. Done.")
+	}
+	if len(toolCalls) != 1 || toolCalls[0].Get("function.name").String() != "get_weather" || toolCalls[0].Get("index").Int() != 0 {
+		t.Errorf("tool_calls = %v, want get_weather at index 0", toolCalls)
+	}
+}
+
+func TestStreamFlushesToolCallsBeforeFinishReason(t *testing.T) {
+	var param any
+	ctx := context.WithValue(context.Background(), "flushToolCalls", true)
+	chunks := ConvertGeminiResponseToOpenAI(ctx, "", nil, nil, []byte(interleavedResponse), &param)
+	if len(chunks) != 3 {
+		t.Fatalf("chunks = %v, want text, tool call and final chunk", chunks)
+	}
+
+	if got := gjson.Get(chunks[0], "choices.0.delta.content").String(); got != "Let me check. " {
+		t.Errorf("first chunk content = %q, want %q", got, "Let me check. ")
+	}
+	toolCalls := gjson.Get(chunks[1], "choices.0.delta.tool_calls").Array()
+	if len(toolCalls) != 1 || toolCalls[0].Get("function.name").String() != "get_weather" {
+		t.Errorf("second chunk tool_calls = %v, want get_weather", toolCalls)
+	}
+	if finishReason := gjson.Get(chunks[1], "choices.0.finish_reason"); finishReason.Type != gjson.Null {
+		t.Errorf("tool call chunk finish_reason = %s, want null", finishReason.Raw)
+	}
+	if got := gjson.Get(chunks[2], "choices.0.delta.content").String(); got != "Done." {
+		t.Errorf("last chunk content = %q, want %q", got, "Done.")
+	}
+	if got := gjson.Get(chunks[2], "choices.0.finish_reason").String(); got == "" {
+		t.Error("last chunk has no finish_reason")
+	}
+	if gjson.Get(chunks[2], "choices.0.delta.tool_calls").IsArray() {
+		t.Errorf("last chunk repeats the tool call: %s", chunks[2])
+	}
+}
+
+func TestStreamToolCallsGetDistinctIDsAndIndexes(t *testing.T) {
+	response := []byte(`{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"lookup","args":{"q":"a"}}},{"functionCall":{"name":"lookup","args":{"q":"b"}}}]}}]}`)
+	for _, flush := range []bool{false, true} {
+		var param any
+		ctx := context.WithValue(context.Background(), "flushToolCalls", flush)
+		chunks := ConvertGeminiResponseToOpenAI(ctx, "", nil, nil, response, &param)
+		chunks = append(chunks, ConvertGeminiResponseToOpenAI(ctx, "", nil, nil, response, &param)...)
+
+		ids := make(map[string]bool)
+		indexes := make([]int64, 0)
+		for _, chunk := range chunks {
+			for _, toolCall := range gjson.Get(chunk, "choices.0.delta.tool_calls").Array() {
+				ids[toolCall.Get("id").String()] = true
+				indexes = append(indexes, toolCall.Get("index").Int())
+			}
+		}
+		if len(ids) != 4 {
+			t.Errorf("flush=%t: tool call IDs = %v, want 4 distinct IDs", flush, ids)
+		}
+		for i, index := range indexes {
+			if index != int64(i) {
+				t.Errorf("flush=%t: tool call indexes = %v, want 0 to 3", flush, indexes)
+				break
+			}
+		}
+	}
+}
+
+func TestMapFinishReason(t *testing.T) {
+	tests := []struct {
+		reason    string
+		toolCalls bool
+		want      string
+	}{
+		{reason: "STOP", want: "stop"},
+		{reason: "STOP", toolCalls: true, want: "tool_calls"},
+		{reason: "MAX_TOKENS", want: "length"},
+		{reason: "MAX_TOKENS", toolCalls: true, want: "length"},
+		{reason: "SAFETY", want: "content_filter"},
+		{reason: "RECITATION", want: "content_filter"},
+		{reason: "BLOCKLIST", want: "content_filter"},
+		{reason: "PROHIBITED_CONTENT", want: "content_filter"},
+		{reason: "SPII", want: "content_filter"},
+		{reason: "IMAGE_SAFETY", want: "content_filter"},
+		{reason: "OTHER", want: "stop"},
+		{reason: "MALFORMED_FUNCTION_CALL", want: "stop"},
+	}
+	for _, tt := range tests {
+		if got := MapFinishReason(tt.reason, tt.toolCalls); got != tt.want {
+			t.Errorf("MapFinishReason(%q, %t) = %q, want %q", tt.reason, tt.toolCalls, got, tt.want)
+		}
+	}
+}
+
+func TestFinishReasonReportsToolCalls(t *testing.T) {
+	response := ConvertGeminiResponseToOpenAINonStream(context.Background(), "", nil, nil, []byte(interleavedResponse), nil)
+	if got := gjson.Get(response, "choices.0.finish_reason").String(); got != "tool_calls" {
+		t.Errorf("non-stream finish_reason = %q, want %q", got, "tool_calls")
+	}
+	if got := gjson.Get(response, "choices.0.native_finish_reason").String(); got != "STOP" {
+		t.Errorf("non-stream native_finish_reason = %q, want %q", got, "STOP")
+	}
+
+	// In a stream, the tool call may arrive in an earlier chunk than the finish reason.
+	var param any
+	ConvertGeminiResponseToOpenAI(context.Background(), "", nil, nil, []byte(`{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"get_weather","args":{}}}]}}]}`), &param)
+	chunks := ConvertGeminiResponseToOpenAI(context.Background(), "", nil, nil, []byte(`{"candidates":[{"content":{"role":"model","parts":[{"text":""}]},"finishReason":"STOP"}]}`), &param)
+	if got := gjson.Get(chunks[len(chunks)-1], "choices.0.finish_reason").String(); got != "tool_calls" {
+		t.Errorf("stream finish_reason = %q, want %q", got, "tool_calls")
+	}
+}
+
+func TestResponseSurfacesGroundingAsAnnotations(t *testing.T) {
+	const grounded = `{"candidates":[{"content":{"role":"model","parts":[{"text":"It is sunny."}]},"finishReason":"STOP","groundingMetadata":{"groundingChunks":[{"web":{"uri":"https://weather.example","title":"Weather"}}],"groundingSupports":[{"segment":{"startIndex":0,"endIndex":12},"groundingChunkIndices":[0]}]}}]}`
+
+	var param any
+	chunks := ConvertGeminiResponseToOpenAI(context.Background(), "", nil, nil, []byte(grounded), &param)
+	if len(chunks) == 0 {
+		t.Fatal("no chunks")
+	}
+	tests := []struct {
+		name     string
+		response string
+		path     string
+	}{
+		{name: "non-stream", response: ConvertGeminiResponseToOpenAINonStream(context.Background(), "", nil, nil, []byte(grounded), nil), path: "choices.0.message.annotations"},
+		{name: "stream", response: chunks[0], path: "choices.0.delta.annotations"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gjson.Get(tt.response, tt.path+".0.url_citation.url").String(); got != "https://weather.example" {
+				t.Errorf("%s = %s, want a citation of https://weather.example", tt.path, gjson.Get(tt.response, tt.path).Raw)
+			}
+		})
+	}
+}
+
+func TestResponseSurfacesFinishMessage(t *testing.T) {
+	const blocked = `{"candidates":[{"content":{"role":"model","parts":[{"text":"Sure, here"}]},"finishReason":"SAFETY","finishMessage":"Response blocked."}]}`
+
+	var param any
+	chunks := ConvertGeminiResponseToOpenAI(context.Background(), "", nil, nil, []byte(blocked), &param)
+	if len(chunks) == 0 {
+		t.Fatal("no chunks")
+	}
+	tests := []struct {
+		name     string
+		response string
+	}{
+		{name: "non-stream", response: ConvertGeminiResponseToOpenAINonStream(context.Background(), "", nil, nil, []byte(blocked), nil)},
+		{name: "stream", response: chunks[len(chunks)-1]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gjson.Get(tt.response, "choices.0.native_finish_message").String(); got != "Response blocked." {
+				t.Errorf("native_finish_message = %q, want %q", got, "Response blocked.")
+			}
+			if got := gjson.Get(tt.response, "choices.0.native_finish_reason").String(); got != "SAFETY" {
+				t.Errorf("native_finish_reason = %q, want %q", got, "SAFETY")
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package chat_completions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// toolCallResponse is a Gemini response calling a tool with a thought signature.
+func toolCallResponse(name, signature string) []byte {
+	response := `{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"","args":{"city":"Paris"}},"thoughtSignature":""}]},"finishReason":"STOP"}]}`
+	response, _ = sjson.Set(response, "candidates.0.content.parts.0.functionCall.name", name)
+	response, _ = sjson.Set(response, "candidates.0.content.parts.0.thoughtSignature", signature)
+	return []byte(response)
+}
+
+// appendToolTurn appends the assistant tool call of an OpenAI response and the tool result to
+// the messages of a request. With echoSignature false the client drops extra_content, as
+// most OpenAI clients do.
+func appendToolTurn(t *testing.T, request, response string, echoSignature bool) string {
+	t.Helper()
+	toolCall := gjson.Get(response, "choices.0.message.tool_calls.0")
+	if !toolCall.Exists() {
+		t.Fatalf("response has no tool call: %s", response)
+	}
+	call := toolCall.Raw
+	if !echoSignature {
+		call, _ = sjson.Delete(call, "extra_content")
+	}
+	assistant, _ := sjson.SetRaw(`{"role":"assistant","content":null,"tool_calls":[]}`, "tool_calls.-1", call)
+	request, _ = sjson.SetRaw(request, "messages.-1", assistant)
+	tool, _ := sjson.Set(`{"role":"tool","tool_call_id":"","content":"sunny"}`, "tool_call_id", toolCall.Get("id").String())
+	request, _ = sjson.SetRaw(request, "messages.-1", tool)
+	return request
+}
+
+// modelSignatures returns the thought signatures of the function calls sent to Gemini.
+func modelSignatures(geminiRequest []byte) []string {
+	signatures := make([]string, 0)
+	for _, content := range gjson.GetBytes(geminiRequest, "contents").Array() {
+		for _, part := range content.Get("parts").Array() {
+			if part.Get("functionCall").Exists() {
+				signatures = append(signatures, part.Get("thoughtSignature").String())
+			}
+		}
+	}
+	return signatures
+}
+
+func TestThoughtSignatureRoundTripsThroughToolTurns(t *testing.T) {
+	for name, echoSignature := range map[string]bool{"echoed by the client": true, "dropped by the client": false} {
+		t.Run(name, func(t *testing.T) {
+			request := `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":"What is the weather in Paris?"}]}`
+
+			first := ConvertGeminiResponseToOpenAINonStream(context.Background(), "", nil, nil, toolCallResponse("get_weather", "signature-1"), nil)
+			if got := gjson.Get(first, "choices.0.message.tool_calls.0.extra_content.google.thought_signature").String(); got != "signature-1" {
+				t.Fatalf("response thought_signature = %q, want %q", got, "signature-1")
+			}
+			request = appendToolTurn(t, request, first, echoSignature)
+			signatures := modelSignatures(ConvertOpenAIRequestToGemini("gemini-2.5-pro", []byte(request), false))
+			if len(signatures) != 1 || signatures[0] != "signature-1" {
+				t.Fatalf("signatures after the first turn = %v, want [signature-1]", signatures)
+			}
+
+			second := ConvertGeminiResponseToOpenAINonStream(context.Background(), "", nil, nil, toolCallResponse("get_forecast", "signature-2"), nil)
+			request = appendToolTurn(t, request, second, echoSignature)
+			signatures = modelSignatures(ConvertOpenAIRequestToGemini("gemini-2.5-pro", []byte(request), false))
+			if len(signatures) != 2 || signatures[0] != "signature-1" || signatures[1] != "signature-2" {
+				t.Errorf("signatures after the second turn = %v, want [signature-1 signature-2]", signatures)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"strings"
 
+	"github.com/luispater/CLIProxyAPI/v5/internal/util"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
 )
@@ -75,6 +76,10 @@ func ConvertOpenAIResponsesRequestToGemini(modelName string, inputRawJSON []byte
 					functionCall, _ = sjson.SetRaw(functionCall, "functionCall.args", argsResult.Raw)
 				}
 
+				if signature := util.GetThoughtSignature(item.Get("call_id").String()); signature != "" {
+					functionCall, _ = sjson.Set(functionCall, "thoughtSignature", signature)
+				}
+
 				modelContent, _ = sjson.SetRaw(modelContent, "parts.-1", functionCall)
 				out, _ = sjson.SetRaw(out, "contents.-1", modelContent)
 
@@ -191,6 +196,17 @@ func ConvertOpenAIResponsesRequestToGemini(modelName string, inputRawJSON []byte
 		out, _ = sjson.Set(out, "generationConfig.topP", topP.Float())
 	}
 
+	// Handle text.format as responseMimeType/responseSchema
+	if mimeType, schema := util.GeminiResponseFormat(root, "text.format"); mimeType != "" {
+		if !gjson.Get(out, "generationConfig").Exists() {
+			out, _ = sjson.SetRaw(out, "generationConfig", `{}`)
+		}
+		out, _ = sjson.Set(out, "generationConfig.responseMimeType", mimeType)
+		if schema != "" {
+			out, _ = sjson.SetRaw(out, "generationConfig.responseSchema", schema)
+		}
+	}
+
 	// Handle stop sequences
 	if stopSequences := root.Get("stop_sequences"); stopSequences.Exists() && stopSequences.IsArray() {
 		if !gjson.Get(out, "generationConfig").Exists() {
@@ -204,6 +220,11 @@ func ConvertOpenAIResponsesRequestToGemini(modelName string, inputRawJSON []byte
 		out, _ = sjson.Set(out, "generationConfig.stopSequences", sequences)
 	}
 
+	// Handle safety settings
+	if settings := util.GeminiSafetySettings(root); settings != "" {
+		out, _ = sjson.SetRaw(out, "safetySettings", settings)
+	}
+
 	if reasoningEffort := root.Get("reasoning.effort"); reasoningEffort.Exists() {
 		switch reasoningEffort.String() {
 		case "none":
@@ -214,11 +235,11 @@ func ConvertOpenAIResponsesRequestToGemini(modelName string, inputRawJSON []byte
 		case "minimal":
 			out, _ = sjson.Set(out, "generationConfig.thinkingConfig.thinkingBudget", 1024)
 		case "low":
-			out, _ = sjson.Set(out, "generationConfig.thinkingConfig.thinkingBudget", 4096)
+			out, _ = sjson.Set(out, "generationConfig.thinkingConfig.thinkingBudget", util.ReasoningBudget(modelName, "low", 4096))
 		case "medium":
-			out, _ = sjson.Set(out, "generationConfig.thinkingConfig.thinkingBudget", 8192)
+			out, _ = sjson.Set(out, "generationConfig.thinkingConfig.thinkingBudget", util.ReasoningBudget(modelName, "medium", 8192))
 		case "high":
-			out, _ = sjson.Set(out, "generationConfig.thinkingConfig.thinkingBudget", 24576)
+			out, _ = sjson.Set(out, "generationConfig.thinkingConfig.thinkingBudget", util.ReasoningBudget(modelName, "high", 24576))
 		default:
 			out, _ = sjson.Set(out, "generationConfig.thinkingConfig.thinkingBudget", -1)
 		}
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/luispater/CLIProxyAPI/v5/internal/util"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
 )
@@ -194,6 +195,7 @@ func ConvertGeminiResponseToOpenAIResponses(_ context.Context, modelName string,
 					st.FuncCallIDs[idx] = fmt.Sprintf("call_%d", time.Now().UnixNano())
 				}
 				st.FuncNames[idx] = name
+				util.CacheThoughtSignature(st.FuncCallIDs[idx], part.Get("thoughtSignature").String())
 
 				// Emit item.added for function call
 				item := `{"type":"response.output_item.added","sequence_number":0,"output_index":0,"item":{"id":"","type":"function_call","status":"in_progress","arguments":"","call_id":"","name":""}}`
@@ -537,6 +539,7 @@ func ConvertGeminiResponseToOpenAIResponsesNonStream(_ context.Context, _ string
 				name := fc.Get("name").String()
 				args := fc.Get("args")
 				callID := fmt.Sprintf("call_%x", time.Now().UnixNano())
+				util.CacheThoughtSignature(callID, p.Get("thoughtSignature").String())
 				outputs = append(outputs, map[string]interface{}{
 					"id":     fmt.Sprintf("fc_%s", callID),
 					"type":   "function_call",
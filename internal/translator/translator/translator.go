@@ -2,56 +2,123 @@ package translator
 
 import (
 	"context"
+	"mime"
+	"sync"
 
 	"github.com/luispater/CLIProxyAPI/v5/internal/interfaces"
 	log "github.com/sirupsen/logrus"
 )
 
 var (
-	Requests  map[string]map[string]interfaces.TranslateRequestFunc
-	Responses map[string]map[string]interfaces.TranslateResponse
+	// Translators maps an inbound format and a client format to the translator between them.
+	Translators map[string]map[string]interfaces.Translator
+
+	inboundMutex   sync.RWMutex
+	inboundFormats map[inboundKey]string
 )
 
+// inboundKey identifies a registered inbound format by route and content type.
+type inboundKey struct {
+	route       string
+	contentType string
+}
+
 func init() {
-	Requests = make(map[string]map[string]interfaces.TranslateRequestFunc)
-	Responses = make(map[string]map[string]interfaces.TranslateResponse)
+	Translators = make(map[string]map[string]interfaces.Translator)
+	inboundFormats = make(map[inboundKey]string)
 }
 
+// Register registers a translator built from a request function and a pair of
+// response functions. It is kept for the built-in formats, which are implemented
+// as plain functions.
 func Register(from, to string, request interfaces.TranslateRequestFunc, response interfaces.TranslateResponse) {
+	RegisterTranslator(from, to, interfaces.TranslatorFuncs{Request: request, Response: response})
+}
+
+// RegisterTranslator registers a translator from an inbound format to a client format.
+// Registering the same pair twice replaces the previous translator.
+//
+// Parameters:
+//   - from: The inbound format, as returned by the handler's HandlerType
+//   - to: The client format
+//   - t: The translator
+func RegisterTranslator(from, to string, t interfaces.Translator) {
 	log.Debugf("Registering translator from %s to %s", from, to)
-	if _, ok := Requests[from]; !ok {
-		Requests[from] = make(map[string]interfaces.TranslateRequestFunc)
+	if _, ok := Translators[from]; !ok {
+		Translators[from] = make(map[string]interfaces.Translator)
 	}
-	Requests[from][to] = request
+	Translators[from][to] = t
+}
 
-	if _, ok := Responses[from]; !ok {
-		Responses[from] = make(map[string]interfaces.TranslateResponse)
+// RegisterInbound maps requests on a route and content type to an inbound format, so that
+// a custom format can be served without a dedicated handler. An empty route or content type
+// matches any value.
+//
+// Parameters:
+//   - route: The gin route path, for example "/v1/chat/completions"
+//   - contentType: The request media type, for example "application/vnd.example+json"
+//   - from: The inbound format that translators are registered under
+func RegisterInbound(route, contentType, from string) {
+	log.Debugf("Registering inbound format %s for route %q and content type %q", from, route, contentType)
+	inboundMutex.Lock()
+	inboundFormats[inboundKey{route: route, contentType: contentType}] = from
+	inboundMutex.Unlock()
+}
+
+// InboundFormat returns the inbound format registered for a route and content type.
+// An exact match is preferred over a content-type-only match, which is preferred over
+// a route-only match.
+//
+// Parameters:
+//   - route: The gin route path
+//   - contentType: The raw Content-Type header of the request
+//
+// Returns:
+//   - string: The registered inbound format
+//   - bool: True if a format was registered
+func InboundFormat(route, contentType string) (string, bool) {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = mediaType
+	}
+
+	inboundMutex.RLock()
+	defer inboundMutex.RUnlock()
+	if len(inboundFormats) == 0 {
+		return "", false
+	}
+	for _, key := range []inboundKey{{route, contentType}, {"", contentType}, {route, ""}} {
+		if key.route == "" && key.contentType == "" {
+			continue
+		}
+		if from, ok := inboundFormats[key]; ok {
+			return from, true
+		}
 	}
-	Responses[from][to] = response
+	return "", false
 }
 
 func Request(from, to, modelName string, rawJSON []byte, stream bool) []byte {
-	if translator, ok := Requests[from][to]; ok {
-		return translator(modelName, rawJSON, stream)
+	if translator, ok := Translators[from][to]; ok {
+		return translator.ParseRequest(modelName, rawJSON, stream)
 	}
 	return rawJSON
 }
 
 func NeedConvert(from, to string) bool {
-	_, ok := Responses[from][to]
+	_, ok := Translators[from][to]
 	return ok
 }
 
 func Response(from, to string, ctx context.Context, modelName string, originalRequestRawJSON, requestRawJSON, rawJSON []byte, param *any) []string {
-	if translator, ok := Responses[from][to]; ok {
-		return translator.Stream(ctx, modelName, originalRequestRawJSON, requestRawJSON, rawJSON, param)
+	if translator, ok := Translators[from][to]; ok {
+		return translator.FormatStream(ctx, modelName, originalRequestRawJSON, requestRawJSON, rawJSON, param)
 	}
 	return []string{string(rawJSON)}
 }
 
 func ResponseNonStream(from, to string, ctx context.Context, modelName string, originalRequestRawJSON, requestRawJSON, rawJSON []byte, param *any) string {
-	if translator, ok := Responses[from][to]; ok {
-		return translator.NonStream(ctx, modelName, originalRequestRawJSON, requestRawJSON, rawJSON, param)
+	if translator, ok := Translators[from][to]; ok {
+		return translator.FormatResponse(ctx, modelName, originalRequestRawJSON, requestRawJSON, rawJSON, param)
 	}
 	return string(rawJSON)
 }
@@ -0,0 +1,99 @@
+package translator
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// lineTranslator is a custom inbound format whose requests are {"say": "..."} and whose
+// responses are plain text.
+type lineTranslator struct{}
+
+func (lineTranslator) ParseRequest(modelName string, rawJSON []byte, _ bool) []byte {
+	out, _ := sjson.SetBytes([]byte(`{"contents":[{"role":"user","parts":[{"text":""}]}]}`), "contents.0.parts.0.text", gjson.GetBytes(rawJSON, "say").String())
+	out, _ = sjson.SetBytes(out, "model", modelName)
+	return out
+}
+
+func (lineTranslator) FormatStream(_ context.Context, _ string, _, _, rawJSON []byte, _ *any) []string {
+	return []string{gjson.GetBytes(rawJSON, "candidates.0.content.parts.0.text").String()}
+}
+
+func (lineTranslator) FormatResponse(_ context.Context, _ string, _, _, rawJSON []byte, _ *any) string {
+	return strings.ToUpper(gjson.GetBytes(rawJSON, "candidates.0.content.parts.0.text").String())
+}
+
+func TestCustomTranslatorRoundTrip(t *testing.T) {
+	RegisterTranslator("line-test", "gemini-test", lineTranslator{})
+	t.Cleanup(func() { delete(Translators, "line-test") })
+
+	if !NeedConvert("line-test", "gemini-test") {
+		t.Fatal("NeedConvert() = false, want true for a registered translator")
+	}
+	request := Request("line-test", "gemini-test", "gemini-2.5-pro", []byte(`{"say":"hello"}`), false)
+	if got := gjson.GetBytes(request, "contents.0.parts.0.text").String(); got != "hello" {
+		t.Errorf("request text = %q, want %q", got, "hello")
+	}
+	if got := gjson.GetBytes(request, "model").String(); got != "gemini-2.5-pro" {
+		t.Errorf("request model = %q, want %q", got, "gemini-2.5-pro")
+	}
+
+	upstream := []byte(`{"candidates":[{"content":{"parts":[{"text":"hi there"}]}}]}`)
+	var param any
+	if got := ResponseNonStream("line-test", "gemini-test", context.Background(), "gemini-2.5-pro", nil, request, upstream, &param); got != "HI THERE" {
+		t.Errorf("ResponseNonStream() = %q, want %q", got, "HI THERE")
+	}
+	if got := Response("line-test", "gemini-test", context.Background(), "gemini-2.5-pro", nil, request, upstream, &param); len(got) != 1 || got[0] != "hi there" {
+		t.Errorf("Response() = %q, want [hi there]", got)
+	}
+}
+
+func TestUnregisteredFormatsPassThrough(t *testing.T) {
+	raw := []byte(`{"say":"hello"}`)
+	if NeedConvert("line-unknown", "gemini-test") {
+		t.Error("NeedConvert() = true, want false without a translator")
+	}
+	if got := Request("line-unknown", "gemini-test", "m", raw, false); string(got) != string(raw) {
+		t.Errorf("Request() = %s, want the request unchanged", got)
+	}
+	if got := ResponseNonStream("line-unknown", "gemini-test", context.Background(), "m", nil, nil, raw, nil); got != string(raw) {
+		t.Errorf("ResponseNonStream() = %s, want the response unchanged", got)
+	}
+}
+
+func TestInboundFormat(t *testing.T) {
+	RegisterInbound("/v1/lines", "application/vnd.lines+json", "lines-exact")
+	RegisterInbound("", "application/vnd.lines+json", "lines-type")
+	RegisterInbound("/v1/plain", "", "lines-route")
+	t.Cleanup(func() {
+		inboundMutex.Lock()
+		inboundFormats = make(map[inboundKey]string)
+		inboundMutex.Unlock()
+	})
+
+	tests := []struct {
+		name        string
+		route       string
+		contentType string
+		want        string
+		wantOK      bool
+	}{
+		{name: "exact match", route: "/v1/lines", contentType: "application/vnd.lines+json", want: "lines-exact", wantOK: true},
+		{name: "media type parameters ignored", route: "/v1/lines", contentType: "application/vnd.lines+json; charset=utf-8", want: "lines-exact", wantOK: true},
+		{name: "content type on any route", route: "/v1/other", contentType: "application/vnd.lines+json", want: "lines-type", wantOK: true},
+		{name: "route with any content type", route: "/v1/plain", contentType: "application/json", want: "lines-route", wantOK: true},
+		{name: "no match", route: "/v1/chat/completions", contentType: "application/json", wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := InboundFormat(tt.route, tt.contentType)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("InboundFormat(%q, %q) = %q, %t, want %q, %t", tt.route, tt.contentType, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
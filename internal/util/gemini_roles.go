@@ -0,0 +1,90 @@
+package util
+
+import (
+	"strconv"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// NormalizeGeminiRoles makes the contents of a native Gemini request acceptable to Gemini,
+// which rejects any role but "user" and "model" with "Please use a valid role":
+//   - Contents with the "system" role are moved into the system instruction.
+//   - "assistant" becomes "model"; "function" and "tool" become "user".
+//   - A missing or unknown role becomes "user" for the first content and then alternates
+//     with the previous role.
+//   - Consecutive contents with the same role are merged into one.
+//
+// Parameters:
+//   - rawJSON: The Gemini request
+//   - pathPrefix: The prefix of the Gemini request body ("request." for Gemini CLI, "" for Gemini)
+//
+// Returns:
+//   - []byte: The request with normalized contents
+func NormalizeGeminiRoles(rawJSON []byte, pathPrefix string) []byte {
+	contents := gjson.GetBytes(rawJSON, pathPrefix+"contents")
+	if !contents.IsArray() {
+		return rawJSON
+	}
+
+	normalized := "[]"
+	var systemParts []string
+	prevRole := ""
+	changed := false
+	count := 0
+	for _, content := range contents.Array() {
+		role := content.Get("role").String()
+		switch role {
+		case "user", "model":
+		case "system":
+			for _, part := range content.Get("parts").Array() {
+				systemParts = append(systemParts, part.Raw)
+			}
+			changed = true
+			continue
+		case "assistant":
+			role = "model"
+		case "function", "tool":
+			role = "user"
+		default:
+			if prevRole == "user" {
+				role = "model"
+			} else {
+				role = "user"
+			}
+		}
+		if role != content.Get("role").String() {
+			changed = true
+		}
+
+		if role == prevRole {
+			for _, part := range content.Get("parts").Array() {
+				normalized, _ = sjson.SetRaw(normalized, strconv.Itoa(count-1)+".parts.-1", part.Raw)
+			}
+			changed = true
+			continue
+		}
+		item, _ := sjson.Set(content.Raw, "role", role)
+		normalized, _ = sjson.SetRaw(normalized, "-1", item)
+		prevRole = role
+		count++
+	}
+	if !changed {
+		return rawJSON
+	}
+
+	rawJSON, _ = sjson.SetRawBytes(rawJSON, pathPrefix+"contents", []byte(normalized))
+	if len(systemParts) > 0 {
+		systemKey := pathPrefix + "systemInstruction"
+		if !gjson.GetBytes(rawJSON, systemKey).Exists() && gjson.GetBytes(rawJSON, pathPrefix+"system_instruction").Exists() {
+			systemKey = pathPrefix + "system_instruction"
+		}
+		if !gjson.GetBytes(rawJSON, systemKey+".parts").IsArray() {
+			rawJSON, _ = sjson.SetRawBytes(rawJSON, systemKey+".parts", []byte("[]"))
+		}
+		for _, part := range systemParts {
+			rawJSON, _ = sjson.SetRawBytes(rawJSON, systemKey+".parts.-1", []byte(part))
+		}
+	}
+	return rawJSON
+}
@@ -0,0 +1,106 @@
+package util
+
+import (
+	"strings"
+	"unicode"
+)
+
+// languageInfo describes a language for response-language: its English name and the Unicode
+// scripts its text is written in.
+type languageInfo struct {
+	name    string
+	scripts []*unicode.RangeTable
+}
+
+var (
+	latinScripts    = []*unicode.RangeTable{unicode.Latin}
+	cyrillicScripts = []*unicode.RangeTable{unicode.Cyrillic}
+)
+
+// languages maps ISO 639-1 codes to the languages response-language can check.
+var languages = map[string]languageInfo{
+	"ar": {"Arabic", []*unicode.RangeTable{unicode.Arabic}},
+	"bg": {"Bulgarian", cyrillicScripts},
+	"de": {"German", latinScripts},
+	"el": {"Greek", []*unicode.RangeTable{unicode.Greek}},
+	"en": {"English", latinScripts},
+	"es": {"Spanish", latinScripts},
+	"fa": {"Persian", []*unicode.RangeTable{unicode.Arabic}},
+	"fr": {"French", latinScripts},
+	"he": {"Hebrew", []*unicode.RangeTable{unicode.Hebrew}},
+	"hi": {"Hindi", []*unicode.RangeTable{unicode.Devanagari}},
+	"id": {"Indonesian", latinScripts},
+	"it": {"Italian", latinScripts},
+	"ja": {"Japanese", []*unicode.RangeTable{unicode.Hiragana, unicode.Katakana, unicode.Han}},
+	"ko": {"Korean", []*unicode.RangeTable{unicode.Hangul, unicode.Han}},
+	"nl": {"Dutch", latinScripts},
+	"pl": {"Polish", latinScripts},
+	"pt": {"Portuguese", latinScripts},
+	"ru": {"Russian", cyrillicScripts},
+	"sv": {"Swedish", latinScripts},
+	"th": {"Thai", []*unicode.RangeTable{unicode.Thai}},
+	"tr": {"Turkish", latinScripts},
+	"uk": {"Ukrainian", cyrillicScripts},
+	"vi": {"Vietnamese", latinScripts},
+	"zh": {"Chinese", []*unicode.RangeTable{unicode.Han}},
+}
+
+// lookupLanguage finds a language by ISO 639-1 code or English name, case-insensitively.
+func lookupLanguage(language string) (languageInfo, bool) {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if info, ok := languages[language]; ok {
+		return info, true
+	}
+	for _, info := range languages {
+		if strings.ToLower(info.name) == language {
+			return info, true
+		}
+	}
+	return languageInfo{}, false
+}
+
+// LanguageName returns the English name of a language given as an ISO 639-1 code or name,
+// for use in instructions to the model. Unknown languages are returned unchanged.
+//
+// Parameters:
+//   - language: The configured language
+//
+// Returns:
+//   - string: The English name of the language
+func LanguageName(language string) string {
+	if info, ok := lookupLanguage(language); ok {
+		return info.name
+	}
+	return strings.TrimSpace(language)
+}
+
+// LanguageMismatch reports whether a text is evidently not written in a language, using the
+// share of its letters that belong to the scripts of the language. Short texts, texts that
+// are mostly code or numbers, and languages without a known script are never reported.
+//
+// Parameters:
+//   - language: The configured language
+//   - text: The response text
+//
+// Returns:
+//   - bool: True if fewer than half of the letters of the text are in the language's scripts
+func LanguageMismatch(language, text string) bool {
+	info, ok := lookupLanguage(language)
+	if !ok {
+		return false
+	}
+
+	letters, matching := 0, 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if unicode.IsOneOf(info.scripts, r) {
+			matching++
+		}
+	}
+	// A few dozen letters are needed before the script of a text is meaningful.
+	const minLetters = 20
+	return letters >= minLetters && matching*2 < letters
+}
@@ -0,0 +1,47 @@
+package util
+
+import "testing"
+
+func TestLanguageName(t *testing.T) {
+	tests := []struct {
+		language string
+		want     string
+	}{
+		{language: "ja", want: "Japanese"},
+		{language: " DE ", want: "German"},
+		{language: "japanese", want: "Japanese"},
+		{language: "Klingon", want: "Klingon"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.language, func(t *testing.T) {
+			if got := LanguageName(tt.language); got != tt.want {
+				t.Errorf("LanguageName(%q) = %q, want %q", tt.language, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLanguageMismatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		language string
+		text     string
+		want     bool
+	}{
+		{name: "matching script", language: "ja", text: "今日の東京の天気は晴れで、とても暖かいです。", want: false},
+		{name: "other script", language: "ja", text: "The weather in Tokyo is sunny and warm today.", want: true},
+		{name: "Cyrillic for English", language: "English", text: "Сегодня в Москве солнечно и очень тепло.", want: true},
+		{name: "same script is not checked further", language: "fr", text: "The weather in Paris is sunny and warm today.", want: false},
+		{name: "short text", language: "ja", text: "OK, done.", want: false},
+		{name: "mostly code", language: "ja", text: "x := 1 + 2 // 42", want: false},
+		{name: "unknown language", language: "Klingon", text: "The weather in Tokyo is sunny and warm today.", want: false},
+		{name: "mixed text mostly in the language", language: "ja", text: "東京の天気予報によると今日は晴れで暖かいでしょう。Tokyo weather", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LanguageMismatch(tt.language, tt.text); got != tt.want {
+				t.Errorf("LanguageMismatch(%q, %q) = %t, want %t", tt.language, tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -113,6 +113,24 @@ func InArray(hystack []string, needle string) bool {
 	return false
 }
 
+// AccountLabel returns the label that identifies an account in logs and metrics: the alias
+// configured in account-aliases, or the masked e-mail.
+//
+// Parameters:
+//   - cfg: The application configuration
+//   - email: The e-mail (or API key) of the account
+//
+// Returns:
+//   - string: The label of the account
+func AccountLabel(cfg *config.Config, email string) string {
+	if cfg != nil {
+		if alias, ok := cfg.AccountAliases[email]; ok && alias != "" {
+			return alias
+		}
+	}
+	return HideAPIKey(email)
+}
+
 // HideAPIKey obscures an API key for logging purposes, showing only the first and last few characters.
 //
 // Parameters:
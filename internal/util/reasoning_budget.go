@@ -0,0 +1,43 @@
+package util
+
+import (
+	"sync"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+)
+
+var (
+	reasoningBudgetsMutex sync.RWMutex
+	reasoningBudgets      map[string]config.ReasoningBudget
+)
+
+// SetReasoningBudgets applies the reasoning-budgets setting of the configuration, the per-model
+// thinking budgets used when translating a reasoning effort to a Gemini thinkingBudget.
+func SetReasoningBudgets(cfg *config.Config) {
+	reasoningBudgetsMutex.Lock()
+	reasoningBudgets = cfg.ReasoningBudgets
+	reasoningBudgetsMutex.Unlock()
+}
+
+// ReasoningBudget returns the thinking budget configured for a model and reasoning effort.
+// A model's own entry takes precedence over the "*" entry, which overrides the built-in
+// budget for all models.
+//
+// Parameters:
+//   - modelName: The model of the request
+//   - effort: The reasoning effort (low, medium, or high)
+//   - fallback: The built-in budget, used when no entry configures the effort
+//
+// Returns:
+//   - int: The thinking budget
+func ReasoningBudget(modelName, effort string, fallback int) int {
+	reasoningBudgetsMutex.RLock()
+	defer reasoningBudgetsMutex.RUnlock()
+
+	for _, key := range []string{modelName, "*"} {
+		if budget := reasoningBudgets[key].ForEffort(effort); budget != 0 {
+			return budget
+		}
+	}
+	return fallback
+}
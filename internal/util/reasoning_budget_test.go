@@ -0,0 +1,45 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/luispater/CLIProxyAPI/v5/internal/config"
+)
+
+func TestReasoningBudget(t *testing.T) {
+	SetReasoningBudgets(&config.Config{ReasoningBudgets: map[string]config.ReasoningBudget{
+		"gemini-2.5-flash": {Low: 512, High: 12000},
+		"gemini-2.5-pro":   {High: 32768},
+		"*":                {Medium: 4096, High: 16384},
+	}})
+	t.Cleanup(func() { SetReasoningBudgets(&config.Config{}) })
+
+	tests := []struct {
+		name     string
+		model    string
+		effort   string
+		fallback int
+		want     int
+	}{
+		{name: "model entry", model: "gemini-2.5-flash", effort: "high", fallback: 24576, want: 12000},
+		{name: "other model entry", model: "gemini-2.5-pro", effort: "high", fallback: 24576, want: 32768},
+		{name: "model without the effort uses the wildcard", model: "gemini-2.5-flash", effort: "medium", fallback: 8192, want: 4096},
+		{name: "model without an entry uses the wildcard", model: "gemini-2.5-flash-lite", effort: "high", fallback: 24576, want: 16384},
+		{name: "built-in budget", model: "gemini-2.5-flash-lite", effort: "low", fallback: 1024, want: 1024},
+		{name: "unknown effort", model: "gemini-2.5-flash", effort: "extreme", fallback: 8192, want: 8192},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ReasoningBudget(tt.model, tt.effort, tt.fallback); got != tt.want {
+				t.Errorf("ReasoningBudget(%q, %q, %d) = %d, want %d", tt.model, tt.effort, tt.fallback, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReasoningBudgetWithoutConfiguration(t *testing.T) {
+	SetReasoningBudgets(&config.Config{})
+	if got := ReasoningBudget("gemini-2.5-pro", "high", 24576); got != 24576 {
+		t.Errorf("ReasoningBudget() = %d, want the built-in budget %d", got, 24576)
+	}
+}
@@ -0,0 +1,86 @@
+package util
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const (
+	// thoughtSignatureTTL is how long a tool call's thought signature is remembered.
+	thoughtSignatureTTL = time.Hour
+
+	// maxThoughtSignatures bounds the number of remembered signatures; the oldest are
+	// evicted first.
+	maxThoughtSignatures = 10000
+)
+
+type thoughtSignatureEntry struct {
+	toolCallID string
+	signature  string
+	expiresAt  time.Time
+}
+
+var (
+	thoughtSignatureMutex sync.Mutex
+	// thoughtSignatures indexes the elements of thoughtSignatureOrder by tool call ID.
+	thoughtSignatures = make(map[string]*list.Element)
+	// thoughtSignatureOrder holds the entries oldest first. As every entry lives for the same
+	// TTL, this is also the order in which they expire.
+	thoughtSignatureOrder = list.New()
+)
+
+// CacheThoughtSignature remembers the Gemini thought signature attached to a tool call,
+// so that it can be re-attached when the client echoes the tool call back in a later
+// turn without preserving the signature itself.
+//
+// Parameters:
+//   - toolCallID: The tool call ID emitted to the client
+//   - signature: The thoughtSignature returned by Gemini
+func CacheThoughtSignature(toolCallID, signature string) {
+	if toolCallID == "" || signature == "" {
+		return
+	}
+
+	now := time.Now()
+	thoughtSignatureMutex.Lock()
+	defer thoughtSignatureMutex.Unlock()
+
+	if element, ok := thoughtSignatures[toolCallID]; ok {
+		thoughtSignatureOrder.Remove(element)
+	}
+	entry := &thoughtSignatureEntry{toolCallID: toolCallID, signature: signature, expiresAt: now.Add(thoughtSignatureTTL)}
+	thoughtSignatures[toolCallID] = thoughtSignatureOrder.PushBack(entry)
+
+	// Only the oldest entries can have expired, so eviction stops at the first live one.
+	for oldest := thoughtSignatureOrder.Front(); oldest != nil; oldest = thoughtSignatureOrder.Front() {
+		entry = oldest.Value.(*thoughtSignatureEntry)
+		if thoughtSignatureOrder.Len() <= maxThoughtSignatures && !now.After(entry.expiresAt) {
+			break
+		}
+		thoughtSignatureOrder.Remove(oldest)
+		delete(thoughtSignatures, entry.toolCallID)
+	}
+}
+
+// GetThoughtSignature returns the cached thought signature for a tool call.
+//
+// Parameters:
+//   - toolCallID: The tool call ID sent back by the client
+//
+// Returns:
+//   - string: The cached signature, or an empty string if none is known
+func GetThoughtSignature(toolCallID string) string {
+	thoughtSignatureMutex.Lock()
+	defer thoughtSignatureMutex.Unlock()
+
+	element, ok := thoughtSignatures[toolCallID]
+	if !ok {
+		return ""
+	}
+	entry := element.Value.(*thoughtSignatureEntry)
+	if time.Now().After(entry.expiresAt) {
+		return ""
+	}
+	return entry.signature
+}
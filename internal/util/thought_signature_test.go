@@ -0,0 +1,59 @@
+package util
+
+import (
+	"container/list"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// resetThoughtSignatures empties the thought signature cache.
+func resetThoughtSignatures(t *testing.T) {
+	t.Helper()
+	thoughtSignatureMutex.Lock()
+	defer thoughtSignatureMutex.Unlock()
+	thoughtSignatures = make(map[string]*list.Element)
+	thoughtSignatureOrder.Init()
+}
+
+func TestThoughtSignatureCacheIsBounded(t *testing.T) {
+	resetThoughtSignatures(t)
+	t.Cleanup(func() { resetThoughtSignatures(t) })
+
+	for i := 0; i < maxThoughtSignatures+10; i++ {
+		CacheThoughtSignature(fmt.Sprintf("call-%d", i), fmt.Sprintf("signature-%d", i))
+	}
+
+	if n := len(thoughtSignatures); n != maxThoughtSignatures {
+		t.Errorf("cached signatures = %d, want %d", n, maxThoughtSignatures)
+	}
+	if got := GetThoughtSignature("call-9"); got != "" {
+		t.Errorf("oldest signature = %q, want it evicted", got)
+	}
+	last := maxThoughtSignatures + 9
+	if got, want := GetThoughtSignature(fmt.Sprintf("call-%d", last)), fmt.Sprintf("signature-%d", last); got != want {
+		t.Errorf("newest signature = %q, want %q", got, want)
+	}
+}
+
+func TestThoughtSignatureCacheEvictsExpiredEntries(t *testing.T) {
+	resetThoughtSignatures(t)
+	t.Cleanup(func() { resetThoughtSignatures(t) })
+
+	CacheThoughtSignature("expired", "signature-1")
+	CacheThoughtSignature("live", "signature-2")
+	thoughtSignatureMutex.Lock()
+	thoughtSignatures["expired"].Value.(*thoughtSignatureEntry).expiresAt = time.Now().Add(-time.Second)
+	thoughtSignatureMutex.Unlock()
+
+	if got := GetThoughtSignature("expired"); got != "" {
+		t.Errorf("expired signature = %q, want none", got)
+	}
+	CacheThoughtSignature("new", "signature-3")
+	if _, ok := thoughtSignatures["expired"]; ok {
+		t.Error("the expired signature was not evicted")
+	}
+	if got := GetThoughtSignature("live"); got != "signature-2" {
+		t.Errorf("live signature = %q, want %q", got, "signature-2")
+	}
+}
@@ -6,6 +6,7 @@ package util
 import (
 	"bytes"
 	"fmt"
+	"strings"
 
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
@@ -264,6 +265,186 @@ func SanitizeSchemaForGemini(schemaJSON string) (string, error) {
 	return result, nil
 }
 
+// GeminiResponseFormat maps the structured output settings of an OpenAI request to the Gemini
+// responseMimeType and responseSchema. It reads the OpenAI response format at formatPath
+// (response_format for Chat Completions, text.format for Responses) and the Gemini-style
+// response_mime_type and response_schema fields. A json_object format maps to JSON mode and a
+// json_schema format to JSON mode with the sanitized schema.
+//
+// Parameters:
+//   - request: The parsed OpenAI request
+//   - formatPath: The path of the OpenAI response format
+//
+// Returns:
+//   - string: The response MIME type, empty if the request does not set one
+//   - string: The raw response schema, empty if the request does not set one
+func GeminiResponseFormat(request gjson.Result, formatPath string) (string, string) {
+	mimeType := request.Get("response_mime_type").String()
+	schema := request.Get("response_schema")
+
+	format := request.Get(formatPath)
+	switch format.Get("type").String() {
+	case "json_object":
+		mimeType = "application/json"
+	case "json_schema":
+		mimeType = "application/json"
+		if formatSchema := format.Get("json_schema.schema"); formatSchema.Exists() {
+			schema = formatSchema
+		} else if formatSchema = format.Get("schema"); formatSchema.Exists() {
+			schema = formatSchema
+		}
+	}
+
+	if !schema.IsObject() {
+		return mimeType, ""
+	}
+	if mimeType == "" {
+		mimeType = "application/json"
+	}
+	sanitized, err := SanitizeSchemaForGemini(schema.Raw)
+	if err != nil {
+		return mimeType, schema.Raw
+	}
+	return mimeType, sanitized
+}
+
+// GeminiSafetySettings maps the safety settings of an OpenAI or Claude request to the Gemini
+// safetySettings array. Both safety_settings and safetySettings are read, and the category
+// and threshold of each setting are kept.
+//
+// Parameters:
+//   - request: The parsed request
+//
+// Returns:
+//   - string: The raw safetySettings array, empty if the request does not set any
+func GeminiSafetySettings(request gjson.Result) string {
+	settings := request.Get("safety_settings")
+	if !settings.Exists() {
+		settings = request.Get("safetySettings")
+	}
+	if !settings.IsArray() {
+		return ""
+	}
+
+	out := "[]"
+	for _, setting := range settings.Array() {
+		category, threshold := setting.Get("category"), setting.Get("threshold")
+		if category.Type != gjson.String || threshold.Type != gjson.String {
+			continue
+		}
+		item := `{"category":"","threshold":""}`
+		item, _ = sjson.Set(item, "category", category.String())
+		item, _ = sjson.Set(item, "threshold", threshold.String())
+		out, _ = sjson.SetRaw(out, "-1", item)
+	}
+	if out == "[]" {
+		return ""
+	}
+	return out
+}
+
+// OpenAIUsage converts the usageMetadata of a Gemini response into an OpenAI usage object.
+// Thinking tokens are output tokens, so they count as completion tokens and are reported as
+// reasoning tokens too; cached prompt tokens are reported as cached tokens.
+//
+// Parameters:
+//   - usageMetadata: The usageMetadata of the Gemini response
+//
+// Returns:
+//   - string: The raw OpenAI usage object
+func OpenAIUsage(usageMetadata gjson.Result) string {
+	promptTokens := usageMetadata.Get("promptTokenCount").Int()
+	thoughtsTokens := usageMetadata.Get("thoughtsTokenCount").Int()
+	completionTokens := usageMetadata.Get("candidatesTokenCount").Int() + thoughtsTokens
+	totalTokens := usageMetadata.Get("totalTokenCount").Int()
+	if totalTokens == 0 {
+		totalTokens = promptTokens + completionTokens
+	}
+
+	usage := `{"prompt_tokens":0,"completion_tokens":0,"total_tokens":0}`
+	usage, _ = sjson.Set(usage, "prompt_tokens", promptTokens)
+	usage, _ = sjson.Set(usage, "completion_tokens", completionTokens)
+	usage, _ = sjson.Set(usage, "total_tokens", totalTokens)
+	if cachedTokens := usageMetadata.Get("cachedContentTokenCount").Int(); cachedTokens > 0 {
+		usage, _ = sjson.Set(usage, "prompt_tokens_details.cached_tokens", cachedTokens)
+	}
+	if thoughtsTokens > 0 {
+		usage, _ = sjson.Set(usage, "completion_tokens_details.reasoning_tokens", thoughtsTokens)
+	}
+	return usage
+}
+
+// OpenAIURLCitations converts the groundingMetadata of a Gemini response grounded with
+// Google Search into OpenAI url_citation annotations. Each grounding support yields an
+// annotation for every web source it cites, spanning the supported segment; if the metadata
+// has sources but no supports, every source is cited without a span.
+//
+// Parameters:
+//   - groundingMetadata: The groundingMetadata of the Gemini response candidate
+//
+// Returns:
+//   - string: The raw array of annotations, or "" if the response cites no web sources
+func OpenAIURLCitations(groundingMetadata gjson.Result) string {
+	chunks := groundingMetadata.Get("groundingChunks").Array()
+	citation := func(chunk gjson.Result, start, end int64) string {
+		annotation := `{"type":"url_citation","url_citation":{"url":"","title":"","start_index":0,"end_index":0}}`
+		annotation, _ = sjson.Set(annotation, "url_citation.url", chunk.Get("web.uri").String())
+		annotation, _ = sjson.Set(annotation, "url_citation.title", chunk.Get("web.title").String())
+		annotation, _ = sjson.Set(annotation, "url_citation.start_index", start)
+		annotation, _ = sjson.Set(annotation, "url_citation.end_index", end)
+		return annotation
+	}
+
+	annotations := "[]"
+	count := 0
+	for _, support := range groundingMetadata.Get("groundingSupports").Array() {
+		start, end := support.Get("segment.startIndex").Int(), support.Get("segment.endIndex").Int()
+		for _, index := range support.Get("groundingChunkIndices").Array() {
+			if i := int(index.Int()); i >= 0 && i < len(chunks) && chunks[i].Get("web").Exists() {
+				annotations, _ = sjson.SetRaw(annotations, "-1", citation(chunks[i], start, end))
+				count++
+			}
+		}
+	}
+	if count == 0 {
+		for _, chunk := range chunks {
+			if chunk.Get("web").Exists() {
+				annotations, _ = sjson.SetRaw(annotations, "-1", citation(chunk, 0, 0))
+				count++
+			}
+		}
+	}
+	if count == 0 {
+		return ""
+	}
+	return annotations
+}
+
+// ClaudeSystemText returns the text of the system field of an Anthropic Messages request,
+// which is either a string or an array of content blocks. The text blocks of an array are
+// concatenated, separated by blank lines; other blocks are ignored.
+//
+// Parameters:
+//   - system: The system field of the request
+//
+// Returns:
+//   - string: The system prompt, empty if the request has none
+func ClaudeSystemText(system gjson.Result) string {
+	if system.Type == gjson.String {
+		return system.String()
+	}
+	if !system.IsArray() {
+		return ""
+	}
+	texts := make([]string, 0)
+	for _, block := range system.Array() {
+		if block.Get("type").String() == "text" && block.Get("text").String() != "" {
+			texts = append(texts, block.Get("text").String())
+		}
+	}
+	return strings.Join(texts, "\n\n")
+}
+
 // sanitizeTypeFields converts type arrays to single types for Gemini compatibility
 func sanitizeTypeFields(jsonStr string) string {
 	// Parse the JSON to find all "type" fields
@@ -0,0 +1,62 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestClaudeSystemText(t *testing.T) {
+	tests := []struct {
+		name   string
+		system string
+		want   string
+	}{
+		{name: "string", system: `"Be brief."`, want: "Be brief."},
+		{name: "text blocks", system: `[{"type":"text","text":"Be brief."},{"type":"text","text":"Use English."}]`, want: "Be brief.\n\nUse English."},
+		{name: "other and empty blocks skipped", system: `[{"type":"text","text":""},{"type":"document"},{"type":"text","text":"Be brief."}]`, want: "Be brief."},
+		{name: "missing", system: `null`, want: ""},
+		{name: "object", system: `{"text":"Be brief."}`, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClaudeSystemText(gjson.Parse(tt.system)); got != tt.want {
+				t.Errorf("ClaudeSystemText(%s) = %q, want %q", tt.system, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenAIURLCitations(t *testing.T) {
+	const chunks = `"groundingChunks":[{"web":{"uri":"https://a.example","title":"A"}},{"retrievedContext":{"uri":"gs://doc"}},{"web":{"uri":"https://b.example","title":"B"}}]`
+	tests := []struct {
+		name     string
+		metadata string
+		want     string
+	}{
+		{
+			name:     "supports",
+			metadata: `{` + chunks + `,"groundingSupports":[{"segment":{"startIndex":0,"endIndex":12},"groundingChunkIndices":[0,1,2]}]}`,
+			want:     `[{"type":"url_citation","url_citation":{"url":"https://a.example","title":"A","start_index":0,"end_index":12}},{"type":"url_citation","url_citation":{"url":"https://b.example","title":"B","start_index":0,"end_index":12}}]`,
+		},
+		{
+			name:     "sources without supports",
+			metadata: `{` + chunks + `}`,
+			want:     `[{"type":"url_citation","url_citation":{"url":"https://a.example","title":"A","start_index":0,"end_index":0}},{"type":"url_citation","url_citation":{"url":"https://b.example","title":"B","start_index":0,"end_index":0}}]`,
+		},
+		{
+			name:     "out of range index",
+			metadata: `{"groundingChunks":[{"web":{"uri":"https://a.example","title":"A"}}],"groundingSupports":[{"segment":{"startIndex":3,"endIndex":5},"groundingChunkIndices":[4]}]}`,
+			want:     `[{"type":"url_citation","url_citation":{"url":"https://a.example","title":"A","start_index":0,"end_index":0}}]`,
+		},
+		{name: "no web sources", metadata: `{"groundingChunks":[{"retrievedContext":{"uri":"gs://doc"}}]}`, want: ""},
+		{name: "missing", metadata: ``, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := OpenAIURLCitations(gjson.Parse(tt.metadata)); got != tt.want {
+				t.Errorf("OpenAIURLCitations() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -13,11 +13,13 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/luispater/CLIProxyAPI/v5/internal/auth"
 	"github.com/luispater/CLIProxyAPI/v5/internal/auth/claude"
 	"github.com/luispater/CLIProxyAPI/v5/internal/auth/codex"
 	"github.com/luispater/CLIProxyAPI/v5/internal/auth/gemini"
@@ -43,6 +45,7 @@ type Watcher struct {
 	watcher        *fsnotify.Watcher
 	lastAuthHashes map[string]string
 	lastConfigHash string
+	reloadRequests chan struct{}
 }
 
 const (
@@ -65,6 +68,7 @@ func NewWatcher(configPath, authDir string, reloadCallback func(map[string]inter
 		clients:        make(map[string]interfaces.Client),
 		apiKeyClients:  make(map[string]interfaces.Client),
 		lastAuthHashes: make(map[string]string),
+		reloadRequests: make(chan struct{}, 1),
 	}, nil
 }
 
@@ -132,10 +136,40 @@ func (w *Watcher) processEvents(ctx context.Context) {
 				return
 			}
 			log.Errorf("file watcher error: %v", errWatch)
+		case <-w.reloadRequests:
+			log.Infof("reload requested, reloading config: %s", w.configPath)
+			w.reloadConfigFile()
 		}
 	}
 }
 
+// RequestReload asks the watcher to reload the configuration file and the clients even if
+// the file is unchanged, e.g. on SIGHUP. The reload runs on the watcher's event loop, so it
+// never overlaps with a reload caused by a file change. In-flight requests keep the
+// configuration they started with.
+func (w *Watcher) RequestReload() {
+	select {
+	case w.reloadRequests <- struct{}{}:
+	default:
+		// A reload is already pending.
+	}
+}
+
+// reloadConfigFile reloads the configuration file and records its hash.
+func (w *Watcher) reloadConfigFile() {
+	data, err := os.ReadFile(w.configPath)
+	if err != nil {
+		log.Errorf("failed to read config file: %v", err)
+		return
+	}
+	sum := sha256.Sum256(data)
+	if w.reloadConfig() {
+		w.clientsMutex.Lock()
+		w.lastConfigHash = hex.EncodeToString(sum[:])
+		w.clientsMutex.Unlock()
+	}
+}
+
 // handleEvent processes individual file system events
 func (w *Watcher) handleEvent(event fsnotify.Event) {
 	// Filter only relevant events: config file or auth-dir JSON files.
@@ -210,6 +244,7 @@ func (w *Watcher) reloadConfig() bool {
 	// Always apply the current log level based on the latest config.
 	// This ensures logrus reflects the desired level even if change detection misses.
 	util.SetLogLevel(newConfig)
+	util.SetReasoningBudgets(newConfig)
 	// Additional debug for visibility when the flag actually changes.
 	if oldConfig != nil && oldConfig.Debug != newConfig.Debug {
 		log.Debugf("log level updated - debug mode changed from %t to %t", oldConfig.Debug, newConfig.Debug)
@@ -221,21 +256,126 @@ func (w *Watcher) reloadConfig() bool {
 		if oldConfig.Port != newConfig.Port {
 			log.Debugf("  port: %d -> %d", oldConfig.Port, newConfig.Port)
 		}
+		if oldConfig.ListenSocket != newConfig.ListenSocket {
+			log.Debugf("  listen-socket: %s -> %s", oldConfig.ListenSocket, newConfig.ListenSocket)
+		}
 		if oldConfig.AuthDir != newConfig.AuthDir {
 			log.Debugf("  auth-dir: %s -> %s", oldConfig.AuthDir, newConfig.AuthDir)
 		}
+	}
+	// The listener and the watched directory are set up at startup.
+	if oldConfig != nil && oldConfig.Port != newConfig.Port {
+		log.Warnf("ignoring port change from %d to %d until restart", oldConfig.Port, newConfig.Port)
+	}
+	if oldConfig != nil && oldConfig.ListenSocket != newConfig.ListenSocket {
+		log.Warnf("ignoring listen-socket change from %q to %q until restart", oldConfig.ListenSocket, newConfig.ListenSocket)
+	}
+	if oldConfig != nil && oldConfig.AuthDir != newConfig.AuthDir {
+		log.Warnf("auth-dir changed from %s to %s: token files are loaded from the new directory, but changes to them are only watched after a restart", oldConfig.AuthDir, newConfig.AuthDir)
+	}
+	if oldConfig != nil {
+		if oldConfig.MigrateAuthFiles != newConfig.MigrateAuthFiles {
+			log.Debugf("  migrate-auth-files: %t -> %t", oldConfig.MigrateAuthFiles, newConfig.MigrateAuthFiles)
+		}
 		if oldConfig.Debug != newConfig.Debug {
 			log.Debugf("  debug: %t -> %t", oldConfig.Debug, newConfig.Debug)
 		}
+		if oldConfig.LoadBalance != newConfig.LoadBalance {
+			log.Debugf("  load-balance: %q -> %q", oldConfig.LoadBalance, newConfig.LoadBalance)
+		}
 		if oldConfig.ProxyURL != newConfig.ProxyURL {
 			log.Debugf("  proxy-url: %s -> %s", oldConfig.ProxyURL, newConfig.ProxyURL)
 		}
 		if oldConfig.RequestLog != newConfig.RequestLog {
 			log.Debugf("  request-log: %t -> %t", oldConfig.RequestLog, newConfig.RequestLog)
 		}
+		if oldConfig.RequestLogSampleRate != newConfig.RequestLogSampleRate {
+			log.Debugf("  request-log-sample-rate: %v -> %v", oldConfig.RequestLogSampleRate, newConfig.RequestLogSampleRate)
+		}
+		if oldConfig.LogRequests != newConfig.LogRequests {
+			log.Debugf("  log-requests: %q -> %q", oldConfig.LogRequests, newConfig.LogRequests)
+		}
 		if oldConfig.RequestRetry != newConfig.RequestRetry {
 			log.Debugf("  request-retry: %d -> %d", oldConfig.RequestRetry, newConfig.RequestRetry)
 		}
+		if oldConfig.SameAccountRetry != newConfig.SameAccountRetry {
+			log.Debugf("  same-account-retry: %d -> %d", oldConfig.SameAccountRetry, newConfig.SameAccountRetry)
+		}
+		if oldConfig.MaxUpstreamAttempts != newConfig.MaxUpstreamAttempts {
+			log.Debugf("  max-upstream-attempts: %d -> %d", oldConfig.MaxUpstreamAttempts, newConfig.MaxUpstreamAttempts)
+		}
+		if oldConfig.RequestTimeoutSeconds != newConfig.RequestTimeoutSeconds {
+			log.Debugf("  request-timeout-seconds: %d -> %d", oldConfig.RequestTimeoutSeconds, newConfig.RequestTimeoutSeconds)
+		}
+		if oldConfig.StreamIdleTimeoutSeconds != newConfig.StreamIdleTimeoutSeconds {
+			log.Debugf("  stream-idle-timeout-seconds: %d -> %d", oldConfig.StreamIdleTimeoutSeconds, newConfig.StreamIdleTimeoutSeconds)
+		}
+		if oldConfig.Overload.MaxActiveRequests != newConfig.Overload.MaxActiveRequests {
+			log.Debugf("  overload.max-active-requests: %d -> %d", oldConfig.Overload.MaxActiveRequests, newConfig.Overload.MaxActiveRequests)
+		}
+		if oldConfig.Overload.RetryAfterSeconds != newConfig.Overload.RetryAfterSeconds {
+			log.Debugf("  overload.retry-after-seconds: %d -> %d", oldConfig.Overload.RetryAfterSeconds, newConfig.Overload.RetryAfterSeconds)
+		}
+		if oldConfig.GlobalRateLimit.RequestsPerSecond != newConfig.GlobalRateLimit.RequestsPerSecond {
+			log.Debugf("  global-rate-limit.requests-per-second: %g -> %g", oldConfig.GlobalRateLimit.RequestsPerSecond, newConfig.GlobalRateLimit.RequestsPerSecond)
+		}
+		if oldConfig.GlobalRateLimit.Burst != newConfig.GlobalRateLimit.Burst {
+			log.Debugf("  global-rate-limit.burst: %d -> %d", oldConfig.GlobalRateLimit.Burst, newConfig.GlobalRateLimit.Burst)
+		}
+		if oldConfig.CaseInsensitiveModels != newConfig.CaseInsensitiveModels {
+			log.Debugf("  case-insensitive-models: %t -> %t", oldConfig.CaseInsensitiveModels, newConfig.CaseInsensitiveModels)
+		}
+		if oldConfig.StrictNumericParams != newConfig.StrictNumericParams {
+			log.Debugf("  strict-numeric-params: %t -> %t", oldConfig.StrictNumericParams, newConfig.StrictNumericParams)
+		}
+		if oldConfig.StrictReasoningEffort != newConfig.StrictReasoningEffort {
+			log.Debugf("  strict-reasoning-effort: %t -> %t", oldConfig.StrictReasoningEffort, newConfig.StrictReasoningEffort)
+		}
+		if oldConfig.TrimLeadingWhitespace != newConfig.TrimLeadingWhitespace {
+			log.Debugf("  trim-leading-whitespace: %t -> %t", oldConfig.TrimLeadingWhitespace, newConfig.TrimLeadingWhitespace)
+		}
+		if oldConfig.DropDuplicateChunks != newConfig.DropDuplicateChunks {
+			log.Debugf("  drop-duplicate-chunks: %t -> %t", oldConfig.DropDuplicateChunks, newConfig.DropDuplicateChunks)
+		}
+		if oldConfig.StreamBuffer.MinChars != newConfig.StreamBuffer.MinChars {
+			log.Debugf("  stream-buffer.min-chars: %d -> %d", oldConfig.StreamBuffer.MinChars, newConfig.StreamBuffer.MinChars)
+		}
+		if oldConfig.StreamBuffer.MaxDelayMs != newConfig.StreamBuffer.MaxDelayMs {
+			log.Debugf("  stream-buffer.max-delay-ms: %d -> %d", oldConfig.StreamBuffer.MaxDelayMs, newConfig.StreamBuffer.MaxDelayMs)
+		}
+		if oldConfig.StreamChannelBuffer != newConfig.StreamChannelBuffer {
+			log.Debugf("  stream-channel-buffer: %d -> %d", oldConfig.StreamChannelBuffer, newConfig.StreamChannelBuffer)
+		}
+		if oldConfig.DuplicateToolCallIDs != newConfig.DuplicateToolCallIDs {
+			log.Debugf("  duplicate-tool-call-ids: %s -> %s", oldConfig.DuplicateToolCallIDs, newConfig.DuplicateToolCallIDs)
+		}
+		if oldConfig.FallbackResponse != newConfig.FallbackResponse {
+			log.Debugf("  fallback-response: %q -> %q", oldConfig.FallbackResponse, newConfig.FallbackResponse)
+		}
+		if oldConfig.RecitationRetry != newConfig.RecitationRetry {
+			log.Debugf("  recitation-retry: %t -> %t", oldConfig.RecitationRetry, newConfig.RecitationRetry)
+		}
+		if oldConfig.QuotaExceeded.CooldownSeconds != newConfig.QuotaExceeded.CooldownSeconds {
+			log.Debugf("  quota-exceeded.cooldown-seconds: %d -> %d", oldConfig.QuotaExceeded.CooldownSeconds, newConfig.QuotaExceeded.CooldownSeconds)
+		}
+		if oldConfig.StreamErrors != newConfig.StreamErrors {
+			log.Debugf("  stream-errors: %q -> %q", oldConfig.StreamErrors, newConfig.StreamErrors)
+		}
+		if oldConfig.FinishMessage != newConfig.FinishMessage {
+			log.Debugf("  finish-message: %q -> %q", oldConfig.FinishMessage, newConfig.FinishMessage)
+		}
+		if oldConfig.StructuredOutput.MaxRetries != newConfig.StructuredOutput.MaxRetries {
+			log.Debugf("  structured-output.max-retries: %d -> %d", oldConfig.StructuredOutput.MaxRetries, newConfig.StructuredOutput.MaxRetries)
+		}
+		if oldConfig.StructuredOutput.OnFailure != newConfig.StructuredOutput.OnFailure {
+			log.Debugf("  structured-output.on-failure: %q -> %q", oldConfig.StructuredOutput.OnFailure, newConfig.StructuredOutput.OnFailure)
+		}
+		if oldConfig.ResponseLanguage.Language != newConfig.ResponseLanguage.Language {
+			log.Debugf("  response-language.language: %q -> %q", oldConfig.ResponseLanguage.Language, newConfig.ResponseLanguage.Language)
+		}
+		if oldConfig.ResponseLanguage.Validate != newConfig.ResponseLanguage.Validate {
+			log.Debugf("  response-language.validate: %q -> %q", oldConfig.ResponseLanguage.Validate, newConfig.ResponseLanguage.Validate)
+		}
 		if oldConfig.GeminiWeb.Context != newConfig.GeminiWeb.Context {
 			log.Debugf("  gemini-web.context: %t -> %t", oldConfig.GeminiWeb.Context, newConfig.GeminiWeb.Context)
 		}
@@ -251,12 +391,177 @@ func (w *Watcher) reloadConfig() bool {
 		if oldConfig.GeminiWeb.CodeMode != newConfig.GeminiWeb.CodeMode {
 			log.Debugf("  gemini-web.code-mode: %t -> %t", oldConfig.GeminiWeb.CodeMode, newConfig.GeminiWeb.CodeMode)
 		}
+		if oldConfig.Metrics.Listen != newConfig.Metrics.Listen {
+			log.Debugf("  metrics.listen: %s -> %s (takes effect after a restart)", oldConfig.Metrics.Listen, newConfig.Metrics.Listen)
+		}
+		if oldConfig.Metrics.TTFTExcludeThinking != newConfig.Metrics.TTFTExcludeThinking {
+			log.Debugf("  metrics.ttft-exclude-thinking: %t -> %t", oldConfig.Metrics.TTFTExcludeThinking, newConfig.Metrics.TTFTExcludeThinking)
+		}
+		if len(oldConfig.CORS.AllowedOrigins) != len(newConfig.CORS.AllowedOrigins) {
+			log.Debugf("  cors.allowed-origins count: %d -> %d", len(oldConfig.CORS.AllowedOrigins), len(newConfig.CORS.AllowedOrigins))
+		}
+		if oldConfig.CORS.AllowCredentials != newConfig.CORS.AllowCredentials {
+			log.Debugf("  cors.allow-credentials: %t -> %t", oldConfig.CORS.AllowCredentials, newConfig.CORS.AllowCredentials)
+		}
+		if len(oldConfig.ReasoningBudgets) != len(newConfig.ReasoningBudgets) {
+			log.Debugf("  reasoning-budgets count: %d -> %d", len(oldConfig.ReasoningBudgets), len(newConfig.ReasoningBudgets))
+		}
+		if oldConfig.HistoryLimit.MaxMessages != newConfig.HistoryLimit.MaxMessages {
+			log.Debugf("  history-limit.max-messages: %d -> %d", oldConfig.HistoryLimit.MaxMessages, newConfig.HistoryLimit.MaxMessages)
+		}
+		if oldConfig.HistoryLimit.Note != newConfig.HistoryLimit.Note {
+			log.Debugf("  history-limit.note: %t -> %t", oldConfig.HistoryLimit.Note, newConfig.HistoryLimit.Note)
+		}
+		if oldConfig.SystemPrompt.Prefix != newConfig.SystemPrompt.Prefix {
+			log.Debugf("  system-prompt.prefix: %d -> %d characters", len(oldConfig.SystemPrompt.Prefix), len(newConfig.SystemPrompt.Prefix))
+		}
+		if oldConfig.SystemPrompt.Suffix != newConfig.SystemPrompt.Suffix {
+			log.Debugf("  system-prompt.suffix: %d -> %d characters", len(oldConfig.SystemPrompt.Suffix), len(newConfig.SystemPrompt.Suffix))
+		}
+		if oldConfig.ContextSummarization.Enabled != newConfig.ContextSummarization.Enabled {
+			log.Debugf("  context-summarization.enabled: %t -> %t", oldConfig.ContextSummarization.Enabled, newConfig.ContextSummarization.Enabled)
+		}
+		if oldConfig.ContextSummarization.Model != newConfig.ContextSummarization.Model {
+			log.Debugf("  context-summarization.model: %s -> %s", oldConfig.ContextSummarization.Model, newConfig.ContextSummarization.Model)
+		}
+		if oldConfig.ContextSummarization.KeepRecentMessages != newConfig.ContextSummarization.KeepRecentMessages {
+			log.Debugf("  context-summarization.keep-recent-messages: %d -> %d", oldConfig.ContextSummarization.KeepRecentMessages, newConfig.ContextSummarization.KeepRecentMessages)
+		}
+		if oldConfig.ContextSummarization.TriggerTokens != newConfig.ContextSummarization.TriggerTokens {
+			log.Debugf("  context-summarization.trigger-tokens: %d -> %d", oldConfig.ContextSummarization.TriggerTokens, newConfig.ContextSummarization.TriggerTokens)
+		}
+		if oldConfig.ToolLimits.MaxDeclarations != newConfig.ToolLimits.MaxDeclarations {
+			log.Debugf("  tool-limits.max-declarations: %d -> %d", oldConfig.ToolLimits.MaxDeclarations, newConfig.ToolLimits.MaxDeclarations)
+		}
+		if oldConfig.ToolLimits.MaxSchemaBytes != newConfig.ToolLimits.MaxSchemaBytes {
+			log.Debugf("  tool-limits.max-schema-bytes: %d -> %d", oldConfig.ToolLimits.MaxSchemaBytes, newConfig.ToolLimits.MaxSchemaBytes)
+		}
+		if oldConfig.ToolLimits.MaxSchemaDepth != newConfig.ToolLimits.MaxSchemaDepth {
+			log.Debugf("  tool-limits.max-schema-depth: %d -> %d", oldConfig.ToolLimits.MaxSchemaDepth, newConfig.ToolLimits.MaxSchemaDepth)
+		}
+		if oldConfig.ToolLimits.PruneDescriptions != newConfig.ToolLimits.PruneDescriptions {
+			log.Debugf("  tool-limits.prune-descriptions: %t -> %t", oldConfig.ToolLimits.PruneDescriptions, newConfig.ToolLimits.PruneDescriptions)
+		}
+		if oldConfig.ToolLimits.Truncate != newConfig.ToolLimits.Truncate {
+			log.Debugf("  tool-limits.truncate: %t -> %t", oldConfig.ToolLimits.Truncate, newConfig.ToolLimits.Truncate)
+		}
+		if oldConfig.ToolResults.MaxBytes != newConfig.ToolResults.MaxBytes {
+			log.Debugf("  tool-results.max-bytes: %d -> %d", oldConfig.ToolResults.MaxBytes, newConfig.ToolResults.MaxBytes)
+		}
+		if oldConfig.ToolResults.Policy != newConfig.ToolResults.Policy {
+			log.Debugf("  tool-results.policy: %s -> %s", oldConfig.ToolResults.Policy, newConfig.ToolResults.Policy)
+		}
+		if oldConfig.ToolResults.OffloadDir != newConfig.ToolResults.OffloadDir {
+			log.Debugf("  tool-results.offload-dir: %s -> %s", oldConfig.ToolResults.OffloadDir, newConfig.ToolResults.OffloadDir)
+		}
+		if oldConfig.ImageDownscale.Enabled != newConfig.ImageDownscale.Enabled {
+			log.Debugf("  image-downscale.enabled: %t -> %t", oldConfig.ImageDownscale.Enabled, newConfig.ImageDownscale.Enabled)
+		}
+		if oldConfig.ImageDownscale.MaxDimension != newConfig.ImageDownscale.MaxDimension {
+			log.Debugf("  image-downscale.max-dimension: %d -> %d", oldConfig.ImageDownscale.MaxDimension, newConfig.ImageDownscale.MaxDimension)
+		}
+		if oldConfig.ImageDownscale.MaxBytes != newConfig.ImageDownscale.MaxBytes {
+			log.Debugf("  image-downscale.max-bytes: %d -> %d", oldConfig.ImageDownscale.MaxBytes, newConfig.ImageDownscale.MaxBytes)
+		}
+		if oldConfig.ImageDownscale.JPEGQuality != newConfig.ImageDownscale.JPEGQuality {
+			log.Debugf("  image-downscale.jpeg-quality: %d -> %d", oldConfig.ImageDownscale.JPEGQuality, newConfig.ImageDownscale.JPEGQuality)
+		}
+		if oldConfig.InvalidSamplingParams != newConfig.InvalidSamplingParams {
+			log.Debugf("  invalid-sampling-params: %q -> %q", oldConfig.InvalidSamplingParams, newConfig.InvalidSamplingParams)
+		}
+		if oldConfig.DistributionLogInterval != newConfig.DistributionLogInterval {
+			log.Debugf("  distribution-log-interval: %d -> %d", oldConfig.DistributionLogInterval, newConfig.DistributionLogInterval)
+		}
+		if oldConfig.ConnectionWarmupInterval != newConfig.ConnectionWarmupInterval {
+			log.Debugf("  connection-warmup-interval: %d -> %d", oldConfig.ConnectionWarmupInterval, newConfig.ConnectionWarmupInterval)
+		}
+		if oldConfig.HealthCheck.Enabled != newConfig.HealthCheck.Enabled {
+			log.Debugf("  health-check.enabled: %t -> %t", oldConfig.HealthCheck.Enabled, newConfig.HealthCheck.Enabled)
+		}
+		if oldConfig.HealthCheck.HealthyInterval != newConfig.HealthCheck.HealthyInterval {
+			log.Debugf("  health-check.healthy-interval: %d -> %d", oldConfig.HealthCheck.HealthyInterval, newConfig.HealthCheck.HealthyInterval)
+		}
+		if oldConfig.HealthCheck.FailingInterval != newConfig.HealthCheck.FailingInterval {
+			log.Debugf("  health-check.failing-interval: %d -> %d", oldConfig.HealthCheck.FailingInterval, newConfig.HealthCheck.FailingInterval)
+		}
+		if oldConfig.HealthCheck.MaxBackoff != newConfig.HealthCheck.MaxBackoff {
+			log.Debugf("  health-check.max-backoff: %d -> %d", oldConfig.HealthCheck.MaxBackoff, newConfig.HealthCheck.MaxBackoff)
+		}
+		if oldConfig.APIVersions.GeminiCLI != newConfig.APIVersions.GeminiCLI {
+			log.Debugf("  api-versions.gemini-cli: %q -> %q", oldConfig.APIVersions.GeminiCLI, newConfig.APIVersions.GeminiCLI)
+		}
+		if oldConfig.APIVersions.Gemini != newConfig.APIVersions.Gemini {
+			log.Debugf("  api-versions.gemini: %q -> %q", oldConfig.APIVersions.Gemini, newConfig.APIVersions.Gemini)
+		}
+		if oldConfig.APIVersions.Detect != newConfig.APIVersions.Detect {
+			log.Debugf("  api-versions.detect: %t -> %t", oldConfig.APIVersions.Detect, newConfig.APIVersions.Detect)
+		}
+		if oldConfig.RequestCapture.Enabled != newConfig.RequestCapture.Enabled {
+			log.Debugf("  request-capture.enabled: %t -> %t", oldConfig.RequestCapture.Enabled, newConfig.RequestCapture.Enabled)
+		}
+		if oldConfig.RequestCapture.Dir != newConfig.RequestCapture.Dir {
+			log.Debugf("  request-capture.dir: %s -> %s", oldConfig.RequestCapture.Dir, newConfig.RequestCapture.Dir)
+		}
+		if oldConfig.RequestDedup.Enabled != newConfig.RequestDedup.Enabled {
+			log.Debugf("  request-dedup.enabled: %t -> %t", oldConfig.RequestDedup.Enabled, newConfig.RequestDedup.Enabled)
+		}
+		if oldConfig.RequestDedup.WindowSeconds != newConfig.RequestDedup.WindowSeconds {
+			log.Debugf("  request-dedup.window-seconds: %d -> %d", oldConfig.RequestDedup.WindowSeconds, newConfig.RequestDedup.WindowSeconds)
+		}
+		if oldConfig.RequestDedup.MaxBufferedChunks != newConfig.RequestDedup.MaxBufferedChunks {
+			log.Debugf("  request-dedup.max-buffered-chunks: %d -> %d", oldConfig.RequestDedup.MaxBufferedChunks, newConfig.RequestDedup.MaxBufferedChunks)
+		}
+		if oldConfig.Onboarding.MaxConcurrent != newConfig.Onboarding.MaxConcurrent {
+			log.Debugf("  onboarding.max-concurrent: %d -> %d", oldConfig.Onboarding.MaxConcurrent, newConfig.Onboarding.MaxConcurrent)
+		}
+		if oldConfig.Onboarding.PollsPerMinute != newConfig.Onboarding.PollsPerMinute {
+			log.Debugf("  onboarding.polls-per-minute: %d -> %d", oldConfig.Onboarding.PollsPerMinute, newConfig.Onboarding.PollsPerMinute)
+		}
+		if oldConfig.Onboarding.AutoSelectProject != newConfig.Onboarding.AutoSelectProject {
+			log.Debugf("  onboarding.auto-select-project: %t -> %t", oldConfig.Onboarding.AutoSelectProject, newConfig.Onboarding.AutoSelectProject)
+		}
+		if len(oldConfig.AccountAliases) != len(newConfig.AccountAliases) {
+			log.Debugf("  account-aliases count: %d -> %d", len(oldConfig.AccountAliases), len(newConfig.AccountAliases))
+		}
+		if len(oldConfig.StopOnToolCall) != len(newConfig.StopOnToolCall) {
+			log.Debugf("  stop-on-tool-call count: %d -> %d", len(oldConfig.StopOnToolCall), len(newConfig.StopOnToolCall))
+		}
+		if len(oldConfig.FlushToolCalls) != len(newConfig.FlushToolCalls) {
+			log.Debugf("  flush-tool-calls count: %d -> %d", len(oldConfig.FlushToolCalls), len(newConfig.FlushToolCalls))
+		}
+		if oldConfig.IncludeThoughts != newConfig.IncludeThoughts {
+			log.Debugf("  include-thoughts: %t -> %t", oldConfig.IncludeThoughts, newConfig.IncludeThoughts)
+		}
+		if len(oldConfig.ThinkingOutput) != len(newConfig.ThinkingOutput) {
+			log.Debugf("  thinking-output count: %d -> %d", len(oldConfig.ThinkingOutput), len(newConfig.ThinkingOutput))
+		}
+		if len(oldConfig.PromptTemplates) != len(newConfig.PromptTemplates) {
+			log.Debugf("  prompt-templates count: %d -> %d", len(oldConfig.PromptTemplates), len(newConfig.PromptTemplates))
+		}
+		if len(oldConfig.DefaultSafetySettings) != len(newConfig.DefaultSafetySettings) {
+			log.Debugf("  default-safety-settings count: %d -> %d", len(oldConfig.DefaultSafetySettings), len(newConfig.DefaultSafetySettings))
+		}
+		if !slices.Equal(oldConfig.DefaultGroundingModels, newConfig.DefaultGroundingModels) {
+			log.Debugf("  default-grounding-models: %v -> %v", oldConfig.DefaultGroundingModels, newConfig.DefaultGroundingModels)
+		}
+		if oldConfig.PartOrdering != newConfig.PartOrdering {
+			log.Debugf("  part-ordering: %q -> %q", oldConfig.PartOrdering, newConfig.PartOrdering)
+		}
+		if oldConfig.UnsupportedPenalties != newConfig.UnsupportedPenalties {
+			log.Debugf("  unsupported-penalties: %q -> %q", oldConfig.UnsupportedPenalties, newConfig.UnsupportedPenalties)
+		}
 		if len(oldConfig.APIKeys) != len(newConfig.APIKeys) {
 			log.Debugf("  api-keys count: %d -> %d", len(oldConfig.APIKeys), len(newConfig.APIKeys))
 		}
+		if len(oldConfig.APIKeySettings) != len(newConfig.APIKeySettings) {
+			log.Debugf("  api-key-settings count: %d -> %d", len(oldConfig.APIKeySettings), len(newConfig.APIKeySettings))
+		}
 		if len(oldConfig.GlAPIKey) != len(newConfig.GlAPIKey) {
 			log.Debugf("  generative-language-api-key count: %d -> %d", len(oldConfig.GlAPIKey), len(newConfig.GlAPIKey))
 		}
+		if !slices.Equal(oldConfig.GlAPIKeyWeights, newConfig.GlAPIKeyWeights) {
+			log.Debugf("  generative-language-api-key-weights: %v -> %v", oldConfig.GlAPIKeyWeights, newConfig.GlAPIKeyWeights)
+		}
 		if len(oldConfig.ClaudeKey) != len(newConfig.ClaudeKey) {
 			log.Debugf("  claude-api-key count: %d -> %d", len(oldConfig.ClaudeKey), len(newConfig.ClaudeKey))
 		}
@@ -269,6 +574,9 @@ func (w *Watcher) reloadConfig() bool {
 		if oldConfig.RemoteManagement.AllowRemote != newConfig.RemoteManagement.AllowRemote {
 			log.Debugf("  remote-management.allow-remote: %t -> %t", oldConfig.RemoteManagement.AllowRemote, newConfig.RemoteManagement.AllowRemote)
 		}
+		if oldConfig.RemoteManagement.AdminUI != newConfig.RemoteManagement.AdminUI {
+			log.Debugf("  remote-management.admin-ui: %t -> %t", oldConfig.RemoteManagement.AdminUI, newConfig.RemoteManagement.AdminUI)
+		}
 		if oldConfig.ForceGPT5Codex != newConfig.ForceGPT5Codex {
 			log.Debugf("  force-gpt-5-codex: %t -> %t", oldConfig.ForceGPT5Codex, newConfig.ForceGPT5Codex)
 		}
@@ -362,6 +670,7 @@ func (w *Watcher) createClientFromFile(path string, cfg *config.Config) (interfa
 	if len(data) == 0 {
 		return nil, nil // Not an error, just nothing to process yet.
 	}
+	data = auth.MigrateTokenFile(path, data, cfg.MigrateAuthFiles)
 
 	tokenType := ""
 	typeResult := gjson.GetBytes(data, "type")